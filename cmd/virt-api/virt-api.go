@@ -101,13 +101,21 @@ func (app *virtAPIApp) Run() {
 		Operation("spice").
 		Doc("Returns a remote-viewer configuration file. Run `man 1 remote-viewer` to learn more about the configuration format."))
 
+	console := rest.NewConsoleResource(virtCli, virtCli.CoreV1())
 	ws.Route(ws.GET(rest.ResourcePath(vmGVR) + rest.SubResourcePath("console")).
-		To(rest.NewConsoleResource(virtCli, virtCli.CoreV1()).Console).
+		To(console.Console).
 		Param(restful.QueryParameter("console", "Name of the serial console to connect to")).
+		Param(restful.QueryParameter("force", "Take over the console if it is already in use, defaults to true")).
 		Param(rest.NamespaceParam(ws)).Param(rest.NameParam(ws)).
 		Operation("console").
 		Doc("Open a websocket connection to a serial console on the specified VM."))
 
+	ws.Route(ws.GET(rest.ResourcePath(vmGVR) + rest.SubResourcePath("consoles")).
+		To(console.ListConsoles).Produces(restful.MIME_JSON).
+		Param(rest.NamespaceParam(ws)).Param(rest.NameParam(ws)).
+		Operation("consoles").
+		Doc("List the consoles and channels of the specified VM which a console can be opened on."))
+
 	restful.Add(ws)
 
 	ws.Route(ws.GET("/healthz").To(healthz.KubeConnectionHealthzFunc).Consumes(restful.MIME_JSON).Produces(restful.MIME_JSON).Doc("Health endpoint"))
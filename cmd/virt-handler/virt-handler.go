@@ -24,23 +24,28 @@ import (
 	"fmt"
 	"net/http"
 	"os"
-
+	"strings"
 	"time"
 
 	"github.com/emicklei/go-restful"
-	"github.com/libvirt/libvirt-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/pflag"
 	k8sv1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes/scheme"
 	k8coresv1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/flowcontrol"
 
 	"kubevirt.io/kubevirt/pkg/api/v1"
 	cloudinit "kubevirt.io/kubevirt/pkg/cloud-init"
 	configdisk "kubevirt.io/kubevirt/pkg/config-disk"
 	"kubevirt.io/kubevirt/pkg/controller"
+	"kubevirt.io/kubevirt/pkg/hooks"
+	kernelboot "kubevirt.io/kubevirt/pkg/kernel-boot"
 	"kubevirt.io/kubevirt/pkg/kubecli"
 	"kubevirt.io/kubevirt/pkg/logging"
 	registrydisk "kubevirt.io/kubevirt/pkg/registry-disk"
@@ -51,7 +56,10 @@ import (
 	virt_api "kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
 	virtcache "kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cache"
 	virtcli "kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cloudhypervisor"
 	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/isolation"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/stats"
 )
 
 type virtHandlerApp struct {
@@ -60,6 +68,20 @@ type virtHandlerApp struct {
 	LibvirtUri       string
 	SocketDir        string
 	EphemeralDiskDir string
+	LibvirtQPS       float32
+	LibvirtBurst     int
+	LibvirtTimeouts  virtcli.ConnectionTimeouts
+	LibvirtReadOnly  bool
+	PressureInterval time.Duration
+	Pressure         stats.PressureThresholds
+	RegistryDiskNBD  bool
+	AllowedQEMUArgs  []string
+	AdoptDomains     string
+	ReleaseVFIO      bool
+	DomainProfiles   []string
+	DumpAuditTrail   bool
+	FSTrimInterval   time.Duration
+	HookSidecars     bool
 }
 
 func newVirtHandlerApp(host *string, port *int, hostOverride *string, libvirtUri *string, socketDir *string, ephemeralDiskDir *string) *virtHandlerApp {
@@ -92,20 +114,25 @@ func (app *virtHandlerApp) Run() {
 	if err != nil {
 		panic(err)
 	}
-
-	go func() {
-		for {
-			if res := libvirt.EventRunDefaultImpl(); res != nil {
-				// Report the error somehow or break the loop.
-				log.Error().Reason(res).Msg("Listening to libvirt events failed.")
-			}
-		}
-	}()
-	domainConn, err := virtcli.NewConnection(app.LibvirtUri, "", "", 10*time.Second)
+	registrydisk.SetNBDExports(app.RegistryDiskNBD)
+	virtwrap.SetAllowedQEMUArgs(app.AllowedQEMUArgs)
+	err = virtwrap.SetAdoptDomainPattern(app.AdoptDomains)
 	if err != nil {
-		panic(fmt.Sprintf("failed to connect to libvirtd: %v", err))
+		panic(err)
+	}
+	virtwrap.SetReleaseUnusedVFIODevices(app.ReleaseVFIO)
+	virtwrap.SetReadOnly(app.LibvirtReadOnly)
+	virtwrap.SetDumpAuditTrailOnFailure(app.DumpAuditTrail)
+	err = virtwrap.SetDomainProfiles(app.DomainProfiles)
+	if err != nil {
+		panic(err)
+	}
+	virtwrap.SetHookSocketDir(app.SocketDir)
+	hooks.SetSidecarsEnabled(app.HookSidecars)
+	err = kernelboot.SetLocalDirectory(app.EphemeralDiskDir + "/kernel-boot-data")
+	if err != nil {
+		panic(err)
 	}
-	defer domainConn.Close()
 
 	// Create event recorder
 	virtCli, err := kubecli.GetKubevirtClient()
@@ -117,12 +144,70 @@ func (app *virtHandlerApp) Run() {
 	// TODO what is scheme used for in Recorder?
 	recorder := broadcaster.NewRecorder(scheme.Scheme, k8sv1.EventSource{Component: "virt-handler", Host: app.HostOverride})
 
-	domainManager, err := virtwrap.NewLibvirtDomainManager(domainConn,
-		recorder,
-		isolation.NewSocketBasedIsolationDetector(app.SocketDir),
-	)
-	if err != nil {
-		panic(err)
+	// The connection to libvirt stays nil with the cloud-hypervisor driver,
+	// everything which needs it is left out then
+	var domainConn virtcli.Connection
+	var domainManager virtwrap.DomainManager
+	var domainSharedInformer cache.SharedInformer
+	if cloudhypervisor.IsDriverURI(app.LibvirtUri) {
+		log.Warning().Msg("The cloud-hypervisor driver is experimental, only simple guests are supported.")
+		vmmSocketDir, err := cloudhypervisor.SocketDirFromURI(app.LibvirtUri)
+		if err != nil {
+			panic(err)
+		}
+		domainManager, err = cloudhypervisor.NewDomainManager(vmmSocketDir,
+			recorder,
+			isolation.NewSocketBasedIsolationDetector(app.SocketDir),
+		)
+		if err != nil {
+			panic(err)
+		}
+		domainSharedInformer, err = cloudhypervisor.NewSharedInformer(vmmSocketDir)
+		if err != nil {
+			panic(err)
+		}
+		prometheus.MustRegister(cloudhypervisor.NewCountersCollector(vmmSocketDir))
+	} else {
+		log.Info().V(1).Log("libvirt driver", libvirt.Driver)
+		go func() {
+			for {
+				if res := libvirt.EventRunDefaultImpl(); res != nil {
+					// Report the error somehow or break the loop.
+					log.Error().Reason(res).Msg("Listening to libvirt events failed.")
+				}
+			}
+		}()
+		connOpts := []virtcli.ConnectionOption{virtcli.WithTimeouts(app.LibvirtTimeouts)}
+		if app.LibvirtQPS > 0 {
+			connOpts = append(connOpts, virtcli.WithRateLimiter(flowcontrol.NewTokenBucketRateLimiter(app.LibvirtQPS, app.LibvirtBurst)))
+		}
+		if app.LibvirtReadOnly {
+			log.Warning().Msg("The connection to libvirt is read only, VMs are observed but not changed.")
+			connOpts = append(connOpts, virtcli.WithReadOnly())
+		}
+		domainConn, err = virtcli.NewConnection(app.LibvirtUri, connOpts...)
+		if err != nil {
+			panic(fmt.Sprintf("failed to connect to libvirtd: %v", err))
+		}
+		defer domainConn.Close()
+
+		domainManager, err = virtwrap.NewLibvirtDomainManager(domainConn,
+			recorder,
+			isolation.NewSocketBasedIsolationDetector(app.SocketDir),
+		)
+		if err != nil {
+			panic(err)
+		}
+
+		// Let VMs which need capabilities only some hosts have find this one
+		if err := virthandler.LabelNodeCapabilities(virtCli.CoreV1().Nodes(), domainConn, app.HostOverride); err != nil {
+			log.Error().Reason(err).Msg("Labeling the node with the capabilities of the host failed.")
+		}
+
+		domainSharedInformer, err = virtcache.NewSharedInformer(domainConn)
+		if err != nil {
+			panic(err)
+		}
 	}
 
 	l, err := labels.Parse(fmt.Sprintf(v1.NodeNameLabel+" in (%s)", app.HostOverride))
@@ -137,11 +222,7 @@ func (app *virtHandlerApp) Run() {
 	vmStore, vmQueue, vmController := virthandler.NewVMController(vmListWatcher, domainManager, recorder, *virtCli.RestClient(), virtCli, app.HostOverride, configDiskClient)
 
 	// Wire Domain controller
-	domainSharedInformer, err := virtcache.NewSharedInformer(domainConn)
-	if err != nil {
-		panic(err)
-	}
-	domainStore, domainController := virthandler.NewDomainController(vmQueue, vmStore, domainSharedInformer, *virtCli.RestClient(), recorder)
+	domainStore, domainController := virthandler.NewDomainController(vmQueue, vmStore, domainSharedInformer, *virtCli.RestClient(), recorder, domainManager)
 
 	if err != nil {
 		panic(err)
@@ -165,44 +246,158 @@ func (app *virtHandlerApp) Run() {
 	vmController.StartInformer(stop)
 	vmController.WaitForSync(stop)
 
-	err = configDiskClient.UndefineUnseen(vmStore)
+	// Recover the state of domains which were defined before we started
+	// and remove the ones whose VM is gone
+	err = domainManager.ReconcileExistingGuests(vmStore)
 	if err != nil {
 		panic(err)
 	}
 
-	err = registrydisk.CleanupOrphanedEphemeralDisks(vmStore)
-	if err != nil {
-		panic(err)
+	// Orphaned data might still be used by domains we only observe
+	if !app.LibvirtReadOnly {
+		err = configDiskClient.UndefineUnseen(vmStore)
+		if err != nil {
+			panic(err)
+		}
+
+		err = registrydisk.CleanupOrphanedEphemeralDisks(vmStore)
+		if err != nil {
+			panic(err)
+		}
+
+		err = kernelboot.CleanupOrphanedKernelBootData(vmStore)
+		if err != nil {
+			panic(err)
+		}
 	}
 
 	go domainController.Run(3, stop)
 	go vmController.Run(3, stop)
 
+	if app.PressureInterval > 0 && domainConn != nil {
+		sampler := stats.NewPressureSampler(domainConn, app.PressureInterval, app.Pressure)
+		go sampler.Run(stop)
+		go recordPressureEvents(sampler.Events(), vmStore, recorder)
+	}
+
+	if app.FSTrimInterval > 0 && !app.LibvirtReadOnly {
+		go virtwrap.NewFSTrimScheduler(domainManager, vmStore, app.FSTrimInterval).Run(stop)
+	}
+
 	// TODO add a http handler which provides health check
 
 	// Add websocket route to access consoles remotely
-	console := rest.NewConsoleResource(domainConn)
-	migrationHostInfo := rest.NewMigrationHostInfo(isolation.NewSocketBasedIsolationDetector(app.SocketDir))
+	serial := rest.NewSerialPortResource(virtwrap.PortKindSerial)
+	parallel := rest.NewSerialPortResource(virtwrap.PortKindParallel)
+	hypervisorLog := rest.NewHypervisorLogResource()
+	auditTrail := rest.NewAuditTrailResource(domainManager)
+	domainJobs := rest.NewJobsResource(domainManager)
+	launchSecurity := rest.NewLaunchSecurityResource(domainManager)
+	clock := rest.NewClockResource(domainManager)
 	ws := new(restful.WebService)
-	ws.Route(ws.GET("/api/v1/namespaces/{namespace}/virtualmachines/{name}/console").To(console.Console))
-	ws.Route(ws.GET("/api/v1/namespaces/{namespace}/virtualmachines/{name}/migrationHostInfo").To(migrationHostInfo.MigrationHostInfo))
+	ws.Route(ws.GET("/api/v1/namespaces/{namespace}/virtualmachines/{name}/serial/{port}").To(serial.SerialPort))
+	ws.Route(ws.GET("/api/v1/namespaces/{namespace}/virtualmachines/{name}/parallel/{port}").To(parallel.SerialPort))
+	ws.Route(ws.GET("/api/v1/namespaces/{namespace}/virtualmachines/{name}/hypervisorlog").To(hypervisorLog.HypervisorLog))
+	ws.Route(ws.GET("/api/v1/namespaces/{namespace}/virtualmachines/{name}/audit").To(auditTrail.AuditTrail))
+	ws.Route(ws.GET("/api/v1/namespaces/{namespace}/virtualmachines/{name}/jobs").To(domainJobs.ListJobs))
+	ws.Route(ws.GET("/api/v1/namespaces/{namespace}/virtualmachines/{name}/launchmeasurement").To(launchSecurity.LaunchMeasurement))
+	ws.Route(ws.GET("/api/v1/namespaces/{namespace}/virtualmachines/{name}/rtcoffset").To(clock.RTCOffset))
+	// Only libvirt domains have consoles, screenshots and stats, the console
+	// of cloud-hypervisor guests is their serial port 0
+	if domainConn != nil {
+		console := rest.NewConsoleResource(domainConn)
+		screenshot := rest.NewScreenshotResource(domainConn)
+		domainStats := rest.NewStatsResource(stats.NewCollector(domainConn, stats.DefaultCollectorTTL))
+		migrationHostInfo := rest.NewMigrationHostInfo(isolation.NewSocketBasedIsolationDetector(app.SocketDir), domainConn)
+		ws.Route(ws.GET("/api/v1/namespaces/{namespace}/virtualmachines/{name}/console").To(console.Console))
+		ws.Route(ws.GET("/api/v1/namespaces/{namespace}/virtualmachines/{name}/consoles").To(console.ListConsoles))
+		ws.Route(ws.GET("/api/v1/namespaces/{namespace}/virtualmachines/{name}/screenshot").To(screenshot.Screenshot))
+		ws.Route(ws.GET("/api/v1/namespaces/{namespace}/virtualmachines/{name}/interfacestats").To(domainStats.InterfaceStats))
+		ws.Route(ws.GET("/api/v1/namespaces/{namespace}/virtualmachines/{name}/diskstats").To(domainStats.DiskStats))
+		ws.Route(ws.GET("/api/v1/namespaces/{namespace}/virtualmachines/{name}/migrationHostInfo").To(migrationHostInfo.MigrationHostInfo))
+	}
 	restful.DefaultContainer.Add(ws)
+	// Expose the latency and error metrics of the libvirt calls, or the
+	// counters of the cloud-hypervisor guests
+	restful.DefaultContainer.Handle("/metrics", promhttp.Handler())
 	server := &http.Server{Addr: app.Service.Address(), Handler: restful.DefaultContainer}
 	server.ListenAndServe()
 }
 
+// recordPressureEvents turns threshold crossings of the domain pressure into
+// events on the VMs, so that controllers can react on them.
+func recordPressureEvents(events <-chan stats.PressureEvent, vmStore cache.Store, recorder record.EventRecorder) {
+	for event := range events {
+		namespace, name := virtcache.SplitVMNamespaceKey(event.Domain)
+		obj, exists, err := vmStore.GetByKey(namespace + "/" + name)
+		if err != nil || !exists {
+			continue
+		}
+		vm := obj.(*v1.VirtualMachine)
+		if event.Exceeded {
+			recorder.Eventf(vm, k8sv1.EventTypeWarning, v1.PressureHigh.String(), "%s is at %.2f, above the threshold of %.2f", event.Resource, event.Value, event.Threshold)
+		} else {
+			recorder.Eventf(vm, k8sv1.EventTypeNormal, v1.PressureRelieved.String(), "%s is at %.2f, back below the threshold of %.2f", event.Resource, event.Value, event.Threshold)
+		}
+	}
+}
+
 func main() {
 	logging.InitializeLogging("virt-handler")
 	libvirt.EventRegisterDefaultImpl()
-	libvirtUri := flag.String("libvirt-uri", "qemu:///system", "Libvirt connection string.")
+	libvirtUri := flag.String("libvirt-uri", "qemu:///system", "Libvirt connection string, or ch+unix:///<socket dir> for the experimental cloud-hypervisor driver")
 	host := flag.String("listen", "0.0.0.0", "Address where to listen on")
 	port := flag.Int("port", 8185, "Port to listen on")
 	hostOverride := flag.String("hostname-override", "", "Kubernetes Pod to monitor for changes")
 	socketDir := flag.String("socket-dir", "/var/run/kubevirt", "Directory where to look for sockets for cgroup detection")
 	ephemeralDiskDir := flag.String("ephemeral-disk-dir", "/var/run/libvirt/kubevirt-ephemeral-disk", "Base directory for ephemeral disk data")
+	libvirtQPS := flag.Float64("libvirt-qps", 0, "Maximum number of libvirt connection calls, like domain lookups and definitions, per second, 0 disables the limit")
+	libvirtBurst := flag.Int("libvirt-burst", 100, "Maximum number of libvirt calls in a burst")
+	libvirtConnectTimeout := flag.Duration("libvirt-connect-timeout", virtcli.DefaultConnectTimeout, "How long to wait for libvirtd on startup")
+	libvirtConnectRetryInterval := flag.Duration("libvirt-connect-retry-interval", virtcli.DefaultConnectRetryInterval, "Interval in which connecting to libvirtd is retried on startup")
+	libvirtReadOnly := flag.Bool("libvirt-read-only", false, "Only observe VMs, all calls to libvirt which would change something fail")
+	libvirtCheckInterval := flag.Duration("libvirt-check-interval", virtcli.DefaultCheckInterval, "Interval in which the libvirtd connection is checked for being alive")
+	pressureInterval := flag.Duration("pressure-interval", 0, "Interval in which the pressure of the domains is sampled, 0 disables sampling")
+	pressureDirtyRate := flag.Uint64("pressure-dirty-rate", 0, "Pages per second a migrating domain may dirty before it is under pressure")
+	pressureCPUSteal := flag.Float64("pressure-cpu-steal", 0, "Percentage of CPU steal above which a domain is under pressure")
+	pressureSwapRate := flag.Uint64("pressure-swap-rate", 0, "KiB per second a domain may swap before it is under pressure")
+	registryDiskNBD := flag.Bool("registry-disk-nbd", false, "Serve registry disks to qemu through qemu-nbd")
+	allowedQEMUArgs := flag.String("allowed-qemu-args", "", "Comma separated qemu options, e.g. -global, which VMs may pass to qemu")
+	adoptDomains := flag.String("adopt-domains-matching", "", "Watch domains which were not defined by KubeVirt and whose name matches this shell pattern, instead of removing them")
+	releaseVFIO := flag.Bool("release-vfio-devices", false, "Give PCI devices which are bound to vfio-pci but not used by any domain back to the host on startup")
+	domainProfiles := flag.String("domain-profiles", "", "Comma separated profiles with the machine type and qemu defaults of this host, e.g. q35,rhel")
+	dumpAuditTrail := flag.Bool("dump-audit-trail", false, "Log the recent operations on a domain when an operation on it fails")
+	fstrimInterval := flag.Duration("fstrim-check-interval", virtwrap.DefaultFSTrimCheckInterval, "Interval in which VMs are checked for being due to an fstrim, 0 disables scheduled trims")
+	hookSidecars := flag.Bool("enable-hook-sidecars", false, "Call the hook sidecars of VMs before their domains are defined")
 	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
 	pflag.Parse()
 
 	app := newVirtHandlerApp(host, port, hostOverride, libvirtUri, socketDir, ephemeralDiskDir)
+	app.LibvirtQPS = float32(*libvirtQPS)
+	app.LibvirtBurst = *libvirtBurst
+	app.LibvirtReadOnly = *libvirtReadOnly
+	app.LibvirtTimeouts = virtcli.ConnectionTimeouts{
+		Connect:       *libvirtConnectTimeout,
+		RetryInterval: *libvirtConnectRetryInterval,
+		CheckInterval: *libvirtCheckInterval,
+	}
+	app.PressureInterval = *pressureInterval
+	app.Pressure = stats.PressureThresholds{
+		DirtyRate: *pressureDirtyRate,
+		CPUSteal:  *pressureCPUSteal,
+		SwapRate:  *pressureSwapRate,
+	}
+	app.RegistryDiskNBD = *registryDiskNBD
+	app.AdoptDomains = *adoptDomains
+	app.ReleaseVFIO = *releaseVFIO
+	app.DumpAuditTrail = *dumpAuditTrail
+	app.FSTrimInterval = *fstrimInterval
+	app.HookSidecars = *hookSidecars
+	if *domainProfiles != "" {
+		app.DomainProfiles = strings.Split(*domainProfiles, ",")
+	}
+	if *allowedQEMUArgs != "" {
+		app.AllowedQEMUArgs = strings.Split(*allowedQEMUArgs, ",")
+	}
 	app.Run()
 }
@@ -72,7 +72,9 @@ func main() {
 	socket := createSocket(*socketDir, *namespace, *name)
 	defer socket.Close()
 
-	mon := virtlauncher.NewProcessMonitor("qemu", *debugMode)
+	// qemu is started by libvirt, cloud-hypervisor by virt-handler if it
+	// uses the cloud-hypervisor driver
+	mon := virtlauncher.NewProcessMonitor([]string{"qemu", "cloud-hypervisor"}, *debugMode)
 
 	markReady(*readinessFile)
 	mon.RunForever(*qemuTimeout)
@@ -52,7 +52,9 @@ func (app *virtManifestApp) Run() {
 
 	log.Info().Msg("Connecting to libvirt")
 
-	domainConn, err := cli.NewConnection(app.LibvirtUri, "", "", 60*time.Second)
+	timeouts := cli.DefaultConnectionTimeouts()
+	timeouts.CheckInterval = 60 * time.Second
+	domainConn, err := cli.NewConnection(app.LibvirtUri, cli.WithTimeouts(timeouts))
 	if err != nil {
 		log.Error().Reason(err).Msg("cannot connect to libvirt")
 		panic(fmt.Sprintf("failed to connect to libvirt: %v", err))
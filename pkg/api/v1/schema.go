@@ -33,23 +33,122 @@ type CloudInitDataSourceNoCloud struct {
 	UserDataBase64 string `json:"userDataBase64"`
 	// The NoCloud cloud-init metadata as a base64 encoded string
 	MetaDataBase64 string `json:"metaDataBase64"`
+	// Reference to a k8s config map that contains NoCloud userdata
+	// +optional
+	UserDataConfigMapRef string `json:"userDataConfigMapRef,omitempty"`
+	// The NoCloud cloud-init network configuration as a base64 encoded string
+	// +optional
+	NetworkDataBase64 string `json:"networkDataBase64,omitempty"`
+	// Reference to a k8s config map that contains the NoCloud network configuration
+	// +optional
+	NetworkDataConfigMapRef string `json:"networkDataConfigMapRef,omitempty"`
+}
+
+// http://cloudinit.readthedocs.io/en/latest/topics/datasources/configdrive.html
+type CloudInitDataSourceConfigDrive struct {
+	// Reference to a k8s secret that contains ConfigDrive userdata
+	UserDataSecretRef string `json:"userDataSecretRef"`
+	// The ConfigDrive cloud-init userdata as a base64 encoded string
+	UserDataBase64 string `json:"userDataBase64"`
+	// The ConfigDrive cloud-init metadata as a base64 encoded JSON document
+	MetaDataBase64 string `json:"metaDataBase64"`
+	// Reference to a k8s config map that contains ConfigDrive userdata
+	// +optional
+	UserDataConfigMapRef string `json:"userDataConfigMapRef,omitempty"`
+	// The ConfigDrive network data as a base64 encoded JSON document
+	// +optional
+	NetworkDataBase64 string `json:"networkDataBase64,omitempty"`
+	// Reference to a k8s config map that contains the ConfigDrive network data
+	// +optional
+	NetworkDataConfigMapRef string `json:"networkDataConfigMapRef,omitempty"`
 }
 
 // Only one of the fields in the CloudInitSpec can be set
 type CloudInitSpec struct {
 	// Nocloud DataSource
 	NoCloudData *CloudInitDataSourceNoCloud `json:"nocloud"`
+	// ConfigDrive DataSource
+	ConfigDriveData *CloudInitDataSourceConfigDrive `json:"configdrive,omitempty"`
 
 	// Add future cloud init datasource structures below.
 }
 
 type DomainSpec struct {
-	Memory  Memory   `json:"memory"`
-	Type    string   `json:"type"`
-	OS      OS       `json:"os"`
-	SysInfo *SysInfo `json:"sysInfo,omitempty"`
-	Devices Devices  `json:"devices"`
-	Clock   *Clock   `json:"clock,omitempty"`
+	Memory        Memory         `json:"memory"`
+	MemoryBacking *MemoryBacking `json:"memoryBacking,omitempty"`
+	VCPU          *VCPU          `json:"vcpu,omitempty"`
+	Type          string         `json:"type"`
+	OS            OS             `json:"os"`
+	Features      *Features      `json:"features,omitempty"`
+	SysInfo       *SysInfo       `json:"sysInfo,omitempty"`
+	Devices       Devices        `json:"devices"`
+	Clock         *Clock         `json:"clock,omitempty"`
+	// IOThreadsPolicy assigns IOThreads to virtio disks without an explicit
+	// IOThread, shared puts all of them on one IOThread, auto gives each one
+	// its own
+	// +optional
+	IOThreadsPolicy string `json:"ioThreadsPolicy,omitempty"`
+	// IOThreads which the disks can explicitly be assigned to
+	// +optional
+	IOThreads *IOThreads `json:"ioThreads,omitempty"`
+	// QEMUArgs are passed to qemu as they are, e.g. ["-global", "ICH9-LPC.noreboot=off"].
+	// Every option which is allowed on the host has to be followed by its value
+	// +optional
+	QEMUArgs []string `json:"qemuArgs,omitempty"`
+	// CoreDumpOnCrash keeps crashed guests around until a core dump of
+	// their memory was written on the host
+	// +optional
+	CoreDumpOnCrash bool `json:"coreDumpOnCrash,omitempty"`
+	// PerfEvents are the perf events which are counted for the guest, e.g.
+	// cache_misses, instructions or cpu_cycles. Changes are applied to
+	// running guests
+	// +optional
+	PerfEvents []string `json:"perfEvents,omitempty"`
+	// CrashPolicy decides what happens to the VM if qemu or the guest
+	// crashed, by default the VM fails
+	// +optional
+	CrashPolicy *CrashPolicy `json:"crashPolicy,omitempty"`
+	// SEV encrypts the guest memory with AMD Secure Encrypted
+	// Virtualization, it requires a UEFI guest on a q35 machine
+	// +optional
+	SEV *SEV `json:"sev,omitempty"`
+}
+
+type SEV struct {
+	// Policy bits of the guest, defaults to 0x0003 which forbids debugging
+	// and key sharing
+	// +optional
+	Policy *uint32 `json:"policy,omitempty"`
+	// EncryptedState enables SEV-ES, which also encrypts the CPU registers
+	// +optional
+	EncryptedState bool `json:"encryptedState,omitempty"`
+	// DHCert is the base64 encoded Diffie-Hellman key of the guest owner
+	// +optional
+	DHCert string `json:"dhCert,omitempty"`
+	// Session is the base64 encoded session blob of the guest owner
+	// +optional
+	Session string `json:"session,omitempty"`
+}
+
+type CrashAction string
+
+const (
+	// CrashActionNone lets the VM fail
+	CrashActionNone CrashAction = "None"
+	// CrashActionRestart starts the guest again on the same node
+	CrashActionRestart CrashAction = "Restart"
+	// CrashActionReport only reports the crash and leaves the VM and the
+	// crashed guest alone
+	CrashActionReport CrashAction = "Report"
+)
+
+type CrashPolicy struct {
+	// Action to take after a crash, None, Restart or Report
+	Action CrashAction `json:"action,omitempty"`
+	// Number of times the guest is restarted before the VM fails, defaults
+	// to 3
+	// +optional
+	MaxRestarts uint `json:"maxRestarts,omitempty"`
 }
 
 type Memory struct {
@@ -57,16 +156,71 @@ type Memory struct {
 	Unit  string `json:"unit"`
 }
 
+type VCPU struct {
+	// Number of virtual CPUs of the guest
+	CPUs uint `json:"cpus"`
+	// DedicatedCPUPlacement requests as many CPUs for the virt-launcher Pod
+	// as the guest has vCPUs and pins every vCPU to its own CPU out of the
+	// ones the kubelet CPU manager dedicated to the Pod. The CPU manager only
+	// dedicates CPUs to Pods with the guaranteed QoS class
+	// +optional
+	DedicatedCPUPlacement bool `json:"dedicatedCpuPlacement,omitempty"`
+}
+
+type IOThreads struct {
+	// Number of IOThreads, they are numbered starting with 1
+	Count uint `json:"count"`
+}
+
+// MemoryBacking influences how the guest memory is backed by the host
+type MemoryBacking struct {
+	// Back the guest memory with hugepages instead of normal pages
+	HugePages *HugePages `json:"hugepages,omitempty"`
+	// Access mode of the guest memory, vhost-user interfaces need it to be shared
+	Access *MemoryAccess `json:"access,omitempty"`
+}
+
+type MemoryAccess struct {
+	// Either shared or private
+	Mode string `json:"mode"`
+}
+
+type HugePages struct {
+	HugePage []HugePage `json:"page,omitempty"`
+}
+
+type HugePage struct {
+	// Size of the hugepages, e.g. 2048 with unit KiB or 1 with unit G
+	Size uint `json:"size"`
+	// Unit of the size, defaults to KiB
+	Unit string `json:"unit,omitempty"`
+	// Guest NUMA nodes which should use this page size, e.g. "0-1,3"
+	NodeSet string `json:"nodeset,omitempty"`
+}
+
 type Devices struct {
-	Emulator   string      `json:"emulator,omitempty"`
-	Interfaces []Interface `json:"interfaces,omitempty"`
-	Channels   []Channel   `json:"channels,omitempty"`
-	Video      []Video     `json:"video,omitempty"`
-	Graphics   []Graphics  `json:"graphics,omitempty"`
-	Ballooning *Ballooning `json:"memballoon,omitempty"`
-	Disks      []Disk      `json:"disks,omitempty"`
-	Serials    []Serial    `json:"serials,omitempty"`
-	Consoles   []Console   `json:"consoles,omitempty"`
+	Emulator    string           `json:"emulator,omitempty"`
+	Interfaces  []Interface      `json:"interfaces,omitempty"`
+	Channels    []Channel        `json:"channels,omitempty"`
+	Video       []Video          `json:"video,omitempty"`
+	Graphics    []Graphics       `json:"graphics,omitempty"`
+	Ballooning  *Ballooning      `json:"memballoon,omitempty"`
+	Disks       []Disk           `json:"disks,omitempty"`
+	Serials     []Serial         `json:"serials,omitempty"`
+	Parallels   []Parallel       `json:"parallels,omitempty"`
+	Consoles    []Console        `json:"consoles,omitempty"`
+	HostDevices []HostDevice     `json:"hostDevices,omitempty"`
+	Watchdog    *Watchdog        `json:"watchdog,omitempty"`
+	Rng         *RandomGenerator `json:"rng,omitempty"`
+	TPM         *TPM             `json:"tpm,omitempty"`
+	Controllers []Controller     `json:"controllers,omitempty"`
+	Sounds      []Sound          `json:"sounds,omitempty"`
+	Inputs      []Input          `json:"inputs,omitempty"`
+	Redirects   []RedirDev       `json:"redirects,omitempty"`
+	// Give virtio disks and interfaces without an explicit number of queues
+	// one queue per vCPU
+	// +optional
+	MultiQueue bool `json:"multiQueue,omitempty"`
 }
 
 // BEGIN Disk -----------------------------
@@ -82,6 +236,20 @@ type Disk struct {
 	ReadOnly  *ReadOnly      `json:"readOnly,omitempty"`
 	Auth      *DiskAuth      `json:"auth,omitempty"`
 	CloudInit *CloudInitSpec `json:"cloudinit,omitempty"`
+	// IOTune limits the IOPS and the bandwidth of the disk, changes are applied to running VMs
+	IOTune *DiskIOTune `json:"ioTune,omitempty"`
+	// Encryption opens a LUKS encrypted disk with the passphrase from a k8s secret
+	Encryption *DiskEncryption `json:"encryption,omitempty"`
+	// Ephemeral file disks are not written to, all writes go to an overlay
+	// which is thrown away when the VM is stopped
+	Ephemeral bool `json:"ephemeral,omitempty"`
+	// BootOrder of the disk, can't be combined with the boot devices of the OS
+	// +optional
+	BootOrder *BootOrder `json:"boot,omitempty"`
+	// Address pins the disk to a PCI address, virtio disks without one get a
+	// stable address assigned
+	// +optional
+	Address *Address `json:"address,omitempty"`
 }
 
 type DiskAuth struct {
@@ -94,6 +262,14 @@ type DiskSecret struct {
 	Usage string `json:"usage"`
 }
 
+type DiskEncryption struct {
+	// Format of the encryption, only "luks" is supported
+	Format string `json:"format"`
+	// Secret of type "passphrase", whose usage is the name of a k8s secret
+	// in the namespace of the VM with a "passphrase" entry
+	Secret *DiskSecret `json:"secret,omitempty"`
+}
+
 type ReadOnly struct{}
 
 type DiskSource struct {
@@ -102,6 +278,15 @@ type DiskSource struct {
 	Protocol      string          `json:"protocol,omitempty"`
 	Name          string          `json:"name,omitempty"`
 	Host          *DiskSourceHost `json:"host,omitempty"`
+	// Additional hosts of a network disk, e.g. the other monitors of a Ceph
+	// cluster or the other portals of an iSCSI target
+	Hosts []DiskSourceHost `json:"hosts,omitempty"`
+	// Initiator to log into an iSCSI target with
+	Initiator *DiskSourceInitiator `json:"initiator,omitempty"`
+}
+
+type DiskSourceInitiator struct {
+	IQN string `json:"iqn"`
 }
 
 type DiskTarget struct {
@@ -109,28 +294,93 @@ type DiskTarget struct {
 	Device string `json:"dev"`
 }
 
+// DiskIOTune holds the IO limits of a disk, 0 means unlimited
+type DiskIOTune struct {
+	TotalBytesSec uint64 `json:"totalBytesSec,omitempty"`
+	ReadBytesSec  uint64 `json:"readBytesSec,omitempty"`
+	WriteBytesSec uint64 `json:"writeBytesSec,omitempty"`
+	TotalIopsSec  uint64 `json:"totalIopsSec,omitempty"`
+	ReadIopsSec   uint64 `json:"readIopsSec,omitempty"`
+	WriteIopsSec  uint64 `json:"writeIopsSec,omitempty"`
+}
+
 type DiskDriver struct {
 	Cache       string `json:"cache,omitempty"`
 	ErrorPolicy string `json:"errorPolicy,omitempty"`
 	IO          string `json:"io,omitempty"`
 	Name        string `json:"name,omitempty"`
 	Type        string `json:"type,omitempty"`
+	// Number of queues of a virtio disk
+	// +optional
+	Queues uint `json:"queues,omitempty"`
+	// IOThread which handles the IO of a virtio disk
+	// +optional
+	IOThread uint `json:"ioThread,omitempty"`
+	// Discard passes discard requests of the guest on to the storage with
+	// unmap, or drops them with ignore, which is the default
+	// +optional
+	Discard string `json:"discard,omitempty"`
 }
 
 type DiskSourceHost struct {
 	Name string `json:"name"`
 	Port string `json:"port,omitempty"`
+	// Transport to reach the host, "tcp" or "unix"
+	Transport string `json:"transport,omitempty"`
+	// Path of the socket for the unix transport
+	Socket string `json:"socket,omitempty"`
 }
 
 // END Disk -----------------------------
 
+// BEGIN HostDevice -----------------------------
+
+// HostDevice passes a device of the host, like a PCI device or an SR-IOV VF, through to the guest
+type HostDevice struct {
+	// Mode of the device, only "subsystem" is supported
+	Mode string `json:"mode"`
+	// Type of the device, e.g. "pci" or "mdev"
+	Type    string `json:"type"`
+	Managed string `json:"managed,omitempty"`
+	// Model of a mediated device, e.g. "vfio-pci"
+	Model   string           `json:"model,omitempty"`
+	Source  HostDeviceSource `json:"source"`
+	Address *Address         `json:"address,omitempty"`
+	Alias   *Alias           `json:"alias,omitempty"`
+	// BootOrder of a PCI device, e.g. of a SR-IOV VF which boots with PXE
+	// +optional
+	BootOrder *BootOrder `json:"boot,omitempty"`
+}
+
+type HostDeviceSource struct {
+	// Address of the device on the host
+	Address *Address `json:"address,omitempty"`
+	// MdevParent is the PCI device on which a mediated device of MdevType
+	// is created for the VM, e.g. 0000:06:00.0
+	// +optional
+	MdevParent string `json:"mdevParent,omitempty"`
+	// MdevType of the mediated device to create, e.g. nvidia-35
+	// +optional
+	MdevType string `json:"mdevType,omitempty"`
+}
+
+// END HostDevice -----------------------------
+
 // BEGIN Serial -----------------------------
 
+// Serial adds a serial port to the VM. Ports of type unix are bound to a
+// unix socket on the host, which can be accessed through virt-handler.
 type Serial struct {
 	Type   string        `json:"type"`
 	Target *SerialTarget `json:"target,omitempty"`
 }
 
+// Parallel adds a parallel port to the VM, like Serial
+type Parallel struct {
+	Type   string        `json:"type"`
+	Target *SerialTarget `json:"target,omitempty"`
+}
+
 type SerialTarget struct {
 	Port *uint `json:"port,omitempty"`
 }
@@ -165,13 +415,52 @@ type Interface struct {
 	LinkState *LinkState       `json:"link,omitempty"`
 	FilterRef *FilterRef       `json:"filterRef,omitempty"`
 	Alias     *Alias           `json:"alias,omitempty"`
+	Driver    *InterfaceDriver `json:"driver,omitempty"`
+	// ROM replaces the option ROM of the interface, e.g. with an iPXE build
+	// which network boots the guest
+	// +optional
+	ROM *InterfaceROM `json:"rom,omitempty"`
+}
+
+type InterfaceROM struct {
+	// File of the ROM, it has to be in one of the ROM directories of the host
+	// +optional
+	File string `json:"file,omitempty"`
+	// Enabled "no" removes the ROM, an interface without ROM can't boot
+	// +optional
+	Enabled string `json:"enabled,omitempty"`
+	// BAR "off" hides the ROM from the guest, only the firmware sees it
+	// +optional
+	BAR string `json:"bar,omitempty"`
+}
+
+type InterfaceDriver struct {
+	// Number of queues of a virtio interface
+	// +optional
+	Queues uint `json:"queues,omitempty"`
 }
 
 type LinkState struct {
 	State string `json:"state"`
 }
 
+// BandWidth limits the traffic of an interface, changes are applied to running VMs
 type BandWidth struct {
+	// Traffic received by the VM
+	Inbound *BandWidthRate `json:"inbound,omitempty"`
+	// Traffic sent by the VM
+	Outbound *BandWidthRate `json:"outbound,omitempty"`
+}
+
+type BandWidthRate struct {
+	// Average bit rate in kilobytes per second
+	Average uint `json:"average"`
+	// Maximum rate in kilobytes per second at which bursts can be sent
+	// +optional
+	Peak uint `json:"peak,omitempty"`
+	// Amount of kilobytes which can be sent in a single burst at peak speed
+	// +optional
+	Burst uint `json:"burst,omitempty"`
 }
 
 type BootOrder struct {
@@ -182,14 +471,27 @@ type MAC struct {
 	MAC string `json:"address"`
 }
 
+// FilterRef applies a libvirt network filter, e.g. clean-traffic, to the interface
 type FilterRef struct {
 	Filter string `json:"filter"`
+	// Parameters of the filter, e.g. the IP address which the VM may use
+	// +optional
+	Parameters []FilterParameter `json:"parameters,omitempty"`
+}
+
+type FilterParameter struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
 }
 
 type InterfaceSource struct {
 	Network string `json:"network,omitempty"`
 	Device  string `json:"device,omitempty"`
 	Bridge  string `json:"bridge,omitempty"`
+	// Path of the unix socket of a vhostuser interface
+	Path string `json:"path,omitempty"`
+	// Whether qemu acts as client or server on the vhostuser socket, defaults to client
+	Mode string `json:"mode,omitempty"`
 }
 
 type Model struct {
@@ -213,6 +515,10 @@ type OS struct {
 	BootOrder []Boot    `json:"bootOrder"`
 	BootMenu  *BootMenu `json:"bootMenu,omitempty"`
 	BIOS      *BIOS     `json:"bios,omitempty"`
+	Loader    *Loader   `json:"loader,omitempty"`
+	NVRam     *NVRam    `json:"nvram,omitempty"`
+	// KernelBoot boots the VM directly from a kernel and initrd, bypassing the bootloader
+	KernelBoot *KernelBoot `json:"kernelBoot,omitempty"`
 }
 
 type OSType struct {
@@ -239,12 +545,42 @@ type BootMenu struct {
 	Timeout *uint `json:"timeout,omitempty"`
 }
 
-// TODO <loader readonly='yes' secure='no' type='rom'>/usr/lib/xen/boot/hvmloader</loader>
-type BIOS struct {
+// KernelBoot describes where the kernel and the initrd of a direct kernel boot come from
+type KernelBoot struct {
+	// Path of the kernel inside the source
+	Kernel string `json:"kernel"`
+	// Path of the initrd inside the source
+	// +optional
+	Initrd string `json:"initrd,omitempty"`
+	// Command line which is passed to the kernel
+	// +optional
+	KernelArgs string           `json:"kernelArgs,omitempty"`
+	Source     KernelBootSource `json:"source"`
+}
+
+// KernelBootSource holds either a container image or a persistent volume claim
+type KernelBootSource struct {
+	// Container image which contains the kernel and the initrd, it needs to provide a shell
+	// +optional
+	Image string `json:"image,omitempty"`
+	// Name of a persistent volume claim in the namespace of the VM
+	// +optional
+	PersistentVolumeClaim string `json:"persistentVolumeClaim,omitempty"`
 }
 
 // TODO <bios useserial='yes' rebootTimeout='0'/>
+type BIOS struct {
+}
+
+// Loader selects the firmware of the VM, e.g. OVMF for UEFI
 type Loader struct {
+	ReadOnly string `json:"readOnly,omitempty"`
+	// Secure enables Secure Boot, requires a q35 machine and SMM
+	Secure string `json:"secure,omitempty"`
+	// Type of the loader, "rom" or "pflash". UEFI requires pflash
+	Type string `json:"type,omitempty"`
+	// Path to the firmware, defaults to the OVMF firmware for pflash loaders
+	Path string `json:"path,omitempty"`
 }
 
 type SysInfo struct {
@@ -261,15 +597,101 @@ type Entry struct {
 
 //END OS --------------------
 
+//BEGIN Features --------------------
+
+type Features struct {
+	ACPI *FeatureEnabled `json:"acpi,omitempty"`
+	// System Management Mode, required for Secure Boot
+	SMM *FeatureState `json:"smm,omitempty"`
+	// Hyperv enlightenments make Windows guests aware that they run on a
+	// hypervisor
+	// +optional
+	Hyperv *FeatureHyperv `json:"hyperv,omitempty"`
+}
+
+type FeatureEnabled struct {
+}
+
+type FeatureState struct {
+	// State of the feature, "on" or "off"
+	State string `json:"state,omitempty"`
+}
+
+// FeatureHyperv lists the Hyper-V enlightenments of a Windows guest
+type FeatureHyperv struct {
+	Relaxed *FeatureState `json:"relaxed,omitempty"`
+	VAPIC   *FeatureState `json:"vapic,omitempty"`
+	// Spinlocks makes the guest notify the hypervisor after the given
+	// number of spinlock retries, defaults to 8191
+	// +optional
+	Spinlocks *FeatureSpinlocks `json:"spinlocks,omitempty"`
+	// VPIndex is required by SyNIC
+	// +optional
+	VPIndex *FeatureState `json:"vpindex,omitempty"`
+	SyNIC   *FeatureState `json:"synic,omitempty"`
+	// SyNICTimer requires SyNIC and the hypervclock timer
+	// +optional
+	SyNICTimer *FeatureState `json:"stimer,omitempty"`
+	Reset      *FeatureState `json:"reset,omitempty"`
+	// VendorID is reported to the guest instead of the KVM one, at most 12
+	// characters long
+	// +optional
+	VendorID    *FeatureVendorID `json:"vendorid,omitempty"`
+	Frequencies *FeatureState    `json:"frequencies,omitempty"`
+}
+
+type FeatureSpinlocks struct {
+	State   string  `json:"state,omitempty"`
+	Retries *uint32 `json:"retries,omitempty"`
+}
+
+type FeatureVendorID struct {
+	State string `json:"state,omitempty"`
+	Value string `json:"value,omitempty"`
+}
+
+//END Features --------------------
+
 //BEGIN Clock --------------------
 
 type Clock struct {
+	// Offset of the guest RTC, utc, localtime, timezone or variable.
+	// Windows guests expect localtime
+	// +optional
+	Offset string `json:"offset,omitempty"`
+	// Timezone of the RTC if the offset is timezone, e.g. Europe/Paris
+	// +optional
+	Timezone string `json:"timezone,omitempty"`
+	// Adjustment in seconds of the RTC relative to the basis if the
+	// offset is variable
+	// +optional
+	Adjustment *int64 `json:"adjustment,omitempty"`
+	// Basis of a variable offset, utc or localtime
+	// +optional
+	Basis string `json:"basis,omitempty"`
+	// Timers of the guest, e.g. hypervclock for Windows guests
+	// +optional
+	Timer []Timer `json:"timer,omitempty"`
 }
 
 type Timer struct {
-	Name       string `json:"name"`
+	// Name of the timer, platform, pit, rtc, hpet, tsc, kvmclock or
+	// hypervclock
+	Name string `json:"name"`
+	// TickPolicy decides what happens to missed ticks, delay, catchup,
+	// merge or discard
+	// +optional
 	TickPolicy string `json:"tickPolicy,omitempty"`
 	Present    string `json:"present,omitempty"`
+	// Track is what the rtc timer follows, boot, guest or wall
+	// +optional
+	Track string `json:"track,omitempty"`
+	// Frequency of the tsc timer in Hz
+	// +optional
+	Frequency *uint64 `json:"frequency,omitempty"`
+	// Mode of the tsc timer, auto, native, emulate, paravirt or smpsafe
+	// +optional
+	Mode string `json:"mode,omitempty"`
 }
 
 //END Clock --------------------
@@ -331,6 +753,8 @@ type Address struct {
 	Bus      string `json:"bus"`
 	Slot     string `json:"slot"`
 	Function string `json:"function"`
+	// UUID of a mediated device
+	UUID string `json:"uuid,omitempty"`
 }
 
 //END Video -------------------
@@ -339,10 +763,90 @@ type Ballooning struct {
 	Model string `json:"model"`
 }
 
+// Watchdog resets or stops the VM if the guest stops feeding it
+type Watchdog struct {
+	// Model of the watchdog, e.g. "i6300esb"
+	Model string `json:"model"`
+	// Action to take when the watchdog fires: reset, shutdown, poweroff, pause, none or dump
+	Action string `json:"action,omitempty"`
+}
+
+// RandomGenerator feeds the guest with entropy from the host
 type RandomGenerator struct {
+	// Model of the device, defaults to "virtio"
+	Model string `json:"model,omitempty"`
+	// Limits the amount of entropy the guest can consume
+	Rate    *RngRate   `json:"rate,omitempty"`
+	Backend RngBackend `json:"backend,omitempty"`
+}
+
+type RngRate struct {
+	// Bytes the guest may consume per period
+	Bytes uint `json:"bytes"`
+	// Period in milliseconds, defaults to 1000
+	Period uint `json:"period,omitempty"`
+}
+
+type RngBackend struct {
+	// Model of the backend, only "random" is supported
+	Model string `json:"model,omitempty"`
+	// Entropy source on the host, /dev/urandom, /dev/random or /dev/hwrng. Defaults to /dev/urandom
+	Source string `json:"source,omitempty"`
+}
+
+// TPM adds an emulated TPM, backed by swtpm, to the VM
+type TPM struct {
+	// Model of the TPM, e.g. "tpm-tis" or "tpm-crb"
+	Model   string     `json:"model,omitempty"`
+	Backend TPMBackend `json:"backend"`
+	// Keep the TPM state when the VM is stopped, instead of starting with a fresh TPM every time
+	Persistent bool `json:"persistent,omitempty"`
+	// Name of a k8s secret in the namespace of the VM, whose "passphrase"
+	// is used to encrypt the TPM state
+	EncryptionSecret string `json:"encryptionSecret,omitempty"`
+}
+
+type TPMBackend struct {
+	// Type of the backend, only "emulator" is supported
+	Type string `json:"type"`
+	// TPM version, e.g. "2.0"
+	Version string `json:"version,omitempty"`
+}
+
+// Controller adds a controller, e.g. a USB controller, to the VM
+type Controller struct {
+	// Type of the controller, e.g. "usb"
+	Type string `json:"type"`
+	// Index of the controller among the controllers of the same type
+	Index string `json:"index,omitempty"`
+	// Model of the controller, e.g. "qemu-xhci" or "none" to disable USB
+	Model string `json:"model,omitempty"`
+}
+
+// Sound adds a sound card to the VM
+type Sound struct {
+	// Model of the sound card, ich9, ich6 or ac97. Defaults to ich9
+	Model string `json:"model,omitempty"`
+}
+
+// Input adds an input device to the VM, a tablet gives the graphical
+// console an absolute pointer
+type Input struct {
+	// Type of the device, tablet, keyboard or mouse
+	Type string `json:"type"`
+	// Bus of the device, usb, virtio or ps2. Defaults to usb
+	Bus string `json:"bus,omitempty"`
+}
+
+// RedirDev redirects USB devices of the SPICE client to the VM
+type RedirDev struct {
+	// Bus of the redirection, only "usb" is supported
+	Bus string `json:"bus,omitempty"`
+	// Type of the redirection, only "spicevmc" is supported
+	Type string `json:"type,omitempty"`
 }
 
-// TODO ballooning, rng, cpu ...
+// TODO ballooning, cpu ...
 
 func NewMinimalDomainSpec() *DomainSpec {
 	domain := DomainSpec{OS: OS{Type: OSType{OS: "hvm"}}, Type: "qemu"}
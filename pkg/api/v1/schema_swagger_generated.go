@@ -4,34 +4,121 @@ package v1
 
 func (CloudInitDataSourceNoCloud) SwaggerDoc() map[string]string {
 	return map[string]string{
-		"":                  "http://cloudinit.readthedocs.io/en/latest/topics/datasources/nocloud.html",
-		"userDataSecretRef": "Reference to a k8s secret that contains NoCloud userdata",
-		"userDataBase64":    "The NoCloud cloud-init userdata as a base64 encoded string",
-		"metaDataBase64":    "The NoCloud cloud-init metadata as a base64 encoded string",
+		"":                        "http://cloudinit.readthedocs.io/en/latest/topics/datasources/nocloud.html",
+		"userDataSecretRef":       "Reference to a k8s secret that contains NoCloud userdata",
+		"userDataBase64":          "The NoCloud cloud-init userdata as a base64 encoded string",
+		"metaDataBase64":          "The NoCloud cloud-init metadata as a base64 encoded string",
+		"userDataConfigMapRef":    "Reference to a k8s config map that contains NoCloud userdata\n+optional",
+		"networkDataBase64":       "The NoCloud cloud-init network configuration as a base64 encoded string\n+optional",
+		"networkDataConfigMapRef": "Reference to a k8s config map that contains the NoCloud network configuration\n+optional",
+	}
+}
+
+func (CloudInitDataSourceConfigDrive) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"":                        "http://cloudinit.readthedocs.io/en/latest/topics/datasources/configdrive.html",
+		"userDataSecretRef":       "Reference to a k8s secret that contains ConfigDrive userdata",
+		"userDataBase64":          "The ConfigDrive cloud-init userdata as a base64 encoded string",
+		"metaDataBase64":          "The ConfigDrive cloud-init metadata as a base64 encoded JSON document",
+		"userDataConfigMapRef":    "Reference to a k8s config map that contains ConfigDrive userdata\n+optional",
+		"networkDataBase64":       "The ConfigDrive network data as a base64 encoded JSON document\n+optional",
+		"networkDataConfigMapRef": "Reference to a k8s config map that contains the ConfigDrive network data\n+optional",
 	}
 }
 
 func (CloudInitSpec) SwaggerDoc() map[string]string {
 	return map[string]string{
-		"":        "Only one of the fields in the CloudInitSpec can be set",
-		"nocloud": "Nocloud DataSource",
+		"":            "Only one of the fields in the CloudInitSpec can be set",
+		"nocloud":     "Nocloud DataSource",
+		"configdrive": "ConfigDrive DataSource",
 	}
 }
 
 func (DomainSpec) SwaggerDoc() map[string]string {
-	return map[string]string{}
+	return map[string]string{
+		"ioThreadsPolicy": "IOThreadsPolicy assigns IOThreads to virtio disks without an explicit\nIOThread, shared puts all of them on one IOThread, auto gives each one\nits own\n+optional",
+		"ioThreads":       "IOThreads which the disks can explicitly be assigned to\n+optional",
+		"qemuArgs":        "QEMUArgs are passed to qemu as they are, e.g. [\"-global\", \"ICH9-LPC.noreboot=off\"].\nEvery option which is allowed on the host has to be followed by its value\n+optional",
+		"coreDumpOnCrash": "CoreDumpOnCrash keeps crashed guests around until a core dump of\ntheir memory was written on the host\n+optional",
+		"perfEvents":      "PerfEvents are the perf events which are counted for the guest, e.g.\ncache_misses, instructions or cpu_cycles. Changes are applied to\nrunning guests\n+optional",
+		"crashPolicy":     "CrashPolicy decides what happens to the VM if qemu or the guest\ncrashed, by default the VM fails\n+optional",
+		"sev":             "SEV encrypts the guest memory with AMD Secure Encrypted\nVirtualization, it requires a UEFI guest on a q35 machine\n+optional",
+	}
+}
+
+func (SEV) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"policy":         "Policy bits of the guest, defaults to 0x0003 which forbids debugging\nand key sharing\n+optional",
+		"encryptedState": "EncryptedState enables SEV-ES, which also encrypts the CPU registers\n+optional",
+		"dhCert":         "DHCert is the base64 encoded Diffie-Hellman key of the guest owner\n+optional",
+		"session":        "Session is the base64 encoded session blob of the guest owner\n+optional",
+	}
+}
+
+func (CrashPolicy) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"action":      "Action to take after a crash, None, Restart or Report",
+		"maxRestarts": "Number of times the guest is restarted before the VM fails, defaults\nto 3\n+optional",
+	}
 }
 
 func (Memory) SwaggerDoc() map[string]string {
 	return map[string]string{}
 }
 
-func (Devices) SwaggerDoc() map[string]string {
+func (VCPU) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"cpus":                  "Number of virtual CPUs of the guest",
+		"dedicatedCpuPlacement": "DedicatedCPUPlacement requests as many CPUs for the virt-launcher Pod\nas the guest has vCPUs and pins every vCPU to its own CPU out of the\nones the kubelet CPU manager dedicated to the Pod. The CPU manager only\ndedicates CPUs to Pods with the guaranteed QoS class\n+optional",
+	}
+}
+
+func (IOThreads) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"count": "Number of IOThreads, they are numbered starting with 1",
+	}
+}
+
+func (MemoryBacking) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"":          "MemoryBacking influences how the guest memory is backed by the host",
+		"hugepages": "Back the guest memory with hugepages instead of normal pages",
+		"access":    "Access mode of the guest memory, vhost-user interfaces need it to be shared",
+	}
+}
+
+func (MemoryAccess) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"mode": "Either shared or private",
+	}
+}
+
+func (HugePages) SwaggerDoc() map[string]string {
 	return map[string]string{}
 }
 
+func (HugePage) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"size":    "Size of the hugepages, e.g. 2048 with unit KiB or 1 with unit G",
+		"unit":    "Unit of the size, defaults to KiB",
+		"nodeset": "Guest NUMA nodes which should use this page size, e.g. \"0-1,3\"",
+	}
+}
+
+func (Devices) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"multiQueue": "Give virtio disks and interfaces without an explicit number of queues\none queue per vCPU\n+optional",
+	}
+}
+
 func (Disk) SwaggerDoc() map[string]string {
-	return map[string]string{}
+	return map[string]string{
+		"ioTune":     "IOTune limits the IOPS and the bandwidth of the disk, changes are applied to running VMs",
+		"encryption": "Encryption opens a LUKS encrypted disk with the passphrase from a k8s secret",
+		"ephemeral":  "Ephemeral file disks are not written to, all writes go to an overlay\nwhich is thrown away when the VM is stopped",
+		"boot":       "BootOrder of the disk, can't be combined with the boot devices of the OS\n+optional",
+		"address":    "Address pins the disk to a PCI address, virtio disks without one get a\nstable address assigned\n+optional",
+	}
 }
 
 func (DiskAuth) SwaggerDoc() map[string]string {
@@ -42,11 +129,25 @@ func (DiskSecret) SwaggerDoc() map[string]string {
 	return map[string]string{}
 }
 
+func (DiskEncryption) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"format": "Format of the encryption, only \"luks\" is supported",
+		"secret": "Secret of type \"passphrase\", whose usage is the name of a k8s secret\nin the namespace of the VM with a \"passphrase\" entry",
+	}
+}
+
 func (ReadOnly) SwaggerDoc() map[string]string {
 	return map[string]string{}
 }
 
 func (DiskSource) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"hosts":     "Additional hosts of a network disk, e.g. the other monitors of a Ceph\ncluster or the other portals of an iSCSI target",
+		"initiator": "Initiator to log into an iSCSI target with",
+	}
+}
+
+func (DiskSourceInitiator) SwaggerDoc() map[string]string {
 	return map[string]string{}
 }
 
@@ -54,16 +155,55 @@ func (DiskTarget) SwaggerDoc() map[string]string {
 	return map[string]string{}
 }
 
+func (DiskIOTune) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"": "DiskIOTune holds the IO limits of a disk, 0 means unlimited",
+	}
+}
+
 func (DiskDriver) SwaggerDoc() map[string]string {
-	return map[string]string{}
+	return map[string]string{
+		"queues":   "Number of queues of a virtio disk\n+optional",
+		"ioThread": "IOThread which handles the IO of a virtio disk\n+optional",
+		"discard":  "Discard passes discard requests of the guest on to the storage with\nunmap, or drops them with ignore, which is the default\n+optional",
+	}
 }
 
 func (DiskSourceHost) SwaggerDoc() map[string]string {
-	return map[string]string{}
+	return map[string]string{
+		"transport": "Transport to reach the host, \"tcp\" or \"unix\"",
+		"socket":    "Path of the socket for the unix transport",
+	}
+}
+
+func (HostDevice) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"":      "HostDevice passes a device of the host, like a PCI device or an SR-IOV VF, through to the guest",
+		"mode":  "Mode of the device, only \"subsystem\" is supported",
+		"type":  "Type of the device, e.g. \"pci\" or \"mdev\"",
+		"model": "Model of a mediated device, e.g. \"vfio-pci\"",
+		"boot":  "BootOrder of a PCI device, e.g. of a SR-IOV VF which boots with PXE\n+optional",
+	}
+}
+
+func (HostDeviceSource) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"address":    "Address of the device on the host",
+		"mdevParent": "MdevParent is the PCI device on which a mediated device of MdevType\nis created for the VM, e.g. 0000:06:00.0\n+optional",
+		"mdevType":   "MdevType of the mediated device to create, e.g. nvidia-35\n+optional",
+	}
 }
 
 func (Serial) SwaggerDoc() map[string]string {
-	return map[string]string{}
+	return map[string]string{
+		"": "Serial adds a serial port to the VM. Ports of type unix are bound to a\nunix socket on the host, which can be accessed through virt-handler.",
+	}
+}
+
+func (Parallel) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"": "Parallel adds a parallel port to the VM, like Serial",
+	}
 }
 
 func (SerialTarget) SwaggerDoc() map[string]string {
@@ -79,7 +219,23 @@ func (ConsoleTarget) SwaggerDoc() map[string]string {
 }
 
 func (Interface) SwaggerDoc() map[string]string {
-	return map[string]string{}
+	return map[string]string{
+		"rom": "ROM replaces the option ROM of the interface, e.g. with an iPXE build\nwhich network boots the guest\n+optional",
+	}
+}
+
+func (InterfaceROM) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"file":    "File of the ROM, it has to be in one of the ROM directories of the host\n+optional",
+		"enabled": "Enabled \"no\" removes the ROM, an interface without ROM can't boot\n+optional",
+		"bar":     "BAR \"off\" hides the ROM from the guest, only the firmware sees it\n+optional",
+	}
+}
+
+func (InterfaceDriver) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"queues": "Number of queues of a virtio interface\n+optional",
+	}
 }
 
 func (LinkState) SwaggerDoc() map[string]string {
@@ -87,7 +243,19 @@ func (LinkState) SwaggerDoc() map[string]string {
 }
 
 func (BandWidth) SwaggerDoc() map[string]string {
-	return map[string]string{}
+	return map[string]string{
+		"":         "BandWidth limits the traffic of an interface, changes are applied to running VMs",
+		"inbound":  "Traffic received by the VM",
+		"outbound": "Traffic sent by the VM",
+	}
+}
+
+func (BandWidthRate) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"average": "Average bit rate in kilobytes per second",
+		"peak":    "Maximum rate in kilobytes per second at which bursts can be sent\n+optional",
+		"burst":   "Amount of kilobytes which can be sent in a single burst at peak speed\n+optional",
+	}
 }
 
 func (BootOrder) SwaggerDoc() map[string]string {
@@ -99,11 +267,21 @@ func (MAC) SwaggerDoc() map[string]string {
 }
 
 func (FilterRef) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"":           "FilterRef applies a libvirt network filter, e.g. clean-traffic, to the interface",
+		"parameters": "Parameters of the filter, e.g. the IP address which the VM may use\n+optional",
+	}
+}
+
+func (FilterParameter) SwaggerDoc() map[string]string {
 	return map[string]string{}
 }
 
 func (InterfaceSource) SwaggerDoc() map[string]string {
-	return map[string]string{}
+	return map[string]string{
+		"path": "Path of the unix socket of a vhostuser interface",
+		"mode": "Whether qemu acts as client or server on the vhostuser socket, defaults to client",
+	}
 }
 
 func (Model) SwaggerDoc() map[string]string {
@@ -119,7 +297,9 @@ func (Alias) SwaggerDoc() map[string]string {
 }
 
 func (OS) SwaggerDoc() map[string]string {
-	return map[string]string{}
+	return map[string]string{
+		"kernelBoot": "KernelBoot boots the VM directly from a kernel and initrd, bypassing the bootloader",
+	}
 }
 
 func (OSType) SwaggerDoc() map[string]string {
@@ -142,12 +322,34 @@ func (BootMenu) SwaggerDoc() map[string]string {
 	return map[string]string{}
 }
 
+func (KernelBoot) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"":           "KernelBoot describes where the kernel and the initrd of a direct kernel boot come from",
+		"kernel":     "Path of the kernel inside the source",
+		"initrd":     "Path of the initrd inside the source\n+optional",
+		"kernelArgs": "Command line which is passed to the kernel\n+optional",
+	}
+}
+
+func (KernelBootSource) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"":                      "KernelBootSource holds either a container image or a persistent volume claim",
+		"image":                 "Container image which contains the kernel and the initrd, it needs to provide a shell\n+optional",
+		"persistentVolumeClaim": "Name of a persistent volume claim in the namespace of the VM\n+optional",
+	}
+}
+
 func (BIOS) SwaggerDoc() map[string]string {
 	return map[string]string{}
 }
 
 func (Loader) SwaggerDoc() map[string]string {
-	return map[string]string{}
+	return map[string]string{
+		"":       "Loader selects the firmware of the VM, e.g. OVMF for UEFI",
+		"secure": "Secure enables Secure Boot, requires a q35 machine and SMM",
+		"type":   "Type of the loader, \"rom\" or \"pflash\". UEFI requires pflash",
+		"path":   "Path to the firmware, defaults to the OVMF firmware for pflash loaders",
+	}
 }
 
 func (SysInfo) SwaggerDoc() map[string]string {
@@ -158,14 +360,61 @@ func (Entry) SwaggerDoc() map[string]string {
 	return map[string]string{}
 }
 
-func (Clock) SwaggerDoc() map[string]string {
+func (Features) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"smm":    "System Management Mode, required for Secure Boot",
+		"hyperv": "Hyperv enlightenments make Windows guests aware that they run on a\nhypervisor\n+optional",
+	}
+}
+
+func (FeatureEnabled) SwaggerDoc() map[string]string {
 	return map[string]string{}
 }
 
-func (Timer) SwaggerDoc() map[string]string {
+func (FeatureState) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"state": "State of the feature, \"on\" or \"off\"",
+	}
+}
+
+func (FeatureHyperv) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"":          "FeatureHyperv lists the Hyper-V enlightenments of a Windows guest",
+		"spinlocks": "Spinlocks makes the guest notify the hypervisor after the given\nnumber of spinlock retries, defaults to 8191\n+optional",
+		"vpindex":   "VPIndex is required by SyNIC\n+optional",
+		"stimer":    "SyNICTimer requires SyNIC and the hypervclock timer\n+optional",
+		"vendorid":  "VendorID is reported to the guest instead of the KVM one, at most 12\ncharacters long\n+optional",
+	}
+}
+
+func (FeatureSpinlocks) SwaggerDoc() map[string]string {
+	return map[string]string{}
+}
+
+func (FeatureVendorID) SwaggerDoc() map[string]string {
 	return map[string]string{}
 }
 
+func (Clock) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"offset":     "Offset of the guest RTC, utc, localtime, timezone or variable.\nWindows guests expect localtime\n+optional",
+		"timezone":   "Timezone of the RTC if the offset is timezone, e.g. Europe/Paris\n+optional",
+		"adjustment": "Adjustment in seconds of the RTC relative to the basis if the\noffset is variable\n+optional",
+		"basis":      "Basis of a variable offset, utc or localtime\n+optional",
+		"timer":      "Timers of the guest, e.g. hypervclock for Windows guests\n+optional",
+	}
+}
+
+func (Timer) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"name":       "Name of the timer, platform, pit, rtc, hpet, tsc, kvmclock or\nhypervclock",
+		"tickPolicy": "TickPolicy decides what happens to missed ticks, delay, catchup,\nmerge or discard\n+optional",
+		"track":      "Track is what the rtc timer follows, boot, guest or wall\n+optional",
+		"frequency":  "Frequency of the tsc timer in Hz\n+optional",
+		"mode":       "Mode of the tsc timer, auto, native, emulate, paravirt or smpsafe\n+optional",
+	}
+}
+
 func (Channel) SwaggerDoc() map[string]string {
 	return map[string]string{}
 }
@@ -191,13 +440,89 @@ func (Listen) SwaggerDoc() map[string]string {
 }
 
 func (Address) SwaggerDoc() map[string]string {
-	return map[string]string{}
+	return map[string]string{
+		"uuid": "UUID of a mediated device",
+	}
 }
 
 func (Ballooning) SwaggerDoc() map[string]string {
 	return map[string]string{}
 }
 
+func (Watchdog) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"":       "Watchdog resets or stops the VM if the guest stops feeding it",
+		"model":  "Model of the watchdog, e.g. \"i6300esb\"",
+		"action": "Action to take when the watchdog fires: reset, shutdown, poweroff, pause, none or dump",
+	}
+}
+
 func (RandomGenerator) SwaggerDoc() map[string]string {
-	return map[string]string{}
+	return map[string]string{
+		"":      "RandomGenerator feeds the guest with entropy from the host",
+		"model": "Model of the device, defaults to \"virtio\"",
+		"rate":  "Limits the amount of entropy the guest can consume",
+	}
+}
+
+func (RngRate) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"bytes":  "Bytes the guest may consume per period",
+		"period": "Period in milliseconds, defaults to 1000",
+	}
+}
+
+func (RngBackend) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"model":  "Model of the backend, only \"random\" is supported",
+		"source": "Entropy source on the host, /dev/urandom, /dev/random or /dev/hwrng. Defaults to /dev/urandom",
+	}
+}
+
+func (TPM) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"":                 "TPM adds an emulated TPM, backed by swtpm, to the VM",
+		"model":            "Model of the TPM, e.g. \"tpm-tis\" or \"tpm-crb\"",
+		"persistent":       "Keep the TPM state when the VM is stopped, instead of starting with a fresh TPM every time",
+		"encryptionSecret": "Name of a k8s secret in the namespace of the VM, whose \"passphrase\"\nis used to encrypt the TPM state",
+	}
+}
+
+func (TPMBackend) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"type":    "Type of the backend, only \"emulator\" is supported",
+		"version": "TPM version, e.g. \"2.0\"",
+	}
+}
+
+func (Controller) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"":      "Controller adds a controller, e.g. a USB controller, to the VM",
+		"type":  "Type of the controller, e.g. \"usb\"",
+		"index": "Index of the controller among the controllers of the same type",
+		"model": "Model of the controller, e.g. \"qemu-xhci\" or \"none\" to disable USB",
+	}
+}
+
+func (Sound) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"":      "Sound adds a sound card to the VM",
+		"model": "Model of the sound card, ich9, ich6 or ac97. Defaults to ich9",
+	}
+}
+
+func (Input) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"":     "Input adds an input device to the VM, a tablet gives the graphical\nconsole an absolute pointer",
+		"type": "Type of the device, tablet, keyboard or mouse",
+		"bus":  "Bus of the device, usb, virtio or ps2. Defaults to usb",
+	}
+}
+
+func (RedirDev) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"":     "RedirDev redirects USB devices of the SPICE client to the VM",
+		"bus":  "Bus of the redirection, only \"usb\" is supported",
+		"type": "Type of the redirection, only \"spicevmc\" is supported",
+	}
 }
@@ -203,6 +203,34 @@ type VMStatus struct {
 	Phase VMPhase `json:"phase"`
 	// Graphics represent the details of available graphical consoles.
 	Graphics []VMGraphics `json:"graphics"`
+	// Interfaces represent the network interfaces of the VM and their addresses.
+	Interfaces []VMNetworkInterface `json:"interfaces,omitempty"`
+	// Filesystems are the filesystems mounted in the guest and their usage,
+	// only known with a guest agent.
+	Filesystems []VMFilesystem `json:"filesystems,omitempty"`
+}
+
+type VMNetworkInterface struct {
+	// MAC address of the interface
+	MAC string `json:"mac"`
+	// Name of the interface inside the guest, only known with a guest agent
+	InterfaceName string `json:"interfaceName,omitempty"`
+	// IP addresses of the interface, from the guest agent or the DHCP leases
+	// of the libvirt network
+	IPs []string `json:"ipAddresses,omitempty"`
+}
+
+type VMFilesystem struct {
+	// MountPoint of the filesystem in the guest
+	MountPoint string `json:"mountPoint"`
+	// Type of the filesystem, e.g. ext4
+	Type string `json:"type"`
+	// UsedBytes of the filesystem, only reported by recent guest agents
+	UsedBytes *uint64 `json:"usedBytes,omitempty"`
+	// TotalBytes of the filesystem, only reported by recent guest agents
+	TotalBytes *uint64 `json:"totalBytes,omitempty"`
+	// Disks of the VM the filesystem is stored on, by their target name
+	Disks []string `json:"disks,omitempty"`
 }
 
 type VMGraphics struct {
@@ -278,6 +306,12 @@ const (
 	// VMReady means the pod is able to service requests and should be added to the
 	// load balancing pools of all matching services.
 	VMReady VMConditionType = "Ready"
+	// PostCopyFailed means that the VM was lost, because the network failed
+	// while it was migrated in post-copy mode.
+	PostCopyFailed VMConditionType = "PostCopyFailed"
+	// VMPaused means that the guest of the VM is paused, e.g. because it
+	// ran out of disk space or is migrated.
+	VMPaused VMConditionType = "Paused"
 )
 
 type VMCondition struct {
@@ -325,8 +359,60 @@ const (
 	NodeNameLabel     string = "kubevirt.io/nodeName"
 	MigrationUIDLabel string = "kubevirt.io/migrationUID"
 	MigrationLabel    string = "kubevirt.io/migration"
+	// SEVLabel is set on nodes whose host can run SEV guests
+	SEVLabel          string = "kubevirt.io/sev"
 )
 
+// Annotations with this prefix set SMBIOS system entries of the VM, e.g.
+// smbios.vm.kubevirt.io/serial. They take precedence over the entries in the spec.
+const SMBIOSAnnotationPrefix string = "smbios.vm.kubevirt.io/"
+
+// FSTrimIntervalAnnotation makes virt-handler trim the filesystems of the
+// running VM through the guest agent in this interval, e.g. 24h, so that
+// thin provisioned storage gets the discarded space back.
+const FSTrimIntervalAnnotation string = "vm.kubevirt.io/fstrim-interval"
+
+// BlkioWeightAnnotation sets the blkio weight of the cgroup of the running
+// VM, between 100 and 1000, so that its disks get a larger or smaller share
+// of the bandwidth of the node.
+const BlkioWeightAnnotation string = "vm.kubevirt.io/blkio-weight"
+
+// MACAddressesAnnotation holds the MAC addresses which virt-handler allocated
+// to the interfaces of the VM, comma separated in the order of the interfaces.
+// Interfaces with a MAC address in the spec have an empty entry.
+const MACAddressesAnnotation string = "vm.kubevirt.io/mac-addresses"
+
+// DeviceAddressesAnnotation holds the disk target names and PCI addresses
+// which virt-handler assigned to the devices of the VM as JSON, so that the
+// devices keep them when the VM is started again.
+const DeviceAddressesAnnotation string = "vm.kubevirt.io/device-addresses"
+
+// HookSidecarsAnnotation lists the hook sidecars of the VM as JSON, e.g.
+// [{"image": "registry:5000/hook:devel"}]. Hook sidecars can change the
+// domain XML before it is defined.
+const HookSidecarsAnnotation string = "vm.kubevirt.io/hook-sidecars"
+
+// LaunchSecretAnnotation names the k8s secret in the namespace of the VM which
+// holds the launch secret of a SEV guest in its packetHeader and secret keys.
+// virt-handler injects it once the guest waits for it and removes the
+// annotation afterwards, since every launch has its own measurement.
+const LaunchSecretAnnotation string = "vm.kubevirt.io/sev-launch-secret"
+
+// MemoryDumpClaimAnnotation names the persistent volume claim into which the
+// memory of the VM can be dumped. The claim is mounted into the virt-launcher
+// Pod when the VM starts.
+const MemoryDumpClaimAnnotation string = "vm.kubevirt.io/memory-dump-claim"
+
+// MemoryDumpAnnotation asks virt-handler to dump the memory of the running VM
+// onto its memory dump claim, e.g. {"path": "testvm.kdump", "format":
+// "kdump-zlib"}. The annotation is removed once the dump job started.
+const MemoryDumpAnnotation string = "vm.kubevirt.io/memory-dump"
+
+// CancelJobAnnotation asks virt-handler to cancel the background job of the
+// VM with the given ID, e.g. a memory dump. The annotation is removed once
+// the job was asked to stop.
+const CancelJobAnnotation string = "vm.kubevirt.io/cancel-job"
+
 func NewVM(name string, uid types.UID) *VirtualMachine {
 	return &VirtualMachine{
 		Spec: VMSpec{},
@@ -349,21 +435,39 @@ const (
 	StartedVirtualMachineMigration   MigrationEvent = "MigrationStarted"
 	SucceededVirtualMachineMigration MigrationEvent = "MigrationSucceeded"
 	FailedVirtualMachineMigration    MigrationEvent = "MigrationFailed"
+	AbortedVirtualMachineMigration   MigrationEvent = "MigrationAborted"
 )
 
 func (s MigrationEvent) String() string {
 	return string(s)
 }
 
+type PressureEvent string
+
+const (
+	PressureHigh     PressureEvent = "PressureHigh"
+	PressureRelieved PressureEvent = "PressureRelieved"
+)
+
+func (s PressureEvent) String() string {
+	return string(s)
+}
+
 type SyncEvent string
 
 const (
-	Created    SyncEvent = "Created"
-	Deleted    SyncEvent = "Deleted"
-	Started    SyncEvent = "Started"
-	Stopped    SyncEvent = "Stopped"
-	SyncFailed SyncEvent = "SyncFailed"
-	Resumed    SyncEvent = "Resumed"
+	Created         SyncEvent = "Created"
+	Deleted         SyncEvent = "Deleted"
+	Started         SyncEvent = "Started"
+	Stopped         SyncEvent = "Stopped"
+	SyncFailed      SyncEvent = "SyncFailed"
+	Resumed         SyncEvent = "Resumed"
+	CoreDumped      SyncEvent = "CoreDumped"
+	Restarted       SyncEvent = "Restarted"
+	RestartRequired SyncEvent = "RestartRequired"
+	ChangeRejected  SyncEvent = "ChangeRejected"
+	MemoryDumped    SyncEvent = "MemoryDumped"
+	JobCancelled    SyncEvent = "JobCancelled"
 )
 
 func (s SyncEvent) String() string {
@@ -542,6 +646,54 @@ type MigrationSpec struct {
 	// Note that these selectors are additions to the node selectors on the VM itself and they must not exist on the VM.
 	// If they are conflicting with the VM, no migration will be started.
 	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// Options to tune the migration, e.g. for busy guests which do not
+	// converge with the defaults. Bandwidth and downtime can be changed
+	// while the migration is running.
+	// +optional
+	Options *MigrationOptions `json:"options,omitempty"`
+}
+
+type MigrationOptions struct {
+	// Maximum bandwidth the migration may use, in MiB/s
+	// +optional
+	Bandwidth uint64 `json:"bandwidth,omitempty"`
+	// Maximum time the guest may be paused when switching over to the
+	// destination, in milliseconds
+	// +optional
+	MaxDowntime uint64 `json:"maxDowntime,omitempty"`
+	// Throttle the vCPUs of the guest, if it dirties its memory faster than
+	// it can be migrated
+	// +optional
+	AutoConverge bool `json:"autoConverge,omitempty"`
+	// Allow switching the migration to post-copy mode
+	// +optional
+	PostCopy bool `json:"postCopy,omitempty"`
+	// Switch to post-copy mode automatically after the first pre-copy pass.
+	// Implies postCopy.
+	// +optional
+	PostCopyAfterPrecopy bool `json:"postCopyAfterPrecopy,omitempty"`
+	// Switch the running migration to post-copy mode now. Requires postCopy.
+	// +optional
+	StartPostCopy bool `json:"startPostCopy,omitempty"`
+	// Encrypt the migration stream with TLS. The hosts need libvirt TLS
+	// certificates.
+	// +optional
+	TLS bool `json:"tls,omitempty"`
+	// Network in CIDR notation, e.g. 10.10.0.0/16, the migration traffic
+	// should use. The destination listens on its address in this network,
+	// instead of on the default node address.
+	// +optional
+	Network string `json:"network,omitempty"`
+	// Number of parallel connections (multifd channels) to migrate the
+	// memory over. Speeds up migrating large guests on fast networks.
+	// Can't be combined with post-copy.
+	// +optional
+	ParallelConnections uint `json:"parallelConnections,omitempty"`
+	// Copy the writable disks which only exist on the source host, e.g.
+	// registry disks, to the destination while migrating. Network disks
+	// and persistent volume claims are shared and never copied.
+	// +optional
+	CopyLocalDisks bool `json:"copyLocalDisks,omitempty"`
 }
 
 type VMSelector struct {
@@ -645,11 +797,34 @@ func (ml *MigrationList) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
-// Host specific data, used by the migration controller to fetch host specific migration information from the target host
+// Host specific data, used by the migration controller to fetch host specific migration information from the source and target hosts
 type MigrationHostInfo struct {
 	Slice      string   `json:"slice"`
 	Controller []string `json:"controller"`
 	PidNS      string   `json:"pidns"`
+	Addresses  []string `json:"addresses,omitempty"`
+	// Migration features which libvirt and qemu on the host support
+	Features []MigrationFeature `json:"features,omitempty"`
+}
+
+// MigrationFeature names a migration option which depends on the libvirt
+// and qemu versions of the hosts.
+type MigrationFeature string
+
+const (
+	MigrationFeatureTLS                 MigrationFeature = "TLS"
+	MigrationFeatureParallelConnections MigrationFeature = "ParallelConnections"
+	MigrationFeatureListenAddress       MigrationFeature = "ListenAddress"
+)
+
+// SupportsFeature tells whether the host supports the migration feature.
+func (info *MigrationHostInfo) SupportsFeature(feature MigrationFeature) bool {
+	for _, f := range info.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
 }
 
 // Given a VM, update all NodeSelectorTerms with anti-affinity for that VM's node.
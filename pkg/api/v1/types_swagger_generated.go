@@ -40,6 +40,26 @@ func (VMStatus) SwaggerDoc() map[string]string {
 		"conditions":        "Conditions are specific points in VM's pod runtime.",
 		"phase":             "Phase is the status of the VM in kubernetes world. It is not the VM status, but partially correlates to it.",
 		"graphics":          "Graphics represent the details of available graphical consoles.",
+		"interfaces":        "Interfaces represent the network interfaces of the VM and their addresses.",
+		"filesystems":       "Filesystems are the filesystems mounted in the guest and their usage,\nonly known with a guest agent.",
+	}
+}
+
+func (VMNetworkInterface) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"mac":           "MAC address of the interface",
+		"interfaceName": "Name of the interface inside the guest, only known with a guest agent",
+		"ipAddresses":   "IP addresses of the interface, from the guest agent or the DHCP leases\nof the libvirt network",
+	}
+}
+
+func (VMFilesystem) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"mountPoint": "MountPoint of the filesystem in the guest",
+		"type":       "Type of the filesystem, e.g. ext4",
+		"usedBytes":  "UsedBytes of the filesystem, only reported by recent guest agents",
+		"totalBytes": "TotalBytes of the filesystem, only reported by recent guest agents",
+		"disks":      "Disks of the VM the filesystem is stored on, by their target name",
 	}
 }
 
@@ -70,6 +90,22 @@ func (MigrationSpec) SwaggerDoc() map[string]string {
 		"":             "MigrationSpec is a description of a VM Migration\nFor example \"destinationNodeName\": \"testvm\" will migrate a VM called \"testvm\" in the namespace \"default\"",
 		"selector":     "Criterias for selecting the VM to migrate.\nFor example\nselector:\n  name: testvm\nwill select the VM `testvm` for migration",
 		"nodeSelector": "Criteria to use when selecting the destination for the migration\nfor example, to select by the hostname, specify `kubernetes.io/hostname: master`\nother possible choices include the hardware required to run the vm or\nor lableing of the nodes to indicate their roles in larger applications.\nexamples:\ndisktype: ssd,\nrandomGenerator: /dev/random,\nrandomGenerator: superfastdevice,\napp: mysql,\nlicensedForServiceX: true\nNote that these selectors are additions to the node selectors on the VM itself and they must not exist on the VM.\nIf they are conflicting with the VM, no migration will be started.",
+		"options":      "Options to tune the migration, e.g. for busy guests which do not\nconverge with the defaults. Bandwidth and downtime can be changed\nwhile the migration is running.\n+optional",
+	}
+}
+
+func (MigrationOptions) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"bandwidth":            "Maximum bandwidth the migration may use, in MiB/s\n+optional",
+		"maxDowntime":          "Maximum time the guest may be paused when switching over to the\ndestination, in milliseconds\n+optional",
+		"autoConverge":         "Throttle the vCPUs of the guest, if it dirties its memory faster than\nit can be migrated\n+optional",
+		"postCopy":             "Allow switching the migration to post-copy mode\n+optional",
+		"postCopyAfterPrecopy": "Switch to post-copy mode automatically after the first pre-copy pass.\nImplies postCopy.\n+optional",
+		"startPostCopy":        "Switch the running migration to post-copy mode now. Requires postCopy.\n+optional",
+		"tls":                  "Encrypt the migration stream with TLS. The hosts need libvirt TLS\ncertificates.\n+optional",
+		"network":              "Network in CIDR notation, e.g. 10.10.0.0/16, the migration traffic\nshould use. The destination listens on its address in this network,\ninstead of on the default node address.\n+optional",
+		"parallelConnections":  "Number of parallel connections (multifd channels) to migrate the\nmemory over. Speeds up migrating large guests on fast networks.\nCan't be combined with post-copy.\n+optional",
+		"copyLocalDisks":       "Copy the writable disks which only exist on the source host, e.g.\nregistry disks, to the destination while migrating. Network disks\nand persistent volume claims are shared and never copied.\n+optional",
 	}
 }
 
@@ -93,7 +129,8 @@ func (MigrationList) SwaggerDoc() map[string]string {
 
 func (MigrationHostInfo) SwaggerDoc() map[string]string {
 	return map[string]string{
-		"": "Host specific data, used by the migration controller to fetch host specific migration information from the target host",
+		"":         "Host specific data, used by the migration controller to fetch host specific migration information from the source and target hosts",
+		"features": "Migration features which libvirt and qemu on the host support",
 	}
 }
 
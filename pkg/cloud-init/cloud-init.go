@@ -20,15 +20,21 @@
 package cloudinit
 
 import (
+	"crypto/md5"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
 	model "github.com/jeevatkm/go-model"
+	"github.com/satori/go.uuid"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
@@ -39,27 +45,29 @@ import (
 	"kubevirt.io/kubevirt/pkg/precond"
 )
 
-type IsoCreationFunc func(isoOutFile string, inFiles []string) error
+type IsoCreationFunc func(isoOutFile string, volumeID string, inFiles []string) error
 
 var cloudInitLocalDir = "/var/run/libvirt/cloud-init-dir"
 var cloudInitOwner = "qemu"
 var cloudInitIsoFunc = defaultIsoFunc
 
 const noCloudFile = "noCloud.iso"
+const configDriveFile = "configDrive.iso"
 
 // Supported DataSources
 const (
-	dataSourceNoCloud = "noCloud"
+	dataSourceNoCloud     = "noCloud"
+	dataSourceConfigDrive = "configDrive"
 )
 
-func defaultIsoFunc(isoOutFile string, inFiles []string) error {
+func defaultIsoFunc(isoOutFile string, volumeID string, inFiles []string) error {
 
 	var args []string
 
 	args = append(args, "-output")
 	args = append(args, isoOutFile)
 	args = append(args, "-volid")
-	args = append(args, "cidata")
+	args = append(args, volumeID)
 	args = append(args, "-joliet")
 	args = append(args, "-rock")
 	args = append(args, inFiles...)
@@ -140,31 +148,45 @@ func MapCloudInitDisks(vm *v1.VirtualMachine) (*v1.VirtualMachine, error) {
 		return vm, err
 	}
 
+	var isoFile string
 	dataSource := getDataSource(spec)
 	switch dataSource {
 	case dataSourceNoCloud:
-		vmCopy := &v1.VirtualMachine{}
-		model.Copy(vmCopy, vm)
-		filePath := fmt.Sprintf("%s/%s", GetDomainBasePath(domain, namespace), noCloudFile)
-
-		for idx, disk := range vmCopy.Spec.Domain.Devices.Disks {
-			if disk.Type == "file" && disk.CloudInit != nil {
-				newDisk := v1.Disk{}
-				newDisk.Type = "file"
+		isoFile = noCloudFile
+	case dataSourceConfigDrive:
+		isoFile = configDriveFile
+	default:
+		return vm, errors.New(fmt.Sprintf("Unknown CloudInit type %s", dataSource))
+	}
+
+	vmCopy := &v1.VirtualMachine{}
+	model.Copy(vmCopy, vm)
+	filePath := fmt.Sprintf("%s/%s", GetDomainBasePath(domain, namespace), isoFile)
+
+	for idx, disk := range vmCopy.Spec.Domain.Devices.Disks {
+		if disk.Type == "file" && disk.CloudInit != nil {
+			newDisk := v1.Disk{}
+			newDisk.Type = "file"
+			newDisk.Target = disk.Target
+			// The seed is a cdrom unless a disk is explicitly asked for.
+			// cdroms can't be attached to the virtio bus.
+			newDisk.Device = "cdrom"
+			newDisk.ReadOnly = &v1.ReadOnly{}
+			if disk.Device == "disk" {
 				newDisk.Device = "disk"
-				newDisk.Driver = &v1.DiskDriver{
-					Type: "raw",
-					Name: "qemu",
-				}
-				newDisk.Source.File = filePath
-				newDisk.Target = disk.Target
-				vmCopy.Spec.Domain.Devices.Disks[idx] = newDisk
+				newDisk.ReadOnly = nil
+			} else if newDisk.Target.Bus == "virtio" || (newDisk.Target.Bus == "" && strings.HasPrefix(newDisk.Target.Device, "vd")) {
+				newDisk.Target.Bus = "sata"
 			}
+			newDisk.Driver = &v1.DiskDriver{
+				Type: "raw",
+				Name: "qemu",
+			}
+			newDisk.Source.File = filePath
+			vmCopy.Spec.Domain.Devices.Disks[idx] = newDisk
 		}
-		return vmCopy, nil
-	default:
-		return vm, errors.New(fmt.Sprintf("Unknown CloudInit type %s", dataSource))
 	}
+	return vmCopy, nil
 }
 
 func ValidateArgs(spec *v1.CloudInitSpec) error {
@@ -172,16 +194,18 @@ func ValidateArgs(spec *v1.CloudInitSpec) error {
 		return nil
 	}
 
+	if spec.NoCloudData != nil && spec.ConfigDriveData != nil {
+		return errors.New("only one cloudInit dataSource can be set")
+	}
+
 	dataSource := getDataSource(spec)
 	switch dataSource {
-	case dataSourceNoCloud:
-		if spec.NoCloudData == nil {
-			return errors.New(fmt.Sprintf("DataSource %s does not have the required data initialized", dataSource))
-		}
-		if spec.NoCloudData.UserDataBase64 == "" {
+	case dataSourceNoCloud, dataSourceConfigDrive:
+		data := getCloudInitData(spec)
+		if data.UserDataBase64 == "" {
 			return errors.New(fmt.Sprintf("userDataBase64 is required for cloudInit type %s", dataSource))
 		}
-		if spec.NoCloudData.MetaDataBase64 == "" {
+		if data.MetaDataBase64 == "" {
 			return errors.New(fmt.Sprintf("metaDataBase64 is required for cloudInit type %s", dataSource))
 		}
 	default:
@@ -210,9 +234,25 @@ func ApplyMetadata(vm *v1.VirtualMachine) {
 		// TODO Put local-hostname in MetaData once we get pod DNS working with VMs
 		msg := fmt.Sprintf("{ \"instance-id\": \"%s.%s\" }\n", domain, namespace)
 		spec.NoCloudData.MetaDataBase64 = base64.StdEncoding.EncodeToString([]byte(msg))
+	case dataSourceConfigDrive:
+		if spec.ConfigDriveData.MetaDataBase64 != "" {
+			return
+		}
+		msg := fmt.Sprintf("{ \"uuid\": \"%s\" }\n", instanceUUID(vm))
+		spec.ConfigDriveData.MetaDataBase64 = base64.StdEncoding.EncodeToString([]byte(msg))
 	}
 }
 
+// instanceUUID returns the UID of the VM, or a UUID derived from its
+// namespace and name if the VM has none yet.
+func instanceUUID(vm *v1.VirtualMachine) string {
+	if vm.GetObjectMeta().GetUID() != "" {
+		return string(vm.GetObjectMeta().GetUID())
+	}
+	name := fmt.Sprintf("%s/%s", vm.GetObjectMeta().GetNamespace(), vm.GetObjectMeta().GetName())
+	return uuid.NewV5(uuid.NamespaceOID, name).String()
+}
+
 func RemoveLocalData(domain string, namespace string) error {
 	domainBasePath := GetDomainBasePath(domain, namespace)
 	err := os.RemoveAll(domainBasePath)
@@ -241,17 +281,32 @@ func getDataSource(spec *v1.CloudInitSpec) string {
 	if spec.NoCloudData != nil {
 		return dataSourceNoCloud
 	}
+	if spec.ConfigDriveData != nil {
+		return dataSourceConfigDrive
+	}
 	return ""
 }
 
-func ResolveSecrets(spec *v1.CloudInitSpec, namespace string, clientset kubecli.KubevirtClient) error {
-
+// The disk based dataSources carry the same data, they only differ in how it
+// is laid out on the seed.
+func getCloudInitData(spec *v1.CloudInitSpec) *v1.CloudInitDataSourceNoCloud {
 	switch getDataSource(spec) {
 	case dataSourceNoCloud:
-		if spec.NoCloudData.UserDataSecretRef == "" {
-			return nil
-		}
-		secretID := spec.NoCloudData.UserDataSecretRef
+		return spec.NoCloudData
+	case dataSourceConfigDrive:
+		return (*v1.CloudInitDataSourceNoCloud)(spec.ConfigDriveData)
+	}
+	return nil
+}
+
+func ResolveSecrets(spec *v1.CloudInitSpec, namespace string, clientset kubecli.KubevirtClient) error {
+	data := getCloudInitData(spec)
+	if data == nil {
+		return nil
+	}
+
+	if data.UserDataSecretRef != "" {
+		secretID := data.UserDataSecretRef
 
 		secret, err := clientset.CoreV1().Secrets(namespace).Get(secretID, metav1.GetOptions{})
 		if err != nil {
@@ -262,11 +317,39 @@ func ResolveSecrets(spec *v1.CloudInitSpec, namespace string, clientset kubecli.
 		if ok == false {
 			return errors.New(fmt.Sprintf("No password value found in k8s secret %s %v", secretID, err))
 		}
-		spec.NoCloudData.UserDataBase64 = string(userDataBase64)
+		data.UserDataBase64 = string(userDataBase64)
+	}
+
+	// Config maps hold the data in plain text
+	if data.UserDataConfigMapRef != "" {
+		userData, err := getConfigMapValue(clientset, namespace, data.UserDataConfigMapRef, "userdata")
+		if err != nil {
+			return err
+		}
+		data.UserDataBase64 = base64.StdEncoding.EncodeToString([]byte(userData))
+	}
+	if data.NetworkDataConfigMapRef != "" {
+		networkData, err := getConfigMapValue(clientset, namespace, data.NetworkDataConfigMapRef, "networkdata")
+		if err != nil {
+			return err
+		}
+		data.NetworkDataBase64 = base64.StdEncoding.EncodeToString([]byte(networkData))
 	}
 	return nil
 }
 
+func getConfigMapValue(clientset kubecli.KubevirtClient, namespace string, name string, key string) (string, error) {
+	configMap, err := clientset.CoreV1().ConfigMaps(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	value, ok := configMap.Data[key]
+	if ok == false {
+		return "", errors.New(fmt.Sprintf("No %s value found in k8s config map %s", key, name))
+	}
+	return value, nil
+}
+
 func GenerateLocalData(domain string, namespace string, spec *v1.CloudInitSpec) error {
 	if spec == nil {
 		return nil
@@ -284,75 +367,122 @@ func GenerateLocalData(domain string, namespace string, spec *v1.CloudInitSpec)
 		return err
 	}
 
+	data := getCloudInitData(spec)
+	userDataBytes, err := base64.StdEncoding.DecodeString(data.UserDataBase64)
+	if err != nil {
+		return err
+	}
+	metaDataBytes, err := base64.StdEncoding.DecodeString(data.MetaDataBase64)
+	if err != nil {
+		return err
+	}
+	networkDataBytes, err := base64.StdEncoding.DecodeString(data.NetworkDataBase64)
+	if err != nil {
+		return err
+	}
+
 	switch getDataSource(spec) {
 	case dataSourceNoCloud:
-		metaFile := fmt.Sprintf("%s/%s", domainBasePath, "meta-data")
-		userFile := fmt.Sprintf("%s/%s", domainBasePath, "user-data")
-		iso := fmt.Sprintf("%s/%s", domainBasePath, noCloudFile)
-		isoStaging := fmt.Sprintf("%s/%s.staging", domainBasePath, noCloudFile)
-		userData64 := spec.NoCloudData.UserDataBase64
-		metaData64 := spec.NoCloudData.MetaDataBase64
-
-		diskutils.RemoveFile(userFile)
-		diskutils.RemoveFile(metaFile)
-		diskutils.RemoveFile(isoStaging)
-
-		userDataBytes, err := base64.StdEncoding.DecodeString(userData64)
-		if err != nil {
-			return err
+		files := map[string][]byte{
+			"user-data": userDataBytes,
+			"meta-data": metaDataBytes,
 		}
-		metaDataBytes, err := base64.StdEncoding.DecodeString(metaData64)
-		if err != nil {
-			return err
+		if len(networkDataBytes) > 0 {
+			files["network-config"] = networkDataBytes
 		}
-
-		err = ioutil.WriteFile(userFile, userDataBytes, 0644)
-		if err != nil {
-			return err
+		return generateIso(domainBasePath, noCloudFile, "cidata", files)
+	case dataSourceConfigDrive:
+		files := map[string][]byte{
+			"openstack/latest/user_data":      userDataBytes,
+			"openstack/latest/meta_data.json": metaDataBytes,
 		}
-		err = ioutil.WriteFile(metaFile, metaDataBytes, 0644)
-		if err != nil {
-			return err
+		if len(networkDataBytes) > 0 {
+			files["openstack/latest/network_data.json"] = networkDataBytes
 		}
+		return generateIso(domainBasePath, configDriveFile, "config-2", files)
+	}
+	return nil
+}
 
-		files := make([]string, 0, 2)
-		files = append(files, metaFile)
-		files = append(files, userFile)
-		err = cloudInitIsoFunc(isoStaging, files)
-		if err != nil {
-			return err
+// generateIso writes the files into a staging directory and creates the iso
+// from it. A checksum of the content is stored next to the iso, so that the
+// iso is only regenerated when the content changes.
+func generateIso(domainBasePath string, isoFile string, volumeID string, files map[string][]byte) error {
+	iso := fmt.Sprintf("%s/%s", domainBasePath, isoFile)
+	isoStaging := fmt.Sprintf("%s/%s.staging", domainBasePath, isoFile)
+	checksumFile := fmt.Sprintf("%s/%s.md5", domainBasePath, isoFile)
+	dataDir := fmt.Sprintf("%s/%s.data", domainBasePath, isoFile)
+
+	checksum := contentChecksum(volumeID, files)
+	exists, err := diskutils.FileExists(iso)
+	if err != nil {
+		return err
+	}
+	if exists {
+		oldChecksum, err := ioutil.ReadFile(checksumFile)
+		if err == nil && string(oldChecksum) == checksum {
+			logging.DefaultLogger().V(3).Info().Msg(fmt.Sprintf("%s iso file %s is up to date", volumeID, iso))
+			return nil
 		}
-		diskutils.RemoveFile(metaFile)
-		diskutils.RemoveFile(userFile)
+	}
+
+	os.RemoveAll(dataDir)
+	diskutils.RemoveFile(isoStaging)
+	defer os.RemoveAll(dataDir)
 
-		err = diskutils.SetFileOwnership(cloudInitOwner, isoStaging)
+	for name, content := range files {
+		file := filepath.Join(dataDir, name)
+		err := os.MkdirAll(filepath.Dir(file), 0755)
 		if err != nil {
 			return err
 		}
-
-		isEqual, err := diskutils.FilesAreEqual(iso, isoStaging)
+		err = ioutil.WriteFile(file, content, 0644)
 		if err != nil {
 			return err
 		}
+	}
 
-		// Only replace the dynamically generated iso if it has a different checksum
-		if isEqual {
-			diskutils.RemoveFile(isoStaging)
-		} else {
-			diskutils.RemoveFile(iso)
-			err = os.Rename(isoStaging, iso)
-			if err != nil {
-				// This error is not something we need to block iso creation for.
-				logging.DefaultLogger().Error().Reason(err).Msg(fmt.Sprintf("Cloud-init failed to rename file %s to %s", isoStaging, iso))
-				return err
-			}
-		}
+	err = cloudInitIsoFunc(isoStaging, volumeID, []string{dataDir})
+	if err != nil {
+		return err
+	}
+
+	err = diskutils.SetFileOwnership(cloudInitOwner, isoStaging)
+	if err != nil {
+		return err
+	}
 
-		logging.DefaultLogger().V(2).Info().Msg(fmt.Sprintf("generated nocloud iso file %s", iso))
+	diskutils.RemoveFile(iso)
+	err = os.Rename(isoStaging, iso)
+	if err != nil {
+		logging.DefaultLogger().Error().Reason(err).Msg(fmt.Sprintf("Cloud-init failed to rename file %s to %s", isoStaging, iso))
+		return err
+	}
+	err = ioutil.WriteFile(checksumFile, []byte(checksum), 0644)
+	if err != nil {
+		return err
 	}
+
+	logging.DefaultLogger().V(2).Info().Msg(fmt.Sprintf("generated %s iso file %s", volumeID, iso))
 	return nil
 }
 
+func contentChecksum(volumeID string, files map[string][]byte) string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	hash := md5.New()
+	hash.Write([]byte(volumeID))
+	for _, name := range names {
+		fmt.Fprintf(hash, "%s:%d:", name, len(files[name]))
+		hash.Write(files[name])
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
 // Lists all vms cloud-init has local data for
 func ListVmWithLocalData() ([]*v1.VirtualMachine, error) {
 	return diskutils.ListVmWithEphemeralDisk(cloudInitLocalDir)
@@ -27,11 +27,14 @@ import (
 	"os"
 	"os/exec"
 	"os/user"
+	"path/filepath"
 	"strings"
 	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/satori/go.uuid"
+	"k8s.io/apimachinery/pkg/types"
 
 	v1 "kubevirt.io/kubevirt/pkg/api/v1"
 	"kubevirt.io/kubevirt/pkg/precond"
@@ -45,9 +48,9 @@ var _ = Describe("CloudInit", func() {
 	if err != nil {
 		panic(err)
 	}
-	isoCreationFunc := func(isoOutFile string, inFiles []string) error {
-		if isoOutFile == "noCloud" && len(inFiles) != 2 {
-			return errors.New("Unexpected number of files for noCloud")
+	isoCreationFunc := func(isoOutFile string, volumeID string, inFiles []string) error {
+		if len(inFiles) != 1 {
+			return errors.New("Unexpected number of files")
 		}
 
 		// fake creating the iso
@@ -69,6 +72,10 @@ var _ = Describe("CloudInit", func() {
 		SetIsoCreationFunction(isoCreationFunc)
 	})
 
+	AfterEach(func() {
+		SetIsoCreationFunction(defaultIsoFunc)
+	})
+
 	AfterSuite(func() {
 		os.RemoveAll(tmpDir)
 	})
@@ -78,7 +85,7 @@ var _ = Describe("CloudInit", func() {
 			It("Verify no cloudinit data exec timeout works", func() {
 
 				timedOut := false
-				customCreationFunc := func(isoOutFile string, inFiles []string) error {
+				customCreationFunc := func(isoOutFile string, volumeID string, inFiles []string) error {
 					var args []string
 
 					args = append(args, "10")
@@ -157,12 +164,85 @@ var _ = Describe("CloudInit", func() {
 
 				expectedIso := fmt.Sprintf("%s/%s/%s/noCloud.iso", tmpDir, namespace, domain)
 				Expect(disk.Type).To(Equal("file"))
-				Expect(disk.Device).To(Equal("disk"))
+				Expect(disk.Device).To(Equal("cdrom"))
+				Expect(disk.ReadOnly).ToNot(BeNil())
 				Expect(disk.Driver.Type).To(Equal("raw"))
 				Expect(disk.Driver.Name).To(Equal("qemu"))
 				Expect(disk.Source.File).To(Equal(expectedIso))
-				Expect(disk.Target.Device).To(Equal("vdb"))
+				Expect(disk.Target).To(Equal(v1.DiskTarget{Bus: "sata", Device: "vdb"}))
+
+			})
+			It("Verify cloudinit cdrom domain xml", func() {
+				vm := v1.NewMinimalVM("fake-vm-nocloud")
+
+				newDisk := v1.Disk{}
+				newDisk.Type = "file"
+				newDisk.Device = "cdrom"
+				newDisk.Target = v1.DiskTarget{
+					Device: "hdc",
+				}
+				newDisk.CloudInit = &v1.CloudInitSpec{
+					NoCloudData: &v1.CloudInitDataSourceNoCloud{
+						UserDataBase64: base64.StdEncoding.EncodeToString([]byte("fake\nuser\ndata\n")),
+						MetaDataBase64: base64.StdEncoding.EncodeToString([]byte("fake\nmeta\ndata\n")),
+					},
+				}
+
+				vm.Spec.Domain.Devices.Disks = append(vm.Spec.Domain.Devices.Disks, newDisk)
+				vm, err := MapCloudInitDisks(vm)
+				Expect(err).ToNot(HaveOccurred())
+				disk := vm.Spec.Domain.Devices.Disks[0]
+				Expect(disk.Device).To(Equal("cdrom"))
+				Expect(disk.ReadOnly).ToNot(BeNil())
+				Expect(disk.Target).To(Equal(v1.DiskTarget{Device: "hdc"}))
+			})
+			It("Verify cloudinit disk domain xml", func() {
+				vm := v1.NewMinimalVM("fake-vm-nocloud")
+
+				newDisk := v1.Disk{}
+				newDisk.Type = "file"
+				newDisk.Device = "disk"
+				newDisk.Target = v1.DiskTarget{
+					Device: "vdb",
+				}
+				newDisk.CloudInit = &v1.CloudInitSpec{
+					NoCloudData: &v1.CloudInitDataSourceNoCloud{
+						UserDataBase64: base64.StdEncoding.EncodeToString([]byte("fake\nuser\ndata\n")),
+						MetaDataBase64: base64.StdEncoding.EncodeToString([]byte("fake\nmeta\ndata\n")),
+					},
+				}
+
+				vm.Spec.Domain.Devices.Disks = append(vm.Spec.Domain.Devices.Disks, newDisk)
+				vm, err := MapCloudInitDisks(vm)
+				Expect(err).ToNot(HaveOccurred())
+				disk := vm.Spec.Domain.Devices.Disks[0]
+				Expect(disk.Device).To(Equal("disk"))
+				Expect(disk.ReadOnly).To(BeNil())
+				Expect(disk.Target).To(Equal(v1.DiskTarget{Device: "vdb"}))
+			})
+			It("Verify the iso is only regenerated when the data changes", func() {
+				namespace := "fake-namespace"
+				domain := "fake-domain-checksum"
+				calls := 0
+				SetIsoCreationFunction(func(isoOutFile string, volumeID string, inFiles []string) error {
+					calls++
+					return isoCreationFunc(isoOutFile, volumeID, inFiles)
+				})
+				cloudInitData := &v1.CloudInitSpec{
+					NoCloudData: &v1.CloudInitDataSourceNoCloud{
+						UserDataBase64: base64.StdEncoding.EncodeToString([]byte("fake\nuser\ndata\n")),
+						MetaDataBase64: base64.StdEncoding.EncodeToString([]byte("fake\nmeta\ndata\n")),
+					},
+				}
+				Expect(GenerateLocalData(domain, namespace, cloudInitData)).To(Succeed())
+				Expect(GenerateLocalData(domain, namespace, cloudInitData)).To(Succeed())
+				Expect(calls).To(Equal(1))
 
+				cloudInitData.NoCloudData.UserDataBase64 = base64.StdEncoding.EncodeToString([]byte("other\nuser\ndata\n"))
+				Expect(GenerateLocalData(domain, namespace, cloudInitData)).To(Succeed())
+				Expect(calls).To(Equal(2))
+
+				Expect(RemoveLocalData(domain, namespace)).To(Succeed())
 			})
 			It("delete non-existent local Nocloud data.", func() {
 				namespace := "fake-namespace"
@@ -282,4 +362,95 @@ var _ = Describe("CloudInit", func() {
 			})
 		})
 	})
+
+	Describe("CloudInit ConfigDrive datasource", func() {
+		It("define vm with ConfigDrive datasource.", func() {
+			namespace := "fake-namespace"
+			domain := "fake-domain-configdrive"
+			var volume string
+			var layout []string
+			SetIsoCreationFunction(func(isoOutFile string, volumeID string, inFiles []string) error {
+				volume = volumeID
+				filepath.Walk(inFiles[0], func(path string, info os.FileInfo, err error) error {
+					if err == nil && !info.IsDir() {
+						layout = append(layout, strings.TrimPrefix(path, inFiles[0]+"/"))
+					}
+					return nil
+				})
+				return isoCreationFunc(isoOutFile, volumeID, inFiles)
+			})
+			cloudInitData := &v1.CloudInitSpec{
+				ConfigDriveData: &v1.CloudInitDataSourceConfigDrive{
+					UserDataBase64:    base64.StdEncoding.EncodeToString([]byte("fake\nuser\ndata\n")),
+					MetaDataBase64:    base64.StdEncoding.EncodeToString([]byte("{ \"uuid\": \"fake\" }")),
+					NetworkDataBase64: base64.StdEncoding.EncodeToString([]byte("{ \"links\": [] }")),
+				},
+			}
+			err := GenerateLocalData(domain, namespace, cloudInitData)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(volume).To(Equal("config-2"))
+			Expect(layout).To(ConsistOf(
+				"openstack/latest/user_data",
+				"openstack/latest/meta_data.json",
+				"openstack/latest/network_data.json",
+			))
+			_, err = os.Stat(fmt.Sprintf("%s/%s/%s/configDrive.iso", tmpDir, namespace, domain))
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(RemoveLocalData(domain, namespace)).To(Succeed())
+		})
+
+		It("Verify ConfigDrive metadata is auto-generated", func() {
+			vm := v1.NewMinimalVM("fake-vm-configdrive")
+			newDisk := v1.Disk{}
+			newDisk.Type = "file"
+			newDisk.CloudInit = &v1.CloudInitSpec{
+				ConfigDriveData: &v1.CloudInitDataSourceConfigDrive{
+					UserDataBase64: base64.StdEncoding.EncodeToString([]byte("fake\nuser\ndata\n")),
+				},
+			}
+			vm.Spec.Domain.Devices.Disks = append(vm.Spec.Domain.Devices.Disks, newDisk)
+
+			ApplyMetadata(vm)
+			metaData, err := base64.StdEncoding.DecodeString(vm.Spec.Domain.Devices.Disks[0].CloudInit.ConfigDriveData.MetaDataBase64)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(metaData)).To(ContainSubstring("uuid"))
+		})
+
+		It("Verify ConfigDrive metadata uses the VM UID as uuid", func() {
+			vm := v1.NewMinimalVM("fake-vm-configdrive")
+			vm.ObjectMeta.UID = types.UID("5f6b3a4e-1d8c-4b2a-9e0f-7c3d2b1a0e9f")
+			newDisk := v1.Disk{}
+			newDisk.Type = "file"
+			newDisk.CloudInit = &v1.CloudInitSpec{
+				ConfigDriveData: &v1.CloudInitDataSourceConfigDrive{
+					UserDataBase64: base64.StdEncoding.EncodeToString([]byte("fake\nuser\ndata\n")),
+				},
+			}
+			vm.Spec.Domain.Devices.Disks = append(vm.Spec.Domain.Devices.Disks, newDisk)
+
+			ApplyMetadata(vm)
+			metaData, err := base64.StdEncoding.DecodeString(vm.Spec.Domain.Devices.Disks[0].CloudInit.ConfigDriveData.MetaDataBase64)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(metaData)).To(Equal("{ \"uuid\": \"5f6b3a4e-1d8c-4b2a-9e0f-7c3d2b1a0e9f\" }\n"))
+		})
+
+		It("Verify the generated ConfigDrive uuid is stable without a VM UID", func() {
+			vm := v1.NewMinimalVM("fake-vm-configdrive")
+			first := instanceUUID(vm)
+			_, err := uuid.FromString(first)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(instanceUUID(v1.NewMinimalVM("fake-vm-configdrive"))).To(Equal(first))
+			Expect(instanceUUID(v1.NewMinimalVM("other-vm-configdrive"))).ToNot(Equal(first))
+		})
+
+		It("Verify only one datasource can be set", func() {
+			spec := &v1.CloudInitSpec{
+				NoCloudData:     &v1.CloudInitDataSourceNoCloud{UserDataBase64: "Zm9v", MetaDataBase64: "Zm9v"},
+				ConfigDriveData: &v1.CloudInitDataSourceConfigDrive{UserDataBase64: "Zm9v", MetaDataBase64: "Zm9v"},
+			}
+			Expect(ValidateArgs(spec)).ToNot(Succeed())
+		})
+	})
 })
@@ -50,9 +50,9 @@ var _ = Describe("ConfigDiskServer", func() {
 		panic(err)
 	}
 
-	isoCreationFunc := func(isoOutFile string, inFiles []string) error {
-		if isoOutFile == "noCloud" && len(inFiles) != 2 {
-			return errors.New("Unexpected number of files for noCloud")
+	isoCreationFunc := func(isoOutFile string, volumeID string, inFiles []string) error {
+		if len(inFiles) != 1 {
+			return errors.New("Unexpected number of files")
 		}
 
 		// fake creating the iso
@@ -0,0 +1,204 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package diskimage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+var qemuImgBinary = "qemu-img"
+
+// Info describes one image of a backing chain as reported by qemu-img
+type Info struct {
+	Filename            string `json:"filename"`
+	Format              string `json:"format"`
+	VirtualSize         uint64 `json:"virtual-size"`
+	ActualSize          uint64 `json:"actual-size"`
+	BackingFilename     string `json:"backing-filename,omitempty"`
+	FullBackingFilename string `json:"full-backing-filename,omitempty"`
+	BackingFormat       string `json:"backing-filename-format,omitempty"`
+}
+
+// Policy describes which images may be attached to a domain
+type Policy struct {
+	// Formats which are accepted for all images of the chain
+	Formats []string
+	// MaxVirtualSize is the largest accepted virtual size in bytes, 0 means unlimited
+	MaxVirtualSize uint64
+	// BackingDir is the directory all backing files have to live in. If it
+	// is empty, images with backing files are rejected.
+	BackingDir string
+}
+
+// DefaultPolicy accepts standalone raw and qcow2 images of any size
+var DefaultPolicy = Policy{Formats: []string{"raw", "qcow2"}}
+
+// Inspect returns the backing chain of the image, starting with the image
+// itself. The format of the image is passed to qemu-img explicitly, since
+// probing the format of untrusted images is not safe.
+func Inspect(path string, format string) ([]Info, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(qemuImgBinary, "info", "--output=json", "--backing-chain", "-f", format, path)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("qemu-img info %s failed: %v: %s", path, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var chain []Info
+	if err := json.Unmarshal(stdout.Bytes(), &chain); err != nil {
+		return nil, fmt.Errorf("parsing the qemu-img info of %s failed: %v", path, err)
+	}
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("qemu-img reported no info for %s", path)
+	}
+	return chain, nil
+}
+
+// Validate makes sure that the image and its backing chain satisfy the
+// policy and returns the info of the image. The headers of the chain are
+// checked before qemu-img ever opens a backing file, so that a crafted
+// image can't make us touch arbitrary host paths.
+func Validate(path string, format string, policy Policy) (*Info, error) {
+	if err := policy.checkFormat(format); err != nil {
+		return nil, err
+	}
+	if err := policy.checkHeaders(path, format); err != nil {
+		return nil, err
+	}
+
+	chain, err := Inspect(path, format)
+	if err != nil {
+		return nil, err
+	}
+	for i, info := range chain {
+		if err := policy.checkFormat(info.Format); err != nil {
+			return nil, fmt.Errorf("image %s: %v", info.Filename, err)
+		}
+		if info.BackingFilename == "" {
+			continue
+		}
+		backingFile := info.FullBackingFilename
+		if backingFile == "" {
+			backingFile = info.BackingFilename
+		}
+		if err := policy.checkBackingFile(filepath.Dir(info.Filename), backingFile); err != nil {
+			return nil, fmt.Errorf("image %s: %v", info.Filename, err)
+		}
+		if i == len(chain)-1 {
+			return nil, fmt.Errorf("backing file %s of image %s is missing", backingFile, info.Filename)
+		}
+	}
+	if policy.MaxVirtualSize != 0 && chain[0].VirtualSize > policy.MaxVirtualSize {
+		return nil, fmt.Errorf("virtual size %d of image %s exceeds the limit of %d bytes", chain[0].VirtualSize, path, policy.MaxVirtualSize)
+	}
+	return &chain[0], nil
+}
+
+// CreateOverlay creates a qcow2 image which takes all writes on top of the
+// base image, so that the base image can stay read-only.
+func CreateOverlay(base string, baseFormat string, overlay string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command(qemuImgBinary, "create", "-f", "qcow2", "-b", base, "-F", baseFormat, overlay)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("creating an overlay for %s failed: %v: %s", base, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+func (p Policy) checkFormat(format string) error {
+	for _, allowed := range p.Formats {
+		if format == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("image format %s is not allowed", format)
+}
+
+// checkHeaders walks the backing chain through the qcow2 headers. A raw
+// image which carries a qcow2 header is rejected, qemu could be tricked into
+// interpreting it as qcow2 otherwise.
+func (p Policy) checkHeaders(path string, format string) error {
+	for depth := 0; ; depth++ {
+		// The chain can't be longer than the number of files in the
+		// backing directory, protect against loops
+		if depth > 64 {
+			return fmt.Errorf("backing chain of image %s is too long", path)
+		}
+		header, err := ReadQcow2Header(path)
+		if err == ErrNotQcow2 {
+			if format == "qcow2" {
+				return fmt.Errorf("image %s is not a qcow2 image", path)
+			}
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if format == "raw" {
+			return fmt.Errorf("raw image %s carries a qcow2 header", path)
+		}
+		if header.BackingFile == "" {
+			return nil
+		}
+		if err := p.checkBackingFile(filepath.Dir(path), header.BackingFile); err != nil {
+			return fmt.Errorf("image %s: %v", path, err)
+		}
+		if !filepath.IsAbs(header.BackingFile) {
+			path = filepath.Join(filepath.Dir(path), header.BackingFile)
+		} else {
+			path = header.BackingFile
+		}
+		// Without a backing format extension qemu probes the format
+		format = ""
+	}
+}
+
+// checkBackingFile rejects backing files outside of the backing directory,
+// including protocol specifications like json: or nbd: and symlinks which
+// point elsewhere.
+func (p Policy) checkBackingFile(imageDir string, backingFile string) error {
+	if p.BackingDir == "" {
+		return fmt.Errorf("backing file %s is not allowed", backingFile)
+	}
+	if strings.Contains(backingFile, ":") {
+		return fmt.Errorf("backing file %s is not a plain file", backingFile)
+	}
+	if !filepath.IsAbs(backingFile) {
+		backingFile = filepath.Join(imageDir, backingFile)
+	}
+	resolved, err := filepath.EvalSymlinks(backingFile)
+	if err != nil {
+		return fmt.Errorf("resolving backing file %s failed: %v", backingFile, err)
+	}
+	backingDir, err := filepath.EvalSymlinks(p.BackingDir)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(resolved, backingDir+string(filepath.Separator)) {
+		return fmt.Errorf("backing file %s is outside of %s", backingFile, p.BackingDir)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package diskimage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DiskImage", func() {
+	var tmpDir string
+	var originalBinary string
+
+	writeQcow2 := func(name string, size uint64, backingFile string) string {
+		header := make([]byte, 72)
+		copy(header, qcow2Magic)
+		binary.BigEndian.PutUint32(header[4:8], 3)
+		binary.BigEndian.PutUint64(header[24:32], size)
+		if backingFile != "" {
+			binary.BigEndian.PutUint64(header[8:16], uint64(len(header)))
+			binary.BigEndian.PutUint32(header[16:20], uint32(len(backingFile)))
+			header = append(header, []byte(backingFile)...)
+		}
+		path := filepath.Join(tmpDir, name)
+		Expect(ioutil.WriteFile(path, header, 0644)).To(Succeed())
+		return path
+	}
+
+	fakeQemuImg := func(output string) {
+		script := fmt.Sprintf("#!/bin/sh\ncat <<'END'\n%s\nEND\n", output)
+		Expect(ioutil.WriteFile(qemuImgBinary, []byte(script), 0755)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "diskimagetest")
+		Expect(err).ToNot(HaveOccurred())
+		originalBinary = qemuImgBinary
+		qemuImgBinary = filepath.Join(tmpDir, "qemu-img")
+	})
+
+	It("should parse qcow2 headers", func() {
+		path := writeQcow2("disk.qcow2", 1024, "base.qcow2")
+		header, err := ReadQcow2Header(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(*header).To(Equal(Qcow2Header{Version: 3, Size: 1024, BackingFile: "base.qcow2"}))
+	})
+
+	It("should detect files which are not qcow2 images", func() {
+		path := filepath.Join(tmpDir, "disk.raw")
+		Expect(ioutil.WriteFile(path, make([]byte, 512), 0644)).To(Succeed())
+		_, err := ReadQcow2Header(path)
+		Expect(err).To(Equal(ErrNotQcow2))
+	})
+
+	It("should accept standalone images", func() {
+		path := writeQcow2("disk.qcow2", 1024, "")
+		fakeQemuImg(fmt.Sprintf(`[{"filename": "%s", "format": "qcow2", "virtual-size": 1024, "actual-size": 72}]`, path))
+		info, err := Validate(path, "qcow2", DefaultPolicy)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.VirtualSize).To(Equal(uint64(1024)))
+	})
+
+	It("should reject raw images with a qcow2 header", func() {
+		path := writeQcow2("disk.raw", 1024, "")
+		_, err := Validate(path, "raw", DefaultPolicy)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should reject backing files pointing at host paths", func() {
+		path := writeQcow2("disk.qcow2", 1024, "/etc/shadow")
+		_, err := Validate(path, "qcow2", Policy{Formats: []string{"qcow2"}, BackingDir: tmpDir})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should reject backing files escaping the backing directory", func() {
+		path := writeQcow2("disk.qcow2", 1024, "../base.qcow2")
+		_, err := Validate(path, "qcow2", Policy{Formats: []string{"qcow2"}, BackingDir: tmpDir})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should reject protocol backing files", func() {
+		path := writeQcow2("disk.qcow2", 1024, "nbd:evil.example.com:10809")
+		_, err := Validate(path, "qcow2", Policy{Formats: []string{"qcow2"}, BackingDir: tmpDir})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should accept backing files inside the backing directory", func() {
+		base := writeQcow2("base.qcow2", 1024, "")
+		path := writeQcow2("disk.qcow2", 1024, "base.qcow2")
+		fakeQemuImg(fmt.Sprintf(`[
+  {"filename": "%s", "format": "qcow2", "virtual-size": 1024, "backing-filename": "base.qcow2", "full-backing-filename": "%s"},
+  {"filename": "%s", "format": "qcow2", "virtual-size": 1024}
+]`, path, base, base))
+		_, err := Validate(path, "qcow2", Policy{Formats: []string{"qcow2"}, BackingDir: tmpDir})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should reject images which are too large", func() {
+		path := writeQcow2("disk.qcow2", 4096, "")
+		fakeQemuImg(fmt.Sprintf(`[{"filename": "%s", "format": "qcow2", "virtual-size": 4096}]`, path))
+		_, err := Validate(path, "qcow2", Policy{Formats: []string{"qcow2"}, MaxVirtualSize: 1024})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should create overlays backed by the base image", func() {
+		args := filepath.Join(tmpDir, "args")
+		script := fmt.Sprintf("#!/bin/sh\necho \"$@\" > %s\n", args)
+		Expect(ioutil.WriteFile(qemuImgBinary, []byte(script), 0755)).To(Succeed())
+
+		Expect(CreateOverlay("/images/base.raw", "raw", "/overlays/vda.qcow2")).To(Succeed())
+		content, err := ioutil.ReadFile(args)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(content)).To(Equal("create -f qcow2 -b /images/base.raw -F raw /overlays/vda.qcow2\n"))
+	})
+
+	AfterEach(func() {
+		qemuImgBinary = originalBinary
+		os.RemoveAll(tmpDir)
+	})
+})
@@ -0,0 +1,91 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package diskimage
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+var qcow2Magic = []byte{'Q', 'F', 'I', 0xfb}
+
+// The backing file name of a qcow2 image is limited to 1023 bytes
+const maxBackingFileSize = 1023
+
+var ErrNotQcow2 = errors.New("not a qcow2 image")
+
+// Qcow2Header holds the fields of a qcow2 header which matter for validating
+// an image.
+type Qcow2Header struct {
+	Version     uint32
+	BackingFile string
+	Size        uint64
+}
+
+// ReadQcow2Header parses the header of a qcow2 image without involving
+// qemu-img. ErrNotQcow2 is returned for files without the qcow2 magic.
+func ReadQcow2Header(path string) (*Qcow2Header, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// magic, version, backing_file_offset, backing_file_size,
+	// cluster_bits and size
+	raw := make([]byte, 32)
+	if _, err := io.ReadFull(f, raw); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrNotQcow2
+		}
+		return nil, err
+	}
+	for i := range qcow2Magic {
+		if raw[i] != qcow2Magic[i] {
+			return nil, ErrNotQcow2
+		}
+	}
+
+	header := &Qcow2Header{
+		Version: binary.BigEndian.Uint32(raw[4:8]),
+		Size:    binary.BigEndian.Uint64(raw[24:32]),
+	}
+	if header.Version != 2 && header.Version != 3 {
+		return nil, fmt.Errorf("unsupported qcow2 version %d", header.Version)
+	}
+
+	backingFileOffset := binary.BigEndian.Uint64(raw[8:16])
+	backingFileSize := binary.BigEndian.Uint32(raw[16:20])
+	if backingFileOffset == 0 {
+		return header, nil
+	}
+	if backingFileSize > maxBackingFileSize {
+		return nil, fmt.Errorf("qcow2 backing file name of %d bytes is too long", backingFileSize)
+	}
+	backingFile := make([]byte, backingFileSize)
+	if _, err := f.ReadAt(backingFile, int64(backingFileOffset)); err != nil {
+		return nil, fmt.Errorf("reading the qcow2 backing file name failed: %v", err)
+	}
+	header.BackingFile = string(backingFile)
+	return header, nil
+}
@@ -0,0 +1,146 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package hooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	kubev1 "k8s.io/api/core/v1"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/precond"
+)
+
+const (
+	// SocketsDir is the directory in which hook sidecars serve the
+	// v1alpha.Callbacks service, one unix socket per sidecar ending in .sock
+	SocketsDir = "/var/run/kubevirt-hooks"
+	volumeName = "hook-sidecar-sockets"
+)
+
+var sidecarsEnabled = false
+
+// SetSidecarsEnabled allows VMs to ask for hook sidecars. Sidecars can change
+// the domain of a VM before it is defined, so they are disabled by default.
+func SetSidecarsEnabled(enabled bool) {
+	sidecarsEnabled = enabled
+}
+
+// Sidecar is a container of the VM pod which changes the domain of the VM
+// before it is defined.
+type Sidecar struct {
+	Image           string            `json:"image"`
+	ImagePullPolicy kubev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+}
+
+// SidecarsFromVM returns the hook sidecars which the VM asks for in its
+// annotations. VMs which ask for sidecars while they are disabled are
+// rejected, instead of being started without their hooks.
+func SidecarsFromVM(vm *v1.VirtualMachine) ([]Sidecar, error) {
+	annotation, exists := vm.ObjectMeta.Annotations[v1.HookSidecarsAnnotation]
+	if !exists {
+		return nil, nil
+	}
+	if !sidecarsEnabled {
+		return nil, fmt.Errorf("hook sidecars are disabled")
+	}
+	sidecars := []Sidecar{}
+	if err := json.Unmarshal([]byte(annotation), &sidecars); err != nil {
+		return nil, fmt.Errorf("invalid hook sidecars: %v", err)
+	}
+	for i, sidecar := range sidecars {
+		if sidecar.Image == "" {
+			return nil, fmt.Errorf("hook sidecar %d has no image", i)
+		}
+	}
+	return sidecars, nil
+}
+
+// SocketDirForVM returns the directory on the host which holds the sockets
+// of the hook sidecars of the VM. It is part of the socket directory of the
+// VM, which virt-handler can reach.
+func SocketDirForVM(socketBaseDir string, vm *v1.VirtualMachine) string {
+	domain := precond.MustNotBeEmpty(vm.GetObjectMeta().GetName())
+	namespace := precond.MustNotBeEmpty(vm.GetObjectMeta().GetNamespace())
+	return filepath.Join(socketBaseDir, namespace, domain, "hooks")
+}
+
+// GenerateContainers returns the hook sidecar containers of the VM and the
+// volume through which they share their sockets with virt-handler.
+func GenerateContainers(vm *v1.VirtualMachine, socketBaseDir string) ([]kubev1.Container, []kubev1.Volume, error) {
+	sidecars, err := SidecarsFromVM(vm)
+	if err != nil || len(sidecars) == 0 {
+		return nil, nil, err
+	}
+
+	containers := []kubev1.Container{}
+	for i, sidecar := range sidecars {
+		pullPolicy := sidecar.ImagePullPolicy
+		if pullPolicy == "" {
+			pullPolicy = kubev1.PullIfNotPresent
+		}
+		containers = append(containers, kubev1.Container{
+			Name:            fmt.Sprintf("hook-sidecar-%d", i),
+			Image:           sidecar.Image,
+			ImagePullPolicy: pullPolicy,
+			VolumeMounts: []kubev1.VolumeMount{
+				{
+					Name:      volumeName,
+					MountPath: SocketsDir,
+				},
+			},
+		})
+	}
+	volumes := []kubev1.Volume{
+		{
+			Name: volumeName,
+			VolumeSource: kubev1.VolumeSource{
+				HostPath: &kubev1.HostPathVolumeSource{
+					Path: SocketDirForVM(socketBaseDir, vm),
+				},
+			},
+		},
+	}
+	return containers, volumes, nil
+}
+
+// Sockets returns the hook sockets in the directory, sorted by their names.
+func Sockets(dir string) ([]string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	sockets := []string{}
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), ".sock") {
+			sockets = append(sockets, filepath.Join(dir, file.Name()))
+		}
+	}
+	sort.Strings(sockets)
+	return sockets, nil
+}
@@ -0,0 +1,98 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package hooks
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	kubev1 "k8s.io/api/core/v1"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+)
+
+var _ = Describe("Hooks", func() {
+	var vm *v1.VirtualMachine
+
+	BeforeEach(func() {
+		vm = v1.NewMinimalVM("testvm")
+		SetSidecarsEnabled(true)
+	})
+
+	It("should not add containers to VMs without sidecars", func() {
+		containers, volumes, err := GenerateContainers(vm, "/var/run/kubevirt")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(containers).To(BeEmpty())
+		Expect(volumes).To(BeEmpty())
+	})
+
+	It("should share the socket directory of the VM with the sidecars", func() {
+		vm.ObjectMeta.Annotations = map[string]string{
+			v1.HookSidecarsAnnotation: `[{"image": "registry:5000/hook:devel", "imagePullPolicy": "Always"}, {"image": "registry:5000/other-hook:devel"}]`,
+		}
+		containers, volumes, err := GenerateContainers(vm, "/var/run/kubevirt")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(containers).To(HaveLen(2))
+		Expect(containers[0].Name).To(Equal("hook-sidecar-0"))
+		Expect(containers[0].ImagePullPolicy).To(Equal(kubev1.PullAlways))
+		Expect(containers[1].Image).To(Equal("registry:5000/other-hook:devel"))
+		Expect(containers[1].ImagePullPolicy).To(Equal(kubev1.PullIfNotPresent))
+		Expect(containers[1].VolumeMounts).To(Equal([]kubev1.VolumeMount{{Name: volumeName, MountPath: SocketsDir}}))
+		Expect(volumes).To(HaveLen(1))
+		Expect(volumes[0].HostPath.Path).To(Equal("/var/run/kubevirt/default/testvm/hooks"))
+	})
+
+	It("should reject sidecars without an image", func() {
+		vm.ObjectMeta.Annotations = map[string]string{v1.HookSidecarsAnnotation: `[{"imagePullPolicy": "Always"}]`}
+		_, err := SidecarsFromVM(vm)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should reject sidecars while they are disabled", func() {
+		SetSidecarsEnabled(false)
+		vm.ObjectMeta.Annotations = map[string]string{v1.HookSidecarsAnnotation: `[{"image": "registry:5000/hook:devel"}]`}
+		_, _, err := GenerateContainers(vm, "/var/run/kubevirt")
+		Expect(err).To(MatchError("hook sidecars are disabled"))
+	})
+
+	It("should list the sockets in the order of their names", func() {
+		dir, err := ioutil.TempDir("", "hooks")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+		for _, name := range []string{"b.sock", "a.sock", "README"} {
+			Expect(ioutil.WriteFile(filepath.Join(dir, name), nil, 0644)).To(Succeed())
+		}
+
+		sockets, err := Sockets(dir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sockets).To(Equal([]string{filepath.Join(dir, "a.sock"), filepath.Join(dir, "b.sock")}))
+
+		sockets, err = Sockets(filepath.Join(dir, "missing"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sockets).To(BeEmpty())
+	})
+
+	AfterEach(func() {
+		SetSidecarsEnabled(false)
+	})
+})
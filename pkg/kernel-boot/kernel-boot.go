@@ -0,0 +1,237 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package kernelboot
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jeevatkm/go-model"
+
+	kubev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	diskutils "kubevirt.io/kubevirt/pkg/ephemeral-disk-utils"
+	"kubevirt.io/kubevirt/pkg/precond"
+)
+
+const (
+	kernelName    = "kernel"
+	initrdName    = "initrd"
+	sourceDir     = "/kernel-boot-source"
+	containerName = "kernel-boot"
+	volumeName    = "kernel-boot-volume"
+	sourceVolume  = "kernel-boot-source"
+)
+
+// The copy script is run by a shell inside the kernel boot container. It
+// copies the kernel and the initrd to the host directory and keeps the
+// container alive afterwards, so that the readiness probe can report success.
+const copyScript = `cp "$KERNEL_PATH" "$COPY_PATH/` + kernelName + `" && ` +
+	`if [ -n "$INITRD_PATH" ]; then cp "$INITRD_PATH" "$COPY_PATH/` + initrdName + `"; fi && ` +
+	`touch /tmp/healthy && while true; do sleep 60; done`
+
+var kernelBootOwner = "qemu"
+
+var mountBaseDir = "/var/run/libvirt/kubevirt-kernel-boot"
+
+func generateVMBaseDir(vm *v1.VirtualMachine) string {
+	domain := precond.MustNotBeEmpty(vm.GetObjectMeta().GetName())
+	namespace := precond.MustNotBeEmpty(vm.GetObjectMeta().GetNamespace())
+	return fmt.Sprintf("%s/%s/%s", mountBaseDir, namespace, domain)
+}
+
+func SetLocalDirectory(dir string) error {
+	mountBaseDir = dir
+	return nil
+}
+
+// The unit test suite uses this function
+func SetLocalDataOwner(user string) {
+	kernelBootOwner = user
+}
+
+func hasKernelBoot(vm *v1.VirtualMachine) bool {
+	return vm.Spec.Domain != nil && vm.Spec.Domain.OS.KernelBoot != nil
+}
+
+func CleanupOrphanedKernelBootData(indexer cache.Store) error {
+	vms, err := diskutils.ListVmWithEphemeralDisk(mountBaseDir)
+	if err != nil {
+		return err
+	}
+
+	for _, vm := range vms {
+		key, err := cache.MetaNamespaceKeyFunc(vm)
+		if err != nil {
+			return err
+		}
+		obj, exists, _ := indexer.GetByKey(key)
+		if exists && !obj.(*v1.VirtualMachine).IsFinal() {
+			continue
+		}
+		if err := CleanupKernelBootData(vm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func CleanupKernelBootData(vm *v1.VirtualMachine) error {
+	err := os.RemoveAll(generateVMBaseDir(vm))
+	if err != nil && os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// The virt-handler replaces the paths inside the kernel boot source with the
+// paths of the copies on the host, which libvirt can consume.
+func MapKernelBoot(vm *v1.VirtualMachine) (*v1.VirtualMachine, error) {
+	if !hasKernelBoot(vm) {
+		return vm, nil
+	}
+	vmCopy := &v1.VirtualMachine{}
+	model.Copy(vmCopy, vm)
+
+	kernelBoot := vmCopy.Spec.Domain.OS.KernelBoot
+	baseDir := generateVMBaseDir(vm)
+
+	kernelPath := filepath.Join(baseDir, kernelName)
+	if err := prepareFile(kernelPath); err != nil {
+		return vm, err
+	}
+	kernelBoot.Kernel = kernelPath
+
+	if kernelBoot.Initrd != "" {
+		initrdPath := filepath.Join(baseDir, initrdName)
+		if err := prepareFile(initrdPath); err != nil {
+			return vm, err
+		}
+		kernelBoot.Initrd = initrdPath
+	}
+	return vmCopy, nil
+}
+
+func prepareFile(path string) error {
+	exists, err := diskutils.FileExists(path)
+	if err != nil {
+		return err
+	} else if !exists {
+		return fmt.Errorf("kernel boot file %s does not exist", path)
+	}
+	return diskutils.SetFileOwnership(kernelBootOwner, path)
+}
+
+// The controller uses this function to generate the container which copies
+// the kernel and the initrd from a container image or a persistent volume
+// claim to the host. Persistent volume claims are read by a container based
+// on the helper image.
+func GenerateContainers(vm *v1.VirtualMachine, helperImage string) ([]kubev1.Container, []kubev1.Volume, error) {
+	if !hasKernelBoot(vm) {
+		return nil, nil, nil
+	}
+	kernelBoot := vm.Spec.Domain.OS.KernelBoot
+	source := kernelBoot.Source
+
+	if kernelBoot.Kernel == "" {
+		return nil, nil, fmt.Errorf("kernel boot requires a kernel")
+	}
+	if (source.Image == "") == (source.PersistentVolumeClaim == "") {
+		return nil, nil, fmt.Errorf("kernel boot requires exactly one of image or persistentVolumeClaim")
+	}
+
+	volumeMountDir := generateVMBaseDir(vm)
+	kernelPath := kernelBoot.Kernel
+	initrdPath := kernelBoot.Initrd
+	image := source.Image
+
+	volumes := []kubev1.Volume{
+		{
+			Name: volumeName,
+			VolumeSource: kubev1.VolumeSource{
+				HostPath: &kubev1.HostPathVolumeSource{
+					Path: volumeMountDir,
+				},
+			},
+		},
+	}
+	volumeMounts := []kubev1.VolumeMount{
+		{
+			Name:      volumeName,
+			MountPath: volumeMountDir,
+		},
+	}
+
+	if source.PersistentVolumeClaim != "" {
+		image = helperImage
+		kernelPath = filepath.Join(sourceDir, kernelPath)
+		if initrdPath != "" {
+			initrdPath = filepath.Join(sourceDir, initrdPath)
+		}
+		volumes = append(volumes, kubev1.Volume{
+			Name: sourceVolume,
+			VolumeSource: kubev1.VolumeSource{
+				PersistentVolumeClaim: &kubev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: source.PersistentVolumeClaim,
+					ReadOnly:  true,
+				},
+			},
+		})
+		volumeMounts = append(volumeMounts, kubev1.VolumeMount{
+			Name:      sourceVolume,
+			MountPath: sourceDir,
+			ReadOnly:  true,
+		})
+	}
+
+	container := kubev1.Container{
+		Name:            containerName,
+		Image:           image,
+		ImagePullPolicy: kubev1.PullIfNotPresent,
+		Command:         []string{"/bin/sh", "-c", copyScript},
+		Env: []kubev1.EnvVar{
+			{Name: "COPY_PATH", Value: volumeMountDir},
+			{Name: "KERNEL_PATH", Value: kernelPath},
+			{Name: "INITRD_PATH", Value: initrdPath},
+		},
+		VolumeMounts: volumeMounts,
+		// The readiness probe ensures that the copy finished before the
+		// container is marked as "Ready: True"
+		ReadinessProbe: &kubev1.Probe{
+			Handler: kubev1.Handler{
+				Exec: &kubev1.ExecAction{
+					Command: []string{
+						"cat",
+						"/tmp/healthy",
+					},
+				},
+			},
+			InitialDelaySeconds: 2,
+			PeriodSeconds:       5,
+			TimeoutSeconds:      5,
+			SuccessThreshold:    2,
+			FailureThreshold:    5,
+		},
+	}
+	return []kubev1.Container{container}, volumes, nil
+}
@@ -0,0 +1,124 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package kernelboot
+
+import (
+	"io/ioutil"
+	"os"
+	"os/user"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	kubev1 "k8s.io/api/core/v1"
+
+	v1 "kubevirt.io/kubevirt/pkg/api/v1"
+)
+
+var _ = Describe("KernelBoot", func() {
+	tmpDir, _ := ioutil.TempDir("", "kernelboottest")
+	owner, err := user.Current()
+	if err != nil {
+		panic(err)
+	}
+
+	newKernelBootVM := func(source v1.KernelBootSource) *v1.VirtualMachine {
+		vm := v1.NewMinimalVM("fake-vm")
+		vm.Spec.Domain.OS.KernelBoot = &v1.KernelBoot{
+			Kernel:     "/boot/vmlinuz",
+			Initrd:     "/boot/initrd.img",
+			KernelArgs: "console=ttyS0",
+			Source:     source,
+		}
+		return vm
+	}
+
+	BeforeSuite(func() {
+		err := SetLocalDirectory(tmpDir)
+		if err != nil {
+			panic(err)
+		}
+		SetLocalDataOwner(owner.Username)
+	})
+
+	AfterSuite(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	Context("verify container generation", func() {
+		It("by copying from the container image", func() {
+			vm := newKernelBootVM(v1.KernelBootSource{Image: "someimage:v1.2.3.4"})
+			containers, volumes, err := GenerateContainers(vm, "launcher:latest")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(containers)).To(Equal(1))
+			Expect(len(volumes)).To(Equal(1))
+			Expect(containers[0].Image).To(Equal("someimage:v1.2.3.4"))
+			Expect(containers[0].Env).To(ContainElement(kubev1.EnvVar{Name: "KERNEL_PATH", Value: "/boot/vmlinuz"}))
+		})
+
+		It("by copying from the persistent volume claim", func() {
+			vm := newKernelBootVM(v1.KernelBootSource{PersistentVolumeClaim: "kernels"})
+			containers, volumes, err := GenerateContainers(vm, "launcher:latest")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(containers)).To(Equal(1))
+			Expect(len(volumes)).To(Equal(2))
+			Expect(containers[0].Image).To(Equal("launcher:latest"))
+			Expect(volumes[1].PersistentVolumeClaim.ClaimName).To(Equal("kernels"))
+		})
+
+		It("by rejecting an ambiguous source", func() {
+			vm := newKernelBootVM(v1.KernelBootSource{Image: "someimage", PersistentVolumeClaim: "kernels"})
+			_, _, err := GenerateContainers(vm, "launcher:latest")
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("by skipping VMs without kernel boot", func() {
+			containers, volumes, err := GenerateContainers(v1.NewMinimalVM("fake-vm"), "launcher:latest")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(containers).To(BeEmpty())
+			Expect(volumes).To(BeEmpty())
+		})
+	})
+
+	Context("verify mapping", func() {
+		It("by pointing to the host copies", func() {
+			vm := newKernelBootVM(v1.KernelBootSource{Image: "someimage:v1.2.3.4"})
+			baseDir := generateVMBaseDir(vm)
+			Expect(os.MkdirAll(baseDir, 0750)).To(Succeed())
+			Expect(ioutil.WriteFile(baseDir+"/kernel", []byte("kernel"), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(baseDir+"/initrd", []byte("initrd"), 0644)).To(Succeed())
+
+			mapped, err := MapKernelBoot(vm)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mapped.Spec.Domain.OS.KernelBoot.Kernel).To(Equal(baseDir + "/kernel"))
+			Expect(mapped.Spec.Domain.OS.KernelBoot.Initrd).To(Equal(baseDir + "/initrd"))
+			Expect(mapped.Spec.Domain.OS.KernelBoot.KernelArgs).To(Equal("console=ttyS0"))
+
+			Expect(CleanupKernelBootData(vm)).To(Succeed())
+			_, err = os.Stat(baseDir)
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		It("by failing when the kernel was not copied yet", func() {
+			vm := newKernelBootVM(v1.KernelBootSource{Image: "someimage:v1.2.3.4"})
+			_, err := MapKernelBoot(vm)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -28,6 +28,7 @@ type VirtHandlerConn interface {
 	NodeMigrationDetails(vm *virtv1.VirtualMachine) (*virtv1.MigrationHostInfo, error)
 	ConnectionDetails() (ip string, port string, err error)
 	ConsoleURI(vm *virtv1.VirtualMachine) (*url.URL, error)
+	ConsolesURI(vm *virtv1.VirtualMachine) (*url.URL, error)
 	Pod() (pod *v1.Pod, err error)
 }
 
@@ -131,6 +132,17 @@ func (v *virtHandlerConn) ConsoleURI(vm *virtv1.VirtualMachine) (*url.URL, error
 	}, nil
 }
 
+func (v *virtHandlerConn) ConsolesURI(vm *virtv1.VirtualMachine) (*url.URL, error) {
+	ip, port, err := v.ConnectionDetails()
+	if err != nil {
+		return nil, err
+	}
+	return &url.URL{
+		Path: fmt.Sprintf("/api/v1/namespaces/%s/virtualmachines/%s/consoles", vm.ObjectMeta.Namespace, vm.ObjectMeta.Name),
+		Host: ip + ":" + port,
+	}, nil
+}
+
 func (v *virtHandlerConn) Pod() (pod *v1.Pod, err error) {
 	if v.err != nil {
 		err = v.err
@@ -0,0 +1,105 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package memorydump
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	kubev1 "k8s.io/api/core/v1"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+)
+
+const (
+	// MountPath is where the memory dump claim of a VM is mounted in the
+	// compute container of its virt-launcher Pod
+	MountPath  = "/var/run/kubevirt-memory-dump"
+	volumeName = "memory-dump"
+)
+
+// Request is a memory dump which was asked for in the MemoryDumpAnnotation
+// of a VM.
+type Request struct {
+	// Path is the file on the memory dump claim, relative to its root
+	Path   string `json:"path"`
+	Format string `json:"format,omitempty"`
+}
+
+// ClaimFromVM returns the name of the memory dump claim of the VM, if it has
+// one.
+func ClaimFromVM(vm *v1.VirtualMachine) string {
+	return vm.ObjectMeta.Annotations[v1.MemoryDumpClaimAnnotation]
+}
+
+// RequestFromVM returns the memory dump which the VM asks for, if any. Dumps
+// can only be written into the memory dump claim of the VM.
+func RequestFromVM(vm *v1.VirtualMachine) (*Request, error) {
+	annotation, exists := vm.ObjectMeta.Annotations[v1.MemoryDumpAnnotation]
+	if !exists {
+		return nil, nil
+	}
+	request := &Request{}
+	if err := json.Unmarshal([]byte(annotation), request); err != nil {
+		return nil, fmt.Errorf("invalid memory dump request: %v", err)
+	}
+	if ClaimFromVM(vm) == "" {
+		return nil, fmt.Errorf("the VM has no memory dump claim")
+	}
+	if err := ValidatePath(request.Path); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// ValidatePath makes sure that the path stays on the memory dump claim.
+func ValidatePath(path string) error {
+	clean := filepath.Clean(path)
+	if path == "" || filepath.IsAbs(path) || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return fmt.Errorf("invalid memory dump path %s", path)
+	}
+	return nil
+}
+
+// GenerateVolume returns the volume of the memory dump claim of the VM and
+// its mount in the compute container, or nil if the VM has no claim. The
+// claim has to be there when the VM starts, the volumes of a Pod can't be
+// changed afterwards.
+func GenerateVolume(vm *v1.VirtualMachine) (*kubev1.Volume, *kubev1.VolumeMount) {
+	claim := ClaimFromVM(vm)
+	if claim == "" {
+		return nil, nil
+	}
+	volume := &kubev1.Volume{
+		Name: volumeName,
+		VolumeSource: kubev1.VolumeSource{
+			PersistentVolumeClaim: &kubev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: claim,
+			},
+		},
+	}
+	mount := &kubev1.VolumeMount{
+		Name:      volumeName,
+		MountPath: MountPath,
+	}
+	return volume, mount
+}
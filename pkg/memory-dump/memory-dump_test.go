@@ -0,0 +1,72 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package memorydump
+
+import (
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+)
+
+var _ = Describe("Memory dump", func() {
+	var vm *v1.VirtualMachine
+
+	BeforeEach(func() {
+		vm = v1.NewMinimalVM("testvm")
+		vm.ObjectMeta.Annotations = map[string]string{v1.MemoryDumpClaimAnnotation: "dumps"}
+	})
+
+	It("should mount the memory dump claim", func() {
+		volume, mount := GenerateVolume(vm)
+		Expect(volume.PersistentVolumeClaim.ClaimName).To(Equal("dumps"))
+		Expect(mount.Name).To(Equal(volume.Name))
+		Expect(mount.MountPath).To(Equal(MountPath))
+	})
+
+	It("should not mount anything without a memory dump claim", func() {
+		volume, mount := GenerateVolume(v1.NewMinimalVM("testvm"))
+		Expect(volume).To(BeNil())
+		Expect(mount).To(BeNil())
+	})
+
+	It("should read the requested memory dump", func() {
+		vm.ObjectMeta.Annotations[v1.MemoryDumpAnnotation] = `{"path": "testvm/1.kdump", "format": "kdump-zlib"}`
+		Expect(RequestFromVM(vm)).To(Equal(&Request{Path: "testvm/1.kdump", Format: "kdump-zlib"}))
+	})
+
+	It("should refuse memory dumps without a claim", func() {
+		delete(vm.ObjectMeta.Annotations, v1.MemoryDumpClaimAnnotation)
+		vm.ObjectMeta.Annotations[v1.MemoryDumpAnnotation] = `{"path": "testvm.core"}`
+		_, err := RequestFromVM(vm)
+		Expect(err).To(MatchError("the VM has no memory dump claim"))
+	})
+
+	table.DescribeTable("should only write onto the claim", func(path string) {
+		Expect(ValidatePath(path)).ToNot(Succeed())
+	},
+		table.Entry("with an empty path", ""),
+		table.Entry("with an absolute path", "/etc/testvm.core"),
+		table.Entry("with a path leaving the claim", "dumps/../../testvm.core"),
+		table.Entry("with the parent directory", ".."),
+		table.Entry("with the claim itself", "dumps/.."),
+	)
+})
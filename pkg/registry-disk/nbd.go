@@ -0,0 +1,168 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package registrydisk
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	diskutils "kubevirt.io/kubevirt/pkg/ephemeral-disk-utils"
+)
+
+const nbdSocketName = "disk.sock"
+const nbdPidFileSuffix = ".pid"
+
+var qemuNBDBinary = "qemu-nbd"
+var nbdStartTimeout = 10 * time.Second
+
+var serveNBD = false
+
+// SetNBDExports makes MapRegistryDisks serve the registry disks to qemu
+// through qemu-nbd, instead of handing the image files over to qemu.
+func SetNBDExports(enabled bool) {
+	serveNBD = enabled
+}
+
+// StartNBDExport serves the image over a unix socket with qemu-nbd. Writes of
+// the guest go to a temporary overlay, the image itself is never modified.
+// The pid of qemu-nbd is recorded next to the socket, so that the export can
+// be stopped even after virt-handler was restarted. An export which is
+// already running is kept, restarting it would drop the writes of the guest.
+func StartNBDExport(image string, format string, socket string) error {
+	running, err := nbdExportRunning(socket)
+	if err != nil {
+		return err
+	}
+	if running {
+		return nil
+	}
+	// Clean up after a qemu-nbd which went away
+	if err := StopNBDExport(socket); err != nil {
+		return err
+	}
+
+	cmd := exec.Command(qemuNBDBinary, "--persistent", "--snapshot", "--format", format, "--socket", socket, image)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	pid := strconv.Itoa(cmd.Process.Pid)
+	if err := ioutil.WriteFile(socket+nbdPidFileSuffix, []byte(pid), 0600); err != nil {
+		cmd.Process.Kill()
+		return err
+	}
+
+	timeout := time.After(nbdStartTimeout)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-exited:
+			os.Remove(socket + nbdPidFileSuffix)
+			return fmt.Errorf("qemu-nbd exited while exporting %s: %v", image, err)
+		case <-timeout:
+			cmd.Process.Kill()
+			os.Remove(socket + nbdPidFileSuffix)
+			return fmt.Errorf("timed out waiting for qemu-nbd to export %s", image)
+		case <-ticker.C:
+			exists, err := diskutils.FileExists(socket)
+			if err != nil {
+				return err
+			}
+			if exists {
+				return nil
+			}
+		}
+	}
+}
+
+// nbdExportRunning checks whether the qemu-nbd process recorded for the
+// socket is still alive.
+func nbdExportRunning(socket string) (bool, error) {
+	pid, err := readNBDPid(socket)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if err := syscall.Kill(pid, 0); err == syscall.ESRCH {
+		return false, nil
+	} else if err != nil && err != syscall.EPERM {
+		return false, err
+	}
+	return diskutils.FileExists(socket)
+}
+
+func readNBDPid(socket string) (int, error) {
+	pidFile := socket + nbdPidFileSuffix
+	content, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid qemu-nbd pid file %s: %v", pidFile, err)
+	}
+	return pid, nil
+}
+
+// StopNBDExport stops the qemu-nbd process behind the socket. It is not an
+// error if there is no such export.
+func StopNBDExport(socket string) error {
+	pid, err := readNBDPid(socket)
+	if os.IsNotExist(err) {
+		return diskutils.RemoveFile(socket)
+	} else if err != nil {
+		return err
+	}
+	if err := syscall.Kill(pid, syscall.SIGTERM); err != nil && err != syscall.ESRCH {
+		return err
+	}
+	if err := diskutils.RemoveFile(socket + nbdPidFileSuffix); err != nil {
+		return err
+	}
+	return diskutils.RemoveFile(socket)
+}
+
+// StopNBDExports stops all qemu-nbd exports of the VM
+func StopNBDExports(vm *v1.VirtualMachine) error {
+	sockets, err := filepath.Glob(filepath.Join(generateVMBaseDir(vm), "disk*", nbdSocketName))
+	if err != nil {
+		return err
+	}
+	for _, socket := range sockets {
+		if err := StopNBDExport(socket); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package registrydisk
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	diskutils "kubevirt.io/kubevirt/pkg/ephemeral-disk-utils"
+)
+
+var _ = Describe("NBD exports", func() {
+	var tmpDir string
+	var originalBinary string
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "nbdtest")
+		Expect(err).ToNot(HaveOccurred())
+
+		// A fake qemu-nbd which only creates the socket
+		originalBinary = qemuNBDBinary
+		qemuNBDBinary = filepath.Join(tmpDir, "qemu-nbd")
+		script := "#!/bin/sh\nwhile [ \"$1\" != \"--socket\" ]; do shift; done\ntouch \"$2\"\nexec sleep 60\n"
+		Expect(ioutil.WriteFile(qemuNBDBinary, []byte(script), 0755)).To(Succeed())
+	})
+
+	It("should start and stop an export", func() {
+		socket := filepath.Join(tmpDir, nbdSocketName)
+		Expect(StartNBDExport(filepath.Join(tmpDir, "disk-image.raw"), "raw", socket)).To(Succeed())
+
+		exists, err := diskutils.FileExists(socket + nbdPidFileSuffix)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(exists).To(BeTrue())
+
+		Expect(StopNBDExport(socket)).To(Succeed())
+		exists, err = diskutils.FileExists(socket)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(exists).To(BeFalse())
+	})
+
+	It("should keep a running export", func() {
+		socket := filepath.Join(tmpDir, nbdSocketName)
+		Expect(StartNBDExport(filepath.Join(tmpDir, "disk-image.raw"), "raw", socket)).To(Succeed())
+		defer StopNBDExport(socket)
+		pid, err := readNBDPid(socket)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(StartNBDExport(filepath.Join(tmpDir, "disk-image.raw"), "raw", socket)).To(Succeed())
+		Expect(readNBDPid(socket)).To(Equal(pid))
+	})
+
+	It("should fail if qemu-nbd exits", func() {
+		Expect(ioutil.WriteFile(qemuNBDBinary, []byte("#!/bin/sh\nexit 1\n"), 0755)).To(Succeed())
+		Expect(StartNBDExport(filepath.Join(tmpDir, "disk-image.raw"), "raw", filepath.Join(tmpDir, nbdSocketName))).ToNot(Succeed())
+	})
+
+	It("should ignore missing exports", func() {
+		Expect(StopNBDExport(filepath.Join(tmpDir, nbdSocketName))).To(Succeed())
+	})
+
+	AfterEach(func() {
+		qemuNBDBinary = originalBinary
+		os.RemoveAll(tmpDir)
+	})
+})
@@ -23,6 +23,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/jeevatkm/go-model"
 
@@ -30,6 +31,7 @@ import (
 	"k8s.io/client-go/tools/cache"
 
 	"kubevirt.io/kubevirt/pkg/api/v1"
+	diskimage "kubevirt.io/kubevirt/pkg/disk-image"
 	diskutils "kubevirt.io/kubevirt/pkg/ephemeral-disk-utils"
 	"kubevirt.io/kubevirt/pkg/precond"
 )
@@ -41,6 +43,11 @@ var registryDiskOwner = "qemu"
 
 var mountBaseDir = "/var/run/libvirt/kubevirt-disk-dir"
 
+var validateImage = func(path string, format string) error {
+	_, err := diskimage.Validate(path, format, diskimage.DefaultPolicy)
+	return err
+}
+
 func generateVMBaseDir(vm *v1.VirtualMachine) string {
 	domain := precond.MustNotBeEmpty(vm.GetObjectMeta().GetName())
 	namespace := precond.MustNotBeEmpty(vm.GetObjectMeta().GetNamespace())
@@ -115,6 +122,10 @@ func CleanupOrphanedEphemeralDisks(indexer cache.Store) error {
 }
 
 func CleanupEphemeralDisks(vm *v1.VirtualMachine) error {
+	if err := StopNBDExports(vm); err != nil {
+		return err
+	}
+
 	volumeMountDir := generateVMBaseDir(vm)
 	err := os.RemoveAll(volumeMountDir)
 	if err != nil && os.IsNotExist(err) {
@@ -123,9 +134,9 @@ func CleanupEphemeralDisks(vm *v1.VirtualMachine) error {
 	return err
 }
 
-// The virt-handler converts registry disks to their corresponding iscsi network
-// disks when the VM spec is being defined as a domain with libvirt.
-// The ports and host of the iscsi disks are already provided here by the controller.
+// The virt-handler converts registry disks to their corresponding file disks,
+// or NBD network disks if enabled, when the VM spec is being defined as a
+// domain with libvirt.
 func MapRegistryDisks(vm *v1.VirtualMachine) (*v1.VirtualMachine, error) {
 	vmCopy := &v1.VirtualMachine{}
 	model.Copy(vmCopy, vm)
@@ -139,6 +150,12 @@ func MapRegistryDisks(vm *v1.VirtualMachine) (*v1.VirtualMachine, error) {
 				return vm, err
 			}
 
+			// Registry disks come from arbitrary container images
+			err = validateImage(diskPath, diskType)
+			if err != nil {
+				return vm, err
+			}
+
 			// Rename file to release management of it from container process.
 			oldDiskPath := diskPath
 			diskPath = oldDiskPath + ".virt"
@@ -161,6 +178,30 @@ func MapRegistryDisks(vm *v1.VirtualMachine) (*v1.VirtualMachine, error) {
 			}
 			newDisk.Source.File = diskPath
 			newDisk.Target = disk.Target
+			newDisk.IOTune = disk.IOTune
+			// Only keep the image as it came out of the container if asked to
+			newDisk.Ephemeral = disk.Ephemeral
+
+			if serveNBD {
+				socket := filepath.Join(volumeMountDir, nbdSocketName)
+				err = StartNBDExport(diskPath, diskType, socket)
+				if err != nil {
+					return vm, err
+				}
+				err = diskutils.SetFileOwnership(registryDiskOwner, socket)
+				if err != nil {
+					return vm, err
+				}
+
+				// qemu-nbd takes care of the image format
+				newDisk.Type = "network"
+				newDisk.Driver.Type = "raw"
+				newDisk.Ephemeral = false
+				newDisk.Source = v1.DiskSource{
+					Protocol: "nbd",
+					Host:     &v1.DiskSourceHost{Transport: "unix", Socket: socket},
+				}
+			}
 			vmCopy.Spec.Domain.Devices.Disks[diskCount] = newDisk
 		}
 	}
@@ -42,7 +42,12 @@ var _ = Describe("RegistryDisk", func() {
 		panic(err)
 	}
 
-	VerifyDiskType := func(diskExtension string) {
+	// The fake disk images are empty files
+	validateImage = func(path string, format string) error {
+		return nil
+	}
+
+	VerifyDiskType := func(diskExtension string, ephemeral bool) {
 		vm := v1.NewMinimalVM("fake-vm")
 		vm.Spec.Domain.Devices.Disks = append(vm.Spec.Domain.Devices.Disks, v1.Disk{
 			Type:   "RegistryDisk:v1alpha",
@@ -53,6 +58,7 @@ var _ = Describe("RegistryDisk", func() {
 			Target: v1.DiskTarget{
 				Device: "vda",
 			},
+			Ephemeral: ephemeral,
 		})
 
 		// create a fake disk file
@@ -83,6 +89,7 @@ var _ = Describe("RegistryDisk", func() {
 		Expect(vm.Spec.Domain.Devices.Disks[0].Driver.Type).To(Equal(diskExtension))
 		Expect(vm.Spec.Domain.Devices.Disks[0].Source).ToNot(Equal(nil))
 		Expect(vm.Spec.Domain.Devices.Disks[0].Source.File).To(Equal(filePath + ".virt"))
+		Expect(vm.Spec.Domain.Devices.Disks[0].Ephemeral).To(Equal(ephemeral))
 
 		err = CleanupEphemeralDisks(vm)
 		exists, err = diskutils.FileExists(volumeMountDir)
@@ -106,11 +113,13 @@ var _ = Describe("RegistryDisk", func() {
 	Describe("registry-disk", func() {
 		Context("verify helper functions", func() {
 			table.DescribeTable("by verifying mapping of ",
-				func(diskType string) {
-					VerifyDiskType(diskType)
+				func(diskType string, ephemeral bool) {
+					VerifyDiskType(diskType, ephemeral)
 				},
-				table.Entry("qcow2 disk", "qcow2"),
-				table.Entry("raw disk", "raw"),
+				table.Entry("qcow2 disk", "qcow2", false),
+				table.Entry("raw disk", "raw", false),
+				table.Entry("ephemeral qcow2 disk", "qcow2", true),
+				table.Entry("ephemeral raw disk", "raw", true),
 			)
 			It("by verifying error when no disk is present", func() {
 
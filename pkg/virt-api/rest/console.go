@@ -24,6 +24,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 
 	"github.com/emicklei/go-restful"
 	"github.com/gorilla/websocket"
@@ -32,6 +33,7 @@ import (
 
 	"k8s.io/apimachinery/pkg/api/errors"
 
+	"kubevirt.io/kubevirt/pkg/api/v1"
 	"kubevirt.io/kubevirt/pkg/kubecli"
 	"kubevirt.io/kubevirt/pkg/logging"
 )
@@ -51,8 +53,9 @@ func NewConsoleResource(virtClient kubecli.KubevirtClient, k8sClient k8scorev1.C
 	return &Console{virtClient: virtClient, k8sClient: k8sClient}
 }
 
-func (t *Console) Console(request *restful.Request, response *restful.Response) {
-	console := request.QueryParameter("console")
+// runningVM looks up the running VM of the request. On failure, the error
+// is written to the response.
+func (t *Console) runningVM(request *restful.Request, response *restful.Response) (*v1.VirtualMachine, bool) {
 	vmName := request.PathParameter("name")
 	namespace := request.PathParameter("namespace")
 
@@ -60,21 +63,66 @@ func (t *Console) Console(request *restful.Request, response *restful.Response)
 	if errors.IsNotFound(err) {
 		logging.DefaultLogger().Info().V(3).Msgf("VM '%s' does not exist", vmName)
 		response.WriteError(http.StatusNotFound, fmt.Errorf("VM does not exist"))
-		return
+		return nil, false
 	}
 	if err != nil {
 		logging.DefaultLogger().Error().Reason(err).Msgf("Error fetching VM '%s'", vmName)
 		response.WriteError(http.StatusInternalServerError, err)
-		return
+		return nil, false
 	}
 
-	log := logging.DefaultLogger().Object(vm)
-
 	if !vm.IsRunning() {
-		log.Info().V(3).Reason(err).Msg("VM is not running")
+		logging.DefaultLogger().Object(vm).Info().V(3).Msg("VM is not running")
 		response.WriteError(http.StatusBadRequest, fmt.Errorf("VM is not running"))
+		return nil, false
+	}
+	return vm, true
+}
+
+// ListConsoles proxies the list of the console devices of a running VM from
+// the virt-handler on its node.
+func (t *Console) ListConsoles(request *restful.Request, response *restful.Response) {
+	vm, ok := t.runningVM(request, response)
+	if !ok {
+		return
+	}
+	log := logging.DefaultLogger().Object(vm)
+
+	virtHandlerCon := kubecli.NewVirtHandlerClient(t.virtClient).ForNode(vm.Status.NodeName)
+	uri, err := virtHandlerCon.ConsolesURI(vm)
+	if err != nil {
+		msg := fmt.Sprintf("Looking up the connection details for virt-handler on node %s failed", vm.Status.NodeName)
+		log.Error().Reason(err).Msg(msg)
+		response.WriteError(http.StatusInternalServerError, fmt.Errorf(msg))
 		return
 	}
+	if t.VirtHandlerPort != "" {
+		uri.Host = uri.Hostname() + ":" + t.VirtHandlerPort
+	}
+	uri.Scheme = "http"
+
+	resp, err := http.Get(uri.String())
+	if err != nil {
+		log.Error().Reason(err).Msgf("Failed to connect to virt-handler")
+		response.WriteError(http.StatusInternalServerError, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	response.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+	response.WriteHeader(resp.StatusCode)
+	if _, err := io.Copy(response, resp.Body); err != nil {
+		log.Error().Reason(err).Msgf("Failed to proxy the consoles from virt-handler")
+	}
+}
+
+func (t *Console) Console(request *restful.Request, response *restful.Response) {
+	console := request.QueryParameter("console")
+	vm, ok := t.runningVM(request, response)
+	if !ok {
+		return
+	}
+	log := logging.DefaultLogger().Object(vm)
 
 	virtHandlerCon := kubecli.NewVirtHandlerClient(t.virtClient).ForNode(vm.Status.NodeName)
 	uri, err := virtHandlerCon.ConsoleURI(vm)
@@ -90,9 +138,14 @@ func (t *Console) Console(request *restful.Request, response *restful.Response)
 		uri.Host = uri.Hostname() + ":" + t.VirtHandlerPort
 	}
 	uri.Scheme = "ws"
+	query := url.Values{}
 	if console != "" {
-		uri.RawQuery = "console=" + console
+		query.Set("console", console)
+	}
+	if force := request.QueryParameter("force"); force != "" {
+		query.Set("force", force)
 	}
+	uri.RawQuery = query.Encode()
 	handlerSocket, resp, err := websocket.DefaultDialer.Dial(uri.String(), nil)
 	if err != nil {
 		if resp != nil && resp.StatusCode != http.StatusOK {
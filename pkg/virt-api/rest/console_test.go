@@ -57,6 +57,7 @@ var _ = Describe("Console", func() {
 	var server *httptest.Server
 	var dial func(vm string, console string) *websocket.Conn
 	var get func(vm string) (*http.Response, error)
+	var list func(vm string) (*http.Response, error)
 
 	logging.DefaultLogger().SetIOWriter(GinkgoWriter)
 
@@ -95,6 +96,12 @@ var _ = Describe("Console", func() {
 		// Endpoint to test
 		consoleResource := NewConsoleResource(virtClient, k8sClient)
 		ws.Route(ws.GET("/virt-api/namespaces/{namespace}/virtualmachines/{name}/console").To(consoleResource.Console))
+		ws.Route(ws.GET("/virt-api/namespaces/{namespace}/virtualmachines/{name}/consoles").To(consoleResource.ListConsoles))
+
+		// Mock out the console list of virt-handler
+		ws.Route(ws.GET("/api/v1/namespaces/{namespace}/virtualmachines/{name}/consoles").To(func(request *restful.Request, response *restful.Response) {
+			response.WriteHeaderAndJson(http.StatusOK, []map[string]string{{"name": "serial0", "kind": "serial", "type": "pty"}}, restful.MIME_JSON)
+		}))
 
 		// Mock out virt-handler. Mirror the first message and exit.
 		ws.Route(ws.GET("/api/v1/namespaces/{namespace}/virtualmachines/{name}/console").To(func(request *restful.Request, response *restful.Response) {
@@ -130,6 +137,12 @@ var _ = Describe("Console", func() {
 			wsUrl.Path = "/virt-api/namespaces/" + k8sv1.NamespaceDefault + "/virtualmachines/" + vm + "/console"
 			return http.DefaultClient.Get(wsUrl.String())
 		}
+
+		list = func(vm string) (*http.Response, error) {
+			wsUrl.Scheme = "http"
+			wsUrl.Path = "/virt-api/namespaces/" + k8sv1.NamespaceDefault + "/virtualmachines/" + vm + "/consoles"
+			return http.DefaultClient.Get(wsUrl.String())
+		}
 		Expect(err).ToNot(HaveOccurred())
 	})
 
@@ -146,6 +159,16 @@ var _ = Describe("Console", func() {
 		Expect(string(data)).To(Equal("hello echo!"))
 	})
 
+	It("Should proxy the consoles of the VM from virt-handler", func() {
+		vmInterface.EXPECT().Get("testvm", gomock.Any()).Return(vm, nil)
+		virtClient.EXPECT().CoreV1().Return(k8sClient)
+		response, err := list("testvm")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response.StatusCode).To(Equal(http.StatusOK))
+		Expect(response.Header.Get("Content-Type")).To(Equal(restful.MIME_JSON))
+		Expect(body(response)).To(ContainSubstring(`"name": "serial0"`))
+	})
+
 	It("Should return 404 if the VM does not exist", func() {
 		vmInterface.EXPECT().Get("testvm", gomock.Any()).Return(vm, errors.NewNotFound(schema.GroupResource{}, "testvm"))
 		response, err := get("testvm")
@@ -21,21 +21,27 @@ package services
 
 import (
 	"fmt"
+	"net"
 
 	kubev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
+	"strconv"
 	"strings"
 
 	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/hooks"
+	kernelboot "kubevirt.io/kubevirt/pkg/kernel-boot"
 	"kubevirt.io/kubevirt/pkg/logging"
+	memorydump "kubevirt.io/kubevirt/pkg/memory-dump"
 	"kubevirt.io/kubevirt/pkg/precond"
 	registrydisk "kubevirt.io/kubevirt/pkg/registry-disk"
 )
 
 type TemplateService interface {
 	RenderLaunchManifest(*v1.VirtualMachine) (*kubev1.Pod, error)
-	RenderMigrationJob(*v1.VirtualMachine, *kubev1.Node, *kubev1.Node, *kubev1.Pod, *v1.MigrationHostInfo) (*kubev1.Pod, error)
+	RenderMigrationJob(*v1.VirtualMachine, *kubev1.Node, *kubev1.Node, *kubev1.Pod, *v1.MigrationHostInfo, *v1.MigrationHostInfo, *v1.MigrationOptions) (*kubev1.Pod, error)
 }
 
 type templateService struct {
@@ -92,11 +98,37 @@ func (t *templateService) RenderLaunchManifest(vm *v1.VirtualMachine) (*kubev1.P
 		},
 	}
 
+	if cpus := dedicatedCPUs(vm); cpus != nil {
+		container.Resources = kubev1.ResourceRequirements{
+			Requests: kubev1.ResourceList{kubev1.ResourceCPU: *cpus},
+			Limits:   kubev1.ResourceList{kubev1.ResourceCPU: *cpus},
+		}
+	}
+
 	containers, volumes, err := registrydisk.GenerateContainers(vm)
 	if err != nil {
 		return nil, err
 	}
 
+	kernelBootContainers, kernelBootVolumes, err := kernelboot.GenerateContainers(vm, t.launcherImage)
+	if err != nil {
+		return nil, err
+	}
+	containers = append(containers, kernelBootContainers...)
+	volumes = append(volumes, kernelBootVolumes...)
+
+	hookContainers, hookVolumes, err := hooks.GenerateContainers(vm, t.socketBaseDir)
+	if err != nil {
+		return nil, err
+	}
+	containers = append(containers, hookContainers...)
+	volumes = append(volumes, hookVolumes...)
+
+	if volume, mount := memorydump.GenerateVolume(vm); volume != nil {
+		container.VolumeMounts = append(container.VolumeMounts, *mount)
+		volumes = append(volumes, *volume)
+	}
+
 	volumes = append(volumes, kubev1.Volume{
 		Name: "sockets",
 		VolumeSource: kubev1.VolumeSource{
@@ -120,7 +152,7 @@ func (t *templateService) RenderLaunchManifest(vm *v1.VirtualMachine) (*kubev1.P
 		Spec: kubev1.PodSpec{
 			RestartPolicy: kubev1.RestartPolicyNever,
 			Containers:    containers,
-			NodeSelector:  vm.Spec.NodeSelector,
+			NodeSelector:  nodeSelector(vm),
 			Volumes:       volumes,
 		},
 	}
@@ -136,7 +168,7 @@ func (t *templateService) RenderLaunchManifest(vm *v1.VirtualMachine) (*kubev1.P
 	return &pod, nil
 }
 
-func (t *templateService) RenderMigrationJob(vm *v1.VirtualMachine, sourceNode *kubev1.Node, targetNode *kubev1.Node, targetPod *kubev1.Pod, targetHostInfo *v1.MigrationHostInfo) (*kubev1.Pod, error) {
+func (t *templateService) RenderMigrationJob(vm *v1.VirtualMachine, sourceNode *kubev1.Node, targetNode *kubev1.Node, targetPod *kubev1.Pod, sourceHostInfo *v1.MigrationHostInfo, targetHostInfo *v1.MigrationHostInfo, options *v1.MigrationOptions) (*kubev1.Pod, error) {
 	srcAddr := ""
 	dstAddr := ""
 	for _, addr := range sourceNode.Status.Addresses {
@@ -165,6 +197,17 @@ func (t *templateService) RenderMigrationJob(vm *v1.VirtualMachine, sourceNode *
 	}
 	destUri := fmt.Sprintf("qemu+tcp://%s/system", dstAddr)
 
+	if err := validateMigrationOptions(options, sourceHostInfo, targetHostInfo); err != nil {
+		logging.DefaultLogger().Error().Reason(err).Msg("invalid migration options")
+		return nil, err
+	}
+
+	migrationAddr, err := migrationAddress(options, targetHostInfo)
+	if err != nil {
+		logging.DefaultLogger().Error().Reason(err).Msg("migration network is unreachable")
+		return nil, err
+	}
+
 	job := kubev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
 			GenerateName: "virt-migration",
@@ -193,10 +236,52 @@ func (t *templateService) RenderMigrationJob(vm *v1.VirtualMachine, sourceNode *
 			},
 		},
 	}
+	if migrationAddr != "" {
+		job.Spec.Containers[0].Command = append(job.Spec.Containers[0].Command, "--migration-address", migrationAddr)
+		// Without a listen address qemu accepts the migration on all
+		// addresses of the target, the stream still takes the migration
+		// network
+		if sourceHostInfo.SupportsFeature(v1.MigrationFeatureListenAddress) && targetHostInfo.SupportsFeature(v1.MigrationFeatureListenAddress) {
+			job.Spec.Containers[0].Command = append(job.Spec.Containers[0].Command, "--listen-address", migrationAddr)
+		}
+	}
+	job.Spec.Containers[0].Command = append(job.Spec.Containers[0].Command, migrationOptionArgs(options)...)
+	if options != nil && options.CopyLocalDisks {
+		if disks := localDiskTargets(vm); len(disks) > 0 {
+			job.Spec.Containers[0].Command = append(job.Spec.Containers[0].Command, "--copy-disks", strings.Join(disks, ","))
+		}
+	}
 
 	return &job, nil
 }
 
+// dedicatedCPUs returns the whole CPUs the kubelet CPU manager should
+// dedicate to the virt-launcher Pod, one per vCPU, or nil if the VM does
+// not ask for dedicated CPUs.
+func dedicatedCPUs(vm *v1.VirtualMachine) *resource.Quantity {
+	if vm.Spec.Domain == nil || vm.Spec.Domain.VCPU == nil || !vm.Spec.Domain.VCPU.DedicatedCPUPlacement {
+		return nil
+	}
+	cpus := vm.Spec.Domain.VCPU.CPUs
+	if cpus == 0 {
+		cpus = 1
+	}
+	return resource.NewQuantity(int64(cpus), resource.DecimalSI)
+}
+
+// nodeSelector adds the labels of the host capabilities the VM needs to
+// the node selector of the VM.
+func nodeSelector(vm *v1.VirtualMachine) map[string]string {
+	if vm.Spec.Domain == nil || vm.Spec.Domain.SEV == nil {
+		return vm.Spec.NodeSelector
+	}
+	selector := map[string]string{v1.SEVLabel: "true"}
+	for key, value := range vm.Spec.NodeSelector {
+		selector[key] = value
+	}
+	return selector
+}
+
 func NewTemplateService(launcherImage string, migratorImage string, socketDir string) (TemplateService, error) {
 	precond.MustNotBeEmpty(launcherImage)
 	precond.MustNotBeEmpty(migratorImage)
@@ -207,3 +292,98 @@ func NewTemplateService(launcherImage string, migratorImage string, socketDir st
 	}
 	return &svc, nil
 }
+
+func migrationOptionArgs(options *v1.MigrationOptions) []string {
+	args := []string{}
+	if options == nil {
+		return args
+	}
+	if options.Bandwidth != 0 {
+		args = append(args, "--bandwidth", strconv.FormatUint(options.Bandwidth, 10))
+	}
+	if options.MaxDowntime != 0 {
+		args = append(args, "--max-downtime", strconv.FormatUint(options.MaxDowntime, 10))
+	}
+	if options.AutoConverge {
+		args = append(args, "--auto-converge")
+	}
+	if options.PostCopy || options.PostCopyAfterPrecopy {
+		args = append(args, "--postcopy")
+	}
+	if options.PostCopyAfterPrecopy {
+		args = append(args, "--postcopy-after-precopy")
+	}
+	if options.TLS {
+		args = append(args, "--tls")
+	}
+	if options.ParallelConnections != 0 {
+		args = append(args, "--parallel-connections", strconv.FormatUint(uint64(options.ParallelConnections), 10))
+	}
+	return args
+}
+
+// localDiskTargets lists the target devices of all writable disks which are
+// not shared between the hosts.
+func localDiskTargets(vm *v1.VirtualMachine) []string {
+	disks := []string{}
+	for _, disk := range vm.Spec.Domain.Devices.Disks {
+		if disk.Device != "disk" || disk.ReadOnly != nil {
+			continue
+		}
+		if disk.Type == "network" || disk.Type == "PersistentVolumeClaim" {
+			continue
+		}
+		disks = append(disks, disk.Target.Device)
+	}
+	return disks
+}
+
+// validateMigrationOptions rejects options which can't be combined or which
+// libvirt and qemu on one of the hosts are too old for.
+func validateMigrationOptions(options *v1.MigrationOptions, sourceHostInfo *v1.MigrationHostInfo, targetHostInfo *v1.MigrationHostInfo) error {
+	if options == nil {
+		return nil
+	}
+	if options.TLS {
+		if err := requireMigrationFeature(v1.MigrationFeatureTLS, sourceHostInfo, targetHostInfo); err != nil {
+			return err
+		}
+	}
+	if options.ParallelConnections != 0 {
+		if options.PostCopy || options.PostCopyAfterPrecopy {
+			return fmt.Errorf("parallel migration connections can't be combined with post-copy")
+		}
+		if err := requireMigrationFeature(v1.MigrationFeatureParallelConnections, sourceHostInfo, targetHostInfo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func requireMigrationFeature(feature v1.MigrationFeature, sourceHostInfo *v1.MigrationHostInfo, targetHostInfo *v1.MigrationHostInfo) error {
+	if !sourceHostInfo.SupportsFeature(feature) {
+		return fmt.Errorf("the source host does not support the %s migration feature", feature)
+	}
+	if !targetHostInfo.SupportsFeature(feature) {
+		return fmt.Errorf("the target host does not support the %s migration feature", feature)
+	}
+	return nil
+}
+
+// migrationAddress picks the address of the target host in the migration
+// network. It returns an empty address if no migration network is chosen.
+func migrationAddress(options *v1.MigrationOptions, targetHostInfo *v1.MigrationHostInfo) (string, error) {
+	if options == nil || options.Network == "" {
+		return "", nil
+	}
+	_, network, err := net.ParseCIDR(options.Network)
+	if err != nil {
+		return "", fmt.Errorf("invalid migration network %s: %v", options.Network, err)
+	}
+	for _, addr := range targetHostInfo.Addresses {
+		if ip := net.ParseIP(addr); ip != nil && network.Contains(ip) {
+			return addr, nil
+		}
+	}
+	return "", fmt.Errorf("migration target has no address in the migration network %s", options.Network)
+}
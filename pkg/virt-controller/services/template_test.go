@@ -29,6 +29,7 @@ import (
 	"k8s.io/apimachinery/pkg/util/uuid"
 
 	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/hooks"
 	"kubevirt.io/kubevirt/pkg/logging"
 )
 
@@ -61,6 +62,98 @@ var _ = Describe("Template", func() {
 					"--readiness-file", "/tmp/healthy"}))
 			})
 		})
+		Context("with a memory dump claim", func() {
+			It("should mount the claim into the compute container", func() {
+				vm := v1.VirtualMachine{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "testvm", Namespace: "testns", UID: "1234",
+						Annotations: map[string]string{v1.MemoryDumpClaimAnnotation: "dumps"},
+					},
+					Spec: v1.VMSpec{Domain: &v1.DomainSpec{}},
+				}
+
+				pod, err := svc.RenderLaunchManifest(&vm)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(pod.Spec.Containers[0].VolumeMounts).To(ContainElement(kubev1.VolumeMount{Name: "memory-dump", MountPath: "/var/run/kubevirt-memory-dump"}))
+				Expect(pod.Spec.Volumes).To(ContainElement(kubev1.Volume{
+					Name: "memory-dump",
+					VolumeSource: kubev1.VolumeSource{
+						PersistentVolumeClaim: &kubev1.PersistentVolumeClaimVolumeSource{ClaimName: "dumps"},
+					},
+				}))
+			})
+		})
+		Context("with dedicated CPUs", func() {
+			It("should request a whole CPU per vCPU for the compute container", func() {
+				vm := v1.NewMinimalVM("testvm")
+				vm.Spec.Domain.VCPU = &v1.VCPU{CPUs: 2, DedicatedCPUPlacement: true}
+
+				pod, err := svc.RenderLaunchManifest(vm)
+				Expect(err).ToNot(HaveOccurred())
+				resources := pod.Spec.Containers[0].Resources
+				Expect(resources.Requests.Cpu().Value()).To(Equal(int64(2)))
+				Expect(resources.Limits.Cpu().Value()).To(Equal(int64(2)))
+			})
+			It("should leave the CPUs of other VMs alone", func() {
+				vm := v1.NewMinimalVM("testvm")
+				vm.Spec.Domain.VCPU = &v1.VCPU{CPUs: 2}
+
+				pod, err := svc.RenderLaunchManifest(vm)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(pod.Spec.Containers[0].Resources.Requests).To(BeEmpty())
+			})
+		})
+		Context("with hook sidecars", func() {
+			BeforeEach(func() {
+				hooks.SetSidecarsEnabled(true)
+			})
+
+			It("should add the sidecars and share the socket directory of the VM with them", func() {
+				vm := v1.VirtualMachine{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "testvm", Namespace: "testns", UID: "1234",
+						Annotations: map[string]string{
+							v1.HookSidecarsAnnotation: `[{"image": "registry:5000/hook:devel"}]`,
+						},
+					},
+					Spec: v1.VMSpec{Domain: &v1.DomainSpec{}},
+				}
+
+				pod, err := svc.RenderLaunchManifest(&vm)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(pod.Spec.Containers).To(HaveLen(2))
+				Expect(pod.Spec.Containers[0].Name).To(Equal("hook-sidecar-0"))
+				Expect(pod.Spec.Containers[0].Image).To(Equal("registry:5000/hook:devel"))
+				Expect(pod.Spec.Containers[0].VolumeMounts[0].MountPath).To(Equal("/var/run/kubevirt-hooks"))
+				Expect(pod.Spec.Containers[1].Name).To(Equal("compute"))
+				Expect(pod.Spec.Volumes).To(ContainElement(kubev1.Volume{
+					Name: "hook-sidecar-sockets",
+					VolumeSource: kubev1.VolumeSource{
+						HostPath: &kubev1.HostPathVolumeSource{Path: "/var/run/libvirt/testns/testvm/hooks"},
+					},
+				}))
+			})
+
+			It("should refuse to render VMs with sidecars while they are disabled", func() {
+				hooks.SetSidecarsEnabled(false)
+				vm := v1.VirtualMachine{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "testvm", Namespace: "testns", UID: "1234",
+						Annotations: map[string]string{
+							v1.HookSidecarsAnnotation: `[{"image": "registry:5000/hook:devel"}]`,
+						},
+					},
+					Spec: v1.VMSpec{Domain: &v1.DomainSpec{}},
+				}
+
+				_, err := svc.RenderLaunchManifest(&vm)
+				Expect(err).To(MatchError("hook sidecars are disabled"))
+			})
+
+			AfterEach(func() {
+				hooks.SetSidecarsEnabled(false)
+			})
+		})
 		Context("with node selectors", func() {
 			It("should add node selectors to template", func() {
 
@@ -92,6 +185,22 @@ var _ = Describe("Template", func() {
 				Expect(pod.Spec.Containers[0].VolumeMounts[0].MountPath).To(Equal("/var/run/libvirt/default/testvm"))
 			})
 
+			It("should schedule SEV guests on SEV capable nodes", func() {
+				nodeSelector := map[string]string{
+					"kubernetes.io/hostname": "master",
+				}
+				vm := v1.VirtualMachine{ObjectMeta: metav1.ObjectMeta{Name: "testvm", Namespace: "default", UID: "1234"}, Spec: v1.VMSpec{NodeSelector: nodeSelector, Domain: &v1.DomainSpec{SEV: &v1.SEV{}}}}
+
+				pod, err := svc.RenderLaunchManifest(&vm)
+
+				Expect(err).To(BeNil())
+				Expect(pod.Spec.NodeSelector).To(Equal(map[string]string{
+					"kubernetes.io/hostname": "master",
+					v1.SEVLabel:              "true",
+				}))
+				Expect(vm.Spec.NodeSelector).To(HaveLen(1))
+			})
+
 			It("should add node affinity to pod", func() {
 				nodeAffinity := kubev1.NodeAffinity{}
 				vm := v1.VirtualMachine{
@@ -171,17 +280,20 @@ var _ = Describe("Template", func() {
 					destPod, err = svc.RenderLaunchManifest(vm)
 					Expect(err).ToNot(HaveOccurred())
 					destPod.Status.PodIP = "127.0.0.1"
-					hostInfo = &v1.MigrationHostInfo{PidNS: "pidns", Controller: []string{"cpu", "memory"}, Slice: "slice"}
+					hostInfo = &v1.MigrationHostInfo{
+						PidNS: "pidns", Controller: []string{"cpu", "memory"}, Slice: "slice",
+						Features: []v1.MigrationFeature{v1.MigrationFeatureTLS, v1.MigrationFeatureParallelConnections, v1.MigrationFeatureListenAddress},
+					}
 				})
 				Context("with correct parameters", func() {
 
 					It("should never restart", func() {
-						job, err := svc.RenderMigrationJob(vm, &srcNodeIp, &destNodeIp, destPod, hostInfo)
+						job, err := svc.RenderMigrationJob(vm, &srcNodeIp, &destNodeIp, destPod, hostInfo, hostInfo, nil)
 						Expect(err).ToNot(HaveOccurred())
 						Expect(job.Spec.RestartPolicy).To(Equal(kubev1.RestartPolicyNever))
 					})
 					It("should use the first ip it finds", func() {
-						job, err := svc.RenderMigrationJob(vm, &srcNode, &targetNode, destPod, hostInfo)
+						job, err := svc.RenderMigrationJob(vm, &srcNode, &targetNode, destPod, hostInfo, hostInfo, nil)
 						Expect(err).ToNot(HaveOccurred())
 						refCommand := []string{
 							"/migrate", "testvm", "--source", "qemu+tcp://127.0.0.2/system",
@@ -191,17 +303,95 @@ var _ = Describe("Template", func() {
 						}
 						Expect(job.Spec.Containers[0].Command).To(Equal(refCommand))
 					})
+					It("should migrate over parallel connections", func() {
+						options := &v1.MigrationOptions{ParallelConnections: 4}
+						job, err := svc.RenderMigrationJob(vm, &srcNode, &targetNode, destPod, hostInfo, hostInfo, options)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(job.Spec.Containers[0].Command[16:]).To(Equal([]string{"--parallel-connections", "4"}))
+					})
+					It("should refuse parallel connections the hosts don't support", func() {
+						oldHostInfo := &v1.MigrationHostInfo{PidNS: "pidns", Controller: []string{"cpu", "memory"}, Slice: "slice", Features: []v1.MigrationFeature{v1.MigrationFeatureTLS}}
+						options := &v1.MigrationOptions{ParallelConnections: 4}
+						_, err := svc.RenderMigrationJob(vm, &srcNode, &targetNode, destPod, oldHostInfo, hostInfo, options)
+						Expect(err).To(MatchError("the source host does not support the ParallelConnections migration feature"))
+						_, err = svc.RenderMigrationJob(vm, &srcNode, &targetNode, destPod, hostInfo, oldHostInfo, options)
+						Expect(err).To(MatchError("the target host does not support the ParallelConnections migration feature"))
+					})
+					It("should refuse parallel post-copy migrations", func() {
+						options := &v1.MigrationOptions{ParallelConnections: 4, PostCopy: true}
+						job, err := svc.RenderMigrationJob(vm, &srcNode, &targetNode, destPod, hostInfo, hostInfo, options)
+						Expect(err).To(HaveOccurred())
+						Expect(job).To(BeNil())
+					})
+					It("should copy the local disks", func() {
+						vm.Spec.Domain.Devices.Disks = []v1.Disk{
+							{Device: "disk", Type: "RegistryDisk:v1alpha", Target: v1.DiskTarget{Device: "vda"}},
+							{Device: "disk", Type: "PersistentVolumeClaim", Target: v1.DiskTarget{Device: "vdb"}},
+							{Device: "disk", Type: "network", Target: v1.DiskTarget{Device: "vdc"}},
+							{Device: "disk", Type: "file", Target: v1.DiskTarget{Device: "vdd"}},
+							{Device: "cdrom", Type: "file", Target: v1.DiskTarget{Device: "hda"}, ReadOnly: &v1.ReadOnly{}},
+						}
+						options := &v1.MigrationOptions{CopyLocalDisks: true}
+						job, err := svc.RenderMigrationJob(vm, &srcNode, &targetNode, destPod, hostInfo, hostInfo, options)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(job.Spec.Containers[0].Command[16:]).To(Equal([]string{"--copy-disks", "vda,vdd"}))
+					})
+					It("should pass the migration options to the migrator", func() {
+						options := &v1.MigrationOptions{Bandwidth: 100, MaxDowntime: 500, AutoConverge: true, PostCopy: true}
+						job, err := svc.RenderMigrationJob(vm, &srcNode, &targetNode, destPod, hostInfo, hostInfo, options)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(job.Spec.Containers[0].Command[16:]).To(Equal([]string{
+							"--bandwidth", "100", "--max-downtime", "500", "--auto-converge", "--postcopy",
+						}))
+					})
+				})
+				Context("with a migration network", func() {
+					BeforeEach(func() {
+						hostInfo.Addresses = []string{"127.0.0.3", "10.10.0.5"}
+					})
+					It("should migrate through the target address in the migration network", func() {
+						options := &v1.MigrationOptions{Network: "10.10.0.0/16", TLS: true}
+						job, err := svc.RenderMigrationJob(vm, &srcNode, &targetNode, destPod, hostInfo, hostInfo, options)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(job.Spec.Containers[0].Command[16:]).To(Equal([]string{
+							"--migration-address", "10.10.0.5", "--listen-address", "10.10.0.5", "--tls",
+						}))
+					})
+					It("should only bind to the target address if both hosts support it", func() {
+						oldHostInfo := &v1.MigrationHostInfo{PidNS: "pidns", Controller: []string{"cpu", "memory"}, Slice: "slice"}
+						options := &v1.MigrationOptions{Network: "10.10.0.0/16"}
+						job, err := svc.RenderMigrationJob(vm, &srcNode, &targetNode, destPod, oldHostInfo, hostInfo, options)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(job.Spec.Containers[0].Command[16:]).To(Equal([]string{"--migration-address", "10.10.0.5"}))
+					})
+					It("should refuse TLS if one of the hosts does not support it", func() {
+						oldHostInfo := &v1.MigrationHostInfo{PidNS: "pidns", Controller: []string{"cpu", "memory"}, Slice: "slice"}
+						options := &v1.MigrationOptions{Network: "10.10.0.0/16", TLS: true}
+						_, err := svc.RenderMigrationJob(vm, &srcNode, &targetNode, destPod, hostInfo, oldHostInfo, options)
+						Expect(err).To(MatchError("the target host does not support the TLS migration feature"))
+					})
+					It("should error if the target is not in the migration network", func() {
+						options := &v1.MigrationOptions{Network: "192.168.0.0/24"}
+						job, err := svc.RenderMigrationJob(vm, &srcNode, &targetNode, destPod, hostInfo, hostInfo, options)
+						Expect(err).To(HaveOccurred())
+						Expect(job).To(BeNil())
+					})
+					It("should error on an invalid migration network", func() {
+						options := &v1.MigrationOptions{Network: "10.10.0.0"}
+						_, err := svc.RenderMigrationJob(vm, &srcNode, &targetNode, destPod, hostInfo, hostInfo, options)
+						Expect(err).To(HaveOccurred())
+					})
 				})
 				Context("with incorrect parameters", func() {
 					It("should error on missing source address", func() {
 						srcNode.Status.Addresses = []kubev1.NodeAddress{}
-						job, err := svc.RenderMigrationJob(vm, &srcNode, &targetNode, destPod, hostInfo)
+						job, err := svc.RenderMigrationJob(vm, &srcNode, &targetNode, destPod, hostInfo, hostInfo, nil)
 						Expect(err).To(HaveOccurred())
 						Expect(job).To(BeNil())
 					})
 					It("should error on missing destination address", func() {
 						targetNode.Status.Addresses = []kubev1.NodeAddress{}
-						job, err := svc.RenderMigrationJob(vm, &srcNode, &targetNode, destPod, hostInfo)
+						job, err := svc.RenderMigrationJob(vm, &srcNode, &targetNode, destPod, hostInfo, hostInfo, nil)
 						Expect(err).To(HaveOccurred())
 						Expect(job).To(BeNil())
 					})
@@ -18,6 +18,8 @@ import (
 	"k8s.io/client-go/util/workqueue"
 
 	"kubevirt.io/kubevirt/pkg/controller"
+	"kubevirt.io/kubevirt/pkg/hooks"
+	kernelboot "kubevirt.io/kubevirt/pkg/kernel-boot"
 	"kubevirt.io/kubevirt/pkg/kubecli"
 	"kubevirt.io/kubevirt/pkg/logging"
 	registrydisk "kubevirt.io/kubevirt/pkg/registry-disk"
@@ -53,6 +55,7 @@ type VirtControllerApp struct {
 	migratorImage    string
 	socketDir        string
 	ephemeralDiskDir string
+	hookSidecars     bool
 }
 
 func Execute() {
@@ -124,6 +127,11 @@ func (vca *VirtControllerApp) initCommon() {
 	if err != nil {
 		golog.Fatal(err)
 	}
+	err = kernelboot.SetLocalDirectory(vca.ephemeralDiskDir + "/kernel-boot-data")
+	if err != nil {
+		golog.Fatal(err)
+	}
+	hooks.SetSidecarsEnabled(vca.hookSidecars)
 	vca.templateService, err = services.NewTemplateService(vca.launcherImage, vca.migratorImage, vca.socketDir)
 	if err != nil {
 		golog.Fatal(err)
@@ -149,5 +157,6 @@ func (vca *VirtControllerApp) DefineFlags() {
 	flag.StringVar(&vca.migratorImage, "migrator-image", "virt-handler", "Container which orchestrates a VM migration")
 	flag.StringVar(&vca.socketDir, "socket-dir", "/var/run/kubevirt", "Directory where to look for sockets for cgroup detection")
 	flag.StringVar(&vca.ephemeralDiskDir, "ephemeral-disk-dir", "/var/run/libvirt/kubevirt-ephemeral-disk", "Base direcetory for ephemeral disk data")
+	flag.BoolVar(&vca.hookSidecars, "enable-hook-sidecars", false, "Allow VMs to add hook sidecars which change their domain before it is defined")
 	flag.Parse()
 }
@@ -30,6 +30,7 @@ import (
 	"kubevirt.io/kubevirt/pkg/api/v1"
 	"kubevirt.io/kubevirt/pkg/controller"
 	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap"
 	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
 )
 
@@ -38,27 +39,31 @@ TODO: Define the exact scope of this controller.
 For now it looks like we should use domain events to detect unexpected domain changes like crashes or vms going
 into pause mode because of resource shortage or cut off connections to storage.
 */
-func NewDomainController(vmQueue workqueue.RateLimitingInterface, vmStore cache.Store, informer cache.SharedInformer, restClient rest.RESTClient, recorder record.EventRecorder) (cache.Store, *controller.Controller) {
+func NewDomainController(vmQueue workqueue.RateLimitingInterface, vmStore cache.Store, informer cache.SharedInformer, restClient rest.RESTClient, recorder record.EventRecorder, domainManager virtwrap.DomainManager) (cache.Store, *controller.Controller) {
 	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
 	informer.AddEventHandler(controller.NewResourceEventHandlerFuncsForWorkqueue(queue))
-	dispatch := NewDomainDispatch(vmQueue, vmStore, restClient, recorder)
+	dispatch := NewDomainDispatch(vmQueue, vmStore, restClient, recorder, domainManager)
 	return controller.NewControllerFromInformer(informer.GetStore(), informer, queue, dispatch)
 }
 
-func NewDomainDispatch(vmQueue workqueue.RateLimitingInterface, vmStore cache.Store, restClient rest.RESTClient, recorder record.EventRecorder) controller.ControllerDispatch {
+func NewDomainDispatch(vmQueue workqueue.RateLimitingInterface, vmStore cache.Store, restClient rest.RESTClient, recorder record.EventRecorder, domainManager virtwrap.DomainManager) controller.ControllerDispatch {
 	return &DomainDispatch{
-		vmQueue:    vmQueue,
-		vmStore:    vmStore,
-		recorder:   recorder,
-		restClient: restClient,
+		vmQueue:       vmQueue,
+		vmStore:       vmStore,
+		recorder:      recorder,
+		restClient:    restClient,
+		domainManager: domainManager,
+		guests:        virtwrap.NewGuestStateMachine(),
 	}
 }
 
 type DomainDispatch struct {
-	vmQueue    workqueue.RateLimitingInterface
-	vmStore    cache.Store
-	recorder   record.EventRecorder
-	restClient rest.RESTClient
+	vmQueue       workqueue.RateLimitingInterface
+	vmStore       cache.Store
+	recorder      record.EventRecorder
+	restClient    rest.RESTClient
+	domainManager virtwrap.DomainManager
+	guests        *virtwrap.GuestStateMachine
 }
 
 func (d *DomainDispatch) Execute(indexer cache.Store, queue workqueue.RateLimitingInterface, key interface{}) {
@@ -76,6 +81,7 @@ func (d *DomainDispatch) Execute(indexer cache.Store, queue workqueue.RateLimiti
 			return
 		}
 		domain = api.NewDomainReferenceFromName(namespace, name)
+		d.guests.Forget(key.(string))
 		logging.DefaultLogger().Info().Object(domain).Msgf("Domain deleted")
 	} else {
 		domain = obj.(*api.Domain)
@@ -86,11 +92,20 @@ func (d *DomainDispatch) Execute(indexer cache.Store, queue workqueue.RateLimiti
 		queue.AddRateLimited(key)
 		return
 	}
+	if !vmExists && d.domainManager.IsAdopted(v1.NewVMReferenceFromNameWithNS(domain.ObjectMeta.Namespace, domain.ObjectMeta.Name)) {
+		// Adopted domains have no VM, their state changes are only reported
+		if exists {
+			if transition, changed := d.guests.Observe(key.(string), domain.Status.Status, domain.Status.Reason); changed {
+				logging.DefaultLogger().Info().Object(domain).Msgf("Adopted guest changed from phase %s to %s, reason %s", transition.From, transition.To, transition.Reason)
+			}
+		}
+		return
+	}
 	if !vmExists || obj.(*v1.VirtualMachine).GetObjectMeta().GetUID() != domain.GetObjectMeta().GetUID() {
 		// The VM is not in the vm cache, or is a VM with a differend uuid, tell the VM controller to investigate it
 		d.vmQueue.Add(key)
 	} else {
-		err := d.setVmPhaseForStatusReason(domain, obj.(*v1.VirtualMachine))
+		err := d.setVmPhaseForStatusReason(key.(string), domain, obj.(*v1.VirtualMachine))
 		if err != nil {
 			queue.AddRateLimited(key)
 		}
@@ -99,25 +114,129 @@ func (d *DomainDispatch) Execute(indexer cache.Store, queue workqueue.RateLimiti
 	return
 }
 
-func (d *DomainDispatch) setVmPhaseForStatusReason(domain *api.Domain, vm *v1.VirtualMachine) error {
+func (d *DomainDispatch) setVmPhaseForStatusReason(key string, domain *api.Domain, vm *v1.VirtualMachine) error {
+	transition, changed := d.guests.Observe(key, domain.Status.Status, domain.Status.Reason)
+	if !changed {
+		return nil
+	}
+	logging.DefaultLogger().Info().Object(vm).Msgf("Guest changed from phase %s to %s, reason %s", transition.From, transition.To, transition.Reason)
+
 	flag := false
-	if domain.Status.Status == api.Shutoff || domain.Status.Status == api.Crashed {
-		switch domain.Status.Reason {
-		case api.ReasonCrashed, api.ReasonPanicked:
-			vm.Status.Phase = v1.Failed
-			d.recorder.Event(vm, k8sv1.EventTypeWarning, v1.Stopped.String(), "The VM crashed.")
-			flag = true
-		case api.ReasonShutdown, api.ReasonDestroyed, api.ReasonSaved, api.ReasonFromSnapshot:
-			vm.Status.Phase = v1.Succeeded
-			d.recorder.Event(vm, k8sv1.EventTypeNormal, v1.Stopped.String(), "The VM was shut down.")
+	keepPhase := false
+	switch transition.To {
+	case virtwrap.GuestFailed:
+		if transition.Reason == api.ReasonWatchdog {
+			d.recorder.Event(vm, k8sv1.EventTypeWarning, v1.Stopped.String(), "The VM watchdog fired.")
+		} else if transition.Reason == api.ReasonPostCopyFailed {
+			if !hasCondition(vm, v1.PostCopyFailed) {
+				vm.Status.Conditions = append(vm.Status.Conditions, v1.VMCondition{
+					Type:               v1.PostCopyFailed,
+					Status:             k8sv1.ConditionTrue,
+					LastProbeTime:      transition.Timestamp,
+					LastTransitionTime: transition.Timestamp,
+					Reason:             string(api.ReasonPostCopyFailed),
+					Message:            "The post-copy migration failed, the guest can't be resumed.",
+				})
+			}
+			d.recorder.Event(vm, k8sv1.EventTypeWarning, v1.FailedVirtualMachineMigration.String(), "The post-copy migration failed.")
+		} else {
+			d.recorder.Event(vm, k8sv1.EventTypeWarning, v1.Stopped.String(), "The VM failed.")
+		}
+		flag = true
+	case virtwrap.GuestCrashed:
+		d.recorder.Eventf(vm, k8sv1.EventTypeWarning, v1.Stopped.String(), "The VM crashed, reason %s.", transition.Reason)
+		// Only guests in the crashed state still have memory to dump
+		dumping := false
+		if domain.Status.Status == api.Crashed && vm.Spec.Domain != nil && vm.Spec.Domain.CoreDumpOnCrash {
+			if _, err := d.domainManager.DumpCrashedGuest(vm); err != nil {
+				logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Dumping the crashed guest failed.")
+				d.recorder.Eventf(vm, k8sv1.EventTypeWarning, v1.CoreDumped.String(), "Dumping the crashed guest failed: %v", err)
+			} else {
+				dumping = true
+			}
+		}
+		switch virtwrap.CrashActionFor(vm) {
+		case v1.CrashActionRestart:
+			if dumping {
+				// The dump job restarts the guest once the dump is written
+				keepPhase = true
+			} else if _, err := d.domainManager.RestartCrashedGuest(vm); err != nil {
+				logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Restarting the crashed guest failed.")
+				d.recorder.Eventf(vm, k8sv1.EventTypeWarning, v1.Restarted.String(), "Restarting the crashed guest failed: %v", err)
+				flag = true
+			} else {
+				keepPhase = true
+			}
+		case v1.CrashActionReport:
+			// Leave it to the owner of the VM to decide what happens next
+			keepPhase = true
+		default:
 			flag = true
 		}
+	case virtwrap.GuestSucceeded:
+		d.recorder.Event(vm, k8sv1.EventTypeNormal, v1.Stopped.String(), "The VM was shut down.")
+		flag = true
+	}
+	if updatePausedCondition(vm, transition) {
+		flag = true
+	}
+	if transition.To.IsFinal() && !keepPhase {
+		vm.Status.Phase = transition.To.VMPhase()
 	}
 
 	if flag {
-		logging.DefaultLogger().Info().Object(vm).Msgf("Changing VM phase to %s", vm.Status.Phase)
-		return d.restClient.Put().Resource("virtualmachines").Body(vm).Name(vm.ObjectMeta.Name).Namespace(vm.ObjectMeta.Namespace).Do().Error()
+		logging.DefaultLogger().Info().Object(vm).Msgf("Updating VM status, phase is %s", vm.Status.Phase)
+		err := d.restClient.Put().Resource("virtualmachines").Body(vm).Name(vm.ObjectMeta.Name).Namespace(vm.ObjectMeta.Namespace).Do().Error()
+		if err != nil {
+			// Make sure that the transition is seen again on the retry
+			d.guests.Forget(key)
+		}
+		return err
 	}
 
 	return nil
 }
+
+// updatePausedCondition adds the Paused condition when the guest got paused
+// and removes it on any other transition. The condition can be stale from
+// before a restart of the guest or of virt-handler, so it is not enough to
+// only remove it when leaving the paused phase. It returns whether the
+// conditions changed.
+func updatePausedCondition(vm *v1.VirtualMachine, transition virtwrap.GuestTransition) bool {
+	if transition.To != virtwrap.GuestPaused {
+		return removeCondition(vm, v1.VMPaused)
+	}
+	if hasCondition(vm, v1.VMPaused) {
+		return false
+	}
+	vm.Status.Conditions = append(vm.Status.Conditions, v1.VMCondition{
+		Type:               v1.VMPaused,
+		Status:             k8sv1.ConditionTrue,
+		LastProbeTime:      transition.Timestamp,
+		LastTransitionTime: transition.Timestamp,
+		Reason:             string(transition.Reason),
+		Message:            "The guest is paused.",
+	})
+	return true
+}
+
+func hasCondition(vm *v1.VirtualMachine, conditionType v1.VMConditionType) bool {
+	for _, condition := range vm.Status.Conditions {
+		if condition.Type == conditionType {
+			return true
+		}
+	}
+	return false
+}
+
+func removeCondition(vm *v1.VirtualMachine, conditionType v1.VMConditionType) bool {
+	conditions := []v1.VMCondition{}
+	for _, condition := range vm.Status.Conditions {
+		if condition.Type != conditionType {
+			conditions = append(conditions, condition)
+		}
+	}
+	removed := len(conditions) != len(vm.Status.Conditions)
+	vm.Status.Conditions = conditions
+	return removed
+}
@@ -20,6 +20,7 @@
 package virthandler
 
 import (
+	"github.com/golang/mock/gomock"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"k8s.io/apimachinery/pkg/types"
@@ -32,6 +33,7 @@ import (
 	"kubevirt.io/kubevirt/pkg/api/v1"
 	"kubevirt.io/kubevirt/pkg/controller"
 	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap"
 	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
 )
 
@@ -43,13 +45,17 @@ var _ = Describe("Domain", func() {
 	var domainQueue workqueue.RateLimitingInterface
 	var dispatch controller.ControllerDispatch
 	var restClient rest.RESTClient
+	var ctrl *gomock.Controller
+	var domainManager *virtwrap.MockDomainManager
 
 	logging.DefaultLogger().SetIOWriter(GinkgoWriter)
 
 	BeforeEach(func() {
 		vmStore = cache.NewStore(cache.DeletionHandlingMetaNamespaceKeyFunc)
 		vmQueue = workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
-		dispatch = NewDomainDispatch(vmQueue, vmStore, restClient, record.NewFakeRecorder(100))
+		ctrl = gomock.NewController(GinkgoT())
+		domainManager = virtwrap.NewMockDomainManager(ctrl)
+		dispatch = NewDomainDispatch(vmQueue, vmStore, restClient, record.NewFakeRecorder(100), domainManager)
 
 		domainStore = cache.NewStore(cache.DeletionHandlingMetaNamespaceKeyFunc)
 		domainQueue = workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
@@ -95,6 +101,18 @@ var _ = Describe("Domain", func() {
 			Expect(vmQueue.Len()).To(Equal(0))
 		})
 
+		It("should only watch adopted domains", func() {
+			domain := api.NewMinimalDomain("legacyvm")
+			domain.Status.Status = api.Running
+			domainStore.Add(domain)
+			domainManager.EXPECT().IsAdopted(v1.NewVMReferenceFromNameWithNS(domain.ObjectMeta.Namespace, "legacyvm")).Return(true)
+			key, _ := cache.MetaNamespaceKeyFunc(domain)
+			domainQueue.Add(key)
+			controller.Dequeue(domainStore, domainQueue, dispatch)
+			Expect(vmQueue.Len()).To(Equal(0))
+			Expect(domainQueue.NumRequeues(key)).To(Equal(0))
+		})
+
 		It("should error out if the key is unparsable", func() {
 			key := "a/b/c/d"
 			domainQueue.Add(key)
@@ -114,6 +132,58 @@ var _ = Describe("Domain", func() {
 
 	})
 
+	Context("A guest crashes", func() {
+		It("should restart it in place if the crash policy asks for it", func() {
+			vm := v1.NewMinimalVM("testvm")
+			vm.Spec.Domain.CrashPolicy = &v1.CrashPolicy{Action: v1.CrashActionRestart}
+			vmStore.Add(vm)
+			domain := api.NewMinimalDomain("testvm")
+			domain.Status.Status = api.Crashed
+			domainStore.Add(domain)
+			domainManager.EXPECT().RestartCrashedGuest(vm).Return(uint(1), nil)
+			key, _ := cache.MetaNamespaceKeyFunc(domain)
+			domainQueue.Add(key)
+			controller.Dequeue(domainStore, domainQueue, dispatch)
+			Expect(domainQueue.NumRequeues(key)).To(Equal(0))
+			Expect(vm.Status.Phase).ToNot(Equal(v1.Failed))
+		})
+
+		It("should only report the crash if the crash policy asks for it", func() {
+			vm := v1.NewMinimalVM("testvm")
+			vm.Spec.Domain.CrashPolicy = &v1.CrashPolicy{Action: v1.CrashActionReport}
+			vmStore.Add(vm)
+			domain := api.NewMinimalDomain("testvm")
+			domain.Status.Status = api.Crashed
+			domainStore.Add(domain)
+			key, _ := cache.MetaNamespaceKeyFunc(domain)
+			domainQueue.Add(key)
+			controller.Dequeue(domainStore, domainQueue, dispatch)
+			Expect(domainQueue.NumRequeues(key)).To(Equal(0))
+			Expect(vm.Status.Phase).ToNot(Equal(v1.Failed))
+		})
+	})
+
+	Context("A guest gets paused", func() {
+		It("should add the paused condition once", func() {
+			vm := v1.NewMinimalVM("testvm")
+			transition := virtwrap.GuestTransition{From: virtwrap.GuestRunning, To: virtwrap.GuestPaused, Reason: api.ReasonWatchdog}
+			Expect(updatePausedCondition(vm, transition)).To(BeTrue())
+			Expect(updatePausedCondition(vm, transition)).To(BeFalse())
+			Expect(vm.Status.Conditions).To(HaveLen(1))
+			Expect(vm.Status.Conditions[0].Reason).To(Equal(string(api.ReasonWatchdog)))
+		})
+
+		It("should remove a stale paused condition when the guest starts", func() {
+			vm := v1.NewMinimalVM("testvm")
+			vm.Status.Conditions = []v1.VMCondition{{Type: v1.VMPaused}}
+			// After a restart of virt-handler the first transition starts from nothing
+			Expect(updatePausedCondition(vm, virtwrap.GuestTransition{To: virtwrap.GuestRunning})).To(BeTrue())
+			Expect(vm.Status.Conditions).To(BeEmpty())
+			Expect(updatePausedCondition(vm, virtwrap.GuestTransition{To: virtwrap.GuestRunning})).To(BeFalse())
+		})
+	})
+
 	AfterEach(func() {
+		ctrl.Finish()
 	})
 })
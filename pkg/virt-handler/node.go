@@ -0,0 +1,64 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virthandler
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+)
+
+// LabelNodeCapabilities labels the node with the capabilities of its host,
+// which only some hosts have, so that VMs which need them are only scheduled
+// there. Labels of capabilities the host lost are removed.
+func LabelNodeCapabilities(nodes corev1.NodeInterface, conn cli.Connection, nodeName string) error {
+	sev, err := virtwrap.GetSEVCapability(conn, "", "q35")
+	if err != nil {
+		return err
+	}
+
+	node, err := nodes.Get(nodeName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	labels := node.ObjectMeta.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	_, labeled := labels[v1.SEVLabel]
+	if sev != nil == labeled {
+		return nil
+	}
+	if sev != nil {
+		labels[v1.SEVLabel] = "true"
+	} else {
+		delete(labels, v1.SEVLabel)
+	}
+	node.ObjectMeta.Labels = labels
+	if _, err := nodes.Update(node); err != nil {
+		return err
+	}
+	logging.DefaultLogger().Info().Msgf("Node capability labels updated, SEV supported: %t.", sev != nil)
+	return nil
+}
@@ -0,0 +1,85 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virthandler
+
+import (
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	k8sv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	k8scorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+)
+
+var _ = Describe("Node", func() {
+	var ctrl *gomock.Controller
+	var mockConn *cli.MockConnection
+	var nodes k8scorev1.NodeInterface
+
+	sevCaps := `<domainCapabilities><features><sev supported='yes'><cbitpos>47</cbitpos><reducedPhysBits>1</reducedPhysBits></sev></features></domainCapabilities>`
+	noSEVCaps := `<domainCapabilities><features><sev supported='no'/></features></domainCapabilities>`
+
+	newNode := func(labels map[string]string) *k8sv1.Node {
+		return &k8sv1.Node{ObjectMeta: metav1.ObjectMeta{Name: "master", Labels: labels}}
+	}
+
+	labelsOf := func() map[string]string {
+		node, err := nodes.Get("master", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		return node.ObjectMeta.Labels
+	}
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockConn = cli.NewMockConnection(ctrl)
+	})
+
+	It("should label nodes of SEV capable hosts", func() {
+		nodes = fake.NewSimpleClientset(newNode(nil)).CoreV1().Nodes()
+		mockConn.EXPECT().GetDomainCapabilities("", "", "q35", "kvm", uint32(0)).Return(sevCaps, nil)
+
+		Expect(LabelNodeCapabilities(nodes, mockConn, "master")).To(Succeed())
+		Expect(labelsOf()).To(HaveKeyWithValue(v1.SEVLabel, "true"))
+	})
+
+	It("should remove the label of hosts which lost SEV", func() {
+		nodes = fake.NewSimpleClientset(newNode(map[string]string{v1.SEVLabel: "true", "other": "label"})).CoreV1().Nodes()
+		mockConn.EXPECT().GetDomainCapabilities("", "", "q35", "kvm", uint32(0)).Return(noSEVCaps, nil)
+
+		Expect(LabelNodeCapabilities(nodes, mockConn, "master")).To(Succeed())
+		Expect(labelsOf()).ToNot(HaveKey(v1.SEVLabel))
+		Expect(labelsOf()).To(HaveKeyWithValue("other", "label"))
+	})
+
+	It("should fail if the node does not exist", func() {
+		nodes = fake.NewSimpleClientset().CoreV1().Nodes()
+		mockConn.EXPECT().GetDomainCapabilities("", "", "q35", "kvm", uint32(0)).Return(sevCaps, nil)
+
+		Expect(LabelNodeCapabilities(nodes, mockConn, "master")).ToNot(Succeed())
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+})
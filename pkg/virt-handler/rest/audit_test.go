@@ -0,0 +1,73 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/emicklei/go-restful"
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap"
+)
+
+var _ = Describe("AuditTrail", func() {
+	var ctrl *gomock.Controller
+	var mockManager *virtwrap.MockDomainManager
+	var server *httptest.Server
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockManager = virtwrap.NewMockDomainManager(ctrl)
+		ws := new(restful.WebService)
+		ws.Route(ws.GET("/api/v1/namespaces/{namespace}/virtualmachines/{name}/audit").To(NewAuditTrailResource(mockManager).AuditTrail))
+		server = httptest.NewServer(restful.NewContainer().Add(ws))
+	})
+
+	It("should return the audit trail of the VM", func() {
+		mockManager.EXPECT().GetAuditTrail(v1.NewVMReferenceFromNameWithNS("default", "testvm")).Return([]virtwrap.AuditEntry{
+			{Operation: "define", Caller: "setDomainXML", ParamsHash: "0123456789abcdef"},
+			{Operation: "destroy", Caller: "killVM"},
+		})
+
+		serverUrl, err := url.Parse(server.URL)
+		Expect(err).ToNot(HaveOccurred())
+		serverUrl.Path = "/api/v1/namespaces/default/virtualmachines/testvm/audit"
+		r, err := http.DefaultClient.Get(serverUrl.String())
+		Expect(err).ToNot(HaveOccurred())
+		defer r.Body.Close()
+		Expect(r.StatusCode).To(Equal(http.StatusOK))
+
+		entries := []virtwrap.AuditEntry{}
+		Expect(json.NewDecoder(r.Body).Decode(&entries)).To(Succeed())
+		Expect(entries).To(HaveLen(2))
+		Expect(entries[1].Operation).To(Equal("destroy"))
+	})
+
+	AfterEach(func() {
+		server.Close()
+		ctrl.Finish()
+	})
+})
@@ -0,0 +1,50 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package rest
+
+import (
+	"net/http"
+
+	"github.com/emicklei/go-restful"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap"
+)
+
+type Clock struct {
+	domainManager virtwrap.DomainManager
+}
+
+func NewClockResource(domainManager virtwrap.DomainManager) *Clock {
+	return &Clock{domainManager: domainManager}
+}
+
+// RTCOffset returns the offset in seconds of the guest RTC to UTC, e.g. after
+// a Windows guest switched to daylight saving time.
+func (c *Clock) RTCOffset(request *restful.Request, response *restful.Response) {
+	vm := v1.NewVMReferenceFromNameWithNS(request.PathParameter("namespace"), request.PathParameter("name"))
+	offset, err := c.domainManager.GetRTCOffset(vm)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the RTC offset failed.")
+		response.WriteError(http.StatusInternalServerError, err)
+		return
+	}
+	response.WriteHeaderAndJson(http.StatusOK, map[string]int64{"offset": offset}, restful.MIME_JSON)
+}
@@ -0,0 +1,83 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/emicklei/go-restful"
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap"
+)
+
+var _ = Describe("Clock", func() {
+	var ctrl *gomock.Controller
+	var mockManager *virtwrap.MockDomainManager
+	var server *httptest.Server
+	var serverUrl *url.URL
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockManager = virtwrap.NewMockDomainManager(ctrl)
+		resource := NewClockResource(mockManager)
+		ws := new(restful.WebService)
+		ws.Route(ws.GET("/api/v1/namespaces/{namespace}/virtualmachines/{name}/rtcoffset").To(resource.RTCOffset))
+		server = httptest.NewServer(restful.NewContainer().Add(ws))
+		var err error
+		serverUrl, err = url.Parse(server.URL)
+		Expect(err).ToNot(HaveOccurred())
+		serverUrl.Path = "/api/v1/namespaces/default/virtualmachines/testvm/rtcoffset"
+	})
+
+	It("should return the RTC offset of the guest", func() {
+		mockManager.EXPECT().GetRTCOffset(v1.NewVMReferenceFromNameWithNS("default", "testvm")).Return(int64(-7200), nil)
+
+		r, err := http.DefaultClient.Get(serverUrl.String())
+		Expect(err).ToNot(HaveOccurred())
+		defer r.Body.Close()
+		Expect(r.StatusCode).To(Equal(http.StatusOK))
+
+		offset := map[string]int64{}
+		Expect(json.NewDecoder(r.Body).Decode(&offset)).To(Succeed())
+		Expect(offset["offset"]).To(Equal(int64(-7200)))
+	})
+
+	It("should report failures", func() {
+		mockManager.EXPECT().GetRTCOffset(v1.NewVMReferenceFromNameWithNS("default", "testvm")).Return(int64(0), fmt.Errorf("domain not found"))
+
+		r, err := http.DefaultClient.Get(serverUrl.String())
+		Expect(err).ToNot(HaveOccurred())
+		defer r.Body.Close()
+		Expect(r.StatusCode).To(Equal(http.StatusInternalServerError))
+	})
+
+	AfterEach(func() {
+		server.Close()
+		ctrl.Finish()
+	})
+})
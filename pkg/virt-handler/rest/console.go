@@ -20,19 +20,25 @@
 package rest
 
 import (
+	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"sync"
 
 	"github.com/emicklei/go-restful"
 	"github.com/gorilla/websocket"
-	"github.com/libvirt/libvirt-go"
+	"golang.org/x/net/context"
 	"k8s.io/apimachinery/pkg/types"
 
 	"kubevirt.io/kubevirt/pkg/api/v1"
 	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
 	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cache"
 	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
 	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/errors"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
 )
 
 var upgrader = websocket.Upgrader{
@@ -42,14 +48,85 @@ var upgrader = websocket.Upgrader{
 
 type Console struct {
 	connection cli.Connection
+	lock       sync.Mutex
+	// open console sessions per domain and console device
+	sessions map[string]int
 }
 
 func NewConsoleResource(connection cli.Connection) *Console {
-	return &Console{connection: connection}
+	return &Console{connection: connection, sessions: map[string]int{}}
 }
 
+// acquire registers a session on a console device. Unless force is set, it
+// fails if the device already has a session.
+func (t *Console) acquire(key string, force bool) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if !force && t.sessions[key] > 0 {
+		return false
+	}
+	t.sessions[key]++
+	return true
+}
+
+func (t *Console) release(key string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.sessions[key]--
+	if t.sessions[key] <= 0 {
+		delete(t.sessions, key)
+	}
+}
+
+func domainDevices(domain cli.VirDomain) (*api.DomainDevices, error) {
+	xmlstr, err := domain.GetXMLDesc(0)
+	if err != nil {
+		return nil, err
+	}
+	return api.NewDomainDevices(xmlstr)
+}
+
+// ListConsoles returns the console devices of a running VM, which can be
+// selected by name when connecting to a console.
+func (t *Console) ListConsoles(request *restful.Request, response *restful.Response) {
+	vmName := request.PathParameter("name")
+	namespace := request.PathParameter("namespace")
+	vm := v1.NewVMReferenceFromNameWithNS(namespace, vmName)
+	log := logging.DefaultLogger().Object(vm)
+	domain, err := t.connection.LookupDomainByName(cache.VMNamespaceKeyFunc(vm))
+	if err != nil {
+		if errors.IsNotFound(err) {
+			response.WriteError(http.StatusNotFound, err)
+		} else {
+			log.Error().Reason(err).Msg("Failed to look up domain.")
+			response.WriteError(http.StatusInternalServerError, err)
+		}
+		return
+	}
+	defer domain.Free()
+
+	devices, err := domainDevices(domain)
+	if err != nil {
+		log.Error().Reason(err).Msg("Failed to get the devices of the domain.")
+		response.WriteError(http.StatusInternalServerError, err)
+		return
+	}
+	response.WriteHeaderAndJson(http.StatusOK, virtwrap.ConsoleDevices(devices), restful.MIME_JSON)
+}
+
+// Console proxies a websocket connection to a console device. Without a
+// console name, the first console of the domain is used. Unless force is
+// set to false, an existing session on the device is taken over.
 func (t *Console) Console(request *restful.Request, response *restful.Response) {
 	console := request.QueryParameter("console")
+	force := true
+	if value := request.QueryParameter("force"); value != "" {
+		var err error
+		if force, err = strconv.ParseBool(value); err != nil {
+			response.WriteError(http.StatusBadRequest, fmt.Errorf("invalid force parameter: %v", err))
+			return
+		}
+	}
 	vmName := request.PathParameter("name")
 	namespace := request.PathParameter("namespace")
 	vm := v1.NewVMReferenceFromNameWithNS(namespace, vmName)
@@ -77,9 +154,38 @@ func (t *Console) Console(request *restful.Request, response *restful.Response)
 	vm.GetObjectMeta().SetUID(types.UID(uid))
 	log = logging.DefaultLogger().Object(vm)
 
+	// Resolve the device first, so that sessions on the default console and
+	// on the same device by name share a key.
+	devices, err := domainDevices(domain)
+	if err != nil {
+		response.WriteError(http.StatusInternalServerError, err)
+		log.Error().Reason(err).Msg("Failed to get the devices of the domain.")
+		return
+	}
+	var device *virtwrap.ConsoleDevice
+	var found bool
+	if console == "" {
+		if device, found = virtwrap.DefaultConsoleDevice(devices); !found {
+			response.WriteError(http.StatusNotFound, fmt.Errorf("the VM has no console"))
+			return
+		}
+	} else if device, found = virtwrap.FindConsoleDevice(devices, console); !found {
+		response.WriteError(http.StatusNotFound, fmt.Errorf("console %s not found", console))
+		return
+	}
+	console = device.Name
+
+	sessionKey := cache.VMNamespaceKeyFunc(vm) + "/" + console
+	if !t.acquire(sessionKey, force) {
+		response.WriteError(http.StatusConflict, fmt.Errorf("console %s is busy", console))
+		return
+	}
+	defer t.release(sessionKey)
+
 	log.Info().Msgf("Opening connection to console %s", console)
 
-	consoleStream, err := t.connection.NewStream(0)
+	// Many consoles can be open at once, don't block a thread in libvirt for each
+	consoleStream, err := t.connection.NewStream(libvirt.STREAM_NONBLOCK)
 	if err != nil {
 		log.Error().Reason(err).Msg("Creating a consoleStream failed.")
 		response.WriteError(http.StatusInternalServerError, err)
@@ -89,7 +195,19 @@ func (t *Console) Console(request *restful.Request, response *restful.Response)
 
 	log.Info().V(3).Msg("Stream created.")
 
-	err = domain.OpenConsole(console, consoleStream.UnderlyingStream(), libvirt.DOMAIN_CONSOLE_FORCE)
+	if device.Kind == virtwrap.PortKindChannel {
+		var flags libvirt.DomainChannelFlags
+		if force {
+			flags = libvirt.DOMAIN_CHANNEL_FORCE
+		}
+		err = domain.OpenChannel(console, consoleStream.UnderlyingStream(), flags)
+	} else {
+		var flags libvirt.DomainConsoleFlags
+		if force {
+			flags = libvirt.DOMAIN_CONSOLE_FORCE
+		}
+		err = domain.OpenConsole(console, consoleStream.UnderlyingStream(), flags)
+	}
 	if err != nil {
 		response.WriteError(http.StatusInternalServerError, err)
 		log.Error().Reason(err).Msg("Failed to open console.")
@@ -97,8 +215,6 @@ func (t *Console) Console(request *restful.Request, response *restful.Response)
 	}
 	log.Info().V(3).Msg("Connection to console created.")
 
-	errorChan := make(chan error)
-
 	ws, err := upgrader.Upgrade(response.ResponseWriter, request.Request, nil)
 	if err != nil {
 		log.Error().Reason(err).Msg("Failed to upgrade websocket connection.")
@@ -109,18 +225,7 @@ func (t *Console) Console(request *restful.Request, response *restful.Response)
 
 	wsReadWriter := &TextReadWriter{ws}
 
-	go func() {
-		_, err := io.Copy(consoleStream, wsReadWriter)
-		errorChan <- err
-	}()
-
-	go func() {
-		_, err := io.Copy(wsReadWriter, consoleStream)
-		errorChan <- err
-	}()
-
-	err = <-errorChan
-
+	err = consoleStream.ServeEvents(context.Background(), wsReadWriter, cli.CopyOptions{Operation: "console"})
 	if err != nil {
 		log.Error().Reason(err).Msg("Proxying data between libvirt and the websocket failed.")
 	}
@@ -21,22 +21,25 @@ package rest
 
 import (
 	"bytes"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
 
 	"github.com/emicklei/go-restful"
 	"github.com/golang/mock/gomock"
 	"github.com/gorilla/websocket"
-	"github.com/libvirt/libvirt-go"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"golang.org/x/net/context"
 	k8sv1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/uuid"
 	"k8s.io/client-go/tools/record"
 
 	"kubevirt.io/kubevirt/pkg/logging"
 	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
 )
 
 var _ = Describe("Console", func() {
@@ -50,6 +53,7 @@ var _ = Describe("Console", func() {
 	var server *httptest.Server
 	var wsUrl *url.URL
 	var serverDone chan bool
+	var resource *Console
 
 	logging.DefaultLogger().SetIOWriter(GinkgoWriter)
 
@@ -68,6 +72,25 @@ var _ = Describe("Console", func() {
 		return http.DefaultClient.Get(wsUrl.String())
 	}
 
+	getConsole := func(vm string, query string) (*http.Response, error) {
+		wsUrl.Scheme = "http"
+		wsUrl.Path = "/api/v1/namespaces/" + k8sv1.NamespaceDefault + "/virtualmachines/" + vm + "/console"
+		wsUrl.RawQuery = query
+		return http.DefaultClient.Get(wsUrl.String())
+	}
+
+	domainXML := `<domain>
+  <devices>
+    <serial type="pty"><target port="0"/><alias name="serial0"/></serial>
+    <console type="pty"><target type="serial" port="0"/><alias name="serial0"/></console>
+    <channel type="unix">
+      <source mode="bind" path="/tmp/agent.sock"/>
+      <target type="virtio" name="org.qemu.guest_agent.0"/>
+      <alias name="channel0"/>
+    </channel>
+  </devices>
+</domain>`
+
 	BeforeEach(func() {
 		var err error
 		// Set up mocks
@@ -84,8 +107,9 @@ var _ = Describe("Console", func() {
 		// Give us a chance to detect when the request is done. Otherwise we
 		// don't know when to check mock invokations
 		serverDone = make(chan bool)
+		resource = NewConsoleResource(mockConn)
 		waiter := func(request *restful.Request, response *restful.Response) {
-			NewConsoleResource(mockConn).Console(request, response)
+			resource.Console(request, response)
 			close(serverDone)
 		}
 		ws.Route(ws.GET("/api/v1/namespaces/{namespace}/virtualmachines/{name}/console").To(waiter))
@@ -124,7 +148,8 @@ var _ = Describe("Console", func() {
 		It("should return 500 if creating a stream fails", func() {
 			mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
 			mockDomain.EXPECT().GetUUIDString().Return(string(uuid.NewUUID()), nil)
-			mockConn.EXPECT().NewStream(libvirt.StreamFlags(0)).Return(nil, libvirt.Error{Code: libvirt.ERR_INVALID_CONN})
+			mockDomain.EXPECT().GetXMLDesc(libvirt.DomainXMLFlags(0)).Return(domainXML, nil)
+			mockConn.EXPECT().NewStream(libvirt.STREAM_NONBLOCK).Return(nil, libvirt.Error{Code: libvirt.ERR_INVALID_CONN})
 			r, err := get("testvm")
 			Expect(err).ToNot(HaveOccurred())
 			Expect(r.StatusCode).To(Equal(http.StatusInternalServerError))
@@ -132,11 +157,12 @@ var _ = Describe("Console", func() {
 		It("should return 500 if opening a console connection fails", func() {
 			mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
 			mockDomain.EXPECT().GetUUIDString().Return(string(uuid.NewUUID()), nil)
-			mockConn.EXPECT().NewStream(libvirt.StreamFlags(0)).Return(mockStream, nil)
+			mockDomain.EXPECT().GetXMLDesc(libvirt.DomainXMLFlags(0)).Return(domainXML, nil)
+			mockConn.EXPECT().NewStream(libvirt.STREAM_NONBLOCK).Return(mockStream, nil)
 			stream := &libvirt.Stream{}
 			mockStream.EXPECT().UnderlyingStream().Return(stream)
 			mockStream.EXPECT().Close()
-			mockDomain.EXPECT().OpenConsole("", stream, libvirt.DomainConsoleFlags(libvirt.DOMAIN_CONSOLE_FORCE)).Return(libvirt.Error{Code: libvirt.ERR_INVALID_CONN})
+			mockDomain.EXPECT().OpenConsole("serial0", stream, libvirt.DomainConsoleFlags(libvirt.DOMAIN_CONSOLE_FORCE)).Return(libvirt.Error{Code: libvirt.ERR_INVALID_CONN})
 			r, err := get("testvm")
 			Expect(err).ToNot(HaveOccurred())
 			Expect(r.StatusCode).To(Equal(http.StatusInternalServerError))
@@ -144,11 +170,12 @@ var _ = Describe("Console", func() {
 		It("should return 400 if ws upgrade does not work", func() {
 			mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
 			mockDomain.EXPECT().GetUUIDString().Return(string(uuid.NewUUID()), nil)
-			mockConn.EXPECT().NewStream(libvirt.StreamFlags(0)).Return(mockStream, nil)
+			mockDomain.EXPECT().GetXMLDesc(libvirt.DomainXMLFlags(0)).Return(domainXML, nil)
+			mockConn.EXPECT().NewStream(libvirt.STREAM_NONBLOCK).Return(mockStream, nil)
 			stream := &libvirt.Stream{}
 			mockStream.EXPECT().UnderlyingStream().Return(stream)
 			mockStream.EXPECT().Close()
-			mockDomain.EXPECT().OpenConsole("", stream, libvirt.DomainConsoleFlags(libvirt.DOMAIN_CONSOLE_FORCE)).Return(nil)
+			mockDomain.EXPECT().OpenConsole("serial0", stream, libvirt.DomainConsoleFlags(libvirt.DOMAIN_CONSOLE_FORCE)).Return(nil)
 			r, err := get("testvm")
 			Expect(err).ToNot(HaveOccurred())
 			Expect(r.StatusCode).To(Equal(http.StatusBadRequest))
@@ -164,10 +191,11 @@ var _ = Describe("Console", func() {
 
 			mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
 			mockDomain.EXPECT().GetUUIDString().Return(string(uuid.NewUUID()), nil)
-			mockConn.EXPECT().NewStream(libvirt.StreamFlags(0)).Return(stream, nil)
-			mockDomain.EXPECT().OpenConsole("console0", stream.s, libvirt.DomainConsoleFlags(libvirt.DOMAIN_CONSOLE_FORCE)).Return(nil)
+			mockDomain.EXPECT().GetXMLDesc(libvirt.DomainXMLFlags(0)).Return(domainXML, nil)
+			mockConn.EXPECT().NewStream(libvirt.STREAM_NONBLOCK).Return(stream, nil)
+			mockDomain.EXPECT().OpenConsole("serial0", stream.s, libvirt.DomainConsoleFlags(libvirt.DOMAIN_CONSOLE_FORCE)).Return(nil)
 
-			con := dial("testvm", "console0")
+			con := dial("testvm", "serial0")
 			defer con.Close()
 			err := con.WriteMessage(websocket.TextMessage, []byte("hello console!"))
 			Expect(err).ToNot(HaveOccurred())
@@ -180,6 +208,47 @@ var _ = Describe("Console", func() {
 			Expect(err).ToNot(HaveOccurred())
 			Expect(body).To(Equal([]byte("hello client!")))
 		})
+		It("should return 404 if the console does not exist", func() {
+			mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+			mockDomain.EXPECT().GetUUIDString().Return(string(uuid.NewUUID()), nil)
+			mockDomain.EXPECT().GetXMLDesc(libvirt.DomainXMLFlags(0)).Return(domainXML, nil)
+			r, err := getConsole("testvm", "console=serial1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(r.StatusCode).To(Equal(http.StatusNotFound))
+		})
+		It("should return 409 if the console is busy", func() {
+			Expect(resource.acquire("default_testvm/serial0", true)).To(BeTrue())
+			mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+			mockDomain.EXPECT().GetUUIDString().Return(string(uuid.NewUUID()), nil)
+			mockDomain.EXPECT().GetXMLDesc(libvirt.DomainXMLFlags(0)).Return(domainXML, nil)
+			r, err := getConsole("testvm", "console=serial0&force=false")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(r.StatusCode).To(Equal(http.StatusConflict))
+		})
+		It("should return 409 if the default console is busy", func() {
+			Expect(resource.acquire("default_testvm/serial0", true)).To(BeTrue())
+			mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+			mockDomain.EXPECT().GetUUIDString().Return(string(uuid.NewUUID()), nil)
+			mockDomain.EXPECT().GetXMLDesc(libvirt.DomainXMLFlags(0)).Return(domainXML, nil)
+			r, err := getConsole("testvm", "force=false")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(r.StatusCode).To(Equal(http.StatusConflict))
+		})
+		It("should open the guest agent channel", func() {
+			mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+			mockDomain.EXPECT().GetUUIDString().Return(string(uuid.NewUUID()), nil)
+			mockDomain.EXPECT().GetXMLDesc(libvirt.DomainXMLFlags(0)).Return(domainXML, nil)
+			mockConn.EXPECT().NewStream(libvirt.STREAM_NONBLOCK).Return(mockStream, nil)
+			stream := &libvirt.Stream{}
+			mockStream.EXPECT().UnderlyingStream().Return(stream)
+			mockStream.EXPECT().Close()
+			mockDomain.EXPECT().OpenChannel("channel0", stream, libvirt.DomainChannelFlags(0)).Return(libvirt.Error{Code: libvirt.ERR_OPERATION_FAILED})
+			r, err := getConsole("testvm", "console=guestagent-channel&force=false")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(r.StatusCode).To(Equal(http.StatusInternalServerError))
+			Eventually(serverDone).Should(BeClosed())
+			Expect(resource.sessions).To(BeEmpty())
+		})
 
 	})
 	AfterEach(func() {
@@ -203,10 +272,51 @@ func (s *fakeStream) Read(p []byte) (n int, err error) {
 	return s.out.Read(p)
 }
 
+func (s *fakeStream) CopyToStream(ctx context.Context, reader io.Reader, opts cli.CopyOptions) (int64, error) {
+	return io.Copy(s, reader)
+}
+
+func (s *fakeStream) CopyFromStream(ctx context.Context, writer io.Writer, opts cli.CopyOptions) (int64, error) {
+	return io.Copy(writer, s)
+}
+
+func (s *fakeStream) CopyToStreamSparse(ctx context.Context, file *os.File, opts cli.CopyOptions) (int64, error) {
+	return s.CopyToStream(ctx, file, opts)
+}
+
+func (s *fakeStream) CopyFromStreamSparse(ctx context.Context, file *os.File, opts cli.CopyOptions) (int64, error) {
+	return s.CopyFromStream(ctx, file, opts)
+}
+
+func (s *fakeStream) ServeEvents(ctx context.Context, peer io.ReadWriter, opts cli.CopyOptions) error {
+	errorChan := make(chan error, 2)
+	go func() {
+		_, err := s.CopyToStream(ctx, peer, opts)
+		errorChan <- err
+	}()
+	go func() {
+		_, err := s.CopyFromStream(ctx, peer, opts)
+		errorChan <- err
+	}()
+	return <-errorChan
+}
+
 func (s *fakeStream) Close() (e error) {
 	return nil
 }
 
+func (s *fakeStream) Finish() error {
+	return nil
+}
+
+func (s *fakeStream) Abort() error {
+	return nil
+}
+
+func (s *fakeStream) Free() error {
+	return nil
+}
+
 func (s *fakeStream) UnderlyingStream() *libvirt.Stream {
 	return s.s
 }
@@ -0,0 +1,108 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package rest
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/emicklei/go-restful"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap"
+)
+
+type HypervisorLog struct {
+	openLog func(vm *v1.VirtualMachine, follow bool) (io.ReadCloser, error)
+}
+
+func NewHypervisorLogResource() *HypervisorLog {
+	return &HypervisorLog{openLog: virtwrap.HypervisorLog}
+}
+
+// HypervisorLog streams the qemu log of the VM, which tells why qemu failed
+// to start or crashed. With follow=true new output is streamed until the
+// client disconnects.
+func (h *HypervisorLog) HypervisorLog(request *restful.Request, response *restful.Response) {
+	follow := false
+	if f := request.QueryParameter("follow"); f != "" {
+		var err error
+		follow, err = strconv.ParseBool(f)
+		if err != nil {
+			response.WriteError(http.StatusBadRequest, fmt.Errorf("invalid follow %s: %v", f, err))
+			return
+		}
+	}
+	vmName := request.PathParameter("name")
+	namespace := request.PathParameter("namespace")
+	vm := v1.NewVMReferenceFromNameWithNS(namespace, vmName)
+	log := logging.DefaultLogger().Object(vm)
+
+	hypervisorLog, err := h.openLog(vm, follow)
+	if err != nil {
+		if os.IsNotExist(err) {
+			log.Error().Reason(err).Msg("Hypervisor log not found.")
+			response.WriteError(http.StatusNotFound, err)
+		} else {
+			log.Error().Reason(err).Msg("Failed to open the hypervisor log.")
+			response.WriteError(http.StatusInternalServerError, err)
+		}
+		return
+	}
+	defer hypervisorLog.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	if notifier, ok := response.ResponseWriter.(http.CloseNotifier); ok {
+		closed := notifier.CloseNotify()
+		go func() {
+			select {
+			case <-closed:
+				hypervisorLog.Close()
+			case <-done:
+			}
+		}()
+	}
+
+	response.AddHeader("Content-Type", "text/plain")
+	response.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(&flushWriter{response.ResponseWriter}, hypervisorLog); err != nil {
+		log.Error().Reason(err).Msg("Streaming the hypervisor log failed.")
+		return
+	}
+	log.Info().V(3).Msg("Hypervisor log sent.")
+}
+
+// flushWriter sends everything written to the client right away, so that
+// followed logs show up as they are written.
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (f *flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if flusher, ok := f.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return n, err
+}
@@ -0,0 +1,109 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package rest
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/emicklei/go-restful"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+)
+
+var _ = Describe("HypervisorLog", func() {
+	var server *httptest.Server
+	var serverUrl *url.URL
+	var openLog func(vm *v1.VirtualMachine, follow bool) (io.ReadCloser, error)
+
+	BeforeEach(func() {
+		resource := &HypervisorLog{openLog: func(vm *v1.VirtualMachine, follow bool) (io.ReadCloser, error) {
+			return openLog(vm, follow)
+		}}
+		ws := new(restful.WebService)
+		ws.Route(ws.GET("/api/v1/namespaces/{namespace}/virtualmachines/{name}/hypervisorlog").To(resource.HypervisorLog))
+		server = httptest.NewServer(restful.NewContainer().Add(ws))
+		var err error
+		serverUrl, err = url.Parse(server.URL)
+		Expect(err).ToNot(HaveOccurred())
+		serverUrl.Path = "/api/v1/namespaces/default/virtualmachines/testvm/hypervisorlog"
+	})
+
+	It("should stream the log of the VM", func() {
+		openLog = func(vm *v1.VirtualMachine, follow bool) (io.ReadCloser, error) {
+			Expect(vm.ObjectMeta.Namespace).To(Equal("default"))
+			Expect(vm.ObjectMeta.Name).To(Equal("testvm"))
+			Expect(follow).To(BeTrue())
+			return ioutil.NopCloser(strings.NewReader("qemu-system-x86_64: terminating on signal 15\n")), nil
+		}
+
+		serverUrl.RawQuery = "follow=true"
+		r, err := http.DefaultClient.Get(serverUrl.String())
+		Expect(err).ToNot(HaveOccurred())
+		defer r.Body.Close()
+		Expect(r.StatusCode).To(Equal(http.StatusOK))
+		Expect(r.Header.Get("Content-Type")).To(Equal("text/plain"))
+		content, err := ioutil.ReadAll(r.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(content)).To(Equal("qemu-system-x86_64: terminating on signal 15\n"))
+	})
+
+	It("should report VMs without a log", func() {
+		openLog = func(vm *v1.VirtualMachine, follow bool) (io.ReadCloser, error) {
+			return nil, os.ErrNotExist
+		}
+
+		r, err := http.DefaultClient.Get(serverUrl.String())
+		Expect(err).ToNot(HaveOccurred())
+		defer r.Body.Close()
+		Expect(r.StatusCode).To(Equal(http.StatusNotFound))
+	})
+
+	It("should report logs which can't be opened", func() {
+		openLog = func(vm *v1.VirtualMachine, follow bool) (io.ReadCloser, error) {
+			return nil, fmt.Errorf("permission denied")
+		}
+
+		r, err := http.DefaultClient.Get(serverUrl.String())
+		Expect(err).ToNot(HaveOccurred())
+		defer r.Body.Close()
+		Expect(r.StatusCode).To(Equal(http.StatusInternalServerError))
+	})
+
+	It("should refuse an invalid follow parameter", func() {
+		serverUrl.RawQuery = "follow=maybe"
+		r, err := http.DefaultClient.Get(serverUrl.String())
+		Expect(err).ToNot(HaveOccurred())
+		defer r.Body.Close()
+		Expect(r.StatusCode).To(Equal(http.StatusBadRequest))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+})
@@ -0,0 +1,43 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package rest
+
+import (
+	"net/http"
+
+	"github.com/emicklei/go-restful"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap"
+)
+
+type Jobs struct {
+	domainManager virtwrap.DomainManager
+}
+
+func NewJobsResource(domainManager virtwrap.DomainManager) *Jobs {
+	return &Jobs{domainManager: domainManager}
+}
+
+// ListJobs returns the background jobs of the VM, like memory dumps, with
+// their progress.
+func (j *Jobs) ListJobs(request *restful.Request, response *restful.Response) {
+	vm := v1.NewVMReferenceFromNameWithNS(request.PathParameter("namespace"), request.PathParameter("name"))
+	response.WriteHeaderAndJson(http.StatusOK, j.domainManager.ListJobs(vm), restful.MIME_JSON)
+}
@@ -0,0 +1,73 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/emicklei/go-restful"
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap"
+)
+
+var _ = Describe("LaunchSecurity", func() {
+	var ctrl *gomock.Controller
+	var mockManager *virtwrap.MockDomainManager
+	var server *httptest.Server
+	var serverUrl *url.URL
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockManager = virtwrap.NewMockDomainManager(ctrl)
+		resource := NewLaunchSecurityResource(mockManager)
+		ws := new(restful.WebService)
+		ws.Route(ws.GET("/api/v1/namespaces/{namespace}/virtualmachines/{name}/launchmeasurement").To(resource.LaunchMeasurement))
+		server = httptest.NewServer(restful.NewContainer().Add(ws))
+		var err error
+		serverUrl, err = url.Parse(server.URL)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should return the launch measurement of the VM", func() {
+		mockManager.EXPECT().GetLaunchMeasurement(v1.NewVMReferenceFromNameWithNS("default", "testvm")).Return("bWVhc3VyZW1lbnQ=", nil)
+
+		serverUrl.Path = "/api/v1/namespaces/default/virtualmachines/testvm/launchmeasurement"
+		r, err := http.DefaultClient.Get(serverUrl.String())
+		Expect(err).ToNot(HaveOccurred())
+		defer r.Body.Close()
+		Expect(r.StatusCode).To(Equal(http.StatusOK))
+
+		measurement := map[string]string{}
+		Expect(json.NewDecoder(r.Body).Decode(&measurement)).To(Succeed())
+		Expect(measurement["measurement"]).To(Equal("bWVhc3VyZW1lbnQ="))
+	})
+
+	AfterEach(func() {
+		server.Close()
+		ctrl.Finish()
+	})
+})
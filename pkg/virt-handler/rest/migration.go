@@ -20,20 +20,34 @@
 package rest
 
 import (
+	"net"
 	"net/http"
 
 	"github.com/emicklei/go-restful"
 
 	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
 	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/isolation"
 )
 
+// migrationFeatures maps the migration features the migration controller
+// asks for to the hypervisor features they depend on.
+var migrationFeatures = []struct {
+	migration v1.MigrationFeature
+	feature   cli.Feature
+}{
+	{v1.MigrationFeatureTLS, cli.FeatureTLSMigration},
+	{v1.MigrationFeatureParallelConnections, cli.FeatureParallelMigration},
+	{v1.MigrationFeatureListenAddress, cli.FeatureMigrationListenAddress},
+}
+
 type MigrationHostInfo struct {
 	isolationDetector isolation.PodIsolationDetector
+	connection        cli.Connection
 }
 
-func NewMigrationHostInfo(isolationDetector isolation.PodIsolationDetector) *MigrationHostInfo {
-	return &MigrationHostInfo{isolationDetector}
+func NewMigrationHostInfo(isolationDetector isolation.PodIsolationDetector, connection cli.Connection) *MigrationHostInfo {
+	return &MigrationHostInfo{isolationDetector, connection}
 }
 
 func (t *MigrationHostInfo) MigrationHostInfo(request *restful.Request, response *restful.Response) {
@@ -45,11 +59,57 @@ func (t *MigrationHostInfo) MigrationHostInfo(request *restful.Request, response
 		response.WriteErrorString(http.StatusNotFound, err.Error())
 		return
 	}
+	addresses, err := hostAddresses()
+	if err != nil {
+		response.WriteErrorString(http.StatusInternalServerError, err.Error())
+		return
+	}
+	features, err := hostMigrationFeatures(t.connection)
+	if err != nil {
+		response.WriteErrorString(http.StatusInternalServerError, err.Error())
+		return
+	}
 	body := &v1.MigrationHostInfo{
 		PidNS:      result.PidNS(),
 		Controller: result.Controller(),
 		Slice:      result.Slice(),
+		Addresses:  addresses,
+		Features:   features,
 	}
 	response.WriteHeader(http.StatusOK)
 	response.WriteAsJson(body)
 }
+
+// hostMigrationFeatures lists the migration features which libvirt and qemu
+// on the host are recent enough for.
+func hostMigrationFeatures(connection cli.Connection) ([]v1.MigrationFeature, error) {
+	version, err := cli.GetHypervisorVersion(connection)
+	if err != nil {
+		return nil, err
+	}
+	features := []v1.MigrationFeature{}
+	for _, f := range migrationFeatures {
+		if version.SupportsFeature(f.feature) {
+			features = append(features, f.migration)
+		}
+	}
+	return features, nil
+}
+
+// hostAddresses lists the addresses of the host, so that migrations can pick
+// the one in their migration network. virt-handler runs in the host network.
+func hostAddresses() ([]string, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	addresses := []string{}
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLoopback() {
+			continue
+		}
+		addresses = append(addresses, ipNet.IP.String())
+	}
+	return addresses, nil
+}
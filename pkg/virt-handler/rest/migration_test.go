@@ -0,0 +1,66 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package rest
+
+import (
+	"fmt"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+)
+
+var _ = Describe("Migration host info", func() {
+	var ctrl *gomock.Controller
+	var mockConn *cli.MockConnection
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockConn = cli.NewMockConnection(ctrl)
+	})
+
+	table.DescribeTable("should report the migration features of the host",
+		func(libvirtVersion uint32, qemuVersion uint32, features []v1.MigrationFeature) {
+			mockConn.EXPECT().GetLibVersion().Return(libvirtVersion, nil)
+			mockConn.EXPECT().GetVersion().Return(qemuVersion, nil)
+
+			Expect(hostMigrationFeatures(mockConn)).To(Equal(features))
+		},
+		table.Entry("with libvirt 3.2", uint32(3002000), uint32(2009000), []v1.MigrationFeature{v1.MigrationFeatureTLS}),
+		table.Entry("with libvirt 4.4", uint32(4004000), uint32(2012000), []v1.MigrationFeature{v1.MigrationFeatureTLS, v1.MigrationFeatureListenAddress}),
+		table.Entry("with libvirt 5.2", uint32(5002000), uint32(4000000), []v1.MigrationFeature{v1.MigrationFeatureTLS, v1.MigrationFeatureParallelConnections, v1.MigrationFeatureListenAddress}),
+		table.Entry("with libvirt 3.0", uint32(3000000), uint32(2008000), []v1.MigrationFeature{}),
+	)
+
+	It("should fail if the versions can't be queried", func() {
+		mockConn.EXPECT().GetLibVersion().Return(uint32(0), fmt.Errorf("connection lost"))
+
+		_, err := hostMigrationFeatures(mockConn)
+		Expect(err).To(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+})
@@ -0,0 +1,98 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/emicklei/go-restful"
+	"golang.org/x/net/context"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cache"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/errors"
+)
+
+type Screenshot struct {
+	connection cli.Connection
+}
+
+func NewScreenshotResource(connection cli.Connection) *Screenshot {
+	return &Screenshot{connection: connection}
+}
+
+// Screenshot streams the current content of a display of the VM. The image
+// format is chosen by the hypervisor and reported as the content type of the
+// response, QEMU for instance returns a PPM image.
+func (t *Screenshot) Screenshot(request *restful.Request, response *restful.Response) {
+	var screen uint64
+	if s := request.QueryParameter("screen"); s != "" {
+		var err error
+		screen, err = strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			response.WriteError(http.StatusBadRequest, fmt.Errorf("invalid screen %s: %v", s, err))
+			return
+		}
+	}
+	vmName := request.PathParameter("name")
+	namespace := request.PathParameter("namespace")
+	vm := v1.NewVMReferenceFromNameWithNS(namespace, vmName)
+	log := logging.DefaultLogger().Object(vm)
+	domain, err := t.connection.LookupDomainByName(cache.VMNamespaceKeyFunc(vm))
+	if err != nil {
+		if errors.IsNotFound(err) {
+			log.Error().Reason(err).Msg("Domain not found.")
+			response.WriteError(http.StatusNotFound, err)
+			return
+		} else {
+			response.WriteError(http.StatusInternalServerError, err)
+			log.Error().Reason(err).Msg("Failed to look up domain.")
+			return
+		}
+	}
+	defer domain.Free()
+
+	screenshotStream, err := t.connection.NewStream(0)
+	if err != nil {
+		log.Error().Reason(err).Msg("Creating a screenshotStream failed.")
+		response.WriteError(http.StatusInternalServerError, err)
+		return
+	}
+	defer screenshotStream.Close()
+
+	mimeType, err := domain.Screenshot(screenshotStream.UnderlyingStream(), uint32(screen), 0)
+	if err != nil {
+		response.WriteError(http.StatusInternalServerError, err)
+		log.Error().Reason(err).Msgf("Failed to take a screenshot of screen %d.", screen)
+		return
+	}
+
+	response.AddHeader("Content-Type", mimeType)
+	response.WriteHeader(http.StatusOK)
+	if _, err := screenshotStream.CopyFromStream(context.Background(), response, cli.CopyOptions{Operation: "screenshot"}); err != nil {
+		log.Error().Reason(err).Msg("Streaming the screenshot failed.")
+		return
+	}
+	log.Info().V(3).Msgf("Screenshot of screen %d sent.", screen)
+}
@@ -0,0 +1,129 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package rest
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/emicklei/go-restful"
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/net/context"
+	k8sv1 "k8s.io/api/core/v1"
+
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Screenshot", func() {
+	var mockConn *cli.MockConnection
+	var mockDomain *cli.MockVirDomain
+	var mockStream *cli.MockStream
+	var ctrl *gomock.Controller
+	var server *httptest.Server
+	var serverUrl *url.URL
+	var serverDone chan bool
+
+	logging.DefaultLogger().SetIOWriter(GinkgoWriter)
+
+	get := func(vm string, query string) (*http.Response, error) {
+		serverUrl.Path = "/api/v1/namespaces/" + k8sv1.NamespaceDefault + "/virtualmachines/" + vm + "/screenshot"
+		serverUrl.RawQuery = query
+		return http.DefaultClient.Get(serverUrl.String())
+	}
+
+	BeforeEach(func() {
+		var err error
+		ctrl = gomock.NewController(GinkgoT())
+		mockConn = cli.NewMockConnection(ctrl)
+		mockDomain = cli.NewMockVirDomain(ctrl)
+		mockStream = cli.NewMockStream(ctrl)
+
+		ws := new(restful.WebService)
+		serverDone = make(chan bool)
+		waiter := func(request *restful.Request, response *restful.Response) {
+			NewScreenshotResource(mockConn).Screenshot(request, response)
+			close(serverDone)
+		}
+		ws.Route(ws.GET("/api/v1/namespaces/{namespace}/virtualmachines/{name}/screenshot").To(waiter))
+		server = httptest.NewServer(restful.NewContainer().Add(ws))
+		serverUrl, err = url.Parse(server.URL)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should return 404 if VM does not exist", func() {
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(nil, libvirt.Error{Code: libvirt.ERR_NO_DOMAIN})
+		r, err := get("testvm", "")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(r.StatusCode).To(Equal(http.StatusNotFound))
+	})
+
+	It("should return 400 if the screen is invalid", func() {
+		r, err := get("testvm", "screen=first")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(r.StatusCode).To(Equal(http.StatusBadRequest))
+	})
+
+	Context("with existing domain", func() {
+		var stream *libvirt.Stream
+
+		BeforeEach(func() {
+			stream = &libvirt.Stream{}
+			mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+			mockConn.EXPECT().NewStream(libvirt.StreamFlags(0)).Return(mockStream, nil)
+			mockStream.EXPECT().UnderlyingStream().Return(stream)
+			mockStream.EXPECT().Close()
+			mockDomain.EXPECT().Free()
+		})
+
+		It("should return 500 if the screenshot can't be taken", func() {
+			mockDomain.EXPECT().Screenshot(stream, uint32(0), uint32(0)).Return("", libvirt.Error{Code: libvirt.ERR_OPERATION_INVALID})
+			r, err := get("testvm", "")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(r.StatusCode).To(Equal(http.StatusInternalServerError))
+		})
+
+		It("should stream the screenshot of the requested screen", func() {
+			mockDomain.EXPECT().Screenshot(stream, uint32(1), uint32(0)).Return("image/x-portable-pixmap", nil)
+			mockStream.EXPECT().CopyFromStream(gomock.Any(), gomock.Any(), cli.CopyOptions{Operation: "screenshot"}).Do(func(ctx context.Context, writer io.Writer, opts cli.CopyOptions) {
+				writer.Write([]byte("P6"))
+			}).Return(int64(2), nil)
+			r, err := get("testvm", "screen=1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(r.StatusCode).To(Equal(http.StatusOK))
+			Expect(r.Header.Get("Content-Type")).To(Equal("image/x-portable-pixmap"))
+			body, err := ioutil.ReadAll(r.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(body)).To(Equal("P6"))
+		})
+	})
+
+	AfterEach(func() {
+		server.Close()
+		<-serverDone
+		ctrl.Finish()
+	})
+})
@@ -0,0 +1,95 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package rest
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/emicklei/go-restful"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap"
+)
+
+// SerialPort proxies websocket connections to the sockets of serial or
+// parallel ports of type unix.
+type SerialPort struct {
+	kind string
+}
+
+func NewSerialPortResource(kind string) *SerialPort {
+	return &SerialPort{kind: kind}
+}
+
+func (s *SerialPort) SerialPort(request *restful.Request, response *restful.Response) {
+	vmName := request.PathParameter("name")
+	namespace := request.PathParameter("namespace")
+	vm := v1.NewVMReferenceFromNameWithNS(namespace, vmName)
+	log := logging.DefaultLogger().Object(vm)
+
+	port, err := strconv.ParseUint(request.PathParameter("port"), 10, 32)
+	if err != nil {
+		response.WriteError(http.StatusBadRequest, fmt.Errorf("invalid %s port: %v", s.kind, err))
+		return
+	}
+
+	conn, err := virtwrap.OpenSerialPort(vm, s.kind, uint(port))
+	if err != nil {
+		log.Error().Reason(err).Msgf("Failed to open %s port %d.", s.kind, port)
+		response.WriteError(http.StatusNotFound, err)
+		return
+	}
+	defer conn.Close()
+	log.Info().V(3).Msgf("Connection to %s port %d created.", s.kind, port)
+
+	ws, err := upgrader.Upgrade(response.ResponseWriter, request.Request, nil)
+	if err != nil {
+		log.Error().Reason(err).Msg("Failed to upgrade websocket connection.")
+		response.WriteError(http.StatusBadRequest, err)
+		return
+	}
+	defer ws.Close()
+
+	wsReadWriter := &TextReadWriter{ws}
+	errorChan := make(chan error)
+
+	go func() {
+		_, err := io.Copy(conn, wsReadWriter)
+		errorChan <- err
+	}()
+
+	go func() {
+		_, err := io.Copy(wsReadWriter, conn)
+		errorChan <- err
+	}()
+
+	err = <-errorChan
+
+	if err != nil {
+		log.Error().Reason(err).Msgf("Proxying data between the %s port and the websocket failed.", s.kind)
+	}
+
+	log.Info().V(3).Msg("Done.")
+	response.WriteHeader(http.StatusOK)
+}
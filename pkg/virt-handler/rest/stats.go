@@ -0,0 +1,70 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package rest
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/emicklei/go-restful"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cache"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/stats"
+)
+
+type Stats struct {
+	collector *stats.Collector
+}
+
+func NewStatsResource(collector *stats.Collector) *Stats {
+	return &Stats{collector: collector}
+}
+
+// writeStats collects stats of a running VM with collect and sends them.
+func (s *Stats) writeStats(request *restful.Request, response *restful.Response, kind string, collect func(name string) (interface{}, bool, error)) {
+	vm := v1.NewVMReferenceFromNameWithNS(request.PathParameter("namespace"), request.PathParameter("name"))
+	result, exists, err := collect(cache.VMNamespaceKeyFunc(vm))
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msgf("Failed to collect the %s stats.", kind)
+		response.WriteError(http.StatusInternalServerError, err)
+		return
+	}
+	if !exists {
+		response.WriteError(http.StatusNotFound, fmt.Errorf("VM is not running"))
+		return
+	}
+	response.WriteHeaderAndJson(http.StatusOK, result, restful.MIME_JSON)
+}
+
+// InterfaceStats returns the counters of all interfaces of a running VM.
+func (s *Stats) InterfaceStats(request *restful.Request, response *restful.Response) {
+	s.writeStats(request, response, "interface", func(name string) (interface{}, bool, error) {
+		return s.collector.InterfaceStats(name)
+	})
+}
+
+// DiskStats returns the I/O counters and latencies of all disks of a running
+// VM.
+func (s *Stats) DiskStats(request *restful.Request, response *restful.Response) {
+	s.writeStats(request, response, "disk", func(name string) (interface{}, bool, error) {
+		return s.collector.DiskStats(name)
+	})
+}
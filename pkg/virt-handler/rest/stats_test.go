@@ -0,0 +1,101 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/emicklei/go-restful"
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/stats"
+)
+
+var _ = Describe("Stats", func() {
+	var ctrl *gomock.Controller
+	var mockConn *cli.MockConnection
+	var server *httptest.Server
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockConn = cli.NewMockConnection(ctrl)
+		ws := new(restful.WebService)
+		collector := stats.NewCollector(mockConn, stats.DefaultCollectorTTL)
+		resource := NewStatsResource(collector)
+		ws.Route(ws.GET("/api/v1/namespaces/{namespace}/virtualmachines/{name}/interfacestats").To(resource.InterfaceStats))
+		ws.Route(ws.GET("/api/v1/namespaces/{namespace}/virtualmachines/{name}/diskstats").To(resource.DiskStats))
+		server = httptest.NewServer(restful.NewContainer().Add(ws))
+
+		mockConn.EXPECT().GetAllDomainStats(gomock.Any(), libvirt.CONNECT_GET_ALL_DOMAINS_STATS_ACTIVE).Return([]*cli.DomainStats{
+			{Name: "default_testvm", DomainStats: &libvirt.DomainStats{
+				Net: []libvirt.DomainStatsNet{
+					{Name: "vnet0", RxBytes: 3000, RxErrs: 1, TxDrop: 4},
+				},
+				Block: []libvirt.DomainStatsBlock{
+					{Name: "vda", RdReqs: 10, RdTimes: 5000},
+				},
+			}},
+		}, nil)
+	})
+
+	It("should return the stats of all interfaces", func() {
+		r, err := http.Get(server.URL + "/api/v1/namespaces/default/virtualmachines/testvm/interfacestats")
+		Expect(err).ToNot(HaveOccurred())
+		defer r.Body.Close()
+		Expect(r.StatusCode).To(Equal(http.StatusOK))
+
+		interfaces := []stats.InterfaceStats{}
+		Expect(json.NewDecoder(r.Body).Decode(&interfaces)).To(Succeed())
+		Expect(interfaces).To(HaveLen(1))
+		Expect(interfaces[0].Name).To(Equal("vnet0"))
+		Expect(interfaces[0].RxErrors).To(Equal(uint64(1)))
+		Expect(interfaces[0].TxDrops).To(Equal(uint64(4)))
+	})
+
+	It("should return the stats of all disks", func() {
+		r, err := http.Get(server.URL + "/api/v1/namespaces/default/virtualmachines/testvm/diskstats")
+		Expect(err).ToNot(HaveOccurred())
+		defer r.Body.Close()
+		Expect(r.StatusCode).To(Equal(http.StatusOK))
+
+		disks := []stats.DiskStats{}
+		Expect(json.NewDecoder(r.Body).Decode(&disks)).To(Succeed())
+		Expect(disks).To(HaveLen(1))
+		Expect(disks[0].Name).To(Equal("vda"))
+		Expect(disks[0].ReadLatency).To(Equal(uint64(500)))
+	})
+
+	It("should return 404 if the VM is not running", func() {
+		r, err := http.Get(server.URL + "/api/v1/namespaces/default/virtualmachines/othervm/interfacestats")
+		Expect(err).ToNot(HaveOccurred())
+		r.Body.Close()
+		Expect(r.StatusCode).To(Equal(http.StatusNotFound))
+	})
+
+	AfterEach(func() {
+		server.Close()
+		ctrl.Finish()
+	})
+})
@@ -0,0 +1,421 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package virtwrap
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cache"
+)
+
+// Disks without a target name and PCI devices without an address get them
+// assigned in the order of the VM spec. The assignments are stored on the VM
+// object in the v1.DeviceAddressesAnnotation and are reused whenever the
+// domain is defined again, also after it was undefined, so that adding or
+// removing a device does not move the others around inside the guest.
+
+var diskTargetPrefixes = map[string]string{
+	"virtio": "vd",
+	"scsi":   "sd",
+	"sata":   "sd",
+	"usb":    "sd",
+	"ide":    "hd",
+	"fdc":    "fd",
+}
+
+// Slot 0 is the host bridge, 1 the ISA bridge and 2 the video card of
+// i440fx machines.
+const (
+	firstAllocatableSlot = 0x03
+	lastAllocatableSlot  = 0x1f
+)
+
+// On q35 machines every device gets a PCIe root port of its own, the index
+// of the root port is the bus of the device. Bus 0 is the root complex.
+const (
+	firstAllocatableBus = 0x01
+	lastAllocatableBus  = 0xfe
+)
+
+// diskTargetName returns the name libvirt would give the disk at the index,
+// e.g. vda, vdz, vdaa.
+func diskTargetName(prefix string, index int) string {
+	name := ""
+	for index >= 0 {
+		name = string('a'+byte(index%26)) + name
+		index = index/26 - 1
+	}
+	return prefix + name
+}
+
+func pciSlotAddress(slot uint64) *api.Address {
+	return &api.Address{Type: "pci", Domain: "0x0000", Bus: "0x00", Slot: fmt.Sprintf("0x%02x", slot), Function: "0x0"}
+}
+
+func pcieRootPortAddress(bus uint64) *api.Address {
+	return &api.Address{Type: "pci", Domain: "0x0000", Bus: fmt.Sprintf("0x%02x", bus), Slot: "0x00", Function: "0x0"}
+}
+
+// pciBus returns the bus of an address behind a bridge or a root port.
+func pciBus(address *api.Address) (uint64, bool) {
+	if address == nil || address.Type != "pci" {
+		return 0, false
+	}
+	if domain, err := strconv.ParseUint(address.Domain, 0, 32); err != nil || domain != 0 {
+		return 0, false
+	}
+	bus, err := strconv.ParseUint(address.Bus, 0, 32)
+	if err != nil || bus == 0 {
+		return 0, false
+	}
+	return bus, true
+}
+
+// pciSlot returns the slot of an address on the root bus.
+func pciSlot(address *api.Address) (uint64, bool) {
+	if address == nil || address.Type != "pci" {
+		return 0, false
+	}
+	for _, s := range []string{address.Domain, address.Bus} {
+		if v, err := strconv.ParseUint(s, 0, 32); err != nil || v != 0 {
+			return 0, false
+		}
+	}
+	slot, err := strconv.ParseUint(address.Slot, 0, 32)
+	if err != nil {
+		return 0, false
+	}
+	return slot, true
+}
+
+// allocatesPCIAddresses tells whether the machine has a flat PCI root bus
+// into which devices can be plugged directly. On PCIe machines like q35,
+// devices are plugged into root ports which libvirt manages.
+func allocatesPCIAddresses(spec *api.DomainSpec) bool {
+	arch := spec.OS.Type.Arch
+	if arch == "" {
+		arch = hostArch
+	}
+	return arch == "x86_64" && !strings.Contains(spec.OS.Type.Machine, "q35")
+}
+
+// allocatesRootPorts tells whether devices are plugged into PCIe root ports,
+// which KubeVirt adds itself so that the devices keep their bus.
+func allocatesRootPorts(spec *api.DomainSpec) bool {
+	arch := spec.OS.Type.Arch
+	if arch == "" {
+		arch = hostArch
+	}
+	return arch == "x86_64" && strings.Contains(spec.OS.Type.Machine, "q35")
+}
+
+func diskAllocationKey(disk *api.Disk, index int) string {
+	switch {
+	case disk.Serial != "":
+		return "disk/serial/" + disk.Serial
+	case disk.Source.File != "":
+		return "disk/file/" + disk.Source.File
+	case disk.Source.Name != "":
+		return "disk/" + disk.Source.Protocol + "/" + disk.Source.Name
+	}
+	return fmt.Sprintf("disk/%d", index)
+}
+
+// Interfaces are identified by their MAC, which is stable once assigned.
+func interfaceAllocationKey(iface *api.Interface, index int) string {
+	if iface.MAC != nil && iface.MAC.MAC != "" {
+		return "interface/" + strings.ToLower(iface.MAC.MAC)
+	}
+	return fmt.Sprintf("interface/%d", index)
+}
+
+// deviceAllocator hands out target names and slots on the root bus, or buses
+// of root ports, preferring the ones the devices had before.
+type deviceAllocator struct {
+	previous    map[string]api.DeviceAllocation
+	rootPorts   bool
+	usedTargets map[string]bool
+	usedSlots   map[uint64]bool
+	usedBuses   map[uint64]bool
+	allocations []api.DeviceAllocation
+}
+
+// reserve keeps the explicit address of a device from being handed out.
+func (a *deviceAllocator) reserve(address *api.Address) {
+	if slot, ok := pciSlot(address); ok {
+		a.usedSlots[slot] = true
+	}
+	if bus, ok := pciBus(address); ok {
+		a.usedBuses[bus] = true
+	}
+}
+
+func (a *deviceAllocator) previousTarget(key string) (string, bool) {
+	target := a.previous[key].Target
+	if target == "" || a.usedTargets[target] {
+		return "", false
+	}
+	a.usedTargets[target] = true
+	return target, true
+}
+
+func (a *deviceAllocator) newTarget(prefix string) string {
+	for i := 0; ; i++ {
+		if target := diskTargetName(prefix, i); !a.usedTargets[target] {
+			a.usedTargets[target] = true
+			return target
+		}
+	}
+}
+
+func (a *deviceAllocator) previousAddress(key string) (*api.Address, bool) {
+	if a.rootPorts {
+		bus, ok := pciBus(a.previous[key].Address)
+		if !ok || a.usedBuses[bus] {
+			return nil, false
+		}
+		a.usedBuses[bus] = true
+		return pcieRootPortAddress(bus), true
+	}
+	slot, ok := pciSlot(a.previous[key].Address)
+	if !ok || a.usedSlots[slot] {
+		return nil, false
+	}
+	a.usedSlots[slot] = true
+	return pciSlotAddress(slot), true
+}
+
+func (a *deviceAllocator) newAddress() (*api.Address, error) {
+	if a.rootPorts {
+		for bus := uint64(firstAllocatableBus); bus <= lastAllocatableBus; bus++ {
+			if !a.usedBuses[bus] {
+				a.usedBuses[bus] = true
+				return pcieRootPortAddress(bus), nil
+			}
+		}
+		return nil, fmt.Errorf("no free PCIe root port left")
+	}
+	for slot := uint64(firstAllocatableSlot); slot <= lastAllocatableSlot; slot++ {
+		if !a.usedSlots[slot] {
+			a.usedSlots[slot] = true
+			return pciSlotAddress(slot), nil
+		}
+	}
+	return nil, fmt.Errorf("no free PCI slot left")
+}
+
+// pendingDevice is a device which still needs a target name or an address.
+type pendingDevice struct {
+	key          string
+	targetPrefix string
+	target       *string
+	address      **api.Address
+}
+
+// prepareDeviceAddresses assigns target names to disks and PCI addresses to
+// virtio disks and interfaces which have none, and returns the allocations
+// which have to be stored on the VM. Devices get the allocations they had in
+// the previous definition of the domain back. The explicit addresses of all
+// devices and the indexes of the PCI controllers are never handed out.
+func prepareDeviceAddresses(spec *api.DomainSpec, previous []api.DeviceAllocation) ([]api.DeviceAllocation, error) {
+	allocator := &deviceAllocator{
+		previous:    allocationsByKey(previous),
+		rootPorts:   allocatesRootPorts(spec),
+		usedTargets: map[string]bool{},
+		usedSlots:   map[uint64]bool{},
+		usedBuses:   map[uint64]bool{},
+	}
+	withAddresses := allocator.rootPorts || allocatesPCIAddresses(spec)
+
+	for _, controller := range spec.Devices.Controllers {
+		allocator.reserve(controller.Address)
+		if controller.Type != "pci" {
+			continue
+		}
+		if index, err := strconv.ParseUint(controller.Index, 10, 32); err == nil {
+			allocator.usedBuses[index] = true
+		}
+	}
+	for _, hostDev := range spec.Devices.HostDevices {
+		allocator.reserve(hostDev.Address)
+	}
+	for _, sound := range spec.Devices.Sounds {
+		allocator.reserve(sound.Address)
+	}
+	for _, input := range spec.Devices.Inputs {
+		allocator.reserve(input.Address)
+	}
+	for _, redirect := range spec.Devices.Redirects {
+		allocator.reserve(redirect.Address)
+	}
+
+	pending := []pendingDevice{}
+	for i := range spec.Devices.Disks {
+		disk := &spec.Devices.Disks[i]
+		device := pendingDevice{key: diskAllocationKey(disk, i)}
+		if disk.Target.Device == "" {
+			if disk.Target.Bus == "" {
+				disk.Target.Bus = "virtio"
+			}
+			prefix, exists := diskTargetPrefixes[disk.Target.Bus]
+			if !exists {
+				return nil, fmt.Errorf("can't name disks on bus %s", disk.Target.Bus)
+			}
+			device.targetPrefix = prefix
+			device.target = &disk.Target.Device
+		} else {
+			allocator.usedTargets[disk.Target.Device] = true
+		}
+		isVirtio := disk.Target.Bus == "virtio" || (disk.Target.Bus == "" && strings.HasPrefix(disk.Target.Device, "vd"))
+		if disk.Address != nil {
+			allocator.reserve(disk.Address)
+		} else if withAddresses && isVirtio {
+			device.address = &disk.Address
+		}
+		pending = append(pending, device)
+	}
+	for i := range spec.Devices.Interfaces {
+		iface := &spec.Devices.Interfaces[i]
+		device := pendingDevice{key: interfaceAllocationKey(iface, i)}
+		// Root ports only take PCIe devices, like virtio ones
+		isVirtio := iface.Model != nil && iface.Model.Type == "virtio"
+		if iface.Address != nil {
+			allocator.reserve(iface.Address)
+		} else if withAddresses && (isVirtio || !allocator.rootPorts) {
+			device.address = &iface.Address
+		}
+		pending = append(pending, device)
+	}
+
+	// Devices get their previous names and slots back first, so that new
+	// devices earlier in the spec can't take them away.
+	for _, device := range pending {
+		if device.target != nil {
+			if target, ok := allocator.previousTarget(device.key); ok {
+				*device.target = target
+			}
+		}
+		if device.address != nil {
+			if address, ok := allocator.previousAddress(device.key); ok {
+				*device.address = address
+			}
+		}
+	}
+	for _, device := range pending {
+		if device.target != nil && *device.target == "" {
+			*device.target = allocator.newTarget(device.targetPrefix)
+		}
+		if device.address != nil && *device.address == nil {
+			address, err := allocator.newAddress()
+			if err != nil {
+				return nil, err
+			}
+			*device.address = address
+		}
+		if device.address != nil && allocator.rootPorts {
+			bus, _ := pciBus(*device.address)
+			spec.Devices.Controllers = append(spec.Devices.Controllers, api.Controller{
+				Type:  "pci",
+				Index: strconv.FormatUint(bus, 10),
+				Model: "pcie-root-port",
+			})
+		}
+		if device.target == nil && device.address == nil {
+			continue
+		}
+		allocation := api.DeviceAllocation{Key: device.key}
+		if device.target != nil {
+			allocation.Target = *device.target
+		}
+		if device.address != nil {
+			allocation.Address = *device.address
+		}
+		allocator.allocations = append(allocator.allocations, allocation)
+	}
+	return allocator.allocations, nil
+}
+
+// allocationsByKey indexes device allocations by the key of their device.
+func allocationsByKey(allocations []api.DeviceAllocation) map[string]api.DeviceAllocation {
+	byKey := map[string]api.DeviceAllocation{}
+	for _, allocation := range allocations {
+		byKey[allocation.Key] = allocation
+	}
+	return byKey
+}
+
+// allocatedDevices returns the device allocations of the annotation of the
+// VM, or nil if the VM has none yet.
+func allocatedDevices(vm *v1.VirtualMachine) ([]api.DeviceAllocation, error) {
+	annotation, exists := vm.ObjectMeta.Annotations[v1.DeviceAddressesAnnotation]
+	if !exists {
+		return nil, nil
+	}
+	allocations := []api.DeviceAllocation{}
+	if err := json.Unmarshal([]byte(annotation), &allocations); err != nil {
+		return nil, fmt.Errorf("invalid device addresses annotation: %v", err)
+	}
+	return allocations, nil
+}
+
+// StoreDeviceAllocations stores the device allocations in the annotation of
+// the VM and tells whether they changed.
+func StoreDeviceAllocations(vm *v1.VirtualMachine, allocations []api.DeviceAllocation) (bool, error) {
+	if allocations == nil {
+		allocations = []api.DeviceAllocation{}
+	}
+	current, err := allocatedDevices(vm)
+	if err == nil && current != nil && reflect.DeepEqual(current, allocations) {
+		return false, nil
+	}
+	annotation, err := json.Marshal(allocations)
+	if err != nil {
+		return false, err
+	}
+	if vm.ObjectMeta.Annotations == nil {
+		vm.ObjectMeta.Annotations = make(map[string]string)
+	}
+	vm.ObjectMeta.Annotations[v1.DeviceAddressesAnnotation] = string(annotation)
+	return true, nil
+}
+
+// GetDeviceAllocations returns the device allocations the domain of the VM
+// was defined with, so that they can be stored on the VM.
+func (l *LibvirtDomainManager) GetDeviceAllocations(vm *v1.VirtualMachine) ([]api.DeviceAllocation, error) {
+	dom, err := l.virConn.LookupDomainByName(cache.VMNamespaceKeyFunc(vm))
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain failed.")
+		return nil, err
+	}
+	defer dom.Free()
+
+	metadata, err := GetMetadata(dom)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Reading the domain metadata failed.")
+		return nil, err
+	}
+	return metadata.Devices, nil
+}
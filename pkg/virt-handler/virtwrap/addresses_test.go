@@ -0,0 +1,197 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package virtwrap
+
+import (
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+)
+
+var _ = Describe("Device addresses", func() {
+	var originalHostArch string
+	var spec *api.DomainSpec
+
+	fileDisk := func(file string, bus string) api.Disk {
+		return api.Disk{
+			Type:   "file",
+			Device: "disk",
+			Source: api.DiskSource{File: file},
+			Target: api.DiskTarget{Bus: bus},
+		}
+	}
+
+	BeforeEach(func() {
+		originalHostArch = hostArch
+		hostArch = "x86_64"
+
+		spec = api.NewMinimalDomainSpec("testvm")
+		spec.Devices.Interfaces[0].MAC = &api.MAC{MAC: "02:00:00:00:00:01"}
+	})
+
+	table.DescribeTable("should name disks like libvirt", func(index int, name string) {
+		Expect(diskTargetName("vd", index)).To(Equal(name))
+	},
+		table.Entry("first", 0, "vda"),
+		table.Entry("last single letter", 25, "vdz"),
+		table.Entry("first two letters", 26, "vdaa"),
+		table.Entry("last two letters", 701, "vdzz"),
+	)
+
+	It("should assign names and slots in spec order", func() {
+		spec.Devices.Disks = []api.Disk{
+			fileDisk("/disks/root.img", "virtio"),
+			fileDisk("/disks/cdrom.iso", "sata"),
+			fileDisk("/disks/data.img", ""),
+		}
+
+		allocations, err := prepareDeviceAddresses(spec, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(spec.Devices.Disks[0].Target.Device).To(Equal("vda"))
+		Expect(spec.Devices.Disks[0].Address).To(Equal(pciSlotAddress(0x03)))
+		Expect(spec.Devices.Disks[1].Target.Device).To(Equal("sda"))
+		Expect(spec.Devices.Disks[1].Address).To(BeNil())
+		Expect(spec.Devices.Disks[2].Target).To(Equal(api.DiskTarget{Bus: "virtio", Device: "vdb"}))
+		Expect(spec.Devices.Disks[2].Address).To(Equal(pciSlotAddress(0x04)))
+		Expect(spec.Devices.Interfaces[0].Address).To(Equal(pciSlotAddress(0x05)))
+		Expect(allocations).To(ContainElement(api.DeviceAllocation{Key: "interface/02:00:00:00:00:01", Address: pciSlotAddress(0x05)}))
+		Expect(allocations).To(HaveLen(4))
+	})
+
+	It("should give devices their previous names and slots back", func() {
+		previous := []api.DeviceAllocation{
+			{Key: "disk/file/data.img", Target: "vdb", Address: pciSlotAddress(0x04)},
+			{Key: "disk/file//disks/data.img", Target: "vda", Address: pciSlotAddress(0x03)},
+			{Key: "interface/02:00:00:00:00:01", Address: pciSlotAddress(0x04)},
+		}
+
+		// The new disk comes first, but must not take the name of the old one
+		spec.Devices.Disks = []api.Disk{
+			fileDisk("/disks/new.img", "virtio"),
+			fileDisk("/disks/data.img", "virtio"),
+		}
+
+		_, err := prepareDeviceAddresses(spec, previous)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(spec.Devices.Disks[0].Target.Device).To(Equal("vdb"))
+		Expect(spec.Devices.Disks[0].Address).To(Equal(pciSlotAddress(0x05)))
+		Expect(spec.Devices.Disks[1].Target.Device).To(Equal("vda"))
+		Expect(spec.Devices.Disks[1].Address).To(Equal(pciSlotAddress(0x03)))
+		Expect(spec.Devices.Interfaces[0].Address).To(Equal(pciSlotAddress(0x04)))
+	})
+
+	It("should keep explicit names and addresses", func() {
+		disk := fileDisk("/disks/root.img", "virtio")
+		disk.Target.Device = "vda"
+		disk.Address = pciSlotAddress(0x03)
+		spec.Devices.Disks = []api.Disk{disk, fileDisk("/disks/data.img", "virtio")}
+
+		allocations, err := prepareDeviceAddresses(spec, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(spec.Devices.Disks[0].Address).To(Equal(pciSlotAddress(0x03)))
+		Expect(spec.Devices.Disks[1].Target.Device).To(Equal("vdb"))
+		Expect(spec.Devices.Disks[1].Address).To(Equal(pciSlotAddress(0x04)))
+		Expect(allocations).To(HaveLen(2))
+	})
+
+	It("should plug virtio devices of PCIe machines into root ports of their own", func() {
+		spec.OS.Type.Machine = "pc-q35-2.10"
+		spec.Devices.Disks = []api.Disk{fileDisk("/disks/root.img", "virtio")}
+		spec.Devices.Interfaces = append(spec.Devices.Interfaces, api.Interface{
+			Type:  "network",
+			MAC:   &api.MAC{MAC: "02:00:00:00:00:02"},
+			Model: &api.Model{Type: "virtio"},
+		})
+
+		allocations, err := prepareDeviceAddresses(spec, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(spec.Devices.Disks[0].Target.Device).To(Equal("vda"))
+		Expect(spec.Devices.Disks[0].Address).To(Equal(pcieRootPortAddress(0x01)))
+		Expect(spec.Devices.Interfaces[0].Address).To(BeNil())
+		Expect(spec.Devices.Interfaces[1].Address).To(Equal(pcieRootPortAddress(0x02)))
+		Expect(spec.Devices.Controllers).To(Equal([]api.Controller{
+			{Type: "pci", Index: "1", Model: "pcie-root-port"},
+			{Type: "pci", Index: "2", Model: "pcie-root-port"},
+		}))
+		Expect(allocations).To(ContainElement(api.DeviceAllocation{Key: "interface/02:00:00:00:00:02", Address: pcieRootPortAddress(0x02)}))
+	})
+
+	It("should give devices of PCIe machines their previous root ports back", func() {
+		spec.OS.Type.Machine = "pc-q35-2.10"
+		spec.Devices.Disks = []api.Disk{fileDisk("/disks/new.img", "virtio"), fileDisk("/disks/data.img", "virtio")}
+		previous := []api.DeviceAllocation{
+			{Key: "disk/file//disks/data.img", Target: "vda", Address: pcieRootPortAddress(0x01)},
+		}
+
+		_, err := prepareDeviceAddresses(spec, previous)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(spec.Devices.Disks[0].Address).To(Equal(pcieRootPortAddress(0x02)))
+		Expect(spec.Devices.Disks[1].Address).To(Equal(pcieRootPortAddress(0x01)))
+	})
+
+	It("should not hand out explicit addresses of other devices", func() {
+		spec.Devices.Controllers = []api.Controller{{Type: "usb", Model: "qemu-xhci", Address: pciSlotAddress(0x03)}}
+		spec.Devices.HostDevices = []api.HostDevice{{Type: "pci", Address: pciSlotAddress(0x04)}}
+		spec.Devices.Sounds = []api.Sound{{Model: "ich6", Address: pciSlotAddress(0x05)}}
+		spec.Devices.Disks = []api.Disk{fileDisk("/disks/root.img", "virtio")}
+
+		_, err := prepareDeviceAddresses(spec, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(spec.Devices.Disks[0].Address).To(Equal(pciSlotAddress(0x06)))
+		Expect(spec.Devices.Interfaces[0].Address).To(Equal(pciSlotAddress(0x07)))
+	})
+
+	It("should not hand out the indexes of PCI controllers as root ports", func() {
+		spec.OS.Type.Machine = "pc-q35-2.10"
+		spec.Devices.Controllers = []api.Controller{{Type: "pci", Index: "1", Model: "pcie-root-port"}}
+		spec.Devices.Disks = []api.Disk{fileDisk("/disks/root.img", "virtio")}
+
+		_, err := prepareDeviceAddresses(spec, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(spec.Devices.Disks[0].Address).To(Equal(pcieRootPortAddress(0x02)))
+	})
+
+	It("should store the allocations on the VM", func() {
+		vm := newVM("default", "testvm")
+		allocations := []api.DeviceAllocation{{Key: "disk/file//disks/root.img", Target: "vda", Address: pciSlotAddress(0x03)}}
+
+		changed, err := StoreDeviceAllocations(vm, allocations)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(changed).To(BeTrue())
+		Expect(allocatedDevices(vm)).To(Equal(allocations))
+
+		changed, err = StoreDeviceAllocations(vm, allocations)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(changed).To(BeFalse())
+	})
+
+	It("should fail when the root bus is full", func() {
+		for i := 0; i < 30; i++ {
+			spec.Devices.Disks = append(spec.Devices.Disks, api.Disk{Serial: diskTargetName("", i), Target: api.DiskTarget{Bus: "virtio"}})
+		}
+		_, err := prepareDeviceAddresses(spec, nil)
+		Expect(err).To(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		hostArch = originalHostArch
+	})
+})
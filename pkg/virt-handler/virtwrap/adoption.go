@@ -0,0 +1,160 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"path/filepath"
+
+	k8sv1 "k8s.io/api/core/v1"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cache"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+// Domains which were not defined by KubeVirt are treated like domains of
+// deleted VMs and are removed. Domains whose name matches the adoption
+// pattern and which carry no KubeVirt metadata are kept and only watched
+// instead, so that existing libvirt VMs can be moved onto the cluster step by
+// step. KubeVirt never changes adopted domains. Older KubeVirt versions did
+// not record metadata either, so foreign domains have to be named explicitly.
+var adoptDomainPattern = ""
+
+// SetAdoptDomainPattern sets the shell pattern, e.g. "legacy-*", which the
+// names of the domains to adopt match. An empty pattern disables adoption.
+func SetAdoptDomainPattern(pattern string) error {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return err
+	}
+	adoptDomainPattern = pattern
+	return nil
+}
+
+func matchesAdoptDomainPattern(domName string) bool {
+	if adoptDomainPattern == "" {
+		return false
+	}
+	matched, _ := filepath.Match(adoptDomainPattern, domName)
+	return matched
+}
+
+// isForeignDomain returns whether the domain is one to adopt.
+func isForeignDomain(domName string, metadata *api.KubeVirtMetadata) bool {
+	return metadata.UID == "" && matchesAdoptDomainPattern(domName)
+}
+
+// adoptDomain records that the domain, which is known under the given name
+// to libvirt, is not managed by us.
+func (l *LibvirtDomainManager) adoptDomain(vm *v1.VirtualMachine, domName string) {
+	l.cacheLock.Lock()
+	defer l.cacheLock.Unlock()
+
+	if _, exists := l.adoptedDomains[cache.VMNamespaceKeyFunc(vm)]; !exists {
+		logging.DefaultLogger().Object(vm).Info().Msgf("Adopted foreign domain %s.", domName)
+	}
+	l.adoptedDomains[cache.VMNamespaceKeyFunc(vm)] = domName
+}
+
+// forgetAdoptedDomain drops the adoption of the domain with the given libvirt
+// name, once the domain is gone.
+func (l *LibvirtDomainManager) forgetAdoptedDomain(domName string) {
+	l.cacheLock.Lock()
+	defer l.cacheLock.Unlock()
+
+	for key, adopted := range l.adoptedDomains {
+		if adopted == domName {
+			delete(l.adoptedDomains, key)
+			logging.DefaultLogger().Info().Msgf("Adopted foreign domain %s is gone.", domName)
+		}
+	}
+}
+
+// forgetUndefinedAdoptedDomain drops the adoption of undefined domains.
+func (l *LibvirtDomainManager) forgetUndefinedAdoptedDomain(d *libvirt.Domain, event *libvirt.DomainEventLifecycle) {
+	if event.Event != libvirt.DOMAIN_EVENT_UNDEFINED {
+		return
+	}
+	name, err := d.GetName()
+	if err != nil {
+		l.forgetAdoptedDomains()
+		return
+	}
+	l.forgetAdoptedDomain(name)
+}
+
+// forgetAdoptedDomains drops all adoptions, they are looked up again when
+// they are needed.
+func (l *LibvirtDomainManager) forgetAdoptedDomains() {
+	l.cacheLock.Lock()
+	defer l.cacheLock.Unlock()
+
+	l.adoptedDomains = make(map[string]string)
+}
+
+// IsAdopted returns whether the domain of the VM was adopted, and thus must
+// not be changed. Foreign domains which were defined after the existing
+// guests were reconciled are adopted here.
+func (l *LibvirtDomainManager) IsAdopted(vm *v1.VirtualMachine) bool {
+	l.cacheLock.Lock()
+	_, adopted := l.adoptedDomains[cache.VMNamespaceKeyFunc(vm)]
+	l.cacheLock.Unlock()
+	if adopted {
+		return true
+	}
+
+	for _, domName := range foreignDomainNames(vm) {
+		if !matchesAdoptDomainPattern(domName) {
+			continue
+		}
+		dom, err := l.virConn.LookupDomainByName(domName)
+		if err != nil {
+			continue
+		}
+		foreign := l.checkForeignDomain(dom, domName)
+		dom.Free()
+		if foreign {
+			l.adoptDomain(vm, domName)
+			return true
+		}
+	}
+	return false
+}
+
+func (l *LibvirtDomainManager) checkForeignDomain(dom cli.VirDomain, domName string) bool {
+	metadata, err := GetMetadata(dom)
+	if err != nil {
+		logging.DefaultLogger().Error().Reason(err).Msgf("Reading the metadata of domain %s failed.", domName)
+		return false
+	}
+	return isForeignDomain(domName, metadata)
+}
+
+// foreignDomainNames returns the libvirt names a foreign domain of the VM
+// can have. Names without a namespace belong to the default namespace.
+func foreignDomainNames(vm *v1.VirtualMachine) []string {
+	names := []string{cache.VMNamespaceKeyFunc(vm)}
+	if vm.ObjectMeta.Namespace == k8sv1.NamespaceDefault {
+		names = append(names, vm.ObjectMeta.Name)
+	}
+	return names
+}
@@ -0,0 +1,145 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package virtwrap
+
+import (
+	"sync"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cache"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+const agentChannelConnected = "connected"
+
+func newGuestAgentChannel() api.Channel {
+	return api.Channel{
+		Type: "unix",
+		// libvirt picks the socket path of the channel
+		Source: api.ChannelSource{Mode: "bind"},
+		Target: &api.ChannelTarget{Type: "virtio", Name: guestAgentChannelName},
+	}
+}
+
+// prepareGuestAgentChannel adds the channel of the qemu guest agent to every
+// domain which does not have one yet.
+func prepareGuestAgentChannel(spec *api.DomainSpec) {
+	for _, channel := range spec.Devices.Channels {
+		if channel.Target != nil && channel.Target.Name == guestAgentChannelName {
+			return
+		}
+	}
+	spec.Devices.Channels = append(spec.Devices.Channels, newGuestAgentChannel())
+}
+
+// agentStates remembers which guest agents are connected, as reported by
+// agent lifecycle events. The zero value is ready to use.
+type agentStates struct {
+	lock      sync.Mutex
+	connected map[string]bool
+}
+
+func (a *agentStates) lookup(name string) (connected bool, known bool) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	connected, known = a.connected[name]
+	return
+}
+
+func (a *agentStates) set(name string, connected bool) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.connected == nil {
+		a.connected = make(map[string]bool)
+	}
+	a.connected[name] = connected
+}
+
+func (a *agentStates) forget(name string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	delete(a.connected, name)
+}
+
+func (a *agentStates) forgetAll() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.connected = nil
+}
+
+func (l *LibvirtDomainManager) recordAgentState(d *libvirt.Domain, event *libvirt.DomainEventAgentLifecycle) {
+	name, err := d.GetName()
+	if err != nil {
+		logging.DefaultLogger().Error().Reason(err).Msg("Getting the name of the domain with a guest agent event failed.")
+		return
+	}
+	connected := event.State == libvirt.CONNECT_DOMAIN_EVENT_AGENT_LIFECYCLE_STATE_CONNECTED
+	logging.DefaultLogger().Info().V(3).With("domain", name).Msgf("Guest agent connected: %t", connected)
+	l.agentStates.set(name, connected)
+}
+
+// forgetAgentState drops the agent state of stopped domains, their agent
+// is gone, but no agent event tells so.
+func (l *LibvirtDomainManager) forgetAgentState(d *libvirt.Domain, event *libvirt.DomainEventLifecycle) {
+	if event.Event != libvirt.DOMAIN_EVENT_STOPPED && event.Event != libvirt.DOMAIN_EVENT_UNDEFINED {
+		return
+	}
+	name, err := d.GetName()
+	if err != nil {
+		l.agentStates.forgetAll()
+		return
+	}
+	l.agentStates.forget(name)
+}
+
+// AgentConnected tells if the guest agent of the VM listens on its channel,
+// so that features which need the agent can be skipped while it does not.
+// Without an agent event since the start of the domain, the state of the
+// channel is read from the domain.
+func (l *LibvirtDomainManager) AgentConnected(vm *v1.VirtualMachine) (bool, error) {
+	name := cache.VMNamespaceKeyFunc(vm)
+	if connected, known := l.agentStates.lookup(name); known {
+		return connected, nil
+	}
+
+	dom, err := l.virConn.LookupDomainByName(name)
+	if err != nil {
+		return false, err
+	}
+	defer dom.Free()
+	xmlstr, err := dom.GetXMLDesc(0)
+	if err != nil {
+		return false, err
+	}
+	devices, err := api.NewDomainDevices(xmlstr)
+	if err != nil {
+		return false, err
+	}
+	connected := false
+	for _, channel := range devices.Channels {
+		if channel.Target != nil && channel.Target.Name == guestAgentChannelName {
+			connected = channel.Target.State == agentChannelConnected
+			break
+		}
+	}
+	l.agentStates.set(name, connected)
+	return connected, nil
+}
@@ -0,0 +1,114 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package virtwrap
+
+import (
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Guest agent", func() {
+
+	Context("channel", func() {
+		It("should be added to domains", func() {
+			spec := api.NewMinimalDomainSpec("testvm")
+			prepareGuestAgentChannel(spec)
+			Expect(spec.Devices.Channels).To(Equal([]api.Channel{newGuestAgentChannel()}))
+		})
+
+		It("should not be added twice", func() {
+			spec := api.NewMinimalDomainSpec("testvm")
+			spec.Devices.Channels = []api.Channel{{
+				Type:   "unix",
+				Source: api.ChannelSource{Mode: "bind", Path: "/var/run/agent.sock"},
+				Target: &api.ChannelTarget{Type: "virtio", Name: guestAgentChannelName},
+			}}
+			prepareGuestAgentChannel(spec)
+			Expect(spec.Devices.Channels).To(HaveLen(1))
+			Expect(spec.Devices.Channels[0].Source.Path).To(Equal("/var/run/agent.sock"))
+		})
+	})
+
+	Context("connection state", func() {
+		var ctrl *gomock.Controller
+		var mockConn *cli.MockConnection
+		var mockDomain *cli.MockVirDomain
+		var manager *LibvirtDomainManager
+
+		agentXML := func(state string) string {
+			return `<domain><devices>
+  <channel type="unix">
+    <source mode="bind" path="/var/lib/libvirt/qemu/channel/target/org.qemu.guest_agent.0"/>
+    <target type="virtio" name="org.qemu.guest_agent.0" state="` + state + `"/>
+  </channel>
+</devices></domain>`
+		}
+
+		BeforeEach(func() {
+			ctrl = gomock.NewController(GinkgoT())
+			mockConn = cli.NewMockConnection(ctrl)
+			mockDomain = cli.NewMockVirDomain(ctrl)
+			manager = &LibvirtDomainManager{virConn: mockConn}
+		})
+
+		It("should be read from the domain and remembered", func() {
+			mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+			mockDomain.EXPECT().GetXMLDesc(libvirt.DomainXMLFlags(0)).Return(agentXML("connected"), nil)
+			mockDomain.EXPECT().Free()
+
+			vm := newVM("default", "testvm")
+			for i := 0; i < 2; i++ {
+				connected, err := manager.AgentConnected(vm)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(connected).To(BeTrue())
+			}
+		})
+
+		It("should be disconnected if the agent does not listen", func() {
+			mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+			mockDomain.EXPECT().GetXMLDesc(libvirt.DomainXMLFlags(0)).Return(agentXML("disconnected"), nil)
+			mockDomain.EXPECT().Free()
+
+			connected, err := manager.AgentConnected(newVM("default", "testvm"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(connected).To(BeFalse())
+		})
+
+		It("should follow agent events", func() {
+			manager.agentStates.set("default_testvm", false)
+			connected, err := manager.AgentConnected(newVM("default", "testvm"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(connected).To(BeFalse())
+
+			manager.agentStates.set("default_testvm", true)
+			connected, err = manager.AgentConnected(newVM("default", "testvm"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(connected).To(BeTrue())
+		})
+
+		AfterEach(func() {
+			ctrl.Finish()
+		})
+	})
+})
@@ -0,0 +1,109 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package api
+
+import (
+	"encoding/xml"
+)
+
+// Capabilities represents the host capabilities as described in
+// https://libvirt.org/formatcaps.html. Only the fields we need are mapped.
+type Capabilities struct {
+	XMLName xml.Name `xml:"capabilities"`
+	Host    Host     `xml:"host"`
+	Guests  []Guest  `xml:"guest"`
+}
+
+type Host struct {
+	UUID     string        `xml:"uuid"`
+	CPU      HostCPU       `xml:"cpu"`
+	Topology *HostTopology `xml:"topology,omitempty"`
+}
+
+type HostCPU struct {
+	Arch  string      `xml:"arch"`
+	Model string      `xml:"model,omitempty"`
+	Pages []HostPages `xml:"pages"`
+}
+
+// HostPages describes a supported page size. Inside a NUMA cell it also
+// contains the number of pages of that size which are allocated on the cell.
+type HostPages struct {
+	Unit  string `xml:"unit,attr"`
+	Size  uint   `xml:"size,attr"`
+	Count uint64 `xml:",chardata"`
+}
+
+type HostTopology struct {
+	Cells []HostCell `xml:"cells>cell"`
+}
+
+type HostCell struct {
+	ID     uint          `xml:"id,attr"`
+	Memory Memory        `xml:"memory"`
+	Pages  []HostPages   `xml:"pages"`
+	CPUs   []HostCellCPU `xml:"cpus>cpu"`
+}
+
+type HostCellCPU struct {
+	ID       uint   `xml:"id,attr"`
+	SocketID uint   `xml:"socket_id,attr"`
+	CoreID   uint   `xml:"core_id,attr"`
+	Siblings string `xml:"siblings,attr"`
+}
+
+// Guest describes which machine types the host provides for guests of an
+// architecture.
+type Guest struct {
+	OSType string    `xml:"os_type"`
+	Arch   GuestArch `xml:"arch"`
+}
+
+type GuestArch struct {
+	Name     string         `xml:"name,attr"`
+	Machines []GuestMachine `xml:"machine"`
+}
+
+// GuestMachine is a machine type. Aliases like q35 name the versioned machine
+// type they stand for in Canonical.
+type GuestMachine struct {
+	Name      string `xml:",chardata"`
+	Canonical string `xml:"canonical,attr,omitempty"`
+}
+
+// DomainCapabilities represents what the hypervisor supports for guests, as
+// described in https://libvirt.org/formatdomaincaps.html. Only the fields we
+// need are mapped.
+type DomainCapabilities struct {
+	XMLName  xml.Name                   `xml:"domainCapabilities"`
+	Features DomainCapabilitiesFeatures `xml:"features"`
+}
+
+type DomainCapabilitiesFeatures struct {
+	SEV *SEVCapability `xml:"sev"`
+}
+
+// SEVCapability tells whether AMD SEV is available, and which memory
+// encryption parameters guests have to use.
+type SEVCapability struct {
+	Supported       string `xml:"supported,attr"`
+	CBitPos         uint   `xml:"cbitpos"`
+	ReducedPhysBits uint   `xml:"reducedPhysBits"`
+}
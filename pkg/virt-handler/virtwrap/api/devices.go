@@ -0,0 +1,57 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package api
+
+import (
+	"encoding/xml"
+)
+
+// DomainDevices holds the devices of a live domain. Unlike DomainSpec, it
+// also keeps devices which libvirt adds on its own, like controllers, so
+// that the actual devices can be compared to the wanted ones.
+type DomainDevices struct {
+	XMLName     xml.Name     `xml:"domain"`
+	Disks       []Disk       `xml:"devices>disk"`
+	Interfaces  []Interface  `xml:"devices>interface"`
+	Controllers []Controller `xml:"devices>controller"`
+	HostDevices []HostDevice `xml:"devices>hostdev"`
+	Serials     []Serial     `xml:"devices>serial"`
+	Parallels   []Parallel   `xml:"devices>parallel"`
+	Consoles    []Console    `xml:"devices>console"`
+	Channels    []Channel    `xml:"devices>channel"`
+}
+
+type Controller struct {
+	Type    string        `xml:"type,attr"`
+	Index   string        `xml:"index,attr,omitempty"`
+	Model   string        `xml:"model,attr,omitempty"`
+	Driver  *DeviceDriver `xml:"driver,omitempty"`
+	Address *Address      `xml:"address,omitempty"`
+	Alias   *Alias        `xml:"alias,omitempty"`
+}
+
+// NewDomainDevices parses the devices out of a domain XML
+func NewDomainDevices(domainXML string) (*DomainDevices, error) {
+	var devices DomainDevices
+	if err := xml.Unmarshal([]byte(domainXML), &devices); err != nil {
+		return nil, err
+	}
+	return &devices, nil
+}
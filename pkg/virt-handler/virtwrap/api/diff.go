@@ -0,0 +1,318 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package api
+
+import (
+	"encoding/xml"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ChangeType tells how a change between two domain specs can be applied
+type ChangeType string
+
+const (
+	// ChangeLive can be applied to the running domain, e.g. by attaching a
+	// device or by changing its IO limits
+	ChangeLive ChangeType = "Live"
+	// ChangeRestartRequired only takes effect after the domain was restarted
+	ChangeRestartRequired ChangeType = "RestartRequired"
+	// ChangeForbidden can not be applied to an existing domain at all
+	ChangeForbidden ChangeType = "Forbidden"
+)
+
+type Change struct {
+	// Path of the changed element, e.g. devices.disk[vda].iotune
+	Path string
+	Type ChangeType
+}
+
+type DomainSpecDiff struct {
+	Changes []Change
+}
+
+func (d *DomainSpecDiff) add(changeType ChangeType, format string, args ...interface{}) {
+	d.Changes = append(d.Changes, Change{Path: fmt.Sprintf(format, args...), Type: changeType})
+}
+
+func (d *DomainSpecDiff) has(changeType ChangeType) bool {
+	for _, change := range d.Changes {
+		if change.Type == changeType {
+			return true
+		}
+	}
+	return false
+}
+
+// Empty returns whether both specs are equal
+func (d *DomainSpecDiff) Empty() bool {
+	return len(d.Changes) == 0
+}
+
+// Forbidden returns whether a change can't be applied at all
+func (d *DomainSpecDiff) Forbidden() bool {
+	return d.has(ChangeForbidden)
+}
+
+// RestartRequired returns whether a change needs a restart of the domain
+func (d *DomainSpecDiff) RestartRequired() bool {
+	return d.has(ChangeRestartRequired)
+}
+
+// LiveChanges returns the changes which can be applied to the running domain
+func (d *DomainSpecDiff) LiveChanges() []Change {
+	changes := []Change{}
+	for _, change := range d.Changes {
+		if change.Type == ChangeLive {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// Aliases and addresses are assigned by libvirt, they are never compared.
+var runtimeFields = []string{"Alias", "Address"}
+
+// DiffDomainSpec compares the spec of an existing domain with the wanted spec
+// and sorts the differences by how they can be applied. Both specs have to be
+// on the same level, e.g. the specs which were derived from the VM before and
+// after a change, libvirt's expanded live XML differs in too many details. The
+// changes are reported in the order of the elements in the spec.
+func DiffDomainSpec(current *DomainSpec, desired *DomainSpec) *DomainSpecDiff {
+	diff := &DomainSpecDiff{}
+
+	if current.Name != desired.Name {
+		diff.add(ChangeForbidden, "name")
+	}
+	if desired.UUID != "" && current.UUID != desired.UUID {
+		diff.add(ChangeForbidden, "uuid")
+	}
+	if current.Type != desired.Type {
+		diff.add(ChangeForbidden, "type")
+	}
+	// Both are plain metadata, libvirt can change them on the fly
+	if current.Title != desired.Title {
+		diff.add(ChangeLive, "title")
+	}
+	if current.Description != desired.Description {
+		diff.add(ChangeLive, "description")
+	}
+
+	for _, element := range []struct {
+		path    string
+		current interface{}
+		desired interface{}
+	}{
+		{"memory", current.Memory, desired.Memory},
+		{"memoryBacking", current.MemoryBacking, desired.MemoryBacking},
+		{"vcpu", current.VCPU, desired.VCPU},
+		{"iothreads", current.IOThreads, desired.IOThreads},
+		{"os", current.OS, desired.OS},
+		{"features", current.Features, desired.Features},
+		{"sysinfo", current.SysInfo, desired.SysInfo},
+		{"clock", current.Clock, desired.Clock},
+		{"resource", current.Resource, desired.Resource},
+		{"launchSecurity", current.LaunchSecurity, desired.LaunchSecurity},
+		{"commandline", current.QEMUCmd, desired.QEMUCmd},
+	} {
+		if !semanticEqual(element.current, element.desired, runtimeFields...) {
+			diff.add(ChangeRestartRequired, element.path)
+		}
+	}
+
+	diffDisks(diff, current.Devices.Disks, desired.Devices.Disks)
+	diffInterfaces(diff, current.Devices.Interfaces, desired.Devices.Interfaces)
+	diffHostDevices(diff, current.Devices.HostDevices, desired.Devices.HostDevices)
+	diffOtherDevices(diff, &current.Devices, &desired.Devices)
+
+	return diff
+}
+
+// Disks are matched by their target, added and removed disks can be hot
+// plugged, IO limits can be changed on the fly.
+func diffDisks(diff *DomainSpecDiff, current []Disk, desired []Disk) {
+	currentDisks := map[string]Disk{}
+	for _, disk := range current {
+		currentDisks[disk.Target.Device] = disk
+	}
+	desiredDisks := map[string]bool{}
+	for _, disk := range desired {
+		dev := disk.Target.Device
+		desiredDisks[dev] = true
+		currentDisk, exists := currentDisks[dev]
+		if !exists {
+			diff.add(ChangeLive, "devices.disk[%s]", dev)
+			continue
+		}
+		if !semanticEqual(currentDisk.IOTune, disk.IOTune) {
+			diff.add(ChangeLive, "devices.disk[%s].iotune", dev)
+		}
+		if !semanticEqual(currentDisk, disk, append(runtimeFields, "IOTune")...) {
+			diff.add(ChangeRestartRequired, "devices.disk[%s]", dev)
+		}
+	}
+	for _, disk := range current {
+		if !desiredDisks[disk.Target.Device] {
+			diff.add(ChangeLive, "devices.disk[%s]", disk.Target.Device)
+		}
+	}
+}
+
+// Interfaces are matched by their MAC, or by their position if the wanted
+// interface has no MAC. Bandwidth limits and the link state can be changed
+// on the fly.
+func diffInterfaces(diff *DomainSpecDiff, current []Interface, desired []Interface) {
+	interfaceKey := func(iface Interface, i int) string {
+		if iface.MAC != nil && iface.MAC.MAC != "" {
+			return strings.ToLower(iface.MAC.MAC)
+		}
+		return fmt.Sprintf("%d", i)
+	}
+
+	currentInterfaces := map[string]Interface{}
+	for i, iface := range current {
+		currentInterfaces[interfaceKey(iface, i)] = iface
+		currentInterfaces[fmt.Sprintf("%d", i)] = iface
+	}
+	matched := map[string]bool{}
+	for i, iface := range desired {
+		key := interfaceKey(iface, i)
+		currentInterface, exists := currentInterfaces[key]
+		if !exists {
+			diff.add(ChangeLive, "devices.interface[%s]", key)
+			continue
+		}
+		matched[interfaceKey(currentInterface, i)] = true
+		if !semanticEqual(currentInterface.BandWidth, iface.BandWidth) {
+			diff.add(ChangeLive, "devices.interface[%s].bandwidth", key)
+		}
+		if !semanticEqual(currentInterface.LinkState, iface.LinkState) {
+			diff.add(ChangeLive, "devices.interface[%s].link", key)
+		}
+		// libvirt picks the MAC and the host side device if they are not set
+		ignored := append(runtimeFields, "BandWidth", "LinkState", "MAC")
+		if iface.Target == nil {
+			ignored = append(ignored, "Target")
+		}
+		if !semanticEqual(currentInterface, iface, ignored...) {
+			diff.add(ChangeRestartRequired, "devices.interface[%s]", key)
+		}
+	}
+	for i, iface := range current {
+		if key := interfaceKey(iface, i); !matched[key] {
+			diff.add(ChangeLive, "devices.interface[%s]", key)
+		}
+	}
+}
+
+// Host devices are matched by their source and can be hot plugged. Their
+// boot order only takes effect after a restart.
+func diffHostDevices(diff *DomainSpecDiff, current []HostDevice, desired []HostDevice) {
+	hostDeviceKey := func(hostDev HostDevice) string {
+		source, _ := xml.Marshal(hostDev.Source)
+		return hostDev.Type + ":" + string(source)
+	}
+
+	currentHostDevices := map[string]HostDevice{}
+	for _, hostDev := range current {
+		currentHostDevices[hostDeviceKey(hostDev)] = hostDev
+	}
+	desiredHostDevices := map[string]bool{}
+	for i, hostDev := range desired {
+		key := hostDeviceKey(hostDev)
+		desiredHostDevices[key] = true
+		currentHostDev, exists := currentHostDevices[key]
+		if !exists {
+			diff.add(ChangeLive, "devices.hostdev[%d]", i)
+			continue
+		}
+		if !semanticEqual(currentHostDev.BootOrder, hostDev.BootOrder) {
+			diff.add(ChangeRestartRequired, "devices.hostdev[%d].boot", i)
+		}
+	}
+	for i, hostDev := range current {
+		if !desiredHostDevices[hostDeviceKey(hostDev)] {
+			diff.add(ChangeLive, "devices.hostdev[%d]", i)
+		}
+	}
+}
+
+// All other devices can only be changed with a restart.
+func diffOtherDevices(diff *DomainSpecDiff, current *Devices, desired *Devices) {
+	currentValue := reflect.ValueOf(current).Elem()
+	desiredValue := reflect.ValueOf(desired).Elem()
+	for i := 0; i < desiredValue.NumField(); i++ {
+		field := desiredValue.Type().Field(i)
+		switch field.Name {
+		case "Disks", "Interfaces", "HostDevices":
+			continue
+		}
+		if !semanticEqual(currentValue.Field(i).Interface(), desiredValue.Field(i).Interface(), runtimeFields...) {
+			diff.add(ChangeRestartRequired, "devices.%s", strings.Split(field.Tag.Get("xml"), ",")[0])
+		}
+	}
+}
+
+// semanticEqual compares two values like reflect.DeepEqual, except that
+// struct fields with one of the ignored names are skipped and that nil and
+// empty slices are equal.
+func semanticEqual(a interface{}, b interface{}, ignored ...string) bool {
+	ignore := map[string]bool{}
+	for _, name := range ignored {
+		ignore[name] = true
+	}
+	return semanticEqualValues(reflect.ValueOf(a), reflect.ValueOf(b), ignore)
+}
+
+func semanticEqualValues(a reflect.Value, b reflect.Value, ignore map[string]bool) bool {
+	if !a.IsValid() || !b.IsValid() {
+		return a.IsValid() == b.IsValid()
+	}
+	switch a.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		return semanticEqualValues(a.Elem(), b.Elem(), ignore)
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			if ignore[a.Type().Field(i).Name] {
+				continue
+			}
+			if !semanticEqualValues(a.Field(i), b.Field(i), ignore) {
+				return false
+			}
+		}
+		return true
+	case reflect.Slice:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !semanticEqualValues(a.Index(i), b.Index(i), ignore) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(a.Interface(), b.Interface())
+	}
+}
@@ -0,0 +1,135 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package api
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DiffDomainSpec", func() {
+
+	newSpec := func() *DomainSpec {
+		spec := NewMinimalDomainSpec("default_testvm")
+		spec.UUID = "3f2c0c6b-8a8b-4e33-9a4f-6f3c7ad2a1e9"
+		spec.Devices.Interfaces[0].MAC = &MAC{MAC: "02:00:00:00:00:01"}
+		spec.Devices.Disks = []Disk{
+			{
+				Type:   "file",
+				Device: "disk",
+				Source: DiskSource{File: "/var/run/kubevirt/disk.img"},
+				Target: DiskTarget{Device: "vda", Bus: "virtio"},
+				Driver: &DiskDriver{Name: "qemu", Type: "raw"},
+			},
+		}
+		return spec
+	}
+
+	It("should not report anything for equal specs", func() {
+		Expect(DiffDomainSpec(newSpec(), newSpec()).Empty()).To(BeTrue())
+	})
+
+	It("should ignore aliases and addresses", func() {
+		current := newSpec()
+		current.Devices.Interfaces[0].Alias = &Alias{Name: "net0"}
+		current.Devices.Interfaces[0].Address = &Address{Type: "pci", Domain: "0x0000", Bus: "0x00", Slot: "0x03", Function: "0x0"}
+		Expect(DiffDomainSpec(current, newSpec()).Empty()).To(BeTrue())
+	})
+
+	It("should apply device attachments and IO limits live", func() {
+		desired := newSpec()
+		desired.Devices.Disks[0].IOTune = &DiskIOTune{TotalIopsSec: 500}
+		desired.Devices.Disks = append(desired.Devices.Disks, Disk{
+			Type:   "file",
+			Device: "disk",
+			Source: DiskSource{File: "/var/run/kubevirt/disk2.img"},
+			Target: DiskTarget{Device: "vdb", Bus: "virtio"},
+		})
+		desired.Devices.Interfaces[0].LinkState = &LinkState{State: "down"}
+		desired.Description = "app=db"
+
+		diff := DiffDomainSpec(newSpec(), desired)
+		Expect(diff.RestartRequired()).To(BeFalse())
+		Expect(diff.Forbidden()).To(BeFalse())
+		Expect(diff.LiveChanges()).To(ConsistOf(
+			Change{Path: "devices.disk[vda].iotune", Type: ChangeLive},
+			Change{Path: "devices.disk[vdb]", Type: ChangeLive},
+			Change{Path: "devices.interface[02:00:00:00:00:01].link", Type: ChangeLive},
+			Change{Path: "description", Type: ChangeLive},
+		))
+	})
+
+	It("should detect removed interfaces", func() {
+		desired := newSpec()
+		desired.Devices.Interfaces = nil
+		Expect(DiffDomainSpec(newSpec(), desired).Changes).To(Equal([]Change{
+			{Path: "devices.interface[02:00:00:00:00:01]", Type: ChangeLive},
+		}))
+	})
+
+	It("should require a restart for changes of the machine", func() {
+		desired := newSpec()
+		desired.Memory.Value = 16384
+		desired.Devices.Disks[0].Driver.Cache = "none"
+		desired.Devices.Watchdog = &Watchdog{Model: "i6300esb"}
+
+		diff := DiffDomainSpec(newSpec(), desired)
+		Expect(diff.RestartRequired()).To(BeTrue())
+		Expect(diff.Changes).To(Equal([]Change{
+			{Path: "memory", Type: ChangeRestartRequired},
+			{Path: "devices.disk[vda]", Type: ChangeRestartRequired},
+			{Path: "devices.watchdog", Type: ChangeRestartRequired},
+		}))
+	})
+
+	It("should require a restart for removed devices", func() {
+		current := newSpec()
+		current.Devices.Watchdog = &Watchdog{Model: "i6300esb"}
+		current.Features = &Features{ACPI: &FeatureEnabled{}}
+
+		Expect(DiffDomainSpec(current, newSpec()).Changes).To(Equal([]Change{
+			{Path: "features", Type: ChangeRestartRequired},
+			{Path: "devices.watchdog", Type: ChangeRestartRequired},
+		}))
+	})
+
+	It("should require a restart for boot order changes of host devices", func() {
+		hostDev := HostDevice{
+			Mode:   "subsystem",
+			Type:   "pci",
+			Source: HostDeviceSource{Address: &Address{Domain: "0x0000", Bus: "0x06", Slot: "0x02", Function: "0x0"}},
+		}
+		current := newSpec()
+		current.Devices.HostDevices = []HostDevice{hostDev}
+		desired := newSpec()
+		desired.Devices.HostDevices = []HostDevice{hostDev}
+		desired.Devices.HostDevices[0].BootOrder = &BootOrder{Order: 1}
+
+		Expect(DiffDomainSpec(current, desired).Changes).To(Equal([]Change{
+			{Path: "devices.hostdev[0].boot", Type: ChangeRestartRequired},
+		}))
+	})
+
+	It("should forbid changing the identity of the domain", func() {
+		desired := newSpec()
+		desired.UUID = "5d3b1e55-1a0f-4a44-9d8c-1b4a37f3c0aa"
+		Expect(DiffDomainSpec(newSpec(), desired).Forbidden()).To(BeTrue())
+	})
+})
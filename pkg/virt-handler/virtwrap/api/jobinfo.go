@@ -0,0 +1,58 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package api
+
+type JobType string
+
+const (
+	JobNone      JobType = "None"
+	JobBounded   JobType = "Bounded"
+	JobUnbounded JobType = "Unbounded"
+	JobCompleted JobType = "Completed"
+	JobFailed    JobType = "Failed"
+	JobCancelled JobType = "Cancelled"
+)
+
+// DomainJobInfo is the progress of the current job of a domain, e.g. of an
+// outgoing migration. Times are in milliseconds, sizes in bytes.
+type DomainJobInfo struct {
+	Type          JobType
+	TimeElapsed   uint64
+	TimeRemaining uint64
+	DataTotal     uint64
+	DataProcessed uint64
+	DataRemaining uint64
+	MemTotal      uint64
+	MemProcessed  uint64
+	MemRemaining  uint64
+	MemBps        uint64
+	MemDirtyRate  uint64
+	MemIteration  uint64
+	Downtime      uint64
+}
+
+// Progress returns the share of the job data which was already processed,
+// between 0 and 1. Jobs which don't know their total size report 0.
+func (j *DomainJobInfo) Progress() float64 {
+	if j.DataTotal == 0 {
+		return 0
+	}
+	return float64(j.DataProcessed) / float64(j.DataTotal)
+}
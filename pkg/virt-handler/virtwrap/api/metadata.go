@@ -0,0 +1,64 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package api
+
+import (
+	"encoding/xml"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// KubeVirt keeps its own state in the metadata section of the domain, in an
+// element of its own XML namespace.
+const (
+	KubeVirtMetadataURI    = "http://kubevirt.io"
+	KubeVirtMetadataPrefix = "kubevirt"
+)
+
+// KubeVirtMetadata is the state virt-handler needs to recover a domain after
+// a restart.
+type KubeVirtMetadata struct {
+	XMLName            xml.Name  `xml:"kubevirt"`
+	UID                types.UID `xml:"uid,omitempty"`
+	GracePeriodSeconds *int64    `xml:"gracePeriodSeconds,omitempty"`
+	MigrationUID       types.UID `xml:"migrationUID,omitempty"`
+	LauncherPodUID     types.UID `xml:"launcherPodUID,omitempty"`
+	// Devices are the target names and PCI addresses which were assigned
+	// to the devices of the domain
+	Devices []DeviceAllocation `xml:"devices>device,omitempty"`
+	// CrashRestarts counts how often the crashed guest was started again in
+	// place
+	CrashRestarts uint `xml:"crashRestarts,omitempty"`
+	// AwaitsLaunchSecret is set while a SEV guest is paused until the guest
+	// owner injects its launch secret
+	AwaitsLaunchSecret bool `xml:"awaitsLaunchSecret,omitempty"`
+	// Spec is the spec which was derived from the VM when the domain was
+	// defined, before virt-handler filled in its defaults. Changes of the VM
+	// are compared against it.
+	Spec *DomainSpec `xml:"domain,omitempty"`
+}
+
+// DeviceAllocation records the target name and the PCI address which were
+// assigned to a device, identified by its key.
+type DeviceAllocation struct {
+	Key     string   `xml:"key,attr" json:"key"`
+	Target  string   `xml:"target,attr,omitempty" json:"target,omitempty"`
+	Address *Address `xml:"address,omitempty" json:"address,omitempty"`
+}
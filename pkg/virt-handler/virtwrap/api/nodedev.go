@@ -0,0 +1,131 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package api
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+// NodeDevice represents a host device as described in
+// https://libvirt.org/formatnode.html.
+type NodeDevice struct {
+	XMLName    xml.Name               `xml:"device"`
+	Name       string                 `xml:"name"`
+	Path       string                 `xml:"path,omitempty"`
+	Parent     string                 `xml:"parent,omitempty"`
+	Driver     *NodeDeviceDriver      `xml:"driver,omitempty"`
+	Capability []NodeDeviceCapability `xml:"capability"`
+}
+
+type NodeDeviceDriver struct {
+	Name string `xml:"name"`
+}
+
+type NodeDeviceCapability struct {
+	Type       string                 `xml:"type,attr"`
+	Domain     *uint                  `xml:"domain,omitempty"`
+	Bus        *uint                  `xml:"bus,omitempty"`
+	Slot       *uint                  `xml:"slot,omitempty"`
+	Function   *uint                  `xml:"function,omitempty"`
+	Product    *NodeDeviceID          `xml:"product,omitempty"`
+	Vendor     *NodeDeviceID          `xml:"vendor,omitempty"`
+	IOMMUGroup *NodeDeviceIOMMUGroup  `xml:"iommuGroup,omitempty"`
+	Addresses  []NodeDevicePCIAddress `xml:"address"`
+	Capability []NodeDeviceCapability `xml:"capability"`
+	// Types is filled for mdev_types and mdev capabilities
+	Types []NodeDeviceMediatedType `xml:"type"`
+}
+
+type NodeDeviceMediatedType struct {
+	ID                 string `xml:"id,attr"`
+	Name               string `xml:"name,omitempty"`
+	DeviceAPI          string `xml:"deviceAPI,omitempty"`
+	AvailableInstances uint   `xml:"availableInstances,omitempty"`
+}
+
+type NodeDeviceID struct {
+	ID   string `xml:"id,attr"`
+	Name string `xml:",chardata"`
+}
+
+type NodeDeviceIOMMUGroup struct {
+	Number    uint                   `xml:"number,attr"`
+	Addresses []NodeDevicePCIAddress `xml:"address"`
+}
+
+type NodeDevicePCIAddress struct {
+	Domain   string `xml:"domain,attr"`
+	Bus      string `xml:"bus,attr"`
+	Slot     string `xml:"slot,attr"`
+	Function string `xml:"function,attr"`
+}
+
+// PCICapability returns the top level pci capability of the device, or nil
+// if it is not a PCI device.
+func (d *NodeDevice) PCICapability() *NodeDeviceCapability {
+	for i, c := range d.Capability {
+		if c.Type == "pci" {
+			return &d.Capability[i]
+		}
+	}
+	return nil
+}
+
+// PCIAddress returns the PCI address of the device as it is used in domain
+// hostdev definitions.
+func (d *NodeDevice) PCIAddress() (*Address, error) {
+	c := d.PCICapability()
+	if c == nil || c.Domain == nil || c.Bus == nil || c.Slot == nil || c.Function == nil {
+		return nil, fmt.Errorf("device %s is not a PCI device", d.Name)
+	}
+	return &Address{
+		Type:     "pci",
+		Domain:   fmt.Sprintf("0x%04x", *c.Domain),
+		Bus:      fmt.Sprintf("0x%02x", *c.Bus),
+		Slot:     fmt.Sprintf("0x%02x", *c.Slot),
+		Function: fmt.Sprintf("0x%x", *c.Function),
+	}, nil
+}
+
+// MediatedTypes returns the mediated device types which can be created on the
+// device.
+func (d *NodeDevice) MediatedTypes() []NodeDeviceMediatedType {
+	if c := d.PCICapability(); c != nil {
+		for _, sub := range c.Capability {
+			if sub.Type == "mdev_types" {
+				return sub.Types
+			}
+		}
+	}
+	return nil
+}
+
+// IsVirtualFunction returns true if the device is an SR-IOV VF.
+func (d *NodeDevice) IsVirtualFunction() bool {
+	if c := d.PCICapability(); c != nil {
+		for _, sub := range c.Capability {
+			if sub.Type == "phys_function" {
+				return true
+			}
+		}
+	}
+	return false
+}
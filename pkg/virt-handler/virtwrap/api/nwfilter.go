@@ -0,0 +1,82 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package api
+
+import (
+	"encoding/xml"
+)
+
+// NWFilter represents a network filter as described in
+// https://libvirt.org/formatnwfilter.html.
+type NWFilter struct {
+	XMLName    xml.Name       `xml:"filter"`
+	Name       string         `xml:"name,attr"`
+	Chain      string         `xml:"chain,attr,omitempty"`
+	Priority   int            `xml:"priority,attr,omitempty"`
+	UUID       string         `xml:"uuid,omitempty"`
+	FilterRefs []FilterRef    `xml:"filterref"`
+	Rules      []NWFilterRule `xml:"rule"`
+}
+
+type NWFilterRule struct {
+	Action    string               `xml:"action,attr"`
+	Direction string               `xml:"direction,attr"`
+	Priority  int                  `xml:"priority,attr,omitempty"`
+	MAC       *NWFilterMACProtocol `xml:"mac,omitempty"`
+	IP        *NWFilterIPProtocol  `xml:"ip,omitempty"`
+	ARP       *NWFilterARPProtocol `xml:"arp,omitempty"`
+}
+
+type NWFilterMACProtocol struct {
+	Match      string `xml:"match,attr,omitempty"`
+	SrcMACAddr string `xml:"srcmacaddr,attr,omitempty"`
+	DstMACAddr string `xml:"dstmacaddr,attr,omitempty"`
+	ProtocolID string `xml:"protocolid,attr,omitempty"`
+}
+
+type NWFilterIPProtocol struct {
+	Match     string `xml:"match,attr,omitempty"`
+	SrcIPAddr string `xml:"srcipaddr,attr,omitempty"`
+	DstIPAddr string `xml:"dstipaddr,attr,omitempty"`
+	Protocol  string `xml:"protocol,attr,omitempty"`
+}
+
+type NWFilterARPProtocol struct {
+	Match         string `xml:"match,attr,omitempty"`
+	ARPSrcMACAddr string `xml:"arpsrcmacaddr,attr,omitempty"`
+	ARPSrcIPAddr  string `xml:"arpsrcipaddr,attr,omitempty"`
+	Opcode        string `xml:"opcode,attr,omitempty"`
+}
+
+// NewAntiSpoofingFilter returns a filter which only allows the guest to
+// use the MAC and IP addresses passed as the MAC and IP parameters. It
+// builds on the filters which libvirt ships by default.
+func NewAntiSpoofingFilter(name string) *NWFilter {
+	return &NWFilter{
+		Name:  name,
+		Chain: "root",
+		FilterRefs: []FilterRef{
+			{Filter: "no-mac-spoofing"},
+			{Filter: "no-ip-spoofing"},
+			{Filter: "no-arp-spoofing"},
+			{Filter: "allow-incoming-ipv4"},
+		},
+	}
+}
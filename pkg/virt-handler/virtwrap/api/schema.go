@@ -41,6 +41,12 @@ type StateChangeReason string
 func init() {
 	// TODO the whole mapping registration can be done be an automatic process with reflection
 	mapper.AddConversion(&Memory{}, &v1.Memory{})
+	mapper.AddPtrConversion((**MemoryBacking)(nil), (**v1.MemoryBacking)(nil))
+	mapper.AddPtrConversion((**VCPU)(nil), (**v1.VCPU)(nil))
+	mapper.AddPtrConversion((**IOThreads)(nil), (**v1.IOThreads)(nil))
+	mapper.AddPtrConversion((**HugePages)(nil), (**v1.HugePages)(nil))
+	mapper.AddPtrConversion((**MemoryAccess)(nil), (**v1.MemoryAccess)(nil))
+	mapper.AddConversion(&HugePage{}, &v1.HugePage{})
 	mapper.AddConversion(&OS{}, &v1.OS{})
 	mapper.AddConversion(&Devices{}, &v1.Devices{})
 	mapper.AddPtrConversion((**Clock)(nil), (**v1.Clock)(nil))
@@ -50,37 +56,63 @@ func init() {
 	mapper.AddConversion(&Graphics{}, &v1.Graphics{})
 	mapper.AddPtrConversion((**Ballooning)(nil), (**v1.Ballooning)(nil))
 	mapper.AddConversion(&Disk{}, &v1.Disk{})
-	mapper.AddConversion(&DiskSource{}, &v1.DiskSource{})
-	mapper.AddPtrConversion((**DiskSourceHost)(nil), (**v1.DiskSourceHost)(nil))
 	mapper.AddConversion(&DiskTarget{}, &v1.DiskTarget{})
 	mapper.AddPtrConversion((**DiskDriver)(nil), (**v1.DiskDriver)(nil))
 	mapper.AddPtrConversion((**ReadOnly)(nil), (**v1.ReadOnly)(nil))
 	mapper.AddPtrConversion((**Address)(nil), (**v1.Address)(nil))
 	mapper.AddConversion(&Serial{}, &v1.Serial{})
 	mapper.AddPtrConversion((**SerialTarget)(nil), (**v1.SerialTarget)(nil))
+	mapper.AddConversion(&Parallel{}, &v1.Parallel{})
 	mapper.AddConversion(&Console{}, &v1.Console{})
 	mapper.AddPtrConversion((**ConsoleTarget)(nil), (**v1.ConsoleTarget)(nil))
 	mapper.AddConversion(&InterfaceSource{}, &v1.InterfaceSource{})
 	mapper.AddPtrConversion((**InterfaceTarget)(nil), (**v1.InterfaceTarget)(nil))
 	mapper.AddPtrConversion((**Model)(nil), (**v1.Model)(nil))
 	mapper.AddPtrConversion((**MAC)(nil), (**v1.MAC)(nil))
+	mapper.AddPtrConversion((**InterfaceDriver)(nil), (**v1.InterfaceDriver)(nil))
+	mapper.AddPtrConversion((**InterfaceROM)(nil), (**v1.InterfaceROM)(nil))
 	mapper.AddPtrConversion((**BandWidth)(nil), (**v1.BandWidth)(nil))
+	mapper.AddPtrConversion((**BandWidthRate)(nil), (**v1.BandWidthRate)(nil))
 	mapper.AddPtrConversion((**BootOrder)(nil), (**v1.BootOrder)(nil))
 	mapper.AddPtrConversion((**LinkState)(nil), (**v1.LinkState)(nil))
 	mapper.AddPtrConversion((**FilterRef)(nil), (**v1.FilterRef)(nil))
+	mapper.AddConversion(&FilterParameter{}, &v1.FilterParameter{})
 	mapper.AddPtrConversion((**Alias)(nil), (**v1.Alias)(nil))
 	mapper.AddConversion(&OSType{}, &v1.OSType{})
 	mapper.AddPtrConversion((**SMBios)(nil), (**v1.SMBios)(nil))
 	mapper.AddConversion(&Boot{}, &v1.Boot{})
 	mapper.AddPtrConversion((**BootMenu)(nil), (**v1.BootMenu)(nil))
 	mapper.AddPtrConversion((**BIOS)(nil), (**v1.BIOS)(nil))
+	mapper.AddPtrConversion((**Loader)(nil), (**v1.Loader)(nil))
+	mapper.AddPtrConversion((**NVRam)(nil), (**v1.NVRam)(nil))
+	mapper.AddPtrConversion((**Features)(nil), (**v1.Features)(nil))
+	mapper.AddPtrConversion((**FeatureState)(nil), (**v1.FeatureState)(nil))
+	mapper.AddPtrConversion((**FeatureEnabled)(nil), (**v1.FeatureEnabled)(nil))
+	mapper.AddPtrConversion((**FeatureHyperv)(nil), (**v1.FeatureHyperv)(nil))
+	mapper.AddPtrConversion((**FeatureSpinlocks)(nil), (**v1.FeatureSpinlocks)(nil))
+	mapper.AddPtrConversion((**FeatureVendorID)(nil), (**v1.FeatureVendorID)(nil))
+	mapper.AddConversion(&Timer{}, &v1.Timer{})
 	mapper.AddConversion(&Entry{}, &v1.Entry{})
 	mapper.AddConversion(&ChannelSource{}, &v1.ChannelSource{})
 	mapper.AddPtrConversion((**ChannelTarget)(nil), (**v1.ChannelTarget)(nil))
 	mapper.AddConversion(&VideoModel{}, &v1.Video{})
 	mapper.AddConversion(&Listen{}, &v1.Listen{})
 	mapper.AddPtrConversion((**DiskAuth)(nil), (**v1.DiskAuth)(nil))
+	mapper.AddPtrConversion((**DiskIOTune)(nil), (**v1.DiskIOTune)(nil))
 	mapper.AddPtrConversion((**DiskSecret)(nil), (**v1.DiskSecret)(nil))
+	mapper.AddPtrConversion((**DiskEncryption)(nil), (**v1.DiskEncryption)(nil))
+	mapper.AddConversion(&HostDevice{}, &v1.HostDevice{})
+	mapper.AddConversion(&HostDeviceSource{}, &v1.HostDeviceSource{})
+	mapper.AddPtrConversion((**Watchdog)(nil), (**v1.Watchdog)(nil))
+	mapper.AddPtrConversion((**RandomGenerator)(nil), (**v1.RandomGenerator)(nil))
+	mapper.AddPtrConversion((**RngRate)(nil), (**v1.RngRate)(nil))
+	mapper.AddConversion(&RngBackend{}, &v1.RngBackend{})
+	mapper.AddPtrConversion((**TPM)(nil), (**v1.TPM)(nil))
+	mapper.AddConversion(&TPMBackend{}, &v1.TPMBackend{})
+	mapper.AddConversion(&Controller{}, &v1.Controller{})
+	mapper.AddConversion(&Sound{}, &v1.Sound{})
+	mapper.AddConversion(&Input{}, &v1.Input{})
+	mapper.AddConversion(&RedirDev{}, &v1.RedirDev{})
 
 	model.AddConversion(&Video{}, &v1.Video{}, func(in reflect.Value) (reflect.Value, error) {
 		out := v1.Video{}
@@ -98,6 +130,48 @@ func init() {
 		}
 		return reflect.ValueOf(out), nil
 	})
+
+	// libvirt lists all hosts of a network disk the same way, the v1 API
+	// has the first host in Host and only the additional ones in Hosts.
+	model.AddConversion(&DiskSource{}, &v1.DiskSource{}, func(in reflect.Value) (reflect.Value, error) {
+		source := in.Interface().(DiskSource)
+		out := v1.DiskSource{
+			File:          source.File,
+			StartupPolicy: source.StartupPolicy,
+			Protocol:      source.Protocol,
+			Name:          source.Name,
+		}
+		for i, host := range source.Hosts {
+			if i == 0 {
+				out.Host = &v1.DiskSourceHost{Name: host.Name, Port: host.Port, Transport: host.Transport, Socket: host.Socket}
+				continue
+			}
+			out.Hosts = append(out.Hosts, v1.DiskSourceHost{Name: host.Name, Port: host.Port, Transport: host.Transport, Socket: host.Socket})
+		}
+		if source.Initiator != nil {
+			out.Initiator = &v1.DiskSourceInitiator{IQN: source.Initiator.IQN.Name}
+		}
+		return reflect.ValueOf(out), nil
+	})
+	model.AddConversion(&v1.DiskSource{}, &DiskSource{}, func(in reflect.Value) (reflect.Value, error) {
+		source := in.Interface().(v1.DiskSource)
+		out := DiskSource{
+			File:          source.File,
+			StartupPolicy: source.StartupPolicy,
+			Protocol:      source.Protocol,
+			Name:          source.Name,
+		}
+		if source.Host != nil {
+			out.Hosts = append(out.Hosts, DiskSourceHost{Name: source.Host.Name, Port: source.Host.Port, Transport: source.Host.Transport, Socket: source.Host.Socket})
+		}
+		for _, host := range source.Hosts {
+			out.Hosts = append(out.Hosts, DiskSourceHost{Name: host.Name, Port: host.Port, Transport: host.Transport, Socket: host.Socket})
+		}
+		if source.Initiator != nil {
+			out.Initiator = &DiskSourceInitiator{IQN: DiskSourceIQN{Name: source.Initiator.IQN}}
+		}
+		return reflect.ValueOf(out), nil
+	})
 }
 
 const (
@@ -125,6 +199,16 @@ const (
 	ReasonSaved        StateChangeReason = "Saved"
 	ReasonFailed       StateChangeReason = "Failed"
 	ReasonFromSnapshot StateChangeReason = "FromSnapshot"
+
+	// Paused reasons
+	ReasonMigration      StateChangeReason = "Migration"
+	ReasonPostCopyFailed StateChangeReason = "PostCopyFailed"
+
+	// Running and Paused reasons
+	ReasonPostCopy StateChangeReason = "PostCopy"
+
+	// Running and Shutoff reasons
+	ReasonWatchdog StateChangeReason = "Watchdog"
 )
 
 type Domain struct {
@@ -201,24 +285,48 @@ func (in *DomainList) DeepCopyObject() runtime.Object {
 // tagged, and they must correspond to the libvirt domain as described in
 // https://libvirt.org/formatdomain.html.
 type DomainSpec struct {
-	XMLName  xml.Name     `xml:"domain"`
-	Type     string       `xml:"type,attr"`
-	XmlNS    string       `xml:"xmlns:qemu,attr,omitempty"`
-	Name     string       `xml:"name"`
-	UUID     string       `xml:"uuid,omitempty"`
-	Memory   Memory       `xml:"memory"`
-	OS       OS           `xml:"os"`
-	SysInfo  *SysInfo     `xml:"sysinfo,omitempty"`
-	Devices  Devices      `xml:"devices"`
-	Clock    *Clock       `xml:"clock,omitempty"`
-	Resource *Resource    `xml:"resource,omitempty"`
-	QEMUCmd  *Commandline `xml:"qemu:commandline,omitempty"`
+	XMLName        xml.Name        `xml:"domain"`
+	Type           string          `xml:"type,attr"`
+	XmlNS          string          `xml:"xmlns:qemu,attr,omitempty"`
+	Name           string          `xml:"name"`
+	UUID           string          `xml:"uuid,omitempty"`
+	Title          string          `xml:"title,omitempty"`
+	Description    string          `xml:"description,omitempty"`
+	Memory         Memory          `xml:"memory"`
+	MemoryBacking  *MemoryBacking  `xml:"memoryBacking,omitempty"`
+	VCPU           *VCPU           `xml:"vcpu,omitempty"`
+	IOThreads      *IOThreads      `xml:"iothreads,omitempty"`
+	OS             OS              `xml:"os"`
+	Features       *Features       `xml:"features,omitempty"`
+	SysInfo        *SysInfo        `xml:"sysinfo,omitempty"`
+	Devices        Devices         `xml:"devices"`
+	Clock          *Clock          `xml:"clock,omitempty"`
+	OnCrash        string          `xml:"on_crash,omitempty"`
+	Perf           *Perf           `xml:"perf,omitempty"`
+	Resource       *Resource       `xml:"resource,omitempty"`
+	LaunchSecurity *LaunchSecurity `xml:"launchSecurity,omitempty"`
+	QEMUCmd        *Commandline    `xml:"qemu:commandline,omitempty"`
+}
+
+// LaunchSecurity encrypts the guest memory, e.g. with AMD SEV
+type LaunchSecurity struct {
+	Type            string `xml:"type,attr"`
+	CBitPos         uint   `xml:"cbitpos,omitempty"`
+	ReducedPhysBits uint   `xml:"reducedPhysBits,omitempty"`
+	Policy          string `xml:"policy,omitempty"`
+	DHCert          string `xml:"dhCert,omitempty"`
+	Session         string `xml:"session,omitempty"`
 }
 
 type Commandline struct {
+	QEMUArg []Arg `xml:"qemu:arg,omitempty"`
 	QEMUEnv []Env `xml:"qemu:env,omitempty"`
 }
 
+type Arg struct {
+	Value string `xml:"value,attr"`
+}
+
 type Env struct {
 	Name  string `xml:"name,attr"`
 	Value string `xml:"value,attr"`
@@ -233,30 +341,81 @@ type Memory struct {
 	Unit  string `xml:"unit,attr"`
 }
 
+type VCPU struct {
+	Placement string `xml:"placement,attr,omitempty"`
+	CPUs      uint   `xml:",chardata"`
+}
+
+type IOThreads struct {
+	Count uint `xml:",chardata"`
+}
+
+type MemoryBacking struct {
+	HugePages *HugePages    `xml:"hugepages,omitempty"`
+	Access    *MemoryAccess `xml:"access,omitempty"`
+}
+
+type MemoryAccess struct {
+	Mode string `xml:"mode,attr"`
+}
+
+type HugePages struct {
+	HugePage []HugePage `xml:"page,omitempty"`
+}
+
+type HugePage struct {
+	Size    uint   `xml:"size,attr"`
+	Unit    string `xml:"unit,attr,omitempty"`
+	NodeSet string `xml:"nodeset,attr,omitempty"`
+}
+
 type Devices struct {
-	Emulator   string      `xml:"emulator,omitempty"`
-	Interfaces []Interface `xml:"interface"`
-	Channels   []Channel   `xml:"channel"`
-	Video      []Video     `xml:"video"`
-	Graphics   []Graphics  `xml:"graphics"`
-	Ballooning *Ballooning `xml:"memballoon,omitempty"`
-	Disks      []Disk      `xml:"disk"`
-	Serials    []Serial    `xml:"serial"`
-	Consoles   []Console   `xml:"console"`
+	Emulator    string           `xml:"emulator,omitempty"`
+	Interfaces  []Interface      `xml:"interface"`
+	Channels    []Channel        `xml:"channel"`
+	Video       []Video          `xml:"video"`
+	Graphics    []Graphics       `xml:"graphics"`
+	Ballooning  *Ballooning      `xml:"memballoon,omitempty"`
+	Disks       []Disk           `xml:"disk"`
+	Serials     []Serial         `xml:"serial"`
+	Parallels   []Parallel       `xml:"parallel"`
+	Consoles    []Console        `xml:"console"`
+	HostDevices []HostDevice     `xml:"hostdev"`
+	Watchdog    *Watchdog        `xml:"watchdog,omitempty"`
+	Panics      []Panic          `xml:"panic"`
+	Rng         *RandomGenerator `xml:"rng,omitempty"`
+	TPM         *TPM             `xml:"tpm,omitempty"`
+	Controllers []Controller     `xml:"controller"`
+	Sounds      []Sound          `xml:"sound"`
+	Inputs      []Input          `xml:"input"`
+	Redirects   []RedirDev       `xml:"redirdev"`
 }
 
 // BEGIN Disk -----------------------------
 
 type Disk struct {
-	Device   string      `xml:"device,attr"`
-	Snapshot string      `xml:"snapshot,attr,omitempty"`
-	Type     string      `xml:"type,attr"`
-	Source   DiskSource  `xml:"source"`
-	Target   DiskTarget  `xml:"target"`
-	Serial   string      `xml:"serial,omitempty"`
-	Driver   *DiskDriver `xml:"driver,omitempty"`
-	ReadOnly *ReadOnly   `xml:"readonly,omitempty"`
-	Auth     *DiskAuth   `xml:"auth,omitempty"`
+	Device     string          `xml:"device,attr"`
+	Snapshot   string          `xml:"snapshot,attr,omitempty"`
+	Type       string          `xml:"type,attr"`
+	Source     DiskSource      `xml:"source"`
+	Target     DiskTarget      `xml:"target"`
+	Serial     string          `xml:"serial,omitempty"`
+	Driver     *DiskDriver     `xml:"driver,omitempty"`
+	ReadOnly   *ReadOnly       `xml:"readonly,omitempty"`
+	Auth       *DiskAuth       `xml:"auth,omitempty"`
+	IOTune     *DiskIOTune     `xml:"iotune,omitempty"`
+	Encryption *DiskEncryption `xml:"encryption,omitempty"`
+	BootOrder  *BootOrder      `xml:"boot,omitempty"`
+	Address    *Address        `xml:"address,omitempty"`
+}
+
+type DiskIOTune struct {
+	TotalBytesSec uint64 `xml:"total_bytes_sec,omitempty"`
+	ReadBytesSec  uint64 `xml:"read_bytes_sec,omitempty"`
+	WriteBytesSec uint64 `xml:"write_bytes_sec,omitempty"`
+	TotalIopsSec  uint64 `xml:"total_iops_sec,omitempty"`
+	ReadIopsSec   uint64 `xml:"read_iops_sec,omitempty"`
+	WriteIopsSec  uint64 `xml:"write_iops_sec,omitempty"`
 }
 
 type DiskAuth struct {
@@ -269,14 +428,28 @@ type DiskSecret struct {
 	Usage string `xml:"usage,attr"`
 }
 
+type DiskEncryption struct {
+	Format string      `xml:"format,attr"`
+	Secret *DiskSecret `xml:"secret,omitempty"`
+}
+
 type ReadOnly struct{}
 
 type DiskSource struct {
-	File          string          `xml:"file,attr,omitempty"`
-	StartupPolicy string          `xml:"startupPolicy,attr,omitempty"`
-	Protocol      string          `xml:"protocol,attr,omitempty"`
-	Name          string          `xml:"name,attr,omitempty"`
-	Host          *DiskSourceHost `xml:"host,omitempty"`
+	File          string               `xml:"file,attr,omitempty"`
+	StartupPolicy string               `xml:"startupPolicy,attr,omitempty"`
+	Protocol      string               `xml:"protocol,attr,omitempty"`
+	Name          string               `xml:"name,attr,omitempty"`
+	Hosts         []DiskSourceHost     `xml:"host,omitempty"`
+	Initiator     *DiskSourceInitiator `xml:"initiator,omitempty"`
+}
+
+type DiskSourceInitiator struct {
+	IQN DiskSourceIQN `xml:"iqn"`
+}
+
+type DiskSourceIQN struct {
+	Name string `xml:"name,attr"`
 }
 
 type DiskTarget struct {
@@ -288,22 +461,63 @@ type DiskDriver struct {
 	Cache       string `xml:"cache,attr,omitempty"`
 	ErrorPolicy string `xml:"error_policy,attr,omitempty"`
 	IO          string `xml:"io,attr,omitempty"`
-	Name        string `xml:"name,attr"`
-	Type        string `xml:"type,attr"`
+	Name        string `xml:"name,attr,omitempty"`
+	Type        string `xml:"type,attr,omitempty"`
+	Queues      uint   `xml:"queues,attr,omitempty"`
+	IOThread    uint   `xml:"iothread,attr,omitempty"`
+	IOMMU       string `xml:"iommu,attr,omitempty"`
+	Discard     string `xml:"discard,attr,omitempty"`
 }
 
 type DiskSourceHost struct {
-	Name string `xml:"name,attr"`
-	Port string `xml:"port,attr,omitempty"`
+	Name      string `xml:"name,attr,omitempty"`
+	Port      string `xml:"port,attr,omitempty"`
+	Transport string `xml:"transport,attr,omitempty"`
+	Socket    string `xml:"socket,attr,omitempty"`
 }
 
 // END Disk -----------------------------
 
+// BEGIN HostDevice -----------------------------
+
+type HostDevice struct {
+	Mode      string           `xml:"mode,attr"`
+	Type      string           `xml:"type,attr"`
+	Managed   string           `xml:"managed,attr,omitempty"`
+	Model     string           `xml:"model,attr,omitempty"`
+	Source    HostDeviceSource `xml:"source"`
+	Address   *Address         `xml:"address,omitempty"`
+	Alias     *Alias           `xml:"alias,omitempty"`
+	BootOrder *BootOrder       `xml:"boot,omitempty"`
+}
+
+type HostDeviceSource struct {
+	Address    *Address `xml:"address,omitempty"`
+	MdevParent string   `xml:"-"`
+	MdevType   string   `xml:"-"`
+}
+
+// END HostDevice -----------------------------
+
 // BEGIN Serial -----------------------------
 
 type Serial struct {
 	Type   string        `xml:"type,attr"`
+	Source *SerialSource `xml:"source,omitempty"`
+	Target *SerialTarget `xml:"target,omitempty"`
+	Alias  *Alias        `xml:"alias,omitempty"`
+}
+
+type SerialSource struct {
+	Mode string `xml:"mode,attr,omitempty"`
+	Path string `xml:"path,attr,omitempty"`
+}
+
+type Parallel struct {
+	Type   string        `xml:"type,attr"`
+	Source *SerialSource `xml:"source,omitempty"`
 	Target *SerialTarget `xml:"target,omitempty"`
+	Alias  *Alias        `xml:"alias,omitempty"`
 }
 
 type SerialTarget struct {
@@ -317,6 +531,7 @@ type SerialTarget struct {
 type Console struct {
 	Type   string         `xml:"type,attr"`
 	Target *ConsoleTarget `xml:"target,omitempty"`
+	Alias  *Alias         `xml:"alias,omitempty"`
 }
 
 type ConsoleTarget struct {
@@ -340,6 +555,19 @@ type Interface struct {
 	LinkState *LinkState       `xml:"link,omitempty"`
 	FilterRef *FilterRef       `xml:"filterref,omitempty"`
 	Alias     *Alias           `xml:"alias,omitempty"`
+	Driver    *InterfaceDriver `xml:"driver,omitempty"`
+	ROM       *InterfaceROM    `xml:"rom,omitempty"`
+}
+
+type InterfaceROM struct {
+	BAR     string `xml:"bar,attr,omitempty"`
+	File    string `xml:"file,attr,omitempty"`
+	Enabled string `xml:"enabled,attr,omitempty"`
+}
+
+type InterfaceDriver struct {
+	Queues uint   `xml:"queues,attr,omitempty"`
+	IOMMU  string `xml:"iommu,attr,omitempty"`
 }
 
 type LinkState struct {
@@ -347,6 +575,14 @@ type LinkState struct {
 }
 
 type BandWidth struct {
+	Inbound  *BandWidthRate `xml:"inbound,omitempty"`
+	Outbound *BandWidthRate `xml:"outbound,omitempty"`
+}
+
+type BandWidthRate struct {
+	Average uint `xml:"average,attr"`
+	Peak    uint `xml:"peak,attr,omitempty"`
+	Burst   uint `xml:"burst,attr,omitempty"`
 }
 
 type BootOrder struct {
@@ -358,13 +594,22 @@ type MAC struct {
 }
 
 type FilterRef struct {
-	Filter string `xml:"filter,attr"`
+	Filter     string            `xml:"filter,attr"`
+	Parameters []FilterParameter `xml:"parameter"`
+}
+
+type FilterParameter struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
 }
 
 type InterfaceSource struct {
+	Type    string `xml:"type,attr,omitempty"`
 	Network string `xml:"network,attr,omitempty"`
 	Device  string `xml:"dev,attr,omitempty"`
 	Bridge  string `xml:"bridge,attr,omitempty"`
+	Path    string `xml:"path,attr,omitempty"`
+	Mode    string `xml:"mode,attr,omitempty"`
 }
 
 type Model struct {
@@ -388,6 +633,8 @@ type OS struct {
 	BootOrder  []Boot    `xml:"boot"`
 	BootMenu   *BootMenu `xml:"bootmenu,omitempty"`
 	BIOS       *BIOS     `xml:"bios,omitempty"`
+	Loader     *Loader   `xml:"loader,omitempty"`
+	NVRam      *NVRam    `xml:"nvram,omitempty"`
 	Kernel     string    `xml:"kernel,omitempty"`
 	Initrd     string    `xml:"initrd,omitempty"`
 	KernelArgs string    `xml:"cmdline,omitempty"`
@@ -417,12 +664,15 @@ type BootMenu struct {
 	Timeout *uint `xml:"timeout,attr,omitempty"`
 }
 
-// TODO <loader readonly='yes' secure='no' type='rom'>/usr/lib/xen/boot/hvmloader</loader>
+// TODO <bios useserial='yes' rebootTimeout='0'/>
 type BIOS struct {
 }
 
-// TODO <bios useserial='yes' rebootTimeout='0'/>
 type Loader struct {
+	ReadOnly string `xml:"readonly,attr,omitempty"`
+	Secure   string `xml:"secure,attr,omitempty"`
+	Type     string `xml:"type,attr,omitempty"`
+	Path     string `xml:",chardata"`
 }
 
 type SysInfo struct {
@@ -433,21 +683,81 @@ type SysInfo struct {
 }
 
 type Entry struct {
-	Name  string `xml:"name"`
+	Name  string `xml:"name,attr"`
 	Value string `xml:",chardata"`
 }
 
 //END OS --------------------
 
+//BEGIN Features --------------------
+
+type Features struct {
+	ACPI   *FeatureEnabled `xml:"acpi,omitempty"`
+	SMM    *FeatureState   `xml:"smm,omitempty"`
+	Hyperv *FeatureHyperv  `xml:"hyperv,omitempty"`
+}
+
+type FeatureEnabled struct {
+}
+
+type FeatureState struct {
+	State string `xml:"state,attr,omitempty"`
+}
+
+type FeatureHyperv struct {
+	Relaxed     *FeatureState     `xml:"relaxed,omitempty"`
+	VAPIC       *FeatureState     `xml:"vapic,omitempty"`
+	Spinlocks   *FeatureSpinlocks `xml:"spinlocks,omitempty"`
+	VPIndex     *FeatureState     `xml:"vpindex,omitempty"`
+	SyNIC       *FeatureState     `xml:"synic,omitempty"`
+	SyNICTimer  *FeatureState     `xml:"stimer,omitempty"`
+	Reset       *FeatureState     `xml:"reset,omitempty"`
+	VendorID    *FeatureVendorID  `xml:"vendor_id,omitempty"`
+	Frequencies *FeatureState     `xml:"frequencies,omitempty"`
+}
+
+type FeatureSpinlocks struct {
+	State   string  `xml:"state,attr,omitempty"`
+	Retries *uint32 `xml:"retries,attr,omitempty"`
+}
+
+type FeatureVendorID struct {
+	State string `xml:"state,attr,omitempty"`
+	Value string `xml:"value,attr,omitempty"`
+}
+
+//END Features --------------------
+
+//BEGIN Perf --------------------
+
+type Perf struct {
+	Events []PerfEvent `xml:"event"`
+}
+
+type PerfEvent struct {
+	Name    string `xml:"name,attr"`
+	Enabled string `xml:"enabled,attr"`
+}
+
+//END Perf --------------------
+
 //BEGIN Clock --------------------
 
 type Clock struct {
+	Offset     string  `xml:"offset,attr,omitempty"`
+	Timezone   string  `xml:"timezone,attr,omitempty"`
+	Adjustment *int64  `xml:"adjustment,attr,omitempty"`
+	Basis      string  `xml:"basis,attr,omitempty"`
+	Timer      []Timer `xml:"timer,omitempty"`
 }
 
 type Timer struct {
-	Name       string `xml:"name,attr"`
-	TickPolicy string `xml:"tickpolicy,attr,omitempty"`
-	Present    string `xml:"present,attr,omitempty"`
+	Name       string  `xml:"name,attr"`
+	TickPolicy string  `xml:"tickpolicy,attr,omitempty"`
+	Present    string  `xml:"present,attr,omitempty"`
+	Track      string  `xml:"track,attr,omitempty"`
+	Frequency  *uint64 `xml:"frequency,attr,omitempty"`
+	Mode       string  `xml:"mode,attr,omitempty"`
 }
 
 //END Clock --------------------
@@ -458,6 +768,7 @@ type Channel struct {
 	Type   string         `xml:"type,attr"`
 	Source ChannelSource  `xml:"source,omitempty"`
 	Target *ChannelTarget `xml:"target,omitempty"`
+	Alias  *Alias         `xml:"alias,omitempty"`
 }
 
 type ChannelTarget struct {
@@ -465,11 +776,14 @@ type ChannelTarget struct {
 	Type    string `xml:"type,attr"`
 	Address string `xml:"address,attr,omitempty"`
 	Port    uint   `xml:"port,attr,omitempty"`
+	// State is reported by libvirt for guest agent channels, it is
+	// connected while the agent in the guest listens on the channel
+	State string `xml:"state,attr,omitempty"`
 }
 
 type ChannelSource struct {
 	Mode string `xml:"mode,attr"`
-	Path string `xml:"path,attr"`
+	Path string `xml:"path,attr,omitempty"`
 }
 
 //END Channel --------------------
@@ -508,33 +822,103 @@ type Listen struct {
 }
 
 type Address struct {
-	Type     string `xml:"type,attr"`
-	Domain   string `xml:"domain,attr"`
-	Bus      string `xml:"bus,attr"`
-	Slot     string `xml:"slot,attr"`
-	Function string `xml:"function,attr"`
+	Type     string `xml:"type,attr" json:"type"`
+	Domain   string `xml:"domain,attr" json:"domain"`
+	Bus      string `xml:"bus,attr" json:"bus"`
+	Slot     string `xml:"slot,attr" json:"slot"`
+	Function string `xml:"function,attr" json:"function"`
+	UUID     string `xml:"uuid,attr,omitempty" json:"uuid,omitempty"`
 }
 
 //END Video -------------------
 
 type Ballooning struct {
-	Model string `xml:"model,attr"`
+	Model  string        `xml:"model,attr"`
+	Driver *DeviceDriver `xml:"driver,omitempty"`
+}
+
+// DeviceDriver holds the driver options of virtio devices which have no
+// driver options of their own.
+type DeviceDriver struct {
+	IOMMU string `xml:"iommu,attr,omitempty"`
+}
+
+type Watchdog struct {
+	Model  string `xml:"model,attr"`
+	Action string `xml:"action,attr,omitempty"`
+}
+
+// Panic is a pvpanic device, through which the guest reports kernel panics.
+type Panic struct {
+	Model string `xml:"model,attr,omitempty"`
 }
 
 type RandomGenerator struct {
+	Model   string        `xml:"model,attr"`
+	Rate    *RngRate      `xml:"rate,omitempty"`
+	Backend RngBackend    `xml:"backend"`
+	Driver  *DeviceDriver `xml:"driver,omitempty"`
+}
+
+type RngRate struct {
+	Bytes  uint `xml:"bytes,attr"`
+	Period uint `xml:"period,attr,omitempty"`
+}
+
+type RngBackend struct {
+	Model  string `xml:"model,attr"`
+	Source string `xml:",chardata"`
+}
+
+type TPM struct {
+	Model   string     `xml:"model,attr,omitempty"`
+	Backend TPMBackend `xml:"backend"`
+}
+
+type TPMBackend struct {
+	Type       string         `xml:"type,attr"`
+	Version    string         `xml:"version,attr,omitempty"`
+	Encryption *TPMEncryption `xml:"encryption,omitempty"`
+}
+
+type TPMEncryption struct {
+	Secret string `xml:"secret,attr"`
+}
+
+type Sound struct {
+	Model   string   `xml:"model,attr"`
+	Address *Address `xml:"address,omitempty"`
+	Alias   *Alias   `xml:"alias,omitempty"`
+}
+
+type Input struct {
+	Type    string   `xml:"type,attr"`
+	Bus     string   `xml:"bus,attr,omitempty"`
+	Address *Address `xml:"address,omitempty"`
+	Alias   *Alias   `xml:"alias,omitempty"`
+}
+
+type RedirDev struct {
+	Bus     string   `xml:"bus,attr"`
+	Type    string   `xml:"type,attr"`
+	Address *Address `xml:"address,omitempty"`
+	Alias   *Alias   `xml:"alias,omitempty"`
 }
 
-// TODO ballooning, rng, cpu ...
+// TODO ballooning, cpu ...
 
 type SecretUsage struct {
 	Type   string `xml:"type,attr"`
 	Target string `xml:"target,omitempty"`
+	Name   string `xml:"name,omitempty"`
+	Volume string `xml:"volume,omitempty"`
 }
 
 type SecretSpec struct {
 	XMLName     xml.Name    `xml:"secret"`
 	Ephemeral   string      `xml:"ephemeral,attr"`
 	Private     string      `xml:"private,attr"`
+	UUID        string      `xml:"uuid,omitempty"`
 	Description string      `xml:"description,omitempty"`
 	Usage       SecretUsage `xml:"usage,omitempty"`
 }
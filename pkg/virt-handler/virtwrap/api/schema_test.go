@@ -70,8 +70,8 @@ var _ = Describe("Schema", func() {
 			Driver: &DiskDriver{Name: "qemu",
 				Type: "raw"},
 			Source: DiskSource{Protocol: "iscsi",
-				Name: "iqn.2013-07.com.example:iscsi-nopool/2",
-				Host: &DiskSourceHost{Name: "example.com", Port: "3260"}},
+				Name:  "iqn.2013-07.com.example:iscsi-nopool/2",
+				Hosts: []DiskSourceHost{{Name: "example.com", Port: "3260"}}},
 			Target: DiskTarget{Device: "vda"},
 		},
 	}
@@ -154,6 +154,131 @@ var _ = Describe("Schema", func() {
 			Expect(convertedDomainSpec).To(Equal(*v1DomainSpec))
 			Expect(errs).To(BeEmpty())
 		})
+		It("converts network disks with multiple hosts", func() {
+			v1Disk := v1.Disk{
+				Type:   "network",
+				Device: "disk",
+				Source: v1.DiskSource{
+					Protocol: "rbd",
+					Name:     "rbd/testimage",
+					Host:     &v1.DiskSourceHost{Name: "10.0.0.1", Port: "6789"},
+					Hosts:    []v1.DiskSourceHost{{Name: "10.0.0.2", Port: "6789"}},
+				},
+				Target: v1.DiskTarget{Device: "vdb"},
+			}
+			disk := Disk{}
+			Expect(model.Copy(&disk, v1Disk)).To(BeEmpty())
+			Expect(disk.Source.Hosts).To(Equal([]DiskSourceHost{
+				{Name: "10.0.0.1", Port: "6789"},
+				{Name: "10.0.0.2", Port: "6789"},
+			}))
+
+			convertedDisk := v1.Disk{}
+			Expect(model.Copy(&convertedDisk, disk)).To(BeEmpty())
+			Expect(convertedDisk.Source).To(Equal(v1Disk.Source))
+		})
+		It("converts the iSCSI initiator", func() {
+			v1Disk := v1.Disk{
+				Type:   "network",
+				Device: "disk",
+				Source: v1.DiskSource{
+					Protocol:  "iscsi",
+					Name:      "iqn.2013-07.com.example:iscsi-nopool/2",
+					Host:      &v1.DiskSourceHost{Name: "10.0.0.1", Port: "3260"},
+					Initiator: &v1.DiskSourceInitiator{IQN: "iqn.2017-10.io.kubevirt:node01"},
+				},
+				Target: v1.DiskTarget{Device: "vdb"},
+			}
+			disk := Disk{}
+			Expect(model.Copy(&disk, v1Disk)).To(BeEmpty())
+
+			buf, err := xml.Marshal(&disk)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(buf)).To(ContainSubstring(`<initiator><iqn name="iqn.2017-10.io.kubevirt:node01"></iqn></initiator>`))
+
+			convertedDisk := v1.Disk{}
+			Expect(model.Copy(&convertedDisk, disk)).To(BeEmpty())
+			Expect(convertedDisk.Source).To(Equal(v1Disk.Source))
+		})
+		It("converts LUKS encrypted disks", func() {
+			v1Disk := v1.Disk{
+				Type:   "file",
+				Device: "disk",
+				Source: v1.DiskSource{File: "/var/run/kubevirt/disk.luks"},
+				Target: v1.DiskTarget{Device: "vdb"},
+				Encryption: &v1.DiskEncryption{
+					Format: "luks",
+					Secret: &v1.DiskSecret{Type: "passphrase", Usage: "diskkey-default-testvm---"},
+				},
+			}
+			disk := Disk{}
+			errs := model.Copy(&disk, v1Disk)
+			Expect(errs).To(BeEmpty())
+
+			buf, err := xml.Marshal(&disk)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(buf)).To(ContainSubstring(`<encryption format="luks"><secret type="passphrase" usage="diskkey-default-testvm---"></secret></encryption>`))
+		})
+		It("converts desktop devices", func() {
+			v1Devices := v1.Devices{
+				Controllers: []v1.Controller{{Type: "usb", Index: "0", Model: "qemu-xhci"}},
+				Sounds:      []v1.Sound{{Model: "ich9"}},
+				Inputs:      []v1.Input{{Type: "tablet", Bus: "usb"}},
+				Redirects:   []v1.RedirDev{{Bus: "usb", Type: "spicevmc"}},
+			}
+			devices := Devices{}
+			Expect(model.Copy(&devices, v1Devices)).To(BeEmpty())
+
+			buf, err := xml.Marshal(&devices)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(buf)).To(ContainSubstring(`<controller type="usb" index="0" model="qemu-xhci"></controller>`))
+			Expect(string(buf)).To(ContainSubstring(`<sound model="ich9"></sound>`))
+			Expect(string(buf)).To(ContainSubstring(`<input type="tablet" bus="usb"></input>`))
+			Expect(string(buf)).To(ContainSubstring(`<redirdev bus="usb" type="spicevmc"></redirdev>`))
+		})
+		It("converts host device addresses", func() {
+			v1Devices := v1.Devices{
+				HostDevices: []v1.HostDevice{
+					{
+						Mode:    "subsystem",
+						Type:    "pci",
+						Source:  v1.HostDeviceSource{Address: &v1.Address{Domain: "0x0000", Bus: "0x06", Slot: "0x02", Function: "0x0"}},
+						Address: &v1.Address{Type: "pci", Domain: "0x0000", Bus: "0x00", Slot: "0x05", Function: "0x0"},
+					},
+					{
+						Mode:   "subsystem",
+						Type:   "mdev",
+						Model:  "vfio-pci",
+						Source: v1.HostDeviceSource{MdevParent: "0000:06:00.0", MdevType: "nvidia-35"},
+					},
+				},
+			}
+			devices := Devices{}
+			Expect(model.Copy(&devices, v1Devices)).To(BeEmpty())
+			Expect(devices.HostDevices[1].Source.MdevType).To(Equal("nvidia-35"))
+			devices.HostDevices[1].Source.Address = &Address{UUID: "4b20d080-1b54-4048-85b3-a6a62d165c01"}
+
+			buf, err := xml.Marshal(&devices)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(buf)).To(ContainSubstring(`<source><address type="" domain="0x0000" bus="0x06" slot="0x02" function="0x0"></address></source><address type="pci" domain="0x0000" bus="0x00" slot="0x05" function="0x0"></address>`))
+			Expect(string(buf)).To(ContainSubstring(`<hostdev mode="subsystem" type="mdev" model="vfio-pci"><source><address type="" domain="" bus="" slot="" function="" uuid="4b20d080-1b54-4048-85b3-a6a62d165c01"></address></source></hostdev>`))
+			Expect(string(buf)).ToNot(ContainSubstring("nvidia-35"))
+		})
+		It("converts vhost-user interfaces", func() {
+			v1Iface := v1.Interface{
+				Type:   "vhostuser",
+				Source: v1.InterfaceSource{Path: "/var/run/openvswitch/vhu0", Mode: "server"},
+				Driver: &v1.InterfaceDriver{Queues: 4},
+			}
+			iface := Interface{}
+			Expect(model.Copy(&iface, v1Iface)).To(BeEmpty())
+			iface.Source.Type = "unix"
+
+			buf, err := xml.Marshal(&iface)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(buf)).To(ContainSubstring(`<source type="unix" path="/var/run/openvswitch/vhu0" mode="server"></source>`))
+			Expect(string(buf)).To(ContainSubstring(`<driver queues="4"></driver>`))
+		})
 	})
 })
 
@@ -0,0 +1,184 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package virtwrap
+
+import (
+	"fmt"
+	"runtime"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+)
+
+// archDefaults describes what a guest of an architecture looks like, where
+// it differs from the x86 assumptions of the domain spec.
+type archDefaults struct {
+	// Machine is the default machine type, empty means the libvirt default
+	Machine string
+	// ConsoleTarget is the target type of consoles, empty means serial
+	ConsoleTarget string
+	// PanicModel is the device through which guests report panics
+	PanicModel string
+	// UEFICode and UEFIVars point to the UEFI firmware, empty if the
+	// architecture has none. UEFISecureBootCode is empty if the architecture
+	// has no Secure Boot firmware.
+	UEFICode           string
+	UEFISecureBootCode string
+	UEFIVars           string
+	// UEFIRequired tells whether guests can only boot through UEFI
+	UEFIRequired bool
+	// SMM tells whether Secure Boot has to be protected by SMM
+	SMM bool
+	// DiskBus and CDROMBus are the buses of disks which don't ask for one,
+	// empty means the libvirt default
+	DiskBus  string
+	CDROMBus string
+	// UnsupportedDiskBuses are disk buses the machine types don't provide
+	UnsupportedDiskBuses []string
+}
+
+var archs = map[string]archDefaults{
+	"x86_64": {
+		PanicModel:         "isa",
+		UEFICode:           ovmfCode,
+		UEFISecureBootCode: ovmfSecureBootCode,
+		UEFIVars:           ovmfVarsTemplate,
+		SMM:                true,
+	},
+	"aarch64": {
+		Machine:              "virt",
+		PanicModel:           "pvpanic",
+		UEFICode:             aavmfCode,
+		UEFIVars:             aavmfVarsTemplate,
+		UEFIRequired:         true,
+		DiskBus:              "virtio",
+		CDROMBus:             "scsi",
+		UnsupportedDiskBuses: []string{"ide", "fdc"},
+	},
+	"s390x": {
+		Machine:              "s390-ccw-virtio",
+		ConsoleTarget:        "sclp",
+		PanicModel:           "s390",
+		DiskBus:              "virtio",
+		CDROMBus:             "scsi",
+		UnsupportedDiskBuses: []string{"ide", "sata", "fdc", "usb"},
+	},
+}
+
+// goArchs maps the Go architecture names to the libvirt ones.
+var goArchs = map[string]string{
+	"amd64": "x86_64",
+	"arm64": "aarch64",
+	"s390x": "s390x",
+}
+
+// hostArch is the architecture guests get if they don't ask for one. It can
+// be overridden in tests.
+var hostArch = goArchs[runtime.GOARCH]
+
+// defaultsForArch returns the defaults of the given architecture and falls
+// back to x86_64 for unknown ones.
+func defaultsForArch(arch string) archDefaults {
+	if defaults, exists := archs[arch]; exists {
+		return defaults
+	}
+	return archs["x86_64"]
+}
+
+// prepareArchitecture fills in the architecture and machine type of the
+// domain and adapts the devices to the architecture. Explicitly requested
+// architectures and machine types are checked against the host capabilities.
+func (l *LibvirtDomainManager) prepareArchitecture(vm *v1.VirtualMachine, spec *api.DomainSpec) error {
+	requested := spec.OS.Type.Arch != "" && spec.OS.Type.Arch != hostArch || spec.OS.Type.Machine != ""
+	if spec.OS.Type.Arch == "" {
+		spec.OS.Type.Arch = hostArch
+	}
+	arch := spec.OS.Type.Arch
+	if arch == "" {
+		// Unknown host architecture, leave it to libvirt
+		return nil
+	}
+	defaults, exists := archs[arch]
+	if !exists {
+		return fmt.Errorf("unsupported guest architecture '%s'", arch)
+	}
+
+	if requested {
+		caps, err := l.getCapabilities()
+		if err != nil {
+			return err
+		}
+		if err := validateArchitecture(spec, caps); err != nil {
+			return err
+		}
+	}
+	if spec.OS.Type.Machine == "" {
+		spec.OS.Type.Machine = defaults.Machine
+	}
+
+	for i := range spec.Devices.Disks {
+		disk := &spec.Devices.Disks[i]
+		if disk.Target.Bus == "" {
+			if disk.Device == "cdrom" {
+				disk.Target.Bus = defaults.CDROMBus
+			} else {
+				disk.Target.Bus = defaults.DiskBus
+			}
+		}
+		for _, bus := range defaults.UnsupportedDiskBuses {
+			if disk.Target.Bus == bus {
+				return fmt.Errorf("disk %s: bus %s is not supported on %s", disk.Target.Device, bus, arch)
+			}
+		}
+	}
+	if defaults.ConsoleTarget != "" {
+		for i := range spec.Devices.Consoles {
+			console := &spec.Devices.Consoles[i]
+			if console.Target == nil {
+				console.Target = &api.ConsoleTarget{}
+			}
+			if console.Target.Type == nil {
+				targetType := defaults.ConsoleTarget
+				console.Target.Type = &targetType
+			}
+		}
+	}
+	return nil
+}
+
+// validateArchitecture checks that the host can run guests of the architecture
+// and machine type of the domain.
+func validateArchitecture(spec *api.DomainSpec, caps *api.Capabilities) error {
+	arch := spec.OS.Type.Arch
+	for _, guest := range caps.Guests {
+		if guest.OSType != spec.OS.Type.OS || guest.Arch.Name != arch {
+			continue
+		}
+		if spec.OS.Type.Machine == "" {
+			return nil
+		}
+		for _, machine := range guest.Arch.Machines {
+			if machine.Name == spec.OS.Type.Machine || machine.Canonical == spec.OS.Type.Machine {
+				return nil
+			}
+		}
+		return fmt.Errorf("machine type '%s' is not supported for %s guests", spec.OS.Type.Machine, arch)
+	}
+	return fmt.Errorf("the host can't run %s guests", arch)
+}
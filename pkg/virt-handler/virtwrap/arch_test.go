@@ -0,0 +1,130 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package virtwrap
+
+import (
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+)
+
+var guestCapabilitiesXML = `<capabilities>
+  <host>
+    <cpu>
+      <arch>x86_64</arch>
+    </cpu>
+  </host>
+  <guest>
+    <os_type>hvm</os_type>
+    <arch name="x86_64">
+      <machine maxCpus="255">pc-i440fx-2.10</machine>
+      <machine canonical="pc-i440fx-2.10" maxCpus="255">pc</machine>
+      <machine maxCpus="288">pc-q35-2.10</machine>
+      <machine canonical="pc-q35-2.10" maxCpus="288">q35</machine>
+    </arch>
+  </guest>
+  <guest>
+    <os_type>hvm</os_type>
+    <arch name="aarch64">
+      <machine maxCpus="255">virt-2.10</machine>
+      <machine canonical="virt-2.10" maxCpus="255">virt</machine>
+    </arch>
+  </guest>
+</capabilities>`
+
+var _ = Describe("Architecture", func() {
+	var ctrl *gomock.Controller
+	var mockConn *cli.MockConnection
+	var manager *LibvirtDomainManager
+	var spec *api.DomainSpec
+	var originalHostArch string
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockConn = cli.NewMockConnection(ctrl)
+		manager = &LibvirtDomainManager{virConn: mockConn}
+		spec = api.NewMinimalDomainSpec("testvm")
+		originalHostArch = hostArch
+		hostArch = "x86_64"
+	})
+
+	It("should default to the host architecture without asking libvirt", func() {
+		Expect(manager.prepareArchitecture(newVM("default", "testvm"), spec)).To(Succeed())
+		Expect(spec.OS.Type.Arch).To(Equal("x86_64"))
+		Expect(spec.OS.Type.Machine).To(BeEmpty())
+	})
+
+	It("should use the machine type and console target of s390x hosts", func() {
+		hostArch = "s390x"
+		spec.Devices.Consoles = []api.Console{{Type: "pty"}}
+		Expect(manager.prepareArchitecture(newVM("default", "testvm"), spec)).To(Succeed())
+		Expect(spec.OS.Type.Machine).To(Equal("s390-ccw-virtio"))
+		Expect(*spec.Devices.Consoles[0].Target.Type).To(Equal("sclp"))
+	})
+
+	It("should default the disk buses of s390x guests", func() {
+		hostArch = "s390x"
+		spec.Devices.Disks = []api.Disk{
+			{Device: "disk", Target: api.DiskTarget{Device: "vda"}},
+			{Device: "cdrom", Target: api.DiskTarget{Device: "sda"}},
+		}
+		Expect(manager.prepareArchitecture(newVM("default", "testvm"), spec)).To(Succeed())
+		Expect(spec.Devices.Disks[0].Target.Bus).To(Equal("virtio"))
+		Expect(spec.Devices.Disks[1].Target.Bus).To(Equal("scsi"))
+	})
+
+	It("should reject disk buses the architecture does not provide", func() {
+		hostArch = "s390x"
+		spec.Devices.Disks = []api.Disk{{Target: api.DiskTarget{Bus: "ide", Device: "hda"}}}
+		Expect(manager.prepareArchitecture(newVM("default", "testvm"), spec)).ToNot(Succeed())
+	})
+
+	It("should accept machine type aliases which the host provides", func() {
+		spec.OS.Type.Machine = "q35"
+		mockConn.EXPECT().GetCapabilities().Return(guestCapabilitiesXML, nil)
+		Expect(manager.prepareArchitecture(newVM("default", "testvm"), spec)).To(Succeed())
+	})
+
+	It("should default the machine type of foreign architectures", func() {
+		spec.OS.Type.Arch = "aarch64"
+		mockConn.EXPECT().GetCapabilities().Return(guestCapabilitiesXML, nil)
+		Expect(manager.prepareArchitecture(newVM("default", "testvm"), spec)).To(Succeed())
+		Expect(spec.OS.Type.Machine).To(Equal("virt"))
+	})
+
+	It("should reject machine types the host does not provide", func() {
+		spec.OS.Type.Machine = "s390-ccw-virtio"
+		mockConn.EXPECT().GetCapabilities().Return(guestCapabilitiesXML, nil)
+		Expect(manager.prepareArchitecture(newVM("default", "testvm"), spec)).ToNot(Succeed())
+	})
+
+	It("should reject architectures the host can't run", func() {
+		spec.OS.Type.Arch = "s390x"
+		mockConn.EXPECT().GetCapabilities().Return(guestCapabilitiesXML, nil)
+		Expect(manager.prepareArchitecture(newVM("default", "testvm"), spec)).ToNot(Succeed())
+	})
+
+	AfterEach(func() {
+		hostArch = originalHostArch
+		ctrl.Finish()
+	})
+})
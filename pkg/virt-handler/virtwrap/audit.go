@@ -0,0 +1,173 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package virtwrap
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cache"
+)
+
+// Operations which change a domain are recorded, so that it can be told
+// afterwards what happened to a domain, e.g. who destroyed it. The trail of
+// a domain is kept after the domain is gone, only the oldest entries and
+// the trails of the least recently changed domains are dropped.
+var (
+	auditTrailSize    = 64
+	auditTrailDomains = 1024
+)
+
+// With dumpAuditTrailOnFailure set, the trail of a domain is logged when an
+// operation on it fails.
+var dumpAuditTrailOnFailure = false
+
+// SetDumpAuditTrailOnFailure enables or disables logging the audit trail of
+// a domain when an operation on it fails.
+func SetDumpAuditTrailOnFailure(dump bool) {
+	dumpAuditTrailOnFailure = dump
+}
+
+// Trigger tells what made virt-handler change a domain, e.g. the VM
+// controller or a libvirt event.
+type Trigger string
+
+const (
+	TriggerVMController     Trigger = "vm-controller"
+	TriggerDomainController Trigger = "domain-controller"
+	TriggerLibvirtEvent     Trigger = "libvirt-event"
+	TriggerStartup          Trigger = "startup"
+	TriggerDrain            Trigger = "node-drain"
+	TriggerFSTrimScheduler  Trigger = "fstrim-scheduler"
+)
+
+// AuditEntry describes an operation on a domain.
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	Operation string    `json:"operation"`
+	Trigger   Trigger   `json:"trigger"`
+	// ParamsHash identifies the parameters of the operation, e.g. the
+	// domain XML which was defined
+	ParamsHash string `json:"paramsHash,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+type domainAuditTrail struct {
+	entries []AuditEntry
+	// position of the domain in the order of the trails
+	element *list.Element
+}
+
+// auditTrail keeps the last entries of every domain. The zero value is
+// ready to use.
+type auditTrail struct {
+	lock   sync.Mutex
+	trails map[string]*domainAuditTrail
+	// names of the domains, the least recently changed first
+	order *list.List
+}
+
+func (a *auditTrail) record(name string, entry AuditEntry) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.trails == nil {
+		a.trails = make(map[string]*domainAuditTrail)
+		a.order = list.New()
+	}
+
+	trail, exists := a.trails[name]
+	if exists {
+		a.order.MoveToBack(trail.element)
+	} else {
+		trail = &domainAuditTrail{element: a.order.PushBack(name)}
+		a.trails[name] = trail
+		if a.order.Len() > auditTrailDomains {
+			delete(a.trails, a.order.Remove(a.order.Front()).(string))
+		}
+	}
+
+	trail.entries = append(trail.entries, entry)
+	if len(trail.entries) > auditTrailSize {
+		trail.entries = trail.entries[len(trail.entries)-auditTrailSize:]
+	}
+}
+
+// get returns a copy of the entries of the domain, the oldest first.
+func (a *auditTrail) get(name string) []AuditEntry {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	trail, exists := a.trails[name]
+	if !exists {
+		return []AuditEntry{}
+	}
+	return append([]AuditEntry{}, trail.entries...)
+}
+
+func paramsHash(params interface{}) string {
+	if params == nil {
+		return ""
+	}
+	var content []byte
+	switch p := params.(type) {
+	case []byte:
+		content = p
+	case string:
+		content = []byte(p)
+	default:
+		var err error
+		if content, err = json.Marshal(p); err != nil {
+			return ""
+		}
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(content))[:16]
+}
+
+// audit records an operation on the domain of the VM, what triggered it and
+// its result.
+func (l *LibvirtDomainManager) audit(vm *v1.VirtualMachine, trigger Trigger, operation string, params interface{}, err error) {
+	entry := AuditEntry{
+		Time:       time.Now().UTC(),
+		Operation:  operation,
+		Trigger:    trigger,
+		ParamsHash: paramsHash(params),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	name := cache.VMNamespaceKeyFunc(vm)
+	l.auditTrail.record(name, entry)
+
+	if err != nil && dumpAuditTrailOnFailure {
+		for _, e := range l.auditTrail.get(name) {
+			logging.DefaultLogger().Object(vm).Error().With("time", e.Time, "trigger", e.Trigger, "params", e.ParamsHash, "error", e.Error).Msgf("Audit: %s", e.Operation)
+		}
+	}
+}
+
+// GetAuditTrail returns the last operations on the domain of the VM, the
+// oldest first.
+func (l *LibvirtDomainManager) GetAuditTrail(vm *v1.VirtualMachine) []AuditEntry {
+	return l.auditTrail.get(cache.VMNamespaceKeyFunc(vm))
+}
@@ -0,0 +1,83 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package virtwrap
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Audit trail", func() {
+	var manager *LibvirtDomainManager
+	var originalTrailSize int
+	var originalTrailDomains int
+
+	BeforeEach(func() {
+		manager = &LibvirtDomainManager{}
+		originalTrailSize = auditTrailSize
+		originalTrailDomains = auditTrailDomains
+	})
+
+	It("should record operations with their trigger and result", func() {
+		vm := newVM("default", "testvm")
+		manager.audit(vm, TriggerVMController, "define", []byte("<domain/>"), nil)
+		manager.audit(vm, TriggerDrain, "destroy", nil, fmt.Errorf("domain is not running"))
+
+		entries := manager.GetAuditTrail(vm)
+		Expect(entries).To(HaveLen(2))
+		Expect(entries[0].Operation).To(Equal("define"))
+		Expect(entries[0].ParamsHash).To(Equal(paramsHash("<domain/>")))
+		Expect(entries[0].Error).To(BeEmpty())
+		Expect(entries[0].Trigger).To(Equal(TriggerVMController))
+		Expect(entries[1].Trigger).To(Equal(TriggerDrain))
+		Expect(entries[1].ParamsHash).To(BeEmpty())
+		Expect(entries[1].Error).To(Equal("domain is not running"))
+		Expect(manager.GetAuditTrail(newVM("default", "othervm"))).To(BeEmpty())
+	})
+
+	It("should only keep the last entries", func() {
+		auditTrailSize = 2
+		vm := newVM("default", "testvm")
+		for _, operation := range []string{"define", "create", "destroy"} {
+			manager.audit(vm, TriggerVMController, operation, nil, nil)
+		}
+		entries := manager.GetAuditTrail(vm)
+		Expect(entries).To(HaveLen(2))
+		Expect(entries[0].Operation).To(Equal("create"))
+	})
+
+	It("should drop the trails of the least recently changed domains", func() {
+		auditTrailDomains = 2
+		manager.audit(newVM("default", "vm1"), TriggerVMController, "define", nil, nil)
+		manager.audit(newVM("default", "vm2"), TriggerVMController, "define", nil, nil)
+		manager.audit(newVM("default", "vm1"), TriggerVMController, "create", nil, nil)
+		manager.audit(newVM("default", "vm3"), TriggerVMController, "define", nil, nil)
+
+		Expect(manager.GetAuditTrail(newVM("default", "vm1"))).To(HaveLen(2))
+		Expect(manager.GetAuditTrail(newVM("default", "vm2"))).To(BeEmpty())
+		Expect(manager.GetAuditTrail(newVM("default", "vm3"))).To(HaveLen(1))
+	})
+
+	AfterEach(func() {
+		auditTrailSize = originalTrailSize
+		auditTrailDomains = originalTrailDomains
+	})
+})
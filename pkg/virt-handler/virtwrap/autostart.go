@@ -0,0 +1,41 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+)
+
+// disableAutostart makes sure that libvirt does not start the domain on its
+// own when the node boots. Starting domains is up to virt-handler, which
+// would otherwise race libvirtd for VMs which moved to other nodes meanwhile.
+func (l *LibvirtDomainManager) disableAutostart(vm *v1.VirtualMachine, dom cli.VirDomain, trigger Trigger) error {
+	autostart, err := dom.GetAutostart()
+	if err != nil {
+		return err
+	}
+	if !autostart {
+		return nil
+	}
+	err = dom.SetAutostart(false)
+	l.audit(vm, trigger, "disable-autostart", nil, err)
+	return err
+}
@@ -0,0 +1,137 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"encoding/xml"
+	"fmt"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+// syncInterfaceBandwidth applies changed bandwidth limits to the interfaces
+// of a running domain. Only interfaces with a bandwidth section are managed,
+// an empty section removes all limits. It returns whether any limit was
+// changed.
+func (l *LibvirtDomainManager) syncInterfaceBandwidth(vm *v1.VirtualMachine, dom cli.VirDomain, spec *api.DomainSpec) (bool, error) {
+	changed := false
+	var running *api.DomainSpec
+	for i, iface := range spec.Devices.Interfaces {
+		if iface.BandWidth == nil {
+			continue
+		}
+		if running == nil {
+			var err error
+			if running, err = getRunningSpec(dom); err != nil {
+				return changed, err
+			}
+		}
+		device, err := interfaceDevice(running, i)
+		if err != nil {
+			return changed, err
+		}
+
+		current, err := dom.GetInterfaceParameters(device, libvirt.DOMAIN_AFFECT_LIVE)
+		if err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msgf("Getting the bandwidth of interface %s failed.", device)
+			return changed, err
+		}
+
+		wanted := newInterfaceParameters(iface.BandWidth)
+		if interfaceParametersEqual(current, wanted) {
+			continue
+		}
+		err = dom.SetInterfaceParameters(device, wanted, libvirt.DOMAIN_AFFECT_LIVE)
+		l.audit(vm, TriggerVMController, "set-interface-parameters", map[string]interface{}{"interface": device, "bandwidth": iface.BandWidth}, err)
+		if err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msgf("Setting the bandwidth of interface %s failed.", device)
+			return changed, err
+		}
+		changed = true
+		logging.DefaultLogger().Object(vm).Info().Msgf("Bandwidth of interface %s updated.", device)
+	}
+	return changed, nil
+}
+
+func getRunningSpec(dom cli.VirDomain) (*api.DomainSpec, error) {
+	xmlstr, err := dom.GetXMLDesc(0)
+	if err != nil {
+		return nil, err
+	}
+	var spec api.DomainSpec
+	if err := xml.Unmarshal([]byte(xmlstr), &spec); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+// interfaceDevice returns the name of the host side device of the n-th
+// interface, which libvirt accepts as an interface identifier.
+func interfaceDevice(running *api.DomainSpec, n int) (string, error) {
+	if n >= len(running.Devices.Interfaces) {
+		return "", fmt.Errorf("interface %d does not exist in the running domain", n)
+	}
+	iface := running.Devices.Interfaces[n]
+	if iface.Target != nil && iface.Target.Device != "" {
+		return iface.Target.Device, nil
+	}
+	if iface.MAC != nil && iface.MAC.MAC != "" {
+		return iface.MAC.MAC, nil
+	}
+	return "", fmt.Errorf("interface %d of the running domain has neither a target device nor a MAC address", n)
+}
+
+func newInterfaceParameters(bandwidth *api.BandWidth) *libvirt.DomainInterfaceParameters {
+	inbound := bandwidth.Inbound
+	if inbound == nil {
+		inbound = &api.BandWidthRate{}
+	}
+	outbound := bandwidth.Outbound
+	if outbound == nil {
+		outbound = &api.BandWidthRate{}
+	}
+	return &libvirt.DomainInterfaceParameters{
+		BandwidthInAverageSet:  true,
+		BandwidthInAverage:     inbound.Average,
+		BandwidthInPeakSet:     true,
+		BandwidthInPeak:        inbound.Peak,
+		BandwidthInBurstSet:    true,
+		BandwidthInBurst:       inbound.Burst,
+		BandwidthOutAverageSet: true,
+		BandwidthOutAverage:    outbound.Average,
+		BandwidthOutPeakSet:    true,
+		BandwidthOutPeak:       outbound.Peak,
+		BandwidthOutBurstSet:   true,
+		BandwidthOutBurst:      outbound.Burst,
+	}
+}
+
+func interfaceParametersEqual(current *libvirt.DomainInterfaceParameters, wanted *libvirt.DomainInterfaceParameters) bool {
+	return current.BandwidthInAverage == wanted.BandwidthInAverage &&
+		current.BandwidthInPeak == wanted.BandwidthInPeak &&
+		current.BandwidthInBurst == wanted.BandwidthInBurst &&
+		current.BandwidthOutAverage == wanted.BandwidthOutAverage &&
+		current.BandwidthOutPeak == wanted.BandwidthOutPeak &&
+		current.BandwidthOutBurst == wanted.BandwidthOutBurst
+}
@@ -0,0 +1,75 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Interface bandwidth", func() {
+	var ctrl *gomock.Controller
+	var mockDomain *cli.MockVirDomain
+	var manager *LibvirtDomainManager
+	var spec *api.DomainSpec
+
+	runningXML := `<domain><devices><interface type="network"><source network="default"/><target dev="vnet0"/></interface></devices></domain>`
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockDomain = cli.NewMockVirDomain(ctrl)
+		manager = &LibvirtDomainManager{}
+		spec = api.NewMinimalDomainSpec("testvm")
+	})
+
+	It("should ignore interfaces without bandwidth limits", func() {
+		Expect(manager.syncInterfaceBandwidth(newVM("default", "testvm"), mockDomain, spec)).To(BeFalse())
+	})
+
+	It("should apply changed limits to the running domain", func() {
+		spec.Devices.Interfaces[0].BandWidth = &api.BandWidth{
+			Inbound: &api.BandWidthRate{Average: 1000, Peak: 5000, Burst: 1024},
+		}
+		mockDomain.EXPECT().GetXMLDesc(libvirt.DomainXMLFlags(0)).Return(runningXML, nil)
+		mockDomain.EXPECT().GetInterfaceParameters("vnet0", libvirt.DOMAIN_AFFECT_LIVE).Return(&libvirt.DomainInterfaceParameters{}, nil)
+		mockDomain.EXPECT().SetInterfaceParameters("vnet0", newInterfaceParameters(spec.Devices.Interfaces[0].BandWidth), libvirt.DOMAIN_AFFECT_LIVE).Return(nil)
+
+		Expect(manager.syncInterfaceBandwidth(newVM("default", "testvm"), mockDomain, spec)).To(BeTrue())
+	})
+
+	It("should leave matching limits alone", func() {
+		spec.Devices.Interfaces[0].BandWidth = &api.BandWidth{
+			Outbound: &api.BandWidthRate{Average: 128},
+		}
+		mockDomain.EXPECT().GetXMLDesc(libvirt.DomainXMLFlags(0)).Return(runningXML, nil)
+		mockDomain.EXPECT().GetInterfaceParameters("vnet0", libvirt.DOMAIN_AFFECT_LIVE).Return(&libvirt.DomainInterfaceParameters{BandwidthOutAverage: 128}, nil)
+
+		Expect(manager.syncInterfaceBandwidth(newVM("default", "testvm"), mockDomain, spec)).To(BeFalse())
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+})
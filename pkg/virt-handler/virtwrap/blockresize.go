@@ -0,0 +1,71 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+// syncDiskCapacities lets qemu know about raw disks, which grew on the host
+// since they were attached, e.g. because the backing PVC was expanded. The
+// guest sees the new capacity without a reboot. It returns whether a disk
+// was resized.
+func (l *LibvirtDomainManager) syncDiskCapacities(vm *v1.VirtualMachine, dom cli.VirDomain, spec *api.DomainSpec) (bool, error) {
+	changed := false
+	for _, disk := range spec.Devices.Disks {
+		if !isResizable(disk) {
+			continue
+		}
+		target := disk.Target.Device
+		info, err := dom.GetBlockInfo(target, 0)
+		if err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msgf("Getting the block info of disk %s failed.", target)
+			return changed, err
+		}
+		if info.Physical <= info.Capacity {
+			continue
+		}
+		err = dom.BlockResize(target, info.Physical, libvirt.DOMAIN_BLOCK_RESIZE_BYTES)
+		l.audit(vm, TriggerVMController, "block-resize", map[string]interface{}{"disk": target, "size": info.Physical}, err)
+		if err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msgf("Resizing disk %s failed.", target)
+			return changed, err
+		}
+		changed = true
+		logging.DefaultLogger().Object(vm).Info().Msgf("Disk %s resized from %d to %d bytes.", target, info.Capacity, info.Physical)
+	}
+	return changed, nil
+}
+
+// Only for raw file and block disks the size on the host is the size seen
+// by the guest.
+func isResizable(disk api.Disk) bool {
+	if disk.Device != "disk" || disk.ReadOnly != nil {
+		return false
+	}
+	if disk.Type != "file" && disk.Type != "block" {
+		return false
+	}
+	return disk.Driver != nil && disk.Driver.Type == "raw"
+}
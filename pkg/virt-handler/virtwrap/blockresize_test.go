@@ -0,0 +1,81 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Block resize", func() {
+	var ctrl *gomock.Controller
+	var mockDomain *cli.MockVirDomain
+	var manager *LibvirtDomainManager
+	var spec *api.DomainSpec
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockDomain = cli.NewMockVirDomain(ctrl)
+		manager = &LibvirtDomainManager{}
+		spec = api.NewMinimalDomainSpec("testvm")
+		spec.Devices.Disks = []api.Disk{
+			{
+				Type:   "file",
+				Device: "disk",
+				Source: api.DiskSource{File: "/var/run/kubevirt/disk.img"},
+				Target: api.DiskTarget{Device: "vda"},
+				Driver: &api.DiskDriver{Name: "qemu", Type: "raw"},
+			},
+			{
+				Type:   "file",
+				Device: "disk",
+				Source: api.DiskSource{File: "/var/run/kubevirt/disk.qcow2"},
+				Target: api.DiskTarget{Device: "vdb"},
+				Driver: &api.DiskDriver{Name: "qemu", Type: "qcow2"},
+			},
+		}
+	})
+
+	It("should propagate grown raw disks to the guest", func() {
+		mockDomain.EXPECT().GetBlockInfo("vda", uint(0)).Return(&libvirt.DomainBlockInfo{Capacity: 1024, Physical: 2048}, nil)
+		mockDomain.EXPECT().BlockResize("vda", uint64(2048), libvirt.DOMAIN_BLOCK_RESIZE_BYTES).Return(nil)
+
+		Expect(manager.syncDiskCapacities(newVM("default", "testvm"), mockDomain, spec)).To(BeTrue())
+		trail := manager.GetAuditTrail(newVM("default", "testvm"))
+		Expect(trail).To(HaveLen(1))
+		Expect(trail[0].Operation).To(Equal("block-resize"))
+		Expect(trail[0].Trigger).To(Equal(TriggerVMController))
+	})
+
+	It("should leave unchanged disks alone", func() {
+		mockDomain.EXPECT().GetBlockInfo("vda", uint(0)).Return(&libvirt.DomainBlockInfo{Capacity: 2048, Physical: 2048}, nil)
+
+		Expect(manager.syncDiskCapacities(newVM("default", "testvm"), mockDomain, spec)).To(BeFalse())
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+})
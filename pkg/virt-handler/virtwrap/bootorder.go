@@ -0,0 +1,76 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package virtwrap
+
+import (
+	"fmt"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+)
+
+// bootableDevice is a device of the domain with a boot order.
+type bootableDevice struct {
+	name  string
+	order uint
+}
+
+// prepareBootOrder validates the boot order of the disks, interfaces and
+// host devices. libvirt does not allow to combine it with the boot devices
+// of the OS, and every bootable device needs its own position, otherwise
+// the firmware might boot from a different device than intended.
+func prepareBootOrder(spec *api.DomainSpec) error {
+	devices := []bootableDevice{}
+	for _, disk := range spec.Devices.Disks {
+		if disk.BootOrder != nil {
+			devices = append(devices, bootableDevice{name: "disk " + disk.Target.Device, order: disk.BootOrder.Order})
+		}
+	}
+	for i, iface := range spec.Devices.Interfaces {
+		if iface.BootOrder != nil {
+			devices = append(devices, bootableDevice{name: fmt.Sprintf("interface %d", i), order: iface.BootOrder.Order})
+		}
+	}
+	for i, hostDev := range spec.Devices.HostDevices {
+		if hostDev.BootOrder == nil {
+			continue
+		}
+		if hostDev.Type != "pci" {
+			return fmt.Errorf("host device %d: only PCI host devices can boot", i)
+		}
+		devices = append(devices, bootableDevice{name: fmt.Sprintf("host device %d", i), order: hostDev.BootOrder.Order})
+	}
+
+	if len(devices) == 0 {
+		return nil
+	}
+	if len(spec.OS.BootOrder) > 0 {
+		return fmt.Errorf("the boot order of devices can't be combined with the boot devices of the OS")
+	}
+	orders := map[uint]string{}
+	for _, device := range devices {
+		if device.order == 0 {
+			return fmt.Errorf("%s: boot order must start at 1", device.name)
+		}
+		if other, exists := orders[device.order]; exists {
+			return fmt.Errorf("%s and %s have the same boot order %d", other, device.name, device.order)
+		}
+		orders[device.order] = device.name
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package virtwrap
+
+import (
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+)
+
+var _ = Describe("Boot order", func() {
+	var spec *api.DomainSpec
+
+	BeforeEach(func() {
+		spec = api.NewMinimalDomainSpec("testvm")
+		spec.Devices.Disks = []api.Disk{
+			{Type: "file", Device: "disk", Target: api.DiskTarget{Device: "vda"}},
+			{Type: "file", Device: "cdrom", Target: api.DiskTarget{Device: "sda"}},
+		}
+		spec.Devices.HostDevices = []api.HostDevice{
+			{Mode: "subsystem", Type: "pci"},
+			{Mode: "subsystem", Type: "mdev"},
+		}
+	})
+
+	It("should accept devices with distinct boot orders", func() {
+		spec.Devices.Disks[0].BootOrder = &api.BootOrder{Order: 1}
+		spec.Devices.Disks[1].BootOrder = &api.BootOrder{Order: 3}
+		spec.Devices.Interfaces[0].BootOrder = &api.BootOrder{Order: 2}
+		spec.Devices.HostDevices[0].BootOrder = &api.BootOrder{Order: 4}
+		Expect(prepareBootOrder(spec)).To(Succeed())
+	})
+
+	It("should accept the boot devices of the OS alone", func() {
+		spec.OS.BootOrder = []api.Boot{{Dev: "hd"}, {Dev: "network"}}
+		Expect(prepareBootOrder(spec)).To(Succeed())
+	})
+
+	table.DescribeTable("should reject", func(configure func()) {
+		configure()
+		Expect(prepareBootOrder(spec)).ToNot(Succeed())
+	},
+		table.Entry("combining device boot order and OS boot devices", func() {
+			spec.Devices.Disks[0].BootOrder = &api.BootOrder{Order: 1}
+			spec.OS.BootOrder = []api.Boot{{Dev: "hd"}}
+		}),
+		table.Entry("two devices with the same boot order", func() {
+			spec.Devices.Disks[0].BootOrder = &api.BootOrder{Order: 1}
+			spec.Devices.Interfaces[0].BootOrder = &api.BootOrder{Order: 1}
+		}),
+		table.Entry("a boot order of zero", func() {
+			spec.Devices.Disks[1].BootOrder = &api.BootOrder{Order: 0}
+		}),
+		table.Entry("booting from a mediated device", func() {
+			spec.Devices.HostDevices[1].BootOrder = &api.BootOrder{Order: 1}
+		}),
+	)
+})
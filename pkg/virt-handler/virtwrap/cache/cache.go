@@ -23,8 +23,8 @@ import (
 	"encoding/xml"
 	"fmt"
 	"strings"
+	"sync"
 
-	"github.com/libvirt/libvirt-go"
 	k8sv1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -36,6 +36,8 @@ import (
 	"kubevirt.io/kubevirt/pkg/logging"
 	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
 	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/errors"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
 )
 
 var LifeCycleTranslationMap = map[libvirt.DomainState]api.LifeCycle{
@@ -65,41 +67,63 @@ var ShutoffReasonTranslationMap = map[libvirt.DomainShutoffReason]api.StateChang
 	libvirt.DOMAIN_SHUTOFF_FROM_SNAPSHOT: api.ReasonFromSnapshot,
 }
 
+var RunningReasonTranslationMap = map[libvirt.DomainRunningReason]api.StateChangeReason{
+	libvirt.DOMAIN_RUNNING_UNKNOWN:  api.ReasonUnknown,
+	libvirt.DOMAIN_RUNNING_POSTCOPY: api.ReasonPostCopy,
+}
+
+var PausedReasonTranslationMap = map[libvirt.DomainPausedReason]api.StateChangeReason{
+	libvirt.DOMAIN_PAUSED_UNKNOWN:         api.ReasonUnknown,
+	libvirt.DOMAIN_PAUSED_USER:            api.ReasonUser,
+	libvirt.DOMAIN_PAUSED_MIGRATION:       api.ReasonMigration,
+	libvirt.DOMAIN_PAUSED_POSTCOPY:        api.ReasonPostCopy,
+	libvirt.DOMAIN_PAUSED_POSTCOPY_FAILED: api.ReasonPostCopyFailed,
+}
+
 var CrashedReasonTranslationMap = map[libvirt.DomainCrashedReason]api.StateChangeReason{
 	libvirt.DOMAIN_CRASHED_UNKNOWN:  api.ReasonUnknown,
 	libvirt.DOMAIN_CRASHED_PANICKED: api.ReasonPanicked,
 }
 
+// listDomains returns all domains with their spec and state.
+func listDomains(c cli.Connection) ([]api.Domain, error) {
+	doms, err := c.ListAllDomains(libvirt.CONNECT_LIST_DOMAINS_ACTIVE | libvirt.CONNECT_LIST_DOMAINS_INACTIVE)
+	if err != nil {
+		return nil, err
+	}
+	domains := []api.Domain{}
+	for _, dom := range doms {
+		domain, err := NewDomain(dom)
+		if err != nil {
+			return nil, err
+		}
+		spec, err := NewDomainSpec(dom)
+		if err != nil {
+			return nil, err
+		}
+		domain.Spec = *spec
+		status, reason, err := dom.GetState()
+		if err != nil {
+			return nil, err
+		}
+		domain.SetState(convState(status), convReason(status, reason))
+		domains = append(domains, *domain)
+	}
+	return domains, nil
+}
+
 // NewListWatchFromClient creates a new ListWatch from the specified client, resource, namespace and field selector.
 func newListWatchFromClient(c cli.Connection, events ...int) *cache.ListWatch {
 	listFunc := func(options metav1.ListOptions) (runtime.Object, error) {
 		logging.DefaultLogger().Info().V(3).Msg("Synchronizing domains")
-		doms, err := c.ListAllDomains(libvirt.CONNECT_LIST_DOMAINS_ACTIVE | libvirt.CONNECT_LIST_DOMAINS_INACTIVE)
+		eventsLock.Lock()
+		defer eventsLock.Unlock()
+		domains, err := listDomains(c)
 		if err != nil {
 			return nil, err
 		}
-		list := api.DomainList{
-			Items: []api.Domain{},
-		}
-		for _, dom := range doms {
-			domain, err := NewDomain(dom)
-			if err != nil {
-				return nil, err
-			}
-			spec, err := NewDomainSpec(dom)
-			if err != nil {
-				return nil, err
-			}
-			domain.Spec = *spec
-			status, reason, err := dom.GetState()
-			if err != nil {
-				return nil, err
-			}
-			domain.SetState(convState(status), convReason(status, reason))
-			list.Items = append(list.Items, *domain)
-		}
-
-		return &list, nil
+		setKnownDomains(domains)
+		return &api.DomainList{Items: domains}, nil
 	}
 	watchFunc := func(options metav1.ListOptions) (watch.Interface, error) {
 		return newDomainWatcher(c, events...)
@@ -107,12 +131,104 @@ func newListWatchFromClient(c cli.Connection, events ...int) *cache.ListWatch {
 	return &cache.ListWatch{ListFunc: listFunc, WatchFunc: watchFunc}
 }
 
+// All watchers which are not stopped yet, so that synthetic events can be
+// sent to them.
+var watchers = map[*DomainWatcher]bool{}
+var watchersLock sync.Mutex
+
+// The event callbacks and ResyncGuests read the state of domains and push it
+// to the watchers while holding eventsLock, so that an older state is never
+// pushed after a newer one. knownDomains are the domains the watchers were
+// told about, keyed by namespace and name.
+var eventsLock sync.Mutex
+var knownDomains = map[string]*api.Domain{}
+
+// ResyncGuests sends a Modified event with the current state of every domain
+// to all watchers, and a Deleted event for every domain the watchers know
+// of which is gone. Consumers which suspect that they missed events can
+// rebuild their view of the domains from the regular event stream this way.
+func ResyncGuests(c cli.Connection) error {
+	eventsLock.Lock()
+	defer eventsLock.Unlock()
+
+	domains, err := listDomains(c)
+	if err != nil {
+		return err
+	}
+	events := make([]watch.Event, 0, len(domains))
+	exists := map[string]bool{}
+	for i := range domains {
+		exists[domainKey(&domains[i])] = true
+		events = append(events, watch.Event{Type: watch.Modified, Object: &domains[i]})
+	}
+	for key, domain := range knownDomains {
+		if !exists[key] {
+			events = append(events, watch.Event{Type: watch.Deleted, Object: domain})
+		}
+	}
+	setKnownDomains(domains)
+
+	watchersLock.Lock()
+	defer watchersLock.Unlock()
+	for watcher := range watchers {
+		for _, event := range events {
+			push(watcher.queue, event)
+		}
+	}
+	logging.DefaultLogger().Info().V(3).Msgf("Replayed %d domain events to %d watchers.", len(events), len(watchers))
+	return nil
+}
+
+func domainKey(domain *api.Domain) string {
+	return domain.ObjectMeta.Namespace + "/" + domain.ObjectMeta.Name
+}
+
+// setKnownDomains replaces the known domains with a listing of all domains.
+func setKnownDomains(domains []api.Domain) {
+	knownDomains = make(map[string]*api.Domain, len(domains))
+	for i := range domains {
+		rememberDomain(&domains[i])
+	}
+}
+
+// rememberDomain records a domain the watchers were told about. Only what is
+// needed to report its removal is kept.
+func rememberDomain(domain *api.Domain) {
+	known := api.NewDomainReferenceFromName(domain.ObjectMeta.Namespace, domain.ObjectMeta.Name)
+	known.ObjectMeta.UID = domain.ObjectMeta.UID
+	known.SetState(api.NoState, api.ReasonUnknown)
+	knownDomains[domainKey(domain)] = known
+}
+
+// DomainWatcher hands the domain events, which the libvirt callbacks put into
+// its bounded queue, over to the consumer of C.
 type DomainWatcher struct {
-	C chan watch.Event
+	C     chan watch.Event
+	queue chan watch.Event
+	stop  chan struct{}
 }
 
 func (d *DomainWatcher) Stop() {
-	close(d.C)
+	watchersLock.Lock()
+	delete(watchers, d)
+	watchersLock.Unlock()
+	close(d.stop)
+}
+
+func (d *DomainWatcher) forward() {
+	defer close(d.C)
+	for {
+		select {
+		case event := <-d.queue:
+			select {
+			case d.C <- event:
+			case <-d.stop:
+				return
+			}
+		case <-d.stop:
+			return
+		}
+	}
 }
 
 func (d *DomainWatcher) ResultChan() <-chan watch.Event {
@@ -120,22 +236,64 @@ func (d *DomainWatcher) ResultChan() <-chan watch.Event {
 }
 
 func newDomainWatcher(c cli.Connection, events ...int) (watch.Interface, error) {
-	watcher := &DomainWatcher{C: make(chan watch.Event)}
-	callback := func(c *libvirt.Connect, d *libvirt.Domain, event *libvirt.DomainEventLifecycle) {
+	watcher := &DomainWatcher{
+		C:     make(chan watch.Event),
+		queue: make(chan watch.Event, EventQueueSize),
+		stop:  make(chan struct{}),
+	}
+	go watcher.forward()
+	if err := watcher.register(c); err != nil {
+		return watcher, err
+	}
+	watchersLock.Lock()
+	watchers[watcher] = true
+	watchersLock.Unlock()
+	return watcher, nil
+}
 
-		// check for reconnects, and emit an error to force a resync
+// register subscribes the watcher to the domain events. After a reconnect
+// it subscribes again and replays the state of all domains, since events
+// might have been missed in between.
+func (d *DomainWatcher) register(c cli.Connection) error {
+	err := c.DomainEventLifecycleRegister(func(_ *libvirt.Connect, dom *libvirt.Domain, event *libvirt.DomainEventLifecycle) {
 		if event == nil {
-			watcher.C <- watch.Event{Type: watch.Error, Object: &metav1.Status{Status: metav1.StatusFailure, Message: "Libvirt reconnected"}}
+			// We are called with the connection lock held, resync once it is released
+			go d.resync(c)
 			return
 		}
 		logging.DefaultLogger().Info().V(3).Msgf("Libvirt event %d with reason %d received", event.Event, event.Detail)
-		callback(d, event, watcher.C)
+		eventsLock.Lock()
+		defer eventsLock.Unlock()
+		callback(dom, event, d.queue)
+	})
+	if err != nil {
+		return err
+	}
+	logging.DefaultLogger().Info().V(2).Msg("Lifecycle event callback registered.")
+	return c.DomainEventWatchdogRegister(func(_ *libvirt.Connect, dom *libvirt.Domain, event *libvirt.DomainEventWatchdog) {
+		logging.DefaultLogger().Info().V(3).Msgf("Libvirt watchdog event with action %d received", event.Action)
+		eventsLock.Lock()
+		defer eventsLock.Unlock()
+		watchdogCallback(dom, event, d.queue)
+	})
+}
+
+// resync registers the watcher again after a reconnect and replays the
+// state of all domains. If that fails, the consumer is asked to start over.
+func (d *DomainWatcher) resync(c cli.Connection) {
+	select {
+	case <-d.stop:
+		return
+	default:
+	}
+	err := d.register(c)
+	if err == nil {
+		err = ResyncGuests(c)
 	}
-	err := c.DomainEventLifecycleRegister(callback)
 	if err != nil {
-		logging.DefaultLogger().Info().V(2).Msg("Lifecycle event callback registered.")
+		logging.DefaultLogger().Error().Reason(err).Msg("Resyncing the domains after a reconnect failed.")
+		push(d.queue, watch.Event{Type: watch.Error, Object: &metav1.Status{Status: metav1.StatusFailure, Message: "Libvirt reconnected"}})
 	}
-	return watcher, err
 }
 
 func NewDomainSpec(dom cli.VirDomain) (*api.DomainSpec, error) {
@@ -196,7 +354,7 @@ func callback(d cli.VirDomain, event *libvirt.DomainEventLifecycle, watcher chan
 	domain, err := NewDomain(d)
 	if err != nil {
 		logging.DefaultLogger().Error().Reason(err).Msg("Could not create the Domain.")
-		watcher <- watch.Event{Type: watch.Error, Object: &metav1.Status{Status: metav1.StatusFailure, Message: err.Error()}}
+		push(watcher, watch.Event{Type: watch.Error, Object: &metav1.Status{Status: metav1.StatusFailure, Message: err.Error()}})
 		return
 	}
 	logging.DefaultLogger().Info().Msgf("event received: %v:%v", event.Event, event.Detail)
@@ -213,9 +371,9 @@ func callback(d cli.VirDomain, event *libvirt.DomainEventLifecycle, watcher chan
 			spec, err := NewDomainSpec(d)
 			if err != nil {
 
-				if err.(libvirt.Error).Code != libvirt.ERR_NO_DOMAIN {
+				if !errors.IsNotFound(err) {
 					logging.DefaultLogger().Error().Reason(err).Msg("Could not fetch the Domain specification.")
-					watcher <- watch.Event{Type: watch.Error, Object: &metav1.Status{Status: metav1.StatusFailure, Message: err.Error()}}
+					push(watcher, watch.Event{Type: watch.Error, Object: &metav1.Status{Status: metav1.StatusFailure, Message: err.Error()}})
 					return
 				}
 			} else {
@@ -225,9 +383,9 @@ func callback(d cli.VirDomain, event *libvirt.DomainEventLifecycle, watcher chan
 		status, reason, err := d.GetState()
 		if err != nil {
 
-			if err.(libvirt.Error).Code != libvirt.ERR_NO_DOMAIN {
+			if !errors.IsNotFound(err) {
 				logging.DefaultLogger().Error().Reason(err).Msg("Could not fetch the Domain state.")
-				watcher <- watch.Event{Type: watch.Error, Object: &metav1.Status{Status: metav1.StatusFailure, Message: err.Error()}}
+				push(watcher, watch.Event{Type: watch.Error, Object: &metav1.Status{Status: metav1.StatusFailure, Message: err.Error()}})
 				return
 			}
 			domain.SetState(api.NoState, api.ReasonUnknown)
@@ -251,25 +409,69 @@ func callback(d cli.VirDomain, event *libvirt.DomainEventLifecycle, watcher chan
 
 	switch event.Event {
 	case libvirt.DOMAIN_EVENT_DEFINED:
+		rememberDomain(domain)
 		if libvirt.DomainEventDefinedDetailType(event.Detail) == libvirt.DOMAIN_EVENT_DEFINED_ADDED {
-			watcher <- watch.Event{Type: watch.Added, Object: domain}
+			push(watcher, watch.Event{Type: watch.Added, Object: domain})
 		} else {
-			watcher <- watch.Event{Type: watch.Modified, Object: domain}
+			push(watcher, watch.Event{Type: watch.Modified, Object: domain})
 		}
 	case libvirt.DOMAIN_EVENT_UNDEFINED:
-		watcher <- watch.Event{Type: watch.Deleted, Object: domain}
+		delete(knownDomains, domainKey(domain))
+		push(watcher, watch.Event{Type: watch.Deleted, Object: domain})
 	default:
-		watcher <- watch.Event{Type: watch.Modified, Object: domain}
+		rememberDomain(domain)
+		push(watcher, watch.Event{Type: watch.Modified, Object: domain})
 	}
 
 }
 
+// watchdogCallback reports the domain with the Watchdog reason in the state
+// the configured watchdog action leaves the guest in. Resets are ignored,
+// the guest just reboots.
+func watchdogCallback(d cli.VirDomain, event *libvirt.DomainEventWatchdog, watcher chan watch.Event) {
+	if event.Action == libvirt.DOMAIN_EVENT_WATCHDOG_RESET {
+		return
+	}
+	domain, err := NewDomain(d)
+	if err != nil {
+		logging.DefaultLogger().Error().Reason(err).Msg("Could not create the Domain.")
+		return
+	}
+	spec, err := NewDomainSpec(d)
+	if err != nil {
+		logging.DefaultLogger().Error().Reason(err).Msg("Could not fetch the Domain specification.")
+		return
+	}
+	domain.Spec = *spec
+	switch event.Action {
+	case libvirt.DOMAIN_EVENT_WATCHDOG_POWEROFF, libvirt.DOMAIN_EVENT_WATCHDOG_SHUTDOWN:
+		// qemu reports the event before it stops the guest
+		domain.SetState(api.Shutoff, api.ReasonWatchdog)
+	case libvirt.DOMAIN_EVENT_WATCHDOG_PAUSE:
+		domain.SetState(api.Paused, api.ReasonWatchdog)
+	default:
+		// With none, dump and inject-nmi the guest keeps running
+		status, _, err := d.GetState()
+		if err != nil {
+			logging.DefaultLogger().Error().Reason(err).Msg("Could not fetch the Domain state.")
+			return
+		}
+		domain.SetState(convState(status), api.ReasonWatchdog)
+	}
+	logging.DefaultLogger().Info().Object(domain).Msgf("Watchdog of the domain fired, action %d.", event.Action)
+	push(watcher, watch.Event{Type: watch.Modified, Object: domain})
+}
+
 func convState(status libvirt.DomainState) api.LifeCycle {
 	return LifeCycleTranslationMap[status]
 }
 
 func convReason(status libvirt.DomainState, reason int) api.StateChangeReason {
 	switch status {
+	case libvirt.DOMAIN_RUNNING:
+		return RunningReasonTranslationMap[libvirt.DomainRunningReason(reason)]
+	case libvirt.DOMAIN_PAUSED:
+		return PausedReasonTranslationMap[libvirt.DomainPausedReason(reason)]
 	case libvirt.DOMAIN_SHUTDOWN:
 		return ShutdownReasonTranslationMap[libvirt.DomainShutdownReason(reason)]
 	case libvirt.DOMAIN_SHUTOFF:
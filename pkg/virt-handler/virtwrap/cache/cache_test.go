@@ -23,7 +23,6 @@ import (
 	"encoding/xml"
 
 	"github.com/golang/mock/gomock"
-	"github.com/libvirt/libvirt-go"
 	. "github.com/onsi/ginkgo"
 	"github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
@@ -33,6 +32,7 @@ import (
 	"kubevirt.io/kubevirt/pkg/logging"
 	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
 	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
 )
 
 var _ = Describe("Cache", func() {
@@ -46,12 +46,14 @@ var _ = Describe("Cache", func() {
 		ctrl = gomock.NewController(GinkgoT())
 		mockConn = cli.NewMockConnection(ctrl)
 		mockDomain = cli.NewMockVirDomain(ctrl)
+		knownDomains = map[string]*api.Domain{}
 	})
 
 	Context("on syncing with libvirt", func() {
 		table.DescribeTable("should receive a VM through the initial listing of domains",
 			func(state libvirt.DomainState, kubevirtState api.LifeCycle) {
 				mockConn.EXPECT().DomainEventLifecycleRegister(gomock.Any()).Return(nil)
+				mockConn.EXPECT().DomainEventWatchdogRegister(gomock.Any()).Return(nil)
 				mockDomain.EXPECT().GetState().Return(state, -1, nil)
 				mockDomain.EXPECT().GetName().Return("test", nil)
 				mockDomain.EXPECT().GetUUIDString().Return("1235", nil)
@@ -93,7 +95,7 @@ var _ = Describe("Cache", func() {
 				Expect(err).To(BeNil())
 				mockDomain.EXPECT().GetXMLDesc(gomock.Eq(libvirt.DOMAIN_XML_MIGRATABLE)).Return(string(x), nil)
 
-				watcher := &DomainWatcher{make(chan watch.Event, 1)}
+				watcher := &DomainWatcher{C: make(chan watch.Event, 1)}
 				callback(mockDomain, &libvirt.DomainEventLifecycle{Event: event}, watcher.C)
 
 				e := <-watcher.C
@@ -116,7 +118,7 @@ var _ = Describe("Cache", func() {
 				mockDomain.EXPECT().GetName().Return("test", nil)
 				mockDomain.EXPECT().GetUUIDString().Return("1235", nil)
 
-				watcher := &DomainWatcher{make(chan watch.Event, 1)}
+				watcher := &DomainWatcher{C: make(chan watch.Event, 1)}
 				callback(mockDomain, &libvirt.DomainEventLifecycle{Event: libvirt.DOMAIN_EVENT_UNDEFINED}, watcher.C)
 
 				e := <-watcher.C
@@ -126,6 +128,137 @@ var _ = Describe("Cache", func() {
 			})
 	})
 
+	table.DescribeTable("should translate the state change reason",
+		func(state libvirt.DomainState, reason int, expected api.StateChangeReason) {
+			Expect(convReason(state, reason)).To(Equal(expected))
+		},
+		table.Entry("of running post-copy migrations", libvirt.DOMAIN_RUNNING, int(libvirt.DOMAIN_RUNNING_POSTCOPY), api.ReasonPostCopy),
+		table.Entry("of paused post-copy migrations", libvirt.DOMAIN_PAUSED, int(libvirt.DOMAIN_PAUSED_POSTCOPY), api.ReasonPostCopy),
+		table.Entry("of failed post-copy migrations", libvirt.DOMAIN_PAUSED, int(libvirt.DOMAIN_PAUSED_POSTCOPY_FAILED), api.ReasonPostCopyFailed),
+		table.Entry("of crashed domains", libvirt.DOMAIN_CRASHED, int(libvirt.DOMAIN_CRASHED_PANICKED), api.ReasonPanicked),
+	)
+
+	Context("on watchdog events", func() {
+		table.DescribeTable("should report the domain with the watchdog reason", func(action libvirt.DomainEventWatchdogAction, status api.LifeCycle) {
+			mockDomain.EXPECT().GetName().Return("test", nil)
+			mockDomain.EXPECT().GetUUIDString().Return("1235", nil)
+			x, err := xml.Marshal(api.NewMinimalDomainSpec("test"))
+			Expect(err).To(BeNil())
+			mockDomain.EXPECT().GetXMLDesc(gomock.Eq(libvirt.DOMAIN_XML_MIGRATABLE)).Return(string(x), nil)
+
+			watcher := &DomainWatcher{C: make(chan watch.Event, 1)}
+			watchdogCallback(mockDomain, &libvirt.DomainEventWatchdog{Action: action}, watcher.C)
+
+			e := <-watcher.C
+			Expect(e.Type).To(Equal(watch.Modified))
+			Expect(e.Object.(*api.Domain).Status.Status).To(Equal(status))
+			Expect(e.Object.(*api.Domain).Status.Reason).To(Equal(api.ReasonWatchdog))
+		},
+			table.Entry("paused on pause", libvirt.DOMAIN_EVENT_WATCHDOG_PAUSE, api.Paused),
+			table.Entry("stopped on poweroff", libvirt.DOMAIN_EVENT_WATCHDOG_POWEROFF, api.Shutoff),
+			table.Entry("stopped on shutdown", libvirt.DOMAIN_EVENT_WATCHDOG_SHUTDOWN, api.Shutoff),
+		)
+		It("should report the current state of guests which keep running", func() {
+			mockDomain.EXPECT().GetState().Return(libvirt.DOMAIN_RUNNING, -1, nil)
+			mockDomain.EXPECT().GetName().Return("test", nil)
+			mockDomain.EXPECT().GetUUIDString().Return("1235", nil)
+			x, err := xml.Marshal(api.NewMinimalDomainSpec("test"))
+			Expect(err).To(BeNil())
+			mockDomain.EXPECT().GetXMLDesc(gomock.Eq(libvirt.DOMAIN_XML_MIGRATABLE)).Return(string(x), nil)
+
+			watcher := &DomainWatcher{C: make(chan watch.Event, 1)}
+			watchdogCallback(mockDomain, &libvirt.DomainEventWatchdog{Action: libvirt.DOMAIN_EVENT_WATCHDOG_NONE}, watcher.C)
+
+			e := <-watcher.C
+			Expect(e.Object.(*api.Domain).Status.Status).To(Equal(api.Running))
+			Expect(e.Object.(*api.Domain).Status.Reason).To(Equal(api.ReasonWatchdog))
+		})
+		It("should ignore watchdog resets", func() {
+			watcher := &DomainWatcher{C: make(chan watch.Event, 1)}
+			watchdogCallback(mockDomain, &libvirt.DomainEventWatchdog{Action: libvirt.DOMAIN_EVENT_WATCHDOG_RESET}, watcher.C)
+			Expect(watcher.C).To(BeEmpty())
+		})
+	})
+
+	Context("on resync", func() {
+		It("should replay the state of all domains to running watchers", func() {
+			mockConn.EXPECT().DomainEventLifecycleRegister(gomock.Any()).Return(nil)
+			mockConn.EXPECT().DomainEventWatchdogRegister(gomock.Any()).Return(nil)
+			mockDomain.EXPECT().GetState().Return(libvirt.DOMAIN_RUNNING, -1, nil)
+			mockDomain.EXPECT().GetName().Return("test", nil)
+			mockDomain.EXPECT().GetUUIDString().Return("1235", nil)
+			x, err := xml.Marshal(api.NewMinimalDomainSpec("test"))
+			Expect(err).To(BeNil())
+			mockDomain.EXPECT().GetXMLDesc(gomock.Eq(libvirt.DOMAIN_XML_MIGRATABLE)).Return(string(x), nil)
+			mockConn.EXPECT().ListAllDomains(gomock.Eq(libvirt.CONNECT_LIST_DOMAINS_ACTIVE|libvirt.CONNECT_LIST_DOMAINS_INACTIVE)).Return([]cli.VirDomain{mockDomain}, nil)
+
+			watcher, err := newDomainWatcher(mockConn)
+			Expect(err).To(BeNil())
+			defer watcher.Stop()
+
+			Expect(ResyncGuests(mockConn)).To(Succeed())
+
+			e := <-watcher.ResultChan()
+			Expect(e.Type).To(Equal(watch.Modified))
+			Expect(e.Object.(*api.Domain).ObjectMeta.Name).To(Equal("test"))
+			Expect(e.Object.(*api.Domain).Status.Status).To(Equal(api.Running))
+		})
+
+		It("should report known domains which are gone as deleted", func() {
+			mockConn.EXPECT().DomainEventLifecycleRegister(gomock.Any()).Return(nil)
+			mockConn.EXPECT().DomainEventWatchdogRegister(gomock.Any()).Return(nil)
+			mockConn.EXPECT().ListAllDomains(gomock.Eq(libvirt.CONNECT_LIST_DOMAINS_ACTIVE|libvirt.CONNECT_LIST_DOMAINS_INACTIVE)).Return([]cli.VirDomain{}, nil)
+			rememberDomain(api.NewDomainReferenceFromName("default", "test"))
+
+			watcher, err := newDomainWatcher(mockConn)
+			Expect(err).To(BeNil())
+			defer watcher.Stop()
+
+			Expect(ResyncGuests(mockConn)).To(Succeed())
+
+			e := <-watcher.ResultChan()
+			Expect(e.Type).To(Equal(watch.Deleted))
+			Expect(e.Object.(*api.Domain).ObjectMeta.Name).To(Equal("test"))
+			Expect(knownDomains).To(BeEmpty())
+		})
+
+		It("should register again and replay the state of all domains after a reconnect", func() {
+			var lifecycleCallback libvirt.DomainEventLifecycleCallback
+			mockConn.EXPECT().DomainEventLifecycleRegister(gomock.Any()).Do(func(callback libvirt.DomainEventLifecycleCallback) {
+				lifecycleCallback = callback
+			}).Return(nil).Times(2)
+			mockConn.EXPECT().DomainEventWatchdogRegister(gomock.Any()).Return(nil).Times(2)
+			mockDomain.EXPECT().GetState().Return(libvirt.DOMAIN_RUNNING, -1, nil)
+			mockDomain.EXPECT().GetName().Return("test", nil)
+			mockDomain.EXPECT().GetUUIDString().Return("1235", nil)
+			x, err := xml.Marshal(api.NewMinimalDomainSpec("test"))
+			Expect(err).To(BeNil())
+			mockDomain.EXPECT().GetXMLDesc(gomock.Eq(libvirt.DOMAIN_XML_MIGRATABLE)).Return(string(x), nil)
+			mockConn.EXPECT().ListAllDomains(gomock.Eq(libvirt.CONNECT_LIST_DOMAINS_ACTIVE|libvirt.CONNECT_LIST_DOMAINS_INACTIVE)).Return([]cli.VirDomain{mockDomain}, nil)
+
+			watcher, err := newDomainWatcher(mockConn)
+			Expect(err).To(BeNil())
+			defer watcher.Stop()
+
+			lifecycleCallback(nil, nil, nil)
+
+			e := <-watcher.ResultChan()
+			Expect(e.Type).To(Equal(watch.Modified))
+			Expect(e.Object.(*api.Domain).ObjectMeta.Name).To(Equal("test"))
+		})
+
+		It("should forget stopped watchers", func() {
+			mockConn.EXPECT().DomainEventLifecycleRegister(gomock.Any()).Return(nil)
+			mockConn.EXPECT().DomainEventWatchdogRegister(gomock.Any()).Return(nil)
+
+			watcher, err := newDomainWatcher(mockConn)
+			Expect(err).To(BeNil())
+			Expect(watchers).To(HaveKey(watcher))
+			watcher.Stop()
+			Expect(watchers).ToNot(HaveKey(watcher))
+		})
+	})
+
 	AfterEach(func() {
 		ctrl.Finish()
 	})
@@ -0,0 +1,72 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package cache
+
+import (
+	"sync/atomic"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+
+	"kubevirt.io/kubevirt/pkg/logging"
+)
+
+// EventQueueSize is the number of events which are buffered for a watcher
+// before the oldest ones are dropped.
+const EventQueueSize = 100
+
+var droppedEvents uint64
+
+// DroppedEvents returns the number of domain events which were dropped,
+// because a watcher did not keep up with them.
+func DroppedEvents() uint64 {
+	return atomic.LoadUint64(&droppedEvents)
+}
+
+// push adds an event to the queue of a watcher without ever blocking, since
+// it is called on the libvirt event loop which a slow watcher would
+// otherwise stall for everybody. If the queue is full, the oldest events are
+// dropped and the watcher is asked to resync, so that the dropped changes
+// still reach it.
+func push(queue chan watch.Event, event watch.Event) {
+	select {
+	case queue <- event:
+		return
+	default:
+	}
+	logging.DefaultLogger().Warning().Msg("Domain event queue is full, dropping the oldest events.")
+	forcePush(queue, watch.Event{Type: watch.Error, Object: &metav1.Status{Status: metav1.StatusFailure, Message: "Domain events dropped"}})
+	forcePush(queue, event)
+}
+
+func forcePush(queue chan watch.Event, event watch.Event) {
+	for {
+		select {
+		case queue <- event:
+			return
+		default:
+		}
+		select {
+		case <-queue:
+			atomic.AddUint64(&droppedEvents, 1)
+		default:
+		}
+	}
+}
@@ -0,0 +1,61 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package cache
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/watch"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+)
+
+var _ = Describe("Event queue", func() {
+	It("should drop the oldest events and request a resync if the queue is full", func() {
+		queue := make(chan watch.Event, 3)
+		dropped := DroppedEvents()
+		for _, name := range []string{"vm1", "vm2", "vm3", "vm4"} {
+			push(queue, watch.Event{Type: watch.Modified, Object: api.NewDomainReferenceFromName("default", name)})
+		}
+
+		Expect(DroppedEvents() - dropped).To(Equal(uint64(2)))
+		Expect(queue).To(HaveLen(3))
+		Expect((<-queue).Object.(*api.Domain).ObjectMeta.Name).To(Equal("vm3"))
+		Expect((<-queue).Type).To(Equal(watch.Error))
+		Expect((<-queue).Object.(*api.Domain).ObjectMeta.Name).To(Equal("vm4"))
+	})
+
+	It("should hand the queued events over to the consumer until it stops", func() {
+		watcher := &DomainWatcher{
+			C:     make(chan watch.Event),
+			queue: make(chan watch.Event, EventQueueSize),
+			stop:  make(chan struct{}),
+		}
+		go watcher.forward()
+
+		push(watcher.queue, watch.Event{Type: watch.Added, Object: api.NewDomainReferenceFromName("default", "vm1")})
+		Eventually(watcher.ResultChan()).Should(Receive())
+
+		watcher.Stop()
+		Eventually(watcher.ResultChan()).Should(BeClosed())
+		// Late events from libvirt must not block or panic
+		push(watcher.queue, watch.Event{Type: watch.Added, Object: api.NewDomainReferenceFromName("default", "vm2")})
+	})
+})
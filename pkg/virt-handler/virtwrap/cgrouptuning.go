@@ -0,0 +1,194 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package virtwrap
+
+import (
+	"fmt"
+	"strconv"
+
+	kubev1 "k8s.io/api/core/v1"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cache"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+)
+
+// MemoryTuningForResources aligns the memory limits of the domain cgroup
+// with the resources of the virt-launcher Pod. The request becomes the soft
+// limit, the limit becomes the hard limit and, since the Pod can't swap,
+// the swap hard limit too. Without a limit both are lifted.
+func MemoryTuningForResources(resources kubev1.ResourceRequirements) *cli.MemoryTuning {
+	tuning := &cli.MemoryTuning{}
+	if request, exists := resources.Requests[kubev1.ResourceMemory]; exists {
+		soft := uint64(request.Value()) / 1024
+		tuning.SoftLimit = &soft
+	}
+	hard := cli.MemoryUnlimited
+	if limit, exists := resources.Limits[kubev1.ResourceMemory]; exists {
+		hard = uint64(limit.Value()) / 1024
+	}
+	swapHard := hard
+	tuning.HardLimit = &hard
+	tuning.SwapHardLimit = &swapHard
+	return tuning
+}
+
+// BlkioTuningForVM returns the blkio tuning the BlkioWeightAnnotation of the
+// VM asks for, or nil if the VM has no such annotation.
+func BlkioTuningForVM(vm *v1.VirtualMachine) (*cli.BlkioTuning, error) {
+	value, exists := vm.GetObjectMeta().GetAnnotations()[v1.BlkioWeightAnnotation]
+	if !exists {
+		return nil, nil
+	}
+	weight, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid blkio weight %s", value)
+	}
+	w := uint(weight)
+	return &cli.BlkioTuning{Weight: &w}, nil
+}
+
+func uint64PtrChanged(current *uint64, wanted *uint64) bool {
+	return wanted != nil && (current == nil || *current != *wanted)
+}
+
+func limitOrUnlimited(limit *uint64) uint64 {
+	if limit == nil {
+		return cli.MemoryUnlimited
+	}
+	return *limit
+}
+
+// memoryTuningSteps merges the wanted limits into the current ones and
+// splits the changes into calls which keep the hard limit below the swap
+// hard limit at all times: a swap hard limit below the current hard limit
+// is only set after the hard limit was lowered, otherwise it is raised
+// first.
+func memoryTuningSteps(current *cli.MemoryTuning, wanted *cli.MemoryTuning) ([]*cli.MemoryTuning, error) {
+	merged := &cli.MemoryTuning{
+		HardLimit:     current.HardLimit,
+		SoftLimit:     current.SoftLimit,
+		SwapHardLimit: current.SwapHardLimit,
+	}
+	limits := &cli.MemoryTuning{}
+	if uint64PtrChanged(current.HardLimit, wanted.HardLimit) {
+		merged.HardLimit = wanted.HardLimit
+		limits.HardLimit = wanted.HardLimit
+	}
+	if uint64PtrChanged(current.SoftLimit, wanted.SoftLimit) {
+		merged.SoftLimit = wanted.SoftLimit
+		limits.SoftLimit = wanted.SoftLimit
+	}
+	swap := &cli.MemoryTuning{}
+	if uint64PtrChanged(current.SwapHardLimit, wanted.SwapHardLimit) {
+		merged.SwapHardLimit = wanted.SwapHardLimit
+		swap.SwapHardLimit = wanted.SwapHardLimit
+	}
+	if err := merged.Validate(); err != nil {
+		return nil, err
+	}
+
+	steps := []*cli.MemoryTuning{}
+	if swap.SwapHardLimit != nil && *swap.SwapHardLimit < limitOrUnlimited(current.HardLimit) {
+		steps = append(steps, limits, swap)
+	} else {
+		steps = append(steps, swap, limits)
+	}
+	changes := []*cli.MemoryTuning{}
+	for _, step := range steps {
+		if step.HardLimit != nil || step.SoftLimit != nil || step.SwapHardLimit != nil {
+			changes = append(changes, step)
+		}
+	}
+	return changes, nil
+}
+
+// TuneMemory changes the memory limits of the running guest, e.g. after the
+// resources of the virt-launcher Pod were scaled vertically. Limits which
+// are already in place are not set again, unset ones keep their value.
+func (l *LibvirtDomainManager) TuneMemory(vm *v1.VirtualMachine, tuning *cli.MemoryTuning, trigger Trigger) error {
+	if err := tuning.Validate(); err != nil {
+		return err
+	}
+	return l.runOnDomain(vm, func() error {
+		dom, err := l.virConn.LookupDomainByName(cache.VMNamespaceKeyFunc(vm))
+		if err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain failed.")
+			return err
+		}
+		defer dom.Free()
+
+		current, err := cli.GetMemoryTuning(dom)
+		if err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the memory parameters failed.")
+			return err
+		}
+		steps, err := memoryTuningSteps(current, tuning)
+		if err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Merging the memory parameters failed.")
+			return err
+		}
+		if len(steps) == 0 {
+			return nil
+		}
+		for _, step := range steps {
+			err = cli.SetMemoryTuning(dom, step)
+			l.audit(vm, trigger, "set-memory-parameters", step, err)
+			if err != nil {
+				logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Setting the memory parameters failed.")
+				return err
+			}
+		}
+		logging.DefaultLogger().Object(vm).Info().Msg("Memory parameters changed.")
+		return nil
+	})
+}
+
+// TuneBlkio changes the blkio weight of the running guest.
+func (l *LibvirtDomainManager) TuneBlkio(vm *v1.VirtualMachine, tuning *cli.BlkioTuning, trigger Trigger) error {
+	if err := tuning.Validate(); err != nil {
+		return err
+	}
+	return l.runOnDomain(vm, func() error {
+		dom, err := l.virConn.LookupDomainByName(cache.VMNamespaceKeyFunc(vm))
+		if err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain failed.")
+			return err
+		}
+		defer dom.Free()
+
+		current, err := cli.GetBlkioTuning(dom)
+		if err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the blkio parameters failed.")
+			return err
+		}
+		if tuning.Weight == nil || (current.Weight != nil && *current.Weight == *tuning.Weight) {
+			return nil
+		}
+		err = cli.SetBlkioTuning(dom, tuning)
+		l.audit(vm, trigger, "set-blkio-parameters", tuning, err)
+		if err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Setting the blkio parameters failed.")
+			return err
+		}
+		logging.DefaultLogger().Object(vm).Info().Msgf("Blkio weight set to %d.", *tuning.Weight)
+		return nil
+	})
+}
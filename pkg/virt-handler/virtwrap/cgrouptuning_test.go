@@ -0,0 +1,161 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package virtwrap
+
+import (
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	kubev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Cgroup tuning", func() {
+	var ctrl *gomock.Controller
+	var mockConn *cli.MockConnection
+	var mockDomain *cli.MockVirDomain
+	var manager *LibvirtDomainManager
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockConn = cli.NewMockConnection(ctrl)
+		mockDomain = cli.NewMockVirDomain(ctrl)
+		manager = &LibvirtDomainManager{virConn: mockConn}
+	})
+
+	It("should derive the memory limits from the Pod resources", func() {
+		tuning := MemoryTuningForResources(kubev1.ResourceRequirements{
+			Requests: kubev1.ResourceList{kubev1.ResourceMemory: resource.MustParse("1Gi")},
+			Limits:   kubev1.ResourceList{kubev1.ResourceMemory: resource.MustParse("2Gi")},
+		})
+		Expect(*tuning.SoftLimit).To(Equal(uint64(1048576)))
+		Expect(*tuning.HardLimit).To(Equal(uint64(2097152)))
+		Expect(*tuning.SwapHardLimit).To(Equal(uint64(2097152)))
+	})
+
+	It("should lift the memory limits of Pods without limit", func() {
+		tuning := MemoryTuningForResources(kubev1.ResourceRequirements{})
+		Expect(tuning.SoftLimit).To(BeNil())
+		Expect(*tuning.HardLimit).To(Equal(cli.MemoryUnlimited))
+		Expect(*tuning.SwapHardLimit).To(Equal(cli.MemoryUnlimited))
+	})
+
+	It("should only change the memory limits which differ", func() {
+		hard := uint64(2097152)
+		soft := uint64(1048576)
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+		mockDomain.EXPECT().GetMemoryParameters(libvirt.DOMAIN_AFFECT_LIVE).Return(&libvirt.DomainMemoryParameters{
+			HardLimitSet: true,
+			HardLimit:    hard,
+			SoftLimitSet: true,
+			SoftLimit:    cli.MemoryUnlimited,
+		}, nil)
+		mockDomain.EXPECT().SetMemoryParameters(&libvirt.DomainMemoryParameters{
+			SoftLimitSet: true,
+			SoftLimit:    soft,
+		}, libvirt.DOMAIN_AFFECT_LIVE).Return(nil)
+		mockDomain.EXPECT().Free()
+		Expect(manager.TuneMemory(newVM("default", "testvm"), &cli.MemoryTuning{HardLimit: &hard, SoftLimit: &soft}, TriggerVMController)).To(Succeed())
+	})
+
+	It("should raise the swap hard limit before the hard limit", func() {
+		hard := uint64(4194304)
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+		mockDomain.EXPECT().GetMemoryParameters(libvirt.DOMAIN_AFFECT_LIVE).Return(&libvirt.DomainMemoryParameters{
+			HardLimitSet:     true,
+			HardLimit:        2097152,
+			SwapHardLimitSet: true,
+			SwapHardLimit:    2097152,
+		}, nil)
+		gomock.InOrder(
+			mockDomain.EXPECT().SetMemoryParameters(&libvirt.DomainMemoryParameters{
+				SwapHardLimitSet: true,
+				SwapHardLimit:    hard,
+			}, libvirt.DOMAIN_AFFECT_LIVE).Return(nil),
+			mockDomain.EXPECT().SetMemoryParameters(&libvirt.DomainMemoryParameters{
+				HardLimitSet: true,
+				HardLimit:    hard,
+			}, libvirt.DOMAIN_AFFECT_LIVE).Return(nil),
+		)
+		mockDomain.EXPECT().Free()
+		Expect(manager.TuneMemory(newVM("default", "testvm"), &cli.MemoryTuning{HardLimit: &hard, SwapHardLimit: &hard}, TriggerVMController)).To(Succeed())
+	})
+
+	It("should lower the hard limit before the swap hard limit", func() {
+		hard := uint64(1048576)
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+		mockDomain.EXPECT().GetMemoryParameters(libvirt.DOMAIN_AFFECT_LIVE).Return(&libvirt.DomainMemoryParameters{
+			HardLimitSet:     true,
+			HardLimit:        2097152,
+			SwapHardLimitSet: true,
+			SwapHardLimit:    2097152,
+		}, nil)
+		gomock.InOrder(
+			mockDomain.EXPECT().SetMemoryParameters(&libvirt.DomainMemoryParameters{
+				HardLimitSet: true,
+				HardLimit:    hard,
+			}, libvirt.DOMAIN_AFFECT_LIVE).Return(nil),
+			mockDomain.EXPECT().SetMemoryParameters(&libvirt.DomainMemoryParameters{
+				SwapHardLimitSet: true,
+				SwapHardLimit:    hard,
+			}, libvirt.DOMAIN_AFFECT_LIVE).Return(nil),
+		)
+		mockDomain.EXPECT().Free()
+		Expect(manager.TuneMemory(newVM("default", "testvm"), &cli.MemoryTuning{HardLimit: &hard, SwapHardLimit: &hard}, TriggerVMController)).To(Succeed())
+	})
+
+	It("should refuse a hard limit above the current swap hard limit", func() {
+		hard := uint64(4194304)
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+		mockDomain.EXPECT().GetMemoryParameters(libvirt.DOMAIN_AFFECT_LIVE).Return(&libvirt.DomainMemoryParameters{
+			SwapHardLimitSet: true,
+			SwapHardLimit:    2097152,
+		}, nil)
+		mockDomain.EXPECT().Free()
+		Expect(manager.TuneMemory(newVM("default", "testvm"), &cli.MemoryTuning{HardLimit: &hard}, TriggerVMController)).ToNot(Succeed())
+	})
+
+	It("should read the blkio weight from the VM", func() {
+		vm := newVM("default", "testvm")
+		Expect(BlkioTuningForVM(vm)).To(BeNil())
+		vm.ObjectMeta.Annotations = map[string]string{v1.BlkioWeightAnnotation: "500"}
+		tuning, err := BlkioTuningForVM(vm)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(*tuning.Weight).To(Equal(uint(500)))
+		vm.ObjectMeta.Annotations[v1.BlkioWeightAnnotation] = "heavy"
+		_, err = BlkioTuningForVM(vm)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should not set the blkio weight again", func() {
+		weight := uint(500)
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+		mockDomain.EXPECT().GetBlkioParameters(libvirt.DOMAIN_AFFECT_LIVE).Return(&libvirt.DomainBlkioParameters{WeightSet: true, Weight: 500}, nil)
+		mockDomain.EXPECT().Free()
+		Expect(manager.TuneBlkio(newVM("default", "testvm"), &cli.BlkioTuning{Weight: &weight}, TriggerVMController)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+})
@@ -0,0 +1,91 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	kubev1 "k8s.io/api/core/v1"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+)
+
+// userDomainSpec returns a copy of the spec as it was derived from the VM,
+// without the qemu wrapper arguments, which depend on the pod of the VM.
+func userDomainSpec(spec *api.DomainSpec) (*api.DomainSpec, error) {
+	userSpec := *spec
+	userSpec.XmlNS = ""
+	userSpec.QEMUCmd = nil
+	xmlStr, err := xml.Marshal(&userSpec)
+	if err != nil {
+		return nil, err
+	}
+	copied := &api.DomainSpec{}
+	if err := xml.Unmarshal(xmlStr, copied); err != nil {
+		return nil, err
+	}
+	return copied, nil
+}
+
+// reportPendingChanges compares the spec of the running domain, as it was
+// derived from the VM when the domain was defined, with the current one. It
+// tells through events which changes only take effect after a restart and
+// which can't be applied to the domain at all. Changes which can be applied
+// live are synchronized separately.
+func (l *LibvirtDomainManager) reportPendingChanges(vm *v1.VirtualMachine, dom cli.VirDomain, wantedSpec *api.DomainSpec) error {
+	metadata, err := GetMetadata(dom)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain metadata failed.")
+		return err
+	}
+	if metadata.Spec == nil {
+		// Defined before we stored the spec, there is nothing to compare with
+		return nil
+	}
+	desired, err := userDomainSpec(wantedSpec)
+	if err != nil {
+		return err
+	}
+
+	diff := api.DiffDomainSpec(metadata.Spec, desired)
+	var restartRequired, forbidden []string
+	for _, change := range diff.Changes {
+		switch change.Type {
+		case api.ChangeRestartRequired:
+			restartRequired = append(restartRequired, change.Path)
+		case api.ChangeForbidden:
+			forbidden = append(forbidden, change.Path)
+		}
+	}
+	if len(forbidden) > 0 {
+		l.recorder.Event(vm, kubev1.EventTypeWarning, v1.ChangeRejected.String(),
+			fmt.Sprintf("Changes of %s can't be applied to the domain.", strings.Join(forbidden, ", ")))
+	}
+	if len(restartRequired) > 0 {
+		l.recorder.Event(vm, kubev1.EventTypeNormal, v1.RestartRequired.String(),
+			fmt.Sprintf("Changes of %s take effect after a restart of the VM.", strings.Join(restartRequired, ", ")))
+	}
+	return nil
+}
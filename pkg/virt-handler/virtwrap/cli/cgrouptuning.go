@@ -0,0 +1,135 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package cli
+
+import (
+	"fmt"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+// MemoryUnlimited lifts a memory limit, it is VIR_DOMAIN_MEMORY_PARAM_UNLIMITED
+// of libvirt.
+const MemoryUnlimited uint64 = 9007199254740991
+
+// Bounds of the blkio weight of the cgroup blkio controller.
+const (
+	minBlkioWeight = 100
+	maxBlkioWeight = 1000
+)
+
+// MemoryTuning holds the memory limits of the cgroup of a domain in KiB.
+// Unset fields are left alone.
+type MemoryTuning struct {
+	HardLimit     *uint64
+	SoftLimit     *uint64
+	SwapHardLimit *uint64
+}
+
+// BlkioTuning holds the blkio parameters of the cgroup of a domain. Unset
+// fields are left alone.
+type BlkioTuning struct {
+	Weight *uint
+}
+
+// Validate checks that the soft limit is not above the hard limit, which in
+// turn is not above the limit of memory and swap together.
+func (t *MemoryTuning) Validate() error {
+	if t.HardLimit != nil && t.SoftLimit != nil && *t.SoftLimit > *t.HardLimit {
+		return fmt.Errorf("the memory soft limit %d KiB is above the hard limit %d KiB", *t.SoftLimit, *t.HardLimit)
+	}
+	if t.HardLimit != nil && t.SwapHardLimit != nil && *t.HardLimit > *t.SwapHardLimit {
+		return fmt.Errorf("the memory hard limit %d KiB is above the swap hard limit %d KiB", *t.HardLimit, *t.SwapHardLimit)
+	}
+	return nil
+}
+
+// Validate checks the weight against the limits of the blkio controller.
+func (t *BlkioTuning) Validate() error {
+	if t.Weight != nil && (*t.Weight < minBlkioWeight || *t.Weight > maxBlkioWeight) {
+		return fmt.Errorf("the blkio weight must be between %d and %d, got %d", minBlkioWeight, maxBlkioWeight, *t.Weight)
+	}
+	return nil
+}
+
+// GetMemoryTuning returns the memory limits of a running domain.
+func GetMemoryTuning(dom VirDomain) (*MemoryTuning, error) {
+	params, err := dom.GetMemoryParameters(libvirt.DOMAIN_AFFECT_LIVE)
+	if err != nil {
+		return nil, err
+	}
+	tuning := &MemoryTuning{}
+	if params.HardLimitSet {
+		tuning.HardLimit = &params.HardLimit
+	}
+	if params.SoftLimitSet {
+		tuning.SoftLimit = &params.SoftLimit
+	}
+	if params.SwapHardLimitSet {
+		tuning.SwapHardLimit = &params.SwapHardLimit
+	}
+	return tuning, nil
+}
+
+// SetMemoryTuning changes the memory limits of a running domain.
+func SetMemoryTuning(dom VirDomain, tuning *MemoryTuning) error {
+	if err := tuning.Validate(); err != nil {
+		return err
+	}
+	params := &libvirt.DomainMemoryParameters{}
+	if tuning.HardLimit != nil {
+		params.HardLimitSet = true
+		params.HardLimit = *tuning.HardLimit
+	}
+	if tuning.SoftLimit != nil {
+		params.SoftLimitSet = true
+		params.SoftLimit = *tuning.SoftLimit
+	}
+	if tuning.SwapHardLimit != nil {
+		params.SwapHardLimitSet = true
+		params.SwapHardLimit = *tuning.SwapHardLimit
+	}
+	return dom.SetMemoryParameters(params, libvirt.DOMAIN_AFFECT_LIVE)
+}
+
+// GetBlkioTuning returns the blkio parameters of a running domain.
+func GetBlkioTuning(dom VirDomain) (*BlkioTuning, error) {
+	params, err := dom.GetBlkioParameters(libvirt.DOMAIN_AFFECT_LIVE)
+	if err != nil {
+		return nil, err
+	}
+	tuning := &BlkioTuning{}
+	if params.WeightSet {
+		tuning.Weight = &params.Weight
+	}
+	return tuning, nil
+}
+
+// SetBlkioTuning changes the blkio parameters of a running domain.
+func SetBlkioTuning(dom VirDomain, tuning *BlkioTuning) error {
+	if err := tuning.Validate(); err != nil {
+		return err
+	}
+	params := &libvirt.DomainBlkioParameters{}
+	if tuning.Weight != nil {
+		params.WeightSet = true
+		params.Weight = *tuning.Weight
+	}
+	return dom.SetBlkioParameters(params, libvirt.DOMAIN_AFFECT_LIVE)
+}
@@ -0,0 +1,87 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package cli
+
+import (
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Cgroup tuning", func() {
+	var ctrl *gomock.Controller
+	var mockDomain *MockVirDomain
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockDomain = NewMockVirDomain(ctrl)
+	})
+
+	It("should set the memory limits", func() {
+		mockDomain.EXPECT().SetMemoryParameters(&libvirt.DomainMemoryParameters{
+			HardLimitSet:     true,
+			HardLimit:        2097152,
+			SoftLimitSet:     true,
+			SoftLimit:        1048576,
+			SwapHardLimitSet: true,
+			SwapHardLimit:    2097152,
+		}, libvirt.DOMAIN_AFFECT_LIVE).Return(nil)
+		Expect(SetMemoryTuning(mockDomain, &MemoryTuning{
+			HardLimit:     newUint64(2097152),
+			SoftLimit:     newUint64(1048576),
+			SwapHardLimit: newUint64(2097152),
+		})).To(Succeed())
+	})
+
+	It("should reject a soft limit above the hard limit", func() {
+		Expect(SetMemoryTuning(mockDomain, &MemoryTuning{HardLimit: newUint64(1024), SoftLimit: newUint64(2048)})).ToNot(Succeed())
+	})
+
+	It("should reject a hard limit above the swap hard limit", func() {
+		Expect(SetMemoryTuning(mockDomain, &MemoryTuning{HardLimit: newUint64(2048), SwapHardLimit: newUint64(1024)})).ToNot(Succeed())
+	})
+
+	It("should return the memory limits which libvirt reported", func() {
+		mockDomain.EXPECT().GetMemoryParameters(libvirt.DOMAIN_AFFECT_LIVE).Return(&libvirt.DomainMemoryParameters{
+			HardLimitSet: true,
+			HardLimit:    MemoryUnlimited,
+		}, nil)
+		tuning, err := GetMemoryTuning(mockDomain)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(*tuning.HardLimit).To(Equal(MemoryUnlimited))
+		Expect(tuning.SoftLimit).To(BeNil())
+	})
+
+	It("should set the blkio weight", func() {
+		weight := uint(500)
+		mockDomain.EXPECT().SetBlkioParameters(&libvirt.DomainBlkioParameters{WeightSet: true, Weight: 500}, libvirt.DOMAIN_AFFECT_LIVE).Return(nil)
+		Expect(SetBlkioTuning(mockDomain, &BlkioTuning{Weight: &weight})).To(Succeed())
+	})
+
+	It("should reject blkio weights the controller does not accept", func() {
+		weight := uint(5000)
+		Expect(SetBlkioTuning(mockDomain, &BlkioTuning{Weight: &weight})).ToNot(Succeed())
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+})
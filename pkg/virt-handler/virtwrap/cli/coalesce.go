@@ -0,0 +1,78 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package cli
+
+import "sync"
+
+type coalescedCall struct {
+	done      sync.WaitGroup
+	val       interface{}
+	err       error
+	followers int
+}
+
+// coalescer makes concurrent identical libvirt calls share a single RPC.
+// The first caller of a key performs the call, all callers which arrive
+// while it is in flight wait for and get its result.
+type coalescer struct {
+	lock  sync.Mutex
+	calls map[string]*coalescedCall
+}
+
+func newCoalescer() *coalescer {
+	return &coalescer{calls: make(map[string]*coalescedCall)}
+}
+
+// do runs fn once for all concurrent callers of key. Before the followers
+// are woken up, share is called once per follower with the result, e.g. to
+// take an additional reference on a returned libvirt object. The returned
+// bool is true for followers.
+func (c *coalescer) do(key string, fn func() (interface{}, error), share func(interface{}) error) (interface{}, error, bool) {
+	c.lock.Lock()
+	if call, exists := c.calls[key]; exists {
+		call.followers++
+		c.lock.Unlock()
+		call.done.Wait()
+		return call.val, call.err, true
+	}
+	call := &coalescedCall{}
+	call.done.Add(1)
+	c.calls[key] = call
+	c.lock.Unlock()
+
+	val, err := fn()
+
+	c.lock.Lock()
+	delete(c.calls, key)
+	followers := call.followers
+	c.lock.Unlock()
+
+	call.val, call.err = val, err
+	if err == nil && share != nil {
+		for i := 0; i < followers; i++ {
+			if shareErr := share(val); shareErr != nil {
+				call.val, call.err = nil, shareErr
+				break
+			}
+		}
+	}
+	call.done.Done()
+	return val, err, false
+}
@@ -0,0 +1,106 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package cli
+
+import (
+	"fmt"
+	"sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Coalescer", func() {
+	var c *coalescer
+
+	BeforeEach(func() {
+		c = newCoalescer()
+	})
+
+	It("should share one call between concurrent callers", func() {
+		release := make(chan struct{})
+		calls := 0
+		shared := 0
+
+		fn := func() (interface{}, error) {
+			calls++
+			<-release
+			return "testvm", nil
+		}
+		share := func(val interface{}) error {
+			shared++
+			return nil
+		}
+
+		var leader sync.WaitGroup
+		leader.Add(1)
+		go func() {
+			defer leader.Done()
+			defer GinkgoRecover()
+			val, err, follower := c.do("key", fn, share)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(val).To(Equal("testvm"))
+			Expect(follower).To(BeFalse())
+		}()
+		Eventually(func() bool {
+			c.lock.Lock()
+			defer c.lock.Unlock()
+			_, exists := c.calls["key"]
+			return exists
+		}).Should(BeTrue())
+
+		var followers sync.WaitGroup
+		for i := 0; i < 3; i++ {
+			followers.Add(1)
+			go func() {
+				defer followers.Done()
+				defer GinkgoRecover()
+				val, err, follower := c.do("key", fn, share)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(val).To(Equal("testvm"))
+				Expect(follower).To(BeTrue())
+			}()
+		}
+		Eventually(func() int {
+			c.lock.Lock()
+			defer c.lock.Unlock()
+			return c.calls["key"].followers
+		}).Should(Equal(3))
+
+		close(release)
+		leader.Wait()
+		followers.Wait()
+		Expect(calls).To(Equal(1))
+		Expect(shared).To(Equal(3))
+		Expect(c.calls).To(BeEmpty())
+	})
+
+	It("should not share a failed call", func() {
+		val, err, follower := c.do("key", func() (interface{}, error) {
+			return nil, fmt.Errorf("failure")
+		}, func(val interface{}) error {
+			Fail("failed results must not be shared")
+			return nil
+		})
+		Expect(err).To(HaveOccurred())
+		Expect(val).To(BeNil())
+		Expect(follower).To(BeFalse())
+	})
+})
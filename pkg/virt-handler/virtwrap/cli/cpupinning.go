@@ -0,0 +1,158 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+// CPUPinningPlan describes on which host CPUs the vCPUs, the emulator threads
+// and the IOThreads of a domain should run. Usually the host CPUs are the ones
+// which the kubelet CPU manager allocated to the virt-launcher Pod.
+type CPUPinningPlan struct {
+	// VCPUs maps a vCPU number to the host CPUs it is allowed to run on
+	VCPUs map[uint][]uint
+	// Emulator contains the host CPUs for the qemu emulator threads
+	Emulator []uint
+	// IOThreads maps an IOThread id to the host CPUs it is allowed to run on
+	IOThreads map[uint][]uint
+}
+
+// ParseCPUSet parses a cpuset in the Linux list format (e.g. "0-3,7") like it
+// is used by cgroups and the kubelet CPU manager.
+func ParseCPUSet(cpuset string) ([]uint, error) {
+	cpus := []uint{}
+	seen := map[uint]bool{}
+	if strings.TrimSpace(cpuset) == "" {
+		return cpus, nil
+	}
+	for _, part := range strings.Split(cpuset, ",") {
+		part = strings.TrimSpace(part)
+		bounds := strings.SplitN(part, "-", 2)
+		start, err := strconv.ParseUint(bounds[0], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cpuset %q: %v", cpuset, err)
+		}
+		end := start
+		if len(bounds) == 2 {
+			end, err = strconv.ParseUint(bounds[1], 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid cpuset %q: %v", cpuset, err)
+			}
+		}
+		if end < start {
+			return nil, fmt.Errorf("invalid cpuset %q: range %s is reversed", cpuset, part)
+		}
+		for cpu := start; cpu <= end; cpu++ {
+			if !seen[uint(cpu)] {
+				seen[uint(cpu)] = true
+				cpus = append(cpus, uint(cpu))
+			}
+		}
+	}
+	sort.Slice(cpus, func(i, j int) bool { return cpus[i] < cpus[j] })
+	return cpus, nil
+}
+
+// CPUSetToCPUMap converts a list of host CPUs into the cpumap representation
+// expected by libvirt, where index i is true if host CPU i is part of the set.
+func CPUSetToCPUMap(cpuset []uint) []bool {
+	var max uint
+	for _, cpu := range cpuset {
+		if cpu > max {
+			max = cpu
+		}
+	}
+	cpuMap := make([]bool, max+1)
+	for _, cpu := range cpuset {
+		cpuMap[cpu] = true
+	}
+	return cpuMap
+}
+
+// PinVcpu restricts the given vCPU of a running domain to the given host CPUs.
+func PinVcpu(dom VirDomain, vcpu uint, cpuset []uint) error {
+	if len(cpuset) == 0 {
+		return fmt.Errorf("can't pin vCPU %d to an empty cpuset", vcpu)
+	}
+	return dom.PinVcpuFlags(vcpu, CPUSetToCPUMap(cpuset), libvirt.DOMAIN_AFFECT_LIVE)
+}
+
+// PinEmulator restricts the emulator threads of a running domain to the given host CPUs.
+func PinEmulator(dom VirDomain, cpuset []uint) error {
+	if len(cpuset) == 0 {
+		return fmt.Errorf("can't pin the emulator to an empty cpuset")
+	}
+	return dom.PinEmulator(CPUSetToCPUMap(cpuset), libvirt.DOMAIN_AFFECT_LIVE)
+}
+
+// PinIOThread restricts the given IOThread of a running domain to the given host CPUs.
+func PinIOThread(dom VirDomain, id uint, cpuset []uint) error {
+	if len(cpuset) == 0 {
+		return fmt.Errorf("can't pin IOThread %d to an empty cpuset", id)
+	}
+	return dom.PinIOThread(id, CPUSetToCPUMap(cpuset), libvirt.DOMAIN_AFFECT_LIVE)
+}
+
+// AddIOThread adds an IOThread with the given id to a running domain.
+func AddIOThread(dom VirDomain, id uint) error {
+	if id == 0 {
+		return fmt.Errorf("IOThread ids start with 1")
+	}
+	return dom.AddIOThread(id, libvirt.DOMAIN_AFFECT_LIVE)
+}
+
+// ApplyCPUPinning pins vCPUs, emulator threads and IOThreads of a running
+// domain according to the plan. It stops at the first failure.
+func ApplyCPUPinning(dom VirDomain, plan *CPUPinningPlan) error {
+	if plan == nil {
+		return nil
+	}
+	for _, vcpu := range sortedKeys(plan.VCPUs) {
+		if err := PinVcpu(dom, vcpu, plan.VCPUs[vcpu]); err != nil {
+			return err
+		}
+	}
+	if len(plan.Emulator) > 0 {
+		if err := PinEmulator(dom, plan.Emulator); err != nil {
+			return err
+		}
+	}
+	for _, id := range sortedKeys(plan.IOThreads) {
+		if err := PinIOThread(dom, id, plan.IOThreads[id]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedKeys(m map[uint][]uint) []uint {
+	keys := make([]uint, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
@@ -0,0 +1,101 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package cli
+
+import (
+	"fmt"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("CPU pinning", func() {
+	var ctrl *gomock.Controller
+	var mockDomain *MockVirDomain
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockDomain = NewMockVirDomain(ctrl)
+	})
+
+	table.DescribeTable("should parse cpusets",
+		func(cpuset string, expected []uint) {
+			cpus, err := ParseCPUSet(cpuset)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cpus).To(Equal(expected))
+		},
+		table.Entry("empty", "", []uint{}),
+		table.Entry("single cpu", "3", []uint{3}),
+		table.Entry("range", "0-3", []uint{0, 1, 2, 3}),
+		table.Entry("mixed and unordered", "7,1-2,2", []uint{1, 2, 7}),
+	)
+
+	table.DescribeTable("should reject invalid cpusets",
+		func(cpuset string) {
+			_, err := ParseCPUSet(cpuset)
+			Expect(err).To(HaveOccurred())
+		},
+		table.Entry("garbage", "a"),
+		table.Entry("reversed range", "3-1"),
+		table.Entry("open range", "1-"),
+	)
+
+	It("should convert a cpuset into a cpumap", func() {
+		Expect(CPUSetToCPUMap([]uint{1, 3})).To(Equal([]bool{false, true, false, true}))
+	})
+
+	It("should apply the whole plan", func() {
+		plan := &CPUPinningPlan{
+			VCPUs:     map[uint][]uint{0: {2}, 1: {3}},
+			Emulator:  []uint{1},
+			IOThreads: map[uint][]uint{1: {1}},
+		}
+		gomock.InOrder(
+			mockDomain.EXPECT().PinVcpuFlags(uint(0), []bool{false, false, true}, libvirt.DOMAIN_AFFECT_LIVE).Return(nil),
+			mockDomain.EXPECT().PinVcpuFlags(uint(1), []bool{false, false, false, true}, libvirt.DOMAIN_AFFECT_LIVE).Return(nil),
+			mockDomain.EXPECT().PinEmulator([]bool{false, true}, libvirt.DOMAIN_AFFECT_LIVE).Return(nil),
+			mockDomain.EXPECT().PinIOThread(uint(1), []bool{false, true}, libvirt.DOMAIN_AFFECT_LIVE).Return(nil),
+		)
+		Expect(ApplyCPUPinning(mockDomain, plan)).To(Succeed())
+	})
+
+	It("should stop on the first pinning failure", func() {
+		plan := &CPUPinningPlan{
+			VCPUs:    map[uint][]uint{0: {2}},
+			Emulator: []uint{1},
+		}
+		mockDomain.EXPECT().PinVcpuFlags(uint(0), gomock.Any(), libvirt.DOMAIN_AFFECT_LIVE).Return(fmt.Errorf("failure"))
+		Expect(ApplyCPUPinning(mockDomain, plan)).ToNot(Succeed())
+	})
+
+	It("should add IOThreads to running domains", func() {
+		mockDomain.EXPECT().AddIOThread(uint(2), libvirt.DOMAIN_AFFECT_LIVE).Return(nil)
+		Expect(AddIOThread(mockDomain, 2)).To(Succeed())
+		Expect(AddIOThread(mockDomain, 0)).ToNot(Succeed())
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+})
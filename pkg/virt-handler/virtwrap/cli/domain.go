@@ -0,0 +1,339 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package cli
+
+import (
+	"time"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+// instrumentedDomain records the latency and the errors of every call on a
+// domain, like the connection does for its own calls. Free only releases a
+// local reference and is passed through.
+type instrumentedDomain struct {
+	*libvirt.Domain
+}
+
+func newInstrumentedDomain(dom *libvirt.Domain) VirDomain {
+	return &instrumentedDomain{dom}
+}
+
+func (d *instrumentedDomain) GetState() (state libvirt.DomainState, reason int, err error) {
+	start := time.Now()
+	state, reason, err = d.Domain.GetState()
+	err = observeCall("DomainGetState", start, err)
+	return
+}
+
+func (d *instrumentedDomain) Create() error {
+	start := time.Now()
+	return observeCall("DomainCreate", start, d.Domain.Create())
+}
+
+func (d *instrumentedDomain) CreateWithFlags(flags libvirt.DomainCreateFlags) error {
+	start := time.Now()
+	return observeCall("DomainCreateWithFlags", start, d.Domain.CreateWithFlags(flags))
+}
+
+func (d *instrumentedDomain) Resume() error {
+	start := time.Now()
+	return observeCall("DomainResume", start, d.Domain.Resume())
+}
+
+func (d *instrumentedDomain) Shutdown() error {
+	start := time.Now()
+	return observeCall("DomainShutdown", start, d.Domain.Shutdown())
+}
+
+func (d *instrumentedDomain) Destroy() error {
+	start := time.Now()
+	return observeCall("DomainDestroy", start, d.Domain.Destroy())
+}
+
+func (d *instrumentedDomain) GetName() (result string, err error) {
+	start := time.Now()
+	result, err = d.Domain.GetName()
+	err = observeCall("DomainGetName", start, err)
+	return
+}
+
+func (d *instrumentedDomain) GetUUIDString() (result string, err error) {
+	start := time.Now()
+	result, err = d.Domain.GetUUIDString()
+	err = observeCall("DomainGetUUIDString", start, err)
+	return
+}
+
+func (d *instrumentedDomain) GetXMLDesc(flags libvirt.DomainXMLFlags) (result string, err error) {
+	start := time.Now()
+	result, err = d.Domain.GetXMLDesc(flags)
+	err = observeCall("DomainGetXMLDesc", start, err)
+	return
+}
+
+func (d *instrumentedDomain) Undefine() error {
+	start := time.Now()
+	return observeCall("DomainUndefine", start, d.Domain.Undefine())
+}
+
+func (d *instrumentedDomain) UndefineFlags(flags libvirt.DomainUndefineFlagsValues) error {
+	start := time.Now()
+	return observeCall("DomainUndefineFlags", start, d.Domain.UndefineFlags(flags))
+}
+
+func (d *instrumentedDomain) OpenConsole(devname string, stream *libvirt.Stream, flags libvirt.DomainConsoleFlags) error {
+	start := time.Now()
+	return observeCall("DomainOpenConsole", start, d.Domain.OpenConsole(devname, stream, flags))
+}
+
+func (d *instrumentedDomain) OpenChannel(name string, stream *libvirt.Stream, flags libvirt.DomainChannelFlags) error {
+	start := time.Now()
+	return observeCall("DomainOpenChannel", start, d.Domain.OpenChannel(name, stream, flags))
+}
+
+func (d *instrumentedDomain) PinVcpuFlags(vcpu uint, cpuMap []bool, flags libvirt.DomainModificationImpact) error {
+	start := time.Now()
+	return observeCall("DomainPinVcpuFlags", start, d.Domain.PinVcpuFlags(vcpu, cpuMap, flags))
+}
+
+func (d *instrumentedDomain) PinEmulator(cpuMap []bool, flags libvirt.DomainModificationImpact) error {
+	start := time.Now()
+	return observeCall("DomainPinEmulator", start, d.Domain.PinEmulator(cpuMap, flags))
+}
+
+func (d *instrumentedDomain) PinIOThread(iothreadid uint, cpuMap []bool, flags libvirt.DomainModificationImpact) error {
+	start := time.Now()
+	return observeCall("DomainPinIOThread", start, d.Domain.PinIOThread(iothreadid, cpuMap, flags))
+}
+
+func (d *instrumentedDomain) AddIOThread(id uint, flags libvirt.DomainModificationImpact) error {
+	start := time.Now()
+	return observeCall("DomainAddIOThread", start, d.Domain.AddIOThread(id, flags))
+}
+
+func (d *instrumentedDomain) GetBlockInfo(disk string, flags uint) (result *libvirt.DomainBlockInfo, err error) {
+	start := time.Now()
+	result, err = d.Domain.GetBlockInfo(disk, flags)
+	err = observeCall("DomainGetBlockInfo", start, err)
+	return
+}
+
+func (d *instrumentedDomain) BlockResize(disk string, size uint64, flags libvirt.DomainBlockResizeFlags) error {
+	start := time.Now()
+	return observeCall("DomainBlockResize", start, d.Domain.BlockResize(disk, size, flags))
+}
+
+func (d *instrumentedDomain) GetBlockIoTune(disk string, flags libvirt.DomainModificationImpact) (result *libvirt.DomainBlockIoTuneParameters, err error) {
+	start := time.Now()
+	result, err = d.Domain.GetBlockIoTune(disk, flags)
+	err = observeCall("DomainGetBlockIoTune", start, err)
+	return
+}
+
+func (d *instrumentedDomain) SetBlockIoTune(disk string, params *libvirt.DomainBlockIoTuneParameters, flags libvirt.DomainModificationImpact) error {
+	start := time.Now()
+	return observeCall("DomainSetBlockIoTune", start, d.Domain.SetBlockIoTune(disk, params, flags))
+}
+
+func (d *instrumentedDomain) GetInterfaceParameters(device string, flags libvirt.DomainModificationImpact) (result *libvirt.DomainInterfaceParameters, err error) {
+	start := time.Now()
+	result, err = d.Domain.GetInterfaceParameters(device, flags)
+	err = observeCall("DomainGetInterfaceParameters", start, err)
+	return
+}
+
+func (d *instrumentedDomain) SetInterfaceParameters(device string, params *libvirt.DomainInterfaceParameters, flags libvirt.DomainModificationImpact) error {
+	start := time.Now()
+	return observeCall("DomainSetInterfaceParameters", start, d.Domain.SetInterfaceParameters(device, params, flags))
+}
+
+func (d *instrumentedDomain) GetMetadata(metadataType libvirt.DomainMetadataType, uri string, flags libvirt.DomainModificationImpact) (result string, err error) {
+	start := time.Now()
+	result, err = d.Domain.GetMetadata(metadataType, uri, flags)
+	err = observeCall("DomainGetMetadata", start, err)
+	return
+}
+
+func (d *instrumentedDomain) SetMetadata(metadata string, metadataType libvirt.DomainMetadataType, key string, uri string, flags libvirt.DomainModificationImpact) error {
+	start := time.Now()
+	return observeCall("DomainSetMetadata", start, d.Domain.SetMetadata(metadata, metadataType, key, uri, flags))
+}
+
+func (d *instrumentedDomain) GetJobStats(flags libvirt.DomainGetJobStatsFlags) (result *libvirt.DomainJobInfo, err error) {
+	start := time.Now()
+	result, err = d.Domain.GetJobStats(flags)
+	err = observeCall("DomainGetJobStats", start, err)
+	return
+}
+
+func (d *instrumentedDomain) AbortJob() error {
+	start := time.Now()
+	return observeCall("DomainAbortJob", start, d.Domain.AbortJob())
+}
+
+func (d *instrumentedDomain) MigrateGetMaxSpeed(flags uint32) (result uint64, err error) {
+	start := time.Now()
+	result, err = d.Domain.MigrateGetMaxSpeed(flags)
+	err = observeCall("DomainMigrateGetMaxSpeed", start, err)
+	return
+}
+
+func (d *instrumentedDomain) MigrateSetMaxSpeed(speed uint64, flags uint32) error {
+	start := time.Now()
+	return observeCall("DomainMigrateSetMaxSpeed", start, d.Domain.MigrateSetMaxSpeed(speed, flags))
+}
+
+func (d *instrumentedDomain) MigrateSetMaxDowntime(downtime uint64, flags uint32) error {
+	start := time.Now()
+	return observeCall("DomainMigrateSetMaxDowntime", start, d.Domain.MigrateSetMaxDowntime(downtime, flags))
+}
+
+func (d *instrumentedDomain) MigrateStartPostCopy(flags uint32) error {
+	start := time.Now()
+	return observeCall("DomainMigrateStartPostCopy", start, d.Domain.MigrateStartPostCopy(flags))
+}
+
+func (d *instrumentedDomain) MemoryStats(nrStats uint32, flags uint32) (result []libvirt.DomainMemoryStat, err error) {
+	start := time.Now()
+	result, err = d.Domain.MemoryStats(nrStats, flags)
+	err = observeCall("DomainMemoryStats", start, err)
+	return
+}
+
+func (d *instrumentedDomain) ListAllInterfaceAddresses(src libvirt.DomainInterfaceAddressesSource) (result []libvirt.DomainInterface, err error) {
+	start := time.Now()
+	result, err = d.Domain.ListAllInterfaceAddresses(src)
+	err = observeCall("DomainListAllInterfaceAddresses", start, err)
+	return
+}
+
+func (d *instrumentedDomain) GetAutostart() (result bool, err error) {
+	start := time.Now()
+	result, err = d.Domain.GetAutostart()
+	err = observeCall("DomainGetAutostart", start, err)
+	return
+}
+
+func (d *instrumentedDomain) SetAutostart(autostart bool) error {
+	start := time.Now()
+	return observeCall("DomainSetAutostart", start, d.Domain.SetAutostart(autostart))
+}
+
+func (d *instrumentedDomain) Rename(name string, flags uint32) error {
+	start := time.Now()
+	return observeCall("DomainRename", start, d.Domain.Rename(name, flags))
+}
+
+func (d *instrumentedDomain) CoreDump(to string, flags libvirt.DomainCoreDumpFlags) error {
+	start := time.Now()
+	return observeCall("DomainCoreDump", start, d.Domain.CoreDump(to, flags))
+}
+
+func (d *instrumentedDomain) CoreDumpWithFormat(to string, format libvirt.DomainCoreDumpFormat, flags libvirt.DomainCoreDumpFlags) error {
+	start := time.Now()
+	return observeCall("DomainCoreDumpWithFormat", start, d.Domain.CoreDumpWithFormat(to, format, flags))
+}
+
+func (d *instrumentedDomain) Screenshot(stream *libvirt.Stream, screen uint32, flags uint32) (result string, err error) {
+	start := time.Now()
+	result, err = d.Domain.Screenshot(stream, screen, flags)
+	err = observeCall("DomainScreenshot", start, err)
+	return
+}
+
+func (d *instrumentedDomain) SendKey(codeset uint, holdtime uint, keycodes []uint, flags uint32) error {
+	start := time.Now()
+	return observeCall("DomainSendKey", start, d.Domain.SendKey(codeset, holdtime, keycodes, flags))
+}
+
+func (d *instrumentedDomain) GetPerfEvents(flags libvirt.DomainModificationImpact) (result *libvirt.DomainPerfEvents, err error) {
+	start := time.Now()
+	result, err = d.Domain.GetPerfEvents(flags)
+	err = observeCall("DomainGetPerfEvents", start, err)
+	return
+}
+
+func (d *instrumentedDomain) SetPerfEvents(params *libvirt.DomainPerfEvents, flags libvirt.DomainModificationImpact) error {
+	start := time.Now()
+	return observeCall("DomainSetPerfEvents", start, d.Domain.SetPerfEvents(params, flags))
+}
+
+func (d *instrumentedDomain) QemuMonitorCommand(command string, flags libvirt.DomainQemuMonitorCommandFlags) (result string, err error) {
+	start := time.Now()
+	result, err = d.Domain.QemuMonitorCommand(command, flags)
+	err = observeCall("DomainQemuMonitorCommand", start, err)
+	return
+}
+
+func (d *instrumentedDomain) QemuAgentCommand(command string, timeout libvirt.DomainQemuAgentCommandTimeout, flags uint32) (result string, err error) {
+	start := time.Now()
+	result, err = d.Domain.QemuAgentCommand(command, timeout, flags)
+	err = observeCall("DomainQemuAgentCommand", start, err)
+	return
+}
+
+func (d *instrumentedDomain) FSTrim(mountpoint string, minimum uint64, flags uint32) error {
+	start := time.Now()
+	return observeCall("DomainFSTrim", start, d.Domain.FSTrim(mountpoint, minimum, flags))
+}
+
+func (d *instrumentedDomain) GetCPUStats(startCpu int, nCpus uint, flags uint32) (result []libvirt.DomainCPUStats, err error) {
+	start := time.Now()
+	result, err = d.Domain.GetCPUStats(startCpu, nCpus, flags)
+	err = observeCall("DomainGetCPUStats", start, err)
+	return
+}
+
+func (d *instrumentedDomain) GetSchedulerParametersFlags(flags libvirt.DomainModificationImpact) (result *libvirt.DomainSchedulerParameters, err error) {
+	start := time.Now()
+	result, err = d.Domain.GetSchedulerParametersFlags(flags)
+	err = observeCall("DomainGetSchedulerParametersFlags", start, err)
+	return
+}
+
+func (d *instrumentedDomain) SetSchedulerParametersFlags(params *libvirt.DomainSchedulerParameters, flags libvirt.DomainModificationImpact) error {
+	start := time.Now()
+	return observeCall("DomainSetSchedulerParametersFlags", start, d.Domain.SetSchedulerParametersFlags(params, flags))
+}
+
+func (d *instrumentedDomain) GetMemoryParameters(flags libvirt.DomainModificationImpact) (result *libvirt.DomainMemoryParameters, err error) {
+	start := time.Now()
+	result, err = d.Domain.GetMemoryParameters(flags)
+	err = observeCall("DomainGetMemoryParameters", start, err)
+	return
+}
+
+func (d *instrumentedDomain) SetMemoryParameters(params *libvirt.DomainMemoryParameters, flags libvirt.DomainModificationImpact) error {
+	start := time.Now()
+	return observeCall("DomainSetMemoryParameters", start, d.Domain.SetMemoryParameters(params, flags))
+}
+
+func (d *instrumentedDomain) GetBlkioParameters(flags libvirt.DomainModificationImpact) (result *libvirt.DomainBlkioParameters, err error) {
+	start := time.Now()
+	result, err = d.Domain.GetBlkioParameters(flags)
+	err = observeCall("DomainGetBlkioParameters", start, err)
+	return
+}
+
+func (d *instrumentedDomain) SetBlkioParameters(params *libvirt.DomainBlkioParameters, flags libvirt.DomainModificationImpact) error {
+	start := time.Now()
+	return observeCall("DomainSetBlkioParameters", start, d.Domain.SetBlkioParameters(params, flags))
+}
@@ -0,0 +1,97 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package cli
+
+import "fmt"
+
+type Feature string
+
+const (
+	FeaturePostCopyMigration      Feature = "PostCopyMigration"
+	FeatureTLSMigration           Feature = "TLSMigration"
+	FeatureParallelMigration      Feature = "ParallelMigration"
+	FeatureMigrationListenAddress Feature = "MigrationListenAddress"
+	FeatureTPMEmulator            Feature = "TPMEmulator"
+	FeatureHypervFrequencies      Feature = "HypervFrequencies"
+)
+
+// Versions are encoded like libvirt does it, major * 1,000,000 +
+// minor * 1,000 + release.
+type requiredVersions struct {
+	libvirt uint32
+	qemu    uint32
+}
+
+var featureVersions = map[Feature]requiredVersions{
+	FeaturePostCopyMigration:      {libvirt: 1003003, qemu: 2005000},
+	FeatureTLSMigration:           {libvirt: 3002000, qemu: 2009000},
+	FeatureParallelMigration:      {libvirt: 5002000, qemu: 4000000},
+	FeatureMigrationListenAddress: {libvirt: 4004000, qemu: 0},
+	FeatureTPMEmulator:            {libvirt: 4005000, qemu: 2011000},
+	FeatureHypervFrequencies:      {libvirt: 4007000, qemu: 2012000},
+}
+
+// HypervisorVersion holds the versions of libvirt and of the hypervisor
+// behind it, to let callers find out what the host supports before libvirt
+// fails with a less obvious error.
+type HypervisorVersion struct {
+	Libvirt uint32
+	Qemu    uint32
+}
+
+func GetHypervisorVersion(conn Connection) (*HypervisorVersion, error) {
+	libvirtVersion, err := conn.GetLibVersion()
+	if err != nil {
+		return nil, err
+	}
+	qemuVersion, err := conn.GetVersion()
+	if err != nil {
+		return nil, err
+	}
+	return &HypervisorVersion{Libvirt: libvirtVersion, Qemu: qemuVersion}, nil
+}
+
+// SupportsFeature returns whether libvirt and qemu are recent enough for the
+// feature. Unknown features are never supported.
+func (v *HypervisorVersion) SupportsFeature(f Feature) bool {
+	required, known := featureVersions[f]
+	if !known {
+		return false
+	}
+	return v.Libvirt >= required.libvirt && v.Qemu >= required.qemu
+}
+
+// RequireFeature returns an error which names the missing versions, if the
+// feature is not supported.
+func (v *HypervisorVersion) RequireFeature(f Feature) error {
+	if v.SupportsFeature(f) {
+		return nil
+	}
+	required, known := featureVersions[f]
+	if !known {
+		return fmt.Errorf("unknown feature %s", f)
+	}
+	return fmt.Errorf("%s requires libvirt %s and qemu %s, the host has libvirt %s and qemu %s",
+		f, formatVersion(required.libvirt), formatVersion(required.qemu), formatVersion(v.Libvirt), formatVersion(v.Qemu))
+}
+
+func formatVersion(version uint32) string {
+	return fmt.Sprintf("%d.%d.%d", version/1000000, version/1000%1000, version%1000)
+}
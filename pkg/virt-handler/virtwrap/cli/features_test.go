@@ -0,0 +1,71 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package cli
+
+import (
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Hypervisor features", func() {
+	var ctrl *gomock.Controller
+	var mockConn *MockConnection
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockConn = NewMockConnection(ctrl)
+	})
+
+	It("should query the libvirt and qemu versions", func() {
+		mockConn.EXPECT().GetLibVersion().Return(uint32(3002000), nil)
+		mockConn.EXPECT().GetVersion().Return(uint32(2009001), nil)
+
+		version, err := GetHypervisorVersion(mockConn)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(*version).To(Equal(HypervisorVersion{Libvirt: 3002000, Qemu: 2009001}))
+	})
+
+	table.DescribeTable("should gate features on the versions",
+		func(libvirtVersion uint32, qemuVersion uint32, feature Feature, supported bool) {
+			version := &HypervisorVersion{Libvirt: libvirtVersion, Qemu: qemuVersion}
+			Expect(version.SupportsFeature(feature)).To(Equal(supported))
+			if supported {
+				Expect(version.RequireFeature(feature)).To(Succeed())
+			} else {
+				Expect(version.RequireFeature(feature)).ToNot(Succeed())
+			}
+		},
+		table.Entry("with recent enough versions", uint32(3002000), uint32(2009000), FeatureTLSMigration, true),
+		table.Entry("with a too old libvirt", uint32(3001000), uint32(2009000), FeatureTLSMigration, false),
+		table.Entry("with a too old qemu", uint32(3002000), uint32(2008000), FeatureTLSMigration, false),
+		table.Entry("with an unknown feature", uint32(9000000), uint32(9000000), Feature("Teleport"), false),
+	)
+
+	It("should name the required versions", func() {
+		version := &HypervisorVersion{Libvirt: 4000000, Qemu: 2011000}
+		Expect(version.RequireFeature(FeatureParallelMigration)).To(MatchError("ParallelMigration requires libvirt 5.2.0 and qemu 4.0.0, the host has libvirt 4.0.0 and qemu 2.11.0"))
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+})
@@ -5,7 +5,11 @@ package cli
 
 import (
 	gomock "github.com/golang/mock/gomock"
-	libvirt_go "github.com/libvirt/libvirt-go"
+	context "golang.org/x/net/context"
+	io "io"
+	os "os"
+
+	libvirt "kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
 )
 
 // Mock of Connection interface
@@ -40,6 +44,17 @@ func (_mr *_MockConnectionRecorder) LookupDomainByName(arg0 interface{}) *gomock
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "LookupDomainByName", arg0)
 }
 
+func (_m *MockConnection) LookupDomainByUUIDString(uuid string) (VirDomain, error) {
+	ret := _m.ctrl.Call(_m, "LookupDomainByUUIDString", uuid)
+	ret0, _ := ret[0].(VirDomain)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockConnectionRecorder) LookupDomainByUUIDString(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "LookupDomainByUUIDString", arg0)
+}
+
 func (_m *MockConnection) DomainDefineXML(xml string) (VirDomain, error) {
 	ret := _m.ctrl.Call(_m, "DomainDefineXML", xml)
 	ret0, _ := ret[0].(VirDomain)
@@ -51,6 +66,17 @@ func (_mr *_MockConnectionRecorder) DomainDefineXML(arg0 interface{}) *gomock.Ca
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "DomainDefineXML", arg0)
 }
 
+func (_m *MockConnection) DomainDefineXMLFlags(xml string, flags libvirt.DomainDefineFlags) (VirDomain, error) {
+	ret := _m.ctrl.Call(_m, "DomainDefineXMLFlags", xml, flags)
+	ret0, _ := ret[0].(VirDomain)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockConnectionRecorder) DomainDefineXMLFlags(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "DomainDefineXMLFlags", arg0, arg1)
+}
+
 func (_m *MockConnection) Close() (int, error) {
 	ret := _m.ctrl.Call(_m, "Close")
 	ret0, _ := ret[0].(int)
@@ -62,7 +88,7 @@ func (_mr *_MockConnectionRecorder) Close() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Close")
 }
 
-func (_m *MockConnection) DomainEventLifecycleRegister(callback libvirt_go.DomainEventLifecycleCallback) error {
+func (_m *MockConnection) DomainEventLifecycleRegister(callback libvirt.DomainEventLifecycleCallback) error {
 	ret := _m.ctrl.Call(_m, "DomainEventLifecycleRegister", callback)
 	ret0, _ := ret[0].(error)
 	return ret0
@@ -72,7 +98,57 @@ func (_mr *_MockConnectionRecorder) DomainEventLifecycleRegister(arg0 interface{
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "DomainEventLifecycleRegister", arg0)
 }
 
-func (_m *MockConnection) ListAllDomains(flags libvirt_go.ConnectListAllDomainsFlags) ([]VirDomain, error) {
+func (_m *MockConnection) DomainEventWatchdogRegister(callback libvirt.DomainEventWatchdogCallback) error {
+	ret := _m.ctrl.Call(_m, "DomainEventWatchdogRegister", callback)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockConnectionRecorder) DomainEventWatchdogRegister(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "DomainEventWatchdogRegister", arg0)
+}
+
+func (_m *MockConnection) DomainEventDeviceAddedRegister(callback libvirt.DomainEventDeviceAddedCallback) error {
+	ret := _m.ctrl.Call(_m, "DomainEventDeviceAddedRegister", callback)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockConnectionRecorder) DomainEventDeviceAddedRegister(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "DomainEventDeviceAddedRegister", arg0)
+}
+
+func (_m *MockConnection) DomainEventDeviceRemovedRegister(callback libvirt.DomainEventDeviceRemovedCallback) error {
+	ret := _m.ctrl.Call(_m, "DomainEventDeviceRemovedRegister", callback)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockConnectionRecorder) DomainEventDeviceRemovedRegister(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "DomainEventDeviceRemovedRegister", arg0)
+}
+
+func (_m *MockConnection) DomainEventRTCChangeRegister(callback libvirt.DomainEventRTCChangeCallback) error {
+	ret := _m.ctrl.Call(_m, "DomainEventRTCChangeRegister", callback)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockConnectionRecorder) DomainEventRTCChangeRegister(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "DomainEventRTCChangeRegister", arg0)
+}
+
+func (_m *MockConnection) DomainEventAgentLifecycleRegister(callback libvirt.DomainEventAgentLifecycleCallback) error {
+	ret := _m.ctrl.Call(_m, "DomainEventAgentLifecycleRegister", callback)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockConnectionRecorder) DomainEventAgentLifecycleRegister(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "DomainEventAgentLifecycleRegister", arg0)
+}
+
+func (_m *MockConnection) ListAllDomains(flags libvirt.ConnectListAllDomainsFlags) ([]VirDomain, error) {
 	ret := _m.ctrl.Call(_m, "ListAllDomains", flags)
 	ret0, _ := ret[0].([]VirDomain)
 	ret1, _ := ret[1].(error)
@@ -83,7 +159,7 @@ func (_mr *_MockConnectionRecorder) ListAllDomains(arg0 interface{}) *gomock.Cal
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "ListAllDomains", arg0)
 }
 
-func (_m *MockConnection) NewStream(flags libvirt_go.StreamFlags) (Stream, error) {
+func (_m *MockConnection) NewStream(flags libvirt.StreamFlags) (Stream, error) {
 	ret := _m.ctrl.Call(_m, "NewStream", flags)
 	ret0, _ := ret[0].(Stream)
 	ret1, _ := ret[1].(error)
@@ -94,7 +170,7 @@ func (_mr *_MockConnectionRecorder) NewStream(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "NewStream", arg0)
 }
 
-func (_m *MockConnection) LookupSecretByUsage(usageType libvirt_go.SecretUsageType, usageID string) (VirSecret, error) {
+func (_m *MockConnection) LookupSecretByUsage(usageType libvirt.SecretUsageType, usageID string) (VirSecret, error) {
 	ret := _m.ctrl.Call(_m, "LookupSecretByUsage", usageType, usageID)
 	ret0, _ := ret[0].(VirSecret)
 	ret1, _ := ret[1].(error)
@@ -138,7 +214,7 @@ func (_mr *_MockConnectionRecorder) LookupSecretByUUIDString(arg0 interface{}) *
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "LookupSecretByUUIDString", arg0)
 }
 
-func (_m *MockConnection) ListAllSecrets(flags libvirt_go.ConnectListAllSecretsFlags) ([]VirSecret, error) {
+func (_m *MockConnection) ListAllSecrets(flags libvirt.ConnectListAllSecretsFlags) ([]VirSecret, error) {
 	ret := _m.ctrl.Call(_m, "ListAllSecrets", flags)
 	ret0, _ := ret[0].([]VirSecret)
 	ret1, _ := ret[1].(error)
@@ -149,6 +225,160 @@ func (_mr *_MockConnectionRecorder) ListAllSecrets(arg0 interface{}) *gomock.Cal
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "ListAllSecrets", arg0)
 }
 
+func (_m *MockConnection) GetCapabilities() (string, error) {
+	ret := _m.ctrl.Call(_m, "GetCapabilities")
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockConnectionRecorder) GetCapabilities() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetCapabilities")
+}
+
+func (_m *MockConnection) GetDomainCapabilities(emulatorbin string, arch string, machine string, virttype string, flags uint32) (string, error) {
+	ret := _m.ctrl.Call(_m, "GetDomainCapabilities", emulatorbin, arch, machine, virttype, flags)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockConnectionRecorder) GetDomainCapabilities(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetDomainCapabilities", arg0, arg1, arg2, arg3, arg4)
+}
+
+func (_m *MockConnection) GetLibVersion() (uint32, error) {
+	ret := _m.ctrl.Call(_m, "GetLibVersion")
+	ret0, _ := ret[0].(uint32)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockConnectionRecorder) GetLibVersion() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetLibVersion")
+}
+
+func (_m *MockConnection) GetVersion() (uint32, error) {
+	ret := _m.ctrl.Call(_m, "GetVersion")
+	ret0, _ := ret[0].(uint32)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockConnectionRecorder) GetVersion() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetVersion")
+}
+
+func (_m *MockConnection) GetFreePages(pageSizes []uint64, startCell int, maxCells uint, flags uint32) ([]uint64, error) {
+	ret := _m.ctrl.Call(_m, "GetFreePages", pageSizes, startCell, maxCells, flags)
+	ret0, _ := ret[0].([]uint64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockConnectionRecorder) GetFreePages(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetFreePages", arg0, arg1, arg2, arg3)
+}
+
+func (_m *MockConnection) ListAllNodeDevices(flags libvirt.ConnectListAllNodeDeviceFlags) ([]VirNodeDevice, error) {
+	ret := _m.ctrl.Call(_m, "ListAllNodeDevices", flags)
+	ret0, _ := ret[0].([]VirNodeDevice)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockConnectionRecorder) ListAllNodeDevices(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "ListAllNodeDevices", arg0)
+}
+
+func (_m *MockConnection) LookupNodeDeviceByName(name string) (VirNodeDevice, error) {
+	ret := _m.ctrl.Call(_m, "LookupNodeDeviceByName", name)
+	ret0, _ := ret[0].(VirNodeDevice)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockConnectionRecorder) LookupNodeDeviceByName(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "LookupNodeDeviceByName", arg0)
+}
+
+func (_m *MockConnection) StoragePoolDefineXML(xml string) (VirStoragePool, error) {
+	ret := _m.ctrl.Call(_m, "StoragePoolDefineXML", xml)
+	ret0, _ := ret[0].(VirStoragePool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockConnectionRecorder) StoragePoolDefineXML(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "StoragePoolDefineXML", arg0)
+}
+
+func (_m *MockConnection) LookupStoragePoolByName(name string) (VirStoragePool, error) {
+	ret := _m.ctrl.Call(_m, "LookupStoragePoolByName", name)
+	ret0, _ := ret[0].(VirStoragePool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockConnectionRecorder) LookupStoragePoolByName(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "LookupStoragePoolByName", arg0)
+}
+
+func (_m *MockConnection) ListAllStoragePools(flags libvirt.ConnectListAllStoragePoolsFlags) ([]VirStoragePool, error) {
+	ret := _m.ctrl.Call(_m, "ListAllStoragePools", flags)
+	ret0, _ := ret[0].([]VirStoragePool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockConnectionRecorder) ListAllStoragePools(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "ListAllStoragePools", arg0)
+}
+
+func (_m *MockConnection) NWFilterDefineXML(xml string) (VirNWFilter, error) {
+	ret := _m.ctrl.Call(_m, "NWFilterDefineXML", xml)
+	ret0, _ := ret[0].(VirNWFilter)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockConnectionRecorder) NWFilterDefineXML(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "NWFilterDefineXML", arg0)
+}
+
+func (_m *MockConnection) LookupNWFilterByName(name string) (VirNWFilter, error) {
+	ret := _m.ctrl.Call(_m, "LookupNWFilterByName", name)
+	ret0, _ := ret[0].(VirNWFilter)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockConnectionRecorder) LookupNWFilterByName(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "LookupNWFilterByName", arg0)
+}
+
+func (_m *MockConnection) ListAllNWFilters(flags uint32) ([]VirNWFilter, error) {
+	ret := _m.ctrl.Call(_m, "ListAllNWFilters", flags)
+	ret0, _ := ret[0].([]VirNWFilter)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockConnectionRecorder) ListAllNWFilters(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "ListAllNWFilters", arg0)
+}
+
+func (_m *MockConnection) GetAllDomainStats(statsTypes libvirt.DomainStatsTypes, flags libvirt.ConnectGetAllDomainStatsFlags) ([]*DomainStats, error) {
+	ret := _m.ctrl.Call(_m, "GetAllDomainStats", statsTypes, flags)
+	ret0, _ := ret[0].([]*DomainStats)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockConnectionRecorder) GetAllDomainStats(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetAllDomainStats", arg0, arg1)
+}
+
 // Mock of Stream interface
 type MockStream struct {
 	ctrl     *gomock.Controller
@@ -202,9 +432,93 @@ func (_mr *_MockStreamRecorder) Close() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Close")
 }
 
-func (_m *MockStream) UnderlyingStream() *libvirt_go.Stream {
+func (_m *MockStream) CopyToStream(ctx context.Context, reader io.Reader, opts CopyOptions) (int64, error) {
+	ret := _m.ctrl.Call(_m, "CopyToStream", ctx, reader, opts)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockStreamRecorder) CopyToStream(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "CopyToStream", arg0, arg1, arg2)
+}
+
+func (_m *MockStream) CopyFromStream(ctx context.Context, writer io.Writer, opts CopyOptions) (int64, error) {
+	ret := _m.ctrl.Call(_m, "CopyFromStream", ctx, writer, opts)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockStreamRecorder) CopyFromStream(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "CopyFromStream", arg0, arg1, arg2)
+}
+
+func (_m *MockStream) CopyToStreamSparse(ctx context.Context, file *os.File, opts CopyOptions) (int64, error) {
+	ret := _m.ctrl.Call(_m, "CopyToStreamSparse", ctx, file, opts)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockStreamRecorder) CopyToStreamSparse(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "CopyToStreamSparse", arg0, arg1, arg2)
+}
+
+func (_m *MockStream) CopyFromStreamSparse(ctx context.Context, file *os.File, opts CopyOptions) (int64, error) {
+	ret := _m.ctrl.Call(_m, "CopyFromStreamSparse", ctx, file, opts)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockStreamRecorder) CopyFromStreamSparse(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "CopyFromStreamSparse", arg0, arg1, arg2)
+}
+
+func (_m *MockStream) ServeEvents(ctx context.Context, peer io.ReadWriteCloser, opts CopyOptions) error {
+	ret := _m.ctrl.Call(_m, "ServeEvents", ctx, peer, opts)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockStreamRecorder) ServeEvents(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "ServeEvents", arg0, arg1, arg2)
+}
+
+func (_m *MockStream) Finish() error {
+	ret := _m.ctrl.Call(_m, "Finish")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockStreamRecorder) Finish() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Finish")
+}
+
+func (_m *MockStream) Abort() error {
+	ret := _m.ctrl.Call(_m, "Abort")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockStreamRecorder) Abort() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Abort")
+}
+
+func (_m *MockStream) Free() error {
+	ret := _m.ctrl.Call(_m, "Free")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockStreamRecorder) Free() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Free")
+}
+
+func (_m *MockStream) UnderlyingStream() *libvirt.Stream {
 	ret := _m.ctrl.Call(_m, "UnderlyingStream")
-	ret0, _ := ret[0].(*libvirt_go.Stream)
+	ret0, _ := ret[0].(*libvirt.Stream)
 	return ret0
 }
 
@@ -296,6 +610,89 @@ func (_mr *_MockVirSecretRecorder) Free() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Free")
 }
 
+// Mock of VirNodeDevice interface
+type MockVirNodeDevice struct {
+	ctrl     *gomock.Controller
+	recorder *_MockVirNodeDeviceRecorder
+}
+
+// Recorder for MockVirNodeDevice (not exported)
+type _MockVirNodeDeviceRecorder struct {
+	mock *MockVirNodeDevice
+}
+
+func NewMockVirNodeDevice(ctrl *gomock.Controller) *MockVirNodeDevice {
+	mock := &MockVirNodeDevice{ctrl: ctrl}
+	mock.recorder = &_MockVirNodeDeviceRecorder{mock}
+	return mock
+}
+
+func (_m *MockVirNodeDevice) EXPECT() *_MockVirNodeDeviceRecorder {
+	return _m.recorder
+}
+
+func (_m *MockVirNodeDevice) GetName() (string, error) {
+	ret := _m.ctrl.Call(_m, "GetName")
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockVirNodeDeviceRecorder) GetName() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetName")
+}
+
+func (_m *MockVirNodeDevice) GetXMLDesc(flags uint32) (string, error) {
+	ret := _m.ctrl.Call(_m, "GetXMLDesc", flags)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockVirNodeDeviceRecorder) GetXMLDesc(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetXMLDesc", arg0)
+}
+
+func (_m *MockVirNodeDevice) Detach() error {
+	ret := _m.ctrl.Call(_m, "Detach")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirNodeDeviceRecorder) Detach() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Detach")
+}
+
+func (_m *MockVirNodeDevice) ReAttach() error {
+	ret := _m.ctrl.Call(_m, "ReAttach")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirNodeDeviceRecorder) ReAttach() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "ReAttach")
+}
+
+func (_m *MockVirNodeDevice) Reset() error {
+	ret := _m.ctrl.Call(_m, "Reset")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirNodeDeviceRecorder) Reset() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Reset")
+}
+
+func (_m *MockVirNodeDevice) Free() error {
+	ret := _m.ctrl.Call(_m, "Free")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirNodeDeviceRecorder) Free() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Free")
+}
+
 // Mock of VirDomain interface
 type MockVirDomain struct {
 	ctrl     *gomock.Controller
@@ -317,9 +714,9 @@ func (_m *MockVirDomain) EXPECT() *_MockVirDomainRecorder {
 	return _m.recorder
 }
 
-func (_m *MockVirDomain) GetState() (libvirt_go.DomainState, int, error) {
+func (_m *MockVirDomain) GetState() (libvirt.DomainState, int, error) {
 	ret := _m.ctrl.Call(_m, "GetState")
-	ret0, _ := ret[0].(libvirt_go.DomainState)
+	ret0, _ := ret[0].(libvirt.DomainState)
 	ret1, _ := ret[1].(int)
 	ret2, _ := ret[2].(error)
 	return ret0, ret1, ret2
@@ -339,6 +736,16 @@ func (_mr *_MockVirDomainRecorder) Create() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Create")
 }
 
+func (_m *MockVirDomain) CreateWithFlags(flags libvirt.DomainCreateFlags) error {
+	ret := _m.ctrl.Call(_m, "CreateWithFlags", flags)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirDomainRecorder) CreateWithFlags(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "CreateWithFlags", arg0)
+}
+
 func (_m *MockVirDomain) Resume() error {
 	ret := _m.ctrl.Call(_m, "Resume")
 	ret0, _ := ret[0].(error)
@@ -349,6 +756,16 @@ func (_mr *_MockVirDomainRecorder) Resume() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Resume")
 }
 
+func (_m *MockVirDomain) Shutdown() error {
+	ret := _m.ctrl.Call(_m, "Shutdown")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirDomainRecorder) Shutdown() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Shutdown")
+}
+
 func (_m *MockVirDomain) Destroy() error {
 	ret := _m.ctrl.Call(_m, "Destroy")
 	ret0, _ := ret[0].(error)
@@ -381,7 +798,7 @@ func (_mr *_MockVirDomainRecorder) GetUUIDString() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetUUIDString")
 }
 
-func (_m *MockVirDomain) GetXMLDesc(flags libvirt_go.DomainXMLFlags) (string, error) {
+func (_m *MockVirDomain) GetXMLDesc(flags libvirt.DomainXMLFlags) (string, error) {
 	ret := _m.ctrl.Call(_m, "GetXMLDesc", flags)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(error)
@@ -402,7 +819,17 @@ func (_mr *_MockVirDomainRecorder) Undefine() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Undefine")
 }
 
-func (_m *MockVirDomain) OpenConsole(devname string, stream *libvirt_go.Stream, flags libvirt_go.DomainConsoleFlags) error {
+func (_m *MockVirDomain) UndefineFlags(flags libvirt.DomainUndefineFlagsValues) error {
+	ret := _m.ctrl.Call(_m, "UndefineFlags", flags)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirDomainRecorder) UndefineFlags(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "UndefineFlags", arg0)
+}
+
+func (_m *MockVirDomain) OpenConsole(devname string, stream *libvirt.Stream, flags libvirt.DomainConsoleFlags) error {
 	ret := _m.ctrl.Call(_m, "OpenConsole", devname, stream, flags)
 	ret0, _ := ret[0].(error)
 	return ret0
@@ -412,8 +839,425 @@ func (_mr *_MockVirDomainRecorder) OpenConsole(arg0, arg1, arg2 interface{}) *go
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "OpenConsole", arg0, arg1, arg2)
 }
 
-func (_m *MockVirDomain) Free() error {
-	ret := _m.ctrl.Call(_m, "Free")
+func (_m *MockVirDomain) OpenChannel(name string, stream *libvirt.Stream, flags libvirt.DomainChannelFlags) error {
+	ret := _m.ctrl.Call(_m, "OpenChannel", name, stream, flags)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirDomainRecorder) OpenChannel(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "OpenChannel", arg0, arg1, arg2)
+}
+
+func (_m *MockVirDomain) PinVcpuFlags(vcpu uint, cpuMap []bool, flags libvirt.DomainModificationImpact) error {
+	ret := _m.ctrl.Call(_m, "PinVcpuFlags", vcpu, cpuMap, flags)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirDomainRecorder) PinVcpuFlags(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "PinVcpuFlags", arg0, arg1, arg2)
+}
+
+func (_m *MockVirDomain) PinEmulator(cpuMap []bool, flags libvirt.DomainModificationImpact) error {
+	ret := _m.ctrl.Call(_m, "PinEmulator", cpuMap, flags)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirDomainRecorder) PinEmulator(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "PinEmulator", arg0, arg1)
+}
+
+func (_m *MockVirDomain) PinIOThread(iothreadid uint, cpuMap []bool, flags libvirt.DomainModificationImpact) error {
+	ret := _m.ctrl.Call(_m, "PinIOThread", iothreadid, cpuMap, flags)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirDomainRecorder) PinIOThread(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "PinIOThread", arg0, arg1, arg2)
+}
+
+func (_m *MockVirDomain) AddIOThread(id uint, flags libvirt.DomainModificationImpact) error {
+	ret := _m.ctrl.Call(_m, "AddIOThread", id, flags)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirDomainRecorder) AddIOThread(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "AddIOThread", arg0, arg1)
+}
+
+func (_m *MockVirDomain) GetBlockInfo(disk string, flags uint) (*libvirt.DomainBlockInfo, error) {
+	ret := _m.ctrl.Call(_m, "GetBlockInfo", disk, flags)
+	ret0, _ := ret[0].(*libvirt.DomainBlockInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockVirDomainRecorder) GetBlockInfo(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetBlockInfo", arg0, arg1)
+}
+
+func (_m *MockVirDomain) BlockResize(disk string, size uint64, flags libvirt.DomainBlockResizeFlags) error {
+	ret := _m.ctrl.Call(_m, "BlockResize", disk, size, flags)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirDomainRecorder) BlockResize(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "BlockResize", arg0, arg1, arg2)
+}
+
+func (_m *MockVirDomain) GetBlockIoTune(disk string, flags libvirt.DomainModificationImpact) (*libvirt.DomainBlockIoTuneParameters, error) {
+	ret := _m.ctrl.Call(_m, "GetBlockIoTune", disk, flags)
+	ret0, _ := ret[0].(*libvirt.DomainBlockIoTuneParameters)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockVirDomainRecorder) GetBlockIoTune(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetBlockIoTune", arg0, arg1)
+}
+
+func (_m *MockVirDomain) SetBlockIoTune(disk string, params *libvirt.DomainBlockIoTuneParameters, flags libvirt.DomainModificationImpact) error {
+	ret := _m.ctrl.Call(_m, "SetBlockIoTune", disk, params, flags)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirDomainRecorder) SetBlockIoTune(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetBlockIoTune", arg0, arg1, arg2)
+}
+
+func (_m *MockVirDomain) GetInterfaceParameters(device string, flags libvirt.DomainModificationImpact) (*libvirt.DomainInterfaceParameters, error) {
+	ret := _m.ctrl.Call(_m, "GetInterfaceParameters", device, flags)
+	ret0, _ := ret[0].(*libvirt.DomainInterfaceParameters)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockVirDomainRecorder) GetInterfaceParameters(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetInterfaceParameters", arg0, arg1)
+}
+
+func (_m *MockVirDomain) SetInterfaceParameters(device string, params *libvirt.DomainInterfaceParameters, flags libvirt.DomainModificationImpact) error {
+	ret := _m.ctrl.Call(_m, "SetInterfaceParameters", device, params, flags)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirDomainRecorder) SetInterfaceParameters(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetInterfaceParameters", arg0, arg1, arg2)
+}
+
+func (_m *MockVirDomain) GetMetadata(metadataType libvirt.DomainMetadataType, uri string, flags libvirt.DomainModificationImpact) (string, error) {
+	ret := _m.ctrl.Call(_m, "GetMetadata", metadataType, uri, flags)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockVirDomainRecorder) GetMetadata(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetMetadata", arg0, arg1, arg2)
+}
+
+func (_m *MockVirDomain) SetMetadata(metadata string, metadataType libvirt.DomainMetadataType, key string, uri string, flags libvirt.DomainModificationImpact) error {
+	ret := _m.ctrl.Call(_m, "SetMetadata", metadata, metadataType, key, uri, flags)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirDomainRecorder) SetMetadata(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetMetadata", arg0, arg1, arg2, arg3, arg4)
+}
+
+func (_m *MockVirDomain) GetJobStats(flags libvirt.DomainGetJobStatsFlags) (*libvirt.DomainJobInfo, error) {
+	ret := _m.ctrl.Call(_m, "GetJobStats", flags)
+	ret0, _ := ret[0].(*libvirt.DomainJobInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockVirDomainRecorder) GetJobStats(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetJobStats", arg0)
+}
+
+func (_m *MockVirDomain) AbortJob() error {
+	ret := _m.ctrl.Call(_m, "AbortJob")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirDomainRecorder) AbortJob() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "AbortJob")
+}
+
+func (_m *MockVirDomain) MigrateGetMaxSpeed(flags uint32) (uint64, error) {
+	ret := _m.ctrl.Call(_m, "MigrateGetMaxSpeed", flags)
+	ret0, _ := ret[0].(uint64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockVirDomainRecorder) MigrateGetMaxSpeed(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "MigrateGetMaxSpeed", arg0)
+}
+
+func (_m *MockVirDomain) MigrateSetMaxSpeed(speed uint64, flags uint32) error {
+	ret := _m.ctrl.Call(_m, "MigrateSetMaxSpeed", speed, flags)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirDomainRecorder) MigrateSetMaxSpeed(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "MigrateSetMaxSpeed", arg0, arg1)
+}
+
+func (_m *MockVirDomain) MigrateSetMaxDowntime(downtime uint64, flags uint32) error {
+	ret := _m.ctrl.Call(_m, "MigrateSetMaxDowntime", downtime, flags)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirDomainRecorder) MigrateSetMaxDowntime(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "MigrateSetMaxDowntime", arg0, arg1)
+}
+
+func (_m *MockVirDomain) MigrateStartPostCopy(flags uint32) error {
+	ret := _m.ctrl.Call(_m, "MigrateStartPostCopy", flags)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirDomainRecorder) MigrateStartPostCopy(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "MigrateStartPostCopy", arg0)
+}
+
+func (_m *MockVirDomain) MemoryStats(nrStats uint32, flags uint32) ([]libvirt.DomainMemoryStat, error) {
+	ret := _m.ctrl.Call(_m, "MemoryStats", nrStats, flags)
+	ret0, _ := ret[0].([]libvirt.DomainMemoryStat)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockVirDomainRecorder) MemoryStats(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "MemoryStats", arg0, arg1)
+}
+
+func (_m *MockVirDomain) ListAllInterfaceAddresses(src libvirt.DomainInterfaceAddressesSource) ([]libvirt.DomainInterface, error) {
+	ret := _m.ctrl.Call(_m, "ListAllInterfaceAddresses", src)
+	ret0, _ := ret[0].([]libvirt.DomainInterface)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockVirDomainRecorder) ListAllInterfaceAddresses(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "ListAllInterfaceAddresses", arg0)
+}
+
+func (_m *MockVirDomain) GetAutostart() (bool, error) {
+	ret := _m.ctrl.Call(_m, "GetAutostart")
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockVirDomainRecorder) GetAutostart() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetAutostart")
+}
+
+func (_m *MockVirDomain) SetAutostart(autostart bool) error {
+	ret := _m.ctrl.Call(_m, "SetAutostart", autostart)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirDomainRecorder) SetAutostart(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetAutostart", arg0)
+}
+
+func (_m *MockVirDomain) Rename(name string, flags uint32) error {
+	ret := _m.ctrl.Call(_m, "Rename", name, flags)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirDomainRecorder) Rename(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Rename", arg0, arg1)
+}
+
+func (_m *MockVirDomain) CoreDump(to string, flags libvirt.DomainCoreDumpFlags) error {
+	ret := _m.ctrl.Call(_m, "CoreDump", to, flags)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirDomainRecorder) CoreDump(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "CoreDump", arg0, arg1)
+}
+
+func (_m *MockVirDomain) CoreDumpWithFormat(to string, format libvirt.DomainCoreDumpFormat, flags libvirt.DomainCoreDumpFlags) error {
+	ret := _m.ctrl.Call(_m, "CoreDumpWithFormat", to, format, flags)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirDomainRecorder) CoreDumpWithFormat(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "CoreDumpWithFormat", arg0, arg1, arg2)
+}
+
+func (_m *MockVirDomain) Screenshot(stream *libvirt.Stream, screen uint32, flags uint32) (string, error) {
+	ret := _m.ctrl.Call(_m, "Screenshot", stream, screen, flags)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockVirDomainRecorder) Screenshot(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Screenshot", arg0, arg1, arg2)
+}
+
+func (_m *MockVirDomain) SendKey(codeset uint, holdtime uint, keycodes []uint, flags uint32) error {
+	ret := _m.ctrl.Call(_m, "SendKey", codeset, holdtime, keycodes, flags)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirDomainRecorder) SendKey(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SendKey", arg0, arg1, arg2, arg3)
+}
+
+func (_m *MockVirDomain) GetPerfEvents(flags libvirt.DomainModificationImpact) (*libvirt.DomainPerfEvents, error) {
+	ret := _m.ctrl.Call(_m, "GetPerfEvents", flags)
+	ret0, _ := ret[0].(*libvirt.DomainPerfEvents)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockVirDomainRecorder) GetPerfEvents(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetPerfEvents", arg0)
+}
+
+func (_m *MockVirDomain) SetPerfEvents(params *libvirt.DomainPerfEvents, flags libvirt.DomainModificationImpact) error {
+	ret := _m.ctrl.Call(_m, "SetPerfEvents", params, flags)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirDomainRecorder) SetPerfEvents(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetPerfEvents", arg0, arg1)
+}
+
+func (_m *MockVirDomain) QemuMonitorCommand(command string, flags libvirt.DomainQemuMonitorCommandFlags) (string, error) {
+	ret := _m.ctrl.Call(_m, "QemuMonitorCommand", command, flags)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockVirDomainRecorder) QemuMonitorCommand(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "QemuMonitorCommand", arg0, arg1)
+}
+
+func (_m *MockVirDomain) QemuAgentCommand(command string, timeout libvirt.DomainQemuAgentCommandTimeout, flags uint32) (string, error) {
+	ret := _m.ctrl.Call(_m, "QemuAgentCommand", command, timeout, flags)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockVirDomainRecorder) QemuAgentCommand(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "QemuAgentCommand", arg0, arg1, arg2)
+}
+
+func (_m *MockVirDomain) FSTrim(mountpoint string, minimum uint64, flags uint32) error {
+	ret := _m.ctrl.Call(_m, "FSTrim", mountpoint, minimum, flags)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirDomainRecorder) FSTrim(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "FSTrim", arg0, arg1, arg2)
+}
+
+func (_m *MockVirDomain) GetCPUStats(startCpu int, nCpus uint, flags uint32) ([]libvirt.DomainCPUStats, error) {
+	ret := _m.ctrl.Call(_m, "GetCPUStats", startCpu, nCpus, flags)
+	ret0, _ := ret[0].([]libvirt.DomainCPUStats)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockVirDomainRecorder) GetCPUStats(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetCPUStats", arg0, arg1, arg2)
+}
+
+func (_m *MockVirDomain) GetSchedulerParametersFlags(flags libvirt.DomainModificationImpact) (*libvirt.DomainSchedulerParameters, error) {
+	ret := _m.ctrl.Call(_m, "GetSchedulerParametersFlags", flags)
+	ret0, _ := ret[0].(*libvirt.DomainSchedulerParameters)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockVirDomainRecorder) GetSchedulerParametersFlags(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetSchedulerParametersFlags", arg0)
+}
+
+func (_m *MockVirDomain) SetSchedulerParametersFlags(params *libvirt.DomainSchedulerParameters, flags libvirt.DomainModificationImpact) error {
+	ret := _m.ctrl.Call(_m, "SetSchedulerParametersFlags", params, flags)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirDomainRecorder) SetSchedulerParametersFlags(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetSchedulerParametersFlags", arg0, arg1)
+}
+
+func (_m *MockVirDomain) GetMemoryParameters(flags libvirt.DomainModificationImpact) (*libvirt.DomainMemoryParameters, error) {
+	ret := _m.ctrl.Call(_m, "GetMemoryParameters", flags)
+	ret0, _ := ret[0].(*libvirt.DomainMemoryParameters)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockVirDomainRecorder) GetMemoryParameters(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetMemoryParameters", arg0)
+}
+
+func (_m *MockVirDomain) SetMemoryParameters(params *libvirt.DomainMemoryParameters, flags libvirt.DomainModificationImpact) error {
+	ret := _m.ctrl.Call(_m, "SetMemoryParameters", params, flags)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirDomainRecorder) SetMemoryParameters(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetMemoryParameters", arg0, arg1)
+}
+
+func (_m *MockVirDomain) GetBlkioParameters(flags libvirt.DomainModificationImpact) (*libvirt.DomainBlkioParameters, error) {
+	ret := _m.ctrl.Call(_m, "GetBlkioParameters", flags)
+	ret0, _ := ret[0].(*libvirt.DomainBlkioParameters)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockVirDomainRecorder) GetBlkioParameters(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetBlkioParameters", arg0)
+}
+
+func (_m *MockVirDomain) SetBlkioParameters(params *libvirt.DomainBlkioParameters, flags libvirt.DomainModificationImpact) error {
+	ret := _m.ctrl.Call(_m, "SetBlkioParameters", params, flags)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirDomainRecorder) SetBlkioParameters(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetBlkioParameters", arg0, arg1)
+}
+
+func (_m *MockVirDomain) Free() error {
+	ret := _m.ctrl.Call(_m, "Free")
 	ret0, _ := ret[0].(error)
 	return ret0
 }
@@ -421,3 +1265,360 @@ func (_m *MockVirDomain) Free() error {
 func (_mr *_MockVirDomainRecorder) Free() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Free")
 }
+
+// Mock of VirNWFilter interface
+type MockVirNWFilter struct {
+	ctrl     *gomock.Controller
+	recorder *_MockVirNWFilterRecorder
+}
+
+// Recorder for MockVirNWFilter (not exported)
+type _MockVirNWFilterRecorder struct {
+	mock *MockVirNWFilter
+}
+
+func NewMockVirNWFilter(ctrl *gomock.Controller) *MockVirNWFilter {
+	mock := &MockVirNWFilter{ctrl: ctrl}
+	mock.recorder = &_MockVirNWFilterRecorder{mock}
+	return mock
+}
+
+func (_m *MockVirNWFilter) EXPECT() *_MockVirNWFilterRecorder {
+	return _m.recorder
+}
+
+func (_m *MockVirNWFilter) GetName() (string, error) {
+	ret := _m.ctrl.Call(_m, "GetName")
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockVirNWFilterRecorder) GetName() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetName")
+}
+
+func (_m *MockVirNWFilter) GetUUIDString() (string, error) {
+	ret := _m.ctrl.Call(_m, "GetUUIDString")
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockVirNWFilterRecorder) GetUUIDString() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetUUIDString")
+}
+
+func (_m *MockVirNWFilter) GetXMLDesc(flags uint32) (string, error) {
+	ret := _m.ctrl.Call(_m, "GetXMLDesc", flags)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockVirNWFilterRecorder) GetXMLDesc(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetXMLDesc", arg0)
+}
+
+func (_m *MockVirNWFilter) Undefine() error {
+	ret := _m.ctrl.Call(_m, "Undefine")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirNWFilterRecorder) Undefine() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Undefine")
+}
+
+func (_m *MockVirNWFilter) Free() error {
+	ret := _m.ctrl.Call(_m, "Free")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirNWFilterRecorder) Free() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Free")
+}
+
+// Mock of VirStoragePool interface
+type MockVirStoragePool struct {
+	ctrl     *gomock.Controller
+	recorder *_MockVirStoragePoolRecorder
+}
+
+// Recorder for MockVirStoragePool (not exported)
+type _MockVirStoragePoolRecorder struct {
+	mock *MockVirStoragePool
+}
+
+func NewMockVirStoragePool(ctrl *gomock.Controller) *MockVirStoragePool {
+	mock := &MockVirStoragePool{ctrl: ctrl}
+	mock.recorder = &_MockVirStoragePoolRecorder{mock}
+	return mock
+}
+
+func (_m *MockVirStoragePool) EXPECT() *_MockVirStoragePoolRecorder {
+	return _m.recorder
+}
+
+func (_m *MockVirStoragePool) GetName() (string, error) {
+	ret := _m.ctrl.Call(_m, "GetName")
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockVirStoragePoolRecorder) GetName() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetName")
+}
+
+func (_m *MockVirStoragePool) GetXMLDesc(flags libvirt.StorageXMLFlags) (string, error) {
+	ret := _m.ctrl.Call(_m, "GetXMLDesc", flags)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockVirStoragePoolRecorder) GetXMLDesc(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetXMLDesc", arg0)
+}
+
+func (_m *MockVirStoragePool) IsActive() (bool, error) {
+	ret := _m.ctrl.Call(_m, "IsActive")
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockVirStoragePoolRecorder) IsActive() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "IsActive")
+}
+
+func (_m *MockVirStoragePool) Build(flags libvirt.StoragePoolBuildFlags) error {
+	ret := _m.ctrl.Call(_m, "Build", flags)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirStoragePoolRecorder) Build(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Build", arg0)
+}
+
+func (_m *MockVirStoragePool) Create(flags libvirt.StoragePoolCreateFlags) error {
+	ret := _m.ctrl.Call(_m, "Create", flags)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirStoragePoolRecorder) Create(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Create", arg0)
+}
+
+func (_m *MockVirStoragePool) SetAutostart(autostart bool) error {
+	ret := _m.ctrl.Call(_m, "SetAutostart", autostart)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirStoragePoolRecorder) SetAutostart(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetAutostart", arg0)
+}
+
+func (_m *MockVirStoragePool) Refresh(flags uint32) error {
+	ret := _m.ctrl.Call(_m, "Refresh", flags)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirStoragePoolRecorder) Refresh(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Refresh", arg0)
+}
+
+func (_m *MockVirStoragePool) LookupStorageVolByName(name string) (VirStorageVol, error) {
+	ret := _m.ctrl.Call(_m, "LookupStorageVolByName", name)
+	ret0, _ := ret[0].(VirStorageVol)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockVirStoragePoolRecorder) LookupStorageVolByName(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "LookupStorageVolByName", arg0)
+}
+
+func (_m *MockVirStoragePool) ListAllStorageVolumes(flags uint32) ([]VirStorageVol, error) {
+	ret := _m.ctrl.Call(_m, "ListAllStorageVolumes", flags)
+	ret0, _ := ret[0].([]VirStorageVol)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockVirStoragePoolRecorder) ListAllStorageVolumes(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "ListAllStorageVolumes", arg0)
+}
+
+func (_m *MockVirStoragePool) StorageVolCreateXML(xml string, flags libvirt.StorageVolCreateFlags) (VirStorageVol, error) {
+	ret := _m.ctrl.Call(_m, "StorageVolCreateXML", xml, flags)
+	ret0, _ := ret[0].(VirStorageVol)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockVirStoragePoolRecorder) StorageVolCreateXML(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "StorageVolCreateXML", arg0, arg1)
+}
+
+func (_m *MockVirStoragePool) StorageVolCreateXMLFrom(xml string, sourceName string, flags libvirt.StorageVolCreateFlags) (VirStorageVol, error) {
+	ret := _m.ctrl.Call(_m, "StorageVolCreateXMLFrom", xml, sourceName, flags)
+	ret0, _ := ret[0].(VirStorageVol)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockVirStoragePoolRecorder) StorageVolCreateXMLFrom(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "StorageVolCreateXMLFrom", arg0, arg1, arg2)
+}
+
+func (_m *MockVirStoragePool) Destroy() error {
+	ret := _m.ctrl.Call(_m, "Destroy")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirStoragePoolRecorder) Destroy() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Destroy")
+}
+
+func (_m *MockVirStoragePool) Undefine() error {
+	ret := _m.ctrl.Call(_m, "Undefine")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirStoragePoolRecorder) Undefine() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Undefine")
+}
+
+func (_m *MockVirStoragePool) Free() error {
+	ret := _m.ctrl.Call(_m, "Free")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirStoragePoolRecorder) Free() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Free")
+}
+
+// Mock of VirStorageVol interface
+type MockVirStorageVol struct {
+	ctrl     *gomock.Controller
+	recorder *_MockVirStorageVolRecorder
+}
+
+// Recorder for MockVirStorageVol (not exported)
+type _MockVirStorageVolRecorder struct {
+	mock *MockVirStorageVol
+}
+
+func NewMockVirStorageVol(ctrl *gomock.Controller) *MockVirStorageVol {
+	mock := &MockVirStorageVol{ctrl: ctrl}
+	mock.recorder = &_MockVirStorageVolRecorder{mock}
+	return mock
+}
+
+func (_m *MockVirStorageVol) EXPECT() *_MockVirStorageVolRecorder {
+	return _m.recorder
+}
+
+func (_m *MockVirStorageVol) GetName() (string, error) {
+	ret := _m.ctrl.Call(_m, "GetName")
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockVirStorageVolRecorder) GetName() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetName")
+}
+
+func (_m *MockVirStorageVol) GetPath() (string, error) {
+	ret := _m.ctrl.Call(_m, "GetPath")
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockVirStorageVolRecorder) GetPath() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetPath")
+}
+
+func (_m *MockVirStorageVol) GetInfo() (*libvirt.StorageVolInfo, error) {
+	ret := _m.ctrl.Call(_m, "GetInfo")
+	ret0, _ := ret[0].(*libvirt.StorageVolInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockVirStorageVolRecorder) GetInfo() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetInfo")
+}
+
+func (_m *MockVirStorageVol) GetXMLDesc(flags uint32) (string, error) {
+	ret := _m.ctrl.Call(_m, "GetXMLDesc", flags)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockVirStorageVolRecorder) GetXMLDesc(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetXMLDesc", arg0)
+}
+
+func (_m *MockVirStorageVol) Resize(capacity uint64, flags libvirt.StorageVolResizeFlags) error {
+	ret := _m.ctrl.Call(_m, "Resize", capacity, flags)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirStorageVolRecorder) Resize(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Resize", arg0, arg1)
+}
+
+func (_m *MockVirStorageVol) Upload(stream *libvirt.Stream, offset uint64, length uint64, flags libvirt.StorageVolUploadFlags) error {
+	ret := _m.ctrl.Call(_m, "Upload", stream, offset, length, flags)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirStorageVolRecorder) Upload(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Upload", arg0, arg1, arg2, arg3)
+}
+
+func (_m *MockVirStorageVol) Download(stream *libvirt.Stream, offset uint64, length uint64, flags libvirt.StorageVolDownloadFlags) error {
+	ret := _m.ctrl.Call(_m, "Download", stream, offset, length, flags)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirStorageVolRecorder) Download(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Download", arg0, arg1, arg2, arg3)
+}
+
+func (_m *MockVirStorageVol) Delete(flags libvirt.StorageVolDeleteFlags) error {
+	ret := _m.ctrl.Call(_m, "Delete", flags)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirStorageVolRecorder) Delete(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Delete", arg0)
+}
+
+func (_m *MockVirStorageVol) Free() error {
+	ret := _m.ctrl.Call(_m, "Free")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockVirStorageVolRecorder) Free() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Free")
+}
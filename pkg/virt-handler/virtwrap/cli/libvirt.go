@@ -19,30 +19,72 @@
 
 package cli
 
-//go:generate mockgen -source $GOFILE -imports "libvirt=github.com/libvirt/libvirt-go" -package=$GOPACKAGE -destination=generated_mock_$GOFILE
+//go:generate mockgen -source $GOFILE -imports "libvirt=kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt" -package=$GOPACKAGE -destination=generated_mock_$GOFILE
 
 import (
 	"fmt"
 	"io"
+	"os"
 	"sync"
 	"time"
 
-	"github.com/libvirt/libvirt-go"
+	"golang.org/x/net/context"
 	utilwait "k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/flowcontrol"
 
 	"kubevirt.io/kubevirt/pkg/logging"
 	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/errors"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
 )
 
-const ConnectionTimeout = 15 * time.Second
-const ConnectionInterval = 10 * time.Second
+const DefaultConnectTimeout = 15 * time.Second
+const DefaultConnectRetryInterval = 1 * time.Second
+const DefaultCheckInterval = 10 * time.Second
+
+// ConnectionTimeouts control how long we try to reach libvirtd initially,
+// how long we wait between these attempts, and in which interval an
+// established connection is checked for being alive.
+type ConnectionTimeouts struct {
+	Connect       time.Duration
+	RetryInterval time.Duration
+	CheckInterval time.Duration
+}
+
+// DefaultConnectionTimeouts returns the timeouts used if nothing else is
+// configured.
+func DefaultConnectionTimeouts() ConnectionTimeouts {
+	return ConnectionTimeouts{
+		Connect:       DefaultConnectTimeout,
+		RetryInterval: DefaultConnectRetryInterval,
+		CheckInterval: DefaultCheckInterval,
+	}
+}
+
+// Validate makes sure that all timeouts are positive and that we retry at
+// least once before giving up on connecting.
+func (t ConnectionTimeouts) Validate() error {
+	if t.Connect <= 0 || t.RetryInterval <= 0 || t.CheckInterval <= 0 {
+		return fmt.Errorf("connection timeouts and intervals must be positive")
+	}
+	if t.RetryInterval >= t.Connect {
+		return fmt.Errorf("connect retry interval %v must be smaller than the connect timeout %v", t.RetryInterval, t.Connect)
+	}
+	return nil
+}
 
 // TODO: Should we handle libvirt connection errors transparent or panic?
 type Connection interface {
 	LookupDomainByName(name string) (VirDomain, error)
+	LookupDomainByUUIDString(uuid string) (VirDomain, error)
 	DomainDefineXML(xml string) (VirDomain, error)
+	DomainDefineXMLFlags(xml string, flags libvirt.DomainDefineFlags) (VirDomain, error)
 	Close() (int, error)
 	DomainEventLifecycleRegister(callback libvirt.DomainEventLifecycleCallback) error
+	DomainEventWatchdogRegister(callback libvirt.DomainEventWatchdogCallback) error
+	DomainEventDeviceAddedRegister(callback libvirt.DomainEventDeviceAddedCallback) error
+	DomainEventDeviceRemovedRegister(callback libvirt.DomainEventDeviceRemovedCallback) error
+	DomainEventRTCChangeRegister(callback libvirt.DomainEventRTCChangeCallback) error
+	DomainEventAgentLifecycleRegister(callback libvirt.DomainEventAgentLifecycleCallback) error
 	ListAllDomains(flags libvirt.ConnectListAllDomainsFlags) ([]VirDomain, error)
 	NewStream(flags libvirt.StreamFlags) (Stream, error)
 	LookupSecretByUsage(usageType libvirt.SecretUsageType, usageID string) (VirSecret, error)
@@ -50,10 +92,41 @@ type Connection interface {
 	ListSecrets() ([]string, error)
 	LookupSecretByUUIDString(uuid string) (VirSecret, error)
 	ListAllSecrets(flags libvirt.ConnectListAllSecretsFlags) ([]VirSecret, error)
+	GetCapabilities() (string, error)
+	GetDomainCapabilities(emulatorbin string, arch string, machine string, virttype string, flags uint32) (string, error)
+	GetLibVersion() (uint32, error)
+	GetVersion() (uint32, error)
+	GetFreePages(pageSizes []uint64, startCell int, maxCells uint, flags uint32) ([]uint64, error)
+	ListAllNodeDevices(flags libvirt.ConnectListAllNodeDeviceFlags) ([]VirNodeDevice, error)
+	LookupNodeDeviceByName(name string) (VirNodeDevice, error)
+	StoragePoolDefineXML(xml string) (VirStoragePool, error)
+	LookupStoragePoolByName(name string) (VirStoragePool, error)
+	ListAllStoragePools(flags libvirt.ConnectListAllStoragePoolsFlags) ([]VirStoragePool, error)
+	NWFilterDefineXML(xml string) (VirNWFilter, error)
+	LookupNWFilterByName(name string) (VirNWFilter, error)
+	ListAllNWFilters(flags uint32) ([]VirNWFilter, error)
+	GetAllDomainStats(statsTypes libvirt.DomainStatsTypes, flags libvirt.ConnectGetAllDomainStatsFlags) ([]*DomainStats, error)
+}
+
+// DomainStats are the statistics of a single domain. The domain reference
+// is already freed, the domain is identified by its name instead.
+type DomainStats struct {
+	Name string
+	*libvirt.DomainStats
 }
 
 type Stream interface {
 	io.ReadWriteCloser
+	CopyToStream(ctx context.Context, reader io.Reader, opts CopyOptions) (int64, error)
+	CopyFromStream(ctx context.Context, writer io.Writer, opts CopyOptions) (int64, error)
+	CopyToStreamSparse(ctx context.Context, file *os.File, opts CopyOptions) (int64, error)
+	CopyFromStreamSparse(ctx context.Context, file *os.File, opts CopyOptions) (int64, error)
+	ServeEvents(ctx context.Context, peer io.ReadWriteCloser, opts CopyOptions) error
+	// Finish, Abort and Free end a transfer step by step, Close does all
+	// of it on success
+	Finish() error
+	Abort() error
+	Free() error
 	UnderlyingStream() *libvirt.Stream
 }
 
@@ -63,13 +136,14 @@ type VirStream struct {
 
 type LibvirtConnection struct {
 	Connect       *libvirt.Connect
-	user          string
-	pass          string
+	options       *connectionOptions
 	uri           string
 	alive         bool
 	stop          chan struct{}
 	reconnectLock *sync.Mutex
 	callbacks     []libvirt.DomainEventLifecycleCallback
+	rateLimiter   flowcontrol.RateLimiter
+	coalescer     *coalescer
 }
 
 func (s *VirStream) Write(p []byte) (n int, err error) {
@@ -77,7 +151,12 @@ func (s *VirStream) Write(p []byte) (n int, err error) {
 }
 
 func (s *VirStream) Read(p []byte) (n int, err error) {
-	return s.Stream.Recv(p)
+	n, err = s.Stream.Recv(p)
+	// libvirt signals the end of a stream by receiving zero bytes
+	if n == 0 && err == nil && len(p) > 0 {
+		return 0, io.EOF
+	}
+	return n, err
 }
 
 /*
@@ -103,7 +182,9 @@ func (l *LibvirtConnection) NewStream(flags libvirt.StreamFlags) (Stream, error)
 	}
 	defer l.checkConnectionLost()
 
+	start := time.Now()
 	s, err := l.Connect.NewStream(flags)
+	err = observeCall("NewStream", start, err)
 	if err != nil {
 		return nil, err
 	}
@@ -121,7 +202,9 @@ func (l *LibvirtConnection) ListSecrets() (secrets []string, err error) {
 	}
 	defer l.checkConnectionLost()
 
+	start := time.Now()
 	secrets, err = l.Connect.ListSecrets()
+	err = observeCall("ListSecrets", start, err)
 	return
 }
 
@@ -131,7 +214,9 @@ func (l *LibvirtConnection) LookupSecretByUUIDString(uuid string) (secret VirSec
 	}
 	defer l.checkConnectionLost()
 
+	start := time.Now()
 	secret, err = l.Connect.LookupSecretByUUIDString(uuid)
+	err = observeCall("LookupSecretByUUIDString", start, err)
 	return
 }
 
@@ -141,7 +226,9 @@ func (l *LibvirtConnection) LookupSecretByUsage(usageType libvirt.SecretUsageTyp
 	}
 	defer l.checkConnectionLost()
 
+	start := time.Now()
 	secret, err = l.Connect.LookupSecretByUsage(usageType, usageID)
+	err = observeCall("LookupSecretByUsage", start, err)
 	return
 }
 
@@ -151,7 +238,9 @@ func (l *LibvirtConnection) ListAllSecrets(flags libvirt.ConnectListAllSecretsFl
 	}
 	defer l.checkConnectionLost()
 
+	start := time.Now()
 	virSecrets, err := l.Connect.ListAllSecrets(flags)
+	err = observeCall("ListAllSecrets", start, err)
 	if err != nil {
 		return nil, err
 	}
@@ -168,7 +257,76 @@ func (l *LibvirtConnection) SecretDefineXML(xml string) (secret VirSecret, err e
 	}
 	defer l.checkConnectionLost()
 
+	start := time.Now()
 	secret, err = l.Connect.SecretDefineXML(xml, 0)
+	err = observeCall("SecretDefineXML", start, err)
+	return
+}
+
+func (l *LibvirtConnection) GetCapabilities() (caps string, err error) {
+	if err = l.reconnectIfNecessary(); err != nil {
+		return
+	}
+	defer l.checkConnectionLost()
+
+	start := time.Now()
+	caps, err = l.Connect.GetCapabilities()
+	err = observeCall("GetCapabilities", start, err)
+	return
+}
+
+// GetDomainCapabilities returns what the hypervisor supports for guests.
+// Empty arguments select the defaults of the host.
+func (l *LibvirtConnection) GetDomainCapabilities(emulatorbin string, arch string, machine string, virttype string, flags uint32) (caps string, err error) {
+	if err = l.reconnectIfNecessary(); err != nil {
+		return
+	}
+	defer l.checkConnectionLost()
+
+	start := time.Now()
+	caps, err = l.Connect.GetDomainCapabilities(emulatorbin, arch, machine, virttype, flags)
+	err = observeCall("GetDomainCapabilities", start, err)
+	return
+}
+
+// GetFreePages returns the number of free pages of the given sizes in KiB
+// for maxCells NUMA cells, starting at startCell. The counts of all sizes of
+// a cell are returned before the counts of the next cell.
+func (l *LibvirtConnection) GetFreePages(pageSizes []uint64, startCell int, maxCells uint, flags uint32) (pages []uint64, err error) {
+	if err = l.reconnectIfNecessary(); err != nil {
+		return
+	}
+	defer l.checkConnectionLost()
+
+	start := time.Now()
+	pages, err = l.Connect.GetFreePages(pageSizes, startCell, maxCells, flags)
+	err = observeCall("GetFreePages", start, err)
+	return
+}
+
+// GetLibVersion returns the version of libvirtd.
+func (l *LibvirtConnection) GetLibVersion() (version uint32, err error) {
+	if err = l.reconnectIfNecessary(); err != nil {
+		return
+	}
+	defer l.checkConnectionLost()
+
+	start := time.Now()
+	version, err = l.Connect.GetLibVersion()
+	err = observeCall("GetLibVersion", start, err)
+	return
+}
+
+// GetVersion returns the version of the hypervisor, i.e. of qemu.
+func (l *LibvirtConnection) GetVersion() (version uint32, err error) {
+	if err = l.reconnectIfNecessary(); err != nil {
+		return
+	}
+	defer l.checkConnectionLost()
+
+	start := time.Now()
+	version, err = l.Connect.GetVersion()
+	err = observeCall("GetVersion", start, err)
 	return
 }
 
@@ -179,46 +337,325 @@ func (l *LibvirtConnection) DomainEventLifecycleRegister(callback libvirt.Domain
 	defer l.checkConnectionLost()
 
 	l.callbacks = append(l.callbacks, callback)
+	start := time.Now()
 	_, err = l.Connect.DomainEventLifecycleRegister(nil, callback)
+	err = observeCall("DomainEventLifecycleRegister", start, err)
 	return
 }
 
-func (l *LibvirtConnection) LookupDomainByName(name string) (dom VirDomain, err error) {
+// DomainEventWatchdogRegister registers a callback for guest watchdog events.
+// In contrast to lifecycle callbacks, it is not notified about reconnects, the
+// lifecycle callbacks take care of triggering a re-registration.
+func (l *LibvirtConnection) DomainEventWatchdogRegister(callback libvirt.DomainEventWatchdogCallback) (err error) {
 	if err = l.reconnectIfNecessary(); err != nil {
 		return
 	}
 	defer l.checkConnectionLost()
 
-	return l.Connect.LookupDomainByName(name)
+	start := time.Now()
+	_, err = l.Connect.DomainEventWatchdogRegister(nil, callback)
+	err = observeCall("DomainEventWatchdogRegister", start, err)
+	return
 }
 
-func (l *LibvirtConnection) DomainDefineXML(xml string) (dom VirDomain, err error) {
+// DomainEventDeviceAddedRegister registers a callback for devices which were
+// hotplugged into a domain.
+func (l *LibvirtConnection) DomainEventDeviceAddedRegister(callback libvirt.DomainEventDeviceAddedCallback) (err error) {
+	if err = l.reconnectIfNecessary(); err != nil {
+		return
+	}
+	defer l.checkConnectionLost()
+
+	start := time.Now()
+	_, err = l.Connect.DomainEventDeviceAddedRegister(nil, callback)
+	err = observeCall("DomainEventDeviceAddedRegister", start, err)
+	return
+}
+
+// DomainEventDeviceRemovedRegister registers a callback for devices which
+// were unplugged from a domain.
+func (l *LibvirtConnection) DomainEventDeviceRemovedRegister(callback libvirt.DomainEventDeviceRemovedCallback) (err error) {
+	if err = l.reconnectIfNecessary(); err != nil {
+		return
+	}
+	defer l.checkConnectionLost()
+
+	start := time.Now()
+	_, err = l.Connect.DomainEventDeviceRemovedRegister(nil, callback)
+	err = observeCall("DomainEventDeviceRemovedRegister", start, err)
+	return
+}
+
+// DomainEventRTCChangeRegister registers a callback for guests which changed
+// the offset of their RTC.
+func (l *LibvirtConnection) DomainEventRTCChangeRegister(callback libvirt.DomainEventRTCChangeCallback) (err error) {
 	if err = l.reconnectIfNecessary(); err != nil {
 		return
 	}
 	defer l.checkConnectionLost()
 
-	dom, err = l.Connect.DomainDefineXML(xml)
+	start := time.Now()
+	_, err = l.Connect.DomainEventRTCChangeRegister(nil, callback)
+	err = observeCall("DomainEventRTCChangeRegister", start, err)
 	return
 }
 
+// DomainEventAgentLifecycleRegister registers a callback for guest agents
+// which connected to or disconnected from their channel.
+func (l *LibvirtConnection) DomainEventAgentLifecycleRegister(callback libvirt.DomainEventAgentLifecycleCallback) (err error) {
+	if err = l.reconnectIfNecessary(); err != nil {
+		return
+	}
+	defer l.checkConnectionLost()
+
+	start := time.Now()
+	_, err = l.Connect.DomainEventAgentLifecycleRegister(nil, callback)
+	err = observeCall("DomainEventAgentLifecycleRegister", start, err)
+	return
+}
+
+// LookupDomainByName coalesces concurrent lookups of the same domain into a
+// single RPC. Every caller gets its own reference and has to free it.
+func (l *LibvirtConnection) LookupDomainByName(name string) (VirDomain, error) {
+	return l.lookupDomain("LookupDomainByName", name, func() (*libvirt.Domain, error) {
+		return l.Connect.LookupDomainByName(name)
+	})
+}
+
+// LookupDomainByUUIDString looks up a domain by its UUID. Unlike names, UUIDs
+// are not reused when a VM is deleted and recreated under the same name.
+// Concurrent lookups are coalesced like the ones by name.
+func (l *LibvirtConnection) LookupDomainByUUIDString(uuid string) (VirDomain, error) {
+	return l.lookupDomain("LookupDomainByUUIDString", uuid, func() (*libvirt.Domain, error) {
+		return l.Connect.LookupDomainByUUIDString(uuid)
+	})
+}
+
+func (l *LibvirtConnection) lookupDomain(operation string, arg string, lookup func() (*libvirt.Domain, error)) (VirDomain, error) {
+	val, err, follower := l.coalescer.do(operation+"/"+arg, func() (interface{}, error) {
+		if err := l.reconnectIfNecessary(); err != nil {
+			return nil, err
+		}
+		defer l.checkConnectionLost()
+
+		start := time.Now()
+		dom, err := lookup()
+		err = observeCall(operation, start, err)
+		return dom, err
+	}, func(val interface{}) error {
+		return val.(*libvirt.Domain).Ref()
+	})
+	if err != nil {
+		return nil, err
+	}
+	virDom := val.(*libvirt.Domain)
+	if follower {
+		// The reference taken for us has to be freed through our own copy
+		copied := *virDom
+		virDom = &copied
+	}
+	return newInstrumentedDomain(virDom), nil
+}
+
+func (l *LibvirtConnection) DomainDefineXML(xml string) (dom VirDomain, err error) {
+	if err = l.reconnectIfNecessary(); err != nil {
+		return
+	}
+	defer l.checkConnectionLost()
+
+	start := time.Now()
+	virDom, err := l.Connect.DomainDefineXML(xml)
+	err = observeCall("DomainDefineXML", start, err)
+	if err != nil {
+		return nil, err
+	}
+	return newInstrumentedDomain(virDom), nil
+}
+
+func (l *LibvirtConnection) DomainDefineXMLFlags(xml string, flags libvirt.DomainDefineFlags) (dom VirDomain, err error) {
+	if err = l.reconnectIfNecessary(); err != nil {
+		return
+	}
+	defer l.checkConnectionLost()
+
+	start := time.Now()
+	virDom, err := l.Connect.DomainDefineXMLFlags(xml, flags)
+	err = observeCall("DomainDefineXMLFlags", start, err)
+	if err != nil {
+		return nil, err
+	}
+	return newInstrumentedDomain(virDom), nil
+}
+
 func (l *LibvirtConnection) ListAllDomains(flags libvirt.ConnectListAllDomainsFlags) ([]VirDomain, error) {
 	if err := l.reconnectIfNecessary(); err != nil {
 		return nil, err
 	}
 	defer l.checkConnectionLost()
 
+	start := time.Now()
 	virDoms, err := l.Connect.ListAllDomains(flags)
+	err = observeCall("ListAllDomains", start, err)
 	if err != nil {
 		return nil, err
 	}
 	doms := make([]VirDomain, len(virDoms))
-	for i, d := range virDoms {
-		doms[i] = &d
+	for i := range virDoms {
+		doms[i] = newInstrumentedDomain(&virDoms[i])
 	}
 	return doms, nil
 }
 
+// GetAllDomainStats fetches the statistics of all domains with a single call.
+func (l *LibvirtConnection) GetAllDomainStats(statsTypes libvirt.DomainStatsTypes, flags libvirt.ConnectGetAllDomainStatsFlags) ([]*DomainStats, error) {
+	if err := l.reconnectIfNecessary(); err != nil {
+		return nil, err
+	}
+	defer l.checkConnectionLost()
+
+	start := time.Now()
+	virStats, err := l.Connect.GetAllDomainStats(nil, statsTypes, flags)
+	err = observeCall("GetAllDomainStats", start, err)
+	if err != nil {
+		return nil, err
+	}
+	stats := make([]*DomainStats, 0, len(virStats))
+	for i := range virStats {
+		name, err := virStats[i].Domain.GetName()
+		virStats[i].Domain.Free()
+		virStats[i].Domain = nil
+		if err != nil {
+			// The domain disappeared in the meantime
+			continue
+		}
+		stats = append(stats, &DomainStats{Name: name, DomainStats: &virStats[i]})
+	}
+	return stats, nil
+}
+
+func (l *LibvirtConnection) ListAllNodeDevices(flags libvirt.ConnectListAllNodeDeviceFlags) ([]VirNodeDevice, error) {
+	if err := l.reconnectIfNecessary(); err != nil {
+		return nil, err
+	}
+	defer l.checkConnectionLost()
+
+	start := time.Now()
+	virDevs, err := l.Connect.ListAllNodeDevices(flags)
+	err = observeCall("ListAllNodeDevices", start, err)
+	if err != nil {
+		return nil, err
+	}
+	devs := make([]VirNodeDevice, len(virDevs))
+	for i := range virDevs {
+		devs[i] = &virDevs[i]
+	}
+	return devs, nil
+}
+
+func (l *LibvirtConnection) LookupNodeDeviceByName(name string) (dev VirNodeDevice, err error) {
+	if err = l.reconnectIfNecessary(); err != nil {
+		return
+	}
+	defer l.checkConnectionLost()
+
+	start := time.Now()
+	dev, err = l.Connect.LookupDeviceByName(name)
+	err = observeCall("LookupNodeDeviceByName", start, err)
+	return
+}
+
+func (l *LibvirtConnection) StoragePoolDefineXML(xml string) (VirStoragePool, error) {
+	if err := l.reconnectIfNecessary(); err != nil {
+		return nil, err
+	}
+	defer l.checkConnectionLost()
+
+	start := time.Now()
+	pool, err := l.Connect.StoragePoolDefineXML(xml, 0)
+	err = observeCall("StoragePoolDefineXML", start, err)
+	if err != nil {
+		return nil, err
+	}
+	return &LibvirtStoragePool{StoragePool: pool}, nil
+}
+
+func (l *LibvirtConnection) LookupStoragePoolByName(name string) (VirStoragePool, error) {
+	if err := l.reconnectIfNecessary(); err != nil {
+		return nil, err
+	}
+	defer l.checkConnectionLost()
+
+	start := time.Now()
+	pool, err := l.Connect.LookupStoragePoolByName(name)
+	err = observeCall("LookupStoragePoolByName", start, err)
+	if err != nil {
+		return nil, err
+	}
+	return &LibvirtStoragePool{StoragePool: pool}, nil
+}
+
+func (l *LibvirtConnection) ListAllStoragePools(flags libvirt.ConnectListAllStoragePoolsFlags) ([]VirStoragePool, error) {
+	if err := l.reconnectIfNecessary(); err != nil {
+		return nil, err
+	}
+	defer l.checkConnectionLost()
+
+	start := time.Now()
+	virPools, err := l.Connect.ListAllStoragePools(flags)
+	err = observeCall("ListAllStoragePools", start, err)
+	if err != nil {
+		return nil, err
+	}
+	pools := make([]VirStoragePool, len(virPools))
+	for i := range virPools {
+		pools[i] = &LibvirtStoragePool{StoragePool: &virPools[i]}
+	}
+	return pools, nil
+}
+
+func (l *LibvirtConnection) NWFilterDefineXML(xml string) (filter VirNWFilter, err error) {
+	if err = l.reconnectIfNecessary(); err != nil {
+		return
+	}
+	defer l.checkConnectionLost()
+
+	start := time.Now()
+	filter, err = l.Connect.NWFilterDefineXML(xml)
+	err = observeCall("NWFilterDefineXML", start, err)
+	return
+}
+
+func (l *LibvirtConnection) LookupNWFilterByName(name string) (filter VirNWFilter, err error) {
+	if err = l.reconnectIfNecessary(); err != nil {
+		return
+	}
+	defer l.checkConnectionLost()
+
+	start := time.Now()
+	filter, err = l.Connect.LookupNWFilterByName(name)
+	err = observeCall("LookupNWFilterByName", start, err)
+	return
+}
+
+func (l *LibvirtConnection) ListAllNWFilters(flags uint32) ([]VirNWFilter, error) {
+	if err := l.reconnectIfNecessary(); err != nil {
+		return nil, err
+	}
+	defer l.checkConnectionLost()
+
+	start := time.Now()
+	virFilters, err := l.Connect.ListAllNWFilters(flags)
+	err = observeCall("ListAllNWFilters", start, err)
+	if err != nil {
+		return nil, err
+	}
+	filters := make([]VirNWFilter, len(virFilters))
+	for i := range virFilters {
+		filters[i] = &virFilters[i]
+	}
+	return filters, nil
+}
+
 // Installs a watchdog which will check periodically if the libvirt connection is still alive.
 func (l *LibvirtConnection) installWatchdog(checkInterval time.Duration) {
 	go func() {
@@ -254,12 +691,18 @@ func (l *LibvirtConnection) installWatchdog(checkInterval time.Duration) {
 }
 
 func (l *LibvirtConnection) reconnectIfNecessary() (err error) {
+	// Every RPC of the connection itself passes here, which makes it the
+	// place to throttle them. Calls on the domains and other objects it hands
+	// out are not throttled, they are already serialized per domain by the
+	// domain manager.
+	l.rateLimiter.Accept()
+
 	l.reconnectLock.Lock()
 	defer l.reconnectLock.Unlock()
 	// TODO add a reconnect backoff, and immediately return an error in these cases
 	// We need this to avoid swamping libvirt with reconnect tries
 	if !l.alive {
-		l.Connect, err = newConnection(l.uri, l.user, l.pass)
+		l.Connect, err = newConnection(l.uri, l.options)
 		if err != nil {
 			return
 		}
@@ -308,28 +751,91 @@ type VirSecret interface {
 	Free() error
 }
 
+type VirNodeDevice interface {
+	GetName() (string, error)
+	GetXMLDesc(flags uint32) (string, error)
+	Detach() error
+	ReAttach() error
+	Reset() error
+	Free() error
+}
+
 type VirDomain interface {
 	GetState() (libvirt.DomainState, int, error)
 	Create() error
+	CreateWithFlags(flags libvirt.DomainCreateFlags) error
 	Resume() error
+	Shutdown() error
 	Destroy() error
 	GetName() (string, error)
 	GetUUIDString() (string, error)
 	GetXMLDesc(flags libvirt.DomainXMLFlags) (string, error)
 	Undefine() error
+	UndefineFlags(flags libvirt.DomainUndefineFlagsValues) error
 	OpenConsole(devname string, stream *libvirt.Stream, flags libvirt.DomainConsoleFlags) error
+	OpenChannel(name string, stream *libvirt.Stream, flags libvirt.DomainChannelFlags) error
+	PinVcpuFlags(vcpu uint, cpuMap []bool, flags libvirt.DomainModificationImpact) error
+	PinEmulator(cpuMap []bool, flags libvirt.DomainModificationImpact) error
+	PinIOThread(iothreadid uint, cpuMap []bool, flags libvirt.DomainModificationImpact) error
+	AddIOThread(id uint, flags libvirt.DomainModificationImpact) error
+	GetBlockInfo(disk string, flags uint) (*libvirt.DomainBlockInfo, error)
+	BlockResize(disk string, size uint64, flags libvirt.DomainBlockResizeFlags) error
+	GetBlockIoTune(disk string, flags libvirt.DomainModificationImpact) (*libvirt.DomainBlockIoTuneParameters, error)
+	SetBlockIoTune(disk string, params *libvirt.DomainBlockIoTuneParameters, flags libvirt.DomainModificationImpact) error
+	GetInterfaceParameters(device string, flags libvirt.DomainModificationImpact) (*libvirt.DomainInterfaceParameters, error)
+	SetInterfaceParameters(device string, params *libvirt.DomainInterfaceParameters, flags libvirt.DomainModificationImpact) error
+	GetMetadata(metadataType libvirt.DomainMetadataType, uri string, flags libvirt.DomainModificationImpact) (string, error)
+	SetMetadata(metadata string, metadataType libvirt.DomainMetadataType, key string, uri string, flags libvirt.DomainModificationImpact) error
+	GetJobStats(flags libvirt.DomainGetJobStatsFlags) (*libvirt.DomainJobInfo, error)
+	AbortJob() error
+	MigrateGetMaxSpeed(flags uint32) (uint64, error)
+	MigrateSetMaxSpeed(speed uint64, flags uint32) error
+	MigrateSetMaxDowntime(downtime uint64, flags uint32) error
+	MigrateStartPostCopy(flags uint32) error
+	MemoryStats(nrStats uint32, flags uint32) ([]libvirt.DomainMemoryStat, error)
+	ListAllInterfaceAddresses(src libvirt.DomainInterfaceAddressesSource) ([]libvirt.DomainInterface, error)
+	GetAutostart() (bool, error)
+	SetAutostart(autostart bool) error
+	Rename(name string, flags uint32) error
+	CoreDump(to string, flags libvirt.DomainCoreDumpFlags) error
+	CoreDumpWithFormat(to string, format libvirt.DomainCoreDumpFormat, flags libvirt.DomainCoreDumpFlags) error
+	Screenshot(stream *libvirt.Stream, screen uint32, flags uint32) (string, error)
+	SendKey(codeset uint, holdtime uint, keycodes []uint, flags uint32) error
+	GetPerfEvents(flags libvirt.DomainModificationImpact) (*libvirt.DomainPerfEvents, error)
+	SetPerfEvents(params *libvirt.DomainPerfEvents, flags libvirt.DomainModificationImpact) error
+	QemuMonitorCommand(command string, flags libvirt.DomainQemuMonitorCommandFlags) (string, error)
+	QemuAgentCommand(command string, timeout libvirt.DomainQemuAgentCommandTimeout, flags uint32) (string, error)
+	FSTrim(mountpoint string, minimum uint64, flags uint32) error
+	GetCPUStats(startCpu int, nCpus uint, flags uint32) ([]libvirt.DomainCPUStats, error)
+	GetSchedulerParametersFlags(flags libvirt.DomainModificationImpact) (*libvirt.DomainSchedulerParameters, error)
+	SetSchedulerParametersFlags(params *libvirt.DomainSchedulerParameters, flags libvirt.DomainModificationImpact) error
+	GetMemoryParameters(flags libvirt.DomainModificationImpact) (*libvirt.DomainMemoryParameters, error)
+	SetMemoryParameters(params *libvirt.DomainMemoryParameters, flags libvirt.DomainModificationImpact) error
+	GetBlkioParameters(flags libvirt.DomainModificationImpact) (*libvirt.DomainBlkioParameters, error)
+	SetBlkioParameters(params *libvirt.DomainBlkioParameters, flags libvirt.DomainModificationImpact) error
 	Free() error
 }
 
-func NewConnection(uri string, user string, pass string, checkInterval time.Duration) (Connection, error) {
+// NewConnection connects to libvirtd and keeps the connection alive,
+// reconnecting if it gets lost. See the ConnectionOption functions for what
+// can be configured.
+func NewConnection(uri string, opts ...ConnectionOption) (Connection, error) {
+	options := newConnectionOptions(opts)
+	if err := options.timeouts.Validate(); err != nil {
+		return nil, err
+	}
+	uri, err := options.connectURI(uri)
+	if err != nil {
+		return nil, fmt.Errorf("invalid libvirt uri: %v", err)
+	}
+
 	logger := logging.DefaultLogger()
 	logger.Info().V(1).Msgf("Connecting to libvirt daemon: %s", uri)
 
-	var err error
 	var virConn *libvirt.Connect
 
-	err = utilwait.PollImmediate(ConnectionInterval, ConnectionTimeout, func() (done bool, err error) {
-		virConn, err = newConnection(uri, user, pass)
+	err = utilwait.PollImmediate(options.timeouts.RetryInterval, options.timeouts.Connect, func() (done bool, err error) {
+		virConn, err = newConnection(uri, options)
 		if err != nil {
 			return false, nil
 		}
@@ -341,37 +847,37 @@ func NewConnection(uri string, user string, pass string, checkInterval time.Dura
 	logger.Info().V(1).Msg("Connected to libvirt daemon")
 
 	lvConn := &LibvirtConnection{
-		Connect: virConn, user: user, pass: pass, uri: uri, alive: true,
+		Connect: virConn, options: options, uri: uri, alive: true,
 		callbacks:     make([]libvirt.DomainEventLifecycleCallback, 0),
 		reconnectLock: &sync.Mutex{},
+		rateLimiter:   options.rateLimiter,
+		coalescer:     newCoalescer(),
 	}
-	lvConn.installWatchdog(checkInterval)
+	lvConn.installWatchdog(options.timeouts.CheckInterval)
 
+	if options.readOnly {
+		return NewReadOnlyConnection(lvConn), nil
+	}
 	return lvConn, nil
 }
 
 // TODO: needs a functional test.
-func newConnection(uri string, user string, pass string) (*libvirt.Connect, error) {
-	callback := func(creds []*libvirt.ConnectCredential) {
-		for _, cred := range creds {
-			if cred.Type == libvirt.CRED_AUTHNAME {
-				cred.Result = user
-				cred.ResultLen = len(cred.Result)
-			} else if cred.Type == libvirt.CRED_PASSPHRASE {
-				cred.Result = pass
-				cred.ResultLen = len(cred.Result)
-			}
-		}
+func newConnection(uri string, options *connectionOptions) (*libvirt.Connect, error) {
+	var flags libvirt.ConnectFlags
+	if options.readOnly {
+		flags = libvirt.CONNECT_RO
 	}
-	auth := &libvirt.ConnectAuth{
-		CredType: []libvirt.ConnectCredentialType{
-			libvirt.CRED_AUTHNAME, libvirt.CRED_PASSPHRASE,
-		},
-		Callback: callback,
+	virConn, err := libvirt.NewConnectWithAuth(uri, options.auth, flags)
+	if err != nil {
+		return nil, err
 	}
-	virConn, err := libvirt.NewConnectWithAuth(uri, auth, 0)
-
-	return virConn, err
+	if options.keepAliveInterval > 0 {
+		if err := virConn.SetKeepAlive(options.keepAliveInterval, options.keepAliveCount); err != nil {
+			virConn.Close()
+			return nil, err
+		}
+	}
+	return virConn, nil
 }
 
 func IsDown(domState libvirt.DomainState) bool {
@@ -391,3 +897,100 @@ func IsPaused(domState libvirt.DomainState) bool {
 	}
 	return false
 }
+
+type VirNWFilter interface {
+	GetName() (string, error)
+	GetUUIDString() (string, error)
+	GetXMLDesc(flags uint32) (string, error)
+	Undefine() error
+	Free() error
+}
+
+type VirStoragePool interface {
+	GetName() (string, error)
+	GetXMLDesc(flags libvirt.StorageXMLFlags) (string, error)
+	IsActive() (bool, error)
+	Build(flags libvirt.StoragePoolBuildFlags) error
+	Create(flags libvirt.StoragePoolCreateFlags) error
+	SetAutostart(autostart bool) error
+	Refresh(flags uint32) error
+	LookupStorageVolByName(name string) (VirStorageVol, error)
+	ListAllStorageVolumes(flags uint32) ([]VirStorageVol, error)
+	StorageVolCreateXML(xml string, flags libvirt.StorageVolCreateFlags) (VirStorageVol, error)
+	StorageVolCreateXMLFrom(xml string, sourceName string, flags libvirt.StorageVolCreateFlags) (VirStorageVol, error)
+	Destroy() error
+	Undefine() error
+	Free() error
+}
+
+type VirStorageVol interface {
+	GetName() (string, error)
+	GetPath() (string, error)
+	GetInfo() (*libvirt.StorageVolInfo, error)
+	GetXMLDesc(flags uint32) (string, error)
+	Resize(capacity uint64, flags libvirt.StorageVolResizeFlags) error
+	Upload(stream *libvirt.Stream, offset uint64, length uint64, flags libvirt.StorageVolUploadFlags) error
+	Download(stream *libvirt.Stream, offset uint64, length uint64, flags libvirt.StorageVolDownloadFlags) error
+	Delete(flags libvirt.StorageVolDeleteFlags) error
+	Free() error
+}
+
+// LibvirtStoragePool hands out volumes as VirStorageVol, so that they can be
+// mocked like all other libvirt objects.
+type LibvirtStoragePool struct {
+	*libvirt.StoragePool
+}
+
+func (p *LibvirtStoragePool) LookupStorageVolByName(name string) (VirStorageVol, error) {
+	start := time.Now()
+	vol, err := p.StoragePool.LookupStorageVolByName(name)
+	err = observeCall("LookupStorageVolByName", start, err)
+	if err != nil {
+		return nil, err
+	}
+	return vol, nil
+}
+
+func (p *LibvirtStoragePool) ListAllStorageVolumes(flags uint32) ([]VirStorageVol, error) {
+	start := time.Now()
+	virVols, err := p.StoragePool.ListAllStorageVolumes(flags)
+	err = observeCall("ListAllStorageVolumes", start, err)
+	if err != nil {
+		return nil, err
+	}
+	vols := make([]VirStorageVol, len(virVols))
+	for i := range virVols {
+		vols[i] = &virVols[i]
+	}
+	return vols, nil
+}
+
+func (p *LibvirtStoragePool) StorageVolCreateXML(xml string, flags libvirt.StorageVolCreateFlags) (VirStorageVol, error) {
+	start := time.Now()
+	vol, err := p.StoragePool.StorageVolCreateXML(xml, flags)
+	err = observeCall("StorageVolCreateXML", start, err)
+	if err != nil {
+		return nil, err
+	}
+	return vol, nil
+}
+
+// StorageVolCreateXMLFrom creates a new volume as a clone of the volume
+// sourceName of the same pool.
+func (p *LibvirtStoragePool) StorageVolCreateXMLFrom(xml string, sourceName string, flags libvirt.StorageVolCreateFlags) (VirStorageVol, error) {
+	start := time.Now()
+	source, err := p.StoragePool.LookupStorageVolByName(sourceName)
+	err = observeCall("LookupStorageVolByName", start, err)
+	if err != nil {
+		return nil, err
+	}
+	defer source.Free()
+
+	start = time.Now()
+	vol, err := p.StoragePool.StorageVolCreateXMLFrom(xml, source, flags)
+	err = observeCall("StorageVolCreateXMLFrom", start, err)
+	if err != nil {
+		return nil, err
+	}
+	return vol, nil
+}
@@ -21,6 +21,7 @@ package cli
 
 import (
 	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
 
 	"fmt"
@@ -31,12 +32,32 @@ import (
 var _ = Describe("Libvirt Suite", func() {
 	Context("Upon attempt to connect to Libvirt", func() {
 		It("should time out while waiting for libvirt", func() {
-			_, err := NewConnection("http://", "", "", 1*time.Microsecond)
+			timeouts := ConnectionTimeouts{Connect: 10 * time.Millisecond, RetryInterval: time.Millisecond, CheckInterval: time.Microsecond}
+			_, err := NewConnection("http://", WithTimeouts(timeouts))
 			msg := fmt.Sprintf("%v", err)
 			Expect(err).To(HaveOccurred())
 			Expect(msg).To(Equal("cannot connect to libvirt daemon: timed out waiting for the condition"))
 		})
 	})
+
+	Context("Validating the connection timeouts", func() {
+		It("should accept the defaults", func() {
+			Expect(DefaultConnectionTimeouts().Validate()).To(Succeed())
+		})
+
+		table.DescribeTable("should reject", func(timeouts ConnectionTimeouts) {
+			Expect(timeouts.Validate()).ToNot(Succeed())
+		},
+			table.Entry("a zero connect timeout", ConnectionTimeouts{RetryInterval: time.Second, CheckInterval: time.Second}),
+			table.Entry("a negative check interval", ConnectionTimeouts{Connect: time.Minute, RetryInterval: time.Second, CheckInterval: -time.Second}),
+			table.Entry("a retry interval which allows only a single attempt", ConnectionTimeouts{Connect: 10 * time.Second, RetryInterval: 10 * time.Second, CheckInterval: time.Second}),
+		)
+
+		It("should not connect with invalid timeouts", func() {
+			_, err := NewConnection("http://", WithTimeouts(ConnectionTimeouts{}))
+			Expect(err).To(MatchError("connection timeouts and intervals must be positive"))
+		})
+	})
 })
 
 func TestLibvirt(t *testing.T) {
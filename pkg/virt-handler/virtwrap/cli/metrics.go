@@ -0,0 +1,83 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package cli
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/errors"
+)
+
+var (
+	callDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "kubevirt",
+			Subsystem: "libvirt",
+			Name:      "call_duration_seconds",
+			Help:      "Latency of libvirt API calls.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 15),
+		},
+		[]string{"operation"},
+	)
+	callErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "kubevirt",
+			Subsystem: "libvirt",
+			Name:      "call_errors_total",
+			Help:      "Failed libvirt API calls, by libvirt error code.",
+		},
+		[]string{"operation", "code"},
+	)
+	streamBytes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "kubevirt",
+			Subsystem: "libvirt",
+			Name:      "stream_bytes_total",
+			Help:      "Bytes sent or received through libvirt streams.",
+		},
+		[]string{"operation", "direction"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(callDuration, callErrors, streamBytes)
+}
+
+// observeCall records the latency of a libvirt call which started at start,
+// and counts it as failed if err is set. It returns err as HypervisorError.
+func observeCall(operation string, start time.Time, err error) error {
+	callDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		callErrors.WithLabelValues(operation, errorCode(err)).Inc()
+	}
+	return errors.NewHypervisorError(err)
+}
+
+// errorCode returns the libvirt error code of err as label value. Errors
+// which do not come from libvirt are labeled "unknown".
+func errorCode(err error) string {
+	if hypervisorError, ok := errors.AsHypervisorError(err); ok {
+		return strconv.Itoa(int(hypervisorError.Code()))
+	}
+	return "unknown"
+}
@@ -0,0 +1,64 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package cli
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/errors"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Metrics", func() {
+
+	errorCount := func(operation string, code string) float64 {
+		metric := &dto.Metric{}
+		Expect(callErrors.WithLabelValues(operation, code).(prometheus.Metric).Write(metric)).To(Succeed())
+		return metric.GetCounter().GetValue()
+	}
+
+	sampleCount := func(operation string) uint64 {
+		metric := &dto.Metric{}
+		Expect(callDuration.WithLabelValues(operation).(prometheus.Metric).Write(metric)).To(Succeed())
+		return metric.GetHistogram().GetSampleCount()
+	}
+
+	It("should observe the latency of successful calls", func() {
+		before := sampleCount("TestSuccess")
+		observeCall("TestSuccess", time.Now(), nil)
+		Expect(sampleCount("TestSuccess")).To(Equal(before + 1))
+		Expect(errorCount("TestSuccess", "unknown")).To(BeZero())
+	})
+
+	It("should count failed calls by libvirt error code", func() {
+		err := observeCall("TestFailure", time.Now(), libvirt.Error{Code: libvirt.ERR_NO_DOMAIN})
+		Expect(err).To(BeAssignableToTypeOf(&errors.HypervisorError{}))
+		observeCall("TestFailure", time.Now(), fmt.Errorf("not from libvirt"))
+		Expect(errorCount("TestFailure", fmt.Sprint(int(libvirt.ERR_NO_DOMAIN)))).To(Equal(float64(1)))
+		Expect(errorCount("TestFailure", "unknown")).To(Equal(float64(1)))
+		Expect(sampleCount("TestFailure")).To(Equal(uint64(2)))
+	})
+})
@@ -0,0 +1,147 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package cli
+
+import (
+	"net/url"
+
+	"k8s.io/client-go/util/flowcontrol"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+// ConnectionOption configures a connection created by NewConnection.
+type ConnectionOption func(*connectionOptions)
+
+type connectionOptions struct {
+	auth              *libvirt.ConnectAuth
+	timeouts          ConnectionTimeouts
+	rateLimiter       flowcontrol.RateLimiter
+	keepAliveInterval int
+	keepAliveCount    uint
+	pkiPath           string
+	readOnly          bool
+}
+
+func newConnectionOptions(opts []ConnectionOption) *connectionOptions {
+	options := &connectionOptions{
+		auth:        credentialsAuth("", ""),
+		timeouts:    DefaultConnectionTimeouts(),
+		rateLimiter: flowcontrol.NewFakeAlwaysRateLimiter(),
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// WithCredentials authenticates against libvirtd with a user name and a
+// password.
+func WithCredentials(user string, pass string) ConnectionOption {
+	return func(o *connectionOptions) {
+		o.auth = credentialsAuth(user, pass)
+	}
+}
+
+// WithAuth lets the caller answer all credential requests of libvirtd, e.g.
+// to fetch them from a secret store.
+func WithAuth(auth *libvirt.ConnectAuth) ConnectionOption {
+	return func(o *connectionOptions) {
+		o.auth = auth
+	}
+}
+
+// WithTimeouts replaces the default connection timeouts.
+func WithTimeouts(timeouts ConnectionTimeouts) ConnectionOption {
+	return func(o *connectionOptions) {
+		o.timeouts = timeouts
+	}
+}
+
+// WithRateLimiter makes the connection never send more RPCs, like domain
+// lookups, definitions and listings, to libvirtd than the rate limiter allows,
+// e.g. to not overload it when all VMs of a node are started at once. Calls on
+// the returned domains are not limited.
+func WithRateLimiter(rateLimiter flowcontrol.RateLimiter) ConnectionOption {
+	return func(o *connectionOptions) {
+		o.rateLimiter = rateLimiter
+	}
+}
+
+// WithKeepAlive makes libvirt send a keepalive message every interval
+// seconds and close the connection after count unanswered ones. It needs a
+// registered event loop.
+func WithKeepAlive(interval int, count uint) ConnectionOption {
+	return func(o *connectionOptions) {
+		o.keepAliveInterval = interval
+		o.keepAliveCount = count
+	}
+}
+
+// WithPKIPath points TLS connections to the directory which holds the CA
+// certificate and the client certificate and key.
+func WithPKIPath(path string) ConnectionOption {
+	return func(o *connectionOptions) {
+		o.pkiPath = path
+	}
+}
+
+// WithReadOnly opens a read only connection to libvirtd. All methods which
+// would change a domain or any other libvirt object fail with ErrReadOnly.
+func WithReadOnly() ConnectionOption {
+	return func(o *connectionOptions) {
+		o.readOnly = true
+	}
+}
+
+// connectURI returns the URI to connect to, with the TLS settings applied.
+func (o *connectionOptions) connectURI(uri string) (string, error) {
+	if o.pkiPath == "" {
+		return uri, nil
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	query.Set("pkipath", o.pkiPath)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+func credentialsAuth(user string, pass string) *libvirt.ConnectAuth {
+	callback := func(creds []*libvirt.ConnectCredential) {
+		for _, cred := range creds {
+			if cred.Type == libvirt.CRED_AUTHNAME {
+				cred.Result = user
+				cred.ResultLen = len(cred.Result)
+			} else if cred.Type == libvirt.CRED_PASSPHRASE {
+				cred.Result = pass
+				cred.ResultLen = len(cred.Result)
+			}
+		}
+	}
+	return &libvirt.ConnectAuth{
+		CredType: []libvirt.ConnectCredentialType{
+			libvirt.CRED_AUTHNAME, libvirt.CRED_PASSPHRASE,
+		},
+		Callback: callback,
+	}
+}
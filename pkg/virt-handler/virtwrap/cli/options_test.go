@@ -0,0 +1,77 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package cli
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/client-go/util/flowcontrol"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Connection options", func() {
+
+	It("should fall back to the defaults", func() {
+		options := newConnectionOptions(nil)
+		Expect(options.timeouts).To(Equal(DefaultConnectionTimeouts()))
+		Expect(options.keepAliveInterval).To(BeZero())
+		Expect(options.auth.CredType).To(ConsistOf(libvirt.CRED_AUTHNAME, libvirt.CRED_PASSPHRASE))
+	})
+
+	It("should apply all given options", func() {
+		timeouts := ConnectionTimeouts{Connect: time.Minute, RetryInterval: time.Second, CheckInterval: time.Second}
+		rateLimiter := flowcontrol.NewTokenBucketRateLimiter(1, 1)
+		options := newConnectionOptions([]ConnectionOption{
+			WithTimeouts(timeouts),
+			WithRateLimiter(rateLimiter),
+			WithKeepAlive(5, 3),
+			WithReadOnly(),
+		})
+		Expect(options.timeouts).To(Equal(timeouts))
+		Expect(options.rateLimiter).To(BeIdenticalTo(rateLimiter))
+		Expect(options.keepAliveInterval).To(Equal(5))
+		Expect(options.keepAliveCount).To(Equal(uint(3)))
+		Expect(options.readOnly).To(BeTrue())
+	})
+
+	It("should answer credential requests with the given credentials", func() {
+		options := newConnectionOptions([]ConnectionOption{WithCredentials("user", "secret")})
+		creds := []*libvirt.ConnectCredential{{Type: libvirt.CRED_AUTHNAME}, {Type: libvirt.CRED_PASSPHRASE}}
+		options.auth.Callback(creds)
+		Expect(creds[0].Result).To(Equal("user"))
+		Expect(creds[1].Result).To(Equal("secret"))
+	})
+
+	It("should add the PKI path to the uri", func() {
+		options := newConnectionOptions([]ConnectionOption{WithPKIPath("/etc/pki/kubevirt")})
+		uri, err := options.connectURI("qemu+tls://node01/system?no_verify=1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(uri).To(Equal("qemu+tls://node01/system?no_verify=1&pkipath=%2Fetc%2Fpki%2Fkubevirt"))
+	})
+
+	It("should leave the uri alone without a PKI path", func() {
+		uri, err := newConnectionOptions(nil).connectURI("qemu:///system")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(uri).To(Equal("qemu:///system"))
+	})
+})
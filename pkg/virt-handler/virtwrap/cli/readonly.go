@@ -0,0 +1,421 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package cli
+
+import (
+	"errors"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+// ErrReadOnly is returned by all methods of read only connections and of the
+// objects they hand out which would change something.
+var ErrReadOnly = errors.New("the connection to libvirt is read only")
+
+// NewReadOnlyConnection wraps a connection, so that all methods which would
+// change something fail with ErrReadOnly. Lookups hand out read only
+// objects as well.
+func NewReadOnlyConnection(conn Connection) Connection {
+	return &readOnlyConnection{conn}
+}
+
+type readOnlyConnection struct {
+	Connection
+}
+
+func (c *readOnlyConnection) LookupDomainByName(name string) (VirDomain, error) {
+	dom, err := c.Connection.LookupDomainByName(name)
+	if err != nil {
+		return nil, err
+	}
+	return &readOnlyDomain{dom}, nil
+}
+
+func (c *readOnlyConnection) LookupDomainByUUIDString(uuid string) (VirDomain, error) {
+	dom, err := c.Connection.LookupDomainByUUIDString(uuid)
+	if err != nil {
+		return nil, err
+	}
+	return &readOnlyDomain{dom}, nil
+}
+
+func (c *readOnlyConnection) ListAllDomains(flags libvirt.ConnectListAllDomainsFlags) ([]VirDomain, error) {
+	doms, err := c.Connection.ListAllDomains(flags)
+	if err != nil {
+		return nil, err
+	}
+	for i := range doms {
+		doms[i] = &readOnlyDomain{doms[i]}
+	}
+	return doms, nil
+}
+
+func (c *readOnlyConnection) DomainDefineXML(xml string) (VirDomain, error) {
+	return nil, ErrReadOnly
+}
+
+func (c *readOnlyConnection) DomainDefineXMLFlags(xml string, flags libvirt.DomainDefineFlags) (VirDomain, error) {
+	return nil, ErrReadOnly
+}
+
+func (c *readOnlyConnection) LookupSecretByUsage(usageType libvirt.SecretUsageType, usageID string) (VirSecret, error) {
+	secret, err := c.Connection.LookupSecretByUsage(usageType, usageID)
+	if err != nil {
+		return nil, err
+	}
+	return &readOnlySecret{secret}, nil
+}
+
+func (c *readOnlyConnection) LookupSecretByUUIDString(uuid string) (VirSecret, error) {
+	secret, err := c.Connection.LookupSecretByUUIDString(uuid)
+	if err != nil {
+		return nil, err
+	}
+	return &readOnlySecret{secret}, nil
+}
+
+func (c *readOnlyConnection) ListAllSecrets(flags libvirt.ConnectListAllSecretsFlags) ([]VirSecret, error) {
+	secrets, err := c.Connection.ListAllSecrets(flags)
+	if err != nil {
+		return nil, err
+	}
+	for i := range secrets {
+		secrets[i] = &readOnlySecret{secrets[i]}
+	}
+	return secrets, nil
+}
+
+func (c *readOnlyConnection) SecretDefineXML(xml string) (VirSecret, error) {
+	return nil, ErrReadOnly
+}
+
+func (c *readOnlyConnection) LookupNodeDeviceByName(name string) (VirNodeDevice, error) {
+	dev, err := c.Connection.LookupNodeDeviceByName(name)
+	if err != nil {
+		return nil, err
+	}
+	return &readOnlyNodeDevice{dev}, nil
+}
+
+func (c *readOnlyConnection) ListAllNodeDevices(flags libvirt.ConnectListAllNodeDeviceFlags) ([]VirNodeDevice, error) {
+	devs, err := c.Connection.ListAllNodeDevices(flags)
+	if err != nil {
+		return nil, err
+	}
+	for i := range devs {
+		devs[i] = &readOnlyNodeDevice{devs[i]}
+	}
+	return devs, nil
+}
+
+func (c *readOnlyConnection) StoragePoolDefineXML(xml string) (VirStoragePool, error) {
+	return nil, ErrReadOnly
+}
+
+func (c *readOnlyConnection) LookupStoragePoolByName(name string) (VirStoragePool, error) {
+	pool, err := c.Connection.LookupStoragePoolByName(name)
+	if err != nil {
+		return nil, err
+	}
+	return &readOnlyStoragePool{pool}, nil
+}
+
+func (c *readOnlyConnection) ListAllStoragePools(flags libvirt.ConnectListAllStoragePoolsFlags) ([]VirStoragePool, error) {
+	pools, err := c.Connection.ListAllStoragePools(flags)
+	if err != nil {
+		return nil, err
+	}
+	for i := range pools {
+		pools[i] = &readOnlyStoragePool{pools[i]}
+	}
+	return pools, nil
+}
+
+func (c *readOnlyConnection) NWFilterDefineXML(xml string) (VirNWFilter, error) {
+	return nil, ErrReadOnly
+}
+
+func (c *readOnlyConnection) LookupNWFilterByName(name string) (VirNWFilter, error) {
+	filter, err := c.Connection.LookupNWFilterByName(name)
+	if err != nil {
+		return nil, err
+	}
+	return &readOnlyNWFilter{filter}, nil
+}
+
+func (c *readOnlyConnection) ListAllNWFilters(flags uint32) ([]VirNWFilter, error) {
+	filters, err := c.Connection.ListAllNWFilters(flags)
+	if err != nil {
+		return nil, err
+	}
+	for i := range filters {
+		filters[i] = &readOnlyNWFilter{filters[i]}
+	}
+	return filters, nil
+}
+
+// readOnlyDomain also refuses consoles, channels, screenshots and monitor or
+// agent commands, since they can change the guest or libvirtd refuses them on
+// read only connections anyway.
+type readOnlyDomain struct {
+	VirDomain
+}
+
+func (d *readOnlyDomain) Create() error {
+	return ErrReadOnly
+}
+
+func (d *readOnlyDomain) CreateWithFlags(flags libvirt.DomainCreateFlags) error {
+	return ErrReadOnly
+}
+
+func (d *readOnlyDomain) Resume() error {
+	return ErrReadOnly
+}
+
+func (d *readOnlyDomain) Shutdown() error {
+	return ErrReadOnly
+}
+
+func (d *readOnlyDomain) Destroy() error {
+	return ErrReadOnly
+}
+
+func (d *readOnlyDomain) Undefine() error {
+	return ErrReadOnly
+}
+
+func (d *readOnlyDomain) UndefineFlags(flags libvirt.DomainUndefineFlagsValues) error {
+	return ErrReadOnly
+}
+
+func (d *readOnlyDomain) OpenConsole(devname string, stream *libvirt.Stream, flags libvirt.DomainConsoleFlags) error {
+	return ErrReadOnly
+}
+
+func (d *readOnlyDomain) OpenChannel(name string, stream *libvirt.Stream, flags libvirt.DomainChannelFlags) error {
+	return ErrReadOnly
+}
+
+func (d *readOnlyDomain) PinVcpuFlags(vcpu uint, cpuMap []bool, flags libvirt.DomainModificationImpact) error {
+	return ErrReadOnly
+}
+
+func (d *readOnlyDomain) PinEmulator(cpuMap []bool, flags libvirt.DomainModificationImpact) error {
+	return ErrReadOnly
+}
+
+func (d *readOnlyDomain) PinIOThread(iothreadid uint, cpuMap []bool, flags libvirt.DomainModificationImpact) error {
+	return ErrReadOnly
+}
+
+func (d *readOnlyDomain) AddIOThread(id uint, flags libvirt.DomainModificationImpact) error {
+	return ErrReadOnly
+}
+
+func (d *readOnlyDomain) BlockResize(disk string, size uint64, flags libvirt.DomainBlockResizeFlags) error {
+	return ErrReadOnly
+}
+
+func (d *readOnlyDomain) SetBlockIoTune(disk string, params *libvirt.DomainBlockIoTuneParameters, flags libvirt.DomainModificationImpact) error {
+	return ErrReadOnly
+}
+
+func (d *readOnlyDomain) SetInterfaceParameters(device string, params *libvirt.DomainInterfaceParameters, flags libvirt.DomainModificationImpact) error {
+	return ErrReadOnly
+}
+
+func (d *readOnlyDomain) SetMetadata(metadata string, metadataType libvirt.DomainMetadataType, key string, uri string, flags libvirt.DomainModificationImpact) error {
+	return ErrReadOnly
+}
+
+func (d *readOnlyDomain) AbortJob() error {
+	return ErrReadOnly
+}
+
+func (d *readOnlyDomain) MigrateSetMaxSpeed(speed uint64, flags uint32) error {
+	return ErrReadOnly
+}
+
+func (d *readOnlyDomain) MigrateSetMaxDowntime(downtime uint64, flags uint32) error {
+	return ErrReadOnly
+}
+
+func (d *readOnlyDomain) MigrateStartPostCopy(flags uint32) error {
+	return ErrReadOnly
+}
+
+func (d *readOnlyDomain) SetAutostart(autostart bool) error {
+	return ErrReadOnly
+}
+
+func (d *readOnlyDomain) Rename(name string, flags uint32) error {
+	return ErrReadOnly
+}
+
+func (d *readOnlyDomain) CoreDump(to string, flags libvirt.DomainCoreDumpFlags) error {
+	return ErrReadOnly
+}
+
+func (d *readOnlyDomain) CoreDumpWithFormat(to string, format libvirt.DomainCoreDumpFormat, flags libvirt.DomainCoreDumpFlags) error {
+	return ErrReadOnly
+}
+
+func (d *readOnlyDomain) Screenshot(stream *libvirt.Stream, screen uint32, flags uint32) (string, error) {
+	return "", ErrReadOnly
+}
+
+func (d *readOnlyDomain) SendKey(codeset uint, holdtime uint, keycodes []uint, flags uint32) error {
+	return ErrReadOnly
+}
+
+func (d *readOnlyDomain) SetPerfEvents(params *libvirt.DomainPerfEvents, flags libvirt.DomainModificationImpact) error {
+	return ErrReadOnly
+}
+
+func (d *readOnlyDomain) QemuMonitorCommand(command string, flags libvirt.DomainQemuMonitorCommandFlags) (string, error) {
+	return "", ErrReadOnly
+}
+
+func (d *readOnlyDomain) QemuAgentCommand(command string, timeout libvirt.DomainQemuAgentCommandTimeout, flags uint32) (string, error) {
+	return "", ErrReadOnly
+}
+
+func (d *readOnlyDomain) FSTrim(mountpoint string, minimum uint64, flags uint32) error {
+	return ErrReadOnly
+}
+
+func (d *readOnlyDomain) SetSchedulerParametersFlags(params *libvirt.DomainSchedulerParameters, flags libvirt.DomainModificationImpact) error {
+	return ErrReadOnly
+}
+
+func (d *readOnlyDomain) SetMemoryParameters(params *libvirt.DomainMemoryParameters, flags libvirt.DomainModificationImpact) error {
+	return ErrReadOnly
+}
+
+func (d *readOnlyDomain) SetBlkioParameters(params *libvirt.DomainBlkioParameters, flags libvirt.DomainModificationImpact) error {
+	return ErrReadOnly
+}
+
+type readOnlySecret struct {
+	VirSecret
+}
+
+func (s *readOnlySecret) SetValue(value []byte, flags uint32) error {
+	return ErrReadOnly
+}
+
+func (s *readOnlySecret) Undefine() error {
+	return ErrReadOnly
+}
+
+type readOnlyNodeDevice struct {
+	VirNodeDevice
+}
+
+func (d *readOnlyNodeDevice) Detach() error {
+	return ErrReadOnly
+}
+
+func (d *readOnlyNodeDevice) ReAttach() error {
+	return ErrReadOnly
+}
+
+func (d *readOnlyNodeDevice) Reset() error {
+	return ErrReadOnly
+}
+
+type readOnlyNWFilter struct {
+	VirNWFilter
+}
+
+func (f *readOnlyNWFilter) Undefine() error {
+	return ErrReadOnly
+}
+
+type readOnlyStoragePool struct {
+	VirStoragePool
+}
+
+func (p *readOnlyStoragePool) Build(flags libvirt.StoragePoolBuildFlags) error {
+	return ErrReadOnly
+}
+
+func (p *readOnlyStoragePool) Create(flags libvirt.StoragePoolCreateFlags) error {
+	return ErrReadOnly
+}
+
+func (p *readOnlyStoragePool) SetAutostart(autostart bool) error {
+	return ErrReadOnly
+}
+
+func (p *readOnlyStoragePool) Refresh(flags uint32) error {
+	return ErrReadOnly
+}
+
+func (p *readOnlyStoragePool) LookupStorageVolByName(name string) (VirStorageVol, error) {
+	vol, err := p.VirStoragePool.LookupStorageVolByName(name)
+	if err != nil {
+		return nil, err
+	}
+	return &readOnlyStorageVol{vol}, nil
+}
+
+func (p *readOnlyStoragePool) ListAllStorageVolumes(flags uint32) ([]VirStorageVol, error) {
+	vols, err := p.VirStoragePool.ListAllStorageVolumes(flags)
+	if err != nil {
+		return nil, err
+	}
+	for i := range vols {
+		vols[i] = &readOnlyStorageVol{vols[i]}
+	}
+	return vols, nil
+}
+
+func (p *readOnlyStoragePool) StorageVolCreateXML(xml string, flags libvirt.StorageVolCreateFlags) (VirStorageVol, error) {
+	return nil, ErrReadOnly
+}
+
+func (p *readOnlyStoragePool) StorageVolCreateXMLFrom(xml string, sourceName string, flags libvirt.StorageVolCreateFlags) (VirStorageVol, error) {
+	return nil, ErrReadOnly
+}
+
+func (p *readOnlyStoragePool) Destroy() error {
+	return ErrReadOnly
+}
+
+func (p *readOnlyStoragePool) Undefine() error {
+	return ErrReadOnly
+}
+
+type readOnlyStorageVol struct {
+	VirStorageVol
+}
+
+func (v *readOnlyStorageVol) Resize(capacity uint64, flags libvirt.StorageVolResizeFlags) error {
+	return ErrReadOnly
+}
+
+func (v *readOnlyStorageVol) Upload(stream *libvirt.Stream, offset uint64, length uint64, flags libvirt.StorageVolUploadFlags) error {
+	return ErrReadOnly
+}
+
+func (v *readOnlyStorageVol) Delete(flags libvirt.StorageVolDeleteFlags) error {
+	return ErrReadOnly
+}
@@ -0,0 +1,83 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package cli
+
+import (
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Read only connection", func() {
+	var ctrl *gomock.Controller
+	var mockConn *MockConnection
+	var mockDomain *MockVirDomain
+	var conn Connection
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockConn = NewMockConnection(ctrl)
+		mockDomain = NewMockVirDomain(ctrl)
+		conn = NewReadOnlyConnection(mockConn)
+	})
+
+	It("should refuse to define domains", func() {
+		_, err := conn.DomainDefineXML("<domain/>")
+		Expect(err).To(Equal(ErrReadOnly))
+		_, err = conn.SecretDefineXML("<secret/>")
+		Expect(err).To(Equal(ErrReadOnly))
+	})
+
+	It("should pass through reads", func() {
+		mockConn.EXPECT().GetLibVersion().Return(uint32(3000000), nil)
+		version, err := conn.GetLibVersion()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(version).To(Equal(uint32(3000000)))
+	})
+
+	It("should hand out read only domains", func() {
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+		mockDomain.EXPECT().GetState().Return(libvirt.DOMAIN_RUNNING, 1, nil)
+		mockDomain.EXPECT().Free()
+
+		dom, err := conn.LookupDomainByName("default_testvm")
+		Expect(err).ToNot(HaveOccurred())
+		state, _, err := dom.GetState()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).To(Equal(libvirt.DOMAIN_RUNNING))
+		Expect(dom.Destroy()).To(Equal(ErrReadOnly))
+		Expect(dom.SetMetadata("", libvirt.DOMAIN_METADATA_ELEMENT, "", "", libvirt.DOMAIN_AFFECT_LIVE)).To(Equal(ErrReadOnly))
+		Expect(dom.Free()).To(Succeed())
+	})
+
+	It("should hand out read only domains when listing them", func() {
+		mockConn.EXPECT().ListAllDomains(libvirt.CONNECT_LIST_DOMAINS_ACTIVE).Return([]VirDomain{mockDomain}, nil)
+
+		doms, err := conn.ListAllDomains(libvirt.CONNECT_LIST_DOMAINS_ACTIVE)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(doms).To(HaveLen(1))
+		Expect(doms[0].Create()).To(Equal(ErrReadOnly))
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+})
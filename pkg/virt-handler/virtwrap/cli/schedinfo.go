@@ -0,0 +1,159 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package cli
+
+import (
+	"fmt"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+// Bounds of the CFS bandwidth control of the cgroup cpu controller, in
+// microseconds. A quota of -1 means unlimited.
+const (
+	minCFSPeriod = 1000
+	maxCFSPeriod = 1000000
+	minCFSQuota  = 1000
+	maxCFSQuota  = 17592186044415
+)
+
+// SchedulerTuning holds the CFS parameters of the cgroups of a domain. The
+// period and the quota apply to each vCPU, the emulator ones to the qemu
+// threads which are not vCPUs or IOThreads. Unset fields are left alone.
+type SchedulerTuning struct {
+	Shares         *uint64
+	Period         *uint64
+	Quota          *int64
+	EmulatorPeriod *uint64
+	EmulatorQuota  *int64
+}
+
+// CPUStats is the CPU time of a domain in nanoseconds. Total includes the
+// emulator threads, VCPU only the time the guest ran.
+type CPUStats struct {
+	Total  uint64
+	User   uint64
+	System uint64
+	VCPU   uint64
+}
+
+func validatePeriod(name string, period *uint64) error {
+	if period != nil && (*period < minCFSPeriod || *period > maxCFSPeriod) {
+		return fmt.Errorf("%s must be between %d and %d, got %d", name, minCFSPeriod, maxCFSPeriod, *period)
+	}
+	return nil
+}
+
+func validateQuota(name string, quota *int64) error {
+	if quota != nil && *quota != -1 && (*quota < minCFSQuota || *quota > maxCFSQuota) {
+		return fmt.Errorf("%s must be -1 or between %d and %d, got %d", name, minCFSQuota, maxCFSQuota, *quota)
+	}
+	return nil
+}
+
+// Validate checks the parameters against the limits of the cgroup cpu
+// controller.
+func (t *SchedulerTuning) Validate() error {
+	if t.Shares != nil && *t.Shares < 2 {
+		return fmt.Errorf("shares must be at least 2, got %d", *t.Shares)
+	}
+	if err := validatePeriod("period", t.Period); err != nil {
+		return err
+	}
+	if err := validatePeriod("emulator period", t.EmulatorPeriod); err != nil {
+		return err
+	}
+	if err := validateQuota("quota", t.Quota); err != nil {
+		return err
+	}
+	return validateQuota("emulator quota", t.EmulatorQuota)
+}
+
+// GetSchedulerTuning returns the scheduler parameters of a running domain.
+func GetSchedulerTuning(dom VirDomain) (*SchedulerTuning, error) {
+	params, err := dom.GetSchedulerParametersFlags(libvirt.DOMAIN_AFFECT_LIVE)
+	if err != nil {
+		return nil, err
+	}
+	tuning := &SchedulerTuning{}
+	if params.CpuSharesSet {
+		tuning.Shares = &params.CpuShares
+	}
+	if params.VcpuPeriodSet {
+		tuning.Period = &params.VcpuPeriod
+	}
+	if params.VcpuQuotaSet {
+		tuning.Quota = &params.VcpuQuota
+	}
+	if params.EmulatorPeriodSet {
+		tuning.EmulatorPeriod = &params.EmulatorPeriod
+	}
+	if params.EmulatorQuotaSet {
+		tuning.EmulatorQuota = &params.EmulatorQuota
+	}
+	return tuning, nil
+}
+
+// SetSchedulerTuning changes the scheduler parameters of a running domain,
+// e.g. to throttle the emulator threads of a noisy guest.
+func SetSchedulerTuning(dom VirDomain, tuning *SchedulerTuning) error {
+	if err := tuning.Validate(); err != nil {
+		return err
+	}
+	params := &libvirt.DomainSchedulerParameters{}
+	if tuning.Shares != nil {
+		params.CpuSharesSet = true
+		params.CpuShares = *tuning.Shares
+	}
+	if tuning.Period != nil {
+		params.VcpuPeriodSet = true
+		params.VcpuPeriod = *tuning.Period
+	}
+	if tuning.Quota != nil {
+		params.VcpuQuotaSet = true
+		params.VcpuQuota = *tuning.Quota
+	}
+	if tuning.EmulatorPeriod != nil {
+		params.EmulatorPeriodSet = true
+		params.EmulatorPeriod = *tuning.EmulatorPeriod
+	}
+	if tuning.EmulatorQuota != nil {
+		params.EmulatorQuotaSet = true
+		params.EmulatorQuota = *tuning.EmulatorQuota
+	}
+	return dom.SetSchedulerParametersFlags(params, libvirt.DOMAIN_AFFECT_LIVE)
+}
+
+// GetCPUStats returns the CPU time which a running domain used in total.
+func GetCPUStats(dom VirDomain) (*CPUStats, error) {
+	// A start CPU of -1 asks for the sum over all host CPUs
+	stats, err := dom.GetCPUStats(-1, 1, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(stats) == 0 {
+		return nil, fmt.Errorf("libvirt returned no CPU stats")
+	}
+	return &CPUStats{
+		Total:  stats[0].CpuTime,
+		User:   stats[0].UserTime,
+		System: stats[0].SystemTime,
+		VCPU:   stats[0].VcpuTime,
+	}, nil
+}
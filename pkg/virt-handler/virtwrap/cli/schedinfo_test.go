@@ -0,0 +1,97 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package cli
+
+import (
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Scheduler tuning", func() {
+	var ctrl *gomock.Controller
+	var mockDomain *MockVirDomain
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockDomain = NewMockVirDomain(ctrl)
+	})
+
+	It("should only set the given parameters", func() {
+		period := uint64(100000)
+		quota := int64(50000)
+		mockDomain.EXPECT().SetSchedulerParametersFlags(&libvirt.DomainSchedulerParameters{
+			EmulatorPeriodSet: true,
+			EmulatorPeriod:    100000,
+			EmulatorQuotaSet:  true,
+			EmulatorQuota:     50000,
+		}, libvirt.DOMAIN_AFFECT_LIVE).Return(nil)
+		Expect(SetSchedulerTuning(mockDomain, &SchedulerTuning{EmulatorPeriod: &period, EmulatorQuota: &quota})).To(Succeed())
+	})
+
+	It("should return the parameters which libvirt reported", func() {
+		mockDomain.EXPECT().GetSchedulerParametersFlags(libvirt.DOMAIN_AFFECT_LIVE).Return(&libvirt.DomainSchedulerParameters{
+			CpuSharesSet:  true,
+			CpuShares:     1024,
+			VcpuQuotaSet:  true,
+			VcpuQuota:     -1,
+			VcpuPeriodSet: false,
+		}, nil)
+		tuning, err := GetSchedulerTuning(mockDomain)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(*tuning.Shares).To(Equal(uint64(1024)))
+		Expect(*tuning.Quota).To(Equal(int64(-1)))
+		Expect(tuning.Period).To(BeNil())
+		Expect(tuning.EmulatorQuota).To(BeNil())
+	})
+
+	table.DescribeTable("should reject parameters the cpu controller does not accept", func(tuning *SchedulerTuning) {
+		Expect(SetSchedulerTuning(mockDomain, tuning)).ToNot(Succeed())
+	},
+		table.Entry("too few shares", &SchedulerTuning{Shares: newUint64(1)}),
+		table.Entry("a too short period", &SchedulerTuning{Period: newUint64(999)}),
+		table.Entry("a too long emulator period", &SchedulerTuning{EmulatorPeriod: newUint64(1000001)}),
+		table.Entry("a too small quota", &SchedulerTuning{Quota: newInt64(10)}),
+		table.Entry("a negative emulator quota", &SchedulerTuning{EmulatorQuota: newInt64(-2)}),
+	)
+
+	It("should sum up the CPU time over all host CPUs", func() {
+		mockDomain.EXPECT().GetCPUStats(-1, uint(1), uint32(0)).Return([]libvirt.DomainCPUStats{
+			{CpuTimeSet: true, CpuTime: 5000, UserTimeSet: true, UserTime: 1000, SystemTimeSet: true, SystemTime: 500, VcpuTimeSet: true, VcpuTime: 4000},
+		}, nil)
+		stats, err := GetCPUStats(mockDomain)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(*stats).To(Equal(CPUStats{Total: 5000, User: 1000, System: 500, VCPU: 4000}))
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+})
+
+func newUint64(v uint64) *uint64 {
+	return &v
+}
+
+func newInt64(v int64) *int64 {
+	return &v
+}
@@ -0,0 +1,247 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package cli
+
+import (
+	"io"
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/errors"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+const streamChunkSize = 256 * 1024
+
+// lseek whence values to find data and holes in sparse files on Linux
+const (
+	seekData = 3
+	seekHole = 4
+)
+
+// CopyOptions control how data is copied between a stream and its peer.
+type CopyOptions struct {
+	// Operation labels the transferred bytes, e.g. "upload" or "console"
+	Operation string
+	// BytesPerSecond limits the bandwidth of the copy, 0 means unlimited
+	BytesPerSecond int64
+}
+
+// CopyToStream sends everything from reader through the stream, until
+// reader is drained or ctx is cancelled. libvirt aborts the stream on
+// failures, the caller only has to finish it on success.
+func (s *VirStream) CopyToStream(ctx context.Context, reader io.Reader, opts CopyOptions) (int64, error) {
+	copier := newStreamCopier(ctx, opts, "send")
+	err := s.Stream.SendAll(copier.source(reader))
+	return copier.transferred, errors.NewHypervisorError(err)
+}
+
+// CopyFromStream writes everything received from the stream to writer, until
+// the stream ends or ctx is cancelled. libvirt aborts the stream on
+// failures, the caller only has to finish it on success.
+func (s *VirStream) CopyFromStream(ctx context.Context, writer io.Writer, opts CopyOptions) (int64, error) {
+	copier := newStreamCopier(ctx, opts, "receive")
+	err := s.Stream.RecvAll(copier.sink(writer))
+	return copier.transferred, errors.NewHypervisorError(err)
+}
+
+// CopyToStreamSparse sends the content of file through the stream, holes in
+// the file are only announced instead of being sent as zeros. The stream has
+// to be opened with a sparse upload flag, e.g.
+// STORAGE_VOL_UPLOAD_SPARSE_STREAM.
+func (s *VirStream) CopyToStreamSparse(ctx context.Context, file *os.File, opts CopyOptions) (int64, error) {
+	copier := newStreamCopier(ctx, opts, "send")
+	err := s.Stream.SparseSendAll(copier.source(file), copier.sourceHole(file), copier.sourceSkip(file))
+	return copier.transferred, errors.NewHypervisorError(err)
+}
+
+// CopyFromStreamSparse writes everything received from the stream to file
+// and recreates the holes of the source, instead of writing zeros. The
+// stream has to be opened with a sparse download flag, e.g.
+// STORAGE_VOL_DOWNLOAD_SPARSE_STREAM.
+func (s *VirStream) CopyFromStreamSparse(ctx context.Context, file *os.File, opts CopyOptions) (int64, error) {
+	copier := newStreamCopier(ctx, opts, "receive")
+	if err := s.Stream.SparseRecvAll(copier.sink(file), copier.sinkHole(file)); err != nil {
+		return copier.transferred, errors.NewHypervisorError(err)
+	}
+	return copier.transferred, truncateAtOffset(file)
+}
+
+type streamCopier struct {
+	ctx         context.Context
+	opts        CopyOptions
+	direction   string
+	started     time.Time
+	transferred int64
+	// sleep is replaced in tests
+	sleep func(time.Duration)
+}
+
+func newStreamCopier(ctx context.Context, opts CopyOptions, direction string) *streamCopier {
+	if opts.Operation == "" {
+		opts.Operation = "unknown"
+	}
+	return &streamCopier{
+		ctx:       ctx,
+		opts:      opts,
+		direction: direction,
+		started:   time.Now(),
+		sleep:     time.Sleep,
+	}
+}
+
+// source feeds libvirt from reader. Returning no data tells libvirt that
+// the end of the stream is reached.
+func (c *streamCopier) source(reader io.Reader) libvirt.StreamSourceFunc {
+	return func(_ *libvirt.Stream, nbytes int) ([]byte, error) {
+		if err := c.ctx.Err(); err != nil {
+			return nil, err
+		}
+		if nbytes == 0 {
+			return nil, nil
+		}
+		if nbytes > streamChunkSize {
+			nbytes = streamChunkSize
+		}
+		// Interactive readers like consoles must not wait for a full buffer
+		buf := make([]byte, nbytes)
+		n, err := reader.Read(buf)
+		for n == 0 && err == nil {
+			n, err = reader.Read(buf)
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		c.account(n)
+		return buf[:n], nil
+	}
+}
+
+// sink hands everything libvirt received to writer.
+func (c *streamCopier) sink(writer io.Writer) libvirt.StreamSinkFunc {
+	return func(_ *libvirt.Stream, data []byte) (int, error) {
+		if err := c.ctx.Err(); err != nil {
+			return 0, err
+		}
+		n, err := writer.Write(data)
+		if err == nil && n != len(data) {
+			err = io.ErrShortWrite
+		}
+		if err != nil {
+			return n, err
+		}
+		c.account(n)
+		return n, nil
+	}
+}
+
+// account counts transferred bytes and slows the copy down to the allowed
+// bandwidth.
+func (c *streamCopier) account(n int) {
+	c.transferred += int64(n)
+	streamBytes.WithLabelValues(c.opts.Operation, c.direction).Add(float64(n))
+	if c.opts.BytesPerSecond <= 0 {
+		return
+	}
+	due := time.Duration(float64(c.transferred) / float64(c.opts.BytesPerSecond) * float64(time.Second))
+	if ahead := due - time.Since(c.started); ahead > 0 {
+		c.sleep(ahead)
+	}
+}
+
+// sourceHole tells libvirt whether the current offset of file is in a data
+// section or in a hole, and how long that section is.
+func (c *streamCopier) sourceHole(file *os.File) libvirt.StreamSourceHoleFunc {
+	return func(_ *libvirt.Stream) (bool, int64, error) {
+		if err := c.ctx.Err(); err != nil {
+			return false, 0, err
+		}
+		return fileSection(file)
+	}
+}
+
+// sourceSkip moves past a hole which libvirt announced to the peer.
+func (c *streamCopier) sourceSkip(file *os.File) libvirt.StreamSourceSkipFunc {
+	return func(_ *libvirt.Stream, length int64) error {
+		_, err := file.Seek(length, io.SeekCurrent)
+		return err
+	}
+}
+
+// sinkHole recreates a hole by seeking over it instead of writing zeros.
+func (c *streamCopier) sinkHole(file *os.File) libvirt.StreamSinkHoleFunc {
+	return func(_ *libvirt.Stream, length int64) error {
+		if err := c.ctx.Err(); err != nil {
+			return err
+		}
+		_, err := file.Seek(length, io.SeekCurrent)
+		return err
+	}
+}
+
+// fileSection returns whether the current offset of file is in data or in a
+// hole, and the length of that section. The offset is left unchanged.
+func fileSection(file *os.File) (bool, int64, error) {
+	offset, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return false, 0, err
+	}
+	defer file.Seek(offset, io.SeekStart)
+
+	data, err := file.Seek(offset, seekData)
+	if isENXIO(err) {
+		// Only a hole is left until the end of the file
+		info, err := file.Stat()
+		if err != nil {
+			return false, 0, err
+		}
+		return false, info.Size() - offset, nil
+	} else if err != nil {
+		return false, 0, err
+	}
+	if data > offset {
+		return false, data - offset, nil
+	}
+	hole, err := file.Seek(offset, seekHole)
+	if err != nil {
+		return false, 0, err
+	}
+	return true, hole - offset, nil
+}
+
+// truncateAtOffset cuts file at its current offset, which also extends it
+// if it ends with a hole which was only seeked over.
+func truncateAtOffset(file *os.File) error {
+	offset, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	return file.Truncate(offset)
+}
+
+func isENXIO(err error) bool {
+	if pathErr, ok := err.(*os.PathError); ok {
+		return pathErr.Err == syscall.ENXIO
+	}
+	return err == syscall.ENXIO
+}
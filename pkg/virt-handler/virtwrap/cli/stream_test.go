@@ -0,0 +1,133 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package cli
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/net/context"
+)
+
+var _ = Describe("Stream copy", func() {
+
+	It("should send the reader content in chunks until it is drained", func() {
+		copier := newStreamCopier(context.Background(), CopyOptions{Operation: "test"}, "send")
+		source := copier.source(bytes.NewBufferString("hello stream"))
+
+		data, err := source(nil, 5)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal("hello"))
+		data, err = source(nil, 64)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal(" stream"))
+		data, err = source(nil, 64)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(BeEmpty())
+		Expect(copier.transferred).To(Equal(int64(12)))
+	})
+
+	It("should write everything received to the writer", func() {
+		var buf bytes.Buffer
+		copier := newStreamCopier(context.Background(), CopyOptions{Operation: "test"}, "receive")
+		sink := copier.sink(&buf)
+
+		n, err := sink(nil, []byte("hello"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(5))
+		Expect(buf.String()).To(Equal("hello"))
+		Expect(copier.transferred).To(Equal(int64(5)))
+	})
+
+	It("should stop copying when the context is cancelled", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		copier := newStreamCopier(ctx, CopyOptions{Operation: "test"}, "send")
+
+		_, err := copier.source(bytes.NewBufferString("hello"))(nil, 5)
+		Expect(err).To(Equal(context.Canceled))
+		_, err = copier.sink(&bytes.Buffer{})(nil, []byte("hello"))
+		Expect(err).To(Equal(context.Canceled))
+		Expect(copier.transferred).To(BeZero())
+	})
+
+	Context("with sparse files", func() {
+		var file *os.File
+
+		BeforeEach(func() {
+			var err error
+			file, err = ioutil.TempFile("", "sparse")
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("should find data and holes", func() {
+			_, err := file.WriteAt([]byte("data"), 1<<20)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(file.Truncate(4 << 20)).To(Succeed())
+
+			inData, length, err := fileSection(file)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(inData).To(BeFalse())
+			Expect(length).To(Equal(int64(1 << 20)))
+
+			_, err = file.Seek(length, io.SeekCurrent)
+			Expect(err).ToNot(HaveOccurred())
+			inData, length, err = fileSection(file)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(inData).To(BeTrue())
+			Expect(length).To(BeNumerically(">=", 4))
+		})
+
+		It("should recreate holes instead of writing zeros", func() {
+			copier := newStreamCopier(context.Background(), CopyOptions{Operation: "test"}, "receive")
+			Expect(copier.sinkHole(file)(nil, 1<<20)).To(Succeed())
+			_, err := copier.sink(file)(nil, []byte("data"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(copier.sinkHole(file)(nil, 1<<20)).To(Succeed())
+			Expect(truncateAtOffset(file)).To(Succeed())
+
+			info, err := file.Stat()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.Size()).To(Equal(int64(2<<20 + 4)))
+			Expect(copier.transferred).To(Equal(int64(4)))
+		})
+
+		AfterEach(func() {
+			file.Close()
+			os.Remove(file.Name())
+		})
+	})
+
+	It("should slow down to the allowed bandwidth", func() {
+		var slept time.Duration
+		copier := newStreamCopier(context.Background(), CopyOptions{Operation: "test", BytesPerSecond: 1024}, "receive")
+		copier.sleep = func(d time.Duration) { slept += d }
+
+		_, err := copier.sink(&bytes.Buffer{})(nil, make([]byte, 2048))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(slept).To(BeNumerically(">", time.Second))
+		Expect(slept).To(BeNumerically("<=", 2*time.Second))
+	})
+})
@@ -0,0 +1,284 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package cli
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"golang.org/x/net/context"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/errors"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+const streamReadEvents = libvirt.STREAM_EVENT_READABLE | libvirt.STREAM_EVENT_ERROR | libvirt.STREAM_EVENT_HANGUP
+
+// The number of received chunks which may wait for a slow peer, before the
+// stream is not read from anymore.
+const streamPumpBacklog = 16
+
+// ServeEvents moves data between a stream opened with STREAM_NONBLOCK and
+// its peer until one of them ends, or ctx is cancelled. Data from the stream
+// is received from the libvirt event loop when it becomes readable, so that
+// no goroutine has to block in libvirt per stream. Writing it to the peer is
+// left to a goroutine of its own, a slow peer must not stall the event loop.
+// Bandwidth limits are not applied, sleeping would stall the event loop.
+// The peer is closed and nothing touches the stream anymore once this
+// returns, so that the caller can close the stream right away.
+func (s *VirStream) ServeEvents(ctx context.Context, peer io.ReadWriteCloser, opts CopyOptions) error {
+	opts.BytesPerSecond = 0
+	pump := newStreamPump(ctx, peer, opts)
+	pump.recv = s.Stream.Recv
+	pump.send = s.Stream.Send
+	pump.update = s.Stream.EventUpdateCallback
+
+	err := s.Stream.EventAddCallback(streamReadEvents, func(_ *libvirt.Stream, events libvirt.StreamEventType) {
+		pump.handleEvent(events)
+	})
+	if err != nil {
+		return errors.NewHypervisorError(err)
+	}
+
+	go pump.deliver()
+	peerDone := make(chan struct{})
+	go func() {
+		_, err := io.Copy(pump, peer)
+		pump.finish(err)
+		close(peerDone)
+	}()
+
+	select {
+	case err = <-pump.done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	s.Stream.EventRemoveCallback()
+	// Closing the peer unblocks the goroutines which read from and write to it
+	peer.Close()
+	pump.close()
+	<-peerDone
+	return err
+}
+
+// streamPump is driven by the events of a non-blocking stream. It hands
+// everything received to a goroutine which passes it on to the peer, and
+// queues everything the peer writes until the stream is writable.
+type streamPump struct {
+	recv   func([]byte) (int, error)
+	send   func([]byte) (int, error)
+	update func(libvirt.StreamEventType) error
+
+	peer     io.Writer
+	received *streamCopier
+	sent     *streamCopier
+
+	incoming  chan []byte
+	stopped   chan struct{}
+	delivered chan struct{}
+
+	lock     sync.Mutex
+	pending  []byte
+	readable bool
+	writable bool
+	closed   bool
+
+	done     chan error
+	doneOnce sync.Once
+}
+
+func newStreamPump(ctx context.Context, peer io.Writer, opts CopyOptions) *streamPump {
+	return &streamPump{
+		peer:      peer,
+		received:  newStreamCopier(ctx, opts, "receive"),
+		sent:      newStreamCopier(ctx, opts, "send"),
+		incoming:  make(chan []byte, streamPumpBacklog),
+		stopped:   make(chan struct{}),
+		delivered: make(chan struct{}),
+		readable:  true,
+		done:      make(chan error, 1),
+	}
+}
+
+func (p *streamPump) handleEvent(events libvirt.StreamEventType) {
+	if events&libvirt.STREAM_EVENT_READABLE != 0 {
+		p.receive()
+	}
+	if events&libvirt.STREAM_EVENT_WRITABLE != 0 {
+		p.lock.Lock()
+		err := p.flush()
+		p.lock.Unlock()
+		if err != nil {
+			p.finish(err)
+		}
+	}
+	if events&libvirt.STREAM_EVENT_ERROR != 0 {
+		p.finish(fmt.Errorf("stream failed"))
+	} else if events&libvirt.STREAM_EVENT_HANGUP != 0 {
+		p.finish(nil)
+	}
+}
+
+// receive drains the stream until it would block, or until the backlog for
+// the peer is full. In the latter case the stream is not read from until
+// deliver caught up.
+func (p *streamPump) receive() {
+	for {
+		if !p.hasBacklogSpace() {
+			return
+		}
+		buf := make([]byte, streamChunkSize)
+		n, err := p.recv(buf)
+		if isWouldBlock(err) {
+			return
+		}
+		if err == io.EOF || (err == nil && n == 0) {
+			p.finish(nil)
+			return
+		}
+		if err != nil {
+			p.finish(errors.NewHypervisorError(err))
+			return
+		}
+		// Only the event loop adds to the backlog, so this never blocks
+		p.incoming <- buf[:n]
+	}
+}
+
+func (p *streamPump) hasBacklogSpace() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if len(p.incoming) < cap(p.incoming) {
+		return true
+	}
+	if err := p.watch(false, p.writable); err != nil {
+		p.finish(err)
+	}
+	return false
+}
+
+// deliver passes everything received on to the peer, until the pump is
+// closed.
+func (p *streamPump) deliver() {
+	defer close(p.delivered)
+	for {
+		select {
+		case data := <-p.incoming:
+			if err := p.resumeReceiving(); err != nil {
+				p.finish(err)
+				return
+			}
+			if _, err := p.peer.Write(data); err != nil {
+				p.finish(err)
+				return
+			}
+			p.received.account(len(data))
+		case <-p.stopped:
+			return
+		}
+	}
+}
+
+func (p *streamPump) resumeReceiving() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.closed {
+		return nil
+	}
+	return p.watch(true, p.writable)
+}
+
+// Write queues data for the stream and sends as much of it as the stream
+// accepts right away.
+func (p *streamPump) Write(data []byte) (int, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.closed {
+		return 0, io.ErrClosedPipe
+	}
+	p.pending = append(p.pending, data...)
+	return len(data), p.flush()
+}
+
+// flush sends pending data until the stream would block, and only asks for
+// writable events while data is pending. The lock has to be held.
+func (p *streamPump) flush() error {
+	for len(p.pending) > 0 {
+		n, err := p.send(p.pending)
+		if isWouldBlock(err) {
+			return p.watch(p.readable, true)
+		}
+		if err != nil {
+			return errors.NewHypervisorError(err)
+		}
+		p.sent.account(n)
+		p.pending = p.pending[n:]
+	}
+	return p.watch(p.readable, false)
+}
+
+// watch updates the events of the stream we are interested in. The lock has
+// to be held.
+func (p *streamPump) watch(readable bool, writable bool) error {
+	if p.readable == readable && p.writable == writable {
+		return nil
+	}
+	events := libvirt.STREAM_EVENT_ERROR | libvirt.STREAM_EVENT_HANGUP
+	if readable {
+		events |= libvirt.STREAM_EVENT_READABLE
+	}
+	if writable {
+		events |= libvirt.STREAM_EVENT_WRITABLE
+	}
+	if err := p.update(events); err != nil {
+		return errors.NewHypervisorError(err)
+	}
+	p.readable = readable
+	p.writable = writable
+	return nil
+}
+
+func (p *streamPump) finish(err error) {
+	p.doneOnce.Do(func() {
+		p.done <- err
+	})
+}
+
+// close makes sure that the stream is not used anymore. Writes which come
+// in later fail, and deliver is stopped.
+func (p *streamPump) close() {
+	p.lock.Lock()
+	p.closed = true
+	p.lock.Unlock()
+
+	close(p.stopped)
+	<-p.delivered
+}
+
+// isWouldBlock detects non-blocking stream calls which returned -2. libvirt
+// does not set an error in that case.
+func isWouldBlock(err error) bool {
+	return err != nil && errors.IsOk(err)
+}
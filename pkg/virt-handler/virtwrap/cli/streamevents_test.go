@@ -0,0 +1,142 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package cli
+
+import (
+	"bytes"
+	"io"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/net/context"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Stream events", func() {
+	wouldBlock := libvirt.Error{Code: libvirt.ERR_OK}
+
+	var peer *bytes.Buffer
+	var pump *streamPump
+	var updates []libvirt.StreamEventType
+
+	BeforeEach(func() {
+		peer = &bytes.Buffer{}
+		updates = nil
+		pump = newStreamPump(context.Background(), peer, CopyOptions{Operation: "test"})
+		pump.update = func(events libvirt.StreamEventType) error {
+			updates = append(updates, events)
+			return nil
+		}
+	})
+
+	It("should hand everything readable over until the stream would block", func() {
+		chunks := []string{"hello ", "console"}
+		pump.recv = func(p []byte) (int, error) {
+			if len(chunks) == 0 {
+				return 0, wouldBlock
+			}
+			n := copy(p, chunks[0])
+			chunks = chunks[1:]
+			return n, nil
+		}
+
+		pump.handleEvent(libvirt.STREAM_EVENT_READABLE)
+		Expect(pump.incoming).To(Receive(Equal([]byte("hello "))))
+		Expect(pump.incoming).To(Receive(Equal([]byte("console"))))
+		Expect(pump.done).To(BeEmpty())
+	})
+
+	It("should stop reading while the peer lags behind", func() {
+		pump.recv = func(p []byte) (int, error) {
+			return copy(p, "x"), nil
+		}
+
+		pump.handleEvent(libvirt.STREAM_EVENT_READABLE)
+		Expect(pump.incoming).To(HaveLen(streamPumpBacklog))
+		Expect(updates).To(Equal([]libvirt.StreamEventType{libvirt.STREAM_EVENT_ERROR | libvirt.STREAM_EVENT_HANGUP}))
+	})
+
+	It("should pass received data to the peer and read again", func() {
+		pump.readable = false
+		pump.incoming <- []byte("hello console")
+
+		go pump.deliver()
+		Eventually(func() int { return len(pump.incoming) }).Should(BeZero())
+		pump.close()
+
+		Expect(peer.String()).To(Equal("hello console"))
+		Expect(updates).To(Equal([]libvirt.StreamEventType{streamReadEvents}))
+	})
+
+	It("should not write to the stream once closed", func() {
+		go pump.deliver()
+		pump.close()
+
+		_, err := pump.Write([]byte("hello"))
+		Expect(err).To(Equal(io.ErrClosedPipe))
+	})
+
+	It("should finish at the end of the stream", func() {
+		pump.recv = func(p []byte) (int, error) {
+			return 0, io.EOF
+		}
+
+		pump.handleEvent(libvirt.STREAM_EVENT_READABLE)
+		Expect(pump.done).To(Receive(BeNil()))
+	})
+
+	It("should finish on stream errors", func() {
+		pump.handleEvent(libvirt.STREAM_EVENT_ERROR)
+		Expect(pump.done).To(Receive(HaveOccurred()))
+	})
+
+	It("should queue writes until the stream is writable", func() {
+		var sent bytes.Buffer
+		blocked := true
+		pump.send = func(p []byte) (int, error) {
+			if blocked {
+				return 0, wouldBlock
+			}
+			return sent.Write(p)
+		}
+
+		n, err := pump.Write([]byte("hello"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(5))
+		Expect(sent.Len()).To(BeZero())
+		Expect(updates).To(Equal([]libvirt.StreamEventType{streamReadEvents | libvirt.STREAM_EVENT_WRITABLE}))
+
+		blocked = false
+		pump.handleEvent(libvirt.STREAM_EVENT_WRITABLE)
+		Expect(sent.String()).To(Equal("hello"))
+		Expect(updates).To(Equal([]libvirt.StreamEventType{streamReadEvents | libvirt.STREAM_EVENT_WRITABLE, streamReadEvents}))
+	})
+
+	It("should not update the events while the stream accepts all writes", func() {
+		pump.send = func(p []byte) (int, error) {
+			return len(p), nil
+		}
+
+		_, err := pump.Write([]byte("hello"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(updates).To(BeEmpty())
+	})
+})
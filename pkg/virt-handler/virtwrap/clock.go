@@ -0,0 +1,137 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package virtwrap
+
+import (
+	"fmt"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cache"
+)
+
+var clockOffsets = map[string]bool{
+	"utc":       true,
+	"localtime": true,
+	"timezone":  true,
+	"variable":  true,
+}
+
+var timerNames = map[string]bool{
+	"platform":    true,
+	"pit":         true,
+	"rtc":         true,
+	"hpet":        true,
+	"tsc":         true,
+	"kvmclock":    true,
+	"hypervclock": true,
+}
+
+var tickPolicies = map[string]bool{
+	"delay":   true,
+	"catchup": true,
+	"merge":   true,
+	"discard": true,
+}
+
+var rtcTracks = map[string]bool{
+	"boot":  true,
+	"guest": true,
+	"wall":  true,
+}
+
+var tscModes = map[string]bool{
+	"auto":     true,
+	"native":   true,
+	"emulate":  true,
+	"paravirt": true,
+	"smpsafe":  true,
+}
+
+// prepareClock validates the clock of the domain, libvirt only reports most
+// of these mistakes when the domain is started.
+func prepareClock(spec *api.DomainSpec) error {
+	clock := spec.Clock
+	if clock == nil {
+		return nil
+	}
+
+	if clock.Offset != "" && !clockOffsets[clock.Offset] {
+		return fmt.Errorf("unsupported clock offset %s", clock.Offset)
+	}
+	if (clock.Offset == "timezone") != (clock.Timezone != "") {
+		return fmt.Errorf("a timezone requires the timezone clock offset")
+	}
+	if clock.Offset != "variable" && (clock.Adjustment != nil || clock.Basis != "") {
+		return fmt.Errorf("adjustment and basis require the variable clock offset")
+	}
+	if clock.Basis != "" && clock.Basis != "utc" && clock.Basis != "localtime" {
+		return fmt.Errorf("unsupported clock basis %s", clock.Basis)
+	}
+
+	seen := map[string]bool{}
+	for _, timer := range clock.Timer {
+		if !timerNames[timer.Name] {
+			return fmt.Errorf("unsupported timer %s", timer.Name)
+		}
+		if seen[timer.Name] {
+			return fmt.Errorf("timer %s is configured more than once", timer.Name)
+		}
+		seen[timer.Name] = true
+
+		if timer.TickPolicy != "" && !tickPolicies[timer.TickPolicy] {
+			return fmt.Errorf("timer %s: unsupported tick policy %s", timer.Name, timer.TickPolicy)
+		}
+		if timer.Track != "" && (timer.Name != "rtc" || !rtcTracks[timer.Track]) {
+			return fmt.Errorf("timer %s: unsupported track %s", timer.Name, timer.Track)
+		}
+		if timer.Name != "tsc" && (timer.Frequency != nil || timer.Mode != "") {
+			return fmt.Errorf("timer %s: only the tsc timer has a frequency and a mode", timer.Name)
+		}
+		if timer.Mode != "" && !tscModes[timer.Mode] {
+			return fmt.Errorf("timer %s: unsupported mode %s", timer.Name, timer.Mode)
+		}
+	}
+	return nil
+}
+
+// GetRTCOffset returns the offset in seconds of the guest RTC to UTC, as the
+// guest set it last. libvirt keeps the adjustment of variable clock offsets
+// in the live XML up to date when the guest changes its RTC, the cached spec
+// is dropped on these changes. All other offsets have no adjustment.
+func (l *LibvirtDomainManager) GetRTCOffset(vm *v1.VirtualMachine) (int64, error) {
+	name := cache.VMNamespaceKeyFunc(vm)
+	dom, err := l.virConn.LookupDomainByName(name)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain failed.")
+		return 0, err
+	}
+	defer dom.Free()
+
+	spec, err := l.getDomainSpec(name, dom)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain spec failed.")
+		return 0, err
+	}
+	if spec.Clock == nil || spec.Clock.Offset != "variable" || spec.Clock.Adjustment == nil {
+		return 0, nil
+	}
+	return *spec.Clock.Adjustment, nil
+}
@@ -0,0 +1,110 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package virtwrap
+
+import (
+	"encoding/xml"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Clock", func() {
+	var ctrl *gomock.Controller
+	var mockConn *cli.MockConnection
+	var mockDomain *cli.MockVirDomain
+	var manager *LibvirtDomainManager
+
+	adjustment := int64(3600)
+	frequency := uint64(2400000000)
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockConn = cli.NewMockConnection(ctrl)
+		mockDomain = cli.NewMockVirDomain(ctrl)
+		manager = &LibvirtDomainManager{
+			virConn:     mockConn,
+			domainSpecs: newDomainSpecCache(),
+		}
+	})
+
+	It("should generate the clock of a Windows guest", func() {
+		spec := api.NewMinimalDomainSpec("testvm")
+		spec.Clock = &api.Clock{
+			Offset: "localtime",
+			Timer: []api.Timer{
+				{Name: "rtc", TickPolicy: "catchup", Track: "guest"},
+				{Name: "pit", TickPolicy: "delay"},
+				{Name: "hpet", Present: "no"},
+				{Name: "tsc", Frequency: &frequency, Mode: "native"},
+			},
+		}
+		Expect(prepareClock(spec)).To(Succeed())
+
+		buf, err := xml.Marshal(spec.Clock)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(buf)).To(Equal(`<Clock offset="localtime">` +
+			`<timer name="rtc" tickpolicy="catchup" track="guest"></timer>` +
+			`<timer name="pit" tickpolicy="delay"></timer>` +
+			`<timer name="hpet" present="no"></timer>` +
+			`<timer name="tsc" frequency="2400000000" mode="native"></timer>` +
+			`</Clock>`))
+	})
+
+	table.DescribeTable("should reject invalid clocks", func(clock *api.Clock) {
+		spec := api.NewMinimalDomainSpec("testvm")
+		spec.Clock = clock
+		Expect(prepareClock(spec)).ToNot(Succeed())
+	},
+		table.Entry("with an unknown offset", &api.Clock{Offset: "moon"}),
+		table.Entry("with a timezone but another offset", &api.Clock{Offset: "utc", Timezone: "Europe/Paris"}),
+		table.Entry("with an adjustment but no variable offset", &api.Clock{Offset: "utc", Adjustment: &adjustment}),
+		table.Entry("with an unknown basis", &api.Clock{Offset: "variable", Basis: "moon"}),
+		table.Entry("with an unknown timer", &api.Clock{Timer: []api.Timer{{Name: "moon"}}}),
+		table.Entry("with a timer twice", &api.Clock{Timer: []api.Timer{{Name: "rtc"}, {Name: "rtc"}}}),
+		table.Entry("with an unknown tick policy", &api.Clock{Timer: []api.Timer{{Name: "rtc", TickPolicy: "moon"}}}),
+		table.Entry("with a track on another timer than rtc", &api.Clock{Timer: []api.Timer{{Name: "pit", Track: "guest"}}}),
+		table.Entry("with a frequency on another timer than tsc", &api.Clock{Timer: []api.Timer{{Name: "kvmclock", Frequency: &frequency}}}),
+		table.Entry("with an unknown tsc mode", &api.Clock{Timer: []api.Timer{{Name: "tsc", Mode: "moon"}}}),
+	)
+
+	It("should return the adjustment of the live clock", func() {
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+		mockDomain.EXPECT().GetXMLDesc(libvirt.DomainXMLFlags(0)).Return(`<domain type="kvm"><name>default_testvm</name><clock offset="variable" adjustment="3600" basis="utc"></clock></domain>`, nil)
+		mockDomain.EXPECT().Free()
+		Expect(manager.GetRTCOffset(newVM("default", "testvm"))).To(Equal(int64(3600)))
+	})
+
+	It("should return no offset for clocks without an adjustment", func() {
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+		mockDomain.EXPECT().GetXMLDesc(libvirt.DomainXMLFlags(0)).Return(`<domain type="kvm"><name>default_testvm</name><clock offset="localtime"></clock></domain>`, nil)
+		mockDomain.EXPECT().Free()
+		Expect(manager.GetRTCOffset(newVM("default", "testvm"))).To(Equal(int64(0)))
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+})
@@ -0,0 +1,216 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+// Package cloudhypervisor is an experimental driver which runs guests with
+// cloud-hypervisor instead of libvirt and qemu. cloud-hypervisor is a lighter
+// VMM, but only supports simple guests: file disks, tap interfaces, a serial
+// console and a random number generator.
+// Every guest gets a VMM process of its own, which is driven through the
+// REST API on its unix socket.
+package cloudhypervisor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cache"
+)
+
+// URIScheme selects cloud-hypervisor instead of libvirt as driver of
+// virt-handler. The path of the URI is the directory in which the API
+// sockets of the VMMs are created, e.g. ch+unix:///var/run/kubevirt/ch.
+const URIScheme = "ch+unix"
+
+const apiPrefix = "http://localhost/api/v1/"
+
+const DefaultRequestTimeout = 30 * time.Second
+
+type Client struct {
+	http *http.Client
+}
+
+// NewClient creates a client which sends all requests to the API socket of
+// one cloud-hypervisor process. Every VMM process runs exactly one guest.
+func NewClient(socket string) *Client {
+	transport := &http.Transport{
+		Dial: func(_, _ string) (net.Conn, error) {
+			return net.Dial("unix", socket)
+		},
+	}
+	return &Client{http: &http.Client{Transport: transport, Timeout: DefaultRequestTimeout}}
+}
+
+// IsDriverURI tells whether the URI virt-handler connects to selects this
+// driver.
+func IsDriverURI(uri string) bool {
+	u, err := url.Parse(uri)
+	return err == nil && u.Scheme == URIScheme
+}
+
+// SocketDirFromURI returns the directory of the API sockets of a ch+unix URI.
+func SocketDirFromURI(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != URIScheme {
+		return "", fmt.Errorf("unsupported cloud-hypervisor URI scheme %s", u.Scheme)
+	}
+	if u.Path == "" {
+		return "", fmt.Errorf("cloud-hypervisor URI %s has no socket directory", uri)
+	}
+	return filepath.Clean(u.Path), nil
+}
+
+// apiSocket returns the API socket of the VMM of the VM, it is named after
+// the domain name, so that the VM can be found from the socket alone.
+func apiSocket(socketDir string, vm *v1.VirtualMachine) string {
+	return filepath.Join(socketDir, cache.VMNamespaceKeyFunc(vm)+".sock")
+}
+
+// Ping returns the version of the VMM.
+func (c *Client) Ping() (string, error) {
+	var pong VmmPingResponse
+	if err := c.do(http.MethodGet, "vmm.ping", nil, &pong); err != nil {
+		return "", err
+	}
+	return pong.Version, nil
+}
+
+// CreateVM creates the guest without booting it.
+func (c *Client) CreateVM(config *VmConfig) error {
+	return c.do(http.MethodPut, "vm.create", config, nil)
+}
+
+func (c *Client) BootVM() error {
+	return c.do(http.MethodPut, "vm.boot", nil, nil)
+}
+
+// ShutdownVM stops the guest right away, like pulling the plug.
+func (c *Client) ShutdownVM() error {
+	return c.do(http.MethodPut, "vm.shutdown", nil, nil)
+}
+
+// PowerButton asks the guest to shut down through ACPI.
+func (c *Client) PowerButton() error {
+	return c.do(http.MethodPut, "vm.power-button", nil, nil)
+}
+
+func (c *Client) PauseVM() error {
+	return c.do(http.MethodPut, "vm.pause", nil, nil)
+}
+
+func (c *Client) ResumeVM() error {
+	return c.do(http.MethodPut, "vm.resume", nil, nil)
+}
+
+// DeleteVM removes the guest from the VMM, it has to be shut down first.
+func (c *Client) DeleteVM() error {
+	return c.do(http.MethodPut, "vm.delete", nil, nil)
+}
+
+// ShutdownVMM terminates the VMM process, the guest has to be deleted first.
+func (c *Client) ShutdownVMM() error {
+	return c.do(http.MethodPut, "vmm.shutdown", nil, nil)
+}
+
+// VMInfo returns the configuration and the state of the guest.
+func (c *Client) VMInfo() (*VmInfo, error) {
+	info := &VmInfo{}
+	if err := c.do(http.MethodGet, "vm.info", nil, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// VMCounters returns the metrics of the guest devices, grouped by device,
+// e.g. the read and written bytes of each disk.
+func (c *Client) VMCounters() (map[string]map[string]uint64, error) {
+	counters := map[string]map[string]uint64{}
+	if err := c.do(http.MethodGet, "vm.counters", nil, &counters); err != nil {
+		return nil, err
+	}
+	return counters, nil
+}
+
+func (c *Client) do(method string, endpoint string, in interface{}, out interface{}) error {
+	var body *bytes.Buffer
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewBuffer(data)
+	} else {
+		body = &bytes.Buffer{}
+	}
+	request, err := http.NewRequest(method, apiPrefix+endpoint, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	response, err := c.http.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return &APIError{Endpoint: endpoint, StatusCode: response.StatusCode, Message: string(data)}
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// IsNotCreated tells whether the VMM rejected a request because it runs no
+// guest yet. The API has no status code of its own for that, it only tells in
+// the message.
+func IsNotCreated(err error) bool {
+	apiErr, ok := err.(*APIError)
+	return ok && strings.Contains(strings.ToLower(apiErr.Message), "not created")
+}
+
+// APIError is returned if the VMM rejected a request.
+type APIError struct {
+	Endpoint   string
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("cloud-hypervisor %s failed with %d: %s", e.Endpoint, e.StatusCode, e.Message)
+}
@@ -0,0 +1,153 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package cloudhypervisor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Client", func() {
+	var tmpDir string
+	var server *httptest.Server
+	var client *Client
+	var mux *http.ServeMux
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "cloudhypervisor")
+		Expect(err).ToNot(HaveOccurred())
+		socket := filepath.Join(tmpDir, "api.sock")
+		listener, err := net.Listen("unix", socket)
+		Expect(err).ToNot(HaveOccurred())
+
+		mux = http.NewServeMux()
+		server = httptest.NewUnstartedServer(mux)
+		server.Listener = listener
+		server.Start()
+		client = NewClient(socket)
+	})
+
+	It("should take the socket directory from the URI", func() {
+		Expect(IsDriverURI("ch+unix:///var/run/kubevirt/ch/")).To(BeTrue())
+		dir, err := SocketDirFromURI("ch+unix:///var/run/kubevirt/ch/")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(dir).To(Equal("/var/run/kubevirt/ch"))
+	})
+
+	It("should reject URIs of other drivers", func() {
+		Expect(IsDriverURI("qemu:///system")).To(BeFalse())
+		_, err := SocketDirFromURI("qemu:///system")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should reject URIs without a socket directory", func() {
+		_, err := SocketDirFromURI("ch+unix://")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should ping the VMM", func() {
+		mux.HandleFunc("/api/v1/vmm.ping", func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Method).To(Equal(http.MethodGet))
+			w.Write([]byte(`{"version": "v40.0"}`))
+		})
+		Expect(client.Ping()).To(Equal("v40.0"))
+	})
+
+	It("should create and boot the guest", func() {
+		var created VmConfig
+		mux.HandleFunc("/api/v1/vm.create", func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Method).To(Equal(http.MethodPut))
+			Expect(json.NewDecoder(r.Body).Decode(&created)).To(Succeed())
+			w.WriteHeader(http.StatusNoContent)
+		})
+		booted := false
+		mux.HandleFunc("/api/v1/vm.boot", func(w http.ResponseWriter, r *http.Request) {
+			booted = true
+			w.WriteHeader(http.StatusNoContent)
+		})
+
+		config := &VmConfig{
+			Cpus:    &CpusConfig{BootVcpus: 1, MaxVcpus: 1},
+			Memory:  &MemoryConfig{Size: 512 << 20},
+			Payload: PayloadConfig{Firmware: "/usr/share/cloud-hypervisor/hypervisor-fw"},
+			Disks:   []DiskConfig{{Path: "/var/run/kubevirt-private/disk.img"}},
+			Serial:  &ConsoleConfig{Mode: ConsoleModeSocket, Socket: "/var/run/kubevirt-private/serial.sock"},
+		}
+		Expect(client.CreateVM(config)).To(Succeed())
+		Expect(client.BootVM()).To(Succeed())
+		Expect(&created).To(Equal(config))
+		Expect(booted).To(BeTrue())
+	})
+
+	It("should return the state and the counters of the guest", func() {
+		mux.HandleFunc("/api/v1/vm.info", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"config": {"payload": {}}, "state": "Running"}`))
+		})
+		mux.HandleFunc("/api/v1/vm.counters", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"_disk0": {"read_bytes": 512, "write_bytes": 1024}}`))
+		})
+
+		info, err := client.VMInfo()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.State).To(Equal(VmStateRunning))
+		counters, err := client.VMCounters()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(counters["_disk0"]["write_bytes"]).To(Equal(uint64(1024)))
+	})
+
+	It("should return rejected requests as API errors", func() {
+		mux.HandleFunc("/api/v1/vm.pause", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("VM is not running"))
+		})
+
+		err := client.PauseVM()
+		Expect(err).To(HaveOccurred())
+		apiErr, ok := err.(*APIError)
+		Expect(ok).To(BeTrue())
+		Expect(apiErr.StatusCode).To(Equal(http.StatusInternalServerError))
+		Expect(apiErr.Message).To(Equal("VM is not running"))
+		Expect(IsNotCreated(err)).To(BeFalse())
+	})
+
+	It("should tell when the VMM runs no guest yet", func() {
+		mux.HandleFunc("/api/v1/vm.info", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Error from API: The VM info is not available: VM is not created"))
+		})
+
+		_, err := client.VMInfo()
+		Expect(IsNotCreated(err)).To(BeTrue())
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll(tmpDir)
+	})
+})
@@ -0,0 +1,144 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package cloudhypervisor
+
+import (
+	"fmt"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap"
+)
+
+// firmwarePath is booted by guests without a direct kernel boot or a loader
+// of their own. It boots the guest from its first disk.
+var firmwarePath = "/usr/share/cloud-hypervisor/hypervisor-fw"
+
+const defaultRngSource = "/dev/urandom"
+
+// serialPortSocket locates the serial console of the guest where the serial
+// port proxy of virt-handler looks for it.
+var serialPortSocket = virtwrap.SerialPortSocket
+
+// vmConfig translates the domain of the VM into the configuration of its
+// guest. VMs which need devices or features cloud-hypervisor does not have
+// are rejected, instead of silently running without them.
+func vmConfig(vm *v1.VirtualMachine) (*VmConfig, error) {
+	domain := vm.Spec.Domain
+	if domain == nil {
+		return nil, fmt.Errorf("the VM has no domain")
+	}
+	if err := checkUnsupported(domain); err != nil {
+		return nil, err
+	}
+
+	memory, err := virtwrap.ToKiB(domain.Memory.Value, domain.Memory.Unit)
+	if err != nil {
+		return nil, err
+	}
+	vcpus := 1
+	if domain.VCPU != nil && domain.VCPU.CPUs > 0 {
+		vcpus = int(domain.VCPU.CPUs)
+	}
+
+	config := &VmConfig{
+		Cpus:   &CpusConfig{BootVcpus: vcpus, MaxVcpus: vcpus},
+		Memory: &MemoryConfig{Size: int64(memory) * 1024},
+		// The serial console is proxied like the unix serial ports of
+		// libvirt domains, the virtio console is not used
+		Serial:   &ConsoleConfig{Mode: ConsoleModeSocket, Socket: serialPortSocket(vm, virtwrap.PortKindSerial, 0)},
+		Console:  &ConsoleConfig{Mode: ConsoleModeOff},
+		Platform: &PlatformConfig{UUID: string(vm.GetObjectMeta().GetUID())},
+	}
+	if domain.MemoryBacking != nil && domain.MemoryBacking.Access != nil {
+		config.Memory.Shared = domain.MemoryBacking.Access.Mode == "shared"
+	}
+
+	switch {
+	case domain.OS.KernelBoot != nil:
+		config.Payload = PayloadConfig{
+			Kernel:    domain.OS.KernelBoot.Kernel,
+			Initramfs: domain.OS.KernelBoot.Initrd,
+			Cmdline:   domain.OS.KernelBoot.KernelArgs,
+		}
+	case domain.OS.Loader != nil && domain.OS.Loader.Path != "":
+		config.Payload = PayloadConfig{Firmware: domain.OS.Loader.Path}
+	default:
+		config.Payload = PayloadConfig{Firmware: firmwarePath}
+	}
+
+	for _, disk := range domain.Devices.Disks {
+		config.Disks = append(config.Disks, DiskConfig{
+			Path:     disk.Source.File,
+			Readonly: disk.ReadOnly != nil || disk.Device == "cdrom",
+			ID:       disk.Target.Device,
+		})
+	}
+	for _, iface := range domain.Devices.Interfaces {
+		net := NetConfig{Tap: iface.Target.Device}
+		if iface.MAC != nil {
+			net.Mac = iface.MAC.MAC
+		}
+		if iface.Alias != nil {
+			net.ID = iface.Alias.Name
+		}
+		config.Net = append(config.Net, net)
+	}
+	if rng := domain.Devices.Rng; rng != nil {
+		config.Rng = &RngConfig{Src: defaultRngSource}
+		if rng.Backend.Source != "" {
+			config.Rng.Src = rng.Backend.Source
+		}
+	}
+	return config, nil
+}
+
+// checkUnsupported fails for the first device or feature of the domain which
+// cloud-hypervisor can't provide.
+func checkUnsupported(domain *v1.DomainSpec) error {
+	for _, disk := range domain.Devices.Disks {
+		if disk.Type != "file" {
+			return fmt.Errorf("disk %s is of type %s, only file disks are supported", disk.Target.Device, disk.Type)
+		}
+		if disk.Encryption != nil {
+			return fmt.Errorf("disk %s is encrypted, encrypted disks are not supported", disk.Target.Device)
+		}
+		if disk.Ephemeral {
+			return fmt.Errorf("disk %s is ephemeral, ephemeral disks are not supported", disk.Target.Device)
+		}
+	}
+	for _, iface := range domain.Devices.Interfaces {
+		if iface.Type != "ethernet" || iface.Target == nil || iface.Target.Device == "" {
+			return fmt.Errorf("interface of type %s is not supported, only ethernet interfaces with a tap device are", iface.Type)
+		}
+	}
+	switch {
+	case len(domain.Devices.Graphics) > 0:
+		return fmt.Errorf("graphics are not supported")
+	case len(domain.Devices.HostDevices) > 0:
+		return fmt.Errorf("host devices are not supported")
+	case domain.Devices.TPM != nil:
+		return fmt.Errorf("TPMs are not supported")
+	case domain.MemoryBacking != nil && domain.MemoryBacking.HugePages != nil:
+		return fmt.Errorf("hugepages are not supported")
+	case domain.SEV != nil:
+		return fmt.Errorf("SEV is not supported")
+	}
+	return nil
+}
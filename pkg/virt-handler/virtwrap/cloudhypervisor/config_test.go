@@ -0,0 +1,107 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package cloudhypervisor
+
+import (
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/types"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+)
+
+// newVM returns a VM with one disk and one tap interface, which the driver
+// can run.
+func newVM(namespace string, name string, uid string) *v1.VirtualMachine {
+	vm := v1.NewMinimalVMWithNS(namespace, name)
+	vm.ObjectMeta.UID = types.UID(uid)
+	vm.Spec.Domain.Memory = v1.Memory{Unit: "MiB", Value: 64}
+	vm.Spec.Domain.Devices.Disks = []v1.Disk{{
+		Type:   "file",
+		Device: "disk",
+		Source: v1.DiskSource{File: "/var/run/kubevirt-private/disk.img"},
+		Target: v1.DiskTarget{Device: "vda"},
+	}}
+	vm.Spec.Domain.Devices.Interfaces = []v1.Interface{{
+		Type:   "ethernet",
+		Target: &v1.InterfaceTarget{Device: "tap0"},
+		MAC:    &v1.MAC{MAC: "52:54:00:12:34:56"},
+	}}
+	return vm
+}
+
+var _ = Describe("Configuration", func() {
+
+	It("should translate the domain of the VM", func() {
+		vm := newVM("default", "testvm", "1234")
+		vm.Spec.Domain.VCPU = &v1.VCPU{CPUs: 2}
+		vm.Spec.Domain.Devices.Disks = append(vm.Spec.Domain.Devices.Disks, v1.Disk{
+			Type:   "file",
+			Device: "cdrom",
+			Source: v1.DiskSource{File: "/var/run/kubevirt-private/cloud-init.iso"},
+			Target: v1.DiskTarget{Device: "hda"},
+		})
+		vm.Spec.Domain.Devices.Rng = &v1.RandomGenerator{}
+
+		config, err := vmConfig(vm)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(config.Cpus).To(Equal(&CpusConfig{BootVcpus: 2, MaxVcpus: 2}))
+		Expect(config.Memory).To(Equal(&MemoryConfig{Size: 64 << 20}))
+		Expect(config.Payload).To(Equal(PayloadConfig{Firmware: firmwarePath}))
+		Expect(config.Disks).To(Equal([]DiskConfig{
+			{Path: "/var/run/kubevirt-private/disk.img", ID: "vda"},
+			{Path: "/var/run/kubevirt-private/cloud-init.iso", Readonly: true, ID: "hda"},
+		}))
+		Expect(config.Net).To(Equal([]NetConfig{{Tap: "tap0", Mac: "52:54:00:12:34:56"}}))
+		Expect(config.Rng).To(Equal(&RngConfig{Src: "/dev/urandom"}))
+		Expect(config.Serial.Mode).To(Equal(ConsoleModeSocket))
+		Expect(config.Serial.Socket).To(HaveSuffix("default_testvm/serial0.sock"))
+		Expect(config.Console.Mode).To(Equal(ConsoleModeOff))
+		Expect(config.Platform.UUID).To(Equal("1234"))
+	})
+
+	It("should boot the kernel of a direct kernel boot", func() {
+		vm := newVM("default", "testvm", "1234")
+		vm.Spec.Domain.OS.KernelBoot = &v1.KernelBoot{Kernel: "/boot/vmlinuz", Initrd: "/boot/initrd", KernelArgs: "console=ttyS0"}
+
+		config, err := vmConfig(vm)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(config.Payload).To(Equal(PayloadConfig{Kernel: "/boot/vmlinuz", Initramfs: "/boot/initrd", Cmdline: "console=ttyS0"}))
+	})
+
+	table.DescribeTable("should reject VMs with devices cloud-hypervisor does not have", func(change func(domain *v1.DomainSpec)) {
+		vm := newVM("default", "testvm", "1234")
+		change(vm.Spec.Domain)
+
+		_, err := vmConfig(vm)
+		Expect(err).To(HaveOccurred())
+	},
+		table.Entry("network disks", func(domain *v1.DomainSpec) { domain.Devices.Disks[0].Type = "network" }),
+		table.Entry("ephemeral disks", func(domain *v1.DomainSpec) { domain.Devices.Disks[0].Ephemeral = true }),
+		table.Entry("libvirt networks", func(domain *v1.DomainSpec) {
+			domain.Devices.Interfaces[0] = v1.Interface{Type: "network", Source: v1.InterfaceSource{Network: "default"}}
+		}),
+		table.Entry("graphics", func(domain *v1.DomainSpec) { domain.Devices.Graphics = []v1.Graphics{{Type: "vnc"}} }),
+		table.Entry("hugepages", func(domain *v1.DomainSpec) {
+			domain.MemoryBacking = &v1.MemoryBacking{HugePages: &v1.HugePages{}}
+		}),
+	)
+})
@@ -0,0 +1,228 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package cloudhypervisor
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	virtcache "kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cache"
+)
+
+var stateTranslationMap = map[string]api.LifeCycle{
+	VmStateCreated:  api.Shutoff,
+	VmStateRunning:  api.Running,
+	VmStateShutdown: api.Shutoff,
+	VmStatePaused:   api.Paused,
+}
+
+var reasonTranslationMap = map[string]api.StateChangeReason{
+	VmStateShutdown: api.ReasonShutdown,
+	VmStatePaused:   api.ReasonUser,
+}
+
+// listSockets returns the API sockets of all VMMs, keyed by domain name.
+func listSockets(socketDir string) (map[string]string, error) {
+	sockets, err := filepath.Glob(filepath.Join(socketDir, "*.sock"))
+	if err != nil {
+		return nil, err
+	}
+	byDomain := make(map[string]string, len(sockets))
+	for _, socket := range sockets {
+		byDomain[strings.TrimSuffix(filepath.Base(socket), ".sock")] = socket
+	}
+	return byDomain, nil
+}
+
+// guestState returns the state of the guest of the VMM on the socket.
+func guestState(socket string) (api.LifeCycle, api.StateChangeReason) {
+	return stateFromInfo(NewClient(socket).VMInfo())
+}
+
+// stateFromInfo translates the answer of the VMM to an info request into the
+// state of its guest. Guests whose VMM died are reported as failed, the VMM
+// only goes away on its own if it crashed.
+func stateFromInfo(info *VmInfo, err error) (api.LifeCycle, api.StateChangeReason) {
+	if IsNotCreated(err) {
+		return api.NoState, api.ReasonUnknown
+	} else if err != nil {
+		return api.Shutoff, api.ReasonFailed
+	}
+	state, ok := stateTranslationMap[info.State]
+	if !ok {
+		return api.NoState, api.ReasonUnknown
+	}
+	reason, ok := reasonTranslationMap[info.State]
+	if !ok {
+		reason = api.ReasonUnknown
+	}
+	return state, reason
+}
+
+// listDomains returns all guests with their spec and state.
+func listDomains(socketDir string) ([]api.Domain, error) {
+	sockets, err := listSockets(socketDir)
+	if err != nil {
+		return nil, err
+	}
+	domains := make([]api.Domain, 0, len(sockets))
+	for domName, socket := range sockets {
+		namespace, name := virtcache.SplitVMNamespaceKey(domName)
+		domain := api.NewDomainReferenceFromName(namespace, name)
+		info, err := NewClient(socket).VMInfo()
+		if err == nil {
+			domain.Spec = *domainSpec(domName, &info.Config)
+			domain.GetObjectMeta().SetUID(types.UID(domain.Spec.UUID))
+		}
+		domain.SetState(stateFromInfo(info, err))
+		domains = append(domains, *domain)
+	}
+	return domains, nil
+}
+
+func domainKey(domain *api.Domain) string {
+	return domain.ObjectMeta.Namespace + "/" + domain.ObjectMeta.Name
+}
+
+// domainChanged tells whether the consumers of the informer need to know
+// about the new state of a domain.
+func domainChanged(old *api.Domain, current *api.Domain) bool {
+	return old.ObjectMeta.UID != current.ObjectMeta.UID ||
+		old.Status.Status != current.Status.Status ||
+		old.Status.Reason != current.Status.Reason
+}
+
+// domainLister remembers the domains it last listed, so that the watchers
+// can tell what changed since.
+type domainLister struct {
+	socketDir string
+	lock      sync.Mutex
+	known     map[string]api.Domain
+}
+
+// list lists the domains and returns the events which lead from the last
+// listing to this one.
+func (l *domainLister) list() ([]api.Domain, []watch.Event, error) {
+	domains, err := listDomains(l.socketDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	events := []watch.Event{}
+	current := make(map[string]api.Domain, len(domains))
+	for i := range domains {
+		domain := &domains[i]
+		key := domainKey(domain)
+		current[key] = *domain
+		if old, exists := l.known[key]; !exists {
+			events = append(events, watch.Event{Type: watch.Added, Object: domain})
+		} else if domainChanged(&old, domain) {
+			events = append(events, watch.Event{Type: watch.Modified, Object: domain})
+		}
+	}
+	for key, old := range l.known {
+		if _, exists := current[key]; !exists {
+			gone := old
+			events = append(events, watch.Event{Type: watch.Deleted, Object: &gone})
+		}
+	}
+	l.known = current
+	return domains, events, nil
+}
+
+// domainWatcher polls the VMMs and hands the changes of their guests over to
+// the consumer of C.
+type domainWatcher struct {
+	lister *domainLister
+	C      chan watch.Event
+	stop   chan struct{}
+	once   sync.Once
+}
+
+func (d *domainWatcher) Stop() {
+	d.once.Do(func() { close(d.stop) })
+}
+
+func (d *domainWatcher) ResultChan() <-chan watch.Event {
+	return d.C
+}
+
+func (d *domainWatcher) run() {
+	defer close(d.C)
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+		}
+		_, events, err := d.lister.list()
+		if err != nil {
+			logging.DefaultLogger().Error().Reason(err).Msg("Listing the domains failed.")
+			events = []watch.Event{{Type: watch.Error, Object: &metav1.Status{Status: metav1.StatusFailure, Message: err.Error()}}}
+		}
+		for _, event := range events {
+			select {
+			case d.C <- event:
+			case <-d.stop:
+				return
+			}
+		}
+	}
+}
+
+func newListWatch(socketDir string) *cache.ListWatch {
+	lister := &domainLister{socketDir: socketDir}
+	listFunc := func(options metav1.ListOptions) (runtime.Object, error) {
+		logging.DefaultLogger().Info().V(3).Msg("Synchronizing domains")
+		domains, _, err := lister.list()
+		if err != nil {
+			return nil, err
+		}
+		return &api.DomainList{Items: domains}, nil
+	}
+	watchFunc := func(options metav1.ListOptions) (watch.Interface, error) {
+		watcher := &domainWatcher{lister: lister, C: make(chan watch.Event), stop: make(chan struct{})}
+		go watcher.run()
+		return watcher, nil
+	}
+	return &cache.ListWatch{ListFunc: listFunc, WatchFunc: watchFunc}
+}
+
+// NewSharedInformer creates an informer for the guests of the VMMs. Since
+// the VMMs can't report changes, the informer polls them.
+func NewSharedInformer(socketDir string) (cache.SharedInformer, error) {
+	lw := newListWatch(socketDir)
+	informer := cache.NewSharedInformer(lw, &api.Domain{}, 0)
+	return informer, nil
+}
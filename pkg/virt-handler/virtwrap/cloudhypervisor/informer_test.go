@@ -0,0 +1,104 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package cloudhypervisor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+)
+
+var _ = Describe("Informer", func() {
+	var tmpDir string
+	var lister *domainLister
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "cloudhypervisor")
+		Expect(err).ToNot(HaveOccurred())
+		lister = &domainLister{socketDir: tmpDir}
+	})
+
+	It("should report the changes of the guests since the last listing", func() {
+		vm := newVM("default", "testvm", "1234")
+		vmm := newFakeVMM(apiSocket(tmpDir, vm))
+		defer vmm.close()
+		vmm.runGuest(vm, VmStateRunning)
+
+		domains, events, err := lister.list()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(domains).To(HaveLen(1))
+		Expect(domains[0].ObjectMeta.Name).To(Equal("testvm"))
+		Expect(domains[0].ObjectMeta.UID).To(Equal(types.UID("1234")))
+		Expect(domains[0].Status.Status).To(Equal(api.Running))
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].Type).To(Equal(watch.Added))
+
+		_, events, err = lister.list()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(events).To(BeEmpty())
+
+		vmm.setState(VmStateShutdown)
+		_, events, err = lister.list()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].Type).To(Equal(watch.Modified))
+		Expect(events[0].Object.(*api.Domain).Status.Status).To(Equal(api.Shutoff))
+		Expect(events[0].Object.(*api.Domain).Status.Reason).To(Equal(api.ReasonShutdown))
+
+		vmm.close()
+		_, events, err = lister.list()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].Type).To(Equal(watch.Deleted))
+		Expect(events[0].Object.(*api.Domain).ObjectMeta.Name).To(Equal("testvm"))
+	})
+
+	It("should report guests whose VMM died as failed", func() {
+		Expect(ioutil.WriteFile(filepath.Join(tmpDir, "default_testvm.sock"), nil, 0644)).To(Succeed())
+
+		domains, _, err := lister.list()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(domains).To(HaveLen(1))
+		Expect(domains[0].Status.Status).To(Equal(api.Shutoff))
+		Expect(domains[0].Status.Reason).To(Equal(api.ReasonFailed))
+	})
+
+	It("should report VMMs without a guest as domains without a state", func() {
+		vmm := newFakeVMM(filepath.Join(tmpDir, "default_testvm.sock"))
+		defer vmm.close()
+
+		domains, _, err := lister.list()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(domains).To(HaveLen(1))
+		Expect(domains[0].Status.Status).To(Equal(api.NoState))
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+})
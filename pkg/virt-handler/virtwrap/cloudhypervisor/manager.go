@@ -0,0 +1,494 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package cloudhypervisor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	kubev1 "k8s.io/api/core/v1"
+	kubecache "k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cache"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/isolation"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/jobs"
+)
+
+// vmmCommand starts a VMM in the cgroups and the PID namespace of the
+// virt-launcher Pod of the VM, like qemu-kube does for qemu. It gets the
+// detected isolation through the same environment variables.
+var vmmCommand = "/cloud-hypervisor-kube"
+
+// How long a started VMM may take to answer on its API socket
+var vmmStartTimeout = 10 * time.Second
+
+// Interval in which the VMMs are asked for the state of their guests, they
+// have no way to report changes on their own
+var pollInterval = time.Second
+
+// DomainManager runs the guests of the VMs with cloud-hypervisor. Everything
+// the VMM has no API for, like jobs, migrations, guest agents and cgroup
+// tuning beyond the limits of the virt-launcher Pod, is reported as not
+// supported.
+type DomainManager struct {
+	socketDir            string
+	recorder             record.EventRecorder
+	podIsolationDetector isolation.PodIsolationDetector
+}
+
+func NewDomainManager(socketDir string, recorder record.EventRecorder, isolationDetector isolation.PodIsolationDetector) (virtwrap.DomainManager, error) {
+	if err := os.MkdirAll(socketDir, 0755); err != nil {
+		return nil, err
+	}
+	return &DomainManager{
+		socketDir:            socketDir,
+		recorder:             recorder,
+		podIsolationDetector: isolationDetector,
+	}, nil
+}
+
+func unsupported(what string) error {
+	return fmt.Errorf("%s is not supported by the cloud-hypervisor driver", what)
+}
+
+// vmmRunning tells whether a VMM listens on the socket. Sockets of VMMs which
+// died are left behind, so their existence alone tells nothing.
+func vmmRunning(socket string) bool {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// startVMM starts the VMM of the VM and waits until it answers on its API
+// socket. The VMM is not owned by virt-handler, it keeps running when
+// virt-handler restarts and exits with its virt-launcher Pod.
+func (m *DomainManager) startVMM(vm *v1.VirtualMachine, socket string) error {
+	res, err := m.podIsolationDetector.Detect(vm)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).V(3).Msgf("Could not detect virt-launcher cgroups.")
+		return err
+	}
+	if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	cmd := exec.Command(vmmCommand, "--api-socket", socket)
+	cmd.Env = append(os.Environ(),
+		"SLICE="+res.Slice(),
+		"CONTROLLERS="+strings.Join(res.Controller(), ","),
+		"PIDNS="+res.PidNS(),
+	)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+
+	client := NewClient(socket)
+	deadline := time.Now().Add(vmmStartTimeout)
+	for {
+		_, err := client.Ping()
+		if err == nil {
+			logging.DefaultLogger().Object(vm).Info().Msg("VMM started.")
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("the VMM did not answer within %v: %v", vmmStartTimeout, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func (m *DomainManager) SyncVM(vm *v1.VirtualMachine) (*api.DomainSpec, error) {
+	config, err := vmConfig(vm)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("The VM can't be run by cloud-hypervisor.")
+		return nil, err
+	}
+
+	socket := apiSocket(m.socketDir, vm)
+	if !vmmRunning(socket) {
+		if err := m.startVMM(vm, socket); err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Starting the VMM failed.")
+			return nil, err
+		}
+	}
+	client := NewClient(socket)
+
+	info, err := client.VMInfo()
+	if IsNotCreated(err) {
+		if err := os.MkdirAll(filepath.Dir(config.Serial.Socket), 0755); err != nil {
+			return nil, err
+		}
+		if err := client.CreateVM(config); err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Creating the guest failed.")
+			return nil, err
+		}
+		logging.DefaultLogger().Object(vm).Info().Msg("Domain defined.")
+		m.recorder.Event(vm, kubev1.EventTypeNormal, v1.Created.String(), "VM defined.")
+		info, err = client.VMInfo()
+	}
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the guest failed.")
+		return nil, err
+	}
+	if info.Config.Platform == nil || info.Config.Platform.UUID != string(vm.GetObjectMeta().GetUID()) {
+		return nil, fmt.Errorf("the VMM runs the guest of another VM with the same name")
+	}
+
+	switch info.State {
+	case VmStateCreated, VmStateShutdown:
+		if err := client.BootVM(); err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Starting the VM failed.")
+			return nil, err
+		}
+		logging.DefaultLogger().Object(vm).Info().Msg("Domain started.")
+		m.recorder.Event(vm, kubev1.EventTypeNormal, v1.Started.String(), "VM started.")
+	case VmStatePaused:
+		if err := client.ResumeVM(); err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Resuming the VM failed.")
+			return nil, err
+		}
+		logging.DefaultLogger().Object(vm).Info().Msg("Domain resumed.")
+		m.recorder.Event(vm, kubev1.EventTypeNormal, v1.Resumed.String(), "VM resumed")
+	}
+	return domainSpec(cache.VMNamespaceKeyFunc(vm), &info.Config), nil
+}
+
+// domainSpec describes the guest as far as the VMM knows about it.
+func domainSpec(domName string, config *VmConfig) *api.DomainSpec {
+	spec := &api.DomainSpec{Type: "cloud-hypervisor", Name: domName}
+	if config.Platform != nil {
+		spec.UUID = config.Platform.UUID
+	}
+	if config.Memory != nil {
+		spec.Memory = api.Memory{Value: uint(config.Memory.Size / 1024), Unit: "KiB"}
+	}
+	if config.Cpus != nil {
+		spec.VCPU = &api.VCPU{CPUs: uint(config.Cpus.BootVcpus)}
+	}
+	return spec
+}
+
+// KillVM stops and deletes the guest and terminates its VMM.
+func (m *DomainManager) KillVM(vm *v1.VirtualMachine) error {
+	socket := apiSocket(m.socketDir, vm)
+	if vmmRunning(socket) {
+		client := NewClient(socket)
+		info, err := client.VMInfo()
+		if err == nil {
+			if info.State == VmStateRunning || info.State == VmStatePaused {
+				if err := client.ShutdownVM(); err != nil {
+					logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Stopping the guest failed.")
+					return err
+				}
+				logging.DefaultLogger().Object(vm).Info().Msg("Domain stopped.")
+				m.recorder.Event(vm, kubev1.EventTypeNormal, v1.Stopped.String(), "VM stopped")
+			}
+			if err := client.DeleteVM(); err != nil {
+				logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Deleting the guest failed.")
+				return err
+			}
+			logging.DefaultLogger().Object(vm).Info().Msg("Domain undefined.")
+			m.recorder.Event(vm, kubev1.EventTypeNormal, v1.Deleted.String(), "VM undefined")
+		} else if !IsNotCreated(err) {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the guest failed.")
+			return err
+		}
+		if err := client.ShutdownVMM(); err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Terminating the VMM failed.")
+			return err
+		}
+	}
+	if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.RemoveAll(filepath.Dir(serialPortSocket(vm, virtwrap.PortKindSerial, 0)))
+}
+
+// RemoveVMData does nothing, no data of the guest outlives its VMM.
+func (m *DomainManager) RemoveVMData(vm *v1.VirtualMachine) error {
+	return nil
+}
+
+// ReconcileExistingGuests terminates the VMMs whose VM is gone, or was
+// replaced by a new VM with the same name. VMMs which can't be reconciled are
+// logged and skipped. The VM store has to be synced before this is called.
+func (m *DomainManager) ReconcileExistingGuests(vmStore kubecache.Store) error {
+	domains, err := listDomains(m.socketDir)
+	if err != nil {
+		logging.DefaultLogger().Error().Reason(err).Msg("Listing the domains failed.")
+		return err
+	}
+	for _, domain := range domains {
+		obj, exists, err := vmStore.GetByKey(domain.ObjectMeta.Namespace + "/" + domain.ObjectMeta.Name)
+		if err != nil {
+			return err
+		}
+		if exists && obj.(*v1.VirtualMachine).GetObjectMeta().GetUID() == domain.ObjectMeta.UID {
+			continue
+		}
+		vm := v1.NewVMReferenceFromNameWithNS(domain.ObjectMeta.Namespace, domain.ObjectMeta.Name)
+		logging.DefaultLogger().Object(vm).Info().Msg("Removing orphaned domain.")
+		if virtwrap.IsReadOnly() {
+			continue
+		}
+		if err := m.KillVM(vm); err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Removing the orphaned domain failed, skipping it.")
+		}
+	}
+	return nil
+}
+
+// WaitForState waits until the guest reaches one of the states, and returns
+// the state it reached.
+func (m *DomainManager) WaitForState(ctx context.Context, vm *v1.VirtualMachine, states ...api.LifeCycle) (api.LifeCycle, error) {
+	socket := apiSocket(m.socketDir, vm)
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		state, _ := guestState(socket)
+		for _, wanted := range states {
+			if state == wanted {
+				return state, nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return state, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// HealthCheck checks whether the VMM runs the guest. There is no guest agent
+// to ping.
+func (m *DomainManager) HealthCheck(vm *v1.VirtualMachine, pingAgent bool) (*virtwrap.HealthResult, error) {
+	socket := apiSocket(m.socketDir, vm)
+	if !vmmRunning(socket) {
+		return &virtwrap.HealthResult{Reason: virtwrap.HealthReasonProcessGone, Message: "the VMM does not run"}, nil
+	}
+	state, _ := guestState(socket)
+	if state != api.Running {
+		return &virtwrap.HealthResult{Reason: virtwrap.HealthReasonNotRunning, Message: fmt.Sprintf("the domain is %s", state), State: state}, nil
+	}
+	return &virtwrap.HealthResult{Healthy: true, Reason: virtwrap.HealthReasonHealthy, State: state}, nil
+}
+
+// DrainGuests shuts all guests of the node down, one after the other. Guests
+// can't be migrated, they get the grace period to shut down and are stopped
+// afterwards.
+func (m *DomainManager) DrainGuests(policy virtwrap.DrainPolicy) error {
+	domains, err := listDomains(m.socketDir)
+	if err != nil {
+		logging.DefaultLogger().Error().Reason(err).Msg("Listing the domains failed.")
+		return err
+	}
+	progress := func(guest string, step virtwrap.DrainStep, done int, err error) {
+		if policy.Progress != nil {
+			policy.Progress(virtwrap.DrainProgress{Guest: guest, Step: step, Done: done, Total: len(domains), Error: err})
+		}
+	}
+
+	errs := []error{}
+	for i, domain := range domains {
+		vm := v1.NewVMReferenceFromNameWithNS(domain.ObjectMeta.Namespace, domain.ObjectMeta.Name)
+		domName := cache.VMNamespaceKeyFunc(vm)
+		if domain.Status.Status != api.Running && domain.Status.Status != api.Paused {
+			progress(domName, virtwrap.DrainSkipped, i+1, nil)
+			continue
+		}
+		if err := m.shutdownGuest(vm, policy.GracePeriod, func(step virtwrap.DrainStep) { progress(domName, step, i, nil) }); err != nil {
+			progress(domName, virtwrap.DrainFailed, i+1, err)
+			errs = append(errs, fmt.Errorf("%s: %v", domName, err))
+			continue
+		}
+		progress(domName, virtwrap.DrainShutDown, i+1, nil)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("draining %d guests failed: %v", len(errs), errs)
+	}
+	return nil
+}
+
+// shutdownGuest asks the guest to shut down and stops it if it does not
+// within the grace period.
+func (m *DomainManager) shutdownGuest(vm *v1.VirtualMachine, gracePeriod time.Duration, step func(virtwrap.DrainStep)) error {
+	client := NewClient(apiSocket(m.socketDir, vm))
+	if gracePeriod > 0 {
+		step(virtwrap.DrainShuttingDown)
+		if err := client.PowerButton(); err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), gracePeriod)
+		defer cancel()
+		if _, err := m.WaitForState(ctx, vm, api.Shutoff); err == nil {
+			return nil
+		}
+	}
+	if err := client.ShutdownVM(); err != nil {
+		return err
+	}
+	step(virtwrap.DrainDestroyed)
+	return nil
+}
+
+func (m *DomainManager) IsAdopted(vm *v1.VirtualMachine) bool {
+	return false
+}
+
+func (m *DomainManager) SyncVMSecret(vm *v1.VirtualMachine, usageType string, usageID string, secretValue string) error {
+	return unsupported("disk authentication")
+}
+
+// RemoveVMSecrets does nothing, secrets are never handed to the VMM.
+func (m *DomainManager) RemoveVMSecrets(vm *v1.VirtualMachine) error {
+	return nil
+}
+
+func (m *DomainManager) GetJobInfo(vm *v1.VirtualMachine) (*api.DomainJobInfo, error) {
+	return nil, unsupported("migration")
+}
+
+func (m *DomainManager) AbortJob(vm *v1.VirtualMachine) error {
+	return unsupported("migration")
+}
+
+func (m *DomainManager) TuneMigration(vm *v1.VirtualMachine, options *v1.MigrationOptions) error {
+	return unsupported("migration")
+}
+
+func (m *DomainManager) GetDomainDevices(vm *v1.VirtualMachine) (*api.DomainDevices, error) {
+	return nil, unsupported("listing the devices")
+}
+
+// GuestNetworkStatus returns nothing, the addresses of the guest are only
+// known to a guest agent.
+func (m *DomainManager) GuestNetworkStatus(vm *v1.VirtualMachine) ([]v1.VMNetworkInterface, error) {
+	return nil, nil
+}
+
+func (m *DomainManager) GuestFilesystemInfo(vm *v1.VirtualMachine) ([]v1.VMFilesystem, error) {
+	return nil, unsupported("the guest agent")
+}
+
+func (m *DomainManager) AgentConnected(vm *v1.VirtualMachine) (bool, error) {
+	return false, nil
+}
+
+func (m *DomainManager) FSTrim(vm *v1.VirtualMachine, trigger virtwrap.Trigger) error {
+	return unsupported("the guest agent")
+}
+
+func (m *DomainManager) DumpCrashedGuest(vm *v1.VirtualMachine) (string, error) {
+	return "", unsupported("dumping guests")
+}
+
+func (m *DomainManager) MemoryDump(vm *v1.VirtualMachine, path string, format string, trigger virtwrap.Trigger) (string, error) {
+	return "", unsupported("dumping guests")
+}
+
+func (m *DomainManager) RestartCrashedGuest(vm *v1.VirtualMachine) (uint, error) {
+	return 0, unsupported("restarting crashed guests")
+}
+
+func (m *DomainManager) SendKey(vm *v1.VirtualMachine, combination string, trigger virtwrap.Trigger) error {
+	return unsupported("sending keys")
+}
+
+func (m *DomainManager) QemuMonitorCommand(vm *v1.VirtualMachine, command string, arguments map[string]interface{}) (json.RawMessage, error) {
+	return nil, unsupported("the qemu monitor")
+}
+
+func (m *DomainManager) MeasureDirtyRate(vm *v1.VirtualMachine, seconds int64) (uint64, error) {
+	return 0, unsupported("measuring the dirty rate")
+}
+
+func (m *DomainManager) GetLaunchMeasurement(vm *v1.VirtualMachine) (string, error) {
+	return "", unsupported("SEV")
+}
+
+// GetDeviceAllocations returns nothing, the VMM picks the addresses of the
+// devices on every boot.
+func (m *DomainManager) GetDeviceAllocations(vm *v1.VirtualMachine) ([]api.DeviceAllocation, error) {
+	return nil, nil
+}
+
+func (m *DomainManager) WaitsForLaunchSecret(vm *v1.VirtualMachine) (bool, error) {
+	return false, nil
+}
+
+func (m *DomainManager) InjectLaunchSecret(vm *v1.VirtualMachine, header string, secret string, trigger virtwrap.Trigger) error {
+	return unsupported("SEV")
+}
+
+func (m *DomainManager) GetRTCOffset(vm *v1.VirtualMachine) (int64, error) {
+	return 0, unsupported("reading the RTC offset")
+}
+
+func (m *DomainManager) GetCPUStats(vm *v1.VirtualMachine) (*cli.CPUStats, error) {
+	return nil, unsupported("reading the CPU statistics")
+}
+
+func (m *DomainManager) GetSchedulerTuning(vm *v1.VirtualMachine) (*cli.SchedulerTuning, error) {
+	return nil, unsupported("scheduler tuning")
+}
+
+func (m *DomainManager) TuneScheduler(vm *v1.VirtualMachine, tuning *cli.SchedulerTuning, trigger virtwrap.Trigger) error {
+	return unsupported("scheduler tuning")
+}
+
+// TuneMemory does nothing, the VMM runs in the cgroups of the virt-launcher
+// Pod, whose memory limits apply to it already.
+func (m *DomainManager) TuneMemory(vm *v1.VirtualMachine, tuning *cli.MemoryTuning, trigger virtwrap.Trigger) error {
+	return nil
+}
+
+func (m *DomainManager) TuneBlkio(vm *v1.VirtualMachine, tuning *cli.BlkioTuning, trigger virtwrap.Trigger) error {
+	return unsupported("blkio tuning")
+}
+
+// GetAuditTrail returns nothing, operations on the VMM are not recorded.
+func (m *DomainManager) GetAuditTrail(vm *v1.VirtualMachine) []virtwrap.AuditEntry {
+	return []virtwrap.AuditEntry{}
+}
+
+func (m *DomainManager) ListJobs(vm *v1.VirtualMachine) []jobs.Job {
+	return []jobs.Job{}
+}
+
+func (m *DomainManager) CancelJob(vm *v1.VirtualMachine, id string, trigger virtwrap.Trigger) error {
+	return fmt.Errorf("job %s does not exist", id)
+}
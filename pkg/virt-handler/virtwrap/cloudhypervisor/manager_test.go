@@ -0,0 +1,348 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package cloudhypervisor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	kubecache "k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/isolation"
+)
+
+// fakeVMM answers on an API socket like a VMM, and records which endpoints
+// were called.
+type fakeVMM struct {
+	server *httptest.Server
+	lock   sync.Mutex
+	info   *VmInfo
+	calls  []string
+	// ignorePowerButton lets the guest ignore requests to shut down
+	ignorePowerButton bool
+}
+
+func newFakeVMM(socket string) *fakeVMM {
+	listener, err := net.Listen("unix", socket)
+	Expect(err).ToNot(HaveOccurred())
+
+	vmm := &fakeVMM{}
+	transitions := map[string]string{
+		"vm.boot":     VmStateRunning,
+		"vm.shutdown": VmStateShutdown,
+		"vm.pause":    VmStatePaused,
+		"vm.resume":   VmStateRunning,
+	}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		defer GinkgoRecover()
+		vmm.lock.Lock()
+		defer vmm.lock.Unlock()
+		endpoint := filepath.Base(r.URL.Path)
+		vmm.calls = append(vmm.calls, endpoint)
+
+		switch endpoint {
+		case "vmm.ping":
+			w.Write([]byte(`{"version": "v40.0"}`))
+			return
+		case "vmm.shutdown":
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case "vm.create":
+			vmm.info = &VmInfo{State: VmStateCreated}
+			Expect(json.NewDecoder(r.Body).Decode(&vmm.info.Config)).To(Succeed())
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if vmm.info == nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("VM is not created"))
+			return
+		}
+		switch endpoint {
+		case "vm.info":
+			Expect(json.NewEncoder(w).Encode(vmm.info)).To(Succeed())
+		case "vm.delete":
+			vmm.info = nil
+			w.WriteHeader(http.StatusNoContent)
+		case "vm.power-button":
+			if !vmm.ignorePowerButton {
+				vmm.info.State = VmStateShutdown
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			vmm.info.State = transitions[endpoint]
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+
+	vmm.server = httptest.NewUnstartedServer(http.HandlerFunc(handler))
+	vmm.server.Listener = listener
+	vmm.server.Start()
+	return vmm
+}
+
+// runGuest lets the VMM run a guest of the VM in the state.
+func (v *fakeVMM) runGuest(vm *v1.VirtualMachine, state string) {
+	config, err := vmConfig(vm)
+	Expect(err).ToNot(HaveOccurred())
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.info = &VmInfo{Config: *config, State: state}
+}
+
+func (v *fakeVMM) setState(state string) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.info.State = state
+}
+
+func (v *fakeVMM) ignoresPowerButton() {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.ignorePowerButton = true
+}
+
+func (v *fakeVMM) called() []string {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return append([]string{}, v.calls...)
+}
+
+func (v *fakeVMM) close() {
+	v.server.Close()
+}
+
+var _ = Describe("Manager", func() {
+	var tmpDir string
+	var originalSerialPortSocket func(vm *v1.VirtualMachine, kind string, port uint) string
+	var originalVmmCommand string
+	var originalVmmStartTimeout time.Duration
+	var originalPollInterval time.Duration
+	var ctrl *gomock.Controller
+	var mockDetector *isolation.MockPodIsolationDetector
+	var recorder *record.FakeRecorder
+	var manager virtwrap.DomainManager
+	var vm *v1.VirtualMachine
+	var vmms []*fakeVMM
+
+	startVMM := func(vm *v1.VirtualMachine) *fakeVMM {
+		vmm := newFakeVMM(apiSocket(tmpDir, vm))
+		vmms = append(vmms, vmm)
+		return vmm
+	}
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "cloudhypervisor")
+		Expect(err).ToNot(HaveOccurred())
+		originalSerialPortSocket = serialPortSocket
+		serialPortSocket = func(vm *v1.VirtualMachine, kind string, port uint) string {
+			return filepath.Join(tmpDir, "serial", vm.GetObjectMeta().GetName(), "serial0.sock")
+		}
+		originalVmmCommand = vmmCommand
+		originalVmmStartTimeout = vmmStartTimeout
+		originalPollInterval = pollInterval
+		pollInterval = 10 * time.Millisecond
+
+		ctrl = gomock.NewController(GinkgoT())
+		mockDetector = isolation.NewMockPodIsolationDetector(ctrl)
+		recorder = record.NewFakeRecorder(10)
+		manager, err = NewDomainManager(tmpDir, recorder, mockDetector)
+		Expect(err).ToNot(HaveOccurred())
+		vm = newVM("default", "testvm", "1234")
+		vmms = nil
+	})
+
+	Context("on syncing a VM", func() {
+		It("should create and boot the guest", func() {
+			vmm := startVMM(vm)
+
+			spec, err := manager.SyncVM(vm)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(spec.Name).To(Equal("default_testvm"))
+			Expect(spec.UUID).To(Equal("1234"))
+			Expect(spec.Memory).To(Equal(api.Memory{Value: 65536, Unit: "KiB"}))
+			Expect(vmm.called()).To(Equal([]string{"vm.info", "vm.create", "vm.info", "vm.boot"}))
+			Expect(filepath.Join(tmpDir, "serial", "testvm")).To(BeADirectory())
+			Expect(<-recorder.Events).To(ContainSubstring(v1.Created.String()))
+			Expect(<-recorder.Events).To(ContainSubstring(v1.Started.String()))
+			Expect(recorder.Events).To(BeEmpty())
+		})
+
+		It("should leave running guests alone", func() {
+			vmm := startVMM(vm)
+			vmm.runGuest(vm, VmStateRunning)
+
+			_, err := manager.SyncVM(vm)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(vmm.called()).To(Equal([]string{"vm.info"}))
+			Expect(recorder.Events).To(BeEmpty())
+		})
+
+		It("should resume paused guests", func() {
+			vmm := startVMM(vm)
+			vmm.runGuest(vm, VmStatePaused)
+
+			_, err := manager.SyncVM(vm)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(vmm.called()).To(Equal([]string{"vm.info", "vm.resume"}))
+			Expect(<-recorder.Events).To(ContainSubstring(v1.Resumed.String()))
+		})
+
+		It("should not take over the guest of another VM with the same name", func() {
+			vmm := startVMM(vm)
+			vmm.runGuest(newVM("default", "testvm", "5678"), VmStateShutdown)
+
+			_, err := manager.SyncVM(vm)
+			Expect(err).To(HaveOccurred())
+			Expect(vmm.called()).To(Equal([]string{"vm.info"}))
+		})
+
+		It("should reject VMs cloud-hypervisor can't run before starting a VMM", func() {
+			vm.Spec.Domain.Devices.Graphics = []v1.Graphics{{Type: "vnc"}}
+
+			_, err := manager.SyncVM(vm)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should fail if the started VMM does not answer", func() {
+			vmmCommand = "true"
+			vmmStartTimeout = 100 * time.Millisecond
+			mockDetector.EXPECT().Detect(vm).Return(isolation.NewIsolationResult(1234, "dfd", []string{"a", "b"}), nil)
+
+			_, err := manager.SyncVM(vm)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("on killing a VM", func() {
+		It("should stop and delete the guest and terminate the VMM", func() {
+			vmm := startVMM(vm)
+			vmm.runGuest(vm, VmStateRunning)
+			Expect(os.MkdirAll(filepath.Join(tmpDir, "serial", "testvm"), 0755)).To(Succeed())
+
+			Expect(manager.KillVM(vm)).To(Succeed())
+			Expect(vmm.called()).To(Equal([]string{"vm.info", "vm.shutdown", "vm.delete", "vmm.shutdown"}))
+			Expect(apiSocket(tmpDir, vm)).ToNot(BeAnExistingFile())
+			Expect(filepath.Join(tmpDir, "serial", "testvm")).ToNot(BeAnExistingFile())
+			Expect(<-recorder.Events).To(ContainSubstring(v1.Stopped.String()))
+			Expect(<-recorder.Events).To(ContainSubstring(v1.Deleted.String()))
+		})
+
+		It("should terminate VMMs without a guest", func() {
+			vmm := startVMM(vm)
+
+			Expect(manager.KillVM(vm)).To(Succeed())
+			Expect(vmm.called()).To(Equal([]string{"vm.info", "vmm.shutdown"}))
+			Expect(recorder.Events).To(BeEmpty())
+		})
+
+		It("should succeed if the VMM is gone", func() {
+			Expect(manager.KillVM(vm)).To(Succeed())
+		})
+	})
+
+	It("should terminate the VMMs of VMs which are gone or were recreated", func() {
+		recreatedVM := newVM("default", "recreated", "5678")
+		goneVM := newVM("default", "gone", "9012")
+		vmm := startVMM(vm)
+		vmm.runGuest(vm, VmStateRunning)
+		recreatedVMM := startVMM(recreatedVM)
+		recreatedVMM.runGuest(newVM("default", "recreated", "3456"), VmStateRunning)
+		goneVMM := startVMM(goneVM)
+		goneVMM.runGuest(goneVM, VmStateShutdown)
+
+		store := kubecache.NewStore(kubecache.MetaNamespaceKeyFunc)
+		store.Add(vm)
+		store.Add(recreatedVM)
+
+		Expect(manager.ReconcileExistingGuests(store)).To(Succeed())
+		Expect(vmm.called()).To(Equal([]string{"vm.info"}))
+		Expect(recreatedVMM.called()).To(ContainElement("vmm.shutdown"))
+		Expect(goneVMM.called()).To(ContainElement("vmm.shutdown"))
+	})
+
+	Context("on checking the health of a VM", func() {
+		It("should report running guests as healthy", func() {
+			vmm := startVMM(vm)
+			vmm.runGuest(vm, VmStateRunning)
+
+			result, err := manager.HealthCheck(vm, false)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.Healthy).To(BeTrue())
+		})
+
+		It("should report paused guests as not running", func() {
+			vmm := startVMM(vm)
+			vmm.runGuest(vm, VmStatePaused)
+
+			result, err := manager.HealthCheck(vm, false)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.Reason).To(Equal(virtwrap.HealthReasonNotRunning))
+			Expect(result.State).To(Equal(api.Paused))
+		})
+
+		It("should report guests without a VMM as gone", func() {
+			result, err := manager.HealthCheck(vm, false)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.Reason).To(Equal(virtwrap.HealthReasonProcessGone))
+		})
+	})
+
+	It("should stop guests which don't shut down within the grace period on drains", func() {
+		vmm := startVMM(vm)
+		vmm.runGuest(vm, VmStateRunning)
+		ignoringVM := newVM("default", "ignoring", "5678")
+		ignoringVMM := startVMM(ignoringVM)
+		ignoringVMM.runGuest(ignoringVM, VmStateRunning)
+		ignoringVMM.ignoresPowerButton()
+
+		Expect(manager.DrainGuests(virtwrap.DrainPolicy{GracePeriod: 100 * time.Millisecond})).To(Succeed())
+		Expect(vmm.called()).To(ContainElement("vm.power-button"))
+		Expect(vmm.called()).ToNot(ContainElement("vm.shutdown"))
+		Expect(ignoringVMM.called()).To(ContainElement("vm.shutdown"))
+	})
+
+	AfterEach(func() {
+		for _, vmm := range vmms {
+			vmm.close()
+		}
+		ctrl.Finish()
+		serialPortSocket = originalSerialPortSocket
+		vmmCommand = originalVmmCommand
+		vmmStartTimeout = originalVmmStartTimeout
+		pollInterval = originalPollInterval
+		os.RemoveAll(tmpDir)
+	})
+})
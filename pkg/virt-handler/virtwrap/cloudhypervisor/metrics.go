@@ -0,0 +1,70 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package cloudhypervisor
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"kubevirt.io/kubevirt/pkg/logging"
+)
+
+var deviceCounterDesc = prometheus.NewDesc(
+	"kubevirt_cloudhypervisor_device_counter",
+	"Counters of the guest devices, e.g. the bytes read from a disk, as the VMM reports them.",
+	[]string{"domain", "device", "counter"},
+	nil,
+)
+
+// countersCollector asks all VMMs for the counters of their guests whenever
+// the metrics are scraped.
+type countersCollector struct {
+	socketDir string
+}
+
+// NewCountersCollector creates a collector for the counters of the guests of
+// the VMMs, it has to be registered by the caller.
+func NewCountersCollector(socketDir string) prometheus.Collector {
+	return &countersCollector{socketDir: socketDir}
+}
+
+func (c *countersCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- deviceCounterDesc
+}
+
+// Collect skips VMMs which don't answer, their guests are gone or not
+// created yet.
+func (c *countersCollector) Collect(ch chan<- prometheus.Metric) {
+	sockets, err := listSockets(c.socketDir)
+	if err != nil {
+		logging.DefaultLogger().Error().Reason(err).Msg("Listing the VMM sockets failed.")
+		return
+	}
+	for domName, socket := range sockets {
+		counters, err := NewClient(socket).VMCounters()
+		if err != nil {
+			continue
+		}
+		for device, values := range counters {
+			for counter, value := range values {
+				ch <- prometheus.MustNewConstMetric(deviceCounterDesc, prometheus.CounterValue, float64(value), domName, device, counter)
+			}
+		}
+	}
+}
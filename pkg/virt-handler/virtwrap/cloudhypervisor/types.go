@@ -0,0 +1,109 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package cloudhypervisor
+
+// The types follow the OpenAPI description of the cloud-hypervisor REST API,
+// only the fields which we need are included.
+
+const (
+	VmStateCreated  = "Created"
+	VmStateRunning  = "Running"
+	VmStateShutdown = "Shutdown"
+	VmStatePaused   = "Paused"
+)
+
+// Console modes, Socket exposes the console on a unix socket, so that it can
+// be proxied like the libvirt consoles.
+const (
+	ConsoleModeOff    = "Off"
+	ConsoleModePty    = "Pty"
+	ConsoleModeFile   = "File"
+	ConsoleModeSocket = "Socket"
+	ConsoleModeNull   = "Null"
+)
+
+type VmmPingResponse struct {
+	Version string `json:"version"`
+}
+
+type VmConfig struct {
+	Cpus     *CpusConfig     `json:"cpus,omitempty"`
+	Memory   *MemoryConfig   `json:"memory,omitempty"`
+	Payload  PayloadConfig   `json:"payload"`
+	Disks    []DiskConfig    `json:"disks,omitempty"`
+	Net      []NetConfig     `json:"net,omitempty"`
+	Rng      *RngConfig      `json:"rng,omitempty"`
+	Serial   *ConsoleConfig  `json:"serial,omitempty"`
+	Console  *ConsoleConfig  `json:"console,omitempty"`
+	Platform *PlatformConfig `json:"platform,omitempty"`
+}
+
+// PlatformConfig carries the UUID of the VM, so that the guest can be told
+// apart from a guest of a recreated VM with the same name.
+type PlatformConfig struct {
+	UUID string `json:"uuid,omitempty"`
+}
+
+type CpusConfig struct {
+	BootVcpus int `json:"boot_vcpus"`
+	MaxVcpus  int `json:"max_vcpus"`
+}
+
+type MemoryConfig struct {
+	// Size in bytes
+	Size   int64 `json:"size"`
+	Shared bool  `json:"shared,omitempty"`
+}
+
+// PayloadConfig either boots a firmware or directly a kernel.
+type PayloadConfig struct {
+	Firmware  string `json:"firmware,omitempty"`
+	Kernel    string `json:"kernel,omitempty"`
+	Cmdline   string `json:"cmdline,omitempty"`
+	Initramfs string `json:"initramfs,omitempty"`
+}
+
+type DiskConfig struct {
+	Path     string `json:"path"`
+	Readonly bool   `json:"readonly,omitempty"`
+	ID       string `json:"id,omitempty"`
+}
+
+type NetConfig struct {
+	Tap string `json:"tap,omitempty"`
+	Mac string `json:"mac,omitempty"`
+	ID  string `json:"id,omitempty"`
+}
+
+type RngConfig struct {
+	Src string `json:"src"`
+}
+
+type ConsoleConfig struct {
+	Mode   string `json:"mode"`
+	File   string `json:"file,omitempty"`
+	Socket string `json:"socket,omitempty"`
+}
+
+type VmInfo struct {
+	Config           VmConfig `json:"config"`
+	State            string   `json:"state"`
+	MemoryActualSize int64    `json:"memory_actual_size,omitempty"`
+}
@@ -0,0 +1,112 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package virtwrap
+
+import (
+	"fmt"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+)
+
+const (
+	PortKindConsole = "console"
+	PortKindChannel = "channel"
+)
+
+// GuestAgentChannel selects the channel of the qemu guest agent, whatever
+// alias libvirt gave it.
+const GuestAgentChannel = "guestagent-channel"
+
+const guestAgentChannelName = "org.qemu.guest_agent.0"
+
+// ConsoleDevice is a character device of a domain which a console can be
+// opened on.
+type ConsoleDevice struct {
+	// Name selects the device, it is the alias of the device, e.g. serial0
+	Name string `json:"name"`
+	// Kind is serial, parallel, console or channel
+	Kind string `json:"kind"`
+	// Type is the type of the character device, e.g. pty or unix
+	Type string `json:"type"`
+	// Target is the name of a channel, e.g. org.qemu.guest_agent.0
+	Target string `json:"target,omitempty"`
+}
+
+func aliasOrDefault(alias *api.Alias, kind string, index int) string {
+	if alias != nil && alias.Name != "" {
+		return alias.Name
+	}
+	return fmt.Sprintf("%s%d", kind, index)
+}
+
+// ConsoleDevices lists the serial and parallel ports, consoles and channels
+// of a domain. Devices without alias are named like libvirt names them,
+// e.g. serial0.
+func ConsoleDevices(devices *api.DomainDevices) []ConsoleDevice {
+	consoles := []ConsoleDevice{}
+	for i, serial := range devices.Serials {
+		consoles = append(consoles, ConsoleDevice{Name: aliasOrDefault(serial.Alias, PortKindSerial, i), Kind: PortKindSerial, Type: serial.Type})
+	}
+	for i, parallel := range devices.Parallels {
+		consoles = append(consoles, ConsoleDevice{Name: aliasOrDefault(parallel.Alias, PortKindParallel, i), Kind: PortKindParallel, Type: parallel.Type})
+	}
+	for i, console := range devices.Consoles {
+		consoles = append(consoles, ConsoleDevice{Name: aliasOrDefault(console.Alias, PortKindConsole, i), Kind: PortKindConsole, Type: console.Type})
+	}
+	for i, channel := range devices.Channels {
+		device := ConsoleDevice{Name: aliasOrDefault(channel.Alias, PortKindChannel, i), Kind: PortKindChannel, Type: channel.Type}
+		if channel.Target != nil {
+			device.Target = channel.Target.Name
+		}
+		consoles = append(consoles, device)
+	}
+	return consoles
+}
+
+// DefaultConsoleDevice returns the device libvirt opens a console on when no
+// device name is given: the first console, or else the first serial port.
+func DefaultConsoleDevice(devices *api.DomainDevices) (*ConsoleDevice, bool) {
+	for _, device := range ConsoleDevices(devices) {
+		if device.Kind == PortKindConsole {
+			return &device, true
+		}
+	}
+	for _, device := range ConsoleDevices(devices) {
+		if device.Kind == PortKindSerial {
+			return &device, true
+		}
+	}
+	return nil, false
+}
+
+// FindConsoleDevice looks up a console device by its name. Channels can also
+// be selected by their target name, the guest agent channel as
+// GuestAgentChannel.
+func FindConsoleDevice(devices *api.DomainDevices, name string) (*ConsoleDevice, bool) {
+	target := name
+	if name == GuestAgentChannel {
+		target = guestAgentChannelName
+	}
+	for _, device := range ConsoleDevices(devices) {
+		if device.Name == name || (device.Kind == PortKindChannel && device.Target != "" && device.Target == target) {
+			return &device, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,87 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package virtwrap
+
+import (
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+)
+
+var _ = Describe("Consoles", func() {
+	var devices *api.DomainDevices
+
+	BeforeEach(func() {
+		var err error
+		devices, err = api.NewDomainDevices(`<domain>
+  <devices>
+    <serial type="pty"><target port="0"/><alias name="serial0"/></serial>
+    <serial type="unix"><source mode="bind" path="/tmp/serial1.sock"/><target port="1"/></serial>
+    <console type="pty"><target type="serial" port="0"/><alias name="serial0"/></console>
+    <channel type="unix">
+      <source mode="bind" path="/tmp/agent.sock"/>
+      <target type="virtio" name="org.qemu.guest_agent.0"/>
+      <alias name="channel0"/>
+    </channel>
+  </devices>
+</domain>`)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should list all console devices", func() {
+		Expect(ConsoleDevices(devices)).To(Equal([]ConsoleDevice{
+			{Name: "serial0", Kind: PortKindSerial, Type: "pty"},
+			{Name: "serial1", Kind: PortKindSerial, Type: "unix"},
+			{Name: "serial0", Kind: PortKindConsole, Type: "pty"},
+			{Name: "channel0", Kind: PortKindChannel, Type: "unix", Target: "org.qemu.guest_agent.0"},
+		}))
+	})
+
+	table.DescribeTable("should find console devices", func(name string, kind string, alias string) {
+		device, found := FindConsoleDevice(devices, name)
+		Expect(found).To(BeTrue())
+		Expect(device.Kind).To(Equal(kind))
+		Expect(device.Name).To(Equal(alias))
+	},
+		table.Entry("by alias", "serial1", PortKindSerial, "serial1"),
+		table.Entry("by channel name", "org.qemu.guest_agent.0", PortKindChannel, "channel0"),
+		table.Entry("for the guest agent", GuestAgentChannel, PortKindChannel, "channel0"),
+	)
+
+	It("should default to the first console", func() {
+		device, found := DefaultConsoleDevice(devices)
+		Expect(found).To(BeTrue())
+		Expect(*device).To(Equal(ConsoleDevice{Name: "serial0", Kind: PortKindConsole, Type: "pty"}))
+	})
+
+	It("should default to the first serial port without console", func() {
+		devices.Consoles = nil
+		device, found := DefaultConsoleDevice(devices)
+		Expect(found).To(BeTrue())
+		Expect(device.Name).To(Equal("serial0"))
+		Expect(device.Kind).To(Equal(PortKindSerial))
+	})
+
+	It("should not find unknown console devices", func() {
+		_, found := FindConsoleDevice(devices, "serial2")
+		Expect(found).To(BeFalse())
+	})
+})
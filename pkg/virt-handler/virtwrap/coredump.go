@@ -0,0 +1,142 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	kubev1 "k8s.io/api/core/v1"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cache"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/jobs"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+// Core dumps are kept on the host, until an operator collects them or the VM
+// is deleted. libvirt writes them in its own pod, so they go to the libvirt
+// data directory which virt-handler shares.
+var coreDumpRoot = "/var/lib/libvirt/kubevirt/dumps"
+
+const coreDumpTimeLayout = "20060102T150405Z"
+
+// removeCoreDumps removes the core dumps of all crashes of the VM. Only files
+// named like the dumps of the domain are removed, so that the dumps of a VM
+// whose name starts with the same prefix stay.
+func removeCoreDumps(vm *v1.VirtualMachine) error {
+	prefix := cache.VMNamespaceKeyFunc(vm) + "-"
+	paths, err := filepath.Glob(filepath.Join(coreDumpRoot, prefix+"*.core"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		timestamp := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), prefix), ".core")
+		if _, err := time.Parse(coreDumpTimeLayout, timestamp); err != nil {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func hasCoreDumpOnCrash(vm *v1.VirtualMachine) bool {
+	return vm.Spec.Domain != nil && vm.Spec.Domain.CoreDumpOnCrash
+}
+
+// prepareCoreDump makes libvirt keep the qemu process of a crashed guest
+// around, so that its memory can still be dumped. Guests only report panics
+// through a panic device, which is added if there is none.
+func prepareCoreDump(vm *v1.VirtualMachine, spec *api.DomainSpec) {
+	if !hasCoreDumpOnCrash(vm) {
+		return
+	}
+	spec.OnCrash = "preserve"
+	if len(spec.Devices.Panics) == 0 {
+		spec.Devices.Panics = []api.Panic{{Model: defaultsForArch(spec.OS.Type.Arch).PanicModel}}
+	}
+}
+
+// DumpCrashedGuest writes the memory of a crashed guest into a core dump on
+// the host in a background job and returns the ID of the job. Nothing else
+// happens to the domain while the dump is written, so guests whose crash
+// policy restarts them are only restarted by the job, once the dump is done.
+func (l *LibvirtDomainManager) DumpCrashedGuest(vm *v1.VirtualMachine) (string, error) {
+	run := func(progress func(percent uint)) error {
+		err := l.runOnDomain(vm, func() error {
+			_, err := l.dumpCrashedGuest(vm)
+			return err
+		})
+		if err != nil {
+			l.recorder.Eventf(vm, kubev1.EventTypeWarning, v1.CoreDumped.String(), "Dumping the crashed guest failed: %v", err)
+		}
+		if CrashActionFor(vm) == v1.CrashActionRestart {
+			if _, err := l.RestartCrashedGuest(vm); err != nil {
+				logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Restarting the crashed guest failed.")
+				l.recorder.Eventf(vm, kubev1.EventTypeWarning, v1.Restarted.String(), "Restarting the crashed guest failed: %v", err)
+			}
+		}
+		return err
+	}
+	cancel := func() error {
+		return l.abortJob(vm)
+	}
+	return l.startJob(vm, jobs.CoreDump, run, cancel)
+}
+
+func (l *LibvirtDomainManager) dumpCrashedGuest(vm *v1.VirtualMachine) (string, error) {
+	domName := cache.VMNamespaceKeyFunc(vm)
+	dom, err := l.virConn.LookupDomainByName(domName)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain failed.")
+		return "", err
+	}
+	defer dom.Free()
+
+	domState, _, err := dom.GetState()
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain state failed.")
+		return "", err
+	}
+	if domState != libvirt.DOMAIN_CRASHED {
+		return "", fmt.Errorf("the domain is not crashed")
+	}
+
+	if err := os.MkdirAll(coreDumpRoot, 0700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(coreDumpRoot, fmt.Sprintf("%s-%s.core", domName, time.Now().UTC().Format(coreDumpTimeLayout)))
+	err = dom.CoreDump(path, libvirt.DUMP_MEMORY_ONLY)
+	l.audit(vm, TriggerDomainController, "core-dump", path, err)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Dumping the crashed guest failed.")
+		return "", err
+	}
+	logging.DefaultLogger().Object(vm).Info().Msgf("Core dump of the crashed guest written to %s.", path)
+	l.recorder.Eventf(vm, kubev1.EventTypeNormal, v1.CoreDumped.String(), "Core dump of the crashed guest written to %s", path)
+	return path, nil
+}
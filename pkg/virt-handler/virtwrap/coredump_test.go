@@ -0,0 +1,178 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/client-go/tools/record"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/jobs"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Core dumps", func() {
+	var tmpDir string
+	var originalCoreDumpRoot string
+	var ctrl *gomock.Controller
+	var mockConn *cli.MockConnection
+	var mockDomain *cli.MockVirDomain
+	var recorder *record.FakeRecorder
+	var manager *LibvirtDomainManager
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "dumps")
+		Expect(err).ToNot(HaveOccurred())
+		originalCoreDumpRoot = coreDumpRoot
+		coreDumpRoot = filepath.Join(tmpDir, "dumps")
+
+		ctrl = gomock.NewController(GinkgoT())
+		mockConn = cli.NewMockConnection(ctrl)
+		mockDomain = cli.NewMockVirDomain(ctrl)
+		recorder = record.NewFakeRecorder(10)
+		manager = &LibvirtDomainManager{
+			virConn:     mockConn,
+			recorder:    recorder,
+			domainSpecs: newDomainSpecCache(),
+			jobs:        jobs.NewJobManager(),
+		}
+	})
+
+	It("should preserve crashed guests and add a panic device", func() {
+		vm := newVM("default", "testvm")
+		vm.Spec.Domain.CoreDumpOnCrash = true
+		spec := api.NewMinimalDomainSpec("default_testvm")
+		prepareCoreDump(vm, spec)
+		Expect(spec.OnCrash).To(Equal("preserve"))
+		Expect(spec.Devices.Panics).To(Equal([]api.Panic{{Model: "isa"}}))
+	})
+
+	It("should add the panic device of the guest architecture", func() {
+		vm := newVM("default", "testvm")
+		vm.Spec.Domain.CoreDumpOnCrash = true
+		spec := api.NewMinimalDomainSpec("default_testvm")
+		spec.OS.Type.Arch = "s390x"
+		prepareCoreDump(vm, spec)
+		Expect(spec.Devices.Panics).To(Equal([]api.Panic{{Model: "s390"}}))
+	})
+
+	It("should leave guests without core dumps alone", func() {
+		spec := api.NewMinimalDomainSpec("default_testvm")
+		prepareCoreDump(newVM("default", "testvm"), spec)
+		Expect(spec.OnCrash).To(BeEmpty())
+		Expect(spec.Devices.Panics).To(BeEmpty())
+	})
+
+	It("should dump crashed guests", func() {
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+		mockDomain.EXPECT().GetState().Return(libvirt.DOMAIN_CRASHED, int(libvirt.DOMAIN_CRASHED_PANICKED), nil)
+		mockDomain.EXPECT().CoreDump(gomock.Any(), libvirt.DUMP_MEMORY_ONLY).Return(nil)
+		mockDomain.EXPECT().Free()
+
+		path, err := manager.dumpCrashedGuest(newVM("default", "testvm"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(filepath.Dir(path)).To(Equal(coreDumpRoot))
+		Expect(filepath.Base(path)).To(HavePrefix("default_testvm-"))
+		Expect(recorder.Events).To(HaveLen(1))
+	})
+
+	It("should refuse to dump guests which did not crash", func() {
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+		mockDomain.EXPECT().GetState().Return(libvirt.DOMAIN_RUNNING, 1, nil)
+		mockDomain.EXPECT().Free()
+
+		_, err := manager.dumpCrashedGuest(newVM("default", "testvm"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should dump crashed guests in a background job", func() {
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+		mockDomain.EXPECT().GetState().Return(libvirt.DOMAIN_CRASHED, int(libvirt.DOMAIN_CRASHED_PANICKED), nil)
+		mockDomain.EXPECT().CoreDump(gomock.Any(), libvirt.DUMP_MEMORY_ONLY).Return(nil)
+		mockDomain.EXPECT().Free()
+
+		id, err := manager.DumpCrashedGuest(newVM("default", "testvm"))
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(func() jobs.JobPhase {
+			job, _ := manager.jobs.Get(id)
+			return job.Phase
+		}).Should(Equal(jobs.Succeeded))
+	})
+
+	It("should only restart crashed guests once the dump is written", func() {
+		vm := newVM("default", "testvm")
+		vm.Spec.Domain.CrashPolicy = &v1.CrashPolicy{Action: v1.CrashActionRestart}
+
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil).Times(2)
+		gomock.InOrder(
+			mockDomain.EXPECT().GetState().Return(libvirt.DOMAIN_CRASHED, int(libvirt.DOMAIN_CRASHED_PANICKED), nil),
+			mockDomain.EXPECT().CoreDump(gomock.Any(), libvirt.DUMP_MEMORY_ONLY).Return(nil),
+			mockDomain.EXPECT().Free(),
+			mockDomain.EXPECT().GetMetadata(libvirt.DOMAIN_METADATA_ELEMENT, api.KubeVirtMetadataURI, libvirt.DOMAIN_AFFECT_CONFIG).Return("<kubevirt><uid>1234</uid></kubevirt>", nil),
+			mockDomain.EXPECT().GetState().Return(libvirt.DOMAIN_CRASHED, int(libvirt.DOMAIN_CRASHED_PANICKED), nil),
+			mockDomain.EXPECT().Destroy().Return(nil),
+			mockDomain.EXPECT().Create().Return(nil),
+			mockDomain.EXPECT().SetMetadata(gomock.Any(), libvirt.DOMAIN_METADATA_ELEMENT, api.KubeVirtMetadataPrefix, api.KubeVirtMetadataURI, libvirt.DOMAIN_AFFECT_CONFIG).Return(nil),
+			mockDomain.EXPECT().Free(),
+		)
+
+		id, err := manager.DumpCrashedGuest(vm)
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(func() jobs.JobPhase {
+			job, _ := manager.jobs.Get(id)
+			return job.Phase
+		}).Should(Equal(jobs.Succeeded))
+	})
+
+	It("should remove the core dumps of the VM", func() {
+		Expect(os.MkdirAll(coreDumpRoot, 0700)).To(Succeed())
+		for _, name := range []string{"default_testvm-20171201T101010Z.core", "default_testvm-20171202T101010Z.core", "default_testvm-2-20171201T101010Z.core", "default_othervm-20171201T101010Z.core"} {
+			Expect(ioutil.WriteFile(filepath.Join(coreDumpRoot, name), []byte("core"), 0600)).To(Succeed())
+		}
+
+		Expect(removeCoreDumps(newVM("default", "testvm"))).To(Succeed())
+		files, err := ioutil.ReadDir(coreDumpRoot)
+		Expect(err).ToNot(HaveOccurred())
+		names := []string{}
+		for _, file := range files {
+			names = append(names, file.Name())
+		}
+		Expect(names).To(ConsistOf("default_testvm-2-20171201T101010Z.core", "default_othervm-20171201T101010Z.core"))
+	})
+
+	It("should not fail without core dumps", func() {
+		Expect(removeCoreDumps(newVM("default", "testvm"))).To(Succeed())
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+		coreDumpRoot = originalCoreDumpRoot
+		os.RemoveAll(tmpDir)
+	})
+})
@@ -0,0 +1,102 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	kubev1 "k8s.io/api/core/v1"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+)
+
+// qemu runs in the cgroups of the virt-launcher Pod, whose cpuset holds the
+// CPUs the kubelet CPU manager dedicated to the Pod.
+var cgroupRoot = "/sys/fs/cgroup"
+
+func hasDedicatedCPUs(vm *v1.VirtualMachine) bool {
+	return vm.Spec.Domain != nil && vm.Spec.Domain.VCPU != nil && vm.Spec.Domain.VCPU.DedicatedCPUPlacement
+}
+
+// launcherCPUSet reads the CPUs of the cpuset cgroup of the virt-launcher
+// Pod.
+func launcherCPUSet(slice string) ([]uint, error) {
+	content, err := ioutil.ReadFile(filepath.Join(cgroupRoot, "cpuset", slice, "cpuset.cpus"))
+	if err != nil {
+		return nil, err
+	}
+	return cli.ParseCPUSet(string(content))
+}
+
+// cpuPinningPlan pins every vCPU to its own CPU of the cpuset. The emulator
+// threads and the IOThreads share the CPUs which are left, or all of them if
+// every CPU runs a vCPU.
+func cpuPinningPlan(spec *api.DomainSpec, cpuset []uint) (*cli.CPUPinningPlan, error) {
+	vcpus := uint(1)
+	if spec.VCPU != nil && spec.VCPU.CPUs != 0 {
+		vcpus = spec.VCPU.CPUs
+	}
+	if uint(len(cpuset)) < vcpus {
+		return nil, fmt.Errorf("%d vCPUs need as many dedicated CPUs, the virt-launcher Pod has %d", vcpus, len(cpuset))
+	}
+
+	plan := &cli.CPUPinningPlan{VCPUs: map[uint][]uint{}, IOThreads: map[uint][]uint{}}
+	for vcpu := uint(0); vcpu < vcpus; vcpu++ {
+		plan.VCPUs[vcpu] = []uint{cpuset[vcpu]}
+	}
+	shared := cpuset[vcpus:]
+	if len(shared) == 0 {
+		shared = cpuset
+	}
+	plan.Emulator = shared
+	if spec.IOThreads != nil {
+		for id := uint(1); id <= spec.IOThreads.Count; id++ {
+			plan.IOThreads[id] = shared
+		}
+	}
+	return plan, nil
+}
+
+// pinDedicatedCPUs pins the threads of a freshly started domain to the CPUs
+// dedicated to the virt-launcher Pod.
+func (l *LibvirtDomainManager) pinDedicatedCPUs(vm *v1.VirtualMachine, dom cli.VirDomain, slice string, spec *api.DomainSpec) error {
+	cpuset, err := launcherCPUSet(slice)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Reading the CPUs of the virt-launcher Pod failed.")
+		return err
+	}
+	plan, err := cpuPinningPlan(spec, cpuset)
+	if err == nil {
+		err = cli.ApplyCPUPinning(dom, plan)
+		l.audit(vm, TriggerVMController, "pin-cpus", plan, err)
+	}
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Pinning the vCPUs failed.")
+		l.recorder.Eventf(vm, kubev1.EventTypeWarning, v1.SyncFailed.String(), "Pinning the vCPUs failed: %v", err)
+		return err
+	}
+	logging.DefaultLogger().Object(vm).Info().Msgf("vCPUs pinned to the dedicated CPUs %v.", cpuset)
+	return nil
+}
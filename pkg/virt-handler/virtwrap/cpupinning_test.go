@@ -0,0 +1,73 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+)
+
+var _ = Describe("CPU pinning", func() {
+
+	It("should only pin VMs with dedicated CPUs", func() {
+		vm := newVM("default", "testvm")
+		Expect(hasDedicatedCPUs(vm)).To(BeFalse())
+		vm.Spec.Domain.VCPU = &v1.VCPU{CPUs: 2}
+		Expect(hasDedicatedCPUs(vm)).To(BeFalse())
+		vm.Spec.Domain.VCPU.DedicatedCPUPlacement = true
+		Expect(hasDedicatedCPUs(vm)).To(BeTrue())
+	})
+
+	It("should give every vCPU its own CPU and share the rest", func() {
+		spec := api.NewMinimalDomainSpec("default_testvm")
+		spec.VCPU = &api.VCPU{CPUs: 2}
+		spec.IOThreads = &api.IOThreads{Count: 2}
+
+		plan, err := cpuPinningPlan(spec, []uint{4, 5, 6, 7})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(*plan).To(Equal(cli.CPUPinningPlan{
+			VCPUs:     map[uint][]uint{0: {4}, 1: {5}},
+			Emulator:  []uint{6, 7},
+			IOThreads: map[uint][]uint{1: {6, 7}, 2: {6, 7}},
+		}))
+	})
+
+	It("should let the emulator share all CPUs if the vCPUs take them all", func() {
+		spec := api.NewMinimalDomainSpec("default_testvm")
+
+		plan, err := cpuPinningPlan(spec, []uint{3})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(plan.VCPUs).To(Equal(map[uint][]uint{0: {3}}))
+		Expect(plan.Emulator).To(Equal([]uint{3}))
+		Expect(plan.IOThreads).To(BeEmpty())
+	})
+
+	It("should refuse to share CPUs between vCPUs", func() {
+		spec := api.NewMinimalDomainSpec("default_testvm")
+		spec.VCPU = &api.VCPU{CPUs: 4}
+
+		_, err := cpuPinningPlan(spec, []uint{0, 1})
+		Expect(err).To(MatchError("4 vCPUs need as many dedicated CPUs, the virt-launcher Pod has 2"))
+	})
+})
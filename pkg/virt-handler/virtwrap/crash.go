@@ -0,0 +1,121 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"fmt"
+
+	kubev1 "k8s.io/api/core/v1"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cache"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+const defaultMaxCrashRestarts = 3
+
+// CrashActionFor returns what has to happen to the VM after its guest crashed.
+func CrashActionFor(vm *v1.VirtualMachine) v1.CrashAction {
+	if vm.Spec.Domain == nil || vm.Spec.Domain.CrashPolicy == nil || vm.Spec.Domain.CrashPolicy.Action == "" {
+		return v1.CrashActionNone
+	}
+	return vm.Spec.Domain.CrashPolicy.Action
+}
+
+func maxCrashRestarts(vm *v1.VirtualMachine) uint {
+	if vm.Spec.Domain == nil || vm.Spec.Domain.CrashPolicy == nil || vm.Spec.Domain.CrashPolicy.MaxRestarts == 0 {
+		return defaultMaxCrashRestarts
+	}
+	return vm.Spec.Domain.CrashPolicy.MaxRestarts
+}
+
+// RestartCrashedGuest starts a crashed guest again in place, as long as it
+// did not crash more often than its crash policy allows. It returns how often
+// the guest was restarted so far. The count is kept in the domain metadata,
+// so that it survives restarts of virt-handler, until the domain is removed.
+func (l *LibvirtDomainManager) RestartCrashedGuest(vm *v1.VirtualMachine) (uint, error) {
+	var restarts uint
+	err := l.runOnDomain(vm, func() (err error) {
+		restarts, err = l.restartCrashedGuest(vm)
+		return
+	})
+	return restarts, err
+}
+
+func (l *LibvirtDomainManager) restartCrashedGuest(vm *v1.VirtualMachine) (uint, error) {
+	domName := cache.VMNamespaceKeyFunc(vm)
+	dom, err := l.virConn.LookupDomainByName(domName)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain failed.")
+		return 0, err
+	}
+	defer dom.Free()
+
+	metadata, err := GetMetadata(dom)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Reading the domain metadata failed.")
+		return 0, err
+	}
+	restarts := metadata.CrashRestarts
+	if max := maxCrashRestarts(vm); restarts >= max {
+		return restarts, fmt.Errorf("the guest was already restarted %d times", max)
+	}
+
+	domState, _, err := dom.GetState()
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain state failed.")
+		return restarts, err
+	}
+	switch domState {
+	case libvirt.DOMAIN_CRASHED:
+		// The qemu process of preserved guests is still around
+		err := dom.Destroy()
+		l.audit(vm, TriggerDomainController, "destroy", nil, err)
+		if err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Destroying the crashed domain failed.")
+			return restarts, err
+		}
+	case libvirt.DOMAIN_SHUTOFF:
+	default:
+		return restarts, fmt.Errorf("the domain is not crashed")
+	}
+
+	err = dom.Create()
+	l.audit(vm, TriggerDomainController, "create", nil, err)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Restarting the crashed domain failed.")
+		return restarts, err
+	}
+	l.domainSpecs.invalidate(domName)
+
+	restarts++
+	metadata.CrashRestarts = restarts
+	err = SetMetadata(dom, metadata)
+	l.audit(vm, TriggerDomainController, "set-metadata", metadata, err)
+	if err != nil {
+		// The guest runs again, it only gets more restarts than it should
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Storing the crash restarts in the domain metadata failed.")
+	}
+
+	logging.DefaultLogger().Object(vm).Info().Msgf("Crashed guest restarted, restart %d of %d.", restarts, maxCrashRestarts(vm))
+	l.recorder.Eventf(vm, kubev1.EventTypeNormal, v1.Restarted.String(), "Crashed guest restarted, restart %d of %d", restarts, maxCrashRestarts(vm))
+	return restarts, nil
+}
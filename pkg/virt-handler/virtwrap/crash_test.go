@@ -0,0 +1,105 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/client-go/tools/record"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Crash policy", func() {
+	var ctrl *gomock.Controller
+	var mockConn *cli.MockConnection
+	var mockDomain *cli.MockVirDomain
+	var manager *LibvirtDomainManager
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockConn = cli.NewMockConnection(ctrl)
+		mockDomain = cli.NewMockVirDomain(ctrl)
+		manager = &LibvirtDomainManager{
+			virConn:     mockConn,
+			recorder:    record.NewFakeRecorder(10),
+			domainSpecs: newDomainSpecCache(),
+		}
+	})
+
+	expectCrashRestarts := func(restarts string) {
+		metadata := "<kubevirt><uid>1234</uid></kubevirt>"
+		if restarts != "" {
+			metadata = "<kubevirt><uid>1234</uid><crashRestarts>" + restarts + "</crashRestarts></kubevirt>"
+		}
+		mockDomain.EXPECT().GetMetadata(libvirt.DOMAIN_METADATA_ELEMENT, api.KubeVirtMetadataURI, libvirt.DOMAIN_AFFECT_CONFIG).Return(metadata, nil)
+	}
+
+	It("should default to no action", func() {
+		Expect(CrashActionFor(newVM("default", "testvm"))).To(Equal(v1.CrashActionNone))
+	})
+
+	It("should destroy and start preserved guests again", func() {
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+		expectCrashRestarts("")
+		mockDomain.EXPECT().GetState().Return(libvirt.DOMAIN_CRASHED, int(libvirt.DOMAIN_CRASHED_PANICKED), nil)
+		mockDomain.EXPECT().Destroy().Return(nil)
+		mockDomain.EXPECT().Create().Return(nil)
+		mockDomain.EXPECT().SetMetadata("<kubevirt><uid>1234</uid><crashRestarts>1</crashRestarts></kubevirt>", libvirt.DOMAIN_METADATA_ELEMENT, api.KubeVirtMetadataPrefix, api.KubeVirtMetadataURI, libvirt.DOMAIN_AFFECT_CONFIG).Return(nil)
+		mockDomain.EXPECT().Free()
+
+		restarts, err := manager.RestartCrashedGuest(newVM("default", "testvm"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(restarts).To(Equal(uint(1)))
+	})
+
+	It("should start shut off guests again", func() {
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+		expectCrashRestarts("1")
+		mockDomain.EXPECT().GetState().Return(libvirt.DOMAIN_SHUTOFF, int(libvirt.DOMAIN_SHUTOFF_CRASHED), nil)
+		mockDomain.EXPECT().Create().Return(nil)
+		mockDomain.EXPECT().SetMetadata("<kubevirt><uid>1234</uid><crashRestarts>2</crashRestarts></kubevirt>", libvirt.DOMAIN_METADATA_ELEMENT, api.KubeVirtMetadataPrefix, api.KubeVirtMetadataURI, libvirt.DOMAIN_AFFECT_CONFIG).Return(nil)
+		mockDomain.EXPECT().Free()
+
+		restarts, err := manager.RestartCrashedGuest(newVM("default", "testvm"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(restarts).To(Equal(uint(2)))
+	})
+
+	It("should give up after the allowed number of restarts", func() {
+		vm := newVM("default", "testvm")
+		vm.Spec.Domain.CrashPolicy = &v1.CrashPolicy{Action: v1.CrashActionRestart, MaxRestarts: 2}
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+		expectCrashRestarts("2")
+		mockDomain.EXPECT().Free()
+
+		restarts, err := manager.RestartCrashedGuest(vm)
+		Expect(err).To(HaveOccurred())
+		Expect(restarts).To(Equal(uint(2)))
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+})
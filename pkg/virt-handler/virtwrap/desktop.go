@@ -0,0 +1,110 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"fmt"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+)
+
+var supportedSoundModels = map[string]bool{
+	"ich9": true,
+	"ich6": true,
+	"ac97": true,
+}
+
+var supportedInputBuses = map[string]bool{
+	"usb":    true,
+	"virtio": true,
+	"ps2":    true,
+}
+
+func hasSpiceGraphics(spec *api.DomainSpec) bool {
+	for _, graphics := range spec.Devices.Graphics {
+		if graphics.Type == "spice" {
+			return true
+		}
+	}
+	return false
+}
+
+func hasUSB(spec *api.DomainSpec) bool {
+	for _, controller := range spec.Devices.Controllers {
+		if controller.Type == "usb" && controller.Model == "none" {
+			return false
+		}
+	}
+	return true
+}
+
+// prepareDesktopDevices fills in the defaults of sound cards, input devices
+// and USB redirections and checks that the domain can host them. libvirt
+// adds a USB controller on its own, unless it is explicitly disabled.
+func prepareDesktopDevices(spec *api.DomainSpec) error {
+	for i := range spec.Devices.Sounds {
+		sound := &spec.Devices.Sounds[i]
+		if sound.Model == "" {
+			sound.Model = "ich9"
+		}
+		if !supportedSoundModels[sound.Model] {
+			return fmt.Errorf("unsupported sound model %s", sound.Model)
+		}
+	}
+
+	for i := range spec.Devices.Inputs {
+		input := &spec.Devices.Inputs[i]
+		if input.Type != "tablet" && input.Type != "keyboard" && input.Type != "mouse" {
+			return fmt.Errorf("unsupported input type %s", input.Type)
+		}
+		if input.Bus == "" {
+			input.Bus = "usb"
+		}
+		if !supportedInputBuses[input.Bus] {
+			return fmt.Errorf("unsupported input bus %s", input.Bus)
+		}
+		if input.Type == "tablet" && input.Bus == "ps2" {
+			return fmt.Errorf("tablets can not be attached to the ps2 bus")
+		}
+		if input.Bus == "usb" && !hasUSB(spec) {
+			return fmt.Errorf("USB %s needs a USB controller", input.Type)
+		}
+	}
+
+	for i := range spec.Devices.Redirects {
+		redir := &spec.Devices.Redirects[i]
+		if redir.Bus == "" {
+			redir.Bus = "usb"
+		}
+		if redir.Type == "" {
+			redir.Type = "spicevmc"
+		}
+		if redir.Bus != "usb" || redir.Type != "spicevmc" {
+			return fmt.Errorf("unsupported redirection %s on bus %s", redir.Type, redir.Bus)
+		}
+		if !hasSpiceGraphics(spec) {
+			return fmt.Errorf("USB redirection needs SPICE graphics")
+		}
+		if !hasUSB(spec) {
+			return fmt.Errorf("USB redirection needs a USB controller")
+		}
+	}
+	return nil
+}
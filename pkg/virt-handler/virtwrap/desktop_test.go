@@ -0,0 +1,72 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+)
+
+var _ = Describe("Desktop devices", func() {
+
+	newSpec := func() *api.DomainSpec {
+		spec := api.NewMinimalDomainSpec("testvm")
+		spec.Devices.Graphics = []api.Graphics{{Type: "spice", Port: -1}}
+		spec.Devices.Sounds = []api.Sound{{}}
+		spec.Devices.Inputs = []api.Input{{Type: "tablet"}, {Type: "keyboard", Bus: "virtio"}}
+		spec.Devices.Redirects = []api.RedirDev{{}}
+		return spec
+	}
+
+	It("should fill in the defaults", func() {
+		spec := newSpec()
+		Expect(prepareDesktopDevices(spec)).To(Succeed())
+		Expect(spec.Devices.Sounds).To(Equal([]api.Sound{{Model: "ich9"}}))
+		Expect(spec.Devices.Inputs).To(Equal([]api.Input{{Type: "tablet", Bus: "usb"}, {Type: "keyboard", Bus: "virtio"}}))
+		Expect(spec.Devices.Redirects).To(Equal([]api.RedirDev{{Bus: "usb", Type: "spicevmc"}}))
+	})
+
+	It("should reject USB redirection without SPICE", func() {
+		spec := newSpec()
+		spec.Devices.Graphics = []api.Graphics{{Type: "vnc", Port: -1}}
+		Expect(prepareDesktopDevices(spec)).ToNot(Succeed())
+	})
+
+	It("should reject USB devices when USB is disabled", func() {
+		spec := newSpec()
+		spec.Devices.Redirects = nil
+		spec.Devices.Controllers = []api.Controller{{Type: "usb", Model: "none"}}
+		Expect(prepareDesktopDevices(spec)).ToNot(Succeed())
+	})
+
+	It("should reject unknown sound models", func() {
+		spec := newSpec()
+		spec.Devices.Sounds[0].Model = "pcspk"
+		Expect(prepareDesktopDevices(spec)).ToNot(Succeed())
+	})
+
+	It("should reject tablets on the ps2 bus", func() {
+		spec := newSpec()
+		spec.Devices.Inputs[0].Bus = "ps2"
+		Expect(prepareDesktopDevices(spec)).ToNot(Succeed())
+	})
+})
@@ -0,0 +1,50 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cache"
+)
+
+// GetDomainDevices returns the disks, interfaces, controllers and host
+// devices of the running domain, as libvirt reports them right now.
+func (l *LibvirtDomainManager) GetDomainDevices(vm *v1.VirtualMachine) (*api.DomainDevices, error) {
+	dom, err := l.virConn.LookupDomainByName(cache.VMNamespaceKeyFunc(vm))
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain failed.")
+		return nil, err
+	}
+	defer dom.Free()
+
+	xmlstr, err := dom.GetXMLDesc(0)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain XML failed.")
+		return nil, err
+	}
+	devices, err := api.NewDomainDevices(xmlstr)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Parsing the domain devices failed.")
+		return nil, err
+	}
+	return devices, nil
+}
@@ -0,0 +1,101 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Domain devices", func() {
+	var ctrl *gomock.Controller
+	var mockConn *cli.MockConnection
+	var mockDomain *cli.MockVirDomain
+	var manager *LibvirtDomainManager
+
+	domainXML := `<domain type="kvm">
+  <name>default_testvm</name>
+  <devices>
+    <emulator>/usr/bin/qemu-kvm</emulator>
+    <disk type="file" device="disk">
+      <driver name="qemu" type="qcow2"></driver>
+      <source file="/var/lib/libvirt/kubevirt/overlays/default_testvm/vda.qcow2"></source>
+      <target dev="vda" bus="virtio"></target>
+      <alias name="virtio-disk0"></alias>
+    </disk>
+    <controller type="usb" index="0" model="piix3-uhci">
+      <alias name="usb"></alias>
+      <address type="pci" domain="0x0000" bus="0x00" slot="0x01" function="0x2"></address>
+    </controller>
+    <controller type="pci" index="0" model="pci-root"></controller>
+    <interface type="network">
+      <mac address="52:54:00:6d:90:02"></mac>
+      <source network="default"></source>
+      <target dev="vnet0"></target>
+    </interface>
+    <hostdev mode="subsystem" type="pci" managed="no">
+      <source>
+        <address domain="0x0000" bus="0x06" slot="0x02" function="0x0"></address>
+      </source>
+    </hostdev>
+  </devices>
+</domain>`
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockConn = cli.NewMockConnection(ctrl)
+		mockDomain = cli.NewMockVirDomain(ctrl)
+		manager = &LibvirtDomainManager{virConn: mockConn}
+	})
+
+	It("should list the devices of the live domain", func() {
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+		mockDomain.EXPECT().GetXMLDesc(libvirt.DomainXMLFlags(0)).Return(domainXML, nil)
+		mockDomain.EXPECT().Free()
+
+		devices, err := manager.GetDomainDevices(newVM("default", "testvm"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(devices.Disks).To(HaveLen(1))
+		Expect(devices.Disks[0].Target).To(Equal(api.DiskTarget{Device: "vda", Bus: "virtio"}))
+		Expect(devices.Interfaces).To(HaveLen(1))
+		Expect(devices.Interfaces[0].Target.Device).To(Equal("vnet0"))
+		Expect(devices.Controllers).To(Equal([]api.Controller{
+			{
+				Type:    "usb",
+				Index:   "0",
+				Model:   "piix3-uhci",
+				Alias:   &api.Alias{Name: "usb"},
+				Address: &api.Address{Type: "pci", Domain: "0x0000", Bus: "0x00", Slot: "0x01", Function: "0x2"},
+			},
+			{Type: "pci", Index: "0", Model: "pci-root"},
+		}))
+		Expect(devices.HostDevices).To(HaveLen(1))
+		Expect(devices.HostDevices[0].Source.Address.Bus).To(Equal("0x06"))
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+})
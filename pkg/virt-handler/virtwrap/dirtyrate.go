@@ -0,0 +1,87 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	utilwait "k8s.io/apimachinery/pkg/util/wait"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/logging"
+)
+
+// qemu refuses shorter or longer measurements
+const minDirtyRateSeconds = 1
+const maxDirtyRateSeconds = 60
+
+const dirtyRateMeasured = "measured"
+
+var dirtyRatePollInterval = 1 * time.Second
+
+// qemu may need a moment longer than the requested time to report the result
+var dirtyRateGracePeriod = 10 * time.Second
+
+type dirtyRateInfo struct {
+	Status string `json:"status"`
+	// Dirtied memory in MiB/s
+	DirtyRate uint64 `json:"dirty-rate"`
+}
+
+// MeasureDirtyRate lets qemu sample how fast the guest dirties its memory
+// over the given number of seconds and returns the rate in MiB/s. The call
+// blocks until the measurement is done.
+func (l *LibvirtDomainManager) MeasureDirtyRate(vm *v1.VirtualMachine, seconds int64) (uint64, error) {
+	if seconds < minDirtyRateSeconds || seconds > maxDirtyRateSeconds {
+		return 0, fmt.Errorf("the dirty rate can only be measured for %d to %d seconds", minDirtyRateSeconds, maxDirtyRateSeconds)
+	}
+	if _, err := l.QemuMonitorCommand(vm, "calc-dirty-rate", map[string]interface{}{"calc-time": seconds}); err != nil {
+		return 0, err
+	}
+
+	var info dirtyRateInfo
+	timeout := time.Duration(seconds)*time.Second + dirtyRateGracePeriod
+	err := utilwait.Poll(dirtyRatePollInterval, timeout, func() (bool, error) {
+		result, err := l.QemuMonitorCommand(vm, "query-dirty-rate", nil)
+		if err != nil {
+			return false, err
+		}
+		if err := json.Unmarshal(result, &info); err != nil {
+			return false, err
+		}
+		return info.Status == dirtyRateMeasured, nil
+	})
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Measuring the dirty rate failed.")
+		return 0, err
+	}
+	logging.DefaultLogger().Object(vm).Info().Msgf("Guest dirties %d MiB/s.", info.DirtyRate)
+	return info.DirtyRate, nil
+}
+
+// PrecopyConverges tells whether a pre-copy migration with the given
+// bandwidth in MiB/s can catch up with a guest dirtying its memory at the
+// given rate. If not, the migration needs post-copy or auto-converge. A
+// bandwidth of zero is unlimited.
+func PrecopyConverges(dirtyRate uint64, bandwidth uint64) bool {
+	return bandwidth == 0 || dirtyRate < bandwidth
+}
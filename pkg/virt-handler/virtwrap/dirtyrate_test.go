@@ -0,0 +1,82 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"time"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Dirty rate", func() {
+	var ctrl *gomock.Controller
+	var mockConn *cli.MockConnection
+	var mockDomain *cli.MockVirDomain
+	var manager *LibvirtDomainManager
+	var originalPollInterval time.Duration
+
+	expectQMP := func(command string, reply string) *gomock.Call {
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+		mockDomain.EXPECT().Free()
+		return mockDomain.EXPECT().QemuMonitorCommand(command, libvirt.DOMAIN_QEMU_MONITOR_COMMAND_DEFAULT).Return(reply, nil)
+	}
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockConn = cli.NewMockConnection(ctrl)
+		mockDomain = cli.NewMockVirDomain(ctrl)
+		manager = &LibvirtDomainManager{virConn: mockConn}
+		originalPollInterval = dirtyRatePollInterval
+		dirtyRatePollInterval = 10 * time.Millisecond
+	})
+
+	It("should wait until the dirty rate was measured", func() {
+		gomock.InOrder(
+			expectQMP(`{"execute":"calc-dirty-rate","arguments":{"calc-time":1}}`, `{"return":{}}`),
+			expectQMP(`{"execute":"query-dirty-rate"}`, `{"return":{"status":"measuring"}}`),
+			expectQMP(`{"execute":"query-dirty-rate"}`, `{"return":{"status":"measured","dirty-rate":108,"calc-time":1}}`),
+		)
+
+		Expect(manager.MeasureDirtyRate(newVM("default", "testvm"), 1)).To(Equal(uint64(108)))
+	})
+
+	It("should reject measurements qemu does not support", func() {
+		_, err := manager.MeasureDirtyRate(newVM("default", "testvm"), 0)
+		Expect(err).To(HaveOccurred())
+		_, err = manager.MeasureDirtyRate(newVM("default", "testvm"), 61)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should tell whether pre-copy can catch up with the guest", func() {
+		Expect(PrecopyConverges(100, 0)).To(BeTrue())
+		Expect(PrecopyConverges(100, 200)).To(BeTrue())
+		Expect(PrecopyConverges(200, 200)).To(BeFalse())
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+		dirtyRatePollInterval = originalPollInterval
+	})
+})
@@ -0,0 +1,68 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"fmt"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cache"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/jobs"
+)
+
+// startJob runs a long operation on the domain of the VM in the background
+// and returns the ID of the job. Finished jobs of the domain are forgotten
+// when a new one starts, so that only the latest ones can be queried.
+func (l *LibvirtDomainManager) startJob(vm *v1.VirtualMachine, jobType jobs.JobType, run jobs.JobFunc, cancel jobs.CancelFunc) (string, error) {
+	domName := cache.VMNamespaceKeyFunc(vm)
+	for _, job := range l.jobs.List() {
+		if job.Domain == domName && job.IsFinished() {
+			l.jobs.Remove(job.ID)
+		}
+	}
+	return l.jobs.Start(domName, jobType, run, cancel)
+}
+
+// ListJobs returns the background jobs of the domain of the VM, including
+// the finished ones.
+func (l *LibvirtDomainManager) ListJobs(vm *v1.VirtualMachine) []jobs.Job {
+	domName := cache.VMNamespaceKeyFunc(vm)
+	domainJobs := []jobs.Job{}
+	for _, job := range l.jobs.List() {
+		if job.Domain == domName {
+			domainJobs = append(domainJobs, job)
+		}
+	}
+	return domainJobs
+}
+
+// CancelJob asks a background job of the domain of the VM to stop.
+func (l *LibvirtDomainManager) CancelJob(vm *v1.VirtualMachine, id string, trigger Trigger) error {
+	job, err := l.jobs.Get(id)
+	if err != nil {
+		return err
+	}
+	if job.Domain != cache.VMNamespaceKeyFunc(vm) {
+		return fmt.Errorf("job %s does not exist", id)
+	}
+	err = l.jobs.Cancel(id)
+	l.audit(vm, trigger, "cancel-job", id, err)
+	return err
+}
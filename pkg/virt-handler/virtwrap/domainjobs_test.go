@@ -0,0 +1,74 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/jobs"
+)
+
+var _ = Describe("Domain jobs", func() {
+	var manager *LibvirtDomainManager
+
+	BeforeEach(func() {
+		manager = &LibvirtDomainManager{jobs: jobs.NewJobManager()}
+	})
+
+	It("should only list and cancel the jobs of the VM", func() {
+		release := make(chan struct{})
+		run := func(progress func(percent uint)) error {
+			<-release
+			return nil
+		}
+		cancel := func() error {
+			close(release)
+			return nil
+		}
+		id, err := manager.startJob(newVM("default", "testvm"), jobs.MemoryDump, run, cancel)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(manager.ListJobs(newVM("default", "testvm"))).To(HaveLen(1))
+		Expect(manager.ListJobs(newVM("default", "othervm"))).To(BeEmpty())
+		Expect(manager.CancelJob(newVM("default", "othervm"), id, TriggerVMController)).ToNot(Succeed())
+		Expect(manager.CancelJob(newVM("default", "testvm"), id, TriggerVMController)).To(Succeed())
+		Eventually(func() jobs.JobPhase {
+			return manager.ListJobs(newVM("default", "testvm"))[0].Phase
+		}).Should(Equal(jobs.Cancelled))
+	})
+
+	It("should forget the finished jobs of the domain when a new one starts", func() {
+		done := func(progress func(percent uint)) error {
+			return nil
+		}
+		first, err := manager.startJob(newVM("default", "testvm"), jobs.MemoryDump, done, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(func() bool {
+			job, _ := manager.jobs.Get(first)
+			return job.IsFinished()
+		}).Should(BeTrue())
+
+		_, err = manager.startJob(newVM("default", "testvm"), jobs.MemoryDump, done, nil)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = manager.jobs.Get(first)
+		Expect(err).To(HaveOccurred())
+	})
+})
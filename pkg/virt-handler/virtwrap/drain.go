@@ -0,0 +1,192 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/net/context"
+	"k8s.io/apimachinery/pkg/util/errors"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cache"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+type DrainStep string
+
+const (
+	DrainMigrating    DrainStep = "Migrating"
+	DrainMigrated     DrainStep = "Migrated"
+	DrainShuttingDown DrainStep = "ShuttingDown"
+	DrainShutDown     DrainStep = "ShutDown"
+	DrainDestroyed    DrainStep = "Destroyed"
+	DrainSkipped      DrainStep = "Skipped"
+	DrainFailed       DrainStep = "Failed"
+)
+
+// IsFinal returns whether the guest is done with the step.
+func (s DrainStep) IsFinal() bool {
+	return s != DrainMigrating && s != DrainShuttingDown
+}
+
+// DrainPolicy decides how the guests of a node are stopped. Every guest is
+// migrated if possible, else shut down gracefully, and destroyed if it does
+// not shut down within the grace period.
+type DrainPolicy struct {
+	// Migrate moves the guest to another node and returns once the guest
+	// left. Guests are not migrated if it is nil.
+	Migrate func(vm *v1.VirtualMachine) error
+	// GracePeriod guests get to shut down, zero destroys them right away
+	GracePeriod time.Duration
+	// Progress is called whenever a guest reaches the next step
+	Progress func(DrainProgress)
+}
+
+type DrainProgress struct {
+	Guest string
+	Step  DrainStep
+	// Number of guests which are done, and of all guests
+	Done  int
+	Total int
+	Error error
+}
+
+// DrainGuests drives all running guests of the node off the node, one after
+// the other. Guests which fail to drain are reported and skipped, all of
+// their errors are returned at the end. Adopted guests are left alone.
+// Migrations run outside of the queue of the domain, so that the migration
+// can still be tuned or aborted while it runs.
+func (l *LibvirtDomainManager) DrainGuests(policy DrainPolicy) error {
+	doms, err := l.virConn.ListAllDomains(libvirt.CONNECT_LIST_DOMAINS_ACTIVE)
+	if err != nil {
+		logging.DefaultLogger().Error().Reason(err).Msg("Listing the domains failed.")
+		return err
+	}
+	vms := make([]*v1.VirtualMachine, 0, len(doms))
+	for i, dom := range doms {
+		domain, err := cache.NewDomain(dom)
+		if err != nil {
+			logging.DefaultLogger().Error().Reason(err).Msg("Reading the domain failed.")
+			for _, dom := range doms[i:] {
+				dom.Free()
+			}
+			return err
+		}
+		dom.Free()
+		vms = append(vms, v1.NewVMReferenceFromNameWithNS(domain.ObjectMeta.Namespace, domain.ObjectMeta.Name))
+	}
+
+	report := func(vm *v1.VirtualMachine, step DrainStep, done int, err error) {
+		if policy.Progress != nil {
+			policy.Progress(DrainProgress{Guest: cache.VMNamespaceKeyFunc(vm), Step: step, Done: done, Total: len(vms), Error: err})
+		}
+	}
+
+	errs := []error{}
+	for i, vm := range vms {
+		if l.IsAdopted(vm) {
+			report(vm, DrainSkipped, i+1, nil)
+			continue
+		}
+		reportStep := func(step DrainStep) {
+			done := i
+			if step.IsFinal() {
+				done++
+			}
+			report(vm, step, done, nil)
+		}
+		if l.migrateGuest(vm, policy, reportStep) {
+			continue
+		}
+		err := l.runOnDomain(vm, func() error {
+			return l.stopGuest(vm, policy, reportStep)
+		})
+		if err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Draining the guest failed.")
+			report(vm, DrainFailed, i+1, err)
+			errs = append(errs, fmt.Errorf("draining %s failed: %v", cache.VMNamespaceKeyFunc(vm), err))
+		}
+	}
+	return errors.NewAggregate(errs)
+}
+
+// migrateGuest returns whether the guest was migrated away.
+func (l *LibvirtDomainManager) migrateGuest(vm *v1.VirtualMachine, policy DrainPolicy, report func(DrainStep)) bool {
+	if policy.Migrate == nil {
+		return false
+	}
+	report(DrainMigrating)
+	err := policy.Migrate(vm)
+	l.audit(vm, TriggerDrain, "migrate", nil, err)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Info().Reason(err).Msg("Migrating the guest failed, stopping it.")
+		return false
+	}
+	logging.DefaultLogger().Object(vm).Info().Msg("Guest migrated away.")
+	report(DrainMigrated)
+	return true
+}
+
+// stopGuest reports the final step of a guest itself, except for failures.
+func (l *LibvirtDomainManager) stopGuest(vm *v1.VirtualMachine, policy DrainPolicy, report func(DrainStep)) error {
+	dom, err := l.virConn.LookupDomainByName(cache.VMNamespaceKeyFunc(vm))
+	if err != nil {
+		return err
+	}
+	defer dom.Free()
+
+	if policy.GracePeriod > 0 {
+		report(DrainShuttingDown)
+		err := dom.Shutdown()
+		l.audit(vm, TriggerDrain, "shutdown", nil, err)
+		if err != nil {
+			logging.DefaultLogger().Object(vm).Info().Reason(err).Msg("Shutting down the guest failed, destroying it.")
+		} else if l.shutOff(dom, cache.VMNamespaceKeyFunc(vm), policy.GracePeriod) {
+			logging.DefaultLogger().Object(vm).Info().Msg("Guest shut down.")
+			report(DrainShutDown)
+			return nil
+		} else {
+			logging.DefaultLogger().Object(vm).Info().Msgf("Guest did not shut down within %v, destroying it.", policy.GracePeriod)
+		}
+	}
+
+	err = dom.Destroy()
+	l.audit(vm, TriggerDrain, "destroy", nil, err)
+	if err != nil {
+		return err
+	}
+	logging.DefaultLogger().Object(vm).Info().Msg("Guest destroyed.")
+	report(DrainDestroyed)
+	return nil
+}
+
+// shutOff waits until the domain is off or the timeout passed. SHUTDOWN
+// means that the guest is still on its way down.
+func (l *LibvirtDomainManager) shutOff(dom cli.VirDomain, name string, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	_, err := l.waitForDomainState(ctx, dom, name, api.Shutoff)
+	return err == nil
+}
@@ -0,0 +1,185 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Draining guests", func() {
+	var ctrl *gomock.Controller
+	var mockConn *cli.MockConnection
+	var manager *LibvirtDomainManager
+	var originalPollInterval time.Duration
+	var progress []DrainProgress
+
+	expectListed := func(names ...string) {
+		doms := []cli.VirDomain{}
+		for _, name := range names {
+			dom := cli.NewMockVirDomain(ctrl)
+			dom.EXPECT().GetName().Return(name, nil)
+			dom.EXPECT().GetUUIDString().Return("1234", nil)
+			dom.EXPECT().Free()
+			doms = append(doms, dom)
+		}
+		mockConn.EXPECT().ListAllDomains(libvirt.CONNECT_LIST_DOMAINS_ACTIVE).Return(doms, nil)
+	}
+
+	expectLookup := func(name string) *cli.MockVirDomain {
+		dom := cli.NewMockVirDomain(ctrl)
+		mockConn.EXPECT().LookupDomainByName(name).Return(dom, nil)
+		dom.EXPECT().Free()
+		return dom
+	}
+
+	policy := func(migrate func(vm *v1.VirtualMachine) error, gracePeriod time.Duration) DrainPolicy {
+		return DrainPolicy{
+			Migrate:     migrate,
+			GracePeriod: gracePeriod,
+			Progress: func(p DrainProgress) {
+				progress = append(progress, p)
+			},
+		}
+	}
+
+	failingMigration := func(vm *v1.VirtualMachine) error {
+		return fmt.Errorf("no migration target")
+	}
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockConn = cli.NewMockConnection(ctrl)
+		manager = &LibvirtDomainManager{
+			virConn:        mockConn,
+			adoptedDomains: make(map[string]string),
+		}
+		originalPollInterval = stateWaitPollInterval
+		stateWaitPollInterval = 10 * time.Millisecond
+		progress = nil
+	})
+
+	It("should migrate guests if possible", func() {
+		expectListed("default_testvm")
+
+		migrated := []string{}
+		migrate := func(vm *v1.VirtualMachine) error {
+			migrated = append(migrated, vm.GetObjectMeta().GetName())
+			return nil
+		}
+		Expect(manager.DrainGuests(policy(migrate, time.Minute))).To(Succeed())
+		Expect(migrated).To(Equal([]string{"testvm"}))
+		Expect(progress).To(Equal([]DrainProgress{
+			{Guest: "default_testvm", Step: DrainMigrating, Done: 0, Total: 1},
+			{Guest: "default_testvm", Step: DrainMigrated, Done: 1, Total: 1},
+		}))
+		trail := manager.GetAuditTrail(newVM("default", "testvm"))
+		Expect(trail).To(HaveLen(1))
+		Expect(trail[0].Operation).To(Equal("migrate"))
+		Expect(trail[0].Trigger).To(Equal(TriggerDrain))
+	})
+
+	It("should not hold the queue of the domain while migrating", func() {
+		expectListed("default_testvm")
+
+		migrate := func(vm *v1.VirtualMachine) error {
+			tuned := make(chan error)
+			go func() {
+				tuned <- manager.runOnDomain(vm, func() error { return nil })
+			}()
+			select {
+			case err := <-tuned:
+				return err
+			case <-time.After(time.Second):
+				return fmt.Errorf("the queue of the domain is blocked")
+			}
+		}
+		Expect(manager.DrainGuests(policy(migrate, time.Minute))).To(Succeed())
+		Expect(progress[len(progress)-1].Step).To(Equal(DrainMigrated))
+	})
+
+	It("should free all domains if one can't be read", func() {
+		broken := cli.NewMockVirDomain(ctrl)
+		broken.EXPECT().GetName().Return("", libvirt.Error{Code: libvirt.ERR_NO_DOMAIN})
+		broken.EXPECT().Free()
+		other := cli.NewMockVirDomain(ctrl)
+		other.EXPECT().Free()
+		mockConn.EXPECT().ListAllDomains(libvirt.CONNECT_LIST_DOMAINS_ACTIVE).Return([]cli.VirDomain{broken, other}, nil)
+
+		Expect(manager.DrainGuests(policy(nil, 0))).ToNot(Succeed())
+	})
+
+	It("should shut down guests which can't be migrated", func() {
+		expectListed("default_testvm")
+		dom := expectLookup("default_testvm")
+		dom.EXPECT().Shutdown().Return(nil)
+		gomock.InOrder(
+			dom.EXPECT().GetState().Return(libvirt.DOMAIN_SHUTDOWN, 1, nil),
+			dom.EXPECT().GetState().Return(libvirt.DOMAIN_SHUTOFF, 1, nil),
+		)
+
+		Expect(manager.DrainGuests(policy(failingMigration, time.Minute))).To(Succeed())
+		Expect(progress[len(progress)-1]).To(Equal(DrainProgress{Guest: "default_testvm", Step: DrainShutDown, Done: 1, Total: 1}))
+	})
+
+	It("should destroy guests which don't shut down in time", func() {
+		expectListed("default_testvm")
+		dom := expectLookup("default_testvm")
+		dom.EXPECT().Shutdown().Return(nil)
+		dom.EXPECT().GetState().Return(libvirt.DOMAIN_RUNNING, 1, nil).AnyTimes()
+		dom.EXPECT().Destroy().Return(nil)
+
+		Expect(manager.DrainGuests(policy(nil, 50*time.Millisecond))).To(Succeed())
+		Expect(progress[len(progress)-1].Step).To(Equal(DrainDestroyed))
+	})
+
+	It("should drain the other guests if one fails", func() {
+		expectListed("default_testvm", "default_othervm")
+		expectLookup("default_testvm").EXPECT().Destroy().Return(libvirt.Error{Code: libvirt.ERR_OPERATION_FAILED})
+		expectLookup("default_othervm").EXPECT().Destroy().Return(nil)
+
+		Expect(manager.DrainGuests(policy(nil, 0))).ToNot(Succeed())
+		Expect(progress).To(HaveLen(2))
+		Expect(progress[0].Step).To(Equal(DrainFailed))
+		Expect(progress[0].Error).To(HaveOccurred())
+		Expect(progress[1]).To(Equal(DrainProgress{Guest: "default_othervm", Step: DrainDestroyed, Done: 2, Total: 2}))
+	})
+
+	It("should leave adopted guests alone", func() {
+		expectListed("legacy_db")
+		manager.adoptedDomains["legacy_db"] = "legacy_db"
+
+		Expect(manager.DrainGuests(policy(nil, 0))).To(Succeed())
+		Expect(progress).To(Equal([]DrainProgress{{Guest: "legacy_db", Step: DrainSkipped, Done: 1, Total: 1}}))
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+		stateWaitPollInterval = originalPollInterval
+	})
+})
@@ -20,13 +20,80 @@
 package errors
 
 import (
-	"github.com/libvirt/libvirt-go"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
 )
 
+// HypervisorError is a libvirt error with its error domain, code and message
+// exposed, so that callers don't have to look at error strings.
+type HypervisorError struct {
+	err libvirt.Error
+}
+
+// NewHypervisorError turns libvirt errors into a HypervisorError. All other
+// errors, including nil, are returned unchanged.
+func NewHypervisorError(err error) error {
+	if libvirtError, ok := err.(libvirt.Error); ok {
+		return &HypervisorError{err: libvirtError}
+	}
+	return err
+}
+
+// AsHypervisorError returns err as HypervisorError, if it is a HypervisorError
+// or a plain libvirt error.
+func AsHypervisorError(err error) (*HypervisorError, bool) {
+	switch e := err.(type) {
+	case *HypervisorError:
+		return e, true
+	case libvirt.Error:
+		return &HypervisorError{err: e}, true
+	}
+	return nil, false
+}
+
+func (e *HypervisorError) Error() string {
+	return e.err.Error()
+}
+
+// Code is the libvirt error code, e.g. ERR_NO_DOMAIN.
+func (e *HypervisorError) Code() libvirt.ErrorNumber {
+	return e.err.Code
+}
+
+// Domain is the part of libvirt which raised the error, e.g. FROM_QEMU.
+func (e *HypervisorError) Domain() libvirt.ErrorDomain {
+	return e.err.Domain
+}
+
+// Message is the error message without code and domain.
+func (e *HypervisorError) Message() string {
+	return e.err.Message
+}
+
+// IsRetryable tells if the same call might succeed when it is tried again
+// later, because the error was caused by a busy or unreachable hypervisor or
+// guest agent.
+func (e *HypervisorError) IsRetryable() bool {
+	switch e.err.Code {
+	case libvirt.ERR_OPERATION_TIMEOUT,
+		libvirt.ERR_AGENT_UNRESPONSIVE,
+		libvirt.ERR_RESOURCE_BUSY,
+		libvirt.ERR_RPC,
+		libvirt.ERR_NO_CONNECT,
+		libvirt.ERR_INVALID_CONN:
+		return true
+	}
+	return false
+}
+
+// Unwrap returns the original libvirt error.
+func (e *HypervisorError) Unwrap() error {
+	return e.err
+}
+
 func checkError(err error, expectedError libvirt.ErrorNumber) bool {
-	libvirtError, ok := err.(libvirt.Error)
+	hypervisorError, ok := AsHypervisorError(err)
 	if ok {
-		return libvirtError.Code == expectedError
+		return hypervisorError.Code() == expectedError
 	}
 
 	return false
@@ -37,6 +104,39 @@ func IsNotFound(err error) bool {
 	return checkError(err, libvirt.ERR_NO_DOMAIN)
 }
 
+// IsSecretNotFound detects libvirt's ERR_NO_SECRET.
+func IsSecretNotFound(err error) bool {
+	return checkError(err, libvirt.ERR_NO_SECRET)
+}
+
+// IsRetryable tells if err is a libvirt error which might go away when the
+// call is tried again.
+func IsRetryable(err error) bool {
+	hypervisorError, ok := AsHypervisorError(err)
+	return ok && hypervisorError.IsRetryable()
+}
+
+// IsStoragePoolNotFound detects libvirt's ERR_NO_STORAGE_POOL.
+func IsStoragePoolNotFound(err error) bool {
+	return checkError(err, libvirt.ERR_NO_STORAGE_POOL)
+}
+
+// IsStorageVolNotFound detects libvirt's ERR_NO_STORAGE_VOL.
+func IsStorageVolNotFound(err error) bool {
+	return checkError(err, libvirt.ERR_NO_STORAGE_VOL)
+}
+
+// IsMetadataNotFound detects libvirt's ERR_NO_DOMAIN_METADATA.
+func IsMetadataNotFound(err error) bool {
+	return checkError(err, libvirt.ERR_NO_DOMAIN_METADATA)
+}
+
+// IsInvalidOperation detects libvirt's ERR_OPERATION_INVALID, e.g. when
+// aborting a job of a domain which has no job.
+func IsInvalidOperation(err error) bool {
+	return checkError(err, libvirt.ERR_OPERATION_INVALID)
+}
+
 // IsOk detects libvirt's ERR_OK. It accepts both error and libvirt.Error (as returned by GetLastError function).
 func IsOk(err error) bool {
 	return checkError(err, libvirt.ERR_OK)
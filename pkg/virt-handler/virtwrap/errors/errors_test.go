@@ -0,0 +1,62 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package errors_test
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/errors"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Errors", func() {
+	It("should expose the details of libvirt errors", func() {
+		err := errors.NewHypervisorError(libvirt.Error{Code: libvirt.ERR_NO_DOMAIN, Domain: libvirt.FROM_QEMU, Message: "Domain not found"})
+		hypervisorError, ok := err.(*errors.HypervisorError)
+		Expect(ok).To(BeTrue())
+		Expect(hypervisorError.Code()).To(Equal(libvirt.ERR_NO_DOMAIN))
+		Expect(hypervisorError.Domain()).To(Equal(libvirt.FROM_QEMU))
+		Expect(hypervisorError.Message()).To(Equal("Domain not found"))
+		Expect(hypervisorError.IsRetryable()).To(BeFalse())
+		Expect(hypervisorError.Unwrap()).To(Equal(libvirt.Error{Code: libvirt.ERR_NO_DOMAIN, Domain: libvirt.FROM_QEMU, Message: "Domain not found"}))
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("should leave other errors alone", func() {
+		Expect(errors.NewHypervisorError(nil)).To(BeNil())
+		err := fmt.Errorf("not from libvirt")
+		Expect(errors.NewHypervisorError(err)).To(Equal(err))
+		Expect(errors.IsNotFound(err)).To(BeFalse())
+	})
+
+	It("should detect plain libvirt errors", func() {
+		Expect(errors.IsNotFound(libvirt.Error{Code: libvirt.ERR_NO_DOMAIN})).To(BeTrue())
+		Expect(errors.IsSecretNotFound(libvirt.Error{Code: libvirt.ERR_NO_SECRET})).To(BeTrue())
+	})
+
+	It("should consider timeouts retryable", func() {
+		Expect(errors.IsRetryable(libvirt.Error{Code: libvirt.ERR_OPERATION_TIMEOUT})).To(BeTrue())
+		Expect(errors.IsRetryable(libvirt.Error{Code: libvirt.ERR_OPERATION_INVALID})).To(BeFalse())
+		Expect(errors.IsRetryable(fmt.Errorf("timeout"))).To(BeFalse())
+	})
+})
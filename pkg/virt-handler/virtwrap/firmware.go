@@ -0,0 +1,126 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cache"
+)
+
+const (
+	ovmfCode           = "/usr/share/OVMF/OVMF_CODE.fd"
+	ovmfSecureBootCode = "/usr/share/OVMF/OVMF_CODE.secboot.fd"
+	ovmfVarsTemplate   = "/usr/share/OVMF/OVMF_VARS.fd"
+	aavmfCode          = "/usr/share/AAVMF/AAVMF_CODE.fd"
+	aavmfVarsTemplate  = "/usr/share/AAVMF/AAVMF_VARS.fd"
+)
+
+// libvirt creates the NVRAM of a domain from the template on the first start.
+// Domains are undefined with DOMAIN_UNDEFINE_KEEP_NVRAM, so that the UEFI
+// variables survive restarts of the VM, and we remove the NVRAM through the
+// libvirt data directory once the VM is deleted.
+var nvramRoot = "/var/lib/libvirt/qemu/nvram"
+
+func nvramPath(vm *v1.VirtualMachine) string {
+	return filepath.Join(nvramRoot, cache.VMNamespaceKeyFunc(vm)+"_VARS.fd")
+}
+
+// removeNVRAM removes the NVRAM of the VM. It is not an error if the VM never
+// had one.
+func removeNVRAM(vm *v1.VirtualMachine) error {
+	if err := os.Remove(nvramPath(vm)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// prepareFirmware fills in the UEFI defaults of the guest architecture, OVMF
+// on x86_64 and AAVMF on aarch64. aarch64 guests always boot through UEFI.
+// Guests with a pflash loader get their own NVRAM file and Secure Boot on
+// x86_64 additionally requires SMM, which is only available on q35 machines.
+func prepareFirmware(vm *v1.VirtualMachine, spec *api.DomainSpec) error {
+	defaults := defaultsForArch(spec.OS.Type.Arch)
+	if spec.OS.Loader == nil && defaults.UEFIRequired {
+		spec.OS.Loader = &api.Loader{}
+	}
+	loader := spec.OS.Loader
+	if loader == nil {
+		return nil
+	}
+	if defaults.UEFICode == "" {
+		return fmt.Errorf("UEFI is not supported on %s", spec.OS.Type.Arch)
+	}
+	secure := loader.Secure == "yes"
+	if secure && defaults.UEFISecureBootCode == "" {
+		return fmt.Errorf("secure boot is not supported on %s", spec.OS.Type.Arch)
+	}
+
+	if loader.Type == "" {
+		loader.Type = "pflash"
+	}
+	if secure && loader.Type != "pflash" {
+		return fmt.Errorf("secure boot requires a pflash loader")
+	}
+	if loader.Type != "pflash" {
+		return nil
+	}
+
+	if loader.ReadOnly == "" {
+		loader.ReadOnly = "yes"
+	}
+	if loader.Path == "" {
+		if secure {
+			loader.Path = defaults.UEFISecureBootCode
+		} else {
+			loader.Path = defaults.UEFICode
+		}
+	}
+
+	if spec.OS.NVRam == nil {
+		spec.OS.NVRam = &api.NVRam{}
+	}
+	if spec.OS.NVRam.NVRam == "" {
+		spec.OS.NVRam.NVRam = nvramPath(vm)
+	}
+	if spec.OS.NVRam.Template == "" {
+		spec.OS.NVRam.Template = defaults.UEFIVars
+	}
+
+	if !secure || !defaults.SMM {
+		return nil
+	}
+	if !strings.Contains(spec.OS.Type.Machine, "q35") {
+		return fmt.Errorf("secure boot requires a q35 machine type, got '%s'", spec.OS.Type.Machine)
+	}
+	if spec.Features == nil {
+		spec.Features = &api.Features{}
+	}
+	if spec.Features.SMM != nil && spec.Features.SMM.State == "off" {
+		return fmt.Errorf("secure boot requires SMM")
+	}
+	spec.Features.SMM = &api.FeatureState{State: "on"}
+	return nil
+}
@@ -0,0 +1,109 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+)
+
+var _ = Describe("Firmware", func() {
+	var spec *api.DomainSpec
+
+	BeforeEach(func() {
+		spec = api.NewMinimalDomainSpec("testvm")
+	})
+
+	It("should leave BIOS guests alone", func() {
+		Expect(prepareFirmware(newVM("default", "testvm"), spec)).To(Succeed())
+		Expect(spec.OS.Loader).To(BeNil())
+		Expect(spec.OS.NVRam).To(BeNil())
+	})
+
+	It("should default to OVMF with a per VM NVRAM", func() {
+		spec.OS.Loader = &api.Loader{}
+		Expect(prepareFirmware(newVM("default", "testvm"), spec)).To(Succeed())
+		Expect(*spec.OS.Loader).To(Equal(api.Loader{ReadOnly: "yes", Type: "pflash", Path: ovmfCode}))
+		Expect(*spec.OS.NVRam).To(Equal(api.NVRam{NVRam: "/var/lib/libvirt/qemu/nvram/default_testvm_VARS.fd", Template: ovmfVarsTemplate}))
+		Expect(spec.Features).To(BeNil())
+	})
+
+	It("should default to AAVMF on aarch64", func() {
+		spec.OS.Type.Arch = "aarch64"
+		Expect(prepareFirmware(newVM("default", "testvm"), spec)).To(Succeed())
+		Expect(*spec.OS.Loader).To(Equal(api.Loader{ReadOnly: "yes", Type: "pflash", Path: aavmfCode}))
+		Expect(spec.OS.NVRam.Template).To(Equal(aavmfVarsTemplate))
+		Expect(spec.Features).To(BeNil())
+	})
+
+	It("should reject Secure Boot on aarch64", func() {
+		spec.OS.Type.Arch = "aarch64"
+		spec.OS.Loader = &api.Loader{Secure: "yes"}
+		Expect(prepareFirmware(newVM("default", "testvm"), spec)).ToNot(Succeed())
+	})
+
+	It("should reject UEFI on s390x", func() {
+		spec.OS.Type.Arch = "s390x"
+		spec.OS.Loader = &api.Loader{}
+		Expect(prepareFirmware(newVM("default", "testvm"), spec)).ToNot(Succeed())
+	})
+
+	It("should enable SMM for Secure Boot", func() {
+		spec.OS.Type.Machine = "pc-q35-2.10"
+		spec.OS.Loader = &api.Loader{Secure: "yes"}
+		Expect(prepareFirmware(newVM("default", "testvm"), spec)).To(Succeed())
+		Expect(spec.OS.Loader.Path).To(Equal(ovmfSecureBootCode))
+		Expect(spec.Features.SMM.State).To(Equal("on"))
+	})
+
+	It("should reject Secure Boot on non q35 machines", func() {
+		spec.OS.Type.Machine = "pc-i440fx-2.10"
+		spec.OS.Loader = &api.Loader{Secure: "yes"}
+		Expect(prepareFirmware(newVM("default", "testvm"), spec)).ToNot(Succeed())
+	})
+
+	It("should reject Secure Boot with SMM disabled", func() {
+		spec.OS.Type.Machine = "q35"
+		spec.OS.Loader = &api.Loader{Secure: "yes"}
+		spec.Features = &api.Features{SMM: &api.FeatureState{State: "off"}}
+		Expect(prepareFirmware(newVM("default", "testvm"), spec)).ToNot(Succeed())
+	})
+
+	It("should remove the NVRAM once", func() {
+		tmpDir, err := ioutil.TempDir("", "nvram")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(tmpDir)
+		originalNVRAMRoot := nvramRoot
+		nvramRoot = tmpDir
+		defer func() { nvramRoot = originalNVRAMRoot }()
+
+		vm := newVM("default", "testvm")
+		Expect(ioutil.WriteFile(filepath.Join(tmpDir, "default_testvm_VARS.fd"), []byte("vars"), 0600)).To(Succeed())
+		Expect(removeNVRAM(vm)).To(Succeed())
+		Expect(filepath.Join(tmpDir, "default_testvm_VARS.fd")).ToNot(BeAnExistingFile())
+		Expect(removeNVRAM(vm)).To(Succeed())
+	})
+})
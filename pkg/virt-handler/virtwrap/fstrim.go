@@ -0,0 +1,211 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package virtwrap
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	kubecache "k8s.io/client-go/tools/cache"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cache"
+)
+
+const DefaultFSTrimCheckInterval = 1 * time.Minute
+
+// Scheduled trims which run at once, and the time after which a trim is
+// considered hung and no longer takes up one of them.
+const (
+	DefaultFSTrimConcurrency = 4
+	DefaultFSTrimTimeout     = 10 * time.Minute
+)
+
+var discardModes = map[string]bool{
+	"unmap":  true,
+	"ignore": true,
+}
+
+// prepareDiscard makes sure that disks only ask for discard modes qemu knows.
+func prepareDiscard(spec *api.DomainSpec) error {
+	for _, disk := range spec.Devices.Disks {
+		if disk.Driver == nil || disk.Driver.Discard == "" {
+			continue
+		}
+		if !discardModes[disk.Driver.Discard] {
+			return fmt.Errorf("disk %s has the unsupported discard mode %s", disk.Target.Device, disk.Driver.Discard)
+		}
+	}
+	return nil
+}
+
+// FSTrim makes the guest agent trim all mounted filesystems of the guest.
+// The space is only given back to the storage for disks with the discard
+// mode unmap.
+func (l *LibvirtDomainManager) FSTrim(vm *v1.VirtualMachine, trigger Trigger) error {
+	connected, err := l.AgentConnected(vm)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Checking the guest agent failed.")
+		return err
+	}
+	if !connected {
+		return fmt.Errorf("the guest agent is not connected")
+	}
+
+	return l.runOnDomain(vm, func() error {
+		dom, err := l.virConn.LookupDomainByName(cache.VMNamespaceKeyFunc(vm))
+		if err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain failed.")
+			return err
+		}
+		defer dom.Free()
+
+		// No mountpoint means all filesystems, no minimum means all free extents
+		err = dom.FSTrim("", 0, 0)
+		l.audit(vm, trigger, "fstrim", nil, err)
+		if err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Trimming the guest filesystems failed.")
+			return err
+		}
+		logging.DefaultLogger().Object(vm).Info().V(3).Msg("Trimmed the guest filesystems.")
+		return nil
+	})
+}
+
+// FSTrimScheduler trims the filesystems of all running VMs which have the
+// FSTrimIntervalAnnotation in the given interval. The first trim of a VM
+// happens one interval after the scheduler saw it, so that restarts of
+// virt-handler don't trim all guests at once.
+//
+// Trims run in the background, at most DefaultFSTrimConcurrency at once.
+// libvirt waits on the guest agent without a timeout, so a trim which takes
+// longer than DefaultFSTrimTimeout gives its slot to the other VMs, and the
+// VM is not trimmed again before the hung trim returned.
+type FSTrimScheduler struct {
+	domainManager DomainManager
+	vmStore       kubecache.Store
+	checkInterval time.Duration
+	trimTimeout   time.Duration
+	lastTrims     map[string]time.Time
+	now           func() time.Time
+	slots         chan struct{}
+	lock          sync.Mutex
+	running       map[string]bool
+	trims         sync.WaitGroup
+}
+
+func NewFSTrimScheduler(domainManager DomainManager, vmStore kubecache.Store, checkInterval time.Duration) *FSTrimScheduler {
+	return &FSTrimScheduler{
+		domainManager: domainManager,
+		vmStore:       vmStore,
+		checkInterval: checkInterval,
+		trimTimeout:   DefaultFSTrimTimeout,
+		lastTrims:     make(map[string]time.Time),
+		now:           time.Now,
+		slots:         make(chan struct{}, DefaultFSTrimConcurrency),
+		running:       make(map[string]bool),
+	}
+}
+
+// Run looks for VMs which are due to be trimmed every check interval until
+// stopChan is closed.
+func (s *FSTrimScheduler) Run(stopChan chan struct{}) {
+	wait.Until(s.TrimDue, s.checkInterval, stopChan)
+}
+
+// TrimDue starts trimming the filesystems of all VMs whose interval passed
+// since their last trim. A failed trim is only tried again after the next
+// interval. VMs which find no free slot are trimmed on a later check.
+func (s *FSTrimScheduler) TrimDue() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := s.now()
+	seen := map[string]bool{}
+	for _, obj := range s.vmStore.List() {
+		vm := obj.(*v1.VirtualMachine)
+		value, exists := vm.GetObjectMeta().GetAnnotations()[v1.FSTrimIntervalAnnotation]
+		if !exists || !vm.IsRunning() {
+			continue
+		}
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval <= 0 {
+			logging.DefaultLogger().Object(vm).Warning().Msgf("Invalid fstrim interval %s.", value)
+			continue
+		}
+
+		name := cache.VMNamespaceKeyFunc(vm)
+		seen[name] = true
+		last, known := s.lastTrims[name]
+		if !known {
+			s.lastTrims[name] = now
+			continue
+		}
+		if now.Sub(last) < interval || s.running[name] {
+			continue
+		}
+		select {
+		case s.slots <- struct{}{}:
+		default:
+			continue
+		}
+		s.lastTrims[name] = now
+		s.running[name] = true
+		s.trims.Add(1)
+		go s.trim(vm, name)
+	}
+
+	for name := range s.lastTrims {
+		if !seen[name] {
+			delete(s.lastTrims, name)
+		}
+	}
+}
+
+// trim runs the trim of a VM in one of the slots of the scheduler.
+func (s *FSTrimScheduler) trim(vm *v1.VirtualMachine, name string) {
+	defer s.trims.Done()
+	done := make(chan error, 1)
+	go func() {
+		done <- s.domainManager.FSTrim(vm, TriggerFSTrimScheduler)
+	}()
+
+	timeout := time.NewTimer(s.trimTimeout)
+	defer timeout.Stop()
+	var err error
+	select {
+	case err = <-done:
+		<-s.slots
+	case <-timeout.C:
+		// libvirt can't abort the trim, only free the slot
+		<-s.slots
+		logging.DefaultLogger().Object(vm).Warning().Msgf("Scheduled fstrim did not finish within %s.", s.trimTimeout)
+		err = <-done
+	}
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Scheduled fstrim failed.")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.running, name)
+}
@@ -0,0 +1,181 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package virtwrap
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/client-go/tools/cache"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+)
+
+var _ = Describe("FSTrim", func() {
+	var ctrl *gomock.Controller
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+	})
+
+	It("should only accept known discard modes", func() {
+		spec := api.NewMinimalDomainSpec("testvm")
+		spec.Devices.Disks = []api.Disk{{Target: api.DiskTarget{Device: "vda"}, Driver: &api.DiskDriver{Name: "qemu", Type: "raw", Discard: "unmap"}}}
+		Expect(prepareDiscard(spec)).To(Succeed())
+		spec.Devices.Disks[0].Driver.Discard = "trim"
+		Expect(prepareDiscard(spec)).ToNot(Succeed())
+	})
+
+	It("should trim all filesystems through the guest agent", func() {
+		mockConn := cli.NewMockConnection(ctrl)
+		mockDomain := cli.NewMockVirDomain(ctrl)
+		manager := &LibvirtDomainManager{virConn: mockConn}
+		manager.agentStates.set("default_testvm", true)
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+		mockDomain.EXPECT().FSTrim("", uint64(0), uint32(0)).Return(nil)
+		mockDomain.EXPECT().Free()
+
+		vm := newVM("default", "testvm")
+		Expect(manager.FSTrim(vm, TriggerFSTrimScheduler)).To(Succeed())
+		Expect(manager.GetAuditTrail(vm)[0].Operation).To(Equal("fstrim"))
+	})
+
+	It("should not trim without a connected guest agent", func() {
+		manager := &LibvirtDomainManager{virConn: cli.NewMockConnection(ctrl)}
+		manager.agentStates.set("default_testvm", false)
+		Expect(manager.FSTrim(newVM("default", "testvm"), TriggerFSTrimScheduler)).ToNot(Succeed())
+	})
+
+	Context("scheduler", func() {
+		var mockManager *MockDomainManager
+		var vmStore cache.Store
+		var scheduler *FSTrimScheduler
+		var now time.Time
+
+		newTrimmedVM := func(name string, interval string) *v1.VirtualMachine {
+			vm := newVM("default", name)
+			vm.Status.Phase = v1.Running
+			if interval != "" {
+				vm.ObjectMeta.Annotations = map[string]string{v1.FSTrimIntervalAnnotation: interval}
+			}
+			return vm
+		}
+
+		BeforeEach(func() {
+			mockManager = NewMockDomainManager(ctrl)
+			vmStore = cache.NewStore(cache.DeletionHandlingMetaNamespaceKeyFunc)
+			scheduler = NewFSTrimScheduler(mockManager, vmStore, DefaultFSTrimCheckInterval)
+			now = time.Now()
+			scheduler.now = func() time.Time { return now }
+		})
+
+		It("should trim VMs once their interval passed", func() {
+			vm := newTrimmedVM("testvm", "1h")
+			vmStore.Add(vm)
+			vmStore.Add(newTrimmedVM("othervm", ""))
+
+			// The interval starts when the VM is seen first
+			scheduler.TrimDue()
+			now = now.Add(30 * time.Minute)
+			scheduler.TrimDue()
+
+			now = now.Add(30 * time.Minute)
+			mockManager.EXPECT().FSTrim(vm, TriggerFSTrimScheduler).Return(nil)
+			scheduler.TrimDue()
+			scheduler.trims.Wait()
+
+			now = now.Add(30 * time.Minute)
+			scheduler.TrimDue()
+		})
+
+		It("should wait for the next interval after a failed trim", func() {
+			vm := newTrimmedVM("testvm", "1h")
+			vmStore.Add(vm)
+			scheduler.TrimDue()
+
+			now = now.Add(time.Hour)
+			mockManager.EXPECT().FSTrim(vm, TriggerFSTrimScheduler).Return(fmt.Errorf("the guest agent is not connected"))
+			scheduler.TrimDue()
+			scheduler.trims.Wait()
+			now = now.Add(time.Minute)
+			scheduler.TrimDue()
+		})
+
+		It("should not trim a VM again while its trim hangs", func() {
+			vm := newTrimmedVM("testvm", "1h")
+			vmStore.Add(vm)
+			scheduler.trimTimeout = 10 * time.Millisecond
+			scheduler.TrimDue()
+
+			hang := make(chan struct{})
+			now = now.Add(time.Hour)
+			mockManager.EXPECT().FSTrim(vm, TriggerFSTrimScheduler).Do(func(_ *v1.VirtualMachine, _ Trigger) {
+				<-hang
+			}).Return(nil)
+			scheduler.TrimDue()
+
+			// The hung trim gives its slot back
+			Eventually(func() int { return len(scheduler.slots) }).Should(BeZero())
+			now = now.Add(time.Hour)
+			scheduler.TrimDue()
+
+			close(hang)
+			scheduler.trims.Wait()
+			Expect(scheduler.running).To(BeEmpty())
+		})
+
+		It("should run at most DefaultFSTrimConcurrency trims at once", func() {
+			hang := make(chan struct{})
+			mockManager.EXPECT().FSTrim(gomock.Any(), TriggerFSTrimScheduler).Do(func(_ *v1.VirtualMachine, _ Trigger) {
+				<-hang
+			}).Return(nil).Times(DefaultFSTrimConcurrency)
+			for i := 0; i <= DefaultFSTrimConcurrency; i++ {
+				vmStore.Add(newTrimmedVM(fmt.Sprintf("testvm%d", i), "1h"))
+			}
+			scheduler.TrimDue()
+			now = now.Add(time.Hour)
+			scheduler.TrimDue()
+			Expect(scheduler.running).To(HaveLen(DefaultFSTrimConcurrency))
+
+			close(hang)
+			scheduler.trims.Wait()
+		})
+
+		It("should skip VMs with invalid intervals and VMs which are not running", func() {
+			vmStore.Add(newTrimmedVM("testvm", "often"))
+			stopped := newTrimmedVM("othervm", "1h")
+			stopped.Status.Phase = v1.Succeeded
+			vmStore.Add(stopped)
+
+			scheduler.TrimDue()
+			now = now.Add(2 * time.Hour)
+			scheduler.TrimDue()
+			Expect(scheduler.lastTrims).To(BeEmpty())
+		})
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+})
@@ -4,10 +4,15 @@
 package virtwrap
 
 import (
+	json "encoding/json"
 	gomock "github.com/golang/mock/gomock"
+	context "golang.org/x/net/context"
+	kubecache "k8s.io/client-go/tools/cache"
 
 	v1 "kubevirt.io/kubevirt/pkg/api/v1"
 	api "kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	cli "kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	jobs "kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/jobs"
 )
 
 // Mock of DomainManager interface
@@ -71,3 +76,351 @@ func (_m *MockDomainManager) KillVM(_param0 *v1.VirtualMachine) error {
 func (_mr *_MockDomainManagerRecorder) KillVM(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "KillVM", arg0)
 }
+
+func (_m *MockDomainManager) RemoveVMData(_param0 *v1.VirtualMachine) error {
+	ret := _m.ctrl.Call(_m, "RemoveVMData", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockDomainManagerRecorder) RemoveVMData(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "RemoveVMData", arg0)
+}
+
+func (_m *MockDomainManager) ReconcileExistingGuests(vmStore kubecache.Store) error {
+	ret := _m.ctrl.Call(_m, "ReconcileExistingGuests", vmStore)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockDomainManagerRecorder) ReconcileExistingGuests(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "ReconcileExistingGuests", arg0)
+}
+
+func (_m *MockDomainManager) GetJobInfo(_param0 *v1.VirtualMachine) (*api.DomainJobInfo, error) {
+	ret := _m.ctrl.Call(_m, "GetJobInfo", _param0)
+	ret0, _ := ret[0].(*api.DomainJobInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockDomainManagerRecorder) GetJobInfo(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetJobInfo", arg0)
+}
+
+func (_m *MockDomainManager) AbortJob(_param0 *v1.VirtualMachine) error {
+	ret := _m.ctrl.Call(_m, "AbortJob", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockDomainManagerRecorder) AbortJob(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "AbortJob", arg0)
+}
+
+func (_m *MockDomainManager) TuneMigration(_param0 *v1.VirtualMachine, _param1 *v1.MigrationOptions) error {
+	ret := _m.ctrl.Call(_m, "TuneMigration", _param0, _param1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockDomainManagerRecorder) TuneMigration(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "TuneMigration", arg0, arg1)
+}
+
+func (_m *MockDomainManager) GetDomainDevices(_param0 *v1.VirtualMachine) (*api.DomainDevices, error) {
+	ret := _m.ctrl.Call(_m, "GetDomainDevices", _param0)
+	ret0, _ := ret[0].(*api.DomainDevices)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockDomainManagerRecorder) GetDomainDevices(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetDomainDevices", arg0)
+}
+
+func (_m *MockDomainManager) GuestNetworkStatus(_param0 *v1.VirtualMachine) ([]v1.VMNetworkInterface, error) {
+	ret := _m.ctrl.Call(_m, "GuestNetworkStatus", _param0)
+	ret0, _ := ret[0].([]v1.VMNetworkInterface)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockDomainManagerRecorder) GuestNetworkStatus(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GuestNetworkStatus", arg0)
+}
+
+func (_m *MockDomainManager) GuestFilesystemInfo(_param0 *v1.VirtualMachine) ([]v1.VMFilesystem, error) {
+	ret := _m.ctrl.Call(_m, "GuestFilesystemInfo", _param0)
+	ret0, _ := ret[0].([]v1.VMFilesystem)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockDomainManagerRecorder) GuestFilesystemInfo(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GuestFilesystemInfo", arg0)
+}
+
+func (_m *MockDomainManager) FSTrim(vm *v1.VirtualMachine, trigger Trigger) error {
+	ret := _m.ctrl.Call(_m, "FSTrim", vm, trigger)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockDomainManagerRecorder) FSTrim(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "FSTrim", arg0, arg1)
+}
+
+func (_m *MockDomainManager) DumpCrashedGuest(_param0 *v1.VirtualMachine) (string, error) {
+	ret := _m.ctrl.Call(_m, "DumpCrashedGuest", _param0)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockDomainManagerRecorder) DumpCrashedGuest(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "DumpCrashedGuest", arg0)
+}
+
+func (_m *MockDomainManager) MemoryDump(vm *v1.VirtualMachine, path string, format string, trigger Trigger) (string, error) {
+	ret := _m.ctrl.Call(_m, "MemoryDump", vm, path, format, trigger)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockDomainManagerRecorder) MemoryDump(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "MemoryDump", arg0, arg1, arg2, arg3)
+}
+
+func (_m *MockDomainManager) SendKey(vm *v1.VirtualMachine, combination string, trigger Trigger) error {
+	ret := _m.ctrl.Call(_m, "SendKey", vm, combination, trigger)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockDomainManagerRecorder) SendKey(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SendKey", arg0, arg1, arg2)
+}
+
+func (_m *MockDomainManager) QemuMonitorCommand(vm *v1.VirtualMachine, command string, arguments map[string]interface{}) (json.RawMessage, error) {
+	ret := _m.ctrl.Call(_m, "QemuMonitorCommand", vm, command, arguments)
+	ret0, _ := ret[0].(json.RawMessage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockDomainManagerRecorder) QemuMonitorCommand(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "QemuMonitorCommand", arg0, arg1, arg2)
+}
+
+func (_m *MockDomainManager) MeasureDirtyRate(vm *v1.VirtualMachine, seconds int64) (uint64, error) {
+	ret := _m.ctrl.Call(_m, "MeasureDirtyRate", vm, seconds)
+	ret0, _ := ret[0].(uint64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockDomainManagerRecorder) MeasureDirtyRate(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "MeasureDirtyRate", arg0, arg1)
+}
+
+func (_m *MockDomainManager) IsAdopted(_param0 *v1.VirtualMachine) bool {
+	ret := _m.ctrl.Call(_m, "IsAdopted", _param0)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+func (_mr *_MockDomainManagerRecorder) IsAdopted(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "IsAdopted", arg0)
+}
+
+func (_m *MockDomainManager) DrainGuests(policy DrainPolicy) error {
+	ret := _m.ctrl.Call(_m, "DrainGuests", policy)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockDomainManagerRecorder) DrainGuests(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "DrainGuests", arg0)
+}
+
+func (_m *MockDomainManager) RestartCrashedGuest(_param0 *v1.VirtualMachine) (uint, error) {
+	ret := _m.ctrl.Call(_m, "RestartCrashedGuest", _param0)
+	ret0, _ := ret[0].(uint)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockDomainManagerRecorder) RestartCrashedGuest(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "RestartCrashedGuest", arg0)
+}
+
+func (_m *MockDomainManager) HealthCheck(vm *v1.VirtualMachine, pingAgent bool) (*HealthResult, error) {
+	ret := _m.ctrl.Call(_m, "HealthCheck", vm, pingAgent)
+	ret0, _ := ret[0].(*HealthResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockDomainManagerRecorder) HealthCheck(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "HealthCheck", arg0, arg1)
+}
+
+func (_m *MockDomainManager) GetLaunchMeasurement(_param0 *v1.VirtualMachine) (string, error) {
+	ret := _m.ctrl.Call(_m, "GetLaunchMeasurement", _param0)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockDomainManagerRecorder) GetLaunchMeasurement(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetLaunchMeasurement", arg0)
+}
+
+func (_m *MockDomainManager) GetDeviceAllocations(_param0 *v1.VirtualMachine) ([]api.DeviceAllocation, error) {
+	ret := _m.ctrl.Call(_m, "GetDeviceAllocations", _param0)
+	ret0, _ := ret[0].([]api.DeviceAllocation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockDomainManagerRecorder) GetDeviceAllocations(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetDeviceAllocations", arg0)
+}
+
+func (_m *MockDomainManager) WaitsForLaunchSecret(_param0 *v1.VirtualMachine) (bool, error) {
+	ret := _m.ctrl.Call(_m, "WaitsForLaunchSecret", _param0)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockDomainManagerRecorder) WaitsForLaunchSecret(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "WaitsForLaunchSecret", arg0)
+}
+
+func (_m *MockDomainManager) InjectLaunchSecret(vm *v1.VirtualMachine, header string, secret string, trigger Trigger) error {
+	ret := _m.ctrl.Call(_m, "InjectLaunchSecret", vm, header, secret, trigger)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockDomainManagerRecorder) InjectLaunchSecret(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "InjectLaunchSecret", arg0, arg1, arg2, arg3)
+}
+
+func (_m *MockDomainManager) GetRTCOffset(_param0 *v1.VirtualMachine) (int64, error) {
+	ret := _m.ctrl.Call(_m, "GetRTCOffset", _param0)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockDomainManagerRecorder) GetRTCOffset(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetRTCOffset", arg0)
+}
+
+func (_m *MockDomainManager) GetCPUStats(_param0 *v1.VirtualMachine) (*cli.CPUStats, error) {
+	ret := _m.ctrl.Call(_m, "GetCPUStats", _param0)
+	ret0, _ := ret[0].(*cli.CPUStats)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockDomainManagerRecorder) GetCPUStats(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetCPUStats", arg0)
+}
+
+func (_m *MockDomainManager) GetSchedulerTuning(_param0 *v1.VirtualMachine) (*cli.SchedulerTuning, error) {
+	ret := _m.ctrl.Call(_m, "GetSchedulerTuning", _param0)
+	ret0, _ := ret[0].(*cli.SchedulerTuning)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockDomainManagerRecorder) GetSchedulerTuning(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetSchedulerTuning", arg0)
+}
+
+func (_m *MockDomainManager) TuneScheduler(vm *v1.VirtualMachine, tuning *cli.SchedulerTuning, trigger Trigger) error {
+	ret := _m.ctrl.Call(_m, "TuneScheduler", vm, tuning, trigger)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockDomainManagerRecorder) TuneScheduler(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "TuneScheduler", arg0, arg1, arg2)
+}
+
+func (_m *MockDomainManager) TuneMemory(vm *v1.VirtualMachine, tuning *cli.MemoryTuning, trigger Trigger) error {
+	ret := _m.ctrl.Call(_m, "TuneMemory", vm, tuning, trigger)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockDomainManagerRecorder) TuneMemory(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "TuneMemory", arg0, arg1, arg2)
+}
+
+func (_m *MockDomainManager) TuneBlkio(vm *v1.VirtualMachine, tuning *cli.BlkioTuning, trigger Trigger) error {
+	ret := _m.ctrl.Call(_m, "TuneBlkio", vm, tuning, trigger)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockDomainManagerRecorder) TuneBlkio(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "TuneBlkio", arg0, arg1, arg2)
+}
+
+func (_m *MockDomainManager) WaitForState(ctx context.Context, vm *v1.VirtualMachine, states ...api.LifeCycle) (api.LifeCycle, error) {
+	ret := _m.ctrl.Call(_m, "WaitForState", ctx, vm, states)
+	ret0, _ := ret[0].(api.LifeCycle)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockDomainManagerRecorder) WaitForState(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "WaitForState", arg0, arg1, arg2)
+}
+
+func (_m *MockDomainManager) GetAuditTrail(_param0 *v1.VirtualMachine) []AuditEntry {
+	ret := _m.ctrl.Call(_m, "GetAuditTrail", _param0)
+	ret0, _ := ret[0].([]AuditEntry)
+	return ret0
+}
+
+func (_mr *_MockDomainManagerRecorder) GetAuditTrail(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetAuditTrail", arg0)
+}
+
+func (_m *MockDomainManager) AgentConnected(_param0 *v1.VirtualMachine) (bool, error) {
+	ret := _m.ctrl.Call(_m, "AgentConnected", _param0)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockDomainManagerRecorder) AgentConnected(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "AgentConnected", arg0)
+}
+
+func (_m *MockDomainManager) ListJobs(_param0 *v1.VirtualMachine) []jobs.Job {
+	ret := _m.ctrl.Call(_m, "ListJobs", _param0)
+	ret0, _ := ret[0].([]jobs.Job)
+	return ret0
+}
+
+func (_mr *_MockDomainManagerRecorder) ListJobs(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "ListJobs", arg0)
+}
+
+func (_m *MockDomainManager) CancelJob(vm *v1.VirtualMachine, id string, trigger Trigger) error {
+	ret := _m.ctrl.Call(_m, "CancelJob", vm, id, trigger)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockDomainManagerRecorder) CancelJob(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "CancelJob", arg0, arg1, arg2)
+}
@@ -0,0 +1,132 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package virtwrap
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cache"
+)
+
+// Seconds the guest agent has to list the filesystems, it has to stat all
+// of them
+const agentFsInfoTimeout = 10
+
+// agentFilesystem is a filesystem as reported by guest-get-fsinfo
+type agentFilesystem struct {
+	Name       string      `json:"name"`
+	MountPoint string      `json:"mountpoint"`
+	Type       string      `json:"type"`
+	UsedBytes  *uint64     `json:"used-bytes"`
+	TotalBytes *uint64     `json:"total-bytes"`
+	Disks      []agentDisk `json:"disk"`
+}
+
+type agentDisk struct {
+	Serial        string             `json:"serial"`
+	PCIController agentPCIController `json:"pci-controller"`
+}
+
+type agentPCIController struct {
+	Domain uint64 `json:"domain"`
+	Bus    uint64 `json:"bus"`
+	Slot   uint64 `json:"slot"`
+}
+
+// diskTarget finds the disk of the domain the guest sees, first by its
+// serial, then by its slot on the root bus.
+func diskTarget(disks []api.Disk, reported agentDisk) (string, bool) {
+	if reported.Serial != "" {
+		for _, disk := range disks {
+			if disk.Serial == reported.Serial {
+				return disk.Target.Device, true
+			}
+		}
+	}
+	if reported.PCIController.Domain != 0 || reported.PCIController.Bus != 0 {
+		return "", false
+	}
+	for _, disk := range disks {
+		if slot, ok := pciSlot(disk.Address); ok && slot == reported.PCIController.Slot {
+			return disk.Target.Device, true
+		}
+	}
+	return "", false
+}
+
+// GuestFilesystemInfo reports the filesystems mounted in the guest, their
+// usage and the disks of the domain they are stored on. It needs a
+// connected guest agent.
+func (l *LibvirtDomainManager) GuestFilesystemInfo(vm *v1.VirtualMachine) ([]v1.VMFilesystem, error) {
+	connected, err := l.AgentConnected(vm)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Checking the guest agent failed.")
+		return nil, err
+	}
+	if !connected {
+		return nil, fmt.Errorf("the guest agent is not connected")
+	}
+
+	domName := cache.VMNamespaceKeyFunc(vm)
+	dom, err := l.virConn.LookupDomainByName(domName)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain failed.")
+		return nil, err
+	}
+	defer dom.Free()
+
+	spec, err := l.getDomainSpec(domName, dom)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain spec failed.")
+		return nil, err
+	}
+
+	result, err := dom.QemuAgentCommand(`{"execute":"guest-get-fsinfo"}`, agentFsInfoTimeout, 0)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the filesystems from the guest agent failed.")
+		return nil, err
+	}
+	var response struct {
+		Return []agentFilesystem `json:"return"`
+	}
+	if err := json.Unmarshal([]byte(result), &response); err != nil {
+		return nil, fmt.Errorf("invalid guest agent response: %v", err)
+	}
+
+	filesystems := make([]v1.VMFilesystem, 0, len(response.Return))
+	for _, fs := range response.Return {
+		filesystem := v1.VMFilesystem{
+			MountPoint: fs.MountPoint,
+			Type:       fs.Type,
+			UsedBytes:  fs.UsedBytes,
+			TotalBytes: fs.TotalBytes,
+		}
+		for _, disk := range fs.Disks {
+			if target, found := diskTarget(spec.Devices.Disks, disk); found {
+				filesystem.Disks = append(filesystem.Disks, target)
+			}
+		}
+		filesystems = append(filesystems, filesystem)
+	}
+	return filesystems, nil
+}
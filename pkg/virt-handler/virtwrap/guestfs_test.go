@@ -0,0 +1,91 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package virtwrap
+
+import (
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Guest filesystem info", func() {
+	var ctrl *gomock.Controller
+	var mockConn *cli.MockConnection
+	var mockDomain *cli.MockVirDomain
+	var manager *LibvirtDomainManager
+
+	domainXML := `<domain type="kvm">
+  <name>default_testvm</name>
+  <devices>
+    <disk type="file" device="disk">
+      <source file="/var/run/kubevirt/root.img"></source>
+      <target dev="vda" bus="virtio"></target>
+      <serial>root</serial>
+    </disk>
+    <disk type="file" device="disk">
+      <source file="/var/run/kubevirt/data.img"></source>
+      <target dev="vdb" bus="virtio"></target>
+      <address type="pci" domain="0x0000" bus="0x00" slot="0x05" function="0x0"></address>
+    </disk>
+  </devices>
+</domain>`
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockConn = cli.NewMockConnection(ctrl)
+		mockDomain = cli.NewMockVirDomain(ctrl)
+		manager = &LibvirtDomainManager{virConn: mockConn, domainSpecs: newDomainSpecCache()}
+	})
+
+	It("should report the filesystems and their disks", func() {
+		manager.agentStates.set("default_testvm", true)
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+		mockDomain.EXPECT().GetXMLDesc(libvirt.DomainXMLFlags(0)).Return(domainXML, nil)
+		mockDomain.EXPECT().Free()
+		mockDomain.EXPECT().QemuAgentCommand(`{"execute":"guest-get-fsinfo"}`, libvirt.DomainQemuAgentCommandTimeout(agentFsInfoTimeout), uint32(0)).Return(`{"return":[
+  {"name":"vda1","mountpoint":"/","type":"xfs","used-bytes":1024,"total-bytes":4096,
+   "disk":[{"serial":"root","bus-type":"virtio","bus":0,"target":0,"unit":0,"pci-controller":{"domain":0,"bus":0,"slot":4,"function":0}}]},
+  {"name":"vdb","mountpoint":"/data","type":"ext4",
+   "disk":[{"bus-type":"virtio","bus":0,"target":0,"unit":0,"pci-controller":{"domain":0,"bus":0,"slot":5,"function":0}}]}
+]}`, nil)
+
+		filesystems, err := manager.GuestFilesystemInfo(newVM("default", "testvm"))
+		Expect(err).ToNot(HaveOccurred())
+		used := uint64(1024)
+		total := uint64(4096)
+		Expect(filesystems).To(Equal([]v1.VMFilesystem{
+			{MountPoint: "/", Type: "xfs", UsedBytes: &used, TotalBytes: &total, Disks: []string{"vda"}},
+			{MountPoint: "/data", Type: "ext4", Disks: []string{"vdb"}},
+		}))
+	})
+
+	It("should fail without a connected guest agent", func() {
+		manager.agentStates.set("default_testvm", false)
+		_, err := manager.GuestFilesystemInfo(newVM("default", "testvm"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+})
@@ -0,0 +1,120 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cache"
+	domainerrors "kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/errors"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var qemuPidDir = "/var/run/libvirt/qemu"
+var procRoot = "/proc"
+
+// The guest agent has to answer a ping within this many seconds
+const agentPingTimeout = 5
+
+type HealthReason string
+
+const (
+	HealthReasonHealthy           HealthReason = "Healthy"
+	HealthReasonDomainMissing     HealthReason = "DomainMissing"
+	HealthReasonNotRunning        HealthReason = "NotRunning"
+	HealthReasonProcessGone       HealthReason = "ProcessGone"
+	HealthReasonAgentUnresponsive HealthReason = "AgentUnresponsive"
+)
+
+// HealthResult is the outcome of a health check of a guest. Reason tells
+// which check failed first.
+type HealthResult struct {
+	Healthy bool
+	Reason  HealthReason
+	Message string
+	State   api.LifeCycle
+}
+
+// HealthCheck checks whether the guest is alive. The domain has to be
+// running and its qemu process has to exist. If pingAgent is set, the guest
+// agent has to answer a ping too. Failing checks are reported in the result,
+// errors are only returned if a check could not be done at all.
+func (l *LibvirtDomainManager) HealthCheck(vm *v1.VirtualMachine, pingAgent bool) (*HealthResult, error) {
+	domName := cache.VMNamespaceKeyFunc(vm)
+	dom, err := l.virConn.LookupDomainByName(domName)
+	if domainerrors.IsNotFound(err) {
+		return &HealthResult{Reason: HealthReasonDomainMissing, Message: "the domain does not exist"}, nil
+	} else if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain failed.")
+		return nil, err
+	}
+	defer dom.Free()
+
+	domState, _, err := dom.GetState()
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain state failed.")
+		return nil, err
+	}
+	result := &HealthResult{State: cache.LifeCycleTranslationMap[domState]}
+	if domState != libvirt.DOMAIN_RUNNING {
+		result.Reason = HealthReasonNotRunning
+		result.Message = fmt.Sprintf("the domain is %s", result.State)
+		return result, nil
+	}
+
+	if err := qemuProcessAlive(domName); err != nil {
+		result.Reason = HealthReasonProcessGone
+		result.Message = err.Error()
+		return result, nil
+	}
+
+	if pingAgent {
+		if _, err := dom.QemuAgentCommand(`{"execute":"guest-ping"}`, agentPingTimeout, 0); err != nil {
+			result.Reason = HealthReasonAgentUnresponsive
+			result.Message = err.Error()
+			return result, nil
+		}
+	}
+
+	result.Healthy = true
+	result.Reason = HealthReasonHealthy
+	return result, nil
+}
+
+// qemuProcessAlive checks that the process from the pid file of the domain
+// still exists.
+func qemuProcessAlive(domName string) error {
+	content, err := ioutil.ReadFile(filepath.Join(qemuPidDir, domName+".pid"))
+	if err != nil {
+		return fmt.Errorf("reading the qemu pid file failed: %v", err)
+	}
+	pid := strings.TrimSpace(string(content))
+	if _, err := os.Stat(filepath.Join(procRoot, pid)); err != nil {
+		return fmt.Errorf("qemu process %s is gone", pid)
+	}
+	return nil
+}
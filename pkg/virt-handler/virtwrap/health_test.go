@@ -0,0 +1,126 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Health check", func() {
+	var tmpDir string
+	var originalQemuPidDir, originalProcRoot string
+	var ctrl *gomock.Controller
+	var mockConn *cli.MockConnection
+	var mockDomain *cli.MockVirDomain
+	var manager *LibvirtDomainManager
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "health")
+		Expect(err).ToNot(HaveOccurred())
+		originalQemuPidDir, originalProcRoot = qemuPidDir, procRoot
+		qemuPidDir = filepath.Join(tmpDir, "qemu")
+		procRoot = filepath.Join(tmpDir, "proc")
+		Expect(os.MkdirAll(qemuPidDir, 0755)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(procRoot, "4242"), 0755)).To(Succeed())
+
+		ctrl = gomock.NewController(GinkgoT())
+		mockConn = cli.NewMockConnection(ctrl)
+		mockDomain = cli.NewMockVirDomain(ctrl)
+		manager = &LibvirtDomainManager{virConn: mockConn}
+	})
+
+	expectRunning := func() {
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+		mockDomain.EXPECT().GetState().Return(libvirt.DOMAIN_RUNNING, int(libvirt.DOMAIN_RUNNING_BOOTED), nil)
+		mockDomain.EXPECT().Free()
+	}
+
+	writePid := func(pid string) {
+		Expect(ioutil.WriteFile(filepath.Join(qemuPidDir, "default_testvm.pid"), []byte(pid+"\n"), 0644)).To(Succeed())
+	}
+
+	It("should consider running guests with a live qemu process and agent healthy", func() {
+		expectRunning()
+		writePid("4242")
+		mockDomain.EXPECT().QemuAgentCommand(`{"execute":"guest-ping"}`, libvirt.DomainQemuAgentCommandTimeout(agentPingTimeout), uint32(0)).Return(`{"return":{}}`, nil)
+
+		result, err := manager.HealthCheck(newVM("default", "testvm"), true)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Healthy).To(BeTrue())
+		Expect(result.Reason).To(Equal(HealthReasonHealthy))
+		Expect(result.State).To(Equal(api.Running))
+	})
+
+	It("should report missing domains", func() {
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(nil, libvirt.Error{Code: libvirt.ERR_NO_DOMAIN})
+
+		result, err := manager.HealthCheck(newVM("default", "testvm"), false)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Healthy).To(BeFalse())
+		Expect(result.Reason).To(Equal(HealthReasonDomainMissing))
+	})
+
+	It("should report guests which are not running", func() {
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+		mockDomain.EXPECT().GetState().Return(libvirt.DOMAIN_PAUSED, int(libvirt.DOMAIN_PAUSED_USER), nil)
+		mockDomain.EXPECT().Free()
+
+		result, err := manager.HealthCheck(newVM("default", "testvm"), true)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Reason).To(Equal(HealthReasonNotRunning))
+		Expect(result.State).To(Equal(api.Paused))
+	})
+
+	It("should report a vanished qemu process", func() {
+		expectRunning()
+		writePid("4343")
+
+		result, err := manager.HealthCheck(newVM("default", "testvm"), true)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Reason).To(Equal(HealthReasonProcessGone))
+	})
+
+	It("should report an unresponsive guest agent", func() {
+		expectRunning()
+		writePid("4242")
+		mockDomain.EXPECT().QemuAgentCommand(gomock.Any(), gomock.Any(), gomock.Any()).Return("", libvirt.Error{Code: libvirt.ERR_AGENT_UNRESPONSIVE})
+
+		result, err := manager.HealthCheck(newVM("default", "testvm"), true)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Reason).To(Equal(HealthReasonAgentUnresponsive))
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+		qemuPidDir, procRoot = originalQemuPidDir, originalProcRoot
+		os.RemoveAll(tmpDir)
+	})
+})
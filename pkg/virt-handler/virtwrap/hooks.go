@@ -0,0 +1,259 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package virtwrap
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/hooks"
+	hooksv1alpha "kubevirt.io/kubevirt/pkg/hooks/v1alpha"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+)
+
+// DomainHook can change the domain XML right before the domain is defined,
+// e.g. to add devices which KubeVirt does not know about.
+type DomainHook interface {
+	OnDefineDomain(vm *v1.VirtualMachine, domainXML string) (string, error)
+}
+
+// Hooks are called in the order in which they were registered, each one gets
+// the XML returned by the previous one. The hook sidecars of a VM are called
+// after them.
+var domainHooks []DomainHook
+var domainHooksLock sync.Mutex
+
+// RegisterDomainHook adds a hook which is called before domains are defined.
+func RegisterDomainHook(hook DomainHook) {
+	domainHooksLock.Lock()
+	defer domainHooksLock.Unlock()
+	domainHooks = append(domainHooks, hook)
+}
+
+// The hook sidecars of a VM serve their sockets in the socket directory of
+// the VM, see hooks.SocketDirForVM.
+var hookSocketBaseDir = "/var/run/kubevirt"
+
+func SetHookSocketDir(dir string) {
+	hookSocketBaseDir = dir
+}
+
+// sidecarHooks returns a hook for every hook sidecar of the VM. Sidecars
+// create their sockets when they start, so the VM can't be defined before
+// all of them are there.
+func sidecarHooks(vm *v1.VirtualMachine) ([]DomainHook, error) {
+	sidecars, err := hooks.SidecarsFromVM(vm)
+	if err != nil || len(sidecars) == 0 {
+		return nil, err
+	}
+	sockets, err := hooks.Sockets(hooks.SocketDirForVM(hookSocketBaseDir, vm))
+	if err != nil {
+		return nil, err
+	}
+	if len(sockets) < len(sidecars) {
+		return nil, fmt.Errorf("waiting for hook sidecars, %d of %d are ready", len(sockets), len(sidecars))
+	}
+	sidecarHooks := []DomainHook{}
+	for _, socket := range sockets {
+		sidecarHooks = append(sidecarHooks, NewSidecarHook(socket))
+	}
+	return sidecarHooks, nil
+}
+
+// runDomainHooks passes the domain XML through all hooks and validates the
+// result, since the hooks run after the domain was prepared.
+func runDomainHooks(vm *v1.VirtualMachine, domainXML []byte) ([]byte, error) {
+	domainHooksLock.Lock()
+	allHooks := append([]DomainHook(nil), domainHooks...)
+	domainHooksLock.Unlock()
+	vmHooks, err := sidecarHooks(vm)
+	if err != nil {
+		return nil, err
+	}
+	allHooks = append(allHooks, vmHooks...)
+	if len(allHooks) == 0 {
+		return domainXML, nil
+	}
+
+	result := string(domainXML)
+	for _, hook := range allHooks {
+		result, err = hook.OnDefineDomain(vm, result)
+		if err != nil {
+			return nil, fmt.Errorf("domain hook failed: %v", err)
+		}
+	}
+	if err := validateHookedDomain(domainXML, []byte(result)); err != nil {
+		return nil, err
+	}
+	return []byte(result), nil
+}
+
+// hookedCommandline reads the qemu command line of a domain XML. The tags of
+// api.Commandline only work for marshaling.
+type hookedCommandline struct {
+	Commandline struct {
+		Args []api.Arg `xml:"http://libvirt.org/schemas/domain/qemu/1.0 arg"`
+		Env  []api.Env `xml:"http://libvirt.org/schemas/domain/qemu/1.0 env"`
+	} `xml:"http://libvirt.org/schemas/domain/qemu/1.0 commandline"`
+}
+
+// hookedFilesystems reads the filesystems of a domain XML, which the api
+// package doesn't know about.
+type hookedFilesystems struct {
+	Devices struct {
+		Filesystems []rawElement `xml:"filesystem"`
+	} `xml:"devices"`
+}
+
+type rawElement struct {
+	Attrs []xml.Attr `xml:",any,attr"`
+	Inner string     `xml:",innerxml"`
+}
+
+// validateHookedDomain applies the checks of the prepare functions which
+// hooks could get around to the domain XML returned by the hooks. Hooks must
+// not rename the domain either, since it is looked up by name, nor change
+// what the guest can access on the host through its disks, host devices and
+// filesystems.
+func validateHookedDomain(original []byte, hooked []byte) error {
+	var originalSpec, hookedSpec api.DomainSpec
+	if err := xml.Unmarshal(original, &originalSpec); err != nil {
+		return err
+	}
+	if err := xml.Unmarshal(hooked, &hookedSpec); err != nil {
+		return fmt.Errorf("domain hooks returned invalid XML: %v", err)
+	}
+	if hookedSpec.Name != originalSpec.Name || hookedSpec.UUID != originalSpec.UUID {
+		return fmt.Errorf("domain hooks must not change the name or uuid of the domain")
+	}
+	if !reflect.DeepEqual(hookedSpec.Devices.Disks, originalSpec.Devices.Disks) {
+		return fmt.Errorf("domain hooks must not change the disks")
+	}
+	if !reflect.DeepEqual(hookedSpec.Devices.HostDevices, originalSpec.Devices.HostDevices) {
+		return fmt.Errorf("domain hooks must not change the host devices")
+	}
+	if err := prepareNetworkBoot(&hookedSpec); err != nil {
+		return fmt.Errorf("domain hooks returned invalid interfaces: %v", err)
+	}
+
+	var originalCmd, hookedCmd hookedCommandline
+	if err := xml.Unmarshal(original, &originalCmd); err != nil {
+		return err
+	}
+	if err := xml.Unmarshal(hooked, &hookedCmd); err != nil {
+		return err
+	}
+	var originalFilesystems, hookedFilesystems hookedFilesystems
+	if err := xml.Unmarshal(original, &originalFilesystems); err != nil {
+		return err
+	}
+	if err := xml.Unmarshal(hooked, &hookedFilesystems); err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(hookedFilesystems.Devices.Filesystems, originalFilesystems.Devices.Filesystems) {
+		return fmt.Errorf("domain hooks must not change the filesystems")
+	}
+
+	if !reflect.DeepEqual(hookedCmd.Commandline.Env, originalCmd.Commandline.Env) {
+		return fmt.Errorf("domain hooks must not change the qemu environment")
+	}
+	args := []string{}
+	for _, arg := range hookedCmd.Commandline.Args {
+		args = append(args, arg.Value)
+	}
+	if err := validateQEMUArgs(args); err != nil {
+		return fmt.Errorf("domain hooks returned invalid qemu arguments: %v", err)
+	}
+	return nil
+}
+
+var hookCallTimeout = 10 * time.Second
+
+// SidecarHook calls the v1alpha.Callbacks service of a hook sidecar.
+type SidecarHook struct {
+	socketPath string
+}
+
+func NewSidecarHook(socketPath string) *SidecarHook {
+	return &SidecarHook{socketPath: socketPath}
+}
+
+func (s *SidecarHook) OnDefineDomain(vm *v1.VirtualMachine, domainXML string) (string, error) {
+	vmJSON, err := json.Marshal(vm)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), hookCallTimeout)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, s.socketPath,
+		grpc.WithInsecure(),
+		grpc.WithBlock(),
+		grpc.WithDialer(func(addr string, timeout time.Duration) (net.Conn, error) {
+			return net.DialTimeout("unix", addr, timeout)
+		}),
+	)
+	if err != nil {
+		return "", fmt.Errorf("connecting to hook %s failed: %v", s.socketPath, err)
+	}
+	defer conn.Close()
+
+	result, err := hooksv1alpha.NewCallbacksClient(conn).OnDefineDomain(ctx, &hooksv1alpha.OnDefineDomainParams{
+		DomainXML: []byte(domainXML),
+		Vm:        vmJSON,
+	})
+	if err != nil {
+		return "", fmt.Errorf("calling hook %s failed: %v", s.socketPath, err)
+	}
+	return string(result.GetDomainXML()), nil
+}
+
+type callbacksServer struct {
+	hook DomainHook
+}
+
+func (c *callbacksServer) OnDefineDomain(ctx context.Context, params *hooksv1alpha.OnDefineDomainParams) (*hooksv1alpha.OnDefineDomainResult, error) {
+	vm := &v1.VirtualMachine{}
+	if err := json.Unmarshal(params.GetVm(), vm); err != nil {
+		return nil, err
+	}
+	domainXML, err := c.hook.OnDefineDomain(vm, string(params.GetDomainXML()))
+	if err != nil {
+		return nil, err
+	}
+	return &hooksv1alpha.OnDefineDomainResult{DomainXML: []byte(domainXML)}, nil
+}
+
+// ServeDomainHook serves the hook to virt-handler on the listener. It is
+// meant to be used by hook sidecars, which listen on a socket in
+// hooks.SocketsDir, and blocks until the listener is closed.
+func ServeDomainHook(listener net.Listener, hook DomainHook) error {
+	server := grpc.NewServer()
+	hooksv1alpha.RegisterCallbacksServer(server, &callbacksServer{hook: hook})
+	return server.Serve(listener)
+}
@@ -0,0 +1,190 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package virtwrap
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/hooks"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+)
+
+type hookFunc func(vm *v1.VirtualMachine, domainXML string) (string, error)
+
+func (f hookFunc) OnDefineDomain(vm *v1.VirtualMachine, domainXML string) (string, error) {
+	return f(vm, domainXML)
+}
+
+var _ = Describe("Domain hooks", func() {
+	var domainXML []byte
+
+	addDescription := func(description string) DomainHook {
+		return hookFunc(func(vm *v1.VirtualMachine, domainXML string) (string, error) {
+			return strings.Replace(domainXML, "</name>", "</name><description>"+description+"</description>", 1), nil
+		})
+	}
+
+	description := func(domainXML []byte) string {
+		spec := api.DomainSpec{}
+		Expect(xml.Unmarshal(domainXML, &spec)).To(Succeed())
+		return spec.Description
+	}
+
+	BeforeEach(func() {
+		var err error
+		domainXML, err = xml.Marshal(api.NewMinimalDomainSpec("default_testvm"))
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should leave the XML alone without hooks", func() {
+		Expect(runDomainHooks(newVM("default", "testvm"), domainXML)).To(Equal(domainXML))
+	})
+
+	It("should pass the XML through all hooks in order", func() {
+		RegisterDomainHook(addDescription("first"))
+		RegisterDomainHook(hookFunc(func(vm *v1.VirtualMachine, domainXML string) (string, error) {
+			Expect(vm.GetObjectMeta().GetName()).To(Equal("testvm"))
+			return strings.Replace(domainXML, "first", "second", 1), nil
+		}))
+
+		result, err := runDomainHooks(newVM("default", "testvm"), domainXML)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(description(result)).To(Equal("second"))
+	})
+
+	It("should fail if a hook fails", func() {
+		RegisterDomainHook(hookFunc(func(vm *v1.VirtualMachine, domainXML string) (string, error) {
+			return "", fmt.Errorf("no way")
+		}))
+		_, err := runDomainHooks(newVM("default", "testvm"), domainXML)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should refuse hooks which rename the domain", func() {
+		RegisterDomainHook(hookFunc(func(vm *v1.VirtualMachine, domainXML string) (string, error) {
+			return strings.Replace(domainXML, "default_testvm", "other", 1), nil
+		}))
+		_, err := runDomainHooks(newVM("default", "testvm"), domainXML)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should refuse hooks which add disks, host devices or filesystems", func() {
+		for _, device := range []string{
+			`<disk type="file" device="disk"><source file="/etc/shadow"></source><target dev="vdz"></target></disk>`,
+			`<hostdev mode="subsystem" type="pci"><source><address domain="0x0000" bus="0x01" slot="0x00" function="0x0"></address></source></hostdev>`,
+			`<filesystem type="mount"><source dir="/"></source><target dir="host"></target></filesystem>`,
+		} {
+			domainHooks = nil
+			RegisterDomainHook(hookFunc(func(vm *v1.VirtualMachine, domainXML string) (string, error) {
+				return strings.Replace(domainXML, "</devices>", device+"</devices>", 1), nil
+			}))
+			_, err := runDomainHooks(newVM("default", "testvm"), domainXML)
+			Expect(err).To(MatchError(ContainSubstring("domain hooks must not change the")))
+		}
+	})
+
+	It("should refuse hooks which add qemu arguments which are not allowed", func() {
+		spec := api.NewMinimalDomainSpec("default_testvm")
+		spec.XmlNS = "http://libvirt.org/schemas/domain/qemu/1.0"
+		spec.QEMUCmd = &api.Commandline{QEMUEnv: []api.Env{{Name: "SLICE", Value: "default"}}}
+		domainXML, err := xml.Marshal(spec)
+		Expect(err).ToNot(HaveOccurred())
+		RegisterDomainHook(hookFunc(func(vm *v1.VirtualMachine, domainXML string) (string, error) {
+			return strings.Replace(domainXML, "<qemu:env", `<qemu:arg value="-device"></qemu:arg><qemu:arg value="pci-assign"></qemu:arg><qemu:env`, 1), nil
+		}))
+
+		_, err = runDomainHooks(newVM("default", "testvm"), domainXML)
+		Expect(err).To(MatchError(ContainSubstring("qemu option -device is not allowed")))
+	})
+
+	It("should refuse hooks which load option ROMs from anywhere", func() {
+		spec := api.NewMinimalDomainSpec("default_testvm")
+		domainXML, err := xml.Marshal(spec)
+		Expect(err).ToNot(HaveOccurred())
+		RegisterDomainHook(hookFunc(func(vm *v1.VirtualMachine, domainXML string) (string, error) {
+			return strings.Replace(domainXML, "</interface>", `<rom file="/tmp/evil.rom"></rom></interface>`, 1), nil
+		}))
+
+		_, err = runDomainHooks(newVM("default", "testvm"), domainXML)
+		Expect(err).To(HaveOccurred())
+	})
+
+	Context("in sidecars", func() {
+		var tmpDir string
+		var listener net.Listener
+		var vm *v1.VirtualMachine
+
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = ioutil.TempDir("", "hooks")
+			Expect(err).ToNot(HaveOccurred())
+			SetHookSocketDir(tmpDir)
+			hooks.SetSidecarsEnabled(true)
+			vm = newVM("default", "testvm")
+			vm.ObjectMeta.Annotations = map[string]string{v1.HookSidecarsAnnotation: `[{"image": "registry:5000/hook:devel"}]`}
+
+			socketDir := hooks.SocketDirForVM(tmpDir, vm)
+			Expect(os.MkdirAll(socketDir, 0755)).To(Succeed())
+			listener, err = net.Listen("unix", filepath.Join(socketDir, "description.sock"))
+			Expect(err).ToNot(HaveOccurred())
+			go ServeDomainHook(listener, hookFunc(func(vm *v1.VirtualMachine, domainXML string) (string, error) {
+				Expect(vm.GetObjectMeta().GetName()).To(Equal("testvm"))
+				return addDescription("sidecar").OnDefineDomain(vm, domainXML)
+			}))
+		})
+
+		It("should call the hook sidecars of the VM", func() {
+			result, err := runDomainHooks(vm, domainXML)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(description(result)).To(Equal("sidecar"))
+		})
+
+		It("should not call the hook sidecars of other VMs", func() {
+			Expect(runDomainHooks(newVM("default", "othervm"), domainXML)).To(Equal(domainXML))
+		})
+
+		It("should wait for all hook sidecars of the VM", func() {
+			vm.ObjectMeta.Annotations[v1.HookSidecarsAnnotation] = `[{"image": "registry:5000/hook:devel"}, {"image": "registry:5000/other-hook:devel"}]`
+
+			_, err := runDomainHooks(vm, domainXML)
+			Expect(err).To(MatchError("waiting for hook sidecars, 1 of 2 are ready"))
+		})
+
+		AfterEach(func() {
+			listener.Close()
+			os.RemoveAll(tmpDir)
+			SetHookSocketDir("/var/run/kubevirt")
+			hooks.SetSidecarsEnabled(false)
+		})
+	})
+
+	AfterEach(func() {
+		domainHooks = nil
+	})
+})
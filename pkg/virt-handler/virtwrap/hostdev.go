@@ -0,0 +1,263 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cache"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+const vfioDriver = "vfio-pci"
+
+// PCI devices which are bound to vfio-pci but not used by any domain were
+// left behind, e.g. because a domain went away while virt-handler was down.
+// Releasing them gives them back to their host drivers on startup. Only
+// enable it on hosts where vfio-pci is not used outside of KubeVirt.
+var releaseUnusedVFIODevices = false
+
+// SetReleaseUnusedVFIODevices enables or disables releasing PCI devices which
+// are bound to vfio-pci but not used by any domain.
+func SetReleaseUnusedVFIODevices(release bool) {
+	releaseUnusedVFIODevices = release
+}
+
+// ListPCIDevices returns all PCI devices of the host, including SR-IOV VFs.
+func ListPCIDevices(conn cli.Connection) ([]api.NodeDevice, error) {
+	return listNodeDevices(conn, libvirt.CONNECT_LIST_NODE_DEVICES_CAP_PCI_DEV)
+}
+
+// ListVFIODevices returns the PCI devices of the host which are bound to
+// vfio-pci, i.e. which are detached from their host drivers.
+func ListVFIODevices(conn cli.Connection) ([]api.NodeDevice, error) {
+	devs, err := ListPCIDevices(conn)
+	if err != nil {
+		return nil, err
+	}
+	vfioDevs := []api.NodeDevice{}
+	for _, dev := range devs {
+		if dev.Driver != nil && dev.Driver.Name == vfioDriver {
+			vfioDevs = append(vfioDevs, dev)
+		}
+	}
+	return vfioDevs, nil
+}
+
+func listNodeDevices(conn cli.Connection, flags libvirt.ConnectListAllNodeDeviceFlags) ([]api.NodeDevice, error) {
+	devs, err := conn.ListAllNodeDevices(flags)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeDevices := []api.NodeDevice{}
+	for _, dev := range devs {
+		nodeDevice, err := newNodeDevice(dev)
+		dev.Free()
+		if err != nil {
+			return nil, err
+		}
+		nodeDevices = append(nodeDevices, *nodeDevice)
+	}
+	return nodeDevices, nil
+}
+
+func newNodeDevice(dev cli.VirNodeDevice) (*api.NodeDevice, error) {
+	xmlstr, err := dev.GetXMLDesc(0)
+	if err != nil {
+		return nil, err
+	}
+	var nodeDevice api.NodeDevice
+	if err := xml.Unmarshal([]byte(xmlstr), &nodeDevice); err != nil {
+		return nil, err
+	}
+	return &nodeDevice, nil
+}
+
+// pciNodeDeviceName converts a PCI address into the libvirt node device name,
+// e.g. pci_0000_06_02_0.
+func pciNodeDeviceName(address *api.Address) (string, error) {
+	if address == nil {
+		return "", fmt.Errorf("host device has no source address")
+	}
+	var parts [4]uint64
+	for i, s := range []string{address.Domain, address.Bus, address.Slot, address.Function} {
+		v, err := strconv.ParseUint(s, 0, 32)
+		if err != nil {
+			return "", fmt.Errorf("invalid PCI address %v: %v", *address, err)
+		}
+		parts[i] = v
+	}
+	return fmt.Sprintf("pci_%04x_%02x_%02x_%x", parts[0], parts[1], parts[2], parts[3]), nil
+}
+
+// prepareHostDevices detaches all PCI host devices of the domain from their
+// host drivers and records that they, and all mediated devices, are allocated
+// to the domain. PCI devices are marked as unmanaged, so that libvirt leaves
+// it to us to give them back to the host when the VM goes away.
+func (l *LibvirtDomainManager) prepareHostDevices(vm *v1.VirtualMachine, spec *api.DomainSpec) error {
+	l.cacheLock.Lock()
+	defer l.cacheLock.Unlock()
+
+	domName := cache.VMNamespaceKeyFunc(vm)
+
+	for i, hostDev := range spec.Devices.HostDevices {
+		var name string
+		var err error
+		switch hostDev.Type {
+		case "pci":
+			name, err = pciNodeDeviceName(hostDev.Source.Address)
+			spec.Devices.HostDevices[i].Managed = "no"
+		case "mdev":
+			name, err = prepareMediatedDevice(vm, i, &spec.Devices.HostDevices[i].Source)
+		default:
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if owner, exists := l.hostDeviceCache[name]; exists {
+			if owner != domName {
+				return fmt.Errorf("host device %s is already allocated to %s", name, owner)
+			}
+			continue
+		}
+
+		dev, err := l.virConn.LookupNodeDeviceByName(name)
+		if err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msgf("Looking up host device %s failed.", name)
+			return err
+		}
+		// Mediated devices are always bound to the vfio-mdev driver
+		if hostDev.Type == "pci" {
+			err = dev.Detach()
+		}
+		dev.Free()
+		if err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msgf("Detaching host device %s failed.", name)
+			return err
+		}
+		l.hostDeviceCache[name] = domName
+		logging.DefaultLogger().Object(vm).Info().Msgf("Host device %s allocated.", name)
+	}
+	return nil
+}
+
+// releaseHostDevices gives all PCI devices which were allocated to the
+// domain back to the host and removes its mediated devices.
+func (l *LibvirtDomainManager) releaseHostDevices(vm *v1.VirtualMachine) error {
+	l.cacheLock.Lock()
+	defer l.cacheLock.Unlock()
+
+	domName := cache.VMNamespaceKeyFunc(vm)
+
+	for name, owner := range l.hostDeviceCache {
+		if owner != domName {
+			continue
+		}
+		// Mediated devices only live as long as the domain which uses them
+		if mdevUUID, isMdev := mdevUUIDFromNodeDeviceName(name); isMdev {
+			if err := RemoveMediatedDevice(mdevUUID); err != nil {
+				logging.DefaultLogger().Object(vm).Error().Reason(err).Msgf("Removing mediated device %s failed.", mdevUUID)
+				return err
+			}
+			delete(l.hostDeviceCache, name)
+			logging.DefaultLogger().Object(vm).Info().Msgf("Mediated device %s removed.", mdevUUID)
+			continue
+		}
+		if err := l.resetAndReAttach(name); err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msgf("Reattaching host device %s failed.", name)
+			return err
+		}
+		delete(l.hostDeviceCache, name)
+		logging.DefaultLogger().Object(vm).Info().Msgf("Host device %s reattached.", name)
+	}
+	return nil
+}
+
+// resetAndReAttach resets the PCI function, so that the next user does not
+// see the state the guest left behind, and binds it to its host driver
+// again. Not all devices can be reset, which does not prevent reattaching.
+func (l *LibvirtDomainManager) resetAndReAttach(name string) error {
+	dev, err := l.virConn.LookupNodeDeviceByName(name)
+	if err != nil {
+		return err
+	}
+	defer dev.Free()
+
+	if err := dev.Reset(); err != nil {
+		logging.DefaultLogger().Warning().Reason(err).Msgf("Resetting host device %s failed.", name)
+	}
+	return dev.ReAttach()
+}
+
+// releaseLeakedVFIODevices gives all PCI devices which are bound to vfio-pci,
+// but are not assigned to any domain, back to the host. Devices which can't
+// be released are skipped. If a domain can't be read, nothing is released,
+// since the domain might use any of the devices.
+func (l *LibvirtDomainManager) releaseLeakedVFIODevices() error {
+	doms, err := l.virConn.ListAllDomains(libvirt.CONNECT_LIST_DOMAINS_ACTIVE | libvirt.CONNECT_LIST_DOMAINS_INACTIVE)
+	if err != nil {
+		return err
+	}
+	inUse := map[string]bool{}
+	for i, dom := range doms {
+		spec, err := cache.NewDomainSpec(dom)
+		if err != nil {
+			logging.DefaultLogger().Error().Reason(err).Msg("Parsing the domain XML failed, not releasing leaked host devices.")
+			for _, dom := range doms[i:] {
+				dom.Free()
+			}
+			return nil
+		}
+		dom.Free()
+		for _, hostDev := range spec.Devices.HostDevices {
+			if hostDev.Type != "pci" {
+				continue
+			}
+			if name, err := pciNodeDeviceName(hostDev.Source.Address); err == nil {
+				inUse[name] = true
+			}
+		}
+	}
+
+	vfioDevs, err := ListVFIODevices(l.virConn)
+	if err != nil {
+		return err
+	}
+	for _, dev := range vfioDevs {
+		if inUse[dev.Name] {
+			continue
+		}
+		if err := l.resetAndReAttach(dev.Name); err != nil {
+			logging.DefaultLogger().Error().Reason(err).Msgf("Releasing leaked host device %s failed.", dev.Name)
+			continue
+		}
+		logging.DefaultLogger().Info().Msgf("Leaked host device %s released.", dev.Name)
+	}
+	return nil
+}
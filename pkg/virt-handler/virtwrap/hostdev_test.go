@@ -0,0 +1,237 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"encoding/xml"
+	"fmt"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var vfXML = `<device>
+  <name>pci_0000_06_02_0</name>
+  <path>/sys/devices/pci0000:00/0000:00:1c.0/0000:06:02.0</path>
+  <parent>pci_0000_00_1c_0</parent>
+  <driver>
+    <name>ixgbevf</name>
+  </driver>
+  <capability type="pci">
+    <domain>0</domain>
+    <bus>6</bus>
+    <slot>2</slot>
+    <function>0</function>
+    <product id="0x10ed">82599 Ethernet Controller Virtual Function</product>
+    <vendor id="0x8086">Intel Corporation</vendor>
+    <capability type="phys_function">
+      <address domain="0x0000" bus="0x06" slot="0x00" function="0x0"/>
+    </capability>
+    <iommuGroup number="42">
+      <address domain="0x0000" bus="0x06" slot="0x02" function="0x0"/>
+    </iommuGroup>
+  </capability>
+</device>`
+
+func vfioXML(name string) string {
+	return fmt.Sprintf(`<device>
+  <name>%s</name>
+  <driver>
+    <name>vfio-pci</name>
+  </driver>
+  <capability type="pci"/>
+</device>`, name)
+}
+
+var _ = Describe("Host devices", func() {
+	var mockConn *cli.MockConnection
+	var mockDev *cli.MockVirNodeDevice
+	var ctrl *gomock.Controller
+	var manager *LibvirtDomainManager
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockConn = cli.NewMockConnection(ctrl)
+		mockDev = cli.NewMockVirNodeDevice(ctrl)
+		manager = &LibvirtDomainManager{
+			virConn:         mockConn,
+			hostDeviceCache: make(map[string]string),
+		}
+	})
+
+	newSpecWithHostDevice := func() *api.DomainSpec {
+		spec := api.NewMinimalDomainSpec("testvm")
+		spec.Devices.HostDevices = []api.HostDevice{
+			{
+				Mode:    "subsystem",
+				Type:    "pci",
+				Managed: "yes",
+				Source: api.HostDeviceSource{
+					Address: &api.Address{Type: "pci", Domain: "0x0000", Bus: "0x06", Slot: "0x02", Function: "0x0"},
+				},
+			},
+		}
+		return spec
+	}
+
+	It("should list and parse PCI devices", func() {
+		mockConn.EXPECT().ListAllNodeDevices(libvirt.CONNECT_LIST_NODE_DEVICES_CAP_PCI_DEV).Return([]cli.VirNodeDevice{mockDev}, nil)
+		mockDev.EXPECT().GetXMLDesc(uint32(0)).Return(vfXML, nil)
+		mockDev.EXPECT().Free()
+
+		devs, err := ListPCIDevices(mockConn)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(devs).To(HaveLen(1))
+		Expect(devs[0].Name).To(Equal("pci_0000_06_02_0"))
+		Expect(devs[0].Driver.Name).To(Equal("ixgbevf"))
+		Expect(devs[0].IsVirtualFunction()).To(BeTrue())
+		address, err := devs[0].PCIAddress()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(*address).To(Equal(api.Address{Type: "pci", Domain: "0x0000", Bus: "0x06", Slot: "0x02", Function: "0x0"}))
+	})
+
+	It("should detach and track a PCI device", func() {
+		vm := newVM("default", "testvm")
+		spec := newSpecWithHostDevice()
+		mockConn.EXPECT().LookupNodeDeviceByName("pci_0000_06_02_0").Return(mockDev, nil)
+		mockDev.EXPECT().Detach().Return(nil)
+		mockDev.EXPECT().Free()
+
+		Expect(manager.prepareHostDevices(vm, spec)).To(Succeed())
+		Expect(spec.Devices.HostDevices[0].Managed).To(Equal("no"))
+		Expect(manager.hostDeviceCache).To(HaveKeyWithValue("pci_0000_06_02_0", "default_testvm"))
+
+		// A second sync must not detach the device again
+		Expect(manager.prepareHostDevices(vm, spec)).To(Succeed())
+	})
+
+	It("should refuse a device which is allocated to another domain", func() {
+		manager.hostDeviceCache["pci_0000_06_02_0"] = "default_othervm"
+		Expect(manager.prepareHostDevices(newVM("default", "testvm"), newSpecWithHostDevice())).ToNot(Succeed())
+	})
+
+	It("should reattach the devices of a domain", func() {
+		manager.hostDeviceCache["pci_0000_06_02_0"] = "default_testvm"
+		manager.hostDeviceCache["pci_0000_06_02_1"] = "default_othervm"
+		mockConn.EXPECT().LookupNodeDeviceByName("pci_0000_06_02_0").Return(mockDev, nil)
+		gomock.InOrder(
+			mockDev.EXPECT().Reset().Return(nil),
+			mockDev.EXPECT().ReAttach().Return(nil),
+		)
+		mockDev.EXPECT().Free()
+
+		Expect(manager.releaseHostDevices(newVM("default", "testvm"))).To(Succeed())
+		Expect(manager.hostDeviceCache).To(Equal(map[string]string{"pci_0000_06_02_1": "default_othervm"}))
+	})
+
+	It("should reattach a device which can't be reset", func() {
+		manager.hostDeviceCache["pci_0000_06_02_0"] = "default_testvm"
+		mockConn.EXPECT().LookupNodeDeviceByName("pci_0000_06_02_0").Return(mockDev, nil)
+		mockDev.EXPECT().Reset().Return(libvirt.Error{Code: libvirt.ERR_OPERATION_FAILED})
+		mockDev.EXPECT().ReAttach().Return(nil)
+		mockDev.EXPECT().Free()
+
+		Expect(manager.releaseHostDevices(newVM("default", "testvm"))).To(Succeed())
+		Expect(manager.hostDeviceCache).To(BeEmpty())
+	})
+
+	It("should only list PCI devices which are bound to vfio-pci", func() {
+		boundDev := cli.NewMockVirNodeDevice(ctrl)
+		mockConn.EXPECT().ListAllNodeDevices(libvirt.CONNECT_LIST_NODE_DEVICES_CAP_PCI_DEV).Return([]cli.VirNodeDevice{mockDev, boundDev}, nil)
+		mockDev.EXPECT().GetXMLDesc(uint32(0)).Return(vfXML, nil)
+		mockDev.EXPECT().Free()
+		boundDev.EXPECT().GetXMLDesc(uint32(0)).Return(vfioXML("pci_0000_06_02_1"), nil)
+		boundDev.EXPECT().Free()
+
+		devs, err := ListVFIODevices(mockConn)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(devs).To(HaveLen(1))
+		Expect(devs[0].Name).To(Equal("pci_0000_06_02_1"))
+	})
+
+	It("should release vfio-pci devices which no domain uses", func() {
+		dom := cli.NewMockVirDomain(ctrl)
+		usedDev := cli.NewMockVirNodeDevice(ctrl)
+		leakedDev := cli.NewMockVirNodeDevice(ctrl)
+		domXML, err := xml.Marshal(newSpecWithHostDevice())
+		Expect(err).ToNot(HaveOccurred())
+
+		mockConn.EXPECT().ListAllDomains(libvirt.CONNECT_LIST_DOMAINS_ACTIVE|libvirt.CONNECT_LIST_DOMAINS_INACTIVE).Return([]cli.VirDomain{dom}, nil)
+		dom.EXPECT().GetXMLDesc(libvirt.DOMAIN_XML_MIGRATABLE).Return(string(domXML), nil)
+		dom.EXPECT().Free()
+		mockConn.EXPECT().ListAllNodeDevices(libvirt.CONNECT_LIST_NODE_DEVICES_CAP_PCI_DEV).Return([]cli.VirNodeDevice{usedDev, leakedDev}, nil)
+		usedDev.EXPECT().GetXMLDesc(uint32(0)).Return(vfioXML("pci_0000_06_02_0"), nil)
+		usedDev.EXPECT().Free()
+		leakedDev.EXPECT().GetXMLDesc(uint32(0)).Return(vfioXML("pci_0000_06_02_1"), nil)
+		leakedDev.EXPECT().Free()
+
+		mockConn.EXPECT().LookupNodeDeviceByName("pci_0000_06_02_1").Return(mockDev, nil)
+		mockDev.EXPECT().Reset().Return(nil)
+		mockDev.EXPECT().ReAttach().Return(nil)
+		mockDev.EXPECT().Free()
+
+		Expect(manager.releaseLeakedVFIODevices()).To(Succeed())
+	})
+
+	It("should keep releasing devices if one can't be released", func() {
+		firstDev := cli.NewMockVirNodeDevice(ctrl)
+		secondDev := cli.NewMockVirNodeDevice(ctrl)
+		otherDev := cli.NewMockVirNodeDevice(ctrl)
+
+		mockConn.EXPECT().ListAllDomains(libvirt.CONNECT_LIST_DOMAINS_ACTIVE|libvirt.CONNECT_LIST_DOMAINS_INACTIVE).Return([]cli.VirDomain{}, nil)
+		mockConn.EXPECT().ListAllNodeDevices(libvirt.CONNECT_LIST_NODE_DEVICES_CAP_PCI_DEV).Return([]cli.VirNodeDevice{firstDev, secondDev}, nil)
+		firstDev.EXPECT().GetXMLDesc(uint32(0)).Return(vfioXML("pci_0000_06_02_0"), nil)
+		firstDev.EXPECT().Free()
+		secondDev.EXPECT().GetXMLDesc(uint32(0)).Return(vfioXML("pci_0000_06_02_1"), nil)
+		secondDev.EXPECT().Free()
+
+		mockConn.EXPECT().LookupNodeDeviceByName("pci_0000_06_02_0").Return(mockDev, nil)
+		mockDev.EXPECT().Reset().Return(nil)
+		mockDev.EXPECT().ReAttach().Return(libvirt.Error{Code: libvirt.ERR_OPERATION_FAILED})
+		mockDev.EXPECT().Free()
+		mockConn.EXPECT().LookupNodeDeviceByName("pci_0000_06_02_1").Return(otherDev, nil)
+		otherDev.EXPECT().Reset().Return(nil)
+		otherDev.EXPECT().ReAttach().Return(nil)
+		otherDev.EXPECT().Free()
+
+		Expect(manager.releaseLeakedVFIODevices()).To(Succeed())
+	})
+
+	It("should not release devices if a domain can't be read", func() {
+		brokenDom := cli.NewMockVirDomain(ctrl)
+		otherDom := cli.NewMockVirDomain(ctrl)
+
+		mockConn.EXPECT().ListAllDomains(libvirt.CONNECT_LIST_DOMAINS_ACTIVE|libvirt.CONNECT_LIST_DOMAINS_INACTIVE).Return([]cli.VirDomain{brokenDom, otherDom}, nil)
+		brokenDom.EXPECT().GetXMLDesc(libvirt.DOMAIN_XML_MIGRATABLE).Return("", libvirt.Error{Code: libvirt.ERR_NO_DOMAIN})
+		brokenDom.EXPECT().Free()
+		otherDom.EXPECT().Free()
+
+		Expect(manager.releaseLeakedVFIODevices()).To(Succeed())
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+})
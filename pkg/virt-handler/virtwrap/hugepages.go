@@ -0,0 +1,153 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+)
+
+var unitsInKiB = map[string]uint64{
+	"b":     0,
+	"bytes": 0,
+	"k":     1,
+	"kib":   1,
+	"kb":    1,
+	"m":     1024,
+	"mib":   1024,
+	"mb":    1024,
+	"g":     1024 * 1024,
+	"gib":   1024 * 1024,
+	"gb":    1024 * 1024,
+	"t":     1024 * 1024 * 1024,
+	"tib":   1024 * 1024 * 1024,
+	"tb":    1024 * 1024 * 1024,
+}
+
+// ToKiB converts a libvirt memory value into KiB. An empty unit means KiB.
+// Decimal units are treated like their binary counterparts, so that guests
+// get at least the memory they ask for.
+func ToKiB(value uint, unit string) (uint64, error) {
+	if unit == "" {
+		return uint64(value), nil
+	}
+	factor, ok := unitsInKiB[strings.ToLower(unit)]
+	if !ok {
+		return 0, fmt.Errorf("unsupported memory unit %s", unit)
+	}
+	if factor == 0 {
+		return uint64(value) / 1024, nil
+	}
+	return uint64(value) * factor, nil
+}
+
+func (l *LibvirtDomainManager) getCapabilities() (*api.Capabilities, error) {
+	capsXML, err := l.virConn.GetCapabilities()
+	if err != nil {
+		return nil, err
+	}
+	var caps api.Capabilities
+	if err := xml.Unmarshal([]byte(capsXML), &caps); err != nil {
+		return nil, err
+	}
+	return &caps, nil
+}
+
+// freeHugePages returns the number of free pages of every page size of the
+// host, summed up over all NUMA cells.
+func (l *LibvirtDomainManager) freeHugePages(caps *api.Capabilities) (map[uint64]uint64, error) {
+	free := map[uint64]uint64{}
+	if caps.Host.Topology == nil || len(caps.Host.Topology.Cells) == 0 {
+		return free, nil
+	}
+
+	sizes := []uint64{}
+	for _, pages := range caps.Host.CPU.Pages {
+		size, err := ToKiB(pages.Size, pages.Unit)
+		if err != nil {
+			return nil, err
+		}
+		sizes = append(sizes, size)
+	}
+	if len(sizes) == 0 {
+		return free, nil
+	}
+
+	cells := len(caps.Host.Topology.Cells)
+	counts, err := l.virConn.GetFreePages(sizes, 0, uint(cells), 0)
+	if err != nil {
+		return nil, err
+	}
+	for i, count := range counts {
+		free[sizes[i%len(sizes)]] += count
+	}
+	return free, nil
+}
+
+// validateHugePages checks that the host supports all requested hugepage sizes
+// and that enough hugepages are free on the host to back the guest memory.
+func validateHugePages(spec *api.DomainSpec, caps *api.Capabilities, free map[uint64]uint64) error {
+	if spec.MemoryBacking == nil || spec.MemoryBacking.HugePages == nil {
+		return nil
+	}
+
+	memory, err := ToKiB(spec.Memory.Value, spec.Memory.Unit)
+	if err != nil {
+		return err
+	}
+
+	supported := map[uint64]bool{}
+	for _, pages := range caps.Host.CPU.Pages {
+		size, err := ToKiB(pages.Size, pages.Unit)
+		if err != nil {
+			return err
+		}
+		supported[size] = true
+	}
+
+	for _, page := range spec.MemoryBacking.HugePages.HugePage {
+		size, err := ToKiB(page.Size, page.Unit)
+		if err != nil {
+			return err
+		}
+		if size == 0 {
+			return fmt.Errorf("invalid hugepage size %d%s", page.Size, page.Unit)
+		}
+		if !supported[size] {
+			return fmt.Errorf("hugepages of size %dKiB are not supported by the host", size)
+		}
+		if page.NodeSet != "" {
+			// Only a part of the guest memory is backed by this page size
+			if _, err := cli.ParseCPUSet(page.NodeSet); err != nil {
+				return fmt.Errorf("invalid hugepage nodeset %s: %v", page.NodeSet, err)
+			}
+			continue
+		}
+		needed := (memory + size - 1) / size
+		if free[size] < needed {
+			return fmt.Errorf("not enough free hugepages of size %dKiB on the host: need %d, have %d", size, needed, free[size])
+		}
+	}
+	return nil
+}
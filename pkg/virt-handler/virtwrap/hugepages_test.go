@@ -0,0 +1,124 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"encoding/xml"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+)
+
+var capabilitiesXML = `<capabilities>
+  <host>
+    <uuid>9b2ed3b5-8e21-4a45-9c3c-7c5d4b1d9d1e</uuid>
+    <cpu>
+      <arch>x86_64</arch>
+      <model>Skylake-Client</model>
+      <pages unit="KiB" size="4"/>
+      <pages unit="KiB" size="2048"/>
+      <pages unit="KiB" size="1048576"/>
+    </cpu>
+    <topology>
+      <cells num="2">
+        <cell id="0">
+          <memory unit="KiB">8192000</memory>
+          <pages unit="KiB" size="4">2048000</pages>
+          <pages unit="KiB" size="2048">512</pages>
+          <pages unit="KiB" size="1048576">0</pages>
+          <cpus num="2">
+            <cpu id="0" socket_id="0" core_id="0" siblings="0,2"/>
+            <cpu id="2" socket_id="0" core_id="0" siblings="0,2"/>
+          </cpus>
+        </cell>
+        <cell id="1">
+          <memory unit="KiB">8192000</memory>
+          <pages unit="KiB" size="4">2048000</pages>
+          <pages unit="KiB" size="2048">512</pages>
+          <pages unit="KiB" size="1048576">0</pages>
+          <cpus num="2">
+            <cpu id="1" socket_id="1" core_id="0" siblings="1,3"/>
+            <cpu id="3" socket_id="1" core_id="0" siblings="1,3"/>
+          </cpus>
+        </cell>
+      </cells>
+    </topology>
+  </host>
+</capabilities>`
+
+var _ = Describe("Hugepages", func() {
+	var caps *api.Capabilities
+	var free map[uint64]uint64
+
+	BeforeEach(func() {
+		caps = &api.Capabilities{}
+		Expect(xml.Unmarshal([]byte(capabilitiesXML), caps)).To(Succeed())
+		free = map[uint64]uint64{4: 4096000, 2048: 1024, 1048576: 0}
+	})
+
+	It("should parse the host capabilities", func() {
+		Expect(caps.Host.CPU.Arch).To(Equal("x86_64"))
+		Expect(caps.Host.CPU.Pages).To(HaveLen(3))
+		Expect(caps.Host.Topology.Cells).To(HaveLen(2))
+		Expect(caps.Host.Topology.Cells[1].Pages[1]).To(Equal(api.HostPages{Unit: "KiB", Size: 2048, Count: 512}))
+		Expect(caps.Host.Topology.Cells[1].CPUs[0].Siblings).To(Equal("1,3"))
+	})
+
+	table.DescribeTable("should validate the hugepage configuration",
+		func(memory api.Memory, page api.HugePage, valid bool) {
+			spec := api.NewMinimalDomainSpec("testvm")
+			spec.Memory = memory
+			spec.MemoryBacking = &api.MemoryBacking{
+				HugePages: &api.HugePages{HugePage: []api.HugePage{page}},
+			}
+			err := validateHugePages(spec, caps, free)
+			if valid {
+				Expect(err).ToNot(HaveOccurred())
+			} else {
+				Expect(err).To(HaveOccurred())
+			}
+		},
+		table.Entry("with enough 2M pages", api.Memory{Value: 2, Unit: "GiB"}, api.HugePage{Size: 2, Unit: "M"}, true),
+		table.Entry("with too few 2M pages", api.Memory{Value: 4, Unit: "GiB"}, api.HugePage{Size: 2048}, false),
+		table.Entry("with no free 1G pages", api.Memory{Value: 1, Unit: "GiB"}, api.HugePage{Size: 1, Unit: "G"}, false),
+		table.Entry("with an unsupported page size", api.Memory{Value: 64, Unit: "MiB"}, api.HugePage{Size: 16, Unit: "M"}, false),
+		table.Entry("with a nodeset", api.Memory{Value: 4, Unit: "GiB"}, api.HugePage{Size: 2048, NodeSet: "0"}, true),
+		table.Entry("with an invalid nodeset", api.Memory{Value: 4, Unit: "GiB"}, api.HugePage{Size: 2048, NodeSet: "x"}, false),
+	)
+
+	It("should ignore domains without hugepages", func() {
+		Expect(validateHugePages(api.NewMinimalDomainSpec("testvm"), &api.Capabilities{}, nil)).To(Succeed())
+	})
+
+	It("should sum up the free pages of all cells", func() {
+		ctrl := gomock.NewController(GinkgoT())
+		defer ctrl.Finish()
+		mockConn := cli.NewMockConnection(ctrl)
+		mockConn.EXPECT().GetFreePages([]uint64{4, 2048, 1048576}, 0, uint(2), uint32(0)).Return([]uint64{100, 10, 0, 200, 20, 1}, nil)
+
+		manager := &LibvirtDomainManager{virConn: mockConn}
+		Expect(manager.freeHugePages(caps)).To(Equal(map[uint64]uint64{4: 300, 2048: 30, 1048576: 1}))
+	})
+})
@@ -0,0 +1,108 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package virtwrap
+
+import (
+	"fmt"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+)
+
+const (
+	defaultSpinlockRetries = 8191
+	minSpinlockRetries     = 4095
+	maxVendorIDLength      = 12
+)
+
+func isFeatureOn(state *api.FeatureState) bool {
+	return state != nil && state.State == "on"
+}
+
+// prepareHyperv fills in the defaults of the Hyper-V enlightenments and
+// enables what they depend on. SyNIC needs the VP index and the SyNIC timers
+// need SyNIC and the hypervclock timer, which are added if they are not
+// explicitly disabled.
+func (l *LibvirtDomainManager) prepareHyperv(spec *api.DomainSpec) error {
+	if spec.Features == nil || spec.Features.Hyperv == nil {
+		return nil
+	}
+	hyperv := spec.Features.Hyperv
+	if spec.OS.Type.Arch != "" && spec.OS.Type.Arch != "x86_64" {
+		return fmt.Errorf("Hyper-V enlightenments are not supported on %s", spec.OS.Type.Arch)
+	}
+
+	if spinlocks := hyperv.Spinlocks; spinlocks != nil && spinlocks.State == "on" {
+		if spinlocks.Retries == nil {
+			retries := uint32(defaultSpinlockRetries)
+			spinlocks.Retries = &retries
+		}
+		if *spinlocks.Retries < minSpinlockRetries {
+			return fmt.Errorf("Hyper-V spinlocks need at least %d retries, got %d", minSpinlockRetries, *spinlocks.Retries)
+		}
+	}
+	if vendorID := hyperv.VendorID; vendorID != nil && vendorID.State == "on" {
+		if vendorID.Value == "" || len(vendorID.Value) > maxVendorIDLength {
+			return fmt.Errorf("Hyper-V vendor id must have 1 to %d characters, got '%s'", maxVendorIDLength, vendorID.Value)
+		}
+	}
+
+	if isFeatureOn(hyperv.SyNICTimer) {
+		if hyperv.SyNIC == nil {
+			hyperv.SyNIC = &api.FeatureState{State: "on"}
+		}
+		if !isFeatureOn(hyperv.SyNIC) {
+			return fmt.Errorf("Hyper-V SyNIC timers require SyNIC")
+		}
+		if err := requireHypervClock(spec); err != nil {
+			return err
+		}
+	}
+	if isFeatureOn(hyperv.SyNIC) {
+		if hyperv.VPIndex == nil {
+			hyperv.VPIndex = &api.FeatureState{State: "on"}
+		}
+		if !isFeatureOn(hyperv.VPIndex) {
+			return fmt.Errorf("Hyper-V SyNIC requires the VP index")
+		}
+	}
+
+	if isFeatureOn(hyperv.Frequencies) {
+		return l.requireFeature(cli.FeatureHypervFrequencies)
+	}
+	return nil
+}
+
+// requireHypervClock adds the hypervclock timer if the guest has none.
+func requireHypervClock(spec *api.DomainSpec) error {
+	if spec.Clock == nil {
+		spec.Clock = &api.Clock{}
+	}
+	for _, timer := range spec.Clock.Timer {
+		if timer.Name != "hypervclock" {
+			continue
+		}
+		if timer.Present == "no" {
+			return fmt.Errorf("Hyper-V SyNIC timers require the hypervclock timer")
+		}
+		return nil
+	}
+	spec.Clock.Timer = append(spec.Clock.Timer, api.Timer{Name: "hypervclock", Present: "yes"})
+	return nil
+}
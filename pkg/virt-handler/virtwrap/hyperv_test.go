@@ -0,0 +1,111 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package virtwrap
+
+import (
+	"encoding/xml"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+)
+
+var _ = Describe("Hyper-V", func() {
+	var ctrl *gomock.Controller
+	var mockConn *cli.MockConnection
+	var manager *LibvirtDomainManager
+	var spec *api.DomainSpec
+
+	on := func() *api.FeatureState {
+		return &api.FeatureState{State: "on"}
+	}
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockConn = cli.NewMockConnection(ctrl)
+		manager = &LibvirtDomainManager{virConn: mockConn}
+		spec = api.NewMinimalDomainSpec("testvm")
+	})
+
+	It("should leave guests without enlightenments alone", func() {
+		Expect(manager.prepareHyperv(spec)).To(Succeed())
+		Expect(spec.Features).To(BeNil())
+		Expect(spec.Clock).To(BeNil())
+	})
+
+	It("should enable what the SyNIC timers depend on", func() {
+		spec.Features = &api.Features{Hyperv: &api.FeatureHyperv{
+			Relaxed:    on(),
+			Spinlocks:  &api.FeatureSpinlocks{State: "on"},
+			SyNICTimer: on(),
+		}}
+		Expect(manager.prepareHyperv(spec)).To(Succeed())
+		Expect(*spec.Features.Hyperv.Spinlocks.Retries).To(Equal(uint32(8191)))
+		Expect(spec.Features.Hyperv.SyNIC).To(Equal(on()))
+		Expect(spec.Features.Hyperv.VPIndex).To(Equal(on()))
+		Expect(spec.Clock.Timer).To(Equal([]api.Timer{{Name: "hypervclock", Present: "yes"}}))
+
+		buf, err := xml.Marshal(spec.Features)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(buf)).To(ContainSubstring(`<spinlocks state="on" retries="8191"></spinlocks>`))
+		Expect(string(buf)).To(ContainSubstring(`<stimer state="on"></stimer>`))
+	})
+
+	It("should reject SyNIC timers without the hypervclock timer", func() {
+		spec.Features = &api.Features{Hyperv: &api.FeatureHyperv{SyNICTimer: on()}}
+		spec.Clock = &api.Clock{Timer: []api.Timer{{Name: "hypervclock", Present: "no"}}}
+		Expect(manager.prepareHyperv(spec)).ToNot(Succeed())
+	})
+
+	It("should reject SyNIC without the VP index", func() {
+		spec.Features = &api.Features{Hyperv: &api.FeatureHyperv{SyNIC: on(), VPIndex: &api.FeatureState{State: "off"}}}
+		Expect(manager.prepareHyperv(spec)).ToNot(Succeed())
+	})
+
+	It("should reject too few spinlock retries", func() {
+		retries := uint32(100)
+		spec.Features = &api.Features{Hyperv: &api.FeatureHyperv{Spinlocks: &api.FeatureSpinlocks{State: "on", Retries: &retries}}}
+		Expect(manager.prepareHyperv(spec)).ToNot(Succeed())
+	})
+
+	It("should reject too long vendor ids", func() {
+		spec.Features = &api.Features{Hyperv: &api.FeatureHyperv{VendorID: &api.FeatureVendorID{State: "on", Value: "KubeVirtKubeVirt"}}}
+		Expect(manager.prepareHyperv(spec)).ToNot(Succeed())
+	})
+
+	It("should reject enlightenments on other architectures", func() {
+		spec.OS.Type.Arch = "aarch64"
+		spec.Features = &api.Features{Hyperv: &api.FeatureHyperv{Relaxed: on()}}
+		Expect(manager.prepareHyperv(spec)).ToNot(Succeed())
+	})
+
+	It("should require a recent hypervisor for the frequency MSRs", func() {
+		spec.Features = &api.Features{Hyperv: &api.FeatureHyperv{Frequencies: on()}}
+		mockConn.EXPECT().GetLibVersion().Return(uint32(3002000), nil)
+		mockConn.EXPECT().GetVersion().Return(uint32(2009000), nil)
+		Expect(manager.prepareHyperv(spec)).ToNot(Succeed())
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+})
@@ -0,0 +1,145 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package virtwrap
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cache"
+)
+
+// libvirt writes the command line and everything qemu prints to stderr,
+// including the reason why it refused to start or crashed, to a log file per
+// domain.
+var qemuLogDir = "/var/log/libvirt/qemu"
+
+var hypervisorLogPollInterval = 1 * time.Second
+
+func hypervisorLogPath(vm *v1.VirtualMachine) string {
+	return filepath.Join(qemuLogDir, cache.VMNamespaceKeyFunc(vm)+".log")
+}
+
+// HypervisorLog opens the qemu log of the VM. If follow is set, reading does
+// not stop at the end of the log but waits for new output until the returned
+// reader is closed.
+func HypervisorLog(vm *v1.VirtualMachine, follow bool) (io.ReadCloser, error) {
+	path := hypervisorLogPath(vm)
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !follow {
+		return file, nil
+	}
+	return &followReader{path: path, file: file, done: make(chan struct{}), interval: hypervisorLogPollInterval}, nil
+}
+
+// followReader keeps reading from the log when reaching its end. The lock
+// makes sure that the file is not closed while it is read.
+type followReader struct {
+	lock     sync.Mutex
+	path     string
+	file     *os.File
+	done     chan struct{}
+	interval time.Duration
+}
+
+func (r *followReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.read(p)
+		if n > 0 || err != nil {
+			return n, err
+		}
+		select {
+		case <-r.done:
+			return 0, io.EOF
+		case <-time.After(r.interval):
+		}
+	}
+}
+
+func (r *followReader) read(p []byte) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	select {
+	case <-r.done:
+		return 0, io.EOF
+	default:
+	}
+	n, err := r.file.Read(p)
+	if n > 0 || err != io.EOF {
+		return n, err
+	}
+	return 0, r.followRotation()
+}
+
+// followRotation switches to the new log once virtlogd rotated the old one
+// away by renaming it, and starts over when the log was truncated in place.
+func (r *followReader) followRotation() error {
+	info, err := r.file.Stat()
+	if err != nil {
+		return err
+	}
+	current, err := os.Stat(r.path)
+	if os.IsNotExist(err) {
+		// The new log is not created yet
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !os.SameFile(info, current) {
+		file, err := os.Open(r.path)
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		r.file.Close()
+		r.file = file
+		return nil
+	}
+
+	offset, err := r.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if info.Size() < offset {
+		_, err = r.file.Seek(0, io.SeekStart)
+	}
+	return err
+}
+
+func (r *followReader) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	select {
+	case <-r.done:
+		return nil
+	default:
+	}
+	close(r.done)
+	return r.file.Close()
+}
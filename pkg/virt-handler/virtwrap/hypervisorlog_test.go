@@ -0,0 +1,141 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package virtwrap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Hypervisor log", func() {
+	var tmpDir string
+	var originalLogDir string
+	var originalInterval time.Duration
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "qemulog")
+		Expect(err).ToNot(HaveOccurred())
+		originalLogDir = qemuLogDir
+		qemuLogDir = tmpDir
+		originalInterval = hypervisorLogPollInterval
+		hypervisorLogPollInterval = 10 * time.Millisecond
+	})
+
+	writeLog := func(content string) {
+		f, err := os.OpenFile(filepath.Join(tmpDir, "default_testvm.log"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		Expect(err).ToNot(HaveOccurred())
+		defer f.Close()
+		_, err = f.WriteString(content)
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	It("should return the log of the VM", func() {
+		writeLog("qemu-system-x86_64: -drive file=/disk.img: Could not open '/disk.img'\n")
+
+		log, err := HypervisorLog(newVM("default", "testvm"), false)
+		Expect(err).ToNot(HaveOccurred())
+		defer log.Close()
+		content, err := ioutil.ReadAll(log)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(content)).To(ContainSubstring("Could not open"))
+	})
+
+	It("should fail if the VM has no log", func() {
+		_, err := HypervisorLog(newVM("default", "testvm"), false)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	It("should follow the log until it is closed", func() {
+		writeLog("starting\n")
+
+		log, err := HypervisorLog(newVM("default", "testvm"), true)
+		Expect(err).ToNot(HaveOccurred())
+
+		done := make(chan string)
+		go func() {
+			defer GinkgoRecover()
+			content, err := ioutil.ReadAll(log)
+			Expect(err).ToNot(HaveOccurred())
+			done <- string(content)
+		}()
+
+		writeLog("2017-11-02 shutting down, reason=crashed\n")
+		Consistently(done, 50*time.Millisecond).ShouldNot(Receive())
+		Expect(log.Close()).To(Succeed())
+		Eventually(done).Should(Receive(Equal("starting\n2017-11-02 shutting down, reason=crashed\n")))
+	})
+
+	It("should follow the log across rotations", func() {
+		writeLog("before rotation\n")
+
+		log, err := HypervisorLog(newVM("default", "testvm"), true)
+		Expect(err).ToNot(HaveOccurred())
+
+		done := make(chan string)
+		go func() {
+			defer GinkgoRecover()
+			content, err := ioutil.ReadAll(log)
+			Expect(err).ToNot(HaveOccurred())
+			done <- string(content)
+		}()
+
+		Consistently(done, 50*time.Millisecond).ShouldNot(Receive())
+		path := filepath.Join(tmpDir, "default_testvm.log")
+		Expect(os.Rename(path, path+".0")).To(Succeed())
+		writeLog("after rotation\n")
+		time.Sleep(50 * time.Millisecond)
+		Expect(log.Close()).To(Succeed())
+		Eventually(done).Should(Receive(Equal("before rotation\nafter rotation\n")))
+	})
+
+	It("should start over when the log was truncated", func() {
+		writeLog("before truncation\n")
+
+		log, err := HypervisorLog(newVM("default", "testvm"), true)
+		Expect(err).ToNot(HaveOccurred())
+
+		done := make(chan string)
+		go func() {
+			defer GinkgoRecover()
+			content, err := ioutil.ReadAll(log)
+			Expect(err).ToNot(HaveOccurred())
+			done <- string(content)
+		}()
+
+		Consistently(done, 50*time.Millisecond).ShouldNot(Receive())
+		Expect(os.Truncate(filepath.Join(tmpDir, "default_testvm.log"), 0)).To(Succeed())
+		time.Sleep(50 * time.Millisecond)
+		writeLog("after\n")
+		time.Sleep(50 * time.Millisecond)
+		Expect(log.Close()).To(Succeed())
+		Eventually(done).Should(Receive(Equal("before truncation\nafter\n")))
+	})
+
+	AfterEach(func() {
+		qemuLogDir = originalLogDir
+		hypervisorLogPollInterval = originalInterval
+		os.RemoveAll(tmpDir)
+	})
+})
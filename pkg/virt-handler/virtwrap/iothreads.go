@@ -0,0 +1,88 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"fmt"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+)
+
+const (
+	ioThreadsPolicyShared = "shared"
+	ioThreadsPolicyAuto   = "auto"
+)
+
+// prepareIOThreads assigns the virtio disks without an explicit IOThread to
+// IOThreads according to the IOThreads policy of the VM and makes sure that
+// the domain has enough IOThreads for all disks. Like for multiple queues,
+// disks without a driver are left alone.
+func prepareIOThreads(vm *v1.VirtualMachine, spec *api.DomainSpec) error {
+	policy := ""
+	if vm.Spec.Domain != nil {
+		policy = vm.Spec.Domain.IOThreadsPolicy
+	}
+	if policy != "" && policy != ioThreadsPolicyShared && policy != ioThreadsPolicyAuto {
+		return fmt.Errorf("unsupported IOThreads policy %s", policy)
+	}
+
+	var count uint
+	if spec.IOThreads != nil {
+		count = spec.IOThreads.Count
+	}
+
+	// Explicit assignments are only checked after all automatic IOThreads
+	// were added
+	var sharedIOThread uint
+	for i := range spec.Devices.Disks {
+		disk := &spec.Devices.Disks[i]
+		if policy == "" || !isVirtioDisk(disk) || disk.Driver == nil || disk.Driver.IOThread > 0 {
+			continue
+		}
+		if policy == ioThreadsPolicyShared {
+			if sharedIOThread == 0 {
+				count++
+				sharedIOThread = count
+			}
+			disk.Driver.IOThread = sharedIOThread
+		} else {
+			count++
+			disk.Driver.IOThread = count
+		}
+	}
+
+	for _, disk := range spec.Devices.Disks {
+		if disk.Driver == nil || disk.Driver.IOThread == 0 {
+			continue
+		}
+		if !isVirtioDisk(&disk) {
+			return fmt.Errorf("disk %s needs the virtio bus to use an IOThread", disk.Target.Device)
+		}
+		if disk.Driver.IOThread > count {
+			return fmt.Errorf("disk %s uses IOThread %d, but the domain only has %d", disk.Target.Device, disk.Driver.IOThread, count)
+		}
+	}
+
+	if count > 0 {
+		spec.IOThreads = &api.IOThreads{Count: count}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+)
+
+var _ = Describe("IOThreads", func() {
+
+	newSpec := func() *api.DomainSpec {
+		spec := api.NewMinimalDomainSpec("testvm")
+		for _, dev := range []string{"vda", "vdb", "vdc"} {
+			spec.Devices.Disks = append(spec.Devices.Disks, api.Disk{
+				Type:   "file",
+				Device: "disk",
+				Source: api.DiskSource{File: "/var/run/kubevirt/" + dev + ".img"},
+				Target: api.DiskTarget{Device: dev, Bus: "virtio"},
+				Driver: &api.DiskDriver{Name: "qemu", Type: "raw"},
+			})
+		}
+		return spec
+	}
+
+	ioThreadsOf := func(spec *api.DomainSpec) []uint {
+		ids := []uint{}
+		for _, disk := range spec.Devices.Disks {
+			ids = append(ids, disk.Driver.IOThread)
+		}
+		return ids
+	}
+
+	It("should let all disks share one IOThread", func() {
+		vm := newVM("default", "testvm")
+		vm.Spec.Domain.IOThreadsPolicy = "shared"
+		spec := newSpec()
+		Expect(prepareIOThreads(vm, spec)).To(Succeed())
+		Expect(spec.IOThreads).To(Equal(&api.IOThreads{Count: 1}))
+		Expect(ioThreadsOf(spec)).To(Equal([]uint{1, 1, 1}))
+	})
+
+	It("should give every disk its own IOThread", func() {
+		vm := newVM("default", "testvm")
+		vm.Spec.Domain.IOThreadsPolicy = "auto"
+		spec := newSpec()
+		spec.IOThreads = &api.IOThreads{Count: 1}
+		spec.Devices.Disks[0].Driver.IOThread = 1
+		Expect(prepareIOThreads(vm, spec)).To(Succeed())
+		Expect(spec.IOThreads).To(Equal(&api.IOThreads{Count: 3}))
+		Expect(ioThreadsOf(spec)).To(Equal([]uint{1, 2, 3}))
+	})
+
+	It("should keep explicit assignments without a policy", func() {
+		spec := newSpec()
+		spec.IOThreads = &api.IOThreads{Count: 2}
+		spec.Devices.Disks[1].Driver.IOThread = 2
+		Expect(prepareIOThreads(newVM("default", "testvm"), spec)).To(Succeed())
+		Expect(ioThreadsOf(spec)).To(Equal([]uint{0, 2, 0}))
+	})
+
+	It("should reject assignments to missing IOThreads", func() {
+		spec := newSpec()
+		spec.Devices.Disks[0].Driver.IOThread = 1
+		Expect(prepareIOThreads(newVM("default", "testvm"), spec)).ToNot(Succeed())
+	})
+
+	It("should reject unknown policies", func() {
+		vm := newVM("default", "testvm")
+		vm.Spec.Domain.IOThreadsPolicy = "dedicated"
+		Expect(prepareIOThreads(vm, newSpec())).ToNot(Succeed())
+	})
+})
@@ -0,0 +1,89 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+// syncBlockIoTune applies changed IO limits to the disks of a running domain.
+// Disks without IO limits in the spec are set back to unlimited. It returns
+// whether any limit was changed.
+func (l *LibvirtDomainManager) syncBlockIoTune(vm *v1.VirtualMachine, dom cli.VirDomain, spec *api.DomainSpec) (bool, error) {
+	changed := false
+	for _, disk := range spec.Devices.Disks {
+		if disk.Device != "disk" {
+			continue
+		}
+		target := disk.Target.Device
+		current, err := dom.GetBlockIoTune(target, libvirt.DOMAIN_AFFECT_LIVE)
+		if err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msgf("Getting the IO limits of disk %s failed.", target)
+			return changed, err
+		}
+
+		wanted := newBlockIoTuneParameters(disk.IOTune)
+		if blockIoTuneEqual(current, wanted) {
+			continue
+		}
+		err = dom.SetBlockIoTune(target, wanted, libvirt.DOMAIN_AFFECT_LIVE)
+		l.audit(vm, TriggerVMController, "set-block-iotune", map[string]interface{}{"disk": target, "iotune": disk.IOTune}, err)
+		if err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msgf("Setting the IO limits of disk %s failed.", target)
+			return changed, err
+		}
+		changed = true
+		logging.DefaultLogger().Object(vm).Info().Msgf("IO limits of disk %s updated.", target)
+	}
+	return changed, nil
+}
+
+func newBlockIoTuneParameters(ioTune *api.DiskIOTune) *libvirt.DomainBlockIoTuneParameters {
+	if ioTune == nil {
+		ioTune = &api.DiskIOTune{}
+	}
+	return &libvirt.DomainBlockIoTuneParameters{
+		TotalBytesSecSet: true,
+		TotalBytesSec:    ioTune.TotalBytesSec,
+		ReadBytesSecSet:  true,
+		ReadBytesSec:     ioTune.ReadBytesSec,
+		WriteBytesSecSet: true,
+		WriteBytesSec:    ioTune.WriteBytesSec,
+		TotalIopsSecSet:  true,
+		TotalIopsSec:     ioTune.TotalIopsSec,
+		ReadIopsSecSet:   true,
+		ReadIopsSec:      ioTune.ReadIopsSec,
+		WriteIopsSecSet:  true,
+		WriteIopsSec:     ioTune.WriteIopsSec,
+	}
+}
+
+func blockIoTuneEqual(current *libvirt.DomainBlockIoTuneParameters, wanted *libvirt.DomainBlockIoTuneParameters) bool {
+	return current.TotalBytesSec == wanted.TotalBytesSec &&
+		current.ReadBytesSec == wanted.ReadBytesSec &&
+		current.WriteBytesSec == wanted.WriteBytesSec &&
+		current.TotalIopsSec == wanted.TotalIopsSec &&
+		current.ReadIopsSec == wanted.ReadIopsSec &&
+		current.WriteIopsSec == wanted.WriteIopsSec
+}
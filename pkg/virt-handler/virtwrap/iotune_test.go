@@ -0,0 +1,77 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Block IO tuning", func() {
+	var ctrl *gomock.Controller
+	var mockDomain *cli.MockVirDomain
+	var manager *LibvirtDomainManager
+	var spec *api.DomainSpec
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockDomain = cli.NewMockVirDomain(ctrl)
+		manager = &LibvirtDomainManager{}
+		spec = api.NewMinimalDomainSpec("testvm")
+		spec.Devices.Disks = []api.Disk{
+			{
+				Type:   "file",
+				Device: "disk",
+				Target: api.DiskTarget{Device: "vda"},
+				IOTune: &api.DiskIOTune{TotalIopsSec: 500},
+			},
+		}
+	})
+
+	It("should apply changed limits to the running domain", func() {
+		mockDomain.EXPECT().GetBlockIoTune("vda", libvirt.DOMAIN_AFFECT_LIVE).Return(&libvirt.DomainBlockIoTuneParameters{TotalIopsSec: 100}, nil)
+		mockDomain.EXPECT().SetBlockIoTune("vda", newBlockIoTuneParameters(spec.Devices.Disks[0].IOTune), libvirt.DOMAIN_AFFECT_LIVE).Return(nil)
+
+		Expect(manager.syncBlockIoTune(newVM("default", "testvm"), mockDomain, spec)).To(BeTrue())
+	})
+
+	It("should leave matching limits alone", func() {
+		mockDomain.EXPECT().GetBlockIoTune("vda", libvirt.DOMAIN_AFFECT_LIVE).Return(&libvirt.DomainBlockIoTuneParameters{TotalIopsSec: 500}, nil)
+
+		Expect(manager.syncBlockIoTune(newVM("default", "testvm"), mockDomain, spec)).To(BeFalse())
+	})
+
+	It("should remove limits which are gone from the spec", func() {
+		spec.Devices.Disks[0].IOTune = nil
+		mockDomain.EXPECT().GetBlockIoTune("vda", libvirt.DOMAIN_AFFECT_LIVE).Return(&libvirt.DomainBlockIoTuneParameters{TotalIopsSec: 500}, nil)
+		mockDomain.EXPECT().SetBlockIoTune("vda", newBlockIoTuneParameters(nil), libvirt.DOMAIN_AFFECT_LIVE).Return(nil)
+
+		Expect(manager.syncBlockIoTune(newVM("default", "testvm"), mockDomain, spec)).To(BeTrue())
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+})
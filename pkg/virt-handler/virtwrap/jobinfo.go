@@ -0,0 +1,106 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cache"
+	domainerrors "kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/errors"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var jobTypeTranslationMap = map[libvirt.DomainJobType]api.JobType{
+	libvirt.DOMAIN_JOB_NONE:      api.JobNone,
+	libvirt.DOMAIN_JOB_BOUNDED:   api.JobBounded,
+	libvirt.DOMAIN_JOB_UNBOUNDED: api.JobUnbounded,
+	libvirt.DOMAIN_JOB_COMPLETED: api.JobCompleted,
+	libvirt.DOMAIN_JOB_FAILED:    api.JobFailed,
+	libvirt.DOMAIN_JOB_CANCELLED: api.JobCancelled,
+}
+
+func newDomainJobInfo(info *libvirt.DomainJobInfo) *api.DomainJobInfo {
+	return &api.DomainJobInfo{
+		Type:          jobTypeTranslationMap[info.Type],
+		TimeElapsed:   info.TimeElapsed,
+		TimeRemaining: info.TimeRemaining,
+		DataTotal:     info.DataTotal,
+		DataProcessed: info.DataProcessed,
+		DataRemaining: info.DataRemaining,
+		MemTotal:      info.MemTotal,
+		MemProcessed:  info.MemProcessed,
+		MemRemaining:  info.MemRemaining,
+		MemBps:        info.MemBps,
+		MemDirtyRate:  info.MemDirtyRate,
+		MemIteration:  info.MemIteration,
+		Downtime:      info.Downtime,
+	}
+}
+
+// GetJobInfo returns the progress of the current job of the domain, e.g. of
+// an outgoing migration.
+func (l *LibvirtDomainManager) GetJobInfo(vm *v1.VirtualMachine) (*api.DomainJobInfo, error) {
+	dom, err := l.virConn.LookupDomainByName(cache.VMNamespaceKeyFunc(vm))
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain failed.")
+		return nil, err
+	}
+	defer dom.Free()
+
+	info, err := dom.GetJobStats(0)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain job stats failed.")
+		return nil, err
+	}
+	return newDomainJobInfo(info), nil
+}
+
+// AbortJob cancels the current job of the domain. It is not an error if the
+// domain or the job is already gone. It deliberately does not take the
+// domain lock, aborting must not wait for the operation it should stop.
+func (l *LibvirtDomainManager) AbortJob(vm *v1.VirtualMachine) error {
+	err := l.abortJob(vm)
+	l.audit(vm, TriggerVMController, "abort-job", nil, err)
+	return err
+}
+
+func (l *LibvirtDomainManager) abortJob(vm *v1.VirtualMachine) error {
+	dom, err := l.virConn.LookupDomainByName(cache.VMNamespaceKeyFunc(vm))
+	if err != nil {
+		if domainerrors.IsNotFound(err) {
+			return nil
+		}
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain failed.")
+		return err
+	}
+	defer dom.Free()
+
+	if err := dom.AbortJob(); err != nil {
+		// libvirt reports an invalid operation if there is no job to abort
+		if domainerrors.IsInvalidOperation(err) {
+			return nil
+		}
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Aborting the domain job failed.")
+		return err
+	}
+	logging.DefaultLogger().Object(vm).Info().Msg("Domain job aborted.")
+	return nil
+}
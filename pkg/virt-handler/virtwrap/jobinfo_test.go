@@ -0,0 +1,89 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Domain jobs", func() {
+	var ctrl *gomock.Controller
+	var mockConn *cli.MockConnection
+	var mockDomain *cli.MockVirDomain
+	var manager *LibvirtDomainManager
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockConn = cli.NewMockConnection(ctrl)
+		mockDomain = cli.NewMockVirDomain(ctrl)
+		manager = &LibvirtDomainManager{virConn: mockConn}
+	})
+
+	It("should report the progress of a migration", func() {
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+		mockDomain.EXPECT().GetJobStats(libvirt.DomainGetJobStatsFlags(0)).Return(&libvirt.DomainJobInfo{
+			Type:         libvirt.DOMAIN_JOB_UNBOUNDED,
+			MemTotal:     1024,
+			MemRemaining: 512,
+			MemBps:       128,
+			MemIteration: 3,
+		}, nil)
+		mockDomain.EXPECT().Free()
+
+		info, err := manager.GetJobInfo(newVM("default", "testvm"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(*info).To(Equal(api.DomainJobInfo{
+			Type:         api.JobUnbounded,
+			MemTotal:     1024,
+			MemRemaining: 512,
+			MemBps:       128,
+			MemIteration: 3,
+		}))
+	})
+
+	It("should abort the job of a domain", func() {
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+		mockDomain.EXPECT().AbortJob().Return(nil)
+		mockDomain.EXPECT().Free()
+		Expect(manager.AbortJob(newVM("default", "testvm"))).To(Succeed())
+	})
+
+	It("should ignore domains without a job", func() {
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+		mockDomain.EXPECT().AbortJob().Return(libvirt.Error{Code: libvirt.ERR_OPERATION_INVALID})
+		mockDomain.EXPECT().Free()
+		Expect(manager.AbortJob(newVM("default", "testvm"))).To(Succeed())
+	})
+
+	It("should ignore missing domains", func() {
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(nil, libvirt.Error{Code: libvirt.ERR_NO_DOMAIN})
+		Expect(manager.AbortJob(newVM("default", "testvm"))).To(Succeed())
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+})
@@ -0,0 +1,234 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package jobs
+
+//go:generate mockgen -source $GOFILE -package=$GOPACKAGE -destination=generated_mock_$GOFILE
+
+/*
+ ATTENTION: Rerun code generators when interface signatures are modified.
+*/
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/satori/go.uuid"
+
+	"kubevirt.io/kubevirt/pkg/logging"
+)
+
+type JobType string
+
+const (
+	CoreDump   JobType = "CoreDump"
+	MemoryDump JobType = "MemoryDump"
+)
+
+type JobPhase string
+
+const (
+	Running   JobPhase = "Running"
+	Succeeded JobPhase = "Succeeded"
+	Failed    JobPhase = "Failed"
+	Cancelled JobPhase = "Cancelled"
+)
+
+// Job is a snapshot of the state of a long-running domain operation.
+type Job struct {
+	ID       string
+	Type     JobType
+	Domain   string
+	Phase    JobPhase
+	Progress uint
+	Error    string
+	Started  time.Time
+	Finished time.Time
+}
+
+func (j *Job) IsFinished() bool {
+	return j.Phase != Running
+}
+
+// JobFunc runs the operation. It can report its progress in percent through
+// the progress function.
+type JobFunc func(progress func(percent uint)) error
+
+// CancelFunc asks a running operation to stop, e.g. by aborting the libvirt
+// job of the domain. The JobFunc is expected to return afterwards.
+type CancelFunc func() error
+
+// JobManager runs long domain operations in the background. Jobs are kept
+// independently of the libvirt connection, so that they can still be queried
+// after a reconnect. libvirt only allows one job per domain at a time.
+type JobManager interface {
+	Start(domain string, jobType JobType, run JobFunc, cancel CancelFunc) (string, error)
+	Get(id string) (Job, error)
+	List() []Job
+	Cancel(id string) error
+	Remove(id string) error
+}
+
+type jobEntry struct {
+	job       Job
+	cancel    CancelFunc
+	cancelled bool
+}
+
+type jobManager struct {
+	lock *sync.Mutex
+	jobs map[string]*jobEntry
+}
+
+func NewJobManager() JobManager {
+	return &jobManager{
+		lock: &sync.Mutex{},
+		jobs: make(map[string]*jobEntry),
+	}
+}
+
+func (m *jobManager) Start(domain string, jobType JobType, run JobFunc, cancel CancelFunc) (string, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for _, entry := range m.jobs {
+		if entry.job.Domain == domain && !entry.job.IsFinished() {
+			return "", fmt.Errorf("domain %s already has a running %s job %s", domain, entry.job.Type, entry.job.ID)
+		}
+	}
+
+	entry := &jobEntry{
+		job: Job{
+			ID:      uuid.NewV4().String(),
+			Type:    jobType,
+			Domain:  domain,
+			Phase:   Running,
+			Started: time.Now(),
+		},
+		cancel: cancel,
+	}
+	m.jobs[entry.job.ID] = entry
+
+	go func() {
+		err := run(func(percent uint) {
+			m.lock.Lock()
+			defer m.lock.Unlock()
+			if percent > 100 {
+				percent = 100
+			}
+			entry.job.Progress = percent
+		})
+		m.finish(entry, err)
+	}()
+
+	logging.DefaultLogger().Info().Msgf("%s job %s for domain %s started.", jobType, entry.job.ID, domain)
+	return entry.job.ID, nil
+}
+
+func (m *jobManager) finish(entry *jobEntry, err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	entry.job.Finished = time.Now()
+	switch {
+	case entry.cancelled:
+		entry.job.Phase = Cancelled
+	case err != nil:
+		entry.job.Phase = Failed
+		entry.job.Error = err.Error()
+	default:
+		entry.job.Phase = Succeeded
+		entry.job.Progress = 100
+	}
+	if err != nil {
+		logging.DefaultLogger().Error().Reason(err).Msgf("%s job %s for domain %s finished.", entry.job.Type, entry.job.ID, entry.job.Domain)
+	} else {
+		logging.DefaultLogger().Info().Msgf("%s job %s for domain %s finished.", entry.job.Type, entry.job.ID, entry.job.Domain)
+	}
+}
+
+func (m *jobManager) Get(id string) (Job, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	entry, exists := m.jobs[id]
+	if !exists {
+		return Job{}, fmt.Errorf("job %s does not exist", id)
+	}
+	return entry.job, nil
+}
+
+func (m *jobManager) List() []Job {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	jobs := make([]Job, 0, len(m.jobs))
+	for _, entry := range m.jobs {
+		jobs = append(jobs, entry.job)
+	}
+	return jobs
+}
+
+// Cancel asks a running job to stop. The job is marked as cancelled once its
+// operation returned.
+func (m *jobManager) Cancel(id string) error {
+	m.lock.Lock()
+	entry, exists := m.jobs[id]
+	if !exists {
+		m.lock.Unlock()
+		return fmt.Errorf("job %s does not exist", id)
+	}
+	if entry.job.IsFinished() {
+		m.lock.Unlock()
+		return nil
+	}
+	if entry.cancel == nil {
+		m.lock.Unlock()
+		return fmt.Errorf("%s job %s can't be cancelled", entry.job.Type, id)
+	}
+	entry.cancelled = true
+	cancel := entry.cancel
+	m.lock.Unlock()
+
+	// Don't hold the lock, the operation might report progress while it stops
+	if err := cancel(); err != nil {
+		m.lock.Lock()
+		entry.cancelled = false
+		m.lock.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Remove forgets a finished job.
+func (m *jobManager) Remove(id string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	entry, exists := m.jobs[id]
+	if !exists {
+		return nil
+	}
+	if !entry.job.IsFinished() {
+		return fmt.Errorf("job %s is still running", id)
+	}
+	delete(m.jobs, id)
+	return nil
+}
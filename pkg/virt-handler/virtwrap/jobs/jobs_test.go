@@ -0,0 +1,124 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package jobs_test
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/jobs"
+)
+
+var _ = Describe("Jobs", func() {
+	var manager JobManager
+
+	BeforeEach(func() {
+		manager = NewJobManager()
+	})
+
+	phase := func(id string) func() JobPhase {
+		return func() JobPhase {
+			job, err := manager.Get(id)
+			Expect(err).ToNot(HaveOccurred())
+			return job.Phase
+		}
+	}
+
+	It("should report progress and success", func() {
+		proceed := make(chan struct{})
+		id, err := manager.Start("default_testvm", MemoryDump, func(progress func(uint)) error {
+			progress(42)
+			<-proceed
+			return nil
+		}, nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		Eventually(func() uint {
+			job, _ := manager.Get(id)
+			return job.Progress
+		}).Should(Equal(uint(42)))
+		Expect(phase(id)()).To(Equal(Running))
+
+		close(proceed)
+		Eventually(phase(id)).Should(Equal(Succeeded))
+		job, _ := manager.Get(id)
+		Expect(job.Progress).To(Equal(uint(100)))
+		Expect(job.Type).To(Equal(MemoryDump))
+		Expect(job.Domain).To(Equal("default_testvm"))
+	})
+
+	It("should record failures", func() {
+		id, err := manager.Start("default_testvm", CoreDump, func(progress func(uint)) error {
+			return fmt.Errorf("disk full")
+		}, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(phase(id)).Should(Equal(Failed))
+		job, _ := manager.Get(id)
+		Expect(job.Error).To(Equal("disk full"))
+	})
+
+	It("should allow only one running job per domain", func() {
+		proceed := make(chan struct{})
+		defer close(proceed)
+		_, err := manager.Start("default_testvm", MemoryDump, func(progress func(uint)) error {
+			<-proceed
+			return nil
+		}, nil)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = manager.Start("default_testvm", CoreDump, func(progress func(uint)) error { return nil }, nil)
+		Expect(err).To(HaveOccurred())
+		_, err = manager.Start("default_othervm", CoreDump, func(progress func(uint)) error { return nil }, nil)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should cancel a running job", func() {
+		abort := make(chan struct{})
+		id, err := manager.Start("default_testvm", MemoryDump, func(progress func(uint)) error {
+			<-abort
+			return fmt.Errorf("operation aborted")
+		}, func() error {
+			close(abort)
+			return nil
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(manager.Cancel(id)).To(Succeed())
+		Eventually(phase(id)).Should(Equal(Cancelled))
+	})
+
+	It("should only remove finished jobs", func() {
+		proceed := make(chan struct{})
+		id, err := manager.Start("default_testvm", MemoryDump, func(progress func(uint)) error {
+			<-proceed
+			return nil
+		}, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(manager.Remove(id)).ToNot(Succeed())
+		Expect(manager.Cancel(id)).ToNot(Succeed())
+
+		close(proceed)
+		Eventually(phase(id)).Should(Equal(Succeeded))
+		Expect(manager.Remove(id)).To(Succeed())
+		Expect(manager.List()).To(BeEmpty())
+		_, err = manager.Get(id)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,39 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+)
+
+// prepareKernelBoot points the domain at the host copies of the kernel and
+// the initrd, which the virt-handler mapped before. Direct kernel boot
+// bypasses the bootloader, so any boot order is dropped.
+func prepareKernelBoot(vm *v1.VirtualMachine, spec *api.DomainSpec) {
+	if vm.Spec.Domain == nil || vm.Spec.Domain.OS.KernelBoot == nil {
+		return
+	}
+	kernelBoot := vm.Spec.Domain.OS.KernelBoot
+	spec.OS.Kernel = kernelBoot.Kernel
+	spec.OS.Initrd = kernelBoot.Initrd
+	spec.OS.KernelArgs = kernelBoot.KernelArgs
+	spec.OS.BootOrder = nil
+}
@@ -0,0 +1,53 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+)
+
+var _ = Describe("Kernel boot", func() {
+	It("should boot from the mapped kernel and initrd", func() {
+		vm := newVM("default", "testvm")
+		vm.Spec.Domain.OS.KernelBoot = &v1.KernelBoot{
+			Kernel:     "/var/run/kernel/kernel",
+			Initrd:     "/var/run/kernel/initrd",
+			KernelArgs: "console=ttyS0",
+		}
+		spec := api.NewMinimalDomainSpec("testvm")
+		spec.OS.BootOrder = []api.Boot{{Dev: "hd"}}
+
+		prepareKernelBoot(vm, spec)
+		Expect(spec.OS.Kernel).To(Equal("/var/run/kernel/kernel"))
+		Expect(spec.OS.Initrd).To(Equal("/var/run/kernel/initrd"))
+		Expect(spec.OS.KernelArgs).To(Equal("console=ttyS0"))
+		Expect(spec.OS.BootOrder).To(BeEmpty())
+	})
+
+	It("should leave other VMs alone", func() {
+		spec := api.NewMinimalDomainSpec("testvm")
+		prepareKernelBoot(newVM("default", "testvm"), spec)
+		Expect(spec.OS.Kernel).To(BeEmpty())
+	})
+})
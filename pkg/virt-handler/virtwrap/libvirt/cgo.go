@@ -0,0 +1,327 @@
+//go:build cgo && !libvirt_rpc
+// +build cgo,!libvirt_rpc
+
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package libvirt
+
+import (
+	libvirt "github.com/libvirt/libvirt-go"
+)
+
+// The libvirt-go binding of the C library is the default, everything is
+// passed through.
+
+// Driver names the implementation of the libvirt API in this build.
+const Driver = "cgo"
+
+type (
+	Connect                                = libvirt.Connect
+	ConnectAuth                            = libvirt.ConnectAuth
+	ConnectAuthCallback                    = libvirt.ConnectAuthCallback
+	ConnectCredential                      = libvirt.ConnectCredential
+	ConnectCredentialType                  = libvirt.ConnectCredentialType
+	ConnectDomainEventAgentLifecycleReason = libvirt.ConnectDomainEventAgentLifecycleReason
+	ConnectDomainEventAgentLifecycleState  = libvirt.ConnectDomainEventAgentLifecycleState
+	ConnectFlags                           = libvirt.ConnectFlags
+	ConnectGetAllDomainStatsFlags          = libvirt.ConnectGetAllDomainStatsFlags
+	ConnectListAllDomainsFlags             = libvirt.ConnectListAllDomainsFlags
+	ConnectListAllNodeDeviceFlags          = libvirt.ConnectListAllNodeDeviceFlags
+	ConnectListAllSecretsFlags             = libvirt.ConnectListAllSecretsFlags
+	ConnectListAllStoragePoolsFlags        = libvirt.ConnectListAllStoragePoolsFlags
+	Domain                                 = libvirt.Domain
+	DomainBlkioParameters                  = libvirt.DomainBlkioParameters
+	DomainBlockInfo                        = libvirt.DomainBlockInfo
+	DomainBlockIoTuneParameters            = libvirt.DomainBlockIoTuneParameters
+	DomainBlockResizeFlags                 = libvirt.DomainBlockResizeFlags
+	DomainCPUStats                         = libvirt.DomainCPUStats
+	DomainChannelFlags                     = libvirt.DomainChannelFlags
+	DomainConsoleFlags                     = libvirt.DomainConsoleFlags
+	DomainCoreDumpFlags                    = libvirt.DomainCoreDumpFlags
+	DomainCoreDumpFormat                   = libvirt.DomainCoreDumpFormat
+	DomainCrashedReason                    = libvirt.DomainCrashedReason
+	DomainCreateFlags                      = libvirt.DomainCreateFlags
+	DomainDefineFlags                      = libvirt.DomainDefineFlags
+	DomainEventAgentLifecycle              = libvirt.DomainEventAgentLifecycle
+	DomainEventAgentLifecycleCallback      = libvirt.DomainEventAgentLifecycleCallback
+	DomainEventDefinedDetailType           = libvirt.DomainEventDefinedDetailType
+	DomainEventDeviceAdded                 = libvirt.DomainEventDeviceAdded
+	DomainEventDeviceAddedCallback         = libvirt.DomainEventDeviceAddedCallback
+	DomainEventDeviceRemoved               = libvirt.DomainEventDeviceRemoved
+	DomainEventDeviceRemovedCallback       = libvirt.DomainEventDeviceRemovedCallback
+	DomainEventLifecycle                   = libvirt.DomainEventLifecycle
+	DomainEventLifecycleCallback           = libvirt.DomainEventLifecycleCallback
+	DomainEventRTCChange                   = libvirt.DomainEventRTCChange
+	DomainEventRTCChangeCallback           = libvirt.DomainEventRTCChangeCallback
+	DomainEventType                        = libvirt.DomainEventType
+	DomainEventWatchdog                    = libvirt.DomainEventWatchdog
+	DomainEventWatchdogAction              = libvirt.DomainEventWatchdogAction
+	DomainEventWatchdogCallback            = libvirt.DomainEventWatchdogCallback
+	DomainGetJobStatsFlags                 = libvirt.DomainGetJobStatsFlags
+	DomainIPAddress                        = libvirt.DomainIPAddress
+	DomainInterface                        = libvirt.DomainInterface
+	DomainInterfaceAddressesSource         = libvirt.DomainInterfaceAddressesSource
+	DomainInterfaceParameters              = libvirt.DomainInterfaceParameters
+	DomainJobInfo                          = libvirt.DomainJobInfo
+	DomainJobType                          = libvirt.DomainJobType
+	DomainMemoryParameters                 = libvirt.DomainMemoryParameters
+	DomainMemoryStat                       = libvirt.DomainMemoryStat
+	DomainMemoryStatTags                   = libvirt.DomainMemoryStatTags
+	DomainMetadataType                     = libvirt.DomainMetadataType
+	DomainModificationImpact               = libvirt.DomainModificationImpact
+	DomainPausedReason                     = libvirt.DomainPausedReason
+	DomainPerfEvents                       = libvirt.DomainPerfEvents
+	DomainQemuAgentCommandTimeout          = libvirt.DomainQemuAgentCommandTimeout
+	DomainQemuMonitorCommandFlags          = libvirt.DomainQemuMonitorCommandFlags
+	DomainRunningReason                    = libvirt.DomainRunningReason
+	DomainSchedulerParameters              = libvirt.DomainSchedulerParameters
+	DomainShutdownReason                   = libvirt.DomainShutdownReason
+	DomainShutoffReason                    = libvirt.DomainShutoffReason
+	DomainState                            = libvirt.DomainState
+	DomainStats                            = libvirt.DomainStats
+	DomainStatsBalloon                     = libvirt.DomainStatsBalloon
+	DomainStatsBlock                       = libvirt.DomainStatsBlock
+	DomainStatsCPU                         = libvirt.DomainStatsCPU
+	DomainStatsNet                         = libvirt.DomainStatsNet
+	DomainStatsPerf                        = libvirt.DomainStatsPerf
+	DomainStatsState                       = libvirt.DomainStatsState
+	DomainStatsTypes                       = libvirt.DomainStatsTypes
+	DomainStatsVcpu                        = libvirt.DomainStatsVcpu
+	DomainUndefineFlagsValues              = libvirt.DomainUndefineFlagsValues
+	DomainXMLFlags                         = libvirt.DomainXMLFlags
+	Error                                  = libvirt.Error
+	ErrorDomain                            = libvirt.ErrorDomain
+	ErrorLevel                             = libvirt.ErrorLevel
+	ErrorNumber                            = libvirt.ErrorNumber
+	KeycodeSet                             = libvirt.KeycodeSet
+	NWFilter                               = libvirt.NWFilter
+	NodeDevice                             = libvirt.NodeDevice
+	Secret                                 = libvirt.Secret
+	SecretUsageType                        = libvirt.SecretUsageType
+	StoragePool                            = libvirt.StoragePool
+	StoragePoolBuildFlags                  = libvirt.StoragePoolBuildFlags
+	StoragePoolCreateFlags                 = libvirt.StoragePoolCreateFlags
+	StorageVol                             = libvirt.StorageVol
+	StorageVolCreateFlags                  = libvirt.StorageVolCreateFlags
+	StorageVolDeleteFlags                  = libvirt.StorageVolDeleteFlags
+	StorageVolDownloadFlags                = libvirt.StorageVolDownloadFlags
+	StorageVolInfo                         = libvirt.StorageVolInfo
+	StorageVolResizeFlags                  = libvirt.StorageVolResizeFlags
+	StorageVolType                         = libvirt.StorageVolType
+	StorageVolUploadFlags                  = libvirt.StorageVolUploadFlags
+	StorageXMLFlags                        = libvirt.StorageXMLFlags
+	Stream                                 = libvirt.Stream
+	StreamEventCallback                    = libvirt.StreamEventCallback
+	StreamEventType                        = libvirt.StreamEventType
+	StreamFlags                            = libvirt.StreamFlags
+	StreamSinkFunc                         = libvirt.StreamSinkFunc
+	StreamSinkHoleFunc                     = libvirt.StreamSinkHoleFunc
+	StreamSourceFunc                       = libvirt.StreamSourceFunc
+	StreamSourceHoleFunc                   = libvirt.StreamSourceHoleFunc
+	StreamSourceSkipFunc                   = libvirt.StreamSourceSkipFunc
+)
+
+const (
+	CONNECT_DOMAIN_EVENT_AGENT_LIFECYCLE_STATE_CONNECTED    = libvirt.CONNECT_DOMAIN_EVENT_AGENT_LIFECYCLE_STATE_CONNECTED
+	CONNECT_DOMAIN_EVENT_AGENT_LIFECYCLE_STATE_DISCONNECTED = libvirt.CONNECT_DOMAIN_EVENT_AGENT_LIFECYCLE_STATE_DISCONNECTED
+	CONNECT_GET_ALL_DOMAINS_STATS_ACTIVE                    = libvirt.CONNECT_GET_ALL_DOMAINS_STATS_ACTIVE
+	CONNECT_GET_ALL_DOMAINS_STATS_INACTIVE                  = libvirt.CONNECT_GET_ALL_DOMAINS_STATS_INACTIVE
+	CONNECT_LIST_DOMAINS_ACTIVE                             = libvirt.CONNECT_LIST_DOMAINS_ACTIVE
+	CONNECT_LIST_DOMAINS_INACTIVE                           = libvirt.CONNECT_LIST_DOMAINS_INACTIVE
+	CONNECT_LIST_NODE_DEVICES_CAP_PCI_DEV                   = libvirt.CONNECT_LIST_NODE_DEVICES_CAP_PCI_DEV
+	CONNECT_LIST_NODE_DEVICES_CAP_SYSTEM                    = libvirt.CONNECT_LIST_NODE_DEVICES_CAP_SYSTEM
+	CONNECT_RO                                              = libvirt.CONNECT_RO
+	CRED_AUTHNAME                                           = libvirt.CRED_AUTHNAME
+	CRED_CNONCE                                             = libvirt.CRED_CNONCE
+	CRED_ECHOPROMPT                                         = libvirt.CRED_ECHOPROMPT
+	CRED_EXTERNAL                                           = libvirt.CRED_EXTERNAL
+	CRED_LANGUAGE                                           = libvirt.CRED_LANGUAGE
+	CRED_NOECHOPROMPT                                       = libvirt.CRED_NOECHOPROMPT
+	CRED_PASSPHRASE                                         = libvirt.CRED_PASSPHRASE
+	CRED_REALM                                              = libvirt.CRED_REALM
+	CRED_USERNAME                                           = libvirt.CRED_USERNAME
+	DOMAIN_AFFECT_CONFIG                                    = libvirt.DOMAIN_AFFECT_CONFIG
+	DOMAIN_AFFECT_CURRENT                                   = libvirt.DOMAIN_AFFECT_CURRENT
+	DOMAIN_AFFECT_LIVE                                      = libvirt.DOMAIN_AFFECT_LIVE
+	DOMAIN_BLOCKED                                          = libvirt.DOMAIN_BLOCKED
+	DOMAIN_BLOCK_RESIZE_BYTES                               = libvirt.DOMAIN_BLOCK_RESIZE_BYTES
+	DOMAIN_CHANNEL_FORCE                                    = libvirt.DOMAIN_CHANNEL_FORCE
+	DOMAIN_CONSOLE_FORCE                                    = libvirt.DOMAIN_CONSOLE_FORCE
+	DOMAIN_CONSOLE_SAFE                                     = libvirt.DOMAIN_CONSOLE_SAFE
+	DOMAIN_CORE_DUMP_FORMAT_KDUMP_LZO                       = libvirt.DOMAIN_CORE_DUMP_FORMAT_KDUMP_LZO
+	DOMAIN_CORE_DUMP_FORMAT_KDUMP_SNAPPY                    = libvirt.DOMAIN_CORE_DUMP_FORMAT_KDUMP_SNAPPY
+	DOMAIN_CORE_DUMP_FORMAT_KDUMP_ZLIB                      = libvirt.DOMAIN_CORE_DUMP_FORMAT_KDUMP_ZLIB
+	DOMAIN_CORE_DUMP_FORMAT_RAW                             = libvirt.DOMAIN_CORE_DUMP_FORMAT_RAW
+	DOMAIN_CRASHED                                          = libvirt.DOMAIN_CRASHED
+	DOMAIN_CRASHED_PANICKED                                 = libvirt.DOMAIN_CRASHED_PANICKED
+	DOMAIN_CRASHED_UNKNOWN                                  = libvirt.DOMAIN_CRASHED_UNKNOWN
+	DOMAIN_DEFINE_VALIDATE                                  = libvirt.DOMAIN_DEFINE_VALIDATE
+	DOMAIN_EVENT_CRASHED                                    = libvirt.DOMAIN_EVENT_CRASHED
+	DOMAIN_EVENT_DEFINED                                    = libvirt.DOMAIN_EVENT_DEFINED
+	DOMAIN_EVENT_DEFINED_ADDED                              = libvirt.DOMAIN_EVENT_DEFINED_ADDED
+	DOMAIN_EVENT_DEFINED_RENAMED                            = libvirt.DOMAIN_EVENT_DEFINED_RENAMED
+	DOMAIN_EVENT_DEFINED_UPDATED                            = libvirt.DOMAIN_EVENT_DEFINED_UPDATED
+	DOMAIN_EVENT_PMSUSPENDED                                = libvirt.DOMAIN_EVENT_PMSUSPENDED
+	DOMAIN_EVENT_RESUMED                                    = libvirt.DOMAIN_EVENT_RESUMED
+	DOMAIN_EVENT_SHUTDOWN                                   = libvirt.DOMAIN_EVENT_SHUTDOWN
+	DOMAIN_EVENT_STARTED                                    = libvirt.DOMAIN_EVENT_STARTED
+	DOMAIN_EVENT_STOPPED                                    = libvirt.DOMAIN_EVENT_STOPPED
+	DOMAIN_EVENT_SUSPENDED                                  = libvirt.DOMAIN_EVENT_SUSPENDED
+	DOMAIN_EVENT_UNDEFINED                                  = libvirt.DOMAIN_EVENT_UNDEFINED
+	DOMAIN_EVENT_WATCHDOG_NONE                              = libvirt.DOMAIN_EVENT_WATCHDOG_NONE
+	DOMAIN_EVENT_WATCHDOG_PAUSE                             = libvirt.DOMAIN_EVENT_WATCHDOG_PAUSE
+	DOMAIN_EVENT_WATCHDOG_POWEROFF                          = libvirt.DOMAIN_EVENT_WATCHDOG_POWEROFF
+	DOMAIN_EVENT_WATCHDOG_RESET                             = libvirt.DOMAIN_EVENT_WATCHDOG_RESET
+	DOMAIN_EVENT_WATCHDOG_SHUTDOWN                          = libvirt.DOMAIN_EVENT_WATCHDOG_SHUTDOWN
+	DOMAIN_INTERFACE_ADDRESSES_SRC_AGENT                    = libvirt.DOMAIN_INTERFACE_ADDRESSES_SRC_AGENT
+	DOMAIN_INTERFACE_ADDRESSES_SRC_ARP                      = libvirt.DOMAIN_INTERFACE_ADDRESSES_SRC_ARP
+	DOMAIN_INTERFACE_ADDRESSES_SRC_LEASE                    = libvirt.DOMAIN_INTERFACE_ADDRESSES_SRC_LEASE
+	DOMAIN_JOB_BOUNDED                                      = libvirt.DOMAIN_JOB_BOUNDED
+	DOMAIN_JOB_CANCELLED                                    = libvirt.DOMAIN_JOB_CANCELLED
+	DOMAIN_JOB_COMPLETED                                    = libvirt.DOMAIN_JOB_COMPLETED
+	DOMAIN_JOB_FAILED                                       = libvirt.DOMAIN_JOB_FAILED
+	DOMAIN_JOB_NONE                                         = libvirt.DOMAIN_JOB_NONE
+	DOMAIN_JOB_STATS_COMPLETED                              = libvirt.DOMAIN_JOB_STATS_COMPLETED
+	DOMAIN_JOB_UNBOUNDED                                    = libvirt.DOMAIN_JOB_UNBOUNDED
+	DOMAIN_MEMORY_STAT_NR                                   = libvirt.DOMAIN_MEMORY_STAT_NR
+	DOMAIN_MEMORY_STAT_SWAP_IN                              = libvirt.DOMAIN_MEMORY_STAT_SWAP_IN
+	DOMAIN_MEMORY_STAT_SWAP_OUT                             = libvirt.DOMAIN_MEMORY_STAT_SWAP_OUT
+	DOMAIN_METADATA_DESCRIPTION                             = libvirt.DOMAIN_METADATA_DESCRIPTION
+	DOMAIN_METADATA_ELEMENT                                 = libvirt.DOMAIN_METADATA_ELEMENT
+	DOMAIN_METADATA_TITLE                                   = libvirt.DOMAIN_METADATA_TITLE
+	DOMAIN_NONE                                             = libvirt.DOMAIN_NONE
+	DOMAIN_NOSTATE                                          = libvirt.DOMAIN_NOSTATE
+	DOMAIN_PAUSED                                           = libvirt.DOMAIN_PAUSED
+	DOMAIN_PAUSED_MIGRATION                                 = libvirt.DOMAIN_PAUSED_MIGRATION
+	DOMAIN_PAUSED_POSTCOPY                                  = libvirt.DOMAIN_PAUSED_POSTCOPY
+	DOMAIN_PAUSED_POSTCOPY_FAILED                           = libvirt.DOMAIN_PAUSED_POSTCOPY_FAILED
+	DOMAIN_PAUSED_UNKNOWN                                   = libvirt.DOMAIN_PAUSED_UNKNOWN
+	DOMAIN_PAUSED_USER                                      = libvirt.DOMAIN_PAUSED_USER
+	DOMAIN_PMSUSPENDED                                      = libvirt.DOMAIN_PMSUSPENDED
+	DOMAIN_QEMU_AGENT_COMMAND_BLOCK                         = libvirt.DOMAIN_QEMU_AGENT_COMMAND_BLOCK
+	DOMAIN_QEMU_AGENT_COMMAND_DEFAULT                       = libvirt.DOMAIN_QEMU_AGENT_COMMAND_DEFAULT
+	DOMAIN_QEMU_AGENT_COMMAND_NOWAIT                        = libvirt.DOMAIN_QEMU_AGENT_COMMAND_NOWAIT
+	DOMAIN_QEMU_MONITOR_COMMAND_DEFAULT                     = libvirt.DOMAIN_QEMU_MONITOR_COMMAND_DEFAULT
+	DOMAIN_QEMU_MONITOR_COMMAND_HMP                         = libvirt.DOMAIN_QEMU_MONITOR_COMMAND_HMP
+	DOMAIN_RUNNING                                          = libvirt.DOMAIN_RUNNING
+	DOMAIN_RUNNING_BOOTED                                   = libvirt.DOMAIN_RUNNING_BOOTED
+	DOMAIN_RUNNING_MIGRATED                                 = libvirt.DOMAIN_RUNNING_MIGRATED
+	DOMAIN_RUNNING_POSTCOPY                                 = libvirt.DOMAIN_RUNNING_POSTCOPY
+	DOMAIN_RUNNING_UNKNOWN                                  = libvirt.DOMAIN_RUNNING_UNKNOWN
+	DOMAIN_SHUTDOWN                                         = libvirt.DOMAIN_SHUTDOWN
+	DOMAIN_SHUTDOWN_UNKNOWN                                 = libvirt.DOMAIN_SHUTDOWN_UNKNOWN
+	DOMAIN_SHUTDOWN_USER                                    = libvirt.DOMAIN_SHUTDOWN_USER
+	DOMAIN_SHUTOFF                                          = libvirt.DOMAIN_SHUTOFF
+	DOMAIN_SHUTOFF_CRASHED                                  = libvirt.DOMAIN_SHUTOFF_CRASHED
+	DOMAIN_SHUTOFF_DESTROYED                                = libvirt.DOMAIN_SHUTOFF_DESTROYED
+	DOMAIN_SHUTOFF_FAILED                                   = libvirt.DOMAIN_SHUTOFF_FAILED
+	DOMAIN_SHUTOFF_FROM_SNAPSHOT                            = libvirt.DOMAIN_SHUTOFF_FROM_SNAPSHOT
+	DOMAIN_SHUTOFF_MIGRATED                                 = libvirt.DOMAIN_SHUTOFF_MIGRATED
+	DOMAIN_SHUTOFF_SAVED                                    = libvirt.DOMAIN_SHUTOFF_SAVED
+	DOMAIN_SHUTOFF_SHUTDOWN                                 = libvirt.DOMAIN_SHUTOFF_SHUTDOWN
+	DOMAIN_SHUTOFF_UNKNOWN                                  = libvirt.DOMAIN_SHUTOFF_UNKNOWN
+	DOMAIN_START_PAUSED                                     = libvirt.DOMAIN_START_PAUSED
+	DOMAIN_STATS_BALLOON                                    = libvirt.DOMAIN_STATS_BALLOON
+	DOMAIN_STATS_BLOCK                                      = libvirt.DOMAIN_STATS_BLOCK
+	DOMAIN_STATS_CPU_TOTAL                                  = libvirt.DOMAIN_STATS_CPU_TOTAL
+	DOMAIN_STATS_INTERFACE                                  = libvirt.DOMAIN_STATS_INTERFACE
+	DOMAIN_STATS_PERF                                       = libvirt.DOMAIN_STATS_PERF
+	DOMAIN_STATS_STATE                                      = libvirt.DOMAIN_STATS_STATE
+	DOMAIN_STATS_VCPU                                       = libvirt.DOMAIN_STATS_VCPU
+	DOMAIN_UNDEFINE_KEEP_NVRAM                              = libvirt.DOMAIN_UNDEFINE_KEEP_NVRAM
+	DOMAIN_UNDEFINE_MANAGED_SAVE                            = libvirt.DOMAIN_UNDEFINE_MANAGED_SAVE
+	DOMAIN_UNDEFINE_NVRAM                                   = libvirt.DOMAIN_UNDEFINE_NVRAM
+	DOMAIN_UNDEFINE_SNAPSHOTS_METADATA                      = libvirt.DOMAIN_UNDEFINE_SNAPSHOTS_METADATA
+	DOMAIN_XML_INACTIVE                                     = libvirt.DOMAIN_XML_INACTIVE
+	DOMAIN_XML_MIGRATABLE                                   = libvirt.DOMAIN_XML_MIGRATABLE
+	DOMAIN_XML_SECURE                                       = libvirt.DOMAIN_XML_SECURE
+	DOMAIN_XML_UPDATE_CPU                                   = libvirt.DOMAIN_XML_UPDATE_CPU
+	DUMP_BYPASS_CACHE                                       = libvirt.DUMP_BYPASS_CACHE
+	DUMP_CRASH                                              = libvirt.DUMP_CRASH
+	DUMP_LIVE                                               = libvirt.DUMP_LIVE
+	DUMP_MEMORY_ONLY                                        = libvirt.DUMP_MEMORY_ONLY
+	DUMP_RESET                                              = libvirt.DUMP_RESET
+	ERR_AGENT_UNRESPONSIVE                                  = libvirt.ERR_AGENT_UNRESPONSIVE
+	ERR_AUTH_CANCELLED                                      = libvirt.ERR_AUTH_CANCELLED
+	ERR_AUTH_FAILED                                         = libvirt.ERR_AUTH_FAILED
+	ERR_ERROR                                               = libvirt.ERR_ERROR
+	ERR_INTERNAL_ERROR                                      = libvirt.ERR_INTERNAL_ERROR
+	ERR_INVALID_ARG                                         = libvirt.ERR_INVALID_ARG
+	ERR_INVALID_CONN                                        = libvirt.ERR_INVALID_CONN
+	ERR_INVALID_STREAM                                      = libvirt.ERR_INVALID_STREAM
+	ERR_NONE                                                = libvirt.ERR_NONE
+	ERR_NO_CONNECT                                          = libvirt.ERR_NO_CONNECT
+	ERR_NO_DOMAIN                                           = libvirt.ERR_NO_DOMAIN
+	ERR_NO_DOMAIN_METADATA                                  = libvirt.ERR_NO_DOMAIN_METADATA
+	ERR_NO_MEMORY                                           = libvirt.ERR_NO_MEMORY
+	ERR_NO_NWFILTER                                         = libvirt.ERR_NO_NWFILTER
+	ERR_NO_SECRET                                           = libvirt.ERR_NO_SECRET
+	ERR_NO_STORAGE_POOL                                     = libvirt.ERR_NO_STORAGE_POOL
+	ERR_NO_STORAGE_VOL                                      = libvirt.ERR_NO_STORAGE_VOL
+	ERR_NO_SUPPORT                                          = libvirt.ERR_NO_SUPPORT
+	ERR_OK                                                  = libvirt.ERR_OK
+	ERR_OPERATION_ABORTED                                   = libvirt.ERR_OPERATION_ABORTED
+	ERR_OPERATION_FAILED                                    = libvirt.ERR_OPERATION_FAILED
+	ERR_OPERATION_INVALID                                   = libvirt.ERR_OPERATION_INVALID
+	ERR_OPERATION_TIMEOUT                                   = libvirt.ERR_OPERATION_TIMEOUT
+	ERR_RESOURCE_BUSY                                       = libvirt.ERR_RESOURCE_BUSY
+	ERR_RPC                                                 = libvirt.ERR_RPC
+	ERR_SYSTEM_ERROR                                        = libvirt.ERR_SYSTEM_ERROR
+	ERR_WARNING                                             = libvirt.ERR_WARNING
+	ERR_XML_INVALID_SCHEMA                                  = libvirt.ERR_XML_INVALID_SCHEMA
+	FROM_NONE                                               = libvirt.FROM_NONE
+	FROM_QEMU                                               = libvirt.FROM_QEMU
+	FROM_REMOTE                                             = libvirt.FROM_REMOTE
+	FROM_RPC                                                = libvirt.FROM_RPC
+	FROM_STREAMS                                            = libvirt.FROM_STREAMS
+	KEYCODE_SET_LINUX                                       = libvirt.KEYCODE_SET_LINUX
+	SECRET_USAGE_TYPE_CEPH                                  = libvirt.SECRET_USAGE_TYPE_CEPH
+	SECRET_USAGE_TYPE_ISCSI                                 = libvirt.SECRET_USAGE_TYPE_ISCSI
+	SECRET_USAGE_TYPE_NONE                                  = libvirt.SECRET_USAGE_TYPE_NONE
+	SECRET_USAGE_TYPE_TLS                                   = libvirt.SECRET_USAGE_TYPE_TLS
+	SECRET_USAGE_TYPE_VOLUME                                = libvirt.SECRET_USAGE_TYPE_VOLUME
+	SECRET_USAGE_TYPE_VTPM                                  = libvirt.SECRET_USAGE_TYPE_VTPM
+	STORAGE_POOL_BUILD_NEW                                  = libvirt.STORAGE_POOL_BUILD_NEW
+	STORAGE_POOL_CREATE_NORMAL                              = libvirt.STORAGE_POOL_CREATE_NORMAL
+	STORAGE_VOL_DELETE_NORMAL                               = libvirt.STORAGE_VOL_DELETE_NORMAL
+	STORAGE_VOL_DOWNLOAD_SPARSE_STREAM                      = libvirt.STORAGE_VOL_DOWNLOAD_SPARSE_STREAM
+	STORAGE_VOL_UPLOAD_SPARSE_STREAM                        = libvirt.STORAGE_VOL_UPLOAD_SPARSE_STREAM
+	STREAM_EVENT_ERROR                                      = libvirt.STREAM_EVENT_ERROR
+	STREAM_EVENT_HANGUP                                     = libvirt.STREAM_EVENT_HANGUP
+	STREAM_EVENT_READABLE                                   = libvirt.STREAM_EVENT_READABLE
+	STREAM_EVENT_WRITABLE                                   = libvirt.STREAM_EVENT_WRITABLE
+	STREAM_NONBLOCK                                         = libvirt.STREAM_NONBLOCK
+)
+
+func EventRegisterDefaultImpl() error {
+	return libvirt.EventRegisterDefaultImpl()
+}
+
+func EventRunDefaultImpl() error {
+	return libvirt.EventRunDefaultImpl()
+}
+
+func GetLastError() Error {
+	return libvirt.GetLastError()
+}
+
+func NewConnectWithAuth(uri string, auth *ConnectAuth, flags ConnectFlags) (*Connect, error) {
+	return libvirt.NewConnectWithAuth(uri, auth, flags)
+}
@@ -0,0 +1,30 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+// Package libvirt is the libvirt API as virt-handler uses it. By default it
+// is the libvirt-go binding of the libvirt C library. Builds without cgo, or
+// with the libvirt_rpc build tag, get a pure Go implementation instead, which
+// talks to libvirtd through its RPC protocol. Such builds don't need the
+// libvirt C library, which makes cross-compiling and static builds easy:
+//
+//	CGO_ENABLED=0 go build ./cmd/virt-handler
+//
+// Only the part of libvirt-go which KubeVirt uses is provided, see the
+// rpc_*.go files for the limitations of the pure Go implementation.
+package libvirt
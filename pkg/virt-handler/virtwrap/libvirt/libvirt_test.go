@@ -0,0 +1,116 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package libvirt
+
+import (
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+// These tests run against both drivers, with and without the libvirt_rpc
+// build tag, to make sure they behave the same towards virt-handler.
+
+var _ = Describe("Driver "+Driver, func() {
+
+	table.DescribeTable("should use the values of the C library", func(value interface{}, expected int) {
+		Expect(value).To(BeNumerically("==", expected))
+	},
+		table.Entry("CONNECT_RO", CONNECT_RO, 1),
+		table.Entry("CONNECT_LIST_DOMAINS_ACTIVE", CONNECT_LIST_DOMAINS_ACTIVE, 1),
+		table.Entry("DOMAIN_NOSTATE", DOMAIN_NOSTATE, 0),
+		table.Entry("DOMAIN_RUNNING", DOMAIN_RUNNING, 1),
+		table.Entry("DOMAIN_PAUSED", DOMAIN_PAUSED, 3),
+		table.Entry("DOMAIN_SHUTDOWN", DOMAIN_SHUTDOWN, 4),
+		table.Entry("DOMAIN_SHUTOFF", DOMAIN_SHUTOFF, 5),
+		table.Entry("DOMAIN_CRASHED", DOMAIN_CRASHED, 6),
+		table.Entry("DOMAIN_SHUTOFF_DESTROYED", DOMAIN_SHUTOFF_DESTROYED, 2),
+		table.Entry("DOMAIN_SHUTOFF_FAILED", DOMAIN_SHUTOFF_FAILED, 6),
+		table.Entry("DOMAIN_UNDEFINE_NVRAM", DOMAIN_UNDEFINE_NVRAM, 4),
+		table.Entry("DOMAIN_XML_SECURE", DOMAIN_XML_SECURE, 1),
+		table.Entry("DOMAIN_XML_INACTIVE", DOMAIN_XML_INACTIVE, 2),
+		table.Entry("DOMAIN_AFFECT_LIVE", DOMAIN_AFFECT_LIVE, 1),
+		table.Entry("DOMAIN_AFFECT_CONFIG", DOMAIN_AFFECT_CONFIG, 2),
+		table.Entry("DOMAIN_METADATA_ELEMENT", DOMAIN_METADATA_ELEMENT, 2),
+		table.Entry("DOMAIN_JOB_UNBOUNDED", DOMAIN_JOB_UNBOUNDED, 2),
+		table.Entry("DOMAIN_STATS_STATE", DOMAIN_STATS_STATE, 1),
+		table.Entry("DOMAIN_STATS_BLOCK", DOMAIN_STATS_BLOCK, 32),
+		table.Entry("DOMAIN_EVENT_STOPPED", DOMAIN_EVENT_STOPPED, 5),
+		table.Entry("STREAM_NONBLOCK", STREAM_NONBLOCK, 1),
+		table.Entry("STREAM_EVENT_READABLE", STREAM_EVENT_READABLE, 1),
+		table.Entry("ERR_OK", ERR_OK, 0),
+		table.Entry("ERR_NO_DOMAIN", ERR_NO_DOMAIN, 42),
+		table.Entry("ERR_OPERATION_INVALID", ERR_OPERATION_INVALID, 55),
+		table.Entry("ERR_NO_SECRET", ERR_NO_SECRET, 66),
+		table.Entry("FROM_QEMU", FROM_QEMU, 10),
+	)
+
+	Context("with a connection to libvirtd", func() {
+		var conn *Connect
+
+		BeforeEach(func() {
+			uri := os.Getenv("LIBVIRT_TEST_URI")
+			if uri == "" {
+				uri = "test:///default"
+			}
+			var err error
+			conn, err = NewConnectWithAuth(uri, nil, 0)
+			if err != nil {
+				Skip("libvirtd is not reachable: " + err.Error())
+			}
+		})
+
+		AfterEach(func() {
+			if conn != nil {
+				conn.Close()
+			}
+		})
+
+		It("should report its version", func() {
+			version, err := conn.GetLibVersion()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(version).To(BeNumerically(">", 0))
+		})
+
+		It("should look up domains by their name", func() {
+			domains, err := conn.ListAllDomains(0)
+			Expect(err).ToNot(HaveOccurred())
+			for _, domain := range domains {
+				name, err := domain.GetName()
+				Expect(err).ToNot(HaveOccurred())
+				found, err := conn.LookupDomainByName(name)
+				Expect(err).ToNot(HaveOccurred())
+				uuid, err := domain.GetUUIDString()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(found.GetUUIDString()).To(Equal(uuid))
+				found.Free()
+				domain.Free()
+			}
+		})
+
+		It("should fail with ERR_NO_DOMAIN for unknown domains", func() {
+			_, err := conn.LookupDomainByName("kubevirt-no-such-domain")
+			Expect(err).To(HaveOccurred())
+			Expect(err.(Error).Code).To(Equal(ERR_NO_DOMAIN))
+		})
+	})
+})
@@ -0,0 +1,468 @@
+//go:build !cgo || libvirt_rpc
+// +build !cgo libvirt_rpc
+
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package libvirt
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	rpc "github.com/digitalocean/go-libvirt"
+)
+
+const (
+	defaultSocket   = "/var/run/libvirt/libvirt-sock"
+	defaultROSocket = "/var/run/libvirt/libvirt-sock-ro"
+	defaultTCPPort  = "16509"
+	defaultTLSPort  = "16514"
+	defaultPKIPath  = "/etc/pki/libvirt"
+	defaultCACert   = "/etc/pki/CA/cacert.pem"
+	dialTimeout     = 10 * time.Second
+)
+
+// remoteTarget is where libvirtd listens for a URI, and what it has to open
+// there.
+type remoteTarget struct {
+	network  string
+	address  string
+	hostname string
+	tls      bool
+	noVerify bool
+	pkiPath  string
+	// name is the URI libvirtd opens, without transport, host and the
+	// parameters which only concern the client
+	name string
+}
+
+// parseRemoteURI resolves a URI like the remote driver of libvirt does. URIs
+// without host are opened by the local libvirtd, through its unix socket.
+// The unix, tcp and tls transports are supported.
+func parseRemoteURI(uri string, flags ConnectFlags) (*remoteTarget, error) {
+	target := &remoteTarget{network: "unix", address: defaultSocket}
+	if flags&CONNECT_RO != 0 {
+		target.address = defaultROSocket
+	}
+	if uri == "" {
+		// libvirtd picks the driver
+		return target, nil
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	scheme, transport := u.Scheme, ""
+	if i := strings.Index(scheme, "+"); i >= 0 {
+		scheme, transport = scheme[:i], scheme[i+1:]
+	}
+	if transport == "" {
+		transport = "unix"
+		if u.Hostname() != "" {
+			transport = "tls"
+		}
+	}
+
+	query := u.Query()
+	switch transport {
+	case "unix":
+		if socket := query.Get("socket"); socket != "" {
+			target.address = socket
+		}
+	case "tcp", "tls":
+		target.network = "tcp"
+		target.hostname = u.Hostname()
+		port := u.Port()
+		if port == "" {
+			port = defaultTCPPort
+			if transport == "tls" {
+				port = defaultTLSPort
+			}
+		}
+		target.address = net.JoinHostPort(target.hostname, port)
+		target.tls = transport == "tls"
+		target.pkiPath = query.Get("pkipath")
+		target.noVerify = query.Get("no_verify") == "1"
+	default:
+		return nil, fmt.Errorf("transport %s is not supported by the %s driver", transport, Driver)
+	}
+
+	if name := query.Get("name"); name != "" {
+		target.name = name
+		return target, nil
+	}
+	for _, param := range []string{"socket", "pkipath", "no_verify", "no_tty", "keyfile", "command", "netcat"} {
+		query.Del(param)
+	}
+	name := url.URL{Scheme: scheme, Opaque: u.Opaque, Path: u.Path, RawQuery: query.Encode()}
+	target.name = name.String()
+	return target, nil
+}
+
+func (t *remoteTarget) dial() (net.Conn, error) {
+	if !t.tls {
+		return net.DialTimeout(t.network, t.address, dialTimeout)
+	}
+	config, err := t.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	return tls.DialWithDialer(&net.Dialer{Timeout: dialTimeout}, t.network, t.address, config)
+}
+
+// tlsConfig loads the CA and the client certificate from where libvirt
+// looks for them.
+func (t *remoteTarget) tlsConfig() (*tls.Config, error) {
+	caCert, clientCert, clientKey := defaultCACert, filepath.Join(defaultPKIPath, "clientcert.pem"), filepath.Join(defaultPKIPath, "private", "clientkey.pem")
+	if t.pkiPath != "" {
+		caCert = filepath.Join(t.pkiPath, "cacert.pem")
+		clientCert = filepath.Join(t.pkiPath, "clientcert.pem")
+		clientKey = filepath.Join(t.pkiPath, "clientkey.pem")
+	}
+	ca, err := ioutil.ReadFile(caCert)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no CA certificates found in %s", caCert)
+	}
+	cert, err := tls.LoadX509KeyPair(clientCert, clientKey)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		RootCAs:            pool,
+		Certificates:       []tls.Certificate{cert},
+		ServerName:         t.hostname,
+		InsecureSkipVerify: t.noVerify,
+	}, nil
+}
+
+// Connect is a connection to libvirtd. libvirtd has to accept it without
+// asking for credentials, e.g. on its unix sockets or with TLS client
+// certificates, the RPC protocol has no way to pass them.
+type Connect struct {
+	client *rpc.Libvirt
+	conn   net.Conn
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	lock           sync.Mutex
+	lastCallbackID int
+}
+
+// NewConnectWithAuth connects to the libvirtd of uri. auth is not used, see
+// Connect.
+func NewConnectWithAuth(uri string, auth *ConnectAuth, flags ConnectFlags) (*Connect, error) {
+	target, err := parseRemoteURI(uri, flags)
+	if err != nil {
+		return nil, newError(ERR_INVALID_ARG, FROM_RPC, "invalid URI %s: %v", uri, err)
+	}
+	conn, err := target.dial()
+	if err != nil {
+		return nil, newError(ERR_NO_CONNECT, FROM_RPC, "failed to connect to %s: %v", target.address, err)
+	}
+	client := rpc.New(conn)
+	if err := client.ConnectToURI(rpc.ConnectURI(target.name)); err != nil {
+		conn.Close()
+		return nil, result(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Connect{client: client, conn: conn, ctx: ctx, cancel: cancel}, result(nil)
+}
+
+// Close ends the connection, all subscriptions to events end with it.
+func (c *Connect) Close() (int, error) {
+	c.cancel()
+	err := c.client.Disconnect()
+	c.conn.Close()
+	return 0, result(err)
+}
+
+// IsAlive asks libvirtd for its version, unlike the C library which knows
+// whether the connection still answers from its keepalive messages.
+func (c *Connect) IsAlive() (bool, error) {
+	select {
+	case <-c.ctx.Done():
+		return false, result(nil)
+	default:
+	}
+	if _, err := c.client.ConnectGetLibVersion(); err != nil {
+		return false, result(err)
+	}
+	return true, result(nil)
+}
+
+// SetKeepAlive closes the connection once libvirtd didn't answer to more
+// than count requests in a row, sent every interval seconds. The keepalive
+// messages of the RPC protocol are not supported by go-libvirt, version
+// requests are sent instead.
+func (c *Connect) SetKeepAlive(interval int, count uint) error {
+	if interval <= 0 {
+		return result(nil)
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer ticker.Stop()
+		failures := uint(0)
+		for {
+			select {
+			case <-c.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if _, err := c.client.ConnectGetLibVersion(); err == nil {
+				failures = 0
+				continue
+			}
+			failures++
+			if failures > count {
+				c.conn.Close()
+				return
+			}
+		}
+	}()
+	return result(nil)
+}
+
+func (c *Connect) GetCapabilities() (string, error) {
+	caps, err := c.client.ConnectGetCapabilities()
+	return caps, result(err)
+}
+
+func (c *Connect) GetDomainCapabilities(emulatorbin string, arch string, machine string, virttype string, flags uint32) (string, error) {
+	caps, err := c.client.ConnectGetDomainCapabilities(optString(emulatorbin), optString(arch), optString(machine), optString(virttype), rpc.ConnectGetDomainCapabilitiesFlags(flags))
+	return caps, result(err)
+}
+
+func (c *Connect) GetLibVersion() (uint32, error) {
+	version, err := c.client.ConnectGetLibVersion()
+	return uint32(version), result(err)
+}
+
+func (c *Connect) GetVersion() (uint32, error) {
+	version, err := c.client.ConnectGetVersion()
+	return uint32(version), result(err)
+}
+
+func (c *Connect) GetFreePages(pageSizes []uint64, startCell int, maxCells uint, flags uint32) ([]uint64, error) {
+	pages := make([]uint32, len(pageSizes))
+	for i, size := range pageSizes {
+		pages[i] = uint32(size)
+	}
+	counts, err := c.client.NodeGetFreePages(pages, int32(startCell), uint32(maxCells), flags)
+	return counts, result(err)
+}
+
+func (c *Connect) NewStream(flags StreamFlags) (*Stream, error) {
+	return &Stream{flags: flags}, result(nil)
+}
+
+func (c *Connect) domain(dom rpc.Domain) *Domain {
+	return &Domain{conn: c, dom: dom}
+}
+
+func (c *Connect) LookupDomainByName(name string) (*Domain, error) {
+	dom, err := c.client.DomainLookupByName(name)
+	if err != nil {
+		return nil, result(err)
+	}
+	return c.domain(dom), result(nil)
+}
+
+func (c *Connect) LookupDomainByUUIDString(uuid string) (*Domain, error) {
+	parsed, err := parseUUID(uuid)
+	if err != nil {
+		return nil, newError(ERR_INVALID_ARG, FROM_NONE, "invalid UUID %s: %v", uuid, err)
+	}
+	dom, err := c.client.DomainLookupByUUID(parsed)
+	if err != nil {
+		return nil, result(err)
+	}
+	return c.domain(dom), result(nil)
+}
+
+func (c *Connect) DomainDefineXML(xml string) (*Domain, error) {
+	dom, err := c.client.DomainDefineXML(xml)
+	if err != nil {
+		return nil, result(err)
+	}
+	return c.domain(dom), result(nil)
+}
+
+func (c *Connect) DomainDefineXMLFlags(xml string, flags DomainDefineFlags) (*Domain, error) {
+	dom, err := c.client.DomainDefineXMLFlags(xml, rpc.DomainDefineFlags(flags))
+	if err != nil {
+		return nil, result(err)
+	}
+	return c.domain(dom), result(nil)
+}
+
+func (c *Connect) ListAllDomains(flags ConnectListAllDomainsFlags) ([]Domain, error) {
+	doms, _, err := c.client.ConnectListAllDomains(1, rpc.ConnectListAllDomainsFlags(flags))
+	if err != nil {
+		return nil, result(err)
+	}
+	domains := make([]Domain, len(doms))
+	for i := range doms {
+		domains[i] = Domain{conn: c, dom: doms[i]}
+	}
+	return domains, result(nil)
+}
+
+func (c *Connect) GetAllDomainStats(doms []*Domain, statsTypes DomainStatsTypes, flags ConnectGetAllDomainStatsFlags) ([]DomainStats, error) {
+	rpcDoms := make([]rpc.Domain, len(doms))
+	for i, dom := range doms {
+		rpcDoms[i] = dom.dom
+	}
+	records, err := c.client.ConnectGetAllDomainStats(rpcDoms, uint32(statsTypes), uint32(flags))
+	if err != nil {
+		return nil, result(err)
+	}
+	stats := make([]DomainStats, len(records))
+	for i, record := range records {
+		domStats, err := newDomainStats(c.domain(record.Dom), statsTypes, record.Params)
+		if err != nil {
+			return nil, newError(ERR_RPC, FROM_RPC, "invalid statistics of domain %s: %v", record.Dom.Name, err)
+		}
+		stats[i] = *domStats
+	}
+	return stats, result(nil)
+}
+
+// subscribe dispatches the events libvirtd sends for eventID on the event
+// loop. The subscription ends with the connection.
+func (c *Connect) subscribe(eventID rpc.DomainEventID, dom *Domain, handle func(event interface{})) (int, error) {
+	var opt rpc.OptDomain
+	if dom != nil {
+		opt = rpc.OptDomain{dom.dom}
+	}
+	events, err := c.client.SubscribeEvents(c.ctx, eventID, opt)
+	if err != nil {
+		return 0, result(err)
+	}
+	go func() {
+		for event := range events {
+			event := event
+			defaultEventLoop.queue(func() { handle(event) })
+		}
+	}()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.lastCallbackID++
+	return c.lastCallbackID, result(nil)
+}
+
+func (c *Connect) DomainEventLifecycleRegister(dom *Domain, callback DomainEventLifecycleCallback) (int, error) {
+	return c.subscribe(rpc.DomainEventIDLifecycle, dom, func(event interface{}) {
+		if e, ok := event.(*rpc.DomainEventCallbackLifecycleMsg); ok && eventOf(dom, e.Msg.Dom) {
+			callback(c, c.domain(e.Msg.Dom), &DomainEventLifecycle{Event: DomainEventType(e.Msg.Event), Detail: int(e.Msg.Detail)})
+		}
+	})
+}
+
+func (c *Connect) DomainEventWatchdogRegister(dom *Domain, callback DomainEventWatchdogCallback) (int, error) {
+	return c.subscribe(rpc.DomainEventIDWatchdog, dom, func(event interface{}) {
+		if e, ok := event.(*rpc.DomainEventCallbackWatchdogMsg); ok && eventOf(dom, e.Msg.Dom) {
+			callback(c, c.domain(e.Msg.Dom), &DomainEventWatchdog{Action: DomainEventWatchdogAction(e.Msg.Action)})
+		}
+	})
+}
+
+func (c *Connect) DomainEventRTCChangeRegister(dom *Domain, callback DomainEventRTCChangeCallback) (int, error) {
+	return c.subscribe(rpc.DomainEventIDRtcChange, dom, func(event interface{}) {
+		if e, ok := event.(*rpc.DomainEventCallbackRtcChangeMsg); ok && eventOf(dom, e.Msg.Dom) {
+			callback(c, c.domain(e.Msg.Dom), &DomainEventRTCChange{Utcoffset: e.Msg.Offset})
+		}
+	})
+}
+
+func (c *Connect) DomainEventDeviceAddedRegister(dom *Domain, callback DomainEventDeviceAddedCallback) (int, error) {
+	return c.subscribe(rpc.DomainEventIDDeviceAdded, dom, func(event interface{}) {
+		if e, ok := event.(*rpc.DomainEventCallbackDeviceAddedMsg); ok && eventOf(dom, e.Dom) {
+			callback(c, c.domain(e.Dom), &DomainEventDeviceAdded{DevAlias: e.DevAlias})
+		}
+	})
+}
+
+func (c *Connect) DomainEventDeviceRemovedRegister(dom *Domain, callback DomainEventDeviceRemovedCallback) (int, error) {
+	return c.subscribe(rpc.DomainEventIDDeviceRemoved, dom, func(event interface{}) {
+		if e, ok := event.(*rpc.DomainEventCallbackDeviceRemovedMsg); ok && eventOf(dom, e.Msg.Dom) {
+			callback(c, c.domain(e.Msg.Dom), &DomainEventDeviceRemoved{DevAlias: e.Msg.DevAlias})
+		}
+	})
+}
+
+func (c *Connect) DomainEventAgentLifecycleRegister(dom *Domain, callback DomainEventAgentLifecycleCallback) (int, error) {
+	return c.subscribe(rpc.DomainEventIDAgentLifecycle, dom, func(event interface{}) {
+		if e, ok := event.(*rpc.DomainEventCallbackAgentLifecycleMsg); ok && eventOf(dom, e.Dom) {
+			callback(c, c.domain(e.Dom), &DomainEventAgentLifecycle{
+				State:  ConnectDomainEventAgentLifecycleState(e.State),
+				Reason: ConnectDomainEventAgentLifecycleReason(e.Reason),
+			})
+		}
+	})
+}
+
+// eventOf tells whether an event of eventDom is for dom, go-libvirt always
+// subscribes to the events of all domains.
+func eventOf(dom *Domain, eventDom rpc.Domain) bool {
+	return dom == nil || dom.dom.UUID == eventDom.UUID
+}
+
+// optString turns empty strings into absent optional ones, like passing
+// NULL to the C library.
+func optString(s string) rpc.OptString {
+	if s == "" {
+		return nil
+	}
+	return rpc.OptString{s}
+}
+
+func parseUUID(uuid string) (rpc.UUID, error) {
+	var parsed rpc.UUID
+	raw, err := hex.DecodeString(strings.Replace(uuid, "-", "", -1))
+	if err != nil {
+		return parsed, err
+	}
+	if len(raw) != len(parsed) {
+		return parsed, fmt.Errorf("UUIDs have %d bytes", len(parsed))
+	}
+	copy(parsed[:], raw)
+	return parsed, nil
+}
+
+func formatUUID(uuid rpc.UUID) string {
+	s := hex.EncodeToString(uuid[:])
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
@@ -0,0 +1,433 @@
+//go:build !cgo || libvirt_rpc
+// +build !cgo libvirt_rpc
+
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package libvirt
+
+import (
+	"io"
+
+	rpc "github.com/digitalocean/go-libvirt"
+)
+
+// Domain references a domain of libvirtd. The RPC protocol has no reference
+// counting, Ref and Free do nothing.
+type Domain struct {
+	conn *Connect
+	dom  rpc.Domain
+}
+
+func (d *Domain) client() *rpc.Libvirt {
+	return d.conn.client
+}
+
+func (d *Domain) Ref() error {
+	return nil
+}
+
+func (d *Domain) Free() error {
+	return nil
+}
+
+func (d *Domain) GetName() (string, error) {
+	return d.dom.Name, result(nil)
+}
+
+func (d *Domain) GetUUIDString() (string, error) {
+	return formatUUID(d.dom.UUID), result(nil)
+}
+
+func (d *Domain) GetState() (DomainState, int, error) {
+	state, reason, err := d.client().DomainGetState(d.dom, 0)
+	return DomainState(state), int(reason), result(err)
+}
+
+func (d *Domain) Create() error {
+	return result(d.client().DomainCreate(d.dom))
+}
+
+func (d *Domain) CreateWithFlags(flags DomainCreateFlags) error {
+	_, err := d.client().DomainCreateWithFlags(d.dom, uint32(flags))
+	return result(err)
+}
+
+func (d *Domain) Resume() error {
+	return result(d.client().DomainResume(d.dom))
+}
+
+func (d *Domain) Shutdown() error {
+	return result(d.client().DomainShutdown(d.dom))
+}
+
+func (d *Domain) Destroy() error {
+	return result(d.client().DomainDestroy(d.dom))
+}
+
+func (d *Domain) GetXMLDesc(flags DomainXMLFlags) (string, error) {
+	xml, err := d.client().DomainGetXMLDesc(d.dom, rpc.DomainXMLFlags(flags))
+	return xml, result(err)
+}
+
+func (d *Domain) Undefine() error {
+	return result(d.client().DomainUndefine(d.dom))
+}
+
+func (d *Domain) UndefineFlags(flags DomainUndefineFlagsValues) error {
+	return result(d.client().DomainUndefineFlags(d.dom, rpc.DomainUndefineFlagsValues(flags)))
+}
+
+// OpenConsole receives the output of the console into stream, see Stream
+// for why it can't send.
+func (d *Domain) OpenConsole(devname string, stream *Stream, flags DomainConsoleFlags) error {
+	return stream.start(false, func(pipe *streamPipe) error {
+		return d.client().DomainOpenConsole(d.dom, optString(devname), pipe, uint32(flags))
+	})
+}
+
+// OpenChannel receives what the guest writes to the channel into stream,
+// see Stream for why it can't send.
+func (d *Domain) OpenChannel(name string, stream *Stream, flags DomainChannelFlags) error {
+	return stream.start(false, func(pipe *streamPipe) error {
+		return d.client().DomainOpenChannel(d.dom, optString(name), pipe, rpc.DomainChannelFlags(flags))
+	})
+}
+
+// Screenshot receives the whole screenshot before it returns, its MIME
+// type is only known then.
+func (d *Domain) Screenshot(stream *Stream, screen uint32, flags uint32) (string, error) {
+	var mime rpc.OptString
+	err := stream.startBuffered(func(w io.Writer) error {
+		var err error
+		mime, err = d.client().DomainScreenshot(d.dom, w, screen, flags)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(mime) == 0 {
+		return "", result(nil)
+	}
+	return mime[0], result(nil)
+}
+
+// cpuMapBytes packs a CPU map into the bitmap of the RPC protocol.
+func cpuMapBytes(cpuMap []bool) []byte {
+	bytes := make([]byte, (len(cpuMap)+7)/8)
+	for i, set := range cpuMap {
+		if set {
+			bytes[i/8] |= 1 << uint(i%8)
+		}
+	}
+	return bytes
+}
+
+func (d *Domain) PinVcpuFlags(vcpu uint, cpuMap []bool, flags DomainModificationImpact) error {
+	return result(d.client().DomainPinVcpuFlags(d.dom, uint32(vcpu), cpuMapBytes(cpuMap), uint32(flags)))
+}
+
+func (d *Domain) PinEmulator(cpuMap []bool, flags DomainModificationImpact) error {
+	return result(d.client().DomainPinEmulator(d.dom, cpuMapBytes(cpuMap), rpc.DomainModificationImpact(flags)))
+}
+
+func (d *Domain) PinIOThread(iothreadid uint, cpuMap []bool, flags DomainModificationImpact) error {
+	return result(d.client().DomainPinIothread(d.dom, uint32(iothreadid), cpuMapBytes(cpuMap), rpc.DomainModificationImpact(flags)))
+}
+
+func (d *Domain) AddIOThread(id uint, flags DomainModificationImpact) error {
+	return result(d.client().DomainAddIothread(d.dom, uint32(id), rpc.DomainModificationImpact(flags)))
+}
+
+func (d *Domain) GetBlockInfo(disk string, flags uint) (*DomainBlockInfo, error) {
+	allocation, capacity, physical, err := d.client().DomainGetBlockInfo(d.dom, disk, uint32(flags))
+	if err != nil {
+		return nil, result(err)
+	}
+	return &DomainBlockInfo{Capacity: capacity, Allocation: allocation, Physical: physical}, result(nil)
+}
+
+func (d *Domain) BlockResize(disk string, size uint64, flags DomainBlockResizeFlags) error {
+	return result(d.client().DomainBlockResize(d.dom, disk, size, rpc.DomainBlockResizeFlags(flags)))
+}
+
+func (d *Domain) GetBlockIoTune(disk string, flags DomainModificationImpact) (*DomainBlockIoTuneParameters, error) {
+	// The first call only returns how many parameters there are
+	_, nparams, err := d.client().DomainGetBlockIOTune(d.dom, optString(disk), 0, uint32(flags))
+	if err != nil {
+		return nil, result(err)
+	}
+	params, _, err := d.client().DomainGetBlockIOTune(d.dom, optString(disk), nparams, uint32(flags))
+	if err != nil {
+		return nil, result(err)
+	}
+	tune := &DomainBlockIoTuneParameters{}
+	return tune, unpackResult(tune.fields(), params)
+}
+
+func (d *Domain) SetBlockIoTune(disk string, params *DomainBlockIoTuneParameters, flags DomainModificationImpact) error {
+	return result(d.client().DomainSetBlockIOTune(d.dom, disk, params.fields().pack(), uint32(flags)))
+}
+
+func (d *Domain) GetInterfaceParameters(device string, flags DomainModificationImpact) (*DomainInterfaceParameters, error) {
+	_, nparams, err := d.client().DomainGetInterfaceParameters(d.dom, device, 0, rpc.DomainModificationImpact(flags))
+	if err != nil {
+		return nil, result(err)
+	}
+	params, _, err := d.client().DomainGetInterfaceParameters(d.dom, device, nparams, rpc.DomainModificationImpact(flags))
+	if err != nil {
+		return nil, result(err)
+	}
+	iface := &DomainInterfaceParameters{}
+	return iface, unpackResult(iface.fields(), params)
+}
+
+func (d *Domain) SetInterfaceParameters(device string, params *DomainInterfaceParameters, flags DomainModificationImpact) error {
+	return result(d.client().DomainSetInterfaceParameters(d.dom, device, params.fields().pack(), uint32(flags)))
+}
+
+func (d *Domain) GetMetadata(metadataType DomainMetadataType, uri string, flags DomainModificationImpact) (string, error) {
+	metadata, err := d.client().DomainGetMetadata(d.dom, int32(metadataType), optString(uri), rpc.DomainModificationImpact(flags))
+	return metadata, result(err)
+}
+
+func (d *Domain) SetMetadata(metadata string, metadataType DomainMetadataType, key string, uri string, flags DomainModificationImpact) error {
+	return result(d.client().DomainSetMetadata(d.dom, int32(metadataType), optString(metadata), optString(key), optString(uri), rpc.DomainModificationImpact(flags)))
+}
+
+func (d *Domain) GetJobStats(flags DomainGetJobStatsFlags) (*DomainJobInfo, error) {
+	jobType, params, err := d.client().DomainGetJobStats(d.dom, rpc.DomainGetJobStatsFlags(flags))
+	if err != nil {
+		return nil, result(err)
+	}
+	info := &DomainJobInfo{Type: DomainJobType(jobType)}
+	return info, unpackResult(info.fields(), params)
+}
+
+func (d *Domain) AbortJob() error {
+	return result(d.client().DomainAbortJob(d.dom))
+}
+
+func (d *Domain) MigrateGetMaxSpeed(flags uint32) (uint64, error) {
+	speed, err := d.client().DomainMigrateGetMaxSpeed(d.dom, flags)
+	return speed, result(err)
+}
+
+func (d *Domain) MigrateSetMaxSpeed(speed uint64, flags uint32) error {
+	return result(d.client().DomainMigrateSetMaxSpeed(d.dom, speed, flags))
+}
+
+func (d *Domain) MigrateSetMaxDowntime(downtime uint64, flags uint32) error {
+	return result(d.client().DomainMigrateSetMaxDowntime(d.dom, downtime, flags))
+}
+
+func (d *Domain) MigrateStartPostCopy(flags uint32) error {
+	return result(d.client().DomainMigrateStartPostCopy(d.dom, flags))
+}
+
+func (d *Domain) MemoryStats(nrStats uint32, flags uint32) ([]DomainMemoryStat, error) {
+	stats, err := d.client().DomainMemoryStats(d.dom, nrStats, flags)
+	if err != nil {
+		return nil, result(err)
+	}
+	memoryStats := make([]DomainMemoryStat, len(stats))
+	for i, stat := range stats {
+		memoryStats[i] = DomainMemoryStat{Tag: stat.Tag, Val: stat.Val}
+	}
+	return memoryStats, result(nil)
+}
+
+func (d *Domain) ListAllInterfaceAddresses(src DomainInterfaceAddressesSource) ([]DomainInterface, error) {
+	ifaces, err := d.client().DomainInterfaceAddresses(d.dom, uint32(src), 0)
+	if err != nil {
+		return nil, result(err)
+	}
+	interfaces := make([]DomainInterface, len(ifaces))
+	for i, iface := range ifaces {
+		interfaces[i] = DomainInterface{Name: iface.Name, Addrs: make([]DomainIPAddress, len(iface.Addrs))}
+		if len(iface.Hwaddr) > 0 {
+			interfaces[i].Hwaddr = iface.Hwaddr[0]
+		}
+		for j, addr := range iface.Addrs {
+			interfaces[i].Addrs[j] = DomainIPAddress{Type: int(addr.Type), Addr: addr.Addr, Prefix: uint(addr.Prefix)}
+		}
+	}
+	return interfaces, result(nil)
+}
+
+func (d *Domain) GetAutostart() (bool, error) {
+	autostart, err := d.client().DomainGetAutostart(d.dom)
+	return autostart != 0, result(err)
+}
+
+func (d *Domain) SetAutostart(autostart bool) error {
+	var value int32
+	if autostart {
+		value = 1
+	}
+	return result(d.client().DomainSetAutostart(d.dom, value))
+}
+
+// Rename keeps the reference working, it refers to the domain by its UUID.
+func (d *Domain) Rename(name string, flags uint32) error {
+	if _, err := d.client().DomainRename(d.dom, optString(name), flags); err != nil {
+		return result(err)
+	}
+	d.dom.Name = name
+	return result(nil)
+}
+
+func (d *Domain) CoreDump(to string, flags DomainCoreDumpFlags) error {
+	return result(d.client().DomainCoreDump(d.dom, to, rpc.DomainCoreDumpFlags(flags)))
+}
+
+func (d *Domain) CoreDumpWithFormat(to string, format DomainCoreDumpFormat, flags DomainCoreDumpFlags) error {
+	return result(d.client().DomainCoreDumpWithFormat(d.dom, to, uint32(format), rpc.DomainCoreDumpFlags(flags)))
+}
+
+func (d *Domain) SendKey(codeset uint, holdtime uint, keycodes []uint, flags uint32) error {
+	codes := make([]uint32, len(keycodes))
+	for i, code := range keycodes {
+		codes[i] = uint32(code)
+	}
+	return result(d.client().DomainSendKey(d.dom, uint32(codeset), uint32(holdtime), codes, flags))
+}
+
+func (d *Domain) GetPerfEvents(flags DomainModificationImpact) (*DomainPerfEvents, error) {
+	params, err := d.client().DomainGetPerfEvents(d.dom, rpc.DomainModificationImpact(flags))
+	if err != nil {
+		return nil, result(err)
+	}
+	events := &DomainPerfEvents{}
+	return events, unpackResult(events.fields(), params)
+}
+
+func (d *Domain) SetPerfEvents(params *DomainPerfEvents, flags DomainModificationImpact) error {
+	return result(d.client().DomainSetPerfEvents(d.dom, params.fields().pack(), rpc.DomainModificationImpact(flags)))
+}
+
+func (d *Domain) QemuMonitorCommand(command string, flags DomainQemuMonitorCommandFlags) (string, error) {
+	reply, err := d.client().QEMUDomainMonitorCommand(d.dom, command, uint32(flags))
+	return reply, result(err)
+}
+
+func (d *Domain) QemuAgentCommand(command string, timeout DomainQemuAgentCommandTimeout, flags uint32) (string, error) {
+	reply, err := d.client().QEMUDomainAgentCommand(d.dom, command, int32(timeout), flags)
+	if err != nil {
+		return "", result(err)
+	}
+	if len(reply) == 0 {
+		return "", result(nil)
+	}
+	return reply[0], result(nil)
+}
+
+func (d *Domain) FSTrim(mountpoint string, minimum uint64, flags uint32) error {
+	return result(d.client().DomainFstrim(d.dom, optString(mountpoint), minimum, flags))
+}
+
+// GetCPUStats returns the statistics of nCpus host CPUs from startCpu on, or
+// the total of all CPUs if startCpu is -1.
+func (d *Domain) GetCPUStats(startCpu int, nCpus uint, flags uint32) ([]DomainCPUStats, error) {
+	if startCpu == -1 {
+		nCpus = 1
+	}
+	// The first call only returns how many parameters there are per CPU
+	_, nparams, err := d.client().DomainGetCPUStats(d.dom, 0, int32(startCpu), 1, rpc.TypedParameterFlags(flags))
+	if err != nil {
+		return nil, result(err)
+	}
+	params, _, err := d.client().DomainGetCPUStats(d.dom, uint32(nparams), int32(startCpu), uint32(nCpus), rpc.TypedParameterFlags(flags))
+	if err != nil {
+		return nil, result(err)
+	}
+
+	stats := make([]DomainCPUStats, nCpus)
+	for i := range stats {
+		first, last := i*int(nparams), (i+1)*int(nparams)
+		if last > len(params) {
+			stats = stats[:i]
+			break
+		}
+		if err := stats[i].fields().unpack(params[first:last]); err != nil {
+			return nil, newError(ERR_RPC, FROM_RPC, "%v", err)
+		}
+	}
+	return stats, result(nil)
+}
+
+func (d *Domain) GetSchedulerParametersFlags(flags DomainModificationImpact) (*DomainSchedulerParameters, error) {
+	schedType, nparams, err := d.client().DomainGetSchedulerType(d.dom)
+	if err != nil {
+		return nil, result(err)
+	}
+	params, err := d.client().DomainGetSchedulerParametersFlags(d.dom, nparams, uint32(flags))
+	if err != nil {
+		return nil, result(err)
+	}
+	sched := &DomainSchedulerParameters{Type: schedType}
+	return sched, unpackResult(sched.fields(), params)
+}
+
+func (d *Domain) SetSchedulerParametersFlags(params *DomainSchedulerParameters, flags DomainModificationImpact) error {
+	return result(d.client().DomainSetSchedulerParametersFlags(d.dom, params.fields().pack(), uint32(flags)))
+}
+
+func (d *Domain) GetMemoryParameters(flags DomainModificationImpact) (*DomainMemoryParameters, error) {
+	_, nparams, err := d.client().DomainGetMemoryParameters(d.dom, 0, uint32(flags))
+	if err != nil {
+		return nil, result(err)
+	}
+	params, _, err := d.client().DomainGetMemoryParameters(d.dom, nparams, uint32(flags))
+	if err != nil {
+		return nil, result(err)
+	}
+	memory := &DomainMemoryParameters{}
+	return memory, unpackResult(memory.fields(), params)
+}
+
+func (d *Domain) SetMemoryParameters(params *DomainMemoryParameters, flags DomainModificationImpact) error {
+	return result(d.client().DomainSetMemoryParameters(d.dom, params.fields().pack(), uint32(flags)))
+}
+
+func (d *Domain) GetBlkioParameters(flags DomainModificationImpact) (*DomainBlkioParameters, error) {
+	_, nparams, err := d.client().DomainGetBlkioParameters(d.dom, 0, uint32(flags))
+	if err != nil {
+		return nil, result(err)
+	}
+	params, _, err := d.client().DomainGetBlkioParameters(d.dom, nparams, uint32(flags))
+	if err != nil {
+		return nil, result(err)
+	}
+	blkio := &DomainBlkioParameters{}
+	return blkio, unpackResult(blkio.fields(), params)
+}
+
+func (d *Domain) SetBlkioParameters(params *DomainBlkioParameters, flags DomainModificationImpact) error {
+	return result(d.client().DomainSetBlkioParameters(d.dom, params.fields().pack(), uint32(flags)))
+}
+
+// unpackResult unpacks the parameters libvirtd returned, parameters of an
+// unexpected type are RPC errors.
+func unpackResult(fields typedParamFields, params []rpc.TypedParam) error {
+	if err := fields.unpack(params); err != nil {
+		return newError(ERR_RPC, FROM_RPC, "%v", err)
+	}
+	return result(nil)
+}
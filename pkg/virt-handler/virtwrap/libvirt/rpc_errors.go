@@ -0,0 +1,141 @@
+//go:build !cgo || libvirt_rpc
+// +build !cgo libvirt_rpc
+
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package libvirt
+
+import (
+	"fmt"
+	"sync"
+
+	rpc "github.com/digitalocean/go-libvirt"
+)
+
+type ErrorLevel int
+
+const (
+	ERR_NONE    = ErrorLevel(0)
+	ERR_WARNING = ErrorLevel(1)
+	ERR_ERROR   = ErrorLevel(2)
+)
+
+type ErrorNumber int
+
+const (
+	ERR_OK                 = ErrorNumber(0)
+	ERR_INTERNAL_ERROR     = ErrorNumber(1)
+	ERR_NO_MEMORY          = ErrorNumber(2)
+	ERR_NO_SUPPORT         = ErrorNumber(3)
+	ERR_NO_CONNECT         = ErrorNumber(5)
+	ERR_INVALID_CONN       = ErrorNumber(6)
+	ERR_INVALID_ARG        = ErrorNumber(8)
+	ERR_OPERATION_FAILED   = ErrorNumber(9)
+	ERR_SYSTEM_ERROR       = ErrorNumber(38)
+	ERR_RPC                = ErrorNumber(39)
+	ERR_NO_DOMAIN          = ErrorNumber(42)
+	ERR_AUTH_FAILED        = ErrorNumber(45)
+	ERR_NO_STORAGE_POOL    = ErrorNumber(49)
+	ERR_NO_STORAGE_VOL     = ErrorNumber(50)
+	ERR_OPERATION_INVALID  = ErrorNumber(55)
+	ERR_NO_NWFILTER        = ErrorNumber(62)
+	ERR_NO_SECRET          = ErrorNumber(66)
+	ERR_OPERATION_TIMEOUT  = ErrorNumber(68)
+	ERR_INVALID_STREAM     = ErrorNumber(73)
+	ERR_OPERATION_ABORTED  = ErrorNumber(78)
+	ERR_AUTH_CANCELLED     = ErrorNumber(79)
+	ERR_NO_DOMAIN_METADATA = ErrorNumber(80)
+	ERR_AGENT_UNRESPONSIVE = ErrorNumber(86)
+	ERR_RESOURCE_BUSY      = ErrorNumber(87)
+	ERR_XML_INVALID_SCHEMA = ErrorNumber(92)
+)
+
+type ErrorDomain int
+
+const (
+	FROM_NONE    = ErrorDomain(0)
+	FROM_RPC     = ErrorDomain(7)
+	FROM_QEMU    = ErrorDomain(10)
+	FROM_REMOTE  = ErrorDomain(13)
+	FROM_STREAMS = ErrorDomain(38)
+)
+
+// Error is what all calls fail with, as a value like in libvirt-go.
+type Error struct {
+	Code    ErrorNumber
+	Domain  ErrorDomain
+	Message string
+	Level   ErrorLevel
+}
+
+func (err Error) Error() string {
+	return fmt.Sprintf("virError(Code=%d, Domain=%d, Message='%s')",
+		err.Code, err.Domain, err.Message)
+}
+
+var (
+	lastErrorLock sync.Mutex
+	lastError     = Error{Code: ERR_OK, Domain: FROM_NONE, Level: ERR_NONE}
+)
+
+// GetLastError returns the error of the last call which failed, or an error
+// with the code ERR_OK if the last call succeeded. Unlike in libvirt the last
+// error is not kept per thread, goroutines don't have threads of their own
+// anyway.
+func GetLastError() Error {
+	lastErrorLock.Lock()
+	defer lastErrorLock.Unlock()
+	return lastError
+}
+
+// result converts the error of a call into an Error and records it as the
+// last error. Errors libvirtd answered with keep their code, all others, like
+// broken connections, are RPC errors.
+func result(err error) error {
+	virErr := Error{Code: ERR_OK, Domain: FROM_NONE, Level: ERR_NONE}
+	if err != nil {
+		virErr = toError(err)
+	}
+	lastErrorLock.Lock()
+	lastError = virErr
+	lastErrorLock.Unlock()
+	if err != nil {
+		return virErr
+	}
+	return nil
+}
+
+func toError(err error) Error {
+	switch e := err.(type) {
+	case Error:
+		return e
+	case rpc.Error:
+		return Error{Code: ErrorNumber(e.Code), Domain: FROM_REMOTE, Message: e.Message, Level: ERR_ERROR}
+	case *rpc.Error:
+		return Error{Code: ErrorNumber(e.Code), Domain: FROM_REMOTE, Message: e.Message, Level: ERR_ERROR}
+	}
+	return Error{Code: ERR_RPC, Domain: FROM_RPC, Message: err.Error(), Level: ERR_ERROR}
+}
+
+// newError creates an error for failures which are detected without asking
+// libvirtd.
+func newError(code ErrorNumber, domain ErrorDomain, format string, args ...interface{}) error {
+	return result(Error{Code: code, Domain: domain, Message: fmt.Sprintf(format, args...), Level: ERR_ERROR})
+}
@@ -0,0 +1,89 @@
+//go:build !cgo || libvirt_rpc
+// +build !cgo libvirt_rpc
+
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package libvirt
+
+import (
+	"sync"
+)
+
+// eventLoop runs the callbacks of domain and stream events, one after the
+// other, in the goroutine which calls EventRunDefaultImpl. That keeps the
+// threading of the callbacks the same as with the C library.
+type eventLoop struct {
+	lock       sync.Mutex
+	registered bool
+	pending    []func()
+	wakeup     chan struct{}
+}
+
+var defaultEventLoop = &eventLoop{wakeup: make(chan struct{}, 1)}
+
+// queue adds a callback, it never blocks.
+func (l *eventLoop) queue(callback func()) {
+	l.lock.Lock()
+	l.pending = append(l.pending, callback)
+	l.lock.Unlock()
+	select {
+	case l.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// run waits for callbacks and runs all which are queued.
+func (l *eventLoop) run() {
+	for {
+		l.lock.Lock()
+		pending := l.pending
+		l.pending = nil
+		l.lock.Unlock()
+		if len(pending) > 0 {
+			for _, callback := range pending {
+				callback()
+			}
+			return
+		}
+		<-l.wakeup
+	}
+}
+
+// EventRegisterDefaultImpl has to be called before connecting, like with the
+// C library.
+func EventRegisterDefaultImpl() error {
+	defaultEventLoop.lock.Lock()
+	defer defaultEventLoop.lock.Unlock()
+	defaultEventLoop.registered = true
+	return nil
+}
+
+// EventRunDefaultImpl runs one iteration of the event loop, it blocks until
+// there are events to dispatch.
+func EventRunDefaultImpl() error {
+	defaultEventLoop.lock.Lock()
+	registered := defaultEventLoop.registered
+	defaultEventLoop.lock.Unlock()
+	if !registered {
+		return newError(ERR_INTERNAL_ERROR, FROM_NONE, "the default event loop is not registered")
+	}
+	defaultEventLoop.run()
+	return nil
+}
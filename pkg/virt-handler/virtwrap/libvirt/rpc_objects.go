@@ -0,0 +1,385 @@
+//go:build !cgo || libvirt_rpc
+// +build !cgo libvirt_rpc
+
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package libvirt
+
+import (
+	rpc "github.com/digitalocean/go-libvirt"
+)
+
+// Like domains, the other objects of libvirtd are referenced without
+// reference counting, their Free does nothing.
+
+type Secret struct {
+	conn   *Connect
+	secret rpc.Secret
+}
+
+func (c *Connect) ListSecrets() ([]string, error) {
+	count, err := c.client.ConnectNumOfSecrets()
+	if err != nil {
+		return nil, result(err)
+	}
+	uuids, err := c.client.ConnectListSecrets(count)
+	return uuids, result(err)
+}
+
+func (c *Connect) ListAllSecrets(flags ConnectListAllSecretsFlags) ([]Secret, error) {
+	rpcSecrets, _, err := c.client.ConnectListAllSecrets(1, rpc.ConnectListAllSecretsFlags(flags))
+	if err != nil {
+		return nil, result(err)
+	}
+	secrets := make([]Secret, len(rpcSecrets))
+	for i := range rpcSecrets {
+		secrets[i] = Secret{conn: c, secret: rpcSecrets[i]}
+	}
+	return secrets, result(nil)
+}
+
+func (c *Connect) LookupSecretByUUIDString(uuid string) (*Secret, error) {
+	parsed, err := parseUUID(uuid)
+	if err != nil {
+		return nil, newError(ERR_INVALID_ARG, FROM_NONE, "invalid UUID %s: %v", uuid, err)
+	}
+	secret, err := c.client.SecretLookupByUUID(parsed)
+	if err != nil {
+		return nil, result(err)
+	}
+	return &Secret{conn: c, secret: secret}, result(nil)
+}
+
+func (c *Connect) LookupSecretByUsage(usageType SecretUsageType, usageID string) (*Secret, error) {
+	secret, err := c.client.SecretLookupByUsage(int32(usageType), usageID)
+	if err != nil {
+		return nil, result(err)
+	}
+	return &Secret{conn: c, secret: secret}, result(nil)
+}
+
+func (c *Connect) SecretDefineXML(xml string, flags uint32) (*Secret, error) {
+	secret, err := c.client.SecretDefineXML(xml, flags)
+	if err != nil {
+		return nil, result(err)
+	}
+	return &Secret{conn: c, secret: secret}, result(nil)
+}
+
+func (s *Secret) SetValue(value []byte, flags uint32) error {
+	return result(s.conn.client.SecretSetValue(s.secret, value, flags))
+}
+
+func (s *Secret) Undefine() error {
+	return result(s.conn.client.SecretUndefine(s.secret))
+}
+
+func (s *Secret) GetUsageID() (string, error) {
+	return s.secret.UsageID, result(nil)
+}
+
+func (s *Secret) GetUUIDString() (string, error) {
+	return formatUUID(s.secret.UUID), result(nil)
+}
+
+func (s *Secret) GetXMLDesc(flags uint32) (string, error) {
+	xml, err := s.conn.client.SecretGetXMLDesc(s.secret, flags)
+	return xml, result(err)
+}
+
+func (s *Secret) Free() error {
+	return nil
+}
+
+type NodeDevice struct {
+	conn *Connect
+	name string
+}
+
+func (c *Connect) ListAllNodeDevices(flags ConnectListAllNodeDeviceFlags) ([]NodeDevice, error) {
+	rpcDevs, _, err := c.client.ConnectListAllNodeDevices(1, uint32(flags))
+	if err != nil {
+		return nil, result(err)
+	}
+	devs := make([]NodeDevice, len(rpcDevs))
+	for i := range rpcDevs {
+		devs[i] = NodeDevice{conn: c, name: rpcDevs[i].Name}
+	}
+	return devs, result(nil)
+}
+
+func (c *Connect) LookupDeviceByName(name string) (*NodeDevice, error) {
+	dev, err := c.client.NodeDeviceLookupByName(name)
+	if err != nil {
+		return nil, result(err)
+	}
+	return &NodeDevice{conn: c, name: dev.Name}, result(nil)
+}
+
+func (n *NodeDevice) GetName() (string, error) {
+	return n.name, result(nil)
+}
+
+func (n *NodeDevice) GetXMLDesc(flags uint32) (string, error) {
+	xml, err := n.conn.client.NodeDeviceGetXMLDesc(n.name, flags)
+	return xml, result(err)
+}
+
+func (n *NodeDevice) Detach() error {
+	return result(n.conn.client.NodeDeviceDettach(n.name))
+}
+
+func (n *NodeDevice) ReAttach() error {
+	return result(n.conn.client.NodeDeviceReAttach(n.name))
+}
+
+func (n *NodeDevice) Reset() error {
+	return result(n.conn.client.NodeDeviceReset(n.name))
+}
+
+func (n *NodeDevice) Free() error {
+	return nil
+}
+
+type NWFilter struct {
+	conn   *Connect
+	filter rpc.Nwfilter
+}
+
+func (c *Connect) NWFilterDefineXML(xml string) (*NWFilter, error) {
+	filter, err := c.client.NwfilterDefineXML(xml)
+	if err != nil {
+		return nil, result(err)
+	}
+	return &NWFilter{conn: c, filter: filter}, result(nil)
+}
+
+func (c *Connect) LookupNWFilterByName(name string) (*NWFilter, error) {
+	filter, err := c.client.NwfilterLookupByName(name)
+	if err != nil {
+		return nil, result(err)
+	}
+	return &NWFilter{conn: c, filter: filter}, result(nil)
+}
+
+func (c *Connect) ListAllNWFilters(flags uint32) ([]NWFilter, error) {
+	rpcFilters, _, err := c.client.ConnectListAllNwfilters(1, flags)
+	if err != nil {
+		return nil, result(err)
+	}
+	filters := make([]NWFilter, len(rpcFilters))
+	for i := range rpcFilters {
+		filters[i] = NWFilter{conn: c, filter: rpcFilters[i]}
+	}
+	return filters, result(nil)
+}
+
+func (f *NWFilter) GetName() (string, error) {
+	return f.filter.Name, result(nil)
+}
+
+func (f *NWFilter) GetUUIDString() (string, error) {
+	return formatUUID(f.filter.UUID), result(nil)
+}
+
+func (f *NWFilter) GetXMLDesc(flags uint32) (string, error) {
+	xml, err := f.conn.client.NwfilterGetXMLDesc(f.filter, flags)
+	return xml, result(err)
+}
+
+func (f *NWFilter) Undefine() error {
+	return result(f.conn.client.NwfilterUndefine(f.filter))
+}
+
+func (f *NWFilter) Free() error {
+	return nil
+}
+
+type StoragePool struct {
+	conn *Connect
+	pool rpc.StoragePool
+}
+
+func (c *Connect) StoragePoolDefineXML(xml string, flags uint32) (*StoragePool, error) {
+	pool, err := c.client.StoragePoolDefineXML(xml, flags)
+	if err != nil {
+		return nil, result(err)
+	}
+	return &StoragePool{conn: c, pool: pool}, result(nil)
+}
+
+func (c *Connect) LookupStoragePoolByName(name string) (*StoragePool, error) {
+	pool, err := c.client.StoragePoolLookupByName(name)
+	if err != nil {
+		return nil, result(err)
+	}
+	return &StoragePool{conn: c, pool: pool}, result(nil)
+}
+
+func (c *Connect) ListAllStoragePools(flags ConnectListAllStoragePoolsFlags) ([]StoragePool, error) {
+	rpcPools, _, err := c.client.ConnectListAllStoragePools(1, rpc.ConnectListAllStoragePoolsFlags(flags))
+	if err != nil {
+		return nil, result(err)
+	}
+	pools := make([]StoragePool, len(rpcPools))
+	for i := range rpcPools {
+		pools[i] = StoragePool{conn: c, pool: rpcPools[i]}
+	}
+	return pools, result(nil)
+}
+
+func (p *StoragePool) GetName() (string, error) {
+	return p.pool.Name, result(nil)
+}
+
+func (p *StoragePool) GetXMLDesc(flags StorageXMLFlags) (string, error) {
+	xml, err := p.conn.client.StoragePoolGetXMLDesc(p.pool, rpc.StorageXMLFlags(flags))
+	return xml, result(err)
+}
+
+func (p *StoragePool) IsActive() (bool, error) {
+	active, err := p.conn.client.StoragePoolIsActive(p.pool)
+	return active != 0, result(err)
+}
+
+func (p *StoragePool) Build(flags StoragePoolBuildFlags) error {
+	return result(p.conn.client.StoragePoolBuild(p.pool, rpc.StoragePoolBuildFlags(flags)))
+}
+
+func (p *StoragePool) Create(flags StoragePoolCreateFlags) error {
+	return result(p.conn.client.StoragePoolCreate(p.pool, rpc.StoragePoolCreateFlags(flags)))
+}
+
+func (p *StoragePool) SetAutostart(autostart bool) error {
+	var value int32
+	if autostart {
+		value = 1
+	}
+	return result(p.conn.client.StoragePoolSetAutostart(p.pool, value))
+}
+
+func (p *StoragePool) Refresh(flags uint32) error {
+	return result(p.conn.client.StoragePoolRefresh(p.pool, flags))
+}
+
+func (p *StoragePool) Destroy() error {
+	return result(p.conn.client.StoragePoolDestroy(p.pool))
+}
+
+func (p *StoragePool) Undefine() error {
+	return result(p.conn.client.StoragePoolUndefine(p.pool))
+}
+
+func (p *StoragePool) Free() error {
+	return nil
+}
+
+func (p *StoragePool) LookupStorageVolByName(name string) (*StorageVol, error) {
+	vol, err := p.conn.client.StorageVolLookupByName(p.pool, name)
+	if err != nil {
+		return nil, result(err)
+	}
+	return &StorageVol{conn: p.conn, vol: vol}, result(nil)
+}
+
+func (p *StoragePool) ListAllStorageVolumes(flags uint32) ([]StorageVol, error) {
+	rpcVols, _, err := p.conn.client.StoragePoolListAllVolumes(p.pool, 1, flags)
+	if err != nil {
+		return nil, result(err)
+	}
+	vols := make([]StorageVol, len(rpcVols))
+	for i := range rpcVols {
+		vols[i] = StorageVol{conn: p.conn, vol: rpcVols[i]}
+	}
+	return vols, result(nil)
+}
+
+func (p *StoragePool) StorageVolCreateXML(xml string, flags StorageVolCreateFlags) (*StorageVol, error) {
+	vol, err := p.conn.client.StorageVolCreateXML(p.pool, xml, rpc.StorageVolCreateFlags(flags))
+	if err != nil {
+		return nil, result(err)
+	}
+	return &StorageVol{conn: p.conn, vol: vol}, result(nil)
+}
+
+func (p *StoragePool) StorageVolCreateXMLFrom(xml string, clonevol *StorageVol, flags StorageVolCreateFlags) (*StorageVol, error) {
+	vol, err := p.conn.client.StorageVolCreateXMLFrom(p.pool, xml, clonevol.vol, rpc.StorageVolCreateFlags(flags))
+	if err != nil {
+		return nil, result(err)
+	}
+	return &StorageVol{conn: p.conn, vol: vol}, result(nil)
+}
+
+type StorageVol struct {
+	conn *Connect
+	vol  rpc.StorageVol
+}
+
+func (v *StorageVol) GetName() (string, error) {
+	return v.vol.Name, result(nil)
+}
+
+func (v *StorageVol) GetPath() (string, error) {
+	path, err := v.conn.client.StorageVolGetPath(v.vol)
+	return path, result(err)
+}
+
+func (v *StorageVol) GetInfo() (*StorageVolInfo, error) {
+	volType, capacity, allocation, err := v.conn.client.StorageVolGetInfo(v.vol)
+	if err != nil {
+		return nil, result(err)
+	}
+	return &StorageVolInfo{Type: StorageVolType(volType), Capacity: capacity, Allocation: allocation}, result(nil)
+}
+
+func (v *StorageVol) GetXMLDesc(flags uint32) (string, error) {
+	xml, err := v.conn.client.StorageVolGetXMLDesc(v.vol, flags)
+	return xml, result(err)
+}
+
+func (v *StorageVol) Resize(capacity uint64, flags StorageVolResizeFlags) error {
+	return result(v.conn.client.StorageVolResize(v.vol, capacity, rpc.StorageVolResizeFlags(flags)))
+}
+
+func (v *StorageVol) Delete(flags StorageVolDeleteFlags) error {
+	return result(v.conn.client.StorageVolDelete(v.vol, rpc.StorageVolDeleteFlags(flags)))
+}
+
+// Upload sends what is sent into stream to the volume. The sparse flag is
+// dropped, see Stream.
+func (v *StorageVol) Upload(stream *Stream, offset uint64, length uint64, flags StorageVolUploadFlags) error {
+	flags &^= STORAGE_VOL_UPLOAD_SPARSE_STREAM
+	return stream.start(true, func(pipe *streamPipe) error {
+		return v.conn.client.StorageVolUpload(v.vol, pipe, offset, length, rpc.StorageVolUploadFlags(flags))
+	})
+}
+
+// Download receives the volume into stream. The sparse flag is dropped, see
+// Stream.
+func (v *StorageVol) Download(stream *Stream, offset uint64, length uint64, flags StorageVolDownloadFlags) error {
+	flags &^= STORAGE_VOL_DOWNLOAD_SPARSE_STREAM
+	return stream.start(false, func(pipe *streamPipe) error {
+		return v.conn.client.StorageVolDownload(v.vol, pipe, offset, length, rpc.StorageVolDownloadFlags(flags))
+	})
+}
+
+func (v *StorageVol) Free() error {
+	return nil
+}
@@ -0,0 +1,460 @@
+//go:build !cgo || libvirt_rpc
+// +build !cgo libvirt_rpc
+
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package libvirt
+
+import (
+	"fmt"
+	"sort"
+
+	rpc "github.com/digitalocean/go-libvirt"
+)
+
+// The discriminants of the typed parameter union of the RPC protocol.
+const (
+	typedParamInt     = 1
+	typedParamUint    = 2
+	typedParamLLong   = 3
+	typedParamULLong  = 4
+	typedParamDouble  = 5
+	typedParamBoolean = 6
+	typedParamString  = 7
+)
+
+// typedParamField points to the field of a struct a typed parameter is read
+// into or written from, like in libvirt-go. Exactly one of the value pointers
+// is set, set tells whether the parameter is present.
+type typedParamField struct {
+	set *bool
+	i   *int
+	ui  *uint
+	l   *int64
+	ul  *uint64
+	d   *float64
+	b   *bool
+	s   *string
+}
+
+type typedParamFields map[string]typedParamField
+
+// unpack stores the parameters libvirtd knows in the fields, the ones the
+// struct has no field for are dropped.
+func (f typedParamFields) unpack(params []rpc.TypedParam) error {
+	for _, param := range params {
+		field, ok := f[param.Field]
+		if !ok {
+			continue
+		}
+		if err := field.assign(param.Value.I); err != nil {
+			return fmt.Errorf("typed parameter %s: %v", param.Field, err)
+		}
+		if field.set != nil {
+			*field.set = true
+		}
+	}
+	return nil
+}
+
+func (f typedParamField) assign(value interface{}) error {
+	if s, ok := value.(string); ok {
+		if f.s == nil {
+			return fmt.Errorf("unexpected string value")
+		}
+		*f.s = s
+		return nil
+	}
+
+	var n int64
+	var u uint64
+	var d float64
+	switch v := value.(type) {
+	case int32:
+		n, u, d = int64(v), uint64(v), float64(v)
+	case uint32:
+		n, u, d = int64(v), uint64(v), float64(v)
+	case int64:
+		n, u, d = v, uint64(v), float64(v)
+	case uint64:
+		n, u, d = int64(v), v, float64(v)
+	case float64:
+		n, u, d = int64(v), uint64(v), v
+	default:
+		return fmt.Errorf("unexpected value of type %T", value)
+	}
+	switch {
+	case f.i != nil:
+		*f.i = int(n)
+	case f.ui != nil:
+		*f.ui = uint(u)
+	case f.l != nil:
+		*f.l = n
+	case f.ul != nil:
+		*f.ul = u
+	case f.d != nil:
+		*f.d = d
+	case f.b != nil:
+		*f.b = n != 0
+	default:
+		return fmt.Errorf("unexpected numeric value")
+	}
+	return nil
+}
+
+// pack returns the fields which are set as typed parameters, sorted by their
+// name to always send them in the same order.
+func (f typedParamFields) pack() []rpc.TypedParam {
+	names := make([]string, 0, len(f))
+	for name, field := range f {
+		if field.set == nil || *field.set {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	params := make([]rpc.TypedParam, 0, len(names))
+	for _, name := range names {
+		field := f[name]
+		var value rpc.TypedParamValue
+		switch {
+		case field.i != nil:
+			value = rpc.TypedParamValue{D: typedParamInt, I: int32(*field.i)}
+		case field.ui != nil:
+			value = rpc.TypedParamValue{D: typedParamUint, I: uint32(*field.ui)}
+		case field.l != nil:
+			value = rpc.TypedParamValue{D: typedParamLLong, I: *field.l}
+		case field.ul != nil:
+			value = rpc.TypedParamValue{D: typedParamULLong, I: *field.ul}
+		case field.d != nil:
+			value = rpc.TypedParamValue{D: typedParamDouble, I: *field.d}
+		case field.b != nil:
+			var b int32
+			if *field.b {
+				b = 1
+			}
+			value = rpc.TypedParamValue{D: typedParamBoolean, I: b}
+		case field.s != nil:
+			value = rpc.TypedParamValue{D: typedParamString, I: *field.s}
+		}
+		params = append(params, rpc.TypedParam{Field: name, Value: value})
+	}
+	return params
+}
+
+type DomainBlockIoTuneParameters struct {
+	TotalBytesSecSet    bool
+	TotalBytesSec       uint64
+	ReadBytesSecSet     bool
+	ReadBytesSec        uint64
+	WriteBytesSecSet    bool
+	WriteBytesSec       uint64
+	TotalIopsSecSet     bool
+	TotalIopsSec        uint64
+	ReadIopsSecSet      bool
+	ReadIopsSec         uint64
+	WriteIopsSecSet     bool
+	WriteIopsSec        uint64
+	TotalBytesSecMaxSet bool
+	TotalBytesSecMax    uint64
+	ReadBytesSecMaxSet  bool
+	ReadBytesSecMax     uint64
+	WriteBytesSecMaxSet bool
+	WriteBytesSecMax    uint64
+	TotalIopsSecMaxSet  bool
+	TotalIopsSecMax     uint64
+	ReadIopsSecMaxSet   bool
+	ReadIopsSecMax      uint64
+	WriteIopsSecMaxSet  bool
+	WriteIopsSecMax     uint64
+	SizeIopsSecSet      bool
+	SizeIopsSec         uint64
+	GroupNameSet        bool
+	GroupName           string
+}
+
+func (p *DomainBlockIoTuneParameters) fields() typedParamFields {
+	return typedParamFields{
+		"total_bytes_sec":     {set: &p.TotalBytesSecSet, ul: &p.TotalBytesSec},
+		"read_bytes_sec":      {set: &p.ReadBytesSecSet, ul: &p.ReadBytesSec},
+		"write_bytes_sec":     {set: &p.WriteBytesSecSet, ul: &p.WriteBytesSec},
+		"total_iops_sec":      {set: &p.TotalIopsSecSet, ul: &p.TotalIopsSec},
+		"read_iops_sec":       {set: &p.ReadIopsSecSet, ul: &p.ReadIopsSec},
+		"write_iops_sec":      {set: &p.WriteIopsSecSet, ul: &p.WriteIopsSec},
+		"total_bytes_sec_max": {set: &p.TotalBytesSecMaxSet, ul: &p.TotalBytesSecMax},
+		"read_bytes_sec_max":  {set: &p.ReadBytesSecMaxSet, ul: &p.ReadBytesSecMax},
+		"write_bytes_sec_max": {set: &p.WriteBytesSecMaxSet, ul: &p.WriteBytesSecMax},
+		"total_iops_sec_max":  {set: &p.TotalIopsSecMaxSet, ul: &p.TotalIopsSecMax},
+		"read_iops_sec_max":   {set: &p.ReadIopsSecMaxSet, ul: &p.ReadIopsSecMax},
+		"write_iops_sec_max":  {set: &p.WriteIopsSecMaxSet, ul: &p.WriteIopsSecMax},
+		"size_iops_sec":       {set: &p.SizeIopsSecSet, ul: &p.SizeIopsSec},
+		"group_name":          {set: &p.GroupNameSet, s: &p.GroupName},
+	}
+}
+
+type DomainInterfaceParameters struct {
+	BandwidthInAverageSet  bool
+	BandwidthInAverage     uint
+	BandwidthInPeakSet     bool
+	BandwidthInPeak        uint
+	BandwidthInBurstSet    bool
+	BandwidthInBurst       uint
+	BandwidthInFloorSet    bool
+	BandwidthInFloor       uint
+	BandwidthOutAverageSet bool
+	BandwidthOutAverage    uint
+	BandwidthOutPeakSet    bool
+	BandwidthOutPeak       uint
+	BandwidthOutBurstSet   bool
+	BandwidthOutBurst      uint
+}
+
+func (p *DomainInterfaceParameters) fields() typedParamFields {
+	return typedParamFields{
+		"inbound.average":  {set: &p.BandwidthInAverageSet, ui: &p.BandwidthInAverage},
+		"inbound.peak":     {set: &p.BandwidthInPeakSet, ui: &p.BandwidthInPeak},
+		"inbound.burst":    {set: &p.BandwidthInBurstSet, ui: &p.BandwidthInBurst},
+		"inbound.floor":    {set: &p.BandwidthInFloorSet, ui: &p.BandwidthInFloor},
+		"outbound.average": {set: &p.BandwidthOutAverageSet, ui: &p.BandwidthOutAverage},
+		"outbound.peak":    {set: &p.BandwidthOutPeakSet, ui: &p.BandwidthOutPeak},
+		"outbound.burst":   {set: &p.BandwidthOutBurstSet, ui: &p.BandwidthOutBurst},
+	}
+}
+
+type DomainMemoryParameters struct {
+	HardLimitSet     bool
+	HardLimit        uint64
+	SoftLimitSet     bool
+	SoftLimit        uint64
+	MinGuaranteeSet  bool
+	MinGuarantee     uint64
+	SwapHardLimitSet bool
+	SwapHardLimit    uint64
+}
+
+func (p *DomainMemoryParameters) fields() typedParamFields {
+	return typedParamFields{
+		"hard_limit":      {set: &p.HardLimitSet, ul: &p.HardLimit},
+		"soft_limit":      {set: &p.SoftLimitSet, ul: &p.SoftLimit},
+		"min_guarantee":   {set: &p.MinGuaranteeSet, ul: &p.MinGuarantee},
+		"swap_hard_limit": {set: &p.SwapHardLimitSet, ul: &p.SwapHardLimit},
+	}
+}
+
+type DomainBlkioParameters struct {
+	WeightSet           bool
+	Weight              uint
+	DeviceWeightSet     bool
+	DeviceWeight        string
+	DeviceReadIopsSet   bool
+	DeviceReadIops      string
+	DeviceWriteIopsSet  bool
+	DeviceWriteIops     string
+	DeviceReadBytesSet  bool
+	DeviceReadBytes     string
+	DeviceWriteBytesSet bool
+	DeviceWriteBytes    string
+}
+
+func (p *DomainBlkioParameters) fields() typedParamFields {
+	return typedParamFields{
+		"weight":                 {set: &p.WeightSet, ui: &p.Weight},
+		"device_weight":          {set: &p.DeviceWeightSet, s: &p.DeviceWeight},
+		"device_read_iops_sec":   {set: &p.DeviceReadIopsSet, s: &p.DeviceReadIops},
+		"device_write_iops_sec":  {set: &p.DeviceWriteIopsSet, s: &p.DeviceWriteIops},
+		"device_read_bytes_sec":  {set: &p.DeviceReadBytesSet, s: &p.DeviceReadBytes},
+		"device_write_bytes_sec": {set: &p.DeviceWriteBytesSet, s: &p.DeviceWriteBytes},
+	}
+}
+
+type DomainSchedulerParameters struct {
+	Type              string
+	CpuSharesSet      bool
+	CpuShares         uint64
+	GlobalPeriodSet   bool
+	GlobalPeriod      uint64
+	GlobalQuotaSet    bool
+	GlobalQuota       int64
+	VcpuPeriodSet     bool
+	VcpuPeriod        uint64
+	VcpuQuotaSet      bool
+	VcpuQuota         int64
+	EmulatorPeriodSet bool
+	EmulatorPeriod    uint64
+	EmulatorQuotaSet  bool
+	EmulatorQuota     int64
+	IothreadPeriodSet bool
+	IothreadPeriod    uint64
+	IothreadQuotaSet  bool
+	IothreadQuota     int64
+}
+
+func (p *DomainSchedulerParameters) fields() typedParamFields {
+	return typedParamFields{
+		"cpu_shares":      {set: &p.CpuSharesSet, ul: &p.CpuShares},
+		"global_period":   {set: &p.GlobalPeriodSet, ul: &p.GlobalPeriod},
+		"global_quota":    {set: &p.GlobalQuotaSet, l: &p.GlobalQuota},
+		"vcpu_period":     {set: &p.VcpuPeriodSet, ul: &p.VcpuPeriod},
+		"vcpu_quota":      {set: &p.VcpuQuotaSet, l: &p.VcpuQuota},
+		"emulator_period": {set: &p.EmulatorPeriodSet, ul: &p.EmulatorPeriod},
+		"emulator_quota":  {set: &p.EmulatorQuotaSet, l: &p.EmulatorQuota},
+		"iothread_period": {set: &p.IothreadPeriodSet, ul: &p.IothreadPeriod},
+		"iothread_quota":  {set: &p.IothreadQuotaSet, l: &p.IothreadQuota},
+	}
+}
+
+type DomainPerfEvents struct {
+	CmtSet                bool
+	Cmt                   bool
+	MbmtSet               bool
+	Mbmt                  bool
+	MbmlSet               bool
+	Mbml                  bool
+	CacheMissesSet        bool
+	CacheMisses           bool
+	CacheReferencesSet    bool
+	CacheReferences       bool
+	InstructionsSet       bool
+	Instructions          bool
+	CpuCyclesSet          bool
+	CpuCycles             bool
+	BranchInstructionsSet bool
+	BranchInstructions    bool
+	BranchMissesSet       bool
+	BranchMisses          bool
+	BusCyclesSet          bool
+	BusCycles             bool
+}
+
+func (p *DomainPerfEvents) fields() typedParamFields {
+	return typedParamFields{
+		"cmt":                 {set: &p.CmtSet, b: &p.Cmt},
+		"mbmt":                {set: &p.MbmtSet, b: &p.Mbmt},
+		"mbml":                {set: &p.MbmlSet, b: &p.Mbml},
+		"cache_misses":        {set: &p.CacheMissesSet, b: &p.CacheMisses},
+		"cache_references":    {set: &p.CacheReferencesSet, b: &p.CacheReferences},
+		"instructions":        {set: &p.InstructionsSet, b: &p.Instructions},
+		"cpu_cycles":          {set: &p.CpuCyclesSet, b: &p.CpuCycles},
+		"branch_instructions": {set: &p.BranchInstructionsSet, b: &p.BranchInstructions},
+		"branch_misses":       {set: &p.BranchMissesSet, b: &p.BranchMisses},
+		"bus_cycles":          {set: &p.BusCyclesSet, b: &p.BusCycles},
+	}
+}
+
+type DomainCPUStats struct {
+	CpuTimeSet    bool
+	CpuTime       uint64
+	UserTimeSet   bool
+	UserTime      uint64
+	SystemTimeSet bool
+	SystemTime    uint64
+	VcpuTimeSet   bool
+	VcpuTime      uint64
+}
+
+func (s *DomainCPUStats) fields() typedParamFields {
+	return typedParamFields{
+		"cpu_time":    {set: &s.CpuTimeSet, ul: &s.CpuTime},
+		"user_time":   {set: &s.UserTimeSet, ul: &s.UserTime},
+		"system_time": {set: &s.SystemTimeSet, ul: &s.SystemTime},
+		"vcpu_time":   {set: &s.VcpuTimeSet, ul: &s.VcpuTime},
+	}
+}
+
+type DomainJobInfo struct {
+	Type                    DomainJobType
+	TimeElapsedSet          bool
+	TimeElapsed             uint64
+	TimeElapsedNetSet       bool
+	TimeElapsedNet          uint64
+	TimeRemainingSet        bool
+	TimeRemaining           uint64
+	DowntimeSet             bool
+	Downtime                uint64
+	DowntimeNetSet          bool
+	DowntimeNet             uint64
+	SetupTimeSet            bool
+	SetupTime               uint64
+	DataTotalSet            bool
+	DataTotal               uint64
+	DataProcessedSet        bool
+	DataProcessed           uint64
+	DataRemainingSet        bool
+	DataRemaining           uint64
+	MemTotalSet             bool
+	MemTotal                uint64
+	MemProcessedSet         bool
+	MemProcessed            uint64
+	MemRemainingSet         bool
+	MemRemaining            uint64
+	MemConstantSet          bool
+	MemConstant             uint64
+	MemNormalSet            bool
+	MemNormal               uint64
+	MemNormalBytesSet       bool
+	MemNormalBytes          uint64
+	MemBpsSet               bool
+	MemBps                  uint64
+	MemDirtyRateSet         bool
+	MemDirtyRate            uint64
+	MemPageSizeSet          bool
+	MemPageSize             uint64
+	MemIterationSet         bool
+	MemIteration            uint64
+	DiskTotalSet            bool
+	DiskTotal               uint64
+	DiskProcessedSet        bool
+	DiskProcessed           uint64
+	DiskRemainingSet        bool
+	DiskRemaining           uint64
+	DiskBpsSet              bool
+	DiskBps                 uint64
+	AutoConvergeThrottleSet bool
+	AutoConvergeThrottle    int
+}
+
+func (j *DomainJobInfo) fields() typedParamFields {
+	return typedParamFields{
+		"time_elapsed":           {set: &j.TimeElapsedSet, ul: &j.TimeElapsed},
+		"time_elapsed_net":       {set: &j.TimeElapsedNetSet, ul: &j.TimeElapsedNet},
+		"time_remaining":         {set: &j.TimeRemainingSet, ul: &j.TimeRemaining},
+		"downtime":               {set: &j.DowntimeSet, ul: &j.Downtime},
+		"downtime_net":           {set: &j.DowntimeNetSet, ul: &j.DowntimeNet},
+		"setup_time":             {set: &j.SetupTimeSet, ul: &j.SetupTime},
+		"data_total":             {set: &j.DataTotalSet, ul: &j.DataTotal},
+		"data_processed":         {set: &j.DataProcessedSet, ul: &j.DataProcessed},
+		"data_remaining":         {set: &j.DataRemainingSet, ul: &j.DataRemaining},
+		"memory_total":           {set: &j.MemTotalSet, ul: &j.MemTotal},
+		"memory_processed":       {set: &j.MemProcessedSet, ul: &j.MemProcessed},
+		"memory_remaining":       {set: &j.MemRemainingSet, ul: &j.MemRemaining},
+		"memory_constant":        {set: &j.MemConstantSet, ul: &j.MemConstant},
+		"memory_normal":          {set: &j.MemNormalSet, ul: &j.MemNormal},
+		"memory_normal_bytes":    {set: &j.MemNormalBytesSet, ul: &j.MemNormalBytes},
+		"memory_bps":             {set: &j.MemBpsSet, ul: &j.MemBps},
+		"memory_dirty_rate":      {set: &j.MemDirtyRateSet, ul: &j.MemDirtyRate},
+		"memory_page_size":       {set: &j.MemPageSizeSet, ul: &j.MemPageSize},
+		"memory_iteration":       {set: &j.MemIterationSet, ul: &j.MemIteration},
+		"disk_total":             {set: &j.DiskTotalSet, ul: &j.DiskTotal},
+		"disk_processed":         {set: &j.DiskProcessedSet, ul: &j.DiskProcessed},
+		"disk_remaining":         {set: &j.DiskRemainingSet, ul: &j.DiskRemaining},
+		"disk_bps":               {set: &j.DiskBpsSet, ul: &j.DiskBps},
+		"auto_converge_throttle": {set: &j.AutoConvergeThrottleSet, i: &j.AutoConvergeThrottle},
+	}
+}
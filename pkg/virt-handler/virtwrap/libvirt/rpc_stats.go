@@ -0,0 +1,237 @@
+//go:build !cgo || libvirt_rpc
+// +build !cgo libvirt_rpc
+
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package libvirt
+
+import (
+	"fmt"
+
+	rpc "github.com/digitalocean/go-libvirt"
+)
+
+type DomainStatsState struct {
+	StateSet  bool
+	State     DomainState
+	ReasonSet bool
+	Reason    int
+}
+
+type DomainStatsCPU struct {
+	TimeSet   bool
+	Time      uint64
+	UserSet   bool
+	User      uint64
+	SystemSet bool
+	System    uint64
+}
+
+type DomainStatsBalloon struct {
+	CurrentSet bool
+	Current    uint64
+	MaximumSet bool
+	Maximum    uint64
+}
+
+type DomainStatsVcpu struct {
+	StateSet bool
+	State    int
+	TimeSet  bool
+	Time     uint64
+}
+
+type DomainStatsNet struct {
+	NameSet    bool
+	Name       string
+	RxBytesSet bool
+	RxBytes    uint64
+	RxPktsSet  bool
+	RxPkts     uint64
+	RxErrsSet  bool
+	RxErrs     uint64
+	RxDropSet  bool
+	RxDrop     uint64
+	TxBytesSet bool
+	TxBytes    uint64
+	TxPktsSet  bool
+	TxPkts     uint64
+	TxErrsSet  bool
+	TxErrs     uint64
+	TxDropSet  bool
+	TxDrop     uint64
+}
+
+type DomainStatsBlock struct {
+	NameSet       bool
+	Name          string
+	PathSet       bool
+	Path          string
+	RdReqsSet     bool
+	RdReqs        uint64
+	RdBytesSet    bool
+	RdBytes       uint64
+	RdTimesSet    bool
+	RdTimes       uint64
+	WrReqsSet     bool
+	WrReqs        uint64
+	WrBytesSet    bool
+	WrBytes       uint64
+	WrTimesSet    bool
+	WrTimes       uint64
+	FlReqsSet     bool
+	FlReqs        uint64
+	FlTimesSet    bool
+	FlTimes       uint64
+	ErrorsSet     bool
+	Errors        uint64
+	AllocationSet bool
+	Allocation    uint64
+	CapacitySet   bool
+	Capacity      uint64
+	PhysicalSet   bool
+	Physical      uint64
+}
+
+type DomainStatsPerf struct {
+	CacheMissesSet        bool
+	CacheMisses           uint64
+	CacheReferencesSet    bool
+	CacheReferences       uint64
+	InstructionsSet       bool
+	Instructions          uint64
+	CpuCyclesSet          bool
+	CpuCycles             uint64
+	BranchInstructionsSet bool
+	BranchInstructions    uint64
+	BranchMissesSet       bool
+	BranchMisses          uint64
+}
+
+type DomainStats struct {
+	Domain  *Domain
+	State   *DomainStatsState
+	Cpu     *DomainStatsCPU
+	Balloon *DomainStatsBalloon
+	Vcpu    []DomainStatsVcpu
+	Net     []DomainStatsNet
+	Block   []DomainStatsBlock
+	Perf    *DomainStatsPerf
+}
+
+// newDomainStats unpacks the statistics of a domain, which libvirtd sends as
+// one flat list of typed parameters. Only the groups which were asked for are
+// set.
+func newDomainStats(dom *Domain, statsTypes DomainStatsTypes, params []rpc.TypedParam) (*DomainStats, error) {
+	stats := &DomainStats{Domain: dom}
+	var counts struct {
+		vcpuSet, netSet, blockSet bool
+		vcpu, net, block          uint
+	}
+	if err := (typedParamFields{
+		"vcpu.current": {set: &counts.vcpuSet, ui: &counts.vcpu},
+		"net.count":    {set: &counts.netSet, ui: &counts.net},
+		"block.count":  {set: &counts.blockSet, ui: &counts.block},
+	}).unpack(params); err != nil {
+		return nil, err
+	}
+
+	fields := typedParamFields{}
+	var state, reason int
+	if statsTypes&DOMAIN_STATS_STATE != 0 {
+		stats.State = &DomainStatsState{}
+		fields["state.state"] = typedParamField{set: &stats.State.StateSet, i: &state}
+		fields["state.reason"] = typedParamField{set: &stats.State.ReasonSet, i: &reason}
+	}
+	if statsTypes&DOMAIN_STATS_CPU_TOTAL != 0 {
+		stats.Cpu = &DomainStatsCPU{}
+		fields["cpu.time"] = typedParamField{set: &stats.Cpu.TimeSet, ul: &stats.Cpu.Time}
+		fields["cpu.user"] = typedParamField{set: &stats.Cpu.UserSet, ul: &stats.Cpu.User}
+		fields["cpu.system"] = typedParamField{set: &stats.Cpu.SystemSet, ul: &stats.Cpu.System}
+	}
+	if statsTypes&DOMAIN_STATS_BALLOON != 0 {
+		stats.Balloon = &DomainStatsBalloon{}
+		fields["balloon.current"] = typedParamField{set: &stats.Balloon.CurrentSet, ul: &stats.Balloon.Current}
+		fields["balloon.maximum"] = typedParamField{set: &stats.Balloon.MaximumSet, ul: &stats.Balloon.Maximum}
+	}
+	if statsTypes&DOMAIN_STATS_VCPU != 0 {
+		stats.Vcpu = make([]DomainStatsVcpu, counts.vcpu)
+		for i := range stats.Vcpu {
+			vcpu := &stats.Vcpu[i]
+			fields[fmt.Sprintf("vcpu.%d.state", i)] = typedParamField{set: &vcpu.StateSet, i: &vcpu.State}
+			fields[fmt.Sprintf("vcpu.%d.time", i)] = typedParamField{set: &vcpu.TimeSet, ul: &vcpu.Time}
+		}
+	}
+	if statsTypes&DOMAIN_STATS_INTERFACE != 0 {
+		stats.Net = make([]DomainStatsNet, counts.net)
+		for i := range stats.Net {
+			net := &stats.Net[i]
+			prefix := fmt.Sprintf("net.%d.", i)
+			fields[prefix+"name"] = typedParamField{set: &net.NameSet, s: &net.Name}
+			fields[prefix+"rx.bytes"] = typedParamField{set: &net.RxBytesSet, ul: &net.RxBytes}
+			fields[prefix+"rx.pkts"] = typedParamField{set: &net.RxPktsSet, ul: &net.RxPkts}
+			fields[prefix+"rx.errs"] = typedParamField{set: &net.RxErrsSet, ul: &net.RxErrs}
+			fields[prefix+"rx.drop"] = typedParamField{set: &net.RxDropSet, ul: &net.RxDrop}
+			fields[prefix+"tx.bytes"] = typedParamField{set: &net.TxBytesSet, ul: &net.TxBytes}
+			fields[prefix+"tx.pkts"] = typedParamField{set: &net.TxPktsSet, ul: &net.TxPkts}
+			fields[prefix+"tx.errs"] = typedParamField{set: &net.TxErrsSet, ul: &net.TxErrs}
+			fields[prefix+"tx.drop"] = typedParamField{set: &net.TxDropSet, ul: &net.TxDrop}
+		}
+	}
+	if statsTypes&DOMAIN_STATS_BLOCK != 0 {
+		stats.Block = make([]DomainStatsBlock, counts.block)
+		for i := range stats.Block {
+			block := &stats.Block[i]
+			prefix := fmt.Sprintf("block.%d.", i)
+			fields[prefix+"name"] = typedParamField{set: &block.NameSet, s: &block.Name}
+			fields[prefix+"path"] = typedParamField{set: &block.PathSet, s: &block.Path}
+			fields[prefix+"rd.reqs"] = typedParamField{set: &block.RdReqsSet, ul: &block.RdReqs}
+			fields[prefix+"rd.bytes"] = typedParamField{set: &block.RdBytesSet, ul: &block.RdBytes}
+			fields[prefix+"rd.times"] = typedParamField{set: &block.RdTimesSet, ul: &block.RdTimes}
+			fields[prefix+"wr.reqs"] = typedParamField{set: &block.WrReqsSet, ul: &block.WrReqs}
+			fields[prefix+"wr.bytes"] = typedParamField{set: &block.WrBytesSet, ul: &block.WrBytes}
+			fields[prefix+"wr.times"] = typedParamField{set: &block.WrTimesSet, ul: &block.WrTimes}
+			fields[prefix+"fl.reqs"] = typedParamField{set: &block.FlReqsSet, ul: &block.FlReqs}
+			fields[prefix+"fl.times"] = typedParamField{set: &block.FlTimesSet, ul: &block.FlTimes}
+			fields[prefix+"errors"] = typedParamField{set: &block.ErrorsSet, ul: &block.Errors}
+			fields[prefix+"allocation"] = typedParamField{set: &block.AllocationSet, ul: &block.Allocation}
+			fields[prefix+"capacity"] = typedParamField{set: &block.CapacitySet, ul: &block.Capacity}
+			fields[prefix+"physical"] = typedParamField{set: &block.PhysicalSet, ul: &block.Physical}
+		}
+	}
+	if statsTypes&DOMAIN_STATS_PERF != 0 {
+		stats.Perf = &DomainStatsPerf{}
+		fields["perf.cache_misses"] = typedParamField{set: &stats.Perf.CacheMissesSet, ul: &stats.Perf.CacheMisses}
+		fields["perf.cache_references"] = typedParamField{set: &stats.Perf.CacheReferencesSet, ul: &stats.Perf.CacheReferences}
+		fields["perf.instructions"] = typedParamField{set: &stats.Perf.InstructionsSet, ul: &stats.Perf.Instructions}
+		fields["perf.cpu_cycles"] = typedParamField{set: &stats.Perf.CpuCyclesSet, ul: &stats.Perf.CpuCycles}
+		fields["perf.branch_instructions"] = typedParamField{set: &stats.Perf.BranchInstructionsSet, ul: &stats.Perf.BranchInstructions}
+		fields["perf.branch_misses"] = typedParamField{set: &stats.Perf.BranchMissesSet, ul: &stats.Perf.BranchMisses}
+	}
+
+	if err := fields.unpack(params); err != nil {
+		return nil, err
+	}
+	if stats.State != nil {
+		stats.State.State = DomainState(state)
+		stats.State.Reason = reason
+	}
+	return stats, nil
+}
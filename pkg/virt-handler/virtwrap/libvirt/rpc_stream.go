@@ -0,0 +1,600 @@
+//go:build !cgo || libvirt_rpc
+// +build !cgo libvirt_rpc
+
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package libvirt
+
+import (
+	"io"
+	"sync"
+)
+
+// streamBufferSize is how much data a stream buffers between libvirtd and
+// the caller before the side which writes has to wait.
+const streamBufferSize = 256 * 1024
+
+// streamChunkSize is what SendAll and RecvAll move per call of the handlers,
+// the same as libvirt does.
+const streamChunkSize = 64 * 1024
+
+var errStreamAborted = Error{Code: ERR_OPERATION_ABORTED, Domain: FROM_STREAMS, Message: "stream aborted", Level: ERR_ERROR}
+
+// streamPipe buffers the data of a stream between the RPC, which runs in a
+// goroutine of its own, and the caller of the stream API. Unlike io.Pipe it
+// can tell whether a read or write would block.
+type streamPipe struct {
+	lock    sync.Mutex
+	changed chan struct{}
+	data    []byte
+	eof     bool
+	err     error
+}
+
+func newStreamPipe() *streamPipe {
+	return &streamPipe{changed: make(chan struct{})}
+}
+
+// notify wakes up everyone waiting for a change, the lock has to be held.
+func (p *streamPipe) notify() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// tryRead reads what is buffered, ok is false if it would have to wait.
+func (p *streamPipe) tryRead(b []byte) (n int, ok bool, err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.err != nil {
+		return 0, true, p.err
+	}
+	if len(p.data) == 0 {
+		if p.eof {
+			return 0, true, io.EOF
+		}
+		return 0, false, nil
+	}
+	n = copy(b, p.data)
+	p.data = p.data[n:]
+	p.notify()
+	return n, true, nil
+}
+
+// tryWrite buffers as much as fits, ok is false if it would have to wait.
+func (p *streamPipe) tryWrite(b []byte) (n int, ok bool, err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.err != nil {
+		return 0, true, p.err
+	}
+	if p.eof {
+		return 0, true, io.ErrClosedPipe
+	}
+	room := streamBufferSize - len(p.data)
+	if room <= 0 {
+		return 0, false, nil
+	}
+	if len(b) < room {
+		room = len(b)
+	}
+	p.data = append(p.data, b[:room]...)
+	p.notify()
+	return room, true, nil
+}
+
+func (p *streamPipe) waitChange() <-chan struct{} {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.changed
+}
+
+func (p *streamPipe) Read(b []byte) (int, error) {
+	for {
+		changed := p.waitChange()
+		if n, ok, err := p.tryRead(b); ok {
+			return n, err
+		}
+		<-changed
+	}
+}
+
+func (p *streamPipe) Write(b []byte) (int, error) {
+	written := 0
+	for written < len(b) {
+		changed := p.waitChange()
+		n, ok, err := p.tryWrite(b[written:])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		if !ok {
+			<-changed
+		}
+	}
+	return written, nil
+}
+
+// closeWrite lets the reader see the end of the data once it read what is
+// buffered.
+func (p *streamPipe) closeWrite() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.eof = true
+	p.notify()
+}
+
+// abort fails all reads and writes from now on, buffered data is dropped.
+func (p *streamPipe) abort(err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.err == nil {
+		p.err = err
+	}
+	p.data = nil
+	p.notify()
+}
+
+func (p *streamPipe) readable() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return len(p.data) > 0 || p.eof || p.err != nil
+}
+
+func (p *streamPipe) writable() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return len(p.data) < streamBufferSize && !p.eof && p.err == nil
+}
+
+// Stream emulates a libvirt stream on top of the stream RPCs of go-libvirt,
+// which transfer all data of the stream in one call. The call runs in a
+// goroutine of its own, which is fed from, or feeds, the pipe the stream API
+// works on. go-libvirt can't send data into console and channel streams, so
+// these can only be read from. Sparse streams transfer holes as zeros.
+type Stream struct {
+	flags StreamFlags
+
+	lock    sync.Mutex
+	pipe    *streamPipe
+	sending bool
+	done    chan struct{}
+	err     error
+	watch   *streamWatch
+}
+
+// streamWatch dispatches the events of a stream to the callback of
+// EventAddCallback. Events are level triggered like in libvirt, the callback
+// is called again as long as the stream stays e.g. readable.
+type streamWatch struct {
+	events      StreamEventType
+	callback    StreamEventCallback
+	dispatching bool
+	kick        chan struct{}
+	stop        chan struct{}
+}
+
+// start runs the RPC of the stream in a goroutine. If sending is true, the
+// RPC reads what is sent into the stream from the pipe, otherwise it writes
+// what it receives into the pipe.
+func (s *Stream) start(sending bool, call func(pipe *streamPipe) error) error {
+	s.lock.Lock()
+	if s.pipe != nil {
+		s.lock.Unlock()
+		return newError(ERR_OPERATION_INVALID, FROM_STREAMS, "stream is already in use")
+	}
+	pipe := newStreamPipe()
+	done := make(chan struct{})
+	s.pipe, s.sending, s.done = pipe, sending, done
+	s.lock.Unlock()
+	s.kickWatch()
+
+	go func() {
+		err := call(pipe)
+		s.lock.Lock()
+		if err != nil {
+			s.err = toError(err)
+			pipe.abort(s.err)
+		} else {
+			pipe.closeWrite()
+		}
+		close(done)
+		s.lock.Unlock()
+		s.kickWatch()
+	}()
+	return result(nil)
+}
+
+// startBuffered runs an RPC whose reply is only known after all data was
+// received, e.g. the MIME type of screenshots. It blocks until then, the data
+// is buffered completely.
+func (s *Stream) startBuffered(call func(w io.Writer) error) error {
+	var buf bufferWriter
+	if err := call(&buf); err != nil {
+		return result(err)
+	}
+	return s.start(false, func(pipe *streamPipe) error {
+		_, err := pipe.Write(buf)
+		return err
+	})
+}
+
+type bufferWriter []byte
+
+func (b *bufferWriter) Write(p []byte) (int, error) {
+	*b = append(*b, p...)
+	return len(p), nil
+}
+
+func (s *Stream) state() (*streamPipe, bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.pipe == nil {
+		return nil, false, newError(ERR_INVALID_STREAM, FROM_STREAMS, "stream is not open")
+	}
+	return s.pipe, s.sending, nil
+}
+
+func (s *Stream) nonBlocking() bool {
+	return s.flags&STREAM_NONBLOCK != 0
+}
+
+// wouldBlock is what non-blocking calls return instead of waiting, libvirt
+// doesn't set an error in that case.
+func wouldBlock() error {
+	return Error{Code: ERR_OK, Domain: FROM_NONE, Level: ERR_NONE}
+}
+
+func (s *Stream) Recv(p []byte) (int, error) {
+	pipe, sending, err := s.state()
+	if err != nil {
+		return 0, err
+	}
+	if sending {
+		return 0, newError(ERR_OPERATION_INVALID, FROM_STREAMS, "stream is not open for receiving")
+	}
+
+	var n int
+	if s.nonBlocking() {
+		var ok bool
+		n, ok, err = pipe.tryRead(p)
+		if !ok {
+			return 0, wouldBlock()
+		}
+	} else {
+		n, err = pipe.Read(p)
+	}
+	s.kickWatch()
+	if err == io.EOF {
+		// Like libvirt the end of the stream is signalled by receiving
+		// nothing
+		return 0, result(nil)
+	} else if err != nil {
+		return 0, result(err)
+	}
+	return n, result(nil)
+}
+
+func (s *Stream) Send(p []byte) (int, error) {
+	pipe, sending, err := s.state()
+	if err != nil {
+		return 0, err
+	}
+	if !sending {
+		return 0, newError(ERR_NO_SUPPORT, FROM_STREAMS, "sending into this stream is not supported by the %s driver", Driver)
+	}
+
+	var n int
+	if s.nonBlocking() {
+		var ok bool
+		n, ok, err = pipe.tryWrite(p)
+		if !ok {
+			return 0, wouldBlock()
+		}
+	} else {
+		n, err = pipe.Write(p)
+	}
+	s.kickWatch()
+	if err != nil {
+		return n, result(err)
+	}
+	return n, result(nil)
+}
+
+// SendAll sends what handler returns until it returns no data.
+func (s *Stream) SendAll(handler StreamSourceFunc) error {
+	for {
+		data, err := handler(s, streamChunkSize)
+		if err != nil {
+			s.Abort()
+			return err
+		}
+		if len(data) == 0 {
+			return nil
+		}
+		if _, err := s.writeAll(data); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Stream) writeAll(data []byte) (int, error) {
+	pipe, sending, err := s.state()
+	if err != nil {
+		return 0, err
+	}
+	if !sending {
+		return 0, newError(ERR_NO_SUPPORT, FROM_STREAMS, "sending into this stream is not supported by the %s driver", Driver)
+	}
+	n, err := pipe.Write(data)
+	s.kickWatch()
+	return n, result(err)
+}
+
+// RecvAll hands all data of the stream over to handler.
+func (s *Stream) RecvAll(handler StreamSinkFunc) error {
+	pipe, sending, err := s.state()
+	if err != nil {
+		return err
+	}
+	if sending {
+		return newError(ERR_OPERATION_INVALID, FROM_STREAMS, "stream is not open for receiving")
+	}
+	buf := make([]byte, streamChunkSize)
+	for {
+		n, err := pipe.Read(buf)
+		s.kickWatch()
+		if err == io.EOF {
+			return result(nil)
+		} else if err != nil {
+			return result(err)
+		}
+		for data := buf[:n]; len(data) > 0; {
+			written, err := handler(s, data)
+			if err != nil {
+				s.Abort()
+				return err
+			}
+			data = data[written:]
+		}
+	}
+}
+
+// SparseSendAll sends the holes of the source as zeros.
+func (s *Stream) SparseSendAll(handler StreamSourceFunc, holeHandler StreamSourceHoleFunc, skipHandler StreamSourceSkipFunc) error {
+	zeros := make([]byte, streamChunkSize)
+	for {
+		inData, length, err := holeHandler(s)
+		if err != nil {
+			s.Abort()
+			return err
+		}
+		if !inData && length > 0 {
+			for left := length; left > 0; {
+				chunk := int64(len(zeros))
+				if left < chunk {
+					chunk = left
+				}
+				if _, err := s.writeAll(zeros[:chunk]); err != nil {
+					return err
+				}
+				left -= chunk
+			}
+			if err := skipHandler(s, length); err != nil {
+				s.Abort()
+				return err
+			}
+			continue
+		}
+
+		want := streamChunkSize
+		if inData && length > 0 && length < int64(want) {
+			want = int(length)
+		}
+		data, err := handler(s, want)
+		if err != nil {
+			s.Abort()
+			return err
+		}
+		if len(data) == 0 {
+			return nil
+		}
+		if _, err := s.writeAll(data); err != nil {
+			return err
+		}
+	}
+}
+
+// SparseRecvAll never calls holeHandler, holes are received as zeros.
+func (s *Stream) SparseRecvAll(handler StreamSinkFunc, holeHandler StreamSinkHoleFunc) error {
+	return s.RecvAll(handler)
+}
+
+// Finish waits for the RPC of a sending stream to transfer what was sent.
+// Receiving streams are not waited for, since the RPCs of consoles only
+// return once the guest writes again. Their RPC fails on its next write.
+func (s *Stream) Finish() error {
+	pipe, sending, err := s.state()
+	if err != nil {
+		return err
+	}
+	if sending {
+		pipe.closeWrite()
+		<-s.done
+	} else {
+		select {
+		case <-s.done:
+		default:
+			pipe.abort(errStreamAborted)
+			return result(nil)
+		}
+	}
+
+	s.lock.Lock()
+	err = s.err
+	s.lock.Unlock()
+	if err != nil {
+		return result(err)
+	}
+	return result(nil)
+}
+
+// Abort fails the RPC of the stream.
+func (s *Stream) Abort() error {
+	pipe, sending, err := s.state()
+	if err != nil {
+		return err
+	}
+	pipe.abort(errStreamAborted)
+	if sending {
+		<-s.done
+	}
+	return result(nil)
+}
+
+// Free stops the dispatching of events, there is nothing to free otherwise.
+func (s *Stream) Free() error {
+	s.EventRemoveCallback()
+	return nil
+}
+
+// readyEvents returns the events which apply to the stream right now.
+func (s *Stream) readyEvents() StreamEventType {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.pipe == nil {
+		return 0
+	}
+	var events StreamEventType
+	select {
+	case <-s.done:
+		if s.err != nil {
+			events |= STREAM_EVENT_ERROR
+		} else {
+			events |= STREAM_EVENT_HANGUP
+		}
+	default:
+	}
+	if s.sending {
+		if s.pipe.writable() {
+			events |= STREAM_EVENT_WRITABLE
+		}
+	} else if s.pipe.readable() {
+		events |= STREAM_EVENT_READABLE
+	}
+	return events
+}
+
+func (s *Stream) EventAddCallback(events StreamEventType, callback StreamEventCallback) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.watch != nil {
+		return newError(ERR_INTERNAL_ERROR, FROM_STREAMS, "stream already has a callback registered")
+	}
+	s.watch = &streamWatch{
+		events:   events,
+		callback: callback,
+		kick:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+	}
+	go s.dispatchEvents(s.watch)
+	return result(nil)
+}
+
+func (s *Stream) EventUpdateCallback(events StreamEventType) error {
+	s.lock.Lock()
+	if s.watch == nil {
+		s.lock.Unlock()
+		return newError(ERR_INTERNAL_ERROR, FROM_STREAMS, "stream does not have a callback registered")
+	}
+	s.watch.events = events
+	s.lock.Unlock()
+	s.kickWatch()
+	return result(nil)
+}
+
+func (s *Stream) EventRemoveCallback() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.watch == nil {
+		return newError(ERR_INTERNAL_ERROR, FROM_STREAMS, "stream does not have a callback registered")
+	}
+	close(s.watch.stop)
+	s.watch = nil
+	return result(nil)
+}
+
+// kickWatch makes the watch look at the stream again, after a change the
+// pipe doesn't notice, like an update of the events.
+func (s *Stream) kickWatch() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.watch == nil {
+		return
+	}
+	select {
+	case s.watch.kick <- struct{}{}:
+	default:
+	}
+}
+
+// dispatchEvents queues a call of the callback on the event loop whenever
+// the stream is ready for one of the events of the watch. There is never
+// more than one call queued, the events are looked up again when it runs.
+func (s *Stream) dispatchEvents(watch *streamWatch) {
+	for {
+		var changed <-chan struct{}
+		s.lock.Lock()
+		if s.pipe != nil {
+			changed = s.pipe.waitChange()
+		}
+		events := watch.events
+		dispatching := watch.dispatching
+		s.lock.Unlock()
+
+		if !dispatching && s.readyEvents()&events != 0 {
+			s.lock.Lock()
+			watch.dispatching = true
+			s.lock.Unlock()
+			defaultEventLoop.queue(func() {
+				s.lock.Lock()
+				current := s.watch == watch
+				events := watch.events
+				s.lock.Unlock()
+				if ready := s.readyEvents() & events; current && ready != 0 {
+					watch.callback(s, ready)
+				}
+				s.lock.Lock()
+				watch.dispatching = false
+				s.lock.Unlock()
+				select {
+				case watch.kick <- struct{}{}:
+				default:
+				}
+			})
+		}
+
+		select {
+		case <-changed:
+		case <-watch.kick:
+		case <-watch.stop:
+			return
+		}
+	}
+}
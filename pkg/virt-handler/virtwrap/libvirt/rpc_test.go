@@ -0,0 +1,230 @@
+//go:build !cgo || libvirt_rpc
+// +build !cgo libvirt_rpc
+
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package libvirt
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	rpc "github.com/digitalocean/go-libvirt"
+	"github.com/digitalocean/go-libvirt/libvirttest"
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RPC driver", func() {
+
+	Context("resolving URIs", func() {
+		table.DescribeTable("should find libvirtd and the URI it opens", func(uri string, flags ConnectFlags, network string, address string, tls bool, name string) {
+			target, err := parseRemoteURI(uri, flags)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(target.network).To(Equal(network))
+			Expect(target.address).To(Equal(address))
+			Expect(target.tls).To(Equal(tls))
+			Expect(target.name).To(Equal(name))
+		},
+			table.Entry("local system", "qemu:///system", ConnectFlags(0), "unix", defaultSocket, false, "qemu:///system"),
+			table.Entry("read only", "qemu:///system", CONNECT_RO, "unix", defaultROSocket, false, "qemu:///system"),
+			table.Entry("explicit unix transport", "qemu+unix:///system", ConnectFlags(0), "unix", defaultSocket, false, "qemu:///system"),
+			table.Entry("custom socket", "qemu+unix:///system?socket=/tmp/sock", ConnectFlags(0), "unix", "/tmp/sock", false, "qemu:///system"),
+			table.Entry("tcp", "qemu+tcp://node01/system", ConnectFlags(0), "tcp", "node01:16509", false, "qemu:///system"),
+			table.Entry("tls with port", "qemu+tls://node01:1234/system?no_verify=1", ConnectFlags(0), "tcp", "node01:1234", true, "qemu:///system"),
+			table.Entry("host without transport", "qemu://node01/system", ConnectFlags(0), "tcp", "node01:16514", true, "qemu:///system"),
+			table.Entry("name parameter", "qemu+tcp://node01/system?name=qemu:///session", ConnectFlags(0), "tcp", "node01:16509", false, "qemu:///session"),
+			table.Entry("no URI", "", ConnectFlags(0), "unix", defaultSocket, false, ""),
+		)
+
+		It("should refuse transports it doesn't have", func() {
+			_, err := parseRemoteURI("qemu+ssh://node01/system", 0)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("with typed parameters", func() {
+		It("should only pack the parameters which are set", func() {
+			params := &DomainMemoryParameters{HardLimitSet: true, HardLimit: 1024, SoftLimit: 512}
+			Expect(params.fields().pack()).To(Equal([]rpc.TypedParam{
+				{Field: "hard_limit", Value: rpc.TypedParamValue{D: typedParamULLong, I: uint64(1024)}},
+			}))
+		})
+
+		It("should unpack the parameters it knows", func() {
+			params := &DomainMemoryParameters{}
+			Expect(params.fields().unpack([]rpc.TypedParam{
+				{Field: "soft_limit", Value: rpc.TypedParamValue{D: typedParamULLong, I: uint64(512)}},
+				{Field: "unknown", Value: rpc.TypedParamValue{D: typedParamString, I: "value"}},
+			})).To(Succeed())
+			Expect(*params).To(Equal(DomainMemoryParameters{SoftLimitSet: true, SoftLimit: 512}))
+		})
+
+		It("should fail for values of the wrong type", func() {
+			params := &DomainMemoryParameters{}
+			Expect(params.fields().unpack([]rpc.TypedParam{
+				{Field: "soft_limit", Value: rpc.TypedParamValue{D: typedParamString, I: "512"}},
+			})).ToNot(Succeed())
+		})
+	})
+
+	Context("with errors", func() {
+		It("should keep the code of errors libvirtd answered with", func() {
+			err := result(rpc.Error{Code: uint32(ERR_NO_DOMAIN), Message: "no domain"})
+			Expect(err).To(Equal(Error{Code: ERR_NO_DOMAIN, Domain: FROM_REMOTE, Message: "no domain", Level: ERR_ERROR}))
+			Expect(GetLastError().Code).To(Equal(ERR_NO_DOMAIN))
+		})
+
+		It("should report other failures as RPC errors", func() {
+			err := result(fmt.Errorf("connection reset"))
+			Expect(err.(Error).Code).To(Equal(ERR_RPC))
+			Expect(err.(Error).Domain).To(Equal(FROM_RPC))
+		})
+
+		It("should reset the last error on success", func() {
+			result(fmt.Errorf("connection reset"))
+			Expect(result(nil)).To(Succeed())
+			Expect(GetLastError().Code).To(Equal(ERR_OK))
+		})
+	})
+
+	Context("with a stream pipe", func() {
+		var pipe *streamPipe
+
+		BeforeEach(func() {
+			pipe = newStreamPipe()
+		})
+
+		It("should not block reads when there is no data", func() {
+			_, ok, err := pipe.tryRead(make([]byte, 4))
+			Expect(ok).To(BeFalse())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pipe.readable()).To(BeFalse())
+		})
+
+		It("should return the buffered data and then the end", func() {
+			Expect(pipe.Write([]byte("data"))).To(Equal(4))
+			pipe.closeWrite()
+			Expect(pipe.writable()).To(BeFalse())
+
+			buf := make([]byte, 8)
+			Expect(pipe.Read(buf)).To(Equal(4))
+			Expect(buf[:4]).To(Equal([]byte("data")))
+			_, err := pipe.Read(buf)
+			Expect(err).To(Equal(io.EOF))
+		})
+
+		It("should not block writes when the buffer is full", func() {
+			Expect(pipe.Write(make([]byte, streamBufferSize))).To(Equal(streamBufferSize))
+			_, ok, err := pipe.tryWrite([]byte("x"))
+			Expect(ok).To(BeFalse())
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("should wake up blocked readers", func() {
+			done := make(chan []byte)
+			go func() {
+				buf := make([]byte, 4)
+				n, _ := pipe.Read(buf)
+				done <- buf[:n]
+			}()
+			pipe.Write([]byte("data"))
+			Eventually(done).Should(Receive(Equal([]byte("data"))))
+		})
+
+		It("should fail reads and writes once aborted", func() {
+			pipe.Write([]byte("data"))
+			pipe.abort(io.ErrUnexpectedEOF)
+			_, err := pipe.Read(make([]byte, 4))
+			Expect(err).To(Equal(io.ErrUnexpectedEOF))
+			_, err = pipe.Write([]byte("data"))
+			Expect(err).To(Equal(io.ErrUnexpectedEOF))
+		})
+	})
+
+	Context("with a mock libvirtd", func() {
+		var conn *Connect
+
+		BeforeEach(func() {
+			netConn, err := libvirttest.New().Dial()
+			Expect(err).ToNot(HaveOccurred())
+			client := rpc.New(netConn)
+			Expect(client.ConnectToURI("qemu:///system")).To(Succeed())
+			conn = &Connect{client: client, conn: netConn}
+			conn.ctx, conn.cancel = context.WithCancel(context.Background())
+		})
+
+		AfterEach(func() {
+			conn.Close()
+		})
+
+		It("should look up domains", func() {
+			dom, err := conn.LookupDomainByName("test")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(dom.GetName()).To(Equal("test"))
+			Expect(dom.GetUUIDString()).To(Equal("dc229f87-d4de-4719-8cfd-2e21c6105b01"))
+			state, _, err := dom.GetState()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(state).To(Equal(DOMAIN_RUNNING))
+		})
+
+		It("should unpack typed parameters", func() {
+			dom, err := conn.LookupDomainByName("test")
+			Expect(err).ToNot(HaveOccurred())
+			params, err := dom.GetBlockIoTune("vda", DOMAIN_AFFECT_LIVE)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(params.WriteBytesSecSet).To(BeTrue())
+			Expect(params.WriteBytesSec).To(Equal(uint64(500000)))
+			Expect(params.GroupName).To(Equal("somename"))
+		})
+
+		It("should list the stats of all domains", func() {
+			stats, err := conn.GetAllDomainStats(nil, DOMAIN_STATS_STATE, 0)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stats).To(HaveLen(2))
+			Expect(stats[0].State).ToNot(BeNil())
+		})
+	})
+
+	Context("with an event loop", func() {
+		It("should run the queued callbacks in order", func() {
+			loop := &eventLoop{wakeup: make(chan struct{}, 1)}
+			calls := []int{}
+			loop.queue(func() { calls = append(calls, 1) })
+			loop.queue(func() { calls = append(calls, 2) })
+			loop.run()
+			Expect(calls).To(Equal([]int{1, 2}))
+		})
+
+		It("should wait for callbacks", func() {
+			loop := &eventLoop{wakeup: make(chan struct{}, 1)}
+			done := make(chan bool)
+			go func() {
+				loop.run()
+				close(done)
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			loop.queue(func() {})
+			Eventually(done).Should(BeClosed())
+		})
+	})
+})
@@ -0,0 +1,488 @@
+//go:build !cgo || libvirt_rpc
+// +build !cgo libvirt_rpc
+
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package libvirt
+
+// The types and constants mirror the ones of libvirt-go, the constants have
+// the values of the C enums they stand for, which are also what the RPC
+// protocol transfers.
+
+// Driver names the implementation of the libvirt API in this build.
+const Driver = "rpc"
+
+type ConnectFlags int
+
+const (
+	CONNECT_RO = ConnectFlags(1 << 0)
+)
+
+type ConnectCredentialType int
+
+const (
+	CRED_USERNAME     = ConnectCredentialType(1)
+	CRED_AUTHNAME     = ConnectCredentialType(2)
+	CRED_LANGUAGE     = ConnectCredentialType(3)
+	CRED_CNONCE       = ConnectCredentialType(4)
+	CRED_PASSPHRASE   = ConnectCredentialType(5)
+	CRED_ECHOPROMPT   = ConnectCredentialType(6)
+	CRED_NOECHOPROMPT = ConnectCredentialType(7)
+	CRED_REALM        = ConnectCredentialType(8)
+	CRED_EXTERNAL     = ConnectCredentialType(9)
+)
+
+type ConnectCredential struct {
+	Type      ConnectCredentialType
+	Prompt    string
+	Challenge string
+	DefResult string
+	Result    string
+	ResultLen int
+}
+
+type ConnectAuthCallback func(creds []*ConnectCredential)
+
+type ConnectAuth struct {
+	CredType []ConnectCredentialType
+	Callback ConnectAuthCallback
+}
+
+type ConnectListAllDomainsFlags int
+
+const (
+	CONNECT_LIST_DOMAINS_ACTIVE   = ConnectListAllDomainsFlags(1 << 0)
+	CONNECT_LIST_DOMAINS_INACTIVE = ConnectListAllDomainsFlags(1 << 1)
+)
+
+type ConnectListAllNodeDeviceFlags int
+
+const (
+	CONNECT_LIST_NODE_DEVICES_CAP_SYSTEM  = ConnectListAllNodeDeviceFlags(1 << 0)
+	CONNECT_LIST_NODE_DEVICES_CAP_PCI_DEV = ConnectListAllNodeDeviceFlags(1 << 1)
+)
+
+type ConnectListAllSecretsFlags int
+
+type ConnectListAllStoragePoolsFlags int
+
+type ConnectGetAllDomainStatsFlags int
+
+const (
+	CONNECT_GET_ALL_DOMAINS_STATS_ACTIVE   = ConnectGetAllDomainStatsFlags(1 << 0)
+	CONNECT_GET_ALL_DOMAINS_STATS_INACTIVE = ConnectGetAllDomainStatsFlags(1 << 1)
+)
+
+type ConnectDomainEventAgentLifecycleState int
+
+const (
+	CONNECT_DOMAIN_EVENT_AGENT_LIFECYCLE_STATE_CONNECTED    = ConnectDomainEventAgentLifecycleState(1)
+	CONNECT_DOMAIN_EVENT_AGENT_LIFECYCLE_STATE_DISCONNECTED = ConnectDomainEventAgentLifecycleState(2)
+)
+
+type ConnectDomainEventAgentLifecycleReason int
+
+type DomainState int
+
+const (
+	DOMAIN_NOSTATE     = DomainState(0)
+	DOMAIN_RUNNING     = DomainState(1)
+	DOMAIN_BLOCKED     = DomainState(2)
+	DOMAIN_PAUSED      = DomainState(3)
+	DOMAIN_SHUTDOWN    = DomainState(4)
+	DOMAIN_SHUTOFF     = DomainState(5)
+	DOMAIN_CRASHED     = DomainState(6)
+	DOMAIN_PMSUSPENDED = DomainState(7)
+)
+
+type DomainRunningReason int
+
+const (
+	DOMAIN_RUNNING_UNKNOWN  = DomainRunningReason(0)
+	DOMAIN_RUNNING_BOOTED   = DomainRunningReason(1)
+	DOMAIN_RUNNING_MIGRATED = DomainRunningReason(2)
+	DOMAIN_RUNNING_POSTCOPY = DomainRunningReason(10)
+)
+
+type DomainPausedReason int
+
+const (
+	DOMAIN_PAUSED_UNKNOWN         = DomainPausedReason(0)
+	DOMAIN_PAUSED_USER            = DomainPausedReason(1)
+	DOMAIN_PAUSED_MIGRATION       = DomainPausedReason(2)
+	DOMAIN_PAUSED_POSTCOPY        = DomainPausedReason(12)
+	DOMAIN_PAUSED_POSTCOPY_FAILED = DomainPausedReason(13)
+)
+
+type DomainShutdownReason int
+
+const (
+	DOMAIN_SHUTDOWN_UNKNOWN = DomainShutdownReason(0)
+	DOMAIN_SHUTDOWN_USER    = DomainShutdownReason(1)
+)
+
+type DomainShutoffReason int
+
+const (
+	DOMAIN_SHUTOFF_UNKNOWN       = DomainShutoffReason(0)
+	DOMAIN_SHUTOFF_SHUTDOWN      = DomainShutoffReason(1)
+	DOMAIN_SHUTOFF_DESTROYED     = DomainShutoffReason(2)
+	DOMAIN_SHUTOFF_CRASHED       = DomainShutoffReason(3)
+	DOMAIN_SHUTOFF_MIGRATED      = DomainShutoffReason(4)
+	DOMAIN_SHUTOFF_SAVED         = DomainShutoffReason(5)
+	DOMAIN_SHUTOFF_FAILED        = DomainShutoffReason(6)
+	DOMAIN_SHUTOFF_FROM_SNAPSHOT = DomainShutoffReason(7)
+)
+
+type DomainCrashedReason int
+
+const (
+	DOMAIN_CRASHED_UNKNOWN  = DomainCrashedReason(0)
+	DOMAIN_CRASHED_PANICKED = DomainCrashedReason(1)
+)
+
+type DomainCreateFlags int
+
+const (
+	DOMAIN_NONE         = DomainCreateFlags(0)
+	DOMAIN_START_PAUSED = DomainCreateFlags(1 << 0)
+)
+
+type DomainDefineFlags int
+
+const (
+	DOMAIN_DEFINE_VALIDATE = DomainDefineFlags(1 << 0)
+)
+
+type DomainUndefineFlagsValues int
+
+const (
+	DOMAIN_UNDEFINE_MANAGED_SAVE       = DomainUndefineFlagsValues(1 << 0)
+	DOMAIN_UNDEFINE_SNAPSHOTS_METADATA = DomainUndefineFlagsValues(1 << 1)
+	DOMAIN_UNDEFINE_NVRAM              = DomainUndefineFlagsValues(1 << 2)
+	DOMAIN_UNDEFINE_KEEP_NVRAM         = DomainUndefineFlagsValues(1 << 3)
+)
+
+type DomainXMLFlags int
+
+const (
+	DOMAIN_XML_SECURE     = DomainXMLFlags(1 << 0)
+	DOMAIN_XML_INACTIVE   = DomainXMLFlags(1 << 1)
+	DOMAIN_XML_UPDATE_CPU = DomainXMLFlags(1 << 2)
+	DOMAIN_XML_MIGRATABLE = DomainXMLFlags(1 << 3)
+)
+
+type DomainModificationImpact int
+
+const (
+	DOMAIN_AFFECT_CURRENT = DomainModificationImpact(0)
+	DOMAIN_AFFECT_LIVE    = DomainModificationImpact(1 << 0)
+	DOMAIN_AFFECT_CONFIG  = DomainModificationImpact(1 << 1)
+)
+
+type DomainConsoleFlags int
+
+const (
+	DOMAIN_CONSOLE_FORCE = DomainConsoleFlags(1 << 0)
+	DOMAIN_CONSOLE_SAFE  = DomainConsoleFlags(1 << 1)
+)
+
+type DomainChannelFlags int
+
+const (
+	DOMAIN_CHANNEL_FORCE = DomainChannelFlags(1 << 0)
+)
+
+type DomainBlockResizeFlags int
+
+const (
+	DOMAIN_BLOCK_RESIZE_BYTES = DomainBlockResizeFlags(1 << 0)
+)
+
+type DomainCoreDumpFlags int
+
+const (
+	DUMP_CRASH        = DomainCoreDumpFlags(1 << 0)
+	DUMP_LIVE         = DomainCoreDumpFlags(1 << 1)
+	DUMP_BYPASS_CACHE = DomainCoreDumpFlags(1 << 2)
+	DUMP_RESET        = DomainCoreDumpFlags(1 << 3)
+	DUMP_MEMORY_ONLY  = DomainCoreDumpFlags(1 << 4)
+)
+
+type DomainCoreDumpFormat int
+
+const (
+	DOMAIN_CORE_DUMP_FORMAT_RAW          = DomainCoreDumpFormat(0)
+	DOMAIN_CORE_DUMP_FORMAT_KDUMP_ZLIB   = DomainCoreDumpFormat(1)
+	DOMAIN_CORE_DUMP_FORMAT_KDUMP_LZO    = DomainCoreDumpFormat(2)
+	DOMAIN_CORE_DUMP_FORMAT_KDUMP_SNAPPY = DomainCoreDumpFormat(3)
+)
+
+type DomainMetadataType int
+
+const (
+	DOMAIN_METADATA_DESCRIPTION = DomainMetadataType(0)
+	DOMAIN_METADATA_TITLE       = DomainMetadataType(1)
+	DOMAIN_METADATA_ELEMENT     = DomainMetadataType(2)
+)
+
+type DomainGetJobStatsFlags int
+
+const (
+	DOMAIN_JOB_STATS_COMPLETED = DomainGetJobStatsFlags(1 << 0)
+)
+
+type DomainJobType int
+
+const (
+	DOMAIN_JOB_NONE      = DomainJobType(0)
+	DOMAIN_JOB_BOUNDED   = DomainJobType(1)
+	DOMAIN_JOB_UNBOUNDED = DomainJobType(2)
+	DOMAIN_JOB_COMPLETED = DomainJobType(3)
+	DOMAIN_JOB_FAILED    = DomainJobType(4)
+	DOMAIN_JOB_CANCELLED = DomainJobType(5)
+)
+
+type DomainMemoryStatTags int
+
+// DOMAIN_MEMORY_STAT_NR is the number of statistics of libvirt 5.4 and later,
+// older daemons just return fewer.
+const (
+	DOMAIN_MEMORY_STAT_SWAP_IN  = DomainMemoryStatTags(0)
+	DOMAIN_MEMORY_STAT_SWAP_OUT = DomainMemoryStatTags(1)
+	DOMAIN_MEMORY_STAT_NR       = DomainMemoryStatTags(13)
+)
+
+type DomainInterfaceAddressesSource int
+
+const (
+	DOMAIN_INTERFACE_ADDRESSES_SRC_LEASE = DomainInterfaceAddressesSource(0)
+	DOMAIN_INTERFACE_ADDRESSES_SRC_AGENT = DomainInterfaceAddressesSource(1)
+	DOMAIN_INTERFACE_ADDRESSES_SRC_ARP   = DomainInterfaceAddressesSource(2)
+)
+
+type DomainQemuMonitorCommandFlags int
+
+const (
+	DOMAIN_QEMU_MONITOR_COMMAND_DEFAULT = DomainQemuMonitorCommandFlags(0)
+	DOMAIN_QEMU_MONITOR_COMMAND_HMP     = DomainQemuMonitorCommandFlags(1 << 0)
+)
+
+type DomainQemuAgentCommandTimeout int
+
+const (
+	DOMAIN_QEMU_AGENT_COMMAND_BLOCK   = DomainQemuAgentCommandTimeout(-2)
+	DOMAIN_QEMU_AGENT_COMMAND_DEFAULT = DomainQemuAgentCommandTimeout(-1)
+	DOMAIN_QEMU_AGENT_COMMAND_NOWAIT  = DomainQemuAgentCommandTimeout(0)
+)
+
+type DomainStatsTypes int
+
+const (
+	DOMAIN_STATS_STATE     = DomainStatsTypes(1 << 0)
+	DOMAIN_STATS_CPU_TOTAL = DomainStatsTypes(1 << 1)
+	DOMAIN_STATS_BALLOON   = DomainStatsTypes(1 << 2)
+	DOMAIN_STATS_VCPU      = DomainStatsTypes(1 << 3)
+	DOMAIN_STATS_INTERFACE = DomainStatsTypes(1 << 4)
+	DOMAIN_STATS_BLOCK     = DomainStatsTypes(1 << 5)
+	DOMAIN_STATS_PERF      = DomainStatsTypes(1 << 6)
+)
+
+type KeycodeSet int
+
+const (
+	KEYCODE_SET_LINUX = KeycodeSet(0)
+)
+
+type DomainEventType int
+
+const (
+	DOMAIN_EVENT_DEFINED     = DomainEventType(0)
+	DOMAIN_EVENT_UNDEFINED   = DomainEventType(1)
+	DOMAIN_EVENT_STARTED     = DomainEventType(2)
+	DOMAIN_EVENT_SUSPENDED   = DomainEventType(3)
+	DOMAIN_EVENT_RESUMED     = DomainEventType(4)
+	DOMAIN_EVENT_STOPPED     = DomainEventType(5)
+	DOMAIN_EVENT_SHUTDOWN    = DomainEventType(6)
+	DOMAIN_EVENT_PMSUSPENDED = DomainEventType(7)
+	DOMAIN_EVENT_CRASHED     = DomainEventType(8)
+)
+
+type DomainEventDefinedDetailType int
+
+const (
+	DOMAIN_EVENT_DEFINED_ADDED   = DomainEventDefinedDetailType(0)
+	DOMAIN_EVENT_DEFINED_UPDATED = DomainEventDefinedDetailType(1)
+	DOMAIN_EVENT_DEFINED_RENAMED = DomainEventDefinedDetailType(2)
+)
+
+type DomainEventWatchdogAction int
+
+const (
+	DOMAIN_EVENT_WATCHDOG_NONE     = DomainEventWatchdogAction(0)
+	DOMAIN_EVENT_WATCHDOG_PAUSE    = DomainEventWatchdogAction(1)
+	DOMAIN_EVENT_WATCHDOG_RESET    = DomainEventWatchdogAction(2)
+	DOMAIN_EVENT_WATCHDOG_POWEROFF = DomainEventWatchdogAction(3)
+	DOMAIN_EVENT_WATCHDOG_SHUTDOWN = DomainEventWatchdogAction(4)
+)
+
+type SecretUsageType int
+
+const (
+	SECRET_USAGE_TYPE_NONE   = SecretUsageType(0)
+	SECRET_USAGE_TYPE_VOLUME = SecretUsageType(1)
+	SECRET_USAGE_TYPE_CEPH   = SecretUsageType(2)
+	SECRET_USAGE_TYPE_ISCSI  = SecretUsageType(3)
+	SECRET_USAGE_TYPE_TLS    = SecretUsageType(4)
+	SECRET_USAGE_TYPE_VTPM   = SecretUsageType(5)
+)
+
+type StorageXMLFlags int
+
+type StoragePoolBuildFlags int
+
+const (
+	STORAGE_POOL_BUILD_NEW = StoragePoolBuildFlags(0)
+)
+
+type StoragePoolCreateFlags int
+
+const (
+	STORAGE_POOL_CREATE_NORMAL = StoragePoolCreateFlags(0)
+)
+
+type StorageVolCreateFlags int
+
+type StorageVolResizeFlags int
+
+type StorageVolDeleteFlags int
+
+const (
+	STORAGE_VOL_DELETE_NORMAL = StorageVolDeleteFlags(0)
+)
+
+type StorageVolUploadFlags int
+
+const (
+	STORAGE_VOL_UPLOAD_SPARSE_STREAM = StorageVolUploadFlags(1 << 0)
+)
+
+type StorageVolDownloadFlags int
+
+const (
+	STORAGE_VOL_DOWNLOAD_SPARSE_STREAM = StorageVolDownloadFlags(1 << 0)
+)
+
+type StorageVolType int
+
+type StreamFlags int
+
+const (
+	STREAM_NONBLOCK = StreamFlags(1 << 0)
+)
+
+type StreamEventType int
+
+const (
+	STREAM_EVENT_READABLE = StreamEventType(1 << 0)
+	STREAM_EVENT_WRITABLE = StreamEventType(1 << 1)
+	STREAM_EVENT_ERROR    = StreamEventType(1 << 2)
+	STREAM_EVENT_HANGUP   = StreamEventType(1 << 3)
+)
+
+type DomainBlockInfo struct {
+	Capacity   uint64
+	Allocation uint64
+	Physical   uint64
+}
+
+type DomainIPAddress struct {
+	Type   int
+	Addr   string
+	Prefix uint
+}
+
+type DomainInterface struct {
+	Name   string
+	Hwaddr string
+	Addrs  []DomainIPAddress
+}
+
+type DomainMemoryStat struct {
+	Tag int32
+	Val uint64
+}
+
+type StorageVolInfo struct {
+	Type       StorageVolType
+	Capacity   uint64
+	Allocation uint64
+}
+
+type DomainEventLifecycle struct {
+	Event DomainEventType
+	// Detail is one of the various DomainEvent*DetailType enums
+	Detail int
+}
+
+type DomainEventLifecycleCallback func(c *Connect, d *Domain, event *DomainEventLifecycle)
+
+type DomainEventWatchdog struct {
+	Action DomainEventWatchdogAction
+}
+
+type DomainEventWatchdogCallback func(c *Connect, d *Domain, event *DomainEventWatchdog)
+
+type DomainEventRTCChange struct {
+	Utcoffset int64
+}
+
+type DomainEventRTCChangeCallback func(c *Connect, d *Domain, event *DomainEventRTCChange)
+
+type DomainEventDeviceAdded struct {
+	DevAlias string
+}
+
+type DomainEventDeviceAddedCallback func(c *Connect, d *Domain, event *DomainEventDeviceAdded)
+
+type DomainEventDeviceRemoved struct {
+	DevAlias string
+}
+
+type DomainEventDeviceRemovedCallback func(c *Connect, d *Domain, event *DomainEventDeviceRemoved)
+
+type DomainEventAgentLifecycle struct {
+	State  ConnectDomainEventAgentLifecycleState
+	Reason ConnectDomainEventAgentLifecycleReason
+}
+
+type DomainEventAgentLifecycleCallback func(c *Connect, d *Domain, event *DomainEventAgentLifecycle)
+
+type StreamEventCallback func(*Stream, StreamEventType)
+
+type StreamSinkFunc func(*Stream, []byte) (int, error)
+
+type StreamSinkHoleFunc func(*Stream, int64) error
+
+type StreamSourceFunc func(*Stream, int) ([]byte, error)
+
+type StreamSourceHoleFunc func(*Stream) (bool, int64, error)
+
+type StreamSourceSkipFunc func(*Stream, int64) error
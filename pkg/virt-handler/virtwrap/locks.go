@@ -0,0 +1,76 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"sync"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cache"
+)
+
+type domainLock struct {
+	sync.Mutex
+	users int
+}
+
+// domainLocks serializes operations on the same domain, while operations on
+// different domains run in parallel. libvirt itself only serializes single
+// API calls, so without it e.g. a device update could interleave with the
+// undefine of the same domain. The zero value is ready to use.
+type domainLocks struct {
+	lock  sync.Mutex
+	locks map[string]*domainLock
+}
+
+// Lock blocks until no other operation holds the lock of the domain and
+// returns the function to release it again.
+func (d *domainLocks) Lock(name string) func() {
+	d.lock.Lock()
+	if d.locks == nil {
+		d.locks = make(map[string]*domainLock)
+	}
+	l, exists := d.locks[name]
+	if !exists {
+		l = &domainLock{}
+		d.locks[name] = l
+	}
+	l.users++
+	d.lock.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+
+		d.lock.Lock()
+		defer d.lock.Unlock()
+		l.users--
+		if l.users == 0 {
+			delete(d.locks, name)
+		}
+	}
+}
+
+// LockDomain gives the caller exclusive access to the domain of the VM with
+// respect to all other operations of the manager which change the domain.
+// The returned function releases the lock.
+func (l *LibvirtDomainManager) LockDomain(vm *v1.VirtualMachine) func() {
+	return l.domainLocks.Lock(cache.VMNamespaceKeyFunc(vm))
+}
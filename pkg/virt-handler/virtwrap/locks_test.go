@@ -0,0 +1,66 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Domain locks", func() {
+	var locks *domainLocks
+
+	BeforeEach(func() {
+		locks = &domainLocks{}
+	})
+
+	It("should serialize operations on the same domain", func() {
+		unlock := locks.Lock("default_testvm")
+
+		acquired := make(chan struct{})
+		go func() {
+			locks.Lock("default_testvm")()
+			close(acquired)
+		}()
+		Consistently(acquired, 100*time.Millisecond).ShouldNot(BeClosed())
+
+		unlock()
+		Eventually(acquired).Should(BeClosed())
+	})
+
+	It("should not block operations on other domains", func() {
+		unlock := locks.Lock("default_testvm")
+		defer unlock()
+
+		acquired := make(chan struct{})
+		go func() {
+			locks.Lock("default_othervm")()
+			close(acquired)
+		}()
+		Eventually(acquired).Should(BeClosed())
+	})
+
+	It("should forget locks nobody holds anymore", func() {
+		locks.Lock("default_testvm")()
+		Expect(locks.locks).To(BeEmpty())
+	})
+})
@@ -0,0 +1,165 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+)
+
+// The MAC addresses of interfaces without one in the spec are allocated once
+// and stored on the VM object in the v1.MACAddressesAnnotation, so that they
+// survive restarts of virt-handler and stay the same when the VM migrates.
+
+// Generating a new MAC for an interface is retried with a different seed
+// if the address is already taken.
+const maxMACAttempts = 16
+
+// generateMAC derives a locally administered unicast MAC from the VM and the
+// index of the interface. The second and third byte only depend on the
+// namespace, so all VMs of a namespace share a common prefix.
+func generateMAC(namespace string, name string, index int, attempt int) string {
+	prefix := sha256.Sum256([]byte(namespace))
+	suffix := sha256.Sum256([]byte(fmt.Sprintf("%s/%s/%d/%d", namespace, name, index, attempt)))
+	return fmt.Sprintf("02:%02x:%02x:%02x:%02x:%02x", prefix[0], prefix[1], suffix[0], suffix[1], suffix[2])
+}
+
+// allocatedMACs returns the MAC addresses of the annotation of the VM.
+func allocatedMACs(vm *v1.VirtualMachine) []string {
+	annotation, exists := vm.ObjectMeta.Annotations[v1.MACAddressesAnnotation]
+	if !exists {
+		return nil
+	}
+	return strings.Split(annotation, ",")
+}
+
+// specMAC returns the MAC address of the interface in the spec of the VM.
+func specMAC(iface v1.Interface) string {
+	if iface.MAC == nil {
+		return ""
+	}
+	return strings.ToLower(iface.MAC.MAC)
+}
+
+// NeedsMACs tells whether interfaces of the VM are still missing a MAC
+// address, which has to be allocated with AllocateMACs first.
+func NeedsMACs(vm *v1.VirtualMachine) bool {
+	if vm.Spec.Domain == nil {
+		return false
+	}
+	allocated := allocatedMACs(vm)
+	for i, iface := range vm.Spec.Domain.Devices.Interfaces {
+		if specMAC(iface) != "" {
+			continue
+		}
+		if i >= len(allocated) || allocated[i] == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// MACsInUse returns the MAC addresses of the VMs and the VMs which use them.
+func MACsInUse(vms []v1.VirtualMachine) map[string]string {
+	inUse := make(map[string]string)
+	for i := range vms {
+		vm := &vms[i]
+		if vm.Spec.Domain == nil {
+			continue
+		}
+		owner := vm.ObjectMeta.Namespace + "/" + vm.ObjectMeta.Name
+		for _, mac := range allocatedMACs(vm) {
+			if mac != "" {
+				inUse[mac] = owner
+			}
+		}
+		for _, iface := range vm.Spec.Domain.Devices.Interfaces {
+			if mac := specMAC(iface); mac != "" {
+				inUse[mac] = owner
+			}
+		}
+	}
+	return inUse
+}
+
+// AllocateMACs gives every interface of the VM without a MAC address one,
+// which none of the other VMs uses, and stores them in the annotation of the
+// VM. MAC addresses which were already allocated to an interface are kept.
+// The MAC addresses of the spec are checked against the ones in use.
+func AllocateMACs(vm *v1.VirtualMachine, inUse map[string]string) error {
+	owner := vm.ObjectMeta.Namespace + "/" + vm.ObjectMeta.Name
+	taken := func(mac string) bool {
+		current, exists := inUse[mac]
+		return exists && current != owner
+	}
+
+	allocated := allocatedMACs(vm)
+	macs := make([]string, len(vm.Spec.Domain.Devices.Interfaces))
+	for i, iface := range vm.Spec.Domain.Devices.Interfaces {
+		if mac := specMAC(iface); mac != "" {
+			if taken(mac) {
+				return fmt.Errorf("MAC address %s of interface %d is already in use by %s", mac, i, inUse[mac])
+			}
+			continue
+		}
+		if i < len(allocated) && allocated[i] != "" {
+			macs[i] = allocated[i]
+			continue
+		}
+		for attempt := 0; attempt < maxMACAttempts; attempt++ {
+			candidate := generateMAC(vm.ObjectMeta.Namespace, vm.ObjectMeta.Name, i, attempt)
+			if !taken(candidate) {
+				macs[i] = candidate
+				break
+			}
+		}
+		if macs[i] == "" {
+			return fmt.Errorf("no free MAC address found for interface %d", i)
+		}
+		inUse[macs[i]] = owner
+	}
+
+	if vm.ObjectMeta.Annotations == nil {
+		vm.ObjectMeta.Annotations = make(map[string]string)
+	}
+	vm.ObjectMeta.Annotations[v1.MACAddressesAnnotation] = strings.Join(macs, ",")
+	return nil
+}
+
+// prepareMACs gives every interface of the domain without a MAC address the
+// one which was allocated to it on the VM.
+func prepareMACs(vm *v1.VirtualMachine, spec *api.DomainSpec) error {
+	allocated := allocatedMACs(vm)
+	for i, iface := range spec.Devices.Interfaces {
+		if iface.MAC != nil && iface.MAC.MAC != "" {
+			spec.Devices.Interfaces[i].MAC = &api.MAC{MAC: strings.ToLower(iface.MAC.MAC)}
+			continue
+		}
+		if i >= len(allocated) || allocated[i] == "" {
+			return fmt.Errorf("no MAC address is allocated to interface %d", i)
+		}
+		spec.Devices.Interfaces[i].MAC = &api.MAC{MAC: allocated[i]}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+)
+
+var _ = Describe("MAC pool", func() {
+	var vm *v1.VirtualMachine
+
+	BeforeEach(func() {
+		vm = newVM("default", "testvm")
+		vm.Spec.Domain.Devices.Interfaces = []v1.Interface{
+			{Type: "network", Source: v1.InterfaceSource{Network: "default"}},
+			{Type: "bridge", Source: v1.InterfaceSource{Bridge: "br0"}},
+		}
+	})
+
+	newSpec := func() *api.DomainSpec {
+		spec := api.NewMinimalDomainSpec("default_testvm")
+		spec.Devices.Interfaces = []api.Interface{
+			{Type: "network", Source: api.InterfaceSource{Network: "default"}},
+			{Type: "bridge", Source: api.InterfaceSource{Bridge: "br0"}},
+		}
+		return spec
+	}
+
+	It("should generate locally administered MACs with a per namespace prefix", func() {
+		mac := generateMAC("default", "testvm", 0, 0)
+		Expect(mac).To(MatchRegexp("^02(:[0-9a-f]{2}){5}$"))
+		Expect(generateMAC("default", "testvm", 0, 0)).To(Equal(mac))
+		Expect(generateMAC("default", "othervm", 0, 0)[:8]).To(Equal(mac[:8]))
+		Expect(generateMAC("default", "testvm", 1, 0)).ToNot(Equal(mac))
+	})
+
+	It("should store the allocated MACs on the VM", func() {
+		Expect(NeedsMACs(vm)).To(BeTrue())
+		Expect(AllocateMACs(vm, map[string]string{})).To(Succeed())
+		Expect(NeedsMACs(vm)).To(BeFalse())
+		Expect(vm.ObjectMeta.Annotations[v1.MACAddressesAnnotation]).To(Equal(generateMAC("default", "testvm", 0, 0) + "," + generateMAC("default", "testvm", 1, 0)))
+
+		spec := newSpec()
+		Expect(prepareMACs(vm, spec)).To(Succeed())
+		Expect(spec.Devices.Interfaces[0].MAC.MAC).To(Equal(generateMAC("default", "testvm", 0, 0)))
+		Expect(spec.Devices.Interfaces[1].MAC.MAC).To(Equal(generateMAC("default", "testvm", 1, 0)))
+	})
+
+	It("should keep the MACs which are already allocated", func() {
+		vm.ObjectMeta.Annotations = map[string]string{v1.MACAddressesAnnotation: "02:00:00:00:00:01"}
+		Expect(NeedsMACs(vm)).To(BeTrue())
+		Expect(AllocateMACs(vm, MACsInUse([]v1.VirtualMachine{*vm}))).To(Succeed())
+		Expect(vm.ObjectMeta.Annotations[v1.MACAddressesAnnotation]).To(Equal("02:00:00:00:00:01," + generateMAC("default", "testvm", 1, 0)))
+	})
+
+	It("should pick another MAC if another VM uses it", func() {
+		other := newVM("default", "othervm")
+		other.ObjectMeta.Annotations = map[string]string{v1.MACAddressesAnnotation: generateMAC("default", "testvm", 0, 0)}
+		Expect(AllocateMACs(vm, MACsInUse([]v1.VirtualMachine{*other, *vm}))).To(Succeed())
+		Expect(allocatedMACs(vm)[0]).To(Equal(generateMAC("default", "testvm", 0, 1)))
+	})
+
+	It("should leave user defined MACs out of the annotation", func() {
+		vm.Spec.Domain.Devices.Interfaces[0].MAC = &v1.MAC{MAC: "02:00:00:00:00:0A"}
+		Expect(AllocateMACs(vm, map[string]string{})).To(Succeed())
+		Expect(allocatedMACs(vm)).To(Equal([]string{"", generateMAC("default", "testvm", 1, 0)}))
+
+		spec := newSpec()
+		spec.Devices.Interfaces[0].MAC = &api.MAC{MAC: "02:00:00:00:00:0A"}
+		Expect(prepareMACs(vm, spec)).To(Succeed())
+		Expect(spec.Devices.Interfaces[0].MAC.MAC).To(Equal("02:00:00:00:00:0a"))
+	})
+
+	It("should reject user defined MACs which are in use", func() {
+		other := newVM("default", "othervm")
+		other.Spec.Domain.Devices.Interfaces[0].MAC = &v1.MAC{MAC: "02:00:00:00:00:01"}
+		vm.Spec.Domain.Devices.Interfaces[0].MAC = &v1.MAC{MAC: "02:00:00:00:00:01"}
+		Expect(AllocateMACs(vm, MACsInUse([]v1.VirtualMachine{*other}))).ToNot(Succeed())
+	})
+
+	It("should not define interfaces without an allocated MAC", func() {
+		Expect(prepareMACs(vm, newSpec())).ToNot(Succeed())
+	})
+})
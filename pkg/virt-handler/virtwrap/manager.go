@@ -26,17 +26,20 @@ package virtwrap
 */
 
 import (
+	"encoding/json"
 	"encoding/xml"
 	goerrors "errors"
 	"fmt"
 
 	"github.com/jeevatkm/go-model"
-	"github.com/libvirt/libvirt-go"
+	"golang.org/x/net/context"
 	kubev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/errors"
+	kubecache "k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 
 	"strings"
+	"sync"
 
 	"kubevirt.io/kubevirt/pkg/api/v1"
 	"kubevirt.io/kubevirt/pkg/logging"
@@ -45,6 +48,8 @@ import (
 	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
 	domainerrors "kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/errors"
 	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/isolation"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/jobs"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
 )
 
 type DomainManager interface {
@@ -52,19 +57,68 @@ type DomainManager interface {
 	RemoveVMSecrets(*v1.VirtualMachine) error
 	SyncVM(*v1.VirtualMachine) (*api.DomainSpec, error)
 	KillVM(*v1.VirtualMachine) error
+	RemoveVMData(*v1.VirtualMachine) error
+	ReconcileExistingGuests(vmStore kubecache.Store) error
+	GetJobInfo(*v1.VirtualMachine) (*api.DomainJobInfo, error)
+	AbortJob(*v1.VirtualMachine) error
+	TuneMigration(*v1.VirtualMachine, *v1.MigrationOptions) error
+	GetDomainDevices(*v1.VirtualMachine) (*api.DomainDevices, error)
+	GuestNetworkStatus(*v1.VirtualMachine) ([]v1.VMNetworkInterface, error)
+	GuestFilesystemInfo(*v1.VirtualMachine) ([]v1.VMFilesystem, error)
+	FSTrim(vm *v1.VirtualMachine, trigger Trigger) error
+	DumpCrashedGuest(*v1.VirtualMachine) (string, error)
+	MemoryDump(vm *v1.VirtualMachine, path string, format string, trigger Trigger) (string, error)
+	SendKey(vm *v1.VirtualMachine, combination string, trigger Trigger) error
+	QemuMonitorCommand(vm *v1.VirtualMachine, command string, arguments map[string]interface{}) (json.RawMessage, error)
+	MeasureDirtyRate(vm *v1.VirtualMachine, seconds int64) (uint64, error)
+	IsAdopted(*v1.VirtualMachine) bool
+	DrainGuests(policy DrainPolicy) error
+	RestartCrashedGuest(*v1.VirtualMachine) (uint, error)
+	HealthCheck(vm *v1.VirtualMachine, pingAgent bool) (*HealthResult, error)
+	GetLaunchMeasurement(*v1.VirtualMachine) (string, error)
+	GetDeviceAllocations(*v1.VirtualMachine) ([]api.DeviceAllocation, error)
+	WaitsForLaunchSecret(*v1.VirtualMachine) (bool, error)
+	InjectLaunchSecret(vm *v1.VirtualMachine, header string, secret string, trigger Trigger) error
+	GetRTCOffset(*v1.VirtualMachine) (int64, error)
+	GetCPUStats(*v1.VirtualMachine) (*cli.CPUStats, error)
+	GetSchedulerTuning(*v1.VirtualMachine) (*cli.SchedulerTuning, error)
+	TuneScheduler(vm *v1.VirtualMachine, tuning *cli.SchedulerTuning, trigger Trigger) error
+	TuneMemory(vm *v1.VirtualMachine, tuning *cli.MemoryTuning, trigger Trigger) error
+	TuneBlkio(vm *v1.VirtualMachine, tuning *cli.BlkioTuning, trigger Trigger) error
+	WaitForState(ctx context.Context, vm *v1.VirtualMachine, states ...api.LifeCycle) (api.LifeCycle, error)
+	GetAuditTrail(*v1.VirtualMachine) []AuditEntry
+	AgentConnected(*v1.VirtualMachine) (bool, error)
+	ListJobs(*v1.VirtualMachine) []jobs.Job
+	CancelJob(vm *v1.VirtualMachine, id string, trigger Trigger) error
 }
 
+// LibvirtDomainManager is safe for concurrent use. Operations which change
+// a domain are executed in the order they were requested, one after another
+// per domain, see runOnDomain and LockDomain. The caches which are shared
+// between all domains are guarded by cacheLock.
 type LibvirtDomainManager struct {
 	virConn              cli.Connection
 	recorder             record.EventRecorder
+	cacheLock            sync.Mutex
 	secretCache          map[string][]string
+	secretKey            []byte
+	hostDeviceCache      map[string]string
+	adoptedDomains       map[string]string
+	pendingRenames       map[string]string
+	domainSpecs          *domainSpecCache
+	domainLocks          domainLocks
+	domainQueues         domainQueues
+	stateWaiters         stateWaiters
+	auditTrail           auditTrail
+	agentStates          agentStates
+	jobs                 jobs.JobManager
 	podIsolationDetector isolation.PodIsolationDetector
 }
 
 func (l *LibvirtDomainManager) initiateSecretCache() error {
 	secrets, err := l.virConn.ListSecrets()
 	if err != nil {
-		if err.(libvirt.Error).Code == libvirt.ERR_NO_SECRET {
+		if domainerrors.IsSecretNotFound(err) {
 			return nil
 		} else {
 			return err
@@ -90,10 +144,10 @@ func (l *LibvirtDomainManager) initiateSecretCache() error {
 			return err
 		}
 
-		if secretSpec.Description == "" {
+		domName, _ := parseSecretDescription(secretSpec.Description)
+		if domName == "" {
 			continue
 		}
-		domName := secretSpec.Description
 		l.secretCache[domName] = append(l.secretCache[domName], secretUUID)
 	}
 
@@ -101,78 +155,122 @@ func (l *LibvirtDomainManager) initiateSecretCache() error {
 }
 
 func NewLibvirtDomainManager(connection cli.Connection, recorder record.EventRecorder, isolationDetector isolation.PodIsolationDetector) (DomainManager, error) {
+	secretKey, err := loadSecretKey()
+	if err != nil {
+		return nil, err
+	}
 	manager := LibvirtDomainManager{
 		virConn:              connection,
 		recorder:             recorder,
 		secretCache:          make(map[string][]string),
+		secretKey:            secretKey,
+		hostDeviceCache:      make(map[string]string),
+		adoptedDomains:       make(map[string]string),
+		pendingRenames:       make(map[string]string),
+		domainSpecs:          newDomainSpecCache(),
+		jobs:                 jobs.NewJobManager(),
 		podIsolationDetector: isolationDetector,
 	}
 
-	err := manager.initiateSecretCache()
+	err = manager.initiateSecretCache()
+	if err != nil {
+		return nil, err
+	}
+	err = manager.watchDomainChanges()
 	if err != nil {
 		return nil, err
 	}
 	return &manager, nil
 }
 
+// requireFeature fails if libvirt or qemu on the host are too old for the
+// feature.
+func (l *LibvirtDomainManager) requireFeature(f cli.Feature) error {
+	version, err := cli.GetHypervisorVersion(l.virConn)
+	if err != nil {
+		return err
+	}
+	return version.RequireFeature(f)
+}
+
 func (l *LibvirtDomainManager) SyncVMSecret(vm *v1.VirtualMachine, usageType string, usageID string, secretValue string) error {
+	l.cacheLock.Lock()
+	defer l.cacheLock.Unlock()
 
 	domName := cache.VMNamespaceKeyFunc(vm)
 
-	switch usageType {
-	case "iscsi":
-		libvirtSecret, err := l.virConn.LookupSecretByUsage(libvirt.SECRET_USAGE_TYPE_ISCSI, usageID)
+	libvirtUsageType, supported := secretUsageTypes[usageType]
+	if !supported {
+		return goerrors.New(fmt.Sprintf("unsupported secret usage type %s", usageType))
+	}
 
-		// If the secret doesn't exist, make it
-		if err != nil {
-			if err.(libvirt.Error).Code != libvirt.ERR_NO_SECRET {
-				logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Failed to get libvirt secret.")
-				return err
+	libvirtSecret, err := l.virConn.LookupSecretByUsage(libvirtUsageType, usageID)
 
-			}
-			secretSpec := &api.SecretSpec{
-				Ephemeral:   "no",
-				Private:     "yes",
-				Description: domName,
-				Usage: api.SecretUsage{
-					Type:   usageType,
-					Target: usageID,
-				},
-			}
+	// If the secret doesn't exist, make it
+	if err != nil {
+		if !domainerrors.IsSecretNotFound(err) {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Failed to get libvirt secret.")
+			return err
 
-			xmlStr, err := xml.Marshal(&secretSpec)
-			libvirtSecret, err = l.virConn.SecretDefineXML(string(xmlStr))
-			if err != nil {
-				logging.DefaultLogger().Error().Reason(err).Msg("Defining the VM secret failed.")
-				return err
-			}
+		}
+		secretSpec := &api.SecretSpec{
+			Ephemeral:   "no",
+			Private:     "yes",
+			Description: secretDescription(l.secretKey, domName, secretValue),
+			Usage:       newSecretUsage(usageType, usageID),
+		}
 
-			secretUUID, err := libvirtSecret.GetUUIDString()
-			if err != nil {
-				// This error really shouldn't occur. The UUID should be known
-				// locally by the libvirt client. If this fails, we make a best
-				// effort attempt at removing the secret from libvirt.
-				libvirtSecret.Undefine()
-				libvirtSecret.Free()
-				return err
-			}
-			l.secretCache[domName] = append(l.secretCache[domName], secretUUID)
+		xmlStr, err := xml.Marshal(&secretSpec)
+		libvirtSecret, err = l.virConn.SecretDefineXML(string(xmlStr))
+		if err != nil {
+			logging.DefaultLogger().Error().Reason(err).Msg("Defining the VM secret failed.")
+			return err
 		}
-		defer libvirtSecret.Free()
 
-		err = libvirtSecret.SetValue([]byte(secretValue), 0)
+		secretUUID, err := libvirtSecret.GetUUIDString()
+		if err != nil {
+			// This error really shouldn't occur. The UUID should be known
+			// locally by the libvirt client. If this fails, we make a best
+			// effort attempt at removing the secret from libvirt.
+			libvirtSecret.Undefine()
+			libvirtSecret.Free()
+			return err
+		}
+		l.secretCache[domName] = append(l.secretCache[domName], secretUUID)
+	} else {
+		libvirtSecret, err = l.redefineChangedSecret(libvirtSecret, domName, secretValue)
 		if err != nil {
-			logging.DefaultLogger().Error().Reason(err).Msg("Setting secret value for the VM failed.")
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Updating the libvirt secret failed.")
 			return err
 		}
+		if libvirtSecret == nil {
+			// The value did not change, don't bother libvirt
+			return nil
+		}
+	}
+	defer libvirtSecret.Free()
 
-	default:
-		return goerrors.New(fmt.Sprintf("unsupported disk auth usage type %s", usageType))
+	err = libvirtSecret.SetValue([]byte(secretValue), 0)
+	if err != nil {
+		logging.DefaultLogger().Error().Reason(err).Msg("Setting secret value for the VM failed.")
+		return err
 	}
 	return nil
 }
 
 func (l *LibvirtDomainManager) SyncVM(vm *v1.VirtualMachine) (*api.DomainSpec, error) {
+	if l.IsAdopted(vm) {
+		return nil, fmt.Errorf("domain %s was adopted and is read-only", cache.VMNamespaceKeyFunc(vm))
+	}
+	var spec *api.DomainSpec
+	err := l.runOnDomain(vm, func() (err error) {
+		spec, err = l.syncVM(vm)
+		return
+	})
+	return spec, err
+}
+
+func (l *LibvirtDomainManager) syncVM(vm *v1.VirtualMachine) (*api.DomainSpec, error) {
 	var wantedSpec api.DomainSpec
 	wantedSpec.XmlNS = "http://libvirt.org/schemas/domain/qemu/1.0"
 	wantedSpec.Type = "qemu"
@@ -198,16 +296,24 @@ func (l *LibvirtDomainManager) SyncVM(vm *v1.VirtualMachine) (*api.DomainSpec, e
 		},
 	}
 
+	// The domain keeps its UUID on renames, we must not define a second one
+	// while it still runs under its old name
+	if spec, postponed, err := l.finishPostponedRename(vm, TriggerVMController); err != nil || postponed {
+		return spec, err
+	}
+
 	domName := cache.VMNamespaceKeyFunc(vm)
 	wantedSpec.Name = domName
 	wantedSpec.UUID = string(vm.GetObjectMeta().GetUID())
+	wantedSpec.Title = domainTitle(vm)
+	wantedSpec.Description = domainDescription(vm)
 	dom, err := l.virConn.LookupDomainByName(domName)
 	newDomain := false
 	if err != nil {
 		// We need the domain but it does not exist, so create it
 		if domainerrors.IsNotFound(err) {
 			newDomain = true
-			dom, err = l.setDomainXML(vm, wantedSpec)
+			dom, err = l.setDomainXML(vm, wantedSpec, nil)
 			if err != nil {
 				return nil, err
 			}
@@ -219,7 +325,7 @@ func (l *LibvirtDomainManager) SyncVM(vm *v1.VirtualMachine) (*api.DomainSpec, e
 		}
 	}
 	defer dom.Free()
-	domState, _, err := dom.GetState()
+	domState, reason, err := dom.GetState()
 	if err != nil {
 		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain state failed.")
 		return nil, err
@@ -228,26 +334,56 @@ func (l *LibvirtDomainManager) SyncVM(vm *v1.VirtualMachine) (*api.DomainSpec, e
 	// To make sure, that we set the right qemu wrapper arguments,
 	// we update the domain XML whenever a VM was already defined but not running
 	if !newDomain && cli.IsDown(domState) {
-		dom, err = l.setDomainXML(vm, wantedSpec)
+		dom, err = l.setDomainXML(vm, wantedSpec, dom)
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	waitsForSecret, err := waitsForLaunchSecret(dom, domState)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Reading the domain metadata failed.")
+		return nil, err
+	}
+
 	// TODO Suspend, Pause, ..., for now we only support reaching the running state
 	// TODO for migration and error detection we also need the state change reason
 	// TODO blocked state
+	started := false
 	if cli.IsDown(domState) {
-		err := dom.Create()
+		// The guest owner has to verify the launch measurement of SEV
+		// guests before they run, see InjectLaunchSecret. The domain is
+		// marked first, so that it is never resumed without the secret.
+		var err error
+		if awaitsLaunchSecret(vm) {
+			if err := l.setAwaitsLaunchSecret(vm, dom, true, TriggerVMController); err != nil {
+				return nil, err
+			}
+			err = dom.CreateWithFlags(libvirt.DOMAIN_START_PAUSED)
+		} else {
+			err = dom.Create()
+		}
+		l.audit(vm, TriggerVMController, "create", nil, err)
+		l.domainSpecs.invalidate(domName)
 		if err != nil {
 			logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Starting the VM failed.")
 			return nil, err
 		}
 		logging.DefaultLogger().Object(vm).Info().Msg("Domain started.")
 		l.recorder.Event(vm, kubev1.EventTypeNormal, v1.Started.String(), "VM started.")
+		started = true
+	} else if waitsForSecret {
+		// Started paused, the guest owner resumes it with the launch secret
+		logging.DefaultLogger().Object(vm).Info().V(3).Msg("Domain waits for its launch secret.")
 	} else if cli.IsPaused(domState) {
+		// The guest memory is split between both hosts, resuming would corrupt the guest
+		if libvirt.DomainPausedReason(reason) == libvirt.DOMAIN_PAUSED_POSTCOPY_FAILED {
+			return nil, goerrors.New("the domain can't be resumed after a failed post-copy migration")
+		}
 		// TODO: if state change reason indicates a system error, we could try something smarter
 		err := dom.Resume()
+		l.audit(vm, TriggerVMController, "resume", nil, err)
+		l.domainSpecs.invalidate(domName)
 		if err != nil {
 			logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Resuming the VM failed.")
 			return nil, err
@@ -255,26 +391,55 @@ func (l *LibvirtDomainManager) SyncVM(vm *v1.VirtualMachine) (*api.DomainSpec, e
 		logging.DefaultLogger().Object(vm).Info().Msg("Domain resumed.")
 		l.recorder.Event(vm, kubev1.EventTypeNormal, v1.Resumed.String(), "VM resumed")
 	} else {
-		// Nothing to do
+		if err := l.reportPendingChanges(vm, dom, &wantedSpec); err != nil {
+			return nil, err
+		}
+		resized, err := l.syncDiskCapacities(vm, dom, &wantedSpec)
+		if err != nil {
+			return nil, err
+		}
+		ioTuned, err := l.syncBlockIoTune(vm, dom, &wantedSpec)
+		if err != nil {
+			return nil, err
+		}
+		bandwidthChanged, err := l.syncInterfaceBandwidth(vm, dom, &wantedSpec)
+		if err != nil {
+			return nil, err
+		}
+		perfChanged, err := l.syncPerfEvents(vm, dom)
+		if err != nil {
+			return nil, err
+		}
+		titleChanged, err := l.syncTitle(vm, dom, &wantedSpec)
+		if err != nil {
+			return nil, err
+		}
+		if resized || ioTuned || bandwidthChanged || perfChanged || titleChanged {
+			l.domainSpecs.invalidate(domName)
+		}
 	}
 
-	xmlstr, err := dom.GetXMLDesc(0)
+	newSpec, err := l.getDomainSpec(domName, dom)
 	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain spec failed.")
 		return nil, err
 	}
 
-	var newSpec api.DomainSpec
-	err = xml.Unmarshal([]byte(xmlstr), &newSpec)
-	if err != nil {
-		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Parsing domain XML failed.")
-		return nil, err
+	// Threads can only be pinned once qemu runs
+	if started && hasDedicatedCPUs(vm) {
+		if err := l.pinDedicatedCPUs(vm, dom, res.Slice(), newSpec); err != nil {
+			return nil, err
+		}
 	}
 
 	// TODO: check if VM Spec and Domain Spec are equal or if we have to sync
-	return &newSpec, nil
+	return newSpec, nil
 }
 
 func (l *LibvirtDomainManager) RemoveVMSecrets(vm *v1.VirtualMachine) error {
+	l.cacheLock.Lock()
+	defer l.cacheLock.Unlock()
+
 	domName := cache.VMNamespaceKeyFunc(vm)
 
 	secretUUIDs, ok := l.secretCache[domName]
@@ -285,7 +450,7 @@ func (l *LibvirtDomainManager) RemoveVMSecrets(vm *v1.VirtualMachine) error {
 	for _, secretUUID := range secretUUIDs {
 		secret, err := l.virConn.LookupSecretByUUIDString(secretUUID)
 		if err != nil {
-			if err.(libvirt.Error).Code != libvirt.ERR_NO_SECRET {
+			if !domainerrors.IsSecretNotFound(err) {
 				logging.DefaultLogger().Object(vm).Error().Reason(err).Msg(fmt.Sprintf("Failed to lookup secret with UUID %s.", secretUUID))
 				return err
 			}
@@ -304,12 +469,52 @@ func (l *LibvirtDomainManager) RemoveVMSecrets(vm *v1.VirtualMachine) error {
 }
 
 func (l *LibvirtDomainManager) KillVM(vm *v1.VirtualMachine) error {
+	// Adopted domains never had a VM, their absence is no reason to kill them
+	if l.IsAdopted(vm) {
+		logging.DefaultLogger().Object(vm).Info().V(3).Msg("Leaving the adopted domain alone.")
+		return nil
+	}
+	return l.runOnDomain(vm, func() error {
+		return l.killVM(vm, TriggerVMController)
+	})
+}
+
+// RemoveVMData removes what belongs to the VM and outlives its domain, like
+// the NVRAM of UEFI guests and the state of persistent TPMs. It must only be called once the VM is deleted on
+// the cluster, KillVM is also called for VMs which just left the host.
+func (l *LibvirtDomainManager) RemoveVMData(vm *v1.VirtualMachine) error {
+	if err := removeNVRAM(vm); err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Removing the NVRAM failed.")
+		return err
+	}
+	if err := removeSavedTPMState(vm); err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Removing the TPM state failed.")
+		return err
+	}
+	if err := removeCoreDumps(vm); err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Removing the core dumps failed.")
+		return err
+	}
+	return nil
+}
+
+func (l *LibvirtDomainManager) killVM(vm *v1.VirtualMachine, trigger Trigger) error {
 	domName := cache.VMNamespaceKeyFunc(vm)
 	dom, err := l.virConn.LookupDomainByName(domName)
 	if err != nil {
-		// If the VM does not exist, we are done
+		// If the VM does not exist, we only have to give back its host
+		// devices and MACs and remove what may be left of its overlays and
+		// serial port sockets
 		if domainerrors.IsNotFound(err) {
-			return nil
+			if err := removeOverlays(vm); err != nil {
+				logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Removing the disk overlays failed.")
+				return err
+			}
+			if err := removeSerialSockets(vm); err != nil {
+				logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Removing the serial port sockets failed.")
+				return err
+			}
+			return l.releaseHostDevices(vm)
 		} else {
 			logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain failed.")
 			return err
@@ -323,8 +528,11 @@ func (l *LibvirtDomainManager) KillVM(vm *v1.VirtualMachine) error {
 		return err
 	}
 
-	if domState == libvirt.DOMAIN_RUNNING || domState == libvirt.DOMAIN_PAUSED {
+	// Crashed guests are kept alive for core dumps
+	started := domState == libvirt.DOMAIN_RUNNING || domState == libvirt.DOMAIN_PAUSED || domState == libvirt.DOMAIN_CRASHED
+	if started {
 		err = dom.Destroy()
+		l.audit(vm, trigger, "destroy", nil, err)
 		if err != nil {
 			logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Destroying the domain state failed.")
 			return err
@@ -333,27 +541,216 @@ func (l *LibvirtDomainManager) KillVM(vm *v1.VirtualMachine) error {
 		l.recorder.Event(vm, kubev1.EventTypeNormal, v1.Stopped.String(), "VM stopped")
 	}
 
-	err = dom.Undefine()
+	if err := saveTPMState(vm, started); err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Saving the TPM state failed.")
+		return err
+	}
+
+	// Keep the NVRAM of UEFI guests, it is only removed with the VM
+	err = dom.UndefineFlags(libvirt.DOMAIN_UNDEFINE_KEEP_NVRAM)
+	l.audit(vm, trigger, "undefine", nil, err)
+	l.domainSpecs.invalidate(domName)
 	if err != nil {
 		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Undefining the domain state failed.")
 		return err
 	}
 	logging.DefaultLogger().Object(vm).Info().Msg("Domain undefined.")
 	l.recorder.Event(vm, kubev1.EventTypeNormal, v1.Deleted.String(), "VM undefined")
-	return nil
+
+	if err := removeTPMState(vm); err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Removing the TPM state failed.")
+		return err
+	}
+	if err := removeOverlays(vm); err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Removing the disk overlays failed.")
+		return err
+	}
+	if err := removeSerialSockets(vm); err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Removing the serial port sockets failed.")
+		return err
+	}
+	return l.releaseHostDevices(vm)
 }
 
-func (l *LibvirtDomainManager) setDomainXML(vm *v1.VirtualMachine, wantedSpec api.DomainSpec) (cli.VirDomain, error) {
+// setDomainXML defines the domain. The currently defined domain is nil if
+// there is none.
+func (l *LibvirtDomainManager) setDomainXML(vm *v1.VirtualMachine, wantedSpec api.DomainSpec, current cli.VirDomain) (cli.VirDomain, error) {
+	// Copied before the defaults are filled in, which share the devices
+	userSpec, err := userDomainSpec(&wantedSpec)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Copying the domain spec failed.")
+		return nil, err
+	}
+	applyDomainProfiles(&wantedSpec)
+	if err := l.prepareArchitecture(vm, &wantedSpec); err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Validating the guest architecture failed.")
+		return nil, err
+	}
+	if wantedSpec.MemoryBacking != nil && wantedSpec.MemoryBacking.HugePages != nil {
+		caps, err := l.getCapabilities()
+		if err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the host capabilities failed.")
+			return nil, err
+		}
+		free, err := l.freeHugePages(caps)
+		if err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the free hugepages failed.")
+			return nil, err
+		}
+		if err := validateHugePages(&wantedSpec, caps, free); err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Validating hugepages failed.")
+			return nil, err
+		}
+	}
+	if err := prepareMACs(vm, &wantedSpec); err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Assigning the MAC addresses failed.")
+		return nil, err
+	}
+	if err := prepareVhostUserInterfaces(&wantedSpec); err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Validating the vhostuser interfaces failed.")
+		return nil, err
+	}
+	if err := prepareQueues(vm, &wantedSpec); err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Configuring the device queues failed.")
+		return nil, err
+	}
+	if err := prepareDiscard(&wantedSpec); err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Validating the disk discard modes failed.")
+		return nil, err
+	}
+	if err := prepareIOThreads(vm, &wantedSpec); err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Assigning the IOThreads failed.")
+		return nil, err
+	}
+	if err := l.validateNetworkFilters(vm, &wantedSpec); err != nil {
+		return nil, err
+	}
+	if err := l.prepareHostDevices(vm, &wantedSpec); err != nil {
+		return nil, err
+	}
+	previous, err := previousMetadata(current)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Reading the domain metadata failed.")
+		return nil, err
+	}
+	previousDevices, err := allocatedDevices(vm)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Reading the device addresses of the VM failed.")
+		return nil, err
+	}
+	// Domains defined before the allocations were stored on the VM
+	if previousDevices == nil {
+		previousDevices = previous.Devices
+	}
+	deviceAllocations, err := prepareDeviceAddresses(&wantedSpec, previousDevices)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Assigning the device addresses failed.")
+		return nil, err
+	}
+	if err := prepareSysInfo(vm, &wantedSpec); err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Configuring the SMBIOS entries failed.")
+		return nil, err
+	}
+	prepareKernelBoot(vm, &wantedSpec)
+	if err := prepareNetworkBoot(&wantedSpec); err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Validating the interface ROMs failed.")
+		return nil, err
+	}
+	if err := prepareBootOrder(&wantedSpec); err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Validating the boot order failed.")
+		return nil, err
+	}
+	if err := prepareFirmware(vm, &wantedSpec); err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Configuring the firmware failed.")
+		return nil, err
+	}
+	if err := prepareClock(&wantedSpec); err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Validating the clock failed.")
+		return nil, err
+	}
+	if err := l.prepareHyperv(&wantedSpec); err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Configuring the Hyper-V enlightenments failed.")
+		return nil, err
+	}
+	if err := l.prepareLaunchSecurity(vm, &wantedSpec); err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Configuring the launch security failed.")
+		return nil, err
+	}
+	if err := prepareOverlays(vm, &wantedSpec); err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Creating the disk overlays failed.")
+		return nil, err
+	}
+	if err := prepareSerialSockets(vm, &wantedSpec); err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Preparing the serial port sockets failed.")
+		return nil, err
+	}
+	if err := prepareDesktopDevices(&wantedSpec); err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Validating the desktop devices failed.")
+		return nil, err
+	}
+	if err := prepareRandomGenerator(&wantedSpec); err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Validating the rng device failed.")
+		return nil, err
+	}
+	prepareGuestAgentChannel(&wantedSpec)
+	if wantedSpec.Devices.TPM != nil {
+		if err := l.requireFeature(cli.FeatureTPMEmulator); err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("The TPM is not supported.")
+			return nil, err
+		}
+	}
+	if err := l.prepareTPMEncryption(vm, &wantedSpec); err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Looking up the TPM encryption secret failed.")
+		return nil, err
+	}
+	if err := restoreTPMState(vm); err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Restoring the TPM state failed.")
+		return nil, err
+	}
+	if err := prepareQEMUArgs(vm, &wantedSpec); err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Validating the qemu arguments failed.")
+		return nil, err
+	}
+	prepareCoreDump(vm, &wantedSpec)
+	if err := preparePerfEvents(vm, &wantedSpec); err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Validating the perf events failed.")
+		return nil, err
+	}
 	xmlStr, err := xml.Marshal(&wantedSpec)
 	if err != nil {
 		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Generating the domain XML failed.")
 		return nil, err
 	}
+	xmlStr, err = runDomainHooks(vm, xmlStr)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Running the domain hooks failed.")
+		return nil, err
+	}
 	logging.DefaultLogger().Object(vm).Info().V(3).With("xml", xmlStr).Msgf("Domain XML generated.")
-	dom, err := l.virConn.DomainDefineXML(string(xmlStr))
+	// libvirt validates the XML against its schema before it defines the
+	// domain, so that invalid specs fail here and not when the VM starts
+	dom, err := l.virConn.DomainDefineXMLFlags(string(xmlStr), libvirt.DOMAIN_DEFINE_VALIDATE)
+	l.audit(vm, TriggerVMController, "define", xmlStr, err)
+	l.domainSpecs.invalidate(cache.VMNamespaceKeyFunc(vm))
 	if err != nil {
 		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Defining the VM failed.")
 		return nil, err
 	}
+	metadata := newKubeVirtMetadata(vm)
+	metadata.Spec = userSpec
+	metadata.Devices = deviceAllocations
+	metadata.CrashRestarts = previous.CrashRestarts
+	err = SetMetadata(dom, metadata)
+	l.audit(vm, TriggerVMController, "set-metadata", metadata, err)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Storing the domain metadata failed.")
+		dom.Free()
+		return nil, err
+	}
+	if err := l.disableAutostart(vm, dom, TriggerVMController); err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Disabling autostart of the domain failed.")
+		dom.Free()
+		return nil, err
+	}
 	return dom, nil
 }
@@ -22,10 +22,12 @@ package virtwrap
 import (
 	"encoding/xml"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 
 	"github.com/golang/mock/gomock"
 	"github.com/jeevatkm/go-model"
-	"github.com/libvirt/libvirt-go"
 	. "github.com/onsi/ginkgo"
 	"github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
@@ -37,6 +39,7 @@ import (
 	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
 	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
 	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/isolation"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
 )
 
 var _ = Describe("Manager", func() {
@@ -45,6 +48,8 @@ var _ = Describe("Manager", func() {
 	var ctrl *gomock.Controller
 	var recorder *record.FakeRecorder
 	var mockDetector *isolation.MockPodIsolationDetector
+	var tmpDir string
+	var originalSecretKeyFile string
 	testVmName := "testvm"
 	testNamespace := "testnamespace"
 	testDomainName := fmt.Sprintf("%s_%s", testNamespace, testVmName)
@@ -52,6 +57,12 @@ var _ = Describe("Manager", func() {
 	logging.DefaultLogger().SetIOWriter(GinkgoWriter)
 
 	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "manager")
+		Expect(err).ToNot(HaveOccurred())
+		originalSecretKeyFile = secretKeyFile
+		secretKeyFile = filepath.Join(tmpDir, "secret-description.key")
+
 		ctrl = gomock.NewController(GinkgoT())
 		mockConn = cli.NewMockConnection(ctrl)
 		mockDomain = cli.NewMockVirDomain(ctrl)
@@ -59,6 +70,11 @@ var _ = Describe("Manager", func() {
 		mockDetector = isolation.NewMockPodIsolationDetector(ctrl)
 		// Make sure that we always free the domain after use
 		mockDomain.EXPECT().Free()
+		mockConn.EXPECT().DomainEventLifecycleRegister(gomock.Any()).AnyTimes().Return(nil)
+		mockConn.EXPECT().DomainEventDeviceAddedRegister(gomock.Any()).AnyTimes().Return(nil)
+		mockConn.EXPECT().DomainEventDeviceRemovedRegister(gomock.Any()).AnyTimes().Return(nil)
+		mockConn.EXPECT().DomainEventRTCChangeRegister(gomock.Any()).AnyTimes().Return(nil)
+		mockConn.EXPECT().DomainEventAgentLifecycleRegister(gomock.Any()).AnyTimes().Return(nil)
 	})
 
 	expectIsolationDetectionForVM := func(vm *v1.VirtualMachine) *api.DomainSpec {
@@ -66,6 +82,14 @@ var _ = Describe("Manager", func() {
 		Expect(model.Copy(&domainSpec, vm.Spec.Domain)).To(BeEmpty())
 
 		domainSpec.Name = testDomainName
+		domainSpec.Title = testNamespace + "/" + testVmName
+		Expect(AllocateMACs(vm, map[string]string{})).To(Succeed())
+		domainSpec.Devices.Interfaces[0].MAC = &api.MAC{MAC: generateMAC(testNamespace, testVmName, 0, 0)}
+		domainSpec.OS.Type.Arch = hostArch
+		domainSpec.Devices.Channels = append(domainSpec.Devices.Channels, newGuestAgentChannel())
+		if allocatesPCIAddresses(&domainSpec) {
+			domainSpec.Devices.Interfaces[0].Address = pciSlotAddress(firstAllocatableSlot)
+		}
 		domainSpec.XmlNS = "http://libvirt.org/schemas/domain/qemu/1.0"
 		domainSpec.QEMUCmd = &api.Commandline{
 			QEMUEnv: []api.Env{
@@ -89,7 +113,9 @@ var _ = Describe("Manager", func() {
 			xml, err := xml.Marshal(domainSpec)
 			Expect(err).To(BeNil())
 			mockConn.EXPECT().ListSecrets().Return(make([]string, 0, 0), nil)
-			mockConn.EXPECT().DomainDefineXML(string(xml)).Return(mockDomain, nil)
+			mockConn.EXPECT().DomainDefineXMLFlags(string(xml), libvirt.DOMAIN_DEFINE_VALIDATE).Return(mockDomain, nil)
+			mockDomain.EXPECT().SetMetadata(gomock.Any(), libvirt.DOMAIN_METADATA_ELEMENT, api.KubeVirtMetadataPrefix, api.KubeVirtMetadataURI, libvirt.DOMAIN_AFFECT_CONFIG).Return(nil)
+			mockDomain.EXPECT().GetAutostart().Return(false, nil)
 			mockDomain.EXPECT().GetState().Return(libvirt.DOMAIN_SHUTDOWN, 1, nil)
 			mockDomain.EXPECT().Create().Return(nil)
 			mockDomain.EXPECT().GetXMLDesc(libvirt.DomainXMLFlags(0)).Return(string(xml), nil)
@@ -101,6 +127,39 @@ var _ = Describe("Manager", func() {
 			Expect(<-recorder.Events).To(ContainSubstring(v1.Started.String()))
 			Expect(recorder.Events).To(BeEmpty())
 		})
+		It("should pin the vCPUs of VMs with dedicated CPUs once started", func() {
+			originalCgroupRoot := cgroupRoot
+			defer func() { cgroupRoot = originalCgroupRoot }()
+			cgroupRoot = tmpDir
+			Expect(os.MkdirAll(filepath.Join(tmpDir, "cpuset", "dfd"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(tmpDir, "cpuset", "dfd", "cpuset.cpus"), []byte("2-4\n"), 0644)).To(Succeed())
+
+			vm := newVM(testNamespace, testVmName)
+			vm.Spec.Domain.VCPU = &v1.VCPU{CPUs: 2, DedicatedCPUPlacement: true}
+			mockConn.EXPECT().LookupDomainByName(testDomainName).Return(mockDomain, libvirt.Error{Code: libvirt.ERR_NO_DOMAIN})
+
+			domainSpec := expectIsolationDetectionForVM(vm)
+			domainSpec.IOThreads = &api.IOThreads{Count: 1}
+			xml, err := xml.Marshal(domainSpec)
+			Expect(err).To(BeNil())
+			mockConn.EXPECT().ListSecrets().Return(make([]string, 0, 0), nil)
+			mockConn.EXPECT().DomainDefineXMLFlags(gomock.Any(), libvirt.DOMAIN_DEFINE_VALIDATE).Return(mockDomain, nil)
+			mockDomain.EXPECT().SetMetadata(gomock.Any(), libvirt.DOMAIN_METADATA_ELEMENT, api.KubeVirtMetadataPrefix, api.KubeVirtMetadataURI, libvirt.DOMAIN_AFFECT_CONFIG).Return(nil)
+			mockDomain.EXPECT().GetAutostart().Return(false, nil)
+			mockDomain.EXPECT().GetState().Return(libvirt.DOMAIN_SHUTDOWN, 1, nil)
+			mockDomain.EXPECT().Create().Return(nil)
+			mockDomain.EXPECT().GetXMLDesc(libvirt.DomainXMLFlags(0)).Return(string(xml), nil)
+			gomock.InOrder(
+				mockDomain.EXPECT().PinVcpuFlags(uint(0), []bool{false, false, true}, libvirt.DOMAIN_AFFECT_LIVE).Return(nil),
+				mockDomain.EXPECT().PinVcpuFlags(uint(1), []bool{false, false, false, true}, libvirt.DOMAIN_AFFECT_LIVE).Return(nil),
+				mockDomain.EXPECT().PinEmulator([]bool{false, false, false, false, true}, libvirt.DOMAIN_AFFECT_LIVE).Return(nil),
+				mockDomain.EXPECT().PinIOThread(uint(1), []bool{false, false, false, false, true}, libvirt.DOMAIN_AFFECT_LIVE).Return(nil),
+			)
+			manager, _ := NewLibvirtDomainManager(mockConn, recorder, mockDetector)
+			newspec, err := manager.SyncVM(vm)
+			Expect(newspec).ToNot(BeNil())
+			Expect(err).To(BeNil())
+		})
 		It("should leave a defined and started VM alone", func() {
 			vm := newVM(testNamespace, testVmName)
 			domainSpec := expectIsolationDetectionForVM(vm)
@@ -109,6 +168,10 @@ var _ = Describe("Manager", func() {
 			mockConn.EXPECT().ListSecrets().Return(make([]string, 0, 0), nil)
 			mockConn.EXPECT().LookupDomainByName(testDomainName).Return(mockDomain, nil)
 			mockDomain.EXPECT().GetState().Return(libvirt.DOMAIN_RUNNING, 1, nil)
+			mockDomain.EXPECT().GetMetadata(libvirt.DOMAIN_METADATA_ELEMENT, api.KubeVirtMetadataURI, libvirt.DOMAIN_AFFECT_CONFIG).Return("", libvirt.Error{Code: libvirt.ERR_NO_DOMAIN_METADATA})
+			mockDomain.EXPECT().GetPerfEvents(libvirt.DOMAIN_AFFECT_LIVE).Return(&libvirt.DomainPerfEvents{}, nil)
+			mockDomain.EXPECT().GetMetadata(libvirt.DOMAIN_METADATA_TITLE, "", libvirt.DOMAIN_AFFECT_LIVE).Return(testNamespace+"/"+testVmName, nil)
+			mockDomain.EXPECT().GetMetadata(libvirt.DOMAIN_METADATA_DESCRIPTION, "", libvirt.DOMAIN_AFFECT_LIVE).Return("", libvirt.Error{Code: libvirt.ERR_NO_DOMAIN_METADATA})
 			mockDomain.EXPECT().GetXMLDesc(libvirt.DomainXMLFlags(0)).Return(string(xml), nil)
 			manager, _ := NewLibvirtDomainManager(mockConn, recorder, mockDetector)
 			newspec, err := manager.SyncVM(vm)
@@ -116,6 +179,33 @@ var _ = Describe("Manager", func() {
 			Expect(err).To(BeNil())
 			Expect(recorder.Events).To(BeEmpty())
 		})
+		It("should report changes of a started VM which need a restart", func() {
+			vm := newVM(testNamespace, testVmName)
+			definedSpec := &api.DomainSpec{}
+			Expect(model.Copy(definedSpec, vm.Spec.Domain)).To(BeEmpty())
+			definedSpec.Name = testDomainName
+			definedSpec.Title = testNamespace + "/" + testVmName
+			definedSpec.Memory.Value = 4096
+			metadata, err := xml.Marshal(&api.KubeVirtMetadata{Spec: definedSpec})
+			Expect(err).ToNot(HaveOccurred())
+
+			domainSpec := expectIsolationDetectionForVM(vm)
+			xml, err := xml.Marshal(domainSpec)
+
+			mockConn.EXPECT().ListSecrets().Return(make([]string, 0, 0), nil)
+			mockConn.EXPECT().LookupDomainByName(testDomainName).Return(mockDomain, nil)
+			mockDomain.EXPECT().GetState().Return(libvirt.DOMAIN_RUNNING, 1, nil)
+			mockDomain.EXPECT().GetMetadata(libvirt.DOMAIN_METADATA_ELEMENT, api.KubeVirtMetadataURI, libvirt.DOMAIN_AFFECT_CONFIG).Return(string(metadata), nil)
+			mockDomain.EXPECT().GetPerfEvents(libvirt.DOMAIN_AFFECT_LIVE).Return(&libvirt.DomainPerfEvents{}, nil)
+			mockDomain.EXPECT().GetMetadata(libvirt.DOMAIN_METADATA_TITLE, "", libvirt.DOMAIN_AFFECT_LIVE).Return(testNamespace+"/"+testVmName, nil)
+			mockDomain.EXPECT().GetMetadata(libvirt.DOMAIN_METADATA_DESCRIPTION, "", libvirt.DOMAIN_AFFECT_LIVE).Return("", libvirt.Error{Code: libvirt.ERR_NO_DOMAIN_METADATA})
+			mockDomain.EXPECT().GetXMLDesc(libvirt.DomainXMLFlags(0)).Return(string(xml), nil)
+			manager, _ := NewLibvirtDomainManager(mockConn, recorder, mockDetector)
+			_, err = manager.SyncVM(vm)
+			Expect(err).To(BeNil())
+			Expect(<-recorder.Events).To(ContainSubstring(v1.RestartRequired.String()))
+			Expect(recorder.Events).To(BeEmpty())
+		})
 		table.DescribeTable("should try to start a VM in state",
 			func(state libvirt.DomainState) {
 				vm := newVM(testNamespace, testVmName)
@@ -125,7 +215,10 @@ var _ = Describe("Manager", func() {
 				mockConn.EXPECT().ListSecrets().Return(make([]string, 0, 0), nil)
 				mockConn.EXPECT().LookupDomainByName(testDomainName).Return(mockDomain, nil)
 				mockDomain.EXPECT().GetState().Return(state, 1, nil)
-				mockConn.EXPECT().DomainDefineXML(string(xml)).Return(mockDomain, nil)
+				mockDomain.EXPECT().GetMetadata(libvirt.DOMAIN_METADATA_ELEMENT, api.KubeVirtMetadataURI, libvirt.DOMAIN_AFFECT_CONFIG).Return("", libvirt.Error{Code: libvirt.ERR_NO_DOMAIN_METADATA})
+				mockConn.EXPECT().DomainDefineXMLFlags(string(xml), libvirt.DOMAIN_DEFINE_VALIDATE).Return(mockDomain, nil)
+				mockDomain.EXPECT().SetMetadata(gomock.Any(), libvirt.DOMAIN_METADATA_ELEMENT, api.KubeVirtMetadataPrefix, api.KubeVirtMetadataURI, libvirt.DOMAIN_AFFECT_CONFIG).Return(nil)
+				mockDomain.EXPECT().GetAutostart().Return(false, nil)
 				mockDomain.EXPECT().Create().Return(nil)
 				mockDomain.EXPECT().GetXMLDesc(libvirt.DomainXMLFlags(0)).Return(string(xml), nil)
 				manager, _ := NewLibvirtDomainManager(mockConn, recorder, mockDetector)
@@ -148,6 +241,7 @@ var _ = Describe("Manager", func() {
 			mockConn.EXPECT().ListSecrets().Return(make([]string, 0, 0), nil)
 			mockConn.EXPECT().LookupDomainByName(testDomainName).Return(mockDomain, nil)
 			mockDomain.EXPECT().GetState().Return(libvirt.DOMAIN_PAUSED, 1, nil)
+			mockDomain.EXPECT().GetMetadata(libvirt.DOMAIN_METADATA_ELEMENT, api.KubeVirtMetadataURI, libvirt.DOMAIN_AFFECT_CONFIG).Return("", libvirt.Error{Code: libvirt.ERR_NO_DOMAIN_METADATA})
 			mockDomain.EXPECT().Resume().Return(nil)
 			mockDomain.EXPECT().GetXMLDesc(libvirt.DomainXMLFlags(0)).Return(string(xml), nil)
 			manager, _ := NewLibvirtDomainManager(mockConn, recorder, mockDetector)
@@ -157,6 +251,67 @@ var _ = Describe("Manager", func() {
 			Expect(<-recorder.Events).To(ContainSubstring(v1.Resumed.String()))
 			Expect(recorder.Events).To(BeEmpty())
 		})
+		It("should not resume a SEV guest which waits for its launch secret", func() {
+			vm := newVM(testNamespace, testVmName)
+			vm.Spec.Domain.SEV = &v1.SEV{DHCert: "cert", Session: "session"}
+			domainSpec := expectIsolationDetectionForVM(vm)
+			xml, err := xml.Marshal(domainSpec)
+
+			mockConn.EXPECT().ListSecrets().Return(make([]string, 0, 0), nil)
+			mockConn.EXPECT().LookupDomainByName(testDomainName).Return(mockDomain, nil)
+			mockDomain.EXPECT().GetState().Return(libvirt.DOMAIN_PAUSED, int(libvirt.DOMAIN_PAUSED_USER), nil)
+			mockDomain.EXPECT().GetMetadata(libvirt.DOMAIN_METADATA_ELEMENT, api.KubeVirtMetadataURI, libvirt.DOMAIN_AFFECT_CONFIG).Return("<kubevirt><awaitsLaunchSecret>true</awaitsLaunchSecret></kubevirt>", nil)
+			mockDomain.EXPECT().GetXMLDesc(libvirt.DomainXMLFlags(0)).Return(string(xml), nil)
+			manager, _ := NewLibvirtDomainManager(mockConn, recorder, mockDetector)
+			newspec, err := manager.SyncVM(vm)
+			Expect(newspec).ToNot(BeNil())
+			Expect(err).To(BeNil())
+			Expect(recorder.Events).To(BeEmpty())
+		})
+		It("should not resume a VM after a failed post-copy migration", func() {
+			vm := newVM(testNamespace, testVmName)
+			expectIsolationDetectionForVM(vm)
+
+			mockConn.EXPECT().ListSecrets().Return(make([]string, 0, 0), nil)
+			mockConn.EXPECT().LookupDomainByName(testDomainName).Return(mockDomain, nil)
+			mockDomain.EXPECT().GetState().Return(libvirt.DOMAIN_PAUSED, int(libvirt.DOMAIN_PAUSED_POSTCOPY_FAILED), nil)
+			mockDomain.EXPECT().GetMetadata(libvirt.DOMAIN_METADATA_ELEMENT, api.KubeVirtMetadataURI, libvirt.DOMAIN_AFFECT_CONFIG).Return("", libvirt.Error{Code: libvirt.ERR_NO_DOMAIN_METADATA})
+			manager, _ := NewLibvirtDomainManager(mockConn, recorder, mockDetector)
+			_, err := manager.SyncVM(vm)
+			Expect(err).To(HaveOccurred())
+			Expect(recorder.Events).To(BeEmpty())
+		})
+	})
+	Context("on failed VM sync", func() {
+		It("should free the defined domain if storing the metadata fails", func() {
+			vm := newVM(testNamespace, testVmName)
+			mockConn.EXPECT().LookupDomainByName(testDomainName).Return(nil, libvirt.Error{Code: libvirt.ERR_NO_DOMAIN})
+
+			domainSpec := expectIsolationDetectionForVM(vm)
+			xml, err := xml.Marshal(domainSpec)
+			Expect(err).To(BeNil())
+			mockConn.EXPECT().ListSecrets().Return(make([]string, 0, 0), nil)
+			mockConn.EXPECT().DomainDefineXMLFlags(string(xml), libvirt.DOMAIN_DEFINE_VALIDATE).Return(mockDomain, nil)
+			mockDomain.EXPECT().SetMetadata(gomock.Any(), libvirt.DOMAIN_METADATA_ELEMENT, api.KubeVirtMetadataPrefix, api.KubeVirtMetadataURI, libvirt.DOMAIN_AFFECT_CONFIG).Return(libvirt.Error{Code: libvirt.ERR_INTERNAL_ERROR})
+			manager, _ := NewLibvirtDomainManager(mockConn, recorder, mockDetector)
+			_, err = manager.SyncVM(vm)
+			Expect(err).To(HaveOccurred())
+		})
+		It("should free the defined domain if disabling autostart fails", func() {
+			vm := newVM(testNamespace, testVmName)
+			mockConn.EXPECT().LookupDomainByName(testDomainName).Return(nil, libvirt.Error{Code: libvirt.ERR_NO_DOMAIN})
+
+			domainSpec := expectIsolationDetectionForVM(vm)
+			xml, err := xml.Marshal(domainSpec)
+			Expect(err).To(BeNil())
+			mockConn.EXPECT().ListSecrets().Return(make([]string, 0, 0), nil)
+			mockConn.EXPECT().DomainDefineXMLFlags(string(xml), libvirt.DOMAIN_DEFINE_VALIDATE).Return(mockDomain, nil)
+			mockDomain.EXPECT().SetMetadata(gomock.Any(), libvirt.DOMAIN_METADATA_ELEMENT, api.KubeVirtMetadataPrefix, api.KubeVirtMetadataURI, libvirt.DOMAIN_AFFECT_CONFIG).Return(nil)
+			mockDomain.EXPECT().GetAutostart().Return(false, libvirt.Error{Code: libvirt.ERR_INTERNAL_ERROR})
+			manager, _ := NewLibvirtDomainManager(mockConn, recorder, mockDetector)
+			_, err = manager.SyncVM(vm)
+			Expect(err).To(HaveOccurred())
+		})
 	})
 	Context("on successful VM kill", func() {
 		table.DescribeTable("should try to undefine a VM in state",
@@ -164,7 +319,7 @@ var _ = Describe("Manager", func() {
 				mockConn.EXPECT().ListSecrets().Return(make([]string, 0, 0), nil)
 				mockConn.EXPECT().LookupDomainByName(testDomainName).Return(mockDomain, nil)
 				mockDomain.EXPECT().GetState().Return(state, 1, nil)
-				mockDomain.EXPECT().Undefine().Return(nil)
+				mockDomain.EXPECT().UndefineFlags(libvirt.DOMAIN_UNDEFINE_KEEP_NVRAM).Return(nil)
 				manager, _ := NewLibvirtDomainManager(mockConn, recorder, mockDetector)
 				err := manager.KillVM(newVM(testNamespace, testVmName))
 				Expect(err).To(BeNil())
@@ -180,7 +335,7 @@ var _ = Describe("Manager", func() {
 				mockConn.EXPECT().LookupDomainByName(testDomainName).Return(mockDomain, nil)
 				mockDomain.EXPECT().GetState().Return(state, 1, nil)
 				mockDomain.EXPECT().Destroy().Return(nil)
-				mockDomain.EXPECT().Undefine().Return(nil)
+				mockDomain.EXPECT().UndefineFlags(libvirt.DOMAIN_UNDEFINE_KEEP_NVRAM).Return(nil)
 				manager, _ := NewLibvirtDomainManager(mockConn, recorder, mockDetector)
 				err := manager.KillVM(newVM(testNamespace, testVmName))
 				Expect(err).To(BeNil())
@@ -193,10 +348,30 @@ var _ = Describe("Manager", func() {
 		)
 	})
 
+	Context("on failed VM sync", func() {
+		It("should not start a VM which libvirt rejects", func() {
+			vm := newVM(testNamespace, testVmName)
+			domainSpec := expectIsolationDetectionForVM(vm)
+			xml, err := xml.Marshal(domainSpec)
+
+			mockConn.EXPECT().ListSecrets().Return(make([]string, 0, 0), nil)
+			mockConn.EXPECT().LookupDomainByName(testDomainName).Return(mockDomain, nil)
+			mockDomain.EXPECT().GetState().Return(libvirt.DOMAIN_SHUTOFF, 1, nil)
+			mockDomain.EXPECT().GetMetadata(libvirt.DOMAIN_METADATA_ELEMENT, api.KubeVirtMetadataURI, libvirt.DOMAIN_AFFECT_CONFIG).Return("", libvirt.Error{Code: libvirt.ERR_NO_DOMAIN_METADATA})
+			mockConn.EXPECT().DomainDefineXMLFlags(string(xml), libvirt.DOMAIN_DEFINE_VALIDATE).Return(nil, libvirt.Error{Code: libvirt.ERR_XML_INVALID_SCHEMA})
+			manager, _ := NewLibvirtDomainManager(mockConn, recorder, mockDetector)
+			_, err = manager.SyncVM(vm)
+			Expect(err).To(HaveOccurred())
+			Expect(recorder.Events).To(BeEmpty())
+		})
+	})
+
 	// TODO: test error reporting on non successful VM syncs and kill attempts
 
 	AfterEach(func() {
 		ctrl.Finish()
+		secretKeyFile = originalSecretKeyFile
+		os.RemoveAll(tmpDir)
 	})
 })
 
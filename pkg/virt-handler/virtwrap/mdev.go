@@ -0,0 +1,97 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/satori/go.uuid"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+)
+
+// libvirt can only list mediated devices, creating and removing them has to
+// be done through sysfs.
+var sysfsRoot = "/sys"
+
+const mdevNodeDevicePrefix = "mdev_"
+
+// CreateMediatedDevice creates a mediated device of the given type with the
+// given UUID on the parent device, e.g. a vGPU of type nvidia-35 on the GPU
+// 0000:06:00.0. It is not an error if the device already exists.
+func CreateMediatedDevice(parent string, mdevType string, mdevUUID string) error {
+	if _, err := os.Stat(filepath.Join(sysfsRoot, "bus", "mdev", "devices", mdevUUID)); err == nil {
+		return nil
+	}
+
+	typeDir := filepath.Join(sysfsRoot, "class", "mdev_bus", parent, "mdev_supported_types", mdevType)
+	if _, err := os.Stat(typeDir); err != nil {
+		return fmt.Errorf("mediated device type %s is not supported by %s: %v", mdevType, parent, err)
+	}
+	return ioutil.WriteFile(filepath.Join(typeDir, "create"), []byte(mdevUUID), 0200)
+}
+
+// RemoveMediatedDevice removes the mediated device with the given UUID. It is
+// not an error if the device does not exist anymore.
+func RemoveMediatedDevice(mdevUUID string) error {
+	devDir := filepath.Join(sysfsRoot, "bus", "mdev", "devices", mdevUUID)
+	if _, err := os.Stat(devDir); os.IsNotExist(err) {
+		return nil
+	}
+	return ioutil.WriteFile(filepath.Join(devDir, "remove"), []byte("1"), 0200)
+}
+
+// prepareMediatedDevice creates the mediated device of a host device if the
+// VM asks for a type instead of an existing device. The UUID is derived from
+// the VM and the position of the device, so that every sync of the VM finds
+// the device it created before. It returns the node device name.
+func prepareMediatedDevice(vm *v1.VirtualMachine, index int, source *api.HostDeviceSource) (string, error) {
+	if source.MdevType != "" {
+		if source.Address == nil {
+			source.Address = &api.Address{}
+		}
+		if source.Address.UUID == "" {
+			source.Address.UUID = uuid.NewV5(uuid.NamespaceOID, fmt.Sprintf("%s/mdev/%d", vm.GetObjectMeta().GetUID(), index)).String()
+		}
+		if err := CreateMediatedDevice(source.MdevParent, source.MdevType, source.Address.UUID); err != nil {
+			return "", err
+		}
+	}
+	if source.Address == nil || source.Address.UUID == "" {
+		return "", fmt.Errorf("mediated device has no source uuid")
+	}
+	return mdevNodeDeviceName(source.Address.UUID), nil
+}
+
+func mdevNodeDeviceName(mdevUUID string) string {
+	return mdevNodeDevicePrefix + strings.Replace(mdevUUID, "-", "_", -1)
+}
+
+func mdevUUIDFromNodeDeviceName(name string) (string, bool) {
+	if !strings.HasPrefix(name, mdevNodeDevicePrefix) {
+		return "", false
+	}
+	return strings.Replace(strings.TrimPrefix(name, mdevNodeDevicePrefix), "_", "-", -1), true
+}
@@ -0,0 +1,140 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+)
+
+var _ = Describe("Mediated devices", func() {
+	var tmpDir string
+	var originalSysfsRoot string
+	var ctrl *gomock.Controller
+	var mockConn *cli.MockConnection
+	var mockDev *cli.MockVirNodeDevice
+	var manager *LibvirtDomainManager
+
+	mdevUUID := "4b20d080-1b54-4048-85b3-a6a62d165c01"
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "sysfs")
+		Expect(err).ToNot(HaveOccurred())
+		originalSysfsRoot = sysfsRoot
+		sysfsRoot = tmpDir
+
+		ctrl = gomock.NewController(GinkgoT())
+		mockConn = cli.NewMockConnection(ctrl)
+		mockDev = cli.NewMockVirNodeDevice(ctrl)
+		manager = &LibvirtDomainManager{
+			virConn:         mockConn,
+			hostDeviceCache: make(map[string]string),
+		}
+	})
+
+	It("should create a mediated device through sysfs", func() {
+		typeDir := filepath.Join(tmpDir, "class", "mdev_bus", "0000:06:00.0", "mdev_supported_types", "nvidia-35")
+		Expect(os.MkdirAll(typeDir, 0755)).To(Succeed())
+
+		Expect(CreateMediatedDevice("0000:06:00.0", "nvidia-35", mdevUUID)).To(Succeed())
+		content, err := ioutil.ReadFile(filepath.Join(typeDir, "create"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(content)).To(Equal(mdevUUID))
+	})
+
+	It("should not create an existing mediated device again", func() {
+		Expect(os.MkdirAll(filepath.Join(tmpDir, "bus", "mdev", "devices", mdevUUID), 0755)).To(Succeed())
+		Expect(CreateMediatedDevice("0000:06:00.0", "nvidia-35", mdevUUID)).To(Succeed())
+	})
+
+	It("should fail to create an unsupported mediated device type", func() {
+		Expect(CreateMediatedDevice("0000:06:00.0", "nvidia-35", mdevUUID)).ToNot(Succeed())
+	})
+
+	It("should create the same mediated device on every sync of a VM", func() {
+		typeDir := filepath.Join(tmpDir, "class", "mdev_bus", "0000:06:00.0", "mdev_supported_types", "nvidia-35")
+		Expect(os.MkdirAll(typeDir, 0755)).To(Succeed())
+
+		vm := newVM("default", "testvm")
+		vm.ObjectMeta.UID = "1234"
+		source := api.HostDeviceSource{MdevParent: "0000:06:00.0", MdevType: "nvidia-35"}
+		name, err := prepareMediatedDevice(vm, 0, &source)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(name).To(Equal(mdevNodeDeviceName(source.Address.UUID)))
+		content, err := ioutil.ReadFile(filepath.Join(typeDir, "create"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(content)).To(Equal(source.Address.UUID))
+
+		again := api.HostDeviceSource{MdevParent: "0000:06:00.0", MdevType: "nvidia-35"}
+		_, err = prepareMediatedDevice(vm, 0, &again)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(again.Address.UUID).To(Equal(source.Address.UUID))
+	})
+
+	It("should reject mediated devices without uuid or type", func() {
+		_, err := prepareMediatedDevice(newVM("default", "testvm"), 0, &api.HostDeviceSource{})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should remove the mediated devices of a domain", func() {
+		devDir := filepath.Join(tmpDir, "bus", "mdev", "devices", mdevUUID)
+		Expect(os.MkdirAll(devDir, 0755)).To(Succeed())
+
+		vm := newVM("default", "testvm")
+		spec := api.NewMinimalDomainSpec("testvm")
+		spec.Devices.HostDevices = []api.HostDevice{
+			{
+				Mode:   "subsystem",
+				Type:   "mdev",
+				Model:  "vfio-pci",
+				Source: api.HostDeviceSource{Address: &api.Address{UUID: mdevUUID}},
+			},
+		}
+		mockConn.EXPECT().LookupNodeDeviceByName("mdev_4b20d080_1b54_4048_85b3_a6a62d165c01").Return(mockDev, nil)
+		mockDev.EXPECT().Free()
+
+		Expect(manager.prepareHostDevices(vm, spec)).To(Succeed())
+		Expect(manager.releaseHostDevices(vm)).To(Succeed())
+		Expect(manager.hostDeviceCache).To(BeEmpty())
+
+		content, err := ioutil.ReadFile(filepath.Join(devDir, "remove"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(content)).To(Equal("1"))
+	})
+
+	It("should ignore already removed mediated devices", func() {
+		Expect(RemoveMediatedDevice(mdevUUID)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+		sysfsRoot = originalSysfsRoot
+		os.RemoveAll(tmpDir)
+	})
+})
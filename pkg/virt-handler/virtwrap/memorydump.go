@@ -0,0 +1,157 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/logging"
+	memorydump "kubevirt.io/kubevirt/pkg/memory-dump"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cache"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/jobs"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+const defaultMemoryDumpFormat = "elf"
+
+var memoryDumpFormats = map[string]libvirt.DomainCoreDumpFormat{
+	"elf":          libvirt.DOMAIN_CORE_DUMP_FORMAT_RAW,
+	"kdump-zlib":   libvirt.DOMAIN_CORE_DUMP_FORMAT_KDUMP_ZLIB,
+	"kdump-lzo":    libvirt.DOMAIN_CORE_DUMP_FORMAT_KDUMP_LZO,
+	"kdump-snappy": libvirt.DOMAIN_CORE_DUMP_FORMAT_KDUMP_SNAPPY,
+}
+
+// Memory dumps are written by libvirt in its own pod onto the memory dump
+// claim of the VM, which is only mounted in the virt-launcher Pod. libvirt
+// reaches the claim through the root of the virt-launcher process, both run
+// in the host PID namespace.
+var procRoot = "/proc"
+
+var memoryDumpProgressInterval = 2 * time.Second
+
+func (l *LibvirtDomainManager) memoryDumpTarget(vm *v1.VirtualMachine, path string) (string, error) {
+	if memorydump.ClaimFromVM(vm) == "" {
+		return "", fmt.Errorf("the VM has no memory dump claim")
+	}
+	if err := memorydump.ValidatePath(path); err != nil {
+		return "", err
+	}
+	isolation, err := l.podIsolationDetector.Detect(vm)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Detecting the virt-launcher process failed.")
+		return "", err
+	}
+	return filepath.Join(procRoot, strconv.Itoa(isolation.Pid()), "root", memorydump.MountPath, path), nil
+}
+
+// MemoryDump writes the memory of a running guest to the file at the given
+// path on the memory dump claim of the VM, while the guest keeps running.
+// The dump runs as a background job, whose ID is returned. The domain is not
+// blocked while the dump is written, libvirt rejects conflicting domain jobs
+// by itself.
+func (l *LibvirtDomainManager) MemoryDump(vm *v1.VirtualMachine, path string, format string, trigger Trigger) (string, error) {
+	if format == "" {
+		format = defaultMemoryDumpFormat
+	}
+	dumpFormat, supported := memoryDumpFormats[format]
+	if !supported {
+		return "", fmt.Errorf("unsupported memory dump format %s", format)
+	}
+
+	target, err := l.memoryDumpTarget(vm, path)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(target); err == nil {
+		return "", fmt.Errorf("memory dump %s already exists", path)
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	run := func(progress func(percent uint)) error {
+		done := make(chan error, 1)
+		go func() {
+			done <- l.memoryDump(vm, target, dumpFormat)
+		}()
+
+		ticker := time.NewTicker(memoryDumpProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case err := <-done:
+				l.audit(vm, trigger, "memory-dump", path, err)
+				return err
+			case <-ticker.C:
+				if percent, known := l.memoryDumpProgress(vm); known {
+					progress(percent)
+				}
+			}
+		}
+	}
+	cancel := func() error {
+		return l.abortJob(vm)
+	}
+	return l.startJob(vm, jobs.MemoryDump, run, cancel)
+}
+
+// memoryDumpProgress reads how much of the guest memory libvirt dumped so
+// far from the stats of the domain job.
+func (l *LibvirtDomainManager) memoryDumpProgress(vm *v1.VirtualMachine) (uint, bool) {
+	dom, err := l.virConn.LookupDomainByName(cache.VMNamespaceKeyFunc(vm))
+	if err != nil {
+		return 0, false
+	}
+	defer dom.Free()
+
+	info, err := dom.GetJobStats(0)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain job stats failed.")
+		return 0, false
+	}
+	if info.Type == libvirt.DOMAIN_JOB_NONE || info.MemTotal == 0 {
+		return 0, false
+	}
+	return uint(info.MemProcessed * 100 / info.MemTotal), true
+}
+
+func (l *LibvirtDomainManager) memoryDump(vm *v1.VirtualMachine, target string, dumpFormat libvirt.DomainCoreDumpFormat) error {
+	dom, err := l.virConn.LookupDomainByName(cache.VMNamespaceKeyFunc(vm))
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain failed.")
+		return err
+	}
+	defer dom.Free()
+
+	logging.DefaultLogger().Object(vm).Info().Msgf("Dumping the guest memory to %s.", target)
+	if err := dom.CoreDumpWithFormat(target, dumpFormat, libvirt.DUMP_MEMORY_ONLY|libvirt.DUMP_LIVE); err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Dumping the guest memory failed.")
+		return err
+	}
+	logging.DefaultLogger().Object(vm).Info().Msgf("Guest memory dumped to %s.", target)
+	return nil
+}
@@ -0,0 +1,180 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	memorydump "kubevirt.io/kubevirt/pkg/memory-dump"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/isolation"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/jobs"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Memory dumps", func() {
+	var tmpDir string
+	var claimDir string
+	var originalProcRoot string
+	var originalProgressInterval time.Duration
+	var ctrl *gomock.Controller
+	var mockConn *cli.MockConnection
+	var mockDomain *cli.MockVirDomain
+	var mockDetector *isolation.MockPodIsolationDetector
+	var manager *LibvirtDomainManager
+	var vm *v1.VirtualMachine
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "memorydump")
+		Expect(err).ToNot(HaveOccurred())
+		originalProcRoot = procRoot
+		procRoot = tmpDir
+		originalProgressInterval = memoryDumpProgressInterval
+		memoryDumpProgressInterval = 10 * time.Millisecond
+		claimDir = filepath.Join(tmpDir, "1234", "root", memorydump.MountPath)
+
+		ctrl = gomock.NewController(GinkgoT())
+		mockConn = cli.NewMockConnection(ctrl)
+		mockDomain = cli.NewMockVirDomain(ctrl)
+		mockDetector = isolation.NewMockPodIsolationDetector(ctrl)
+		manager = &LibvirtDomainManager{virConn: mockConn, podIsolationDetector: mockDetector, jobs: jobs.NewJobManager()}
+
+		vm = newVM("default", "testvm")
+		vm.ObjectMeta.Annotations = map[string]string{v1.MemoryDumpClaimAnnotation: "dumps"}
+	})
+
+	expectIsolationDetection := func() {
+		mockDetector.EXPECT().Detect(vm).Return(isolation.NewIsolationResult(1234, "dfd", []string{"a", "b"}), nil)
+	}
+
+	waitForJob := func(id string) jobs.Job {
+		var job jobs.Job
+		Eventually(func() bool {
+			job, _ = manager.jobs.Get(id)
+			return job.IsFinished()
+		}).Should(BeTrue())
+		return job
+	}
+
+	It("should dump the memory of live guests as ELF onto the claim by default", func() {
+		target := filepath.Join(claimDir, "dumps", "testvm.core")
+		expectIsolationDetection()
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+		mockDomain.EXPECT().CoreDumpWithFormat(target, libvirt.DOMAIN_CORE_DUMP_FORMAT_RAW, libvirt.DUMP_MEMORY_ONLY|libvirt.DUMP_LIVE).Return(nil)
+		mockDomain.EXPECT().Free()
+
+		id, err := manager.MemoryDump(vm, "dumps/testvm.core", "", TriggerVMController)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(waitForJob(id).Phase).To(Equal(jobs.Succeeded))
+		Expect(filepath.Join(claimDir, "dumps")).To(BeADirectory())
+	})
+
+	It("should use the requested format", func() {
+		target := filepath.Join(claimDir, "testvm.kdump")
+		expectIsolationDetection()
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+		mockDomain.EXPECT().CoreDumpWithFormat(target, libvirt.DOMAIN_CORE_DUMP_FORMAT_KDUMP_ZLIB, libvirt.DUMP_MEMORY_ONLY|libvirt.DUMP_LIVE).Return(nil)
+		mockDomain.EXPECT().Free()
+
+		id, err := manager.MemoryDump(vm, "testvm.kdump", "kdump-zlib", TriggerVMController)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(waitForJob(id).Phase).To(Equal(jobs.Succeeded))
+	})
+
+	It("should report the progress of the dump through the job", func() {
+		dumped := make(chan struct{})
+		expectIsolationDetection()
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil).AnyTimes()
+		mockDomain.EXPECT().CoreDumpWithFormat(gomock.Any(), libvirt.DOMAIN_CORE_DUMP_FORMAT_RAW, libvirt.DUMP_MEMORY_ONLY|libvirt.DUMP_LIVE).Do(func(string, libvirt.DomainCoreDumpFormat, libvirt.DomainCoreDumpFlags) {
+			<-dumped
+		}).Return(nil)
+		mockDomain.EXPECT().GetJobStats(libvirt.DomainGetJobStatsFlags(0)).Return(&libvirt.DomainJobInfo{
+			Type:         libvirt.DOMAIN_JOB_UNBOUNDED,
+			MemTotal:     1024,
+			MemProcessed: 256,
+		}, nil).AnyTimes()
+		mockDomain.EXPECT().Free().AnyTimes()
+
+		id, err := manager.MemoryDump(vm, "testvm.core", "", TriggerVMController)
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(func() uint {
+			job, _ := manager.jobs.Get(id)
+			return job.Progress
+		}).Should(Equal(uint(25)))
+		close(dumped)
+		Expect(waitForJob(id).Phase).To(Equal(jobs.Succeeded))
+	})
+
+	It("should report failed dumps through the job", func() {
+		expectIsolationDetection()
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+		mockDomain.EXPECT().CoreDumpWithFormat(gomock.Any(), libvirt.DOMAIN_CORE_DUMP_FORMAT_RAW, libvirt.DUMP_MEMORY_ONLY|libvirt.DUMP_LIVE).Return(libvirt.Error{Code: libvirt.ERR_OPERATION_FAILED})
+		mockDomain.EXPECT().Free()
+
+		id, err := manager.MemoryDump(vm, "testvm.core", "", TriggerVMController)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(waitForJob(id).Phase).To(Equal(jobs.Failed))
+	})
+
+	It("should reject unsupported formats", func() {
+		_, err := manager.MemoryDump(vm, "testvm.core", "vmcore", TriggerVMController)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should reject VMs without a memory dump claim", func() {
+		_, err := manager.MemoryDump(newVM("default", "testvm"), "testvm.core", "", TriggerVMController)
+		Expect(err).To(HaveOccurred())
+	})
+
+	table.DescribeTable("should only write onto the memory dump claim", func(path string) {
+		_, err := manager.MemoryDump(vm, path, "", TriggerVMController)
+		Expect(err).To(HaveOccurred())
+	},
+		table.Entry("with an empty path", ""),
+		table.Entry("with an absolute path", "/etc/testvm.core"),
+		table.Entry("with a relative path", "../testvm.core"),
+		table.Entry("with the parent directory", ".."),
+	)
+
+	It("should not overwrite existing files", func() {
+		Expect(os.MkdirAll(claimDir, 0700)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(claimDir, "testvm.core"), []byte("dump"), 0600)).To(Succeed())
+		expectIsolationDetection()
+		_, err := manager.MemoryDump(vm, "testvm.core", "", TriggerVMController)
+		Expect(err).To(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+		procRoot = originalProcRoot
+		memoryDumpProgressInterval = originalProgressInterval
+		os.RemoveAll(tmpDir)
+	})
+})
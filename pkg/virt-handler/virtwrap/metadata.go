@@ -0,0 +1,75 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"encoding/xml"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	domainerrors "kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/errors"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+func newKubeVirtMetadata(vm *v1.VirtualMachine) *api.KubeVirtMetadata {
+	return &api.KubeVirtMetadata{
+		UID:          vm.GetObjectMeta().GetUID(),
+		MigrationUID: types.UID(vm.GetObjectMeta().GetLabels()[v1.MigrationUIDLabel]),
+	}
+}
+
+// SetMetadata stores the KubeVirt metadata in the persistent definition of
+// the domain, so that it survives restarts of the domain and of virt-handler.
+func SetMetadata(dom cli.VirDomain, metadata *api.KubeVirtMetadata) error {
+	xmlstr, err := xml.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	return dom.SetMetadata(string(xmlstr), libvirt.DOMAIN_METADATA_ELEMENT, api.KubeVirtMetadataPrefix, api.KubeVirtMetadataURI, libvirt.DOMAIN_AFFECT_CONFIG)
+}
+
+// GetMetadata reads the KubeVirt metadata of the domain. Domains which were
+// defined before we started to store metadata get an empty one.
+func GetMetadata(dom cli.VirDomain) (*api.KubeVirtMetadata, error) {
+	metadata := &api.KubeVirtMetadata{}
+	xmlstr, err := dom.GetMetadata(libvirt.DOMAIN_METADATA_ELEMENT, api.KubeVirtMetadataURI, libvirt.DOMAIN_AFFECT_CONFIG)
+	if err != nil {
+		if domainerrors.IsMetadataNotFound(err) {
+			return metadata, nil
+		}
+		return nil, err
+	}
+	if err := xml.Unmarshal([]byte(xmlstr), metadata); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+// previousMetadata reads the KubeVirt metadata of the currently defined
+// domain, which is nil if there is none.
+func previousMetadata(current cli.VirDomain) (*api.KubeVirtMetadata, error) {
+	if current == nil {
+		return &api.KubeVirtMetadata{}, nil
+	}
+	return GetMetadata(current)
+}
@@ -0,0 +1,78 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/types"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Domain metadata", func() {
+	var ctrl *gomock.Controller
+	var mockDomain *cli.MockVirDomain
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockDomain = cli.NewMockVirDomain(ctrl)
+	})
+
+	It("should store the metadata in the KubeVirt namespace", func() {
+		vm := newVM("default", "testvm")
+		vm.ObjectMeta.Labels = map[string]string{v1.MigrationUIDLabel: "1234"}
+		metadata := newKubeVirtMetadata(vm)
+		Expect(metadata.MigrationUID).To(Equal(types.UID("1234")))
+
+		mockDomain.EXPECT().SetMetadata(
+			"<kubevirt><uid>"+string(vm.GetObjectMeta().GetUID())+"</uid><migrationUID>1234</migrationUID></kubevirt>",
+			libvirt.DOMAIN_METADATA_ELEMENT, "kubevirt", "http://kubevirt.io", libvirt.DOMAIN_AFFECT_CONFIG,
+		).Return(nil)
+		Expect(SetMetadata(mockDomain, metadata)).To(Succeed())
+	})
+
+	It("should read the metadata back", func() {
+		mockDomain.EXPECT().GetMetadata(libvirt.DOMAIN_METADATA_ELEMENT, "http://kubevirt.io", libvirt.DOMAIN_AFFECT_CONFIG).Return(
+			`<kubevirt xmlns="http://kubevirt.io"><uid>1234</uid><gracePeriodSeconds>30</gracePeriodSeconds></kubevirt>`, nil,
+		)
+		metadata, err := GetMetadata(mockDomain)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(metadata.UID).To(Equal(types.UID("1234")))
+		Expect(*metadata.GracePeriodSeconds).To(Equal(int64(30)))
+	})
+
+	It("should return empty metadata for domains without metadata", func() {
+		mockDomain.EXPECT().GetMetadata(libvirt.DOMAIN_METADATA_ELEMENT, "http://kubevirt.io", libvirt.DOMAIN_AFFECT_CONFIG).Return(
+			"", libvirt.Error{Code: libvirt.ERR_NO_DOMAIN_METADATA},
+		)
+		metadata, err := GetMetadata(mockDomain)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(*metadata).To(Equal(api.KubeVirtMetadata{}))
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+})
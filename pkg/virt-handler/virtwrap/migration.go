@@ -0,0 +1,109 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"fmt"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cache"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+// TuneMigration applies the bandwidth and downtime limits of a migration to
+// the domain and switches it to post-copy mode on request. libvirt picks up
+// changes even while the migration is running. Auto-converge and allowing
+// post-copy can only be chosen when the migration starts.
+func (l *LibvirtDomainManager) TuneMigration(vm *v1.VirtualMachine, options *v1.MigrationOptions) error {
+	if options == nil || (options.Bandwidth == 0 && options.MaxDowntime == 0 && !options.StartPostCopy) {
+		return nil
+	}
+	return l.runOnDomain(vm, func() error {
+		return l.tuneMigration(vm, options)
+	})
+}
+
+func (l *LibvirtDomainManager) tuneMigration(vm *v1.VirtualMachine, options *v1.MigrationOptions) error {
+	dom, err := l.virConn.LookupDomainByName(cache.VMNamespaceKeyFunc(vm))
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain failed.")
+		return err
+	}
+	defer dom.Free()
+
+	if options.Bandwidth != 0 {
+		speed, err := dom.MigrateGetMaxSpeed(0)
+		if err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the migration bandwidth failed.")
+			return err
+		}
+		if speed != options.Bandwidth {
+			err := dom.MigrateSetMaxSpeed(options.Bandwidth, 0)
+			l.audit(vm, TriggerVMController, "migrate-set-speed", options.Bandwidth, err)
+			if err != nil {
+				logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Setting the migration bandwidth failed.")
+				return err
+			}
+			logging.DefaultLogger().Object(vm).Info().Msgf("Migration bandwidth set to %d MiB/s.", options.Bandwidth)
+		}
+	}
+	// libvirt can't report the current downtime limit, setting it again is cheap
+	if options.MaxDowntime != 0 {
+		err := dom.MigrateSetMaxDowntime(options.MaxDowntime, 0)
+		l.audit(vm, TriggerVMController, "migrate-set-downtime", options.MaxDowntime, err)
+		if err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Setting the migration downtime failed.")
+			return err
+		}
+	}
+	if options.StartPostCopy {
+		if err := l.requireFeature(cli.FeaturePostCopyMigration); err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Post-copy is not supported.")
+			return err
+		}
+		err := startPostCopy(vm, dom, options)
+		l.audit(vm, TriggerVMController, "migrate-start-postcopy", nil, err)
+		return err
+	}
+	return nil
+}
+
+func startPostCopy(vm *v1.VirtualMachine, dom cli.VirDomain, options *v1.MigrationOptions) error {
+	if !options.PostCopy && !options.PostCopyAfterPrecopy {
+		return fmt.Errorf("post-copy was not enabled when the migration started")
+	}
+	// The source domain stays paused while the destination pulls the memory
+	domState, reason, err := dom.GetState()
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain state failed.")
+		return err
+	}
+	if domState == libvirt.DOMAIN_PAUSED && libvirt.DomainPausedReason(reason) == libvirt.DOMAIN_PAUSED_POSTCOPY {
+		return nil
+	}
+	if err := dom.MigrateStartPostCopy(0); err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Switching the migration to post-copy failed.")
+		return err
+	}
+	logging.DefaultLogger().Object(vm).Info().Msg("Migration switched to post-copy.")
+	return nil
+}
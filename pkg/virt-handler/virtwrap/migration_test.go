@@ -0,0 +1,111 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Migration", func() {
+	var ctrl *gomock.Controller
+	var mockConn *cli.MockConnection
+	var mockDomain *cli.MockVirDomain
+	var manager *LibvirtDomainManager
+	var vm *v1.VirtualMachine
+
+	expectVersions := func(libvirtVersion uint32, qemuVersion uint32) {
+		mockConn.EXPECT().GetLibVersion().Return(libvirtVersion, nil)
+		mockConn.EXPECT().GetVersion().Return(qemuVersion, nil)
+	}
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockConn = cli.NewMockConnection(ctrl)
+		mockDomain = cli.NewMockVirDomain(ctrl)
+		manager = &LibvirtDomainManager{virConn: mockConn}
+		vm = newVM("default", "testvm")
+	})
+
+	Context("tuning", func() {
+		It("should do nothing without limits", func() {
+			Expect(manager.TuneMigration(vm, nil)).To(Succeed())
+			Expect(manager.TuneMigration(vm, &v1.MigrationOptions{AutoConverge: true})).To(Succeed())
+		})
+
+		It("should apply changed limits", func() {
+			mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+			mockDomain.EXPECT().MigrateGetMaxSpeed(uint32(0)).Return(uint64(8796093022207), nil)
+			mockDomain.EXPECT().MigrateSetMaxSpeed(uint64(100), uint32(0)).Return(nil)
+			mockDomain.EXPECT().MigrateSetMaxDowntime(uint64(500), uint32(0)).Return(nil)
+			mockDomain.EXPECT().Free()
+			Expect(manager.TuneMigration(vm, &v1.MigrationOptions{Bandwidth: 100, MaxDowntime: 500})).To(Succeed())
+		})
+
+		It("should leave an unchanged bandwidth alone", func() {
+			mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+			mockDomain.EXPECT().MigrateGetMaxSpeed(uint32(0)).Return(uint64(100), nil)
+			mockDomain.EXPECT().Free()
+			Expect(manager.TuneMigration(vm, &v1.MigrationOptions{Bandwidth: 100})).To(Succeed())
+		})
+	})
+
+	Context("post-copy", func() {
+		It("should switch the migration to post-copy", func() {
+			mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+			expectVersions(3000000, 2009000)
+			mockDomain.EXPECT().GetState().Return(libvirt.DOMAIN_RUNNING, int(libvirt.DOMAIN_RUNNING_MIGRATED), nil)
+			mockDomain.EXPECT().MigrateStartPostCopy(uint32(0)).Return(nil)
+			mockDomain.EXPECT().Free()
+			Expect(manager.TuneMigration(vm, &v1.MigrationOptions{PostCopy: true, StartPostCopy: true})).To(Succeed())
+		})
+
+		It("should not switch twice", func() {
+			mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+			expectVersions(3000000, 2009000)
+			mockDomain.EXPECT().GetState().Return(libvirt.DOMAIN_PAUSED, int(libvirt.DOMAIN_PAUSED_POSTCOPY), nil)
+			mockDomain.EXPECT().Free()
+			Expect(manager.TuneMigration(vm, &v1.MigrationOptions{PostCopy: true, StartPostCopy: true})).To(Succeed())
+		})
+
+		It("should refuse to switch if post-copy was not enabled", func() {
+			mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+			expectVersions(3000000, 2009000)
+			mockDomain.EXPECT().Free()
+			Expect(manager.TuneMigration(vm, &v1.MigrationOptions{StartPostCopy: true})).ToNot(Succeed())
+		})
+	})
+
+	It("should refuse to switch to post-copy if the host does not support it", func() {
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+		expectVersions(1002000, 2009000)
+		mockDomain.EXPECT().Free()
+		Expect(manager.TuneMigration(vm, &v1.MigrationOptions{PostCopy: true, StartPostCopy: true})).To(MatchError(ContainSubstring("requires libvirt 1.3.3")))
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+})
@@ -0,0 +1,101 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"fmt"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+)
+
+// vhost-net can not open more queues on a tap device than the kernel allows
+// and qemu supports at most 1024 virtqueues per virtio-blk device.
+const maxNetQueues = 256
+const maxBlockQueues = 1024
+
+func isVirtioInterface(iface *api.Interface) bool {
+	return iface.Type == "vhostuser" || (iface.Model != nil && iface.Model.Type == "virtio")
+}
+
+func isVirtioDisk(disk *api.Disk) bool {
+	return disk.Device == "disk" && disk.Target.Bus == "virtio"
+}
+
+func domainVCPUs(spec *api.DomainSpec) uint {
+	if spec.VCPU == nil || spec.VCPU.CPUs == 0 {
+		return 1
+	}
+	return spec.VCPU.CPUs
+}
+
+func autoQueues(vcpus uint, max uint) uint {
+	if vcpus > max {
+		return max
+	}
+	return vcpus
+}
+
+// prepareQueues validates the number of queues of disks and interfaces and,
+// if requested, gives every virtio device without an explicit number of
+// queues one queue per vCPU. A single queue is the default of qemu, so
+// nothing is done for guests with a single vCPU.
+func prepareQueues(vm *v1.VirtualMachine, spec *api.DomainSpec) error {
+	vcpus := domainVCPUs(spec)
+	auto := vm.Spec.Domain != nil && vm.Spec.Domain.Devices.MultiQueue && vcpus > 1
+
+	for i := range spec.Devices.Interfaces {
+		iface := &spec.Devices.Interfaces[i]
+		if iface.Driver != nil && iface.Driver.Queues > 0 {
+			if !isVirtioInterface(iface) {
+				return fmt.Errorf("interface %d needs the virtio model for multiple queues", i)
+			}
+			if iface.Driver.Queues > maxNetQueues {
+				return fmt.Errorf("interface %d has %d queues, at most %d are supported", i, iface.Driver.Queues, maxNetQueues)
+			}
+			continue
+		}
+		if auto && isVirtioInterface(iface) {
+			if iface.Driver == nil {
+				iface.Driver = &api.InterfaceDriver{}
+			}
+			iface.Driver.Queues = autoQueues(vcpus, maxNetQueues)
+		}
+	}
+
+	for i := range spec.Devices.Disks {
+		disk := &spec.Devices.Disks[i]
+		if disk.Driver != nil && disk.Driver.Queues > 0 {
+			if !isVirtioDisk(disk) {
+				return fmt.Errorf("disk %s needs the virtio bus for multiple queues", disk.Target.Device)
+			}
+			if disk.Driver.Queues > maxBlockQueues {
+				return fmt.Errorf("disk %s has %d queues, at most %d are supported", disk.Target.Device, disk.Driver.Queues, maxBlockQueues)
+			}
+			continue
+		}
+		// Disks without a driver are left alone, since we can not know
+		// their format
+		if auto && isVirtioDisk(disk) && disk.Driver != nil {
+			disk.Driver.Queues = autoQueues(vcpus, maxBlockQueues)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+)
+
+var _ = Describe("Multiqueue", func() {
+
+	newSpec := func(vcpus uint) *api.DomainSpec {
+		spec := api.NewMinimalDomainSpec("testvm")
+		spec.VCPU = &api.VCPU{CPUs: vcpus}
+		spec.Devices.Interfaces = []api.Interface{
+			{Type: "network", Source: api.InterfaceSource{Network: "default"}, Model: &api.Model{Type: "virtio"}},
+			{Type: "network", Source: api.InterfaceSource{Network: "default"}, Model: &api.Model{Type: "e1000"}},
+		}
+		spec.Devices.Disks = []api.Disk{
+			{
+				Type:   "file",
+				Device: "disk",
+				Source: api.DiskSource{File: "/var/run/kubevirt/disk.img"},
+				Target: api.DiskTarget{Device: "vda", Bus: "virtio"},
+				Driver: &api.DiskDriver{Name: "qemu", Type: "raw"},
+			},
+			{
+				Type:   "file",
+				Device: "disk",
+				Source: api.DiskSource{File: "/var/run/kubevirt/disk2.img"},
+				Target: api.DiskTarget{Device: "sda", Bus: "scsi"},
+				Driver: &api.DiskDriver{Name: "qemu", Type: "raw"},
+			},
+		}
+		return spec
+	}
+
+	It("should give virtio devices one queue per vCPU", func() {
+		vm := newVM("default", "testvm")
+		vm.Spec.Domain.Devices.MultiQueue = true
+		spec := newSpec(4)
+		Expect(prepareQueues(vm, spec)).To(Succeed())
+		Expect(spec.Devices.Interfaces[0].Driver).To(Equal(&api.InterfaceDriver{Queues: 4}))
+		Expect(spec.Devices.Interfaces[1].Driver).To(BeNil())
+		Expect(spec.Devices.Disks[0].Driver.Queues).To(Equal(uint(4)))
+		Expect(spec.Devices.Disks[1].Driver.Queues).To(BeZero())
+	})
+
+	It("should keep explicit queue counts", func() {
+		vm := newVM("default", "testvm")
+		vm.Spec.Domain.Devices.MultiQueue = true
+		spec := newSpec(4)
+		spec.Devices.Interfaces[0].Driver = &api.InterfaceDriver{Queues: 2}
+		Expect(prepareQueues(vm, spec)).To(Succeed())
+		Expect(spec.Devices.Interfaces[0].Driver.Queues).To(Equal(uint(2)))
+	})
+
+	It("should only configure queues on request", func() {
+		spec := newSpec(4)
+		Expect(prepareQueues(newVM("default", "testvm"), spec)).To(Succeed())
+		Expect(spec.Devices.Interfaces[0].Driver).To(BeNil())
+		Expect(spec.Devices.Disks[0].Driver.Queues).To(BeZero())
+	})
+
+	It("should cap the queues of interfaces at the vhost-net limit", func() {
+		vm := newVM("default", "testvm")
+		vm.Spec.Domain.Devices.MultiQueue = true
+		spec := newSpec(288)
+		Expect(prepareQueues(vm, spec)).To(Succeed())
+		Expect(spec.Devices.Interfaces[0].Driver.Queues).To(Equal(uint(maxNetQueues)))
+		Expect(spec.Devices.Disks[0].Driver.Queues).To(Equal(uint(288)))
+	})
+
+	It("should reject too many queues", func() {
+		spec := newSpec(1)
+		spec.Devices.Disks[0].Driver.Queues = maxBlockQueues + 1
+		Expect(prepareQueues(newVM("default", "testvm"), spec)).ToNot(Succeed())
+	})
+
+	It("should reject queues on devices which are no virtio devices", func() {
+		spec := newSpec(1)
+		spec.Devices.Interfaces[1].Driver = &api.InterfaceDriver{Queues: 2}
+		Expect(prepareQueues(newVM("default", "testvm"), spec)).ToNot(Succeed())
+	})
+})
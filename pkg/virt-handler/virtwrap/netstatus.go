@@ -0,0 +1,110 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"strings"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cache"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+// GuestNetworkStatus reports the network interfaces of the domain. The
+// interfaces and their MACs come from the domain XML, names and addresses
+// from the guest agent. Where the guest agent does not know an address,
+// e.g. because it is not installed or not connected, the DHCP leases of
+// libvirt networks are used instead.
+func (l *LibvirtDomainManager) GuestNetworkStatus(vm *v1.VirtualMachine) ([]v1.VMNetworkInterface, error) {
+	domName := cache.VMNamespaceKeyFunc(vm)
+	dom, err := l.virConn.LookupDomainByName(domName)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain failed.")
+		return nil, err
+	}
+	defer dom.Free()
+
+	spec, err := l.getDomainSpec(domName, dom)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain spec failed.")
+		return nil, err
+	}
+
+	interfaces := []v1.VMNetworkInterface{}
+	byMAC := map[string]int{}
+	hasNetworkInterface := false
+	for _, iface := range spec.Devices.Interfaces {
+		if iface.MAC == nil {
+			continue
+		}
+		mac := strings.ToLower(iface.MAC.MAC)
+		byMAC[mac] = len(interfaces)
+		interfaces = append(interfaces, v1.VMNetworkInterface{MAC: mac})
+		if iface.Type == "network" {
+			hasNetworkInterface = true
+		}
+	}
+
+	// Don't wait on an agent which does not listen
+	connected, err := l.AgentConnected(vm)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Info().V(3).Reason(err).Msg("Checking the guest agent failed.")
+	}
+	if connected {
+		agentInterfaces, err := dom.ListAllInterfaceAddresses(libvirt.DOMAIN_INTERFACE_ADDRESSES_SRC_AGENT)
+		if err != nil {
+			logging.DefaultLogger().Object(vm).Info().V(3).Reason(err).Msg("Getting the interface addresses from the guest agent failed.")
+		}
+		mergeInterfaceAddresses(interfaces, byMAC, agentInterfaces, true)
+	}
+
+	// Leases are only known for interfaces on libvirt networks
+	if hasNetworkInterface {
+		leaseInterfaces, err := dom.ListAllInterfaceAddresses(libvirt.DOMAIN_INTERFACE_ADDRESSES_SRC_LEASE)
+		if err != nil {
+			logging.DefaultLogger().Object(vm).Info().V(3).Reason(err).Msg("Getting the DHCP leases of the domain failed.")
+		}
+		mergeInterfaceAddresses(interfaces, byMAC, leaseInterfaces, false)
+	}
+	return interfaces, nil
+}
+
+// mergeInterfaceAddresses adds the addresses to the interfaces with the same
+// MAC. Names are only taken from the guest agent, the interface names of
+// leases are the host side devices. Interfaces which already have addresses
+// from a more reliable source are left alone.
+func mergeInterfaceAddresses(interfaces []v1.VMNetworkInterface, byMAC map[string]int, reported []libvirt.DomainInterface, fromAgent bool) {
+	for _, iface := range reported {
+		i, exists := byMAC[strings.ToLower(iface.Hwaddr)]
+		if !exists {
+			continue
+		}
+		if fromAgent {
+			interfaces[i].InterfaceName = iface.Name
+		}
+		if len(interfaces[i].IPs) > 0 {
+			continue
+		}
+		for _, addr := range iface.Addrs {
+			interfaces[i].IPs = append(interfaces[i].IPs, addr.Addr)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"fmt"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Guest network status", func() {
+	var ctrl *gomock.Controller
+	var mockConn *cli.MockConnection
+	var mockDomain *cli.MockVirDomain
+	var manager *LibvirtDomainManager
+
+	domainXML := `<domain type="kvm">
+  <name>default_testvm</name>
+  <devices>
+    <interface type="network">
+      <mac address="52:54:00:6D:90:02"></mac>
+      <source network="default"></source>
+    </interface>
+    <interface type="bridge">
+      <mac address="52:54:00:6d:90:03"></mac>
+      <source bridge="br0"></source>
+    </interface>
+  </devices>
+</domain>`
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockConn = cli.NewMockConnection(ctrl)
+		mockDomain = cli.NewMockVirDomain(ctrl)
+		manager = &LibvirtDomainManager{virConn: mockConn, domainSpecs: newDomainSpecCache()}
+
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+		mockDomain.EXPECT().GetXMLDesc(libvirt.DomainXMLFlags(0)).Return(domainXML, nil)
+		mockDomain.EXPECT().Free()
+	})
+
+	It("should prefer the addresses reported by the guest agent", func() {
+		manager.agentStates.set("default_testvm", true)
+		mockDomain.EXPECT().ListAllInterfaceAddresses(libvirt.DOMAIN_INTERFACE_ADDRESSES_SRC_AGENT).Return([]libvirt.DomainInterface{
+			{Name: "lo", Hwaddr: "00:00:00:00:00:00", Addrs: []libvirt.DomainIPAddress{{Addr: "127.0.0.1"}}},
+			{Name: "eth0", Hwaddr: "52:54:00:6d:90:02", Addrs: []libvirt.DomainIPAddress{{Addr: "192.168.122.10"}, {Addr: "fe80::5054:ff:fe6d:9002"}}},
+			{Name: "eth1", Hwaddr: "52:54:00:6d:90:03", Addrs: []libvirt.DomainIPAddress{{Addr: "10.0.0.5"}}},
+		}, nil)
+		mockDomain.EXPECT().ListAllInterfaceAddresses(libvirt.DOMAIN_INTERFACE_ADDRESSES_SRC_LEASE).Return([]libvirt.DomainInterface{
+			{Name: "vnet0", Hwaddr: "52:54:00:6d:90:02", Addrs: []libvirt.DomainIPAddress{{Addr: "192.168.122.99"}}},
+		}, nil)
+
+		interfaces, err := manager.GuestNetworkStatus(newVM("default", "testvm"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(interfaces).To(Equal([]v1.VMNetworkInterface{
+			{MAC: "52:54:00:6d:90:02", InterfaceName: "eth0", IPs: []string{"192.168.122.10", "fe80::5054:ff:fe6d:9002"}},
+			{MAC: "52:54:00:6d:90:03", InterfaceName: "eth1", IPs: []string{"10.0.0.5"}},
+		}))
+	})
+
+	It("should fall back to the DHCP leases if the guest agent fails", func() {
+		manager.agentStates.set("default_testvm", true)
+		mockDomain.EXPECT().ListAllInterfaceAddresses(libvirt.DOMAIN_INTERFACE_ADDRESSES_SRC_AGENT).Return(nil, fmt.Errorf("guest agent is not responding"))
+		mockDomain.EXPECT().ListAllInterfaceAddresses(libvirt.DOMAIN_INTERFACE_ADDRESSES_SRC_LEASE).Return([]libvirt.DomainInterface{
+			{Name: "vnet0", Hwaddr: "52:54:00:6d:90:02", Addrs: []libvirt.DomainIPAddress{{Addr: "192.168.122.99"}}},
+		}, nil)
+
+		interfaces, err := manager.GuestNetworkStatus(newVM("default", "testvm"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(interfaces).To(Equal([]v1.VMNetworkInterface{
+			{MAC: "52:54:00:6d:90:02", IPs: []string{"192.168.122.99"}},
+			{MAC: "52:54:00:6d:90:03"},
+		}))
+	})
+
+	It("should not ask a disconnected guest agent", func() {
+		manager.agentStates.set("default_testvm", false)
+		mockDomain.EXPECT().ListAllInterfaceAddresses(libvirt.DOMAIN_INTERFACE_ADDRESSES_SRC_LEASE).Return([]libvirt.DomainInterface{
+			{Name: "vnet0", Hwaddr: "52:54:00:6d:90:02", Addrs: []libvirt.DomainIPAddress{{Addr: "192.168.122.99"}}},
+		}, nil)
+
+		interfaces, err := manager.GuestNetworkStatus(newVM("default", "testvm"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(interfaces).To(Equal([]v1.VMNetworkInterface{
+			{MAC: "52:54:00:6d:90:02", IPs: []string{"192.168.122.99"}},
+			{MAC: "52:54:00:6d:90:03"},
+		}))
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+})
@@ -0,0 +1,96 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"encoding/xml"
+	"fmt"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+)
+
+// DefineNetworkFilter creates or updates a network filter.
+func DefineNetworkFilter(conn cli.Connection, filter *api.NWFilter) error {
+	xmlStr, err := xml.Marshal(filter)
+	if err != nil {
+		return err
+	}
+	nwfilter, err := conn.NWFilterDefineXML(string(xmlStr))
+	if err != nil {
+		logging.DefaultLogger().Error().Reason(err).Msgf("Defining the network filter %s failed.", filter.Name)
+		return err
+	}
+	return nwfilter.Free()
+}
+
+// UndefineNetworkFilter removes a network filter. libvirt refuses to remove
+// filters which are still in use by interfaces or other filters.
+func UndefineNetworkFilter(conn cli.Connection, name string) error {
+	nwfilter, err := conn.LookupNWFilterByName(name)
+	if err != nil {
+		return err
+	}
+	defer nwfilter.Free()
+	return nwfilter.Undefine()
+}
+
+// ListNetworkFilters returns all network filters defined on the host.
+func ListNetworkFilters(conn cli.Connection) ([]api.NWFilter, error) {
+	nwfilters, err := conn.ListAllNWFilters(0)
+	if err != nil {
+		return nil, err
+	}
+
+	filters := []api.NWFilter{}
+	for _, nwfilter := range nwfilters {
+		xmlstr, err := nwfilter.GetXMLDesc(0)
+		nwfilter.Free()
+		if err != nil {
+			return nil, err
+		}
+		var filter api.NWFilter
+		if err := xml.Unmarshal([]byte(xmlstr), &filter); err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+	}
+	return filters, nil
+}
+
+// validateNetworkFilters makes sure that all filters which are referenced by
+// interfaces exist, since libvirt would otherwise only fail when the domain
+// is started.
+func (l *LibvirtDomainManager) validateNetworkFilters(vm *v1.VirtualMachine, spec *api.DomainSpec) error {
+	for _, iface := range spec.Devices.Interfaces {
+		if iface.FilterRef == nil {
+			continue
+		}
+		nwfilter, err := l.virConn.LookupNWFilterByName(iface.FilterRef.Filter)
+		if err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msgf("Looking up the network filter %s failed.", iface.FilterRef.Filter)
+			return fmt.Errorf("network filter %s is not available: %v", iface.FilterRef.Filter, err)
+		}
+		nwfilter.Free()
+	}
+	return nil
+}
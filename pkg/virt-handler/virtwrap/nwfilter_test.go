@@ -0,0 +1,83 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"encoding/xml"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Network filters", func() {
+	var ctrl *gomock.Controller
+	var mockConn *cli.MockConnection
+	var mockFilter *cli.MockVirNWFilter
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockConn = cli.NewMockConnection(ctrl)
+		mockFilter = cli.NewMockVirNWFilter(ctrl)
+	})
+
+	It("should define an anti-spoofing filter", func() {
+		filter := api.NewAntiSpoofingFilter("kubevirt-no-spoofing")
+		filterXML, err := xml.Marshal(filter)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(filterXML)).To(ContainSubstring(`<filterref filter="no-ip-spoofing"></filterref>`))
+
+		mockConn.EXPECT().NWFilterDefineXML(string(filterXML)).Return(mockFilter, nil)
+		mockFilter.EXPECT().Free()
+		Expect(DefineNetworkFilter(mockConn, filter)).To(Succeed())
+	})
+
+	It("should list the defined filters", func() {
+		mockConn.EXPECT().ListAllNWFilters(uint32(0)).Return([]cli.VirNWFilter{mockFilter}, nil)
+		mockFilter.EXPECT().GetXMLDesc(uint32(0)).Return(`<filter name="clean-traffic" chain="root"><filterref filter="no-mac-spoofing"/></filter>`, nil)
+		mockFilter.EXPECT().Free()
+
+		filters, err := ListNetworkFilters(mockConn)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(filters).To(HaveLen(1))
+		Expect(filters[0].Name).To(Equal("clean-traffic"))
+		Expect(filters[0].FilterRefs[0].Filter).To(Equal("no-mac-spoofing"))
+	})
+
+	It("should reject interfaces which reference unknown filters", func() {
+		manager := &LibvirtDomainManager{virConn: mockConn}
+		spec := api.NewMinimalDomainSpec("testvm")
+		spec.Devices.Interfaces[0].FilterRef = &api.FilterRef{
+			Filter:     "clean-traffic",
+			Parameters: []api.FilterParameter{{Name: "IP", Value: "10.0.0.1"}},
+		}
+		mockConn.EXPECT().LookupNWFilterByName("clean-traffic").Return(nil, libvirt.Error{Code: libvirt.ERR_NO_NWFILTER})
+
+		Expect(manager.validateNetworkFilters(newVM("default", "testvm"), spec)).ToNot(Succeed())
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+})
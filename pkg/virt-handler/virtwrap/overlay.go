@@ -0,0 +1,95 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	diskimage "kubevirt.io/kubevirt/pkg/disk-image"
+	diskutils "kubevirt.io/kubevirt/pkg/ephemeral-disk-utils"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cache"
+)
+
+// Ephemeral disks are backed by a qcow2 overlay, the base image is never
+// written to. The overlays of a domain live in a directory of their own,
+// which is removed when the domain is undefined. qemu opens the overlays in
+// the libvirt pod, so they live in the libvirt data directory which both
+// pods share.
+var overlayRoot = "/var/lib/libvirt/kubevirt/overlays"
+var overlayOwner = "qemu"
+
+var createOverlay = diskimage.CreateOverlay
+
+func overlayDir(vm *v1.VirtualMachine) string {
+	return filepath.Join(overlayRoot, cache.VMNamespaceKeyFunc(vm))
+}
+
+// prepareOverlays creates fresh overlays for all ephemeral disks of the
+// domain and points the disks to them.
+func prepareOverlays(vm *v1.VirtualMachine, spec *api.DomainSpec) error {
+	if vm.Spec.Domain == nil {
+		return nil
+	}
+	for i, disk := range vm.Spec.Domain.Devices.Disks {
+		if !disk.Ephemeral {
+			continue
+		}
+		if disk.Type != "file" || disk.Source.File == "" {
+			return fmt.Errorf("ephemeral disk %s is not backed by a file", disk.Target.Device)
+		}
+
+		baseFormat := "raw"
+		if disk.Driver != nil && disk.Driver.Type != "" {
+			baseFormat = disk.Driver.Type
+		}
+
+		dir := overlayDir(vm)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		// Ephemeral disks always start from the base image
+		overlay := filepath.Join(dir, disk.Target.Device+".qcow2")
+		if err := diskutils.RemoveFile(overlay); err != nil {
+			return err
+		}
+		if err := createOverlay(disk.Source.File, baseFormat, overlay); err != nil {
+			return err
+		}
+		if err := diskutils.SetFileOwnership(overlayOwner, overlay); err != nil {
+			return err
+		}
+
+		spec.Devices.Disks[i].Source.File = overlay
+		if spec.Devices.Disks[i].Driver == nil {
+			spec.Devices.Disks[i].Driver = &api.DiskDriver{Name: "qemu"}
+		}
+		spec.Devices.Disks[i].Driver.Type = "qcow2"
+	}
+	return nil
+}
+
+// removeOverlays removes all overlays of the domain
+func removeOverlays(vm *v1.VirtualMachine) error {
+	return os.RemoveAll(overlayDir(vm))
+}
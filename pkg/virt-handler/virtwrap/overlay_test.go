@@ -0,0 +1,108 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+)
+
+var _ = Describe("Disk overlays", func() {
+	var tmpDir string
+	var originalOverlayRoot, originalOverlayOwner string
+	var originalCreateOverlay func(string, string, string) error
+	var vm *v1.VirtualMachine
+	var spec *api.DomainSpec
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "overlays")
+		Expect(err).ToNot(HaveOccurred())
+		owner, err := user.Current()
+		Expect(err).ToNot(HaveOccurred())
+
+		originalOverlayRoot = overlayRoot
+		originalOverlayOwner = overlayOwner
+		originalCreateOverlay = createOverlay
+		overlayRoot = tmpDir
+		overlayOwner = owner.Username
+		createOverlay = func(base string, baseFormat string, overlay string) error {
+			return ioutil.WriteFile(overlay, []byte(base+" "+baseFormat), 0644)
+		}
+
+		vm = newVM("default", "testvm")
+		vm.Spec.Domain.Devices.Disks = []v1.Disk{
+			{
+				Type:      "file",
+				Device:    "disk",
+				Source:    v1.DiskSource{File: "/images/base.raw"},
+				Target:    v1.DiskTarget{Device: "vda"},
+				Ephemeral: true,
+			},
+		}
+		spec = api.NewMinimalDomainSpec("default_testvm")
+		spec.Devices.Disks = []api.Disk{
+			{
+				Type:   "file",
+				Device: "disk",
+				Source: api.DiskSource{File: "/images/base.raw"},
+				Target: api.DiskTarget{Device: "vda"},
+			},
+		}
+	})
+
+	It("should point ephemeral disks to an overlay", func() {
+		Expect(prepareOverlays(vm, spec)).To(Succeed())
+
+		overlay := filepath.Join(tmpDir, "default_testvm", "vda.qcow2")
+		Expect(spec.Devices.Disks[0].Source.File).To(Equal(overlay))
+		Expect(spec.Devices.Disks[0].Driver.Type).To(Equal("qcow2"))
+		content, err := ioutil.ReadFile(overlay)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(content)).To(Equal("/images/base.raw raw"))
+	})
+
+	It("should remove the overlays of a domain", func() {
+		Expect(prepareOverlays(vm, spec)).To(Succeed())
+		Expect(removeOverlays(vm)).To(Succeed())
+		_, err := os.Stat(filepath.Join(tmpDir, "default_testvm"))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	It("should reject ephemeral disks which are not backed by a file", func() {
+		vm.Spec.Domain.Devices.Disks[0].Type = "network"
+		Expect(prepareOverlays(vm, spec)).ToNot(Succeed())
+	})
+
+	AfterEach(func() {
+		overlayRoot = originalOverlayRoot
+		overlayOwner = originalOverlayOwner
+		createOverlay = originalCreateOverlay
+		os.RemoveAll(tmpDir)
+	})
+})
@@ -0,0 +1,121 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"fmt"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+// perfEvents maps the supported perf events to their fields in the libvirt
+// parameters, the first one tells libvirt that the second one is set.
+var perfEvents = map[string]func(*libvirt.DomainPerfEvents) (*bool, *bool){
+	"cache_misses": func(e *libvirt.DomainPerfEvents) (*bool, *bool) {
+		return &e.CacheMissesSet, &e.CacheMisses
+	},
+	"cache_references": func(e *libvirt.DomainPerfEvents) (*bool, *bool) {
+		return &e.CacheReferencesSet, &e.CacheReferences
+	},
+	"instructions": func(e *libvirt.DomainPerfEvents) (*bool, *bool) {
+		return &e.InstructionsSet, &e.Instructions
+	},
+	"cpu_cycles": func(e *libvirt.DomainPerfEvents) (*bool, *bool) {
+		return &e.CpuCyclesSet, &e.CpuCycles
+	},
+	"branch_instructions": func(e *libvirt.DomainPerfEvents) (*bool, *bool) {
+		return &e.BranchInstructionsSet, &e.BranchInstructions
+	},
+	"branch_misses": func(e *libvirt.DomainPerfEvents) (*bool, *bool) {
+		return &e.BranchMissesSet, &e.BranchMisses
+	},
+}
+
+func wantedPerfEvents(vm *v1.VirtualMachine) (map[string]bool, error) {
+	wanted := map[string]bool{}
+	if vm.Spec.Domain == nil {
+		return wanted, nil
+	}
+	for _, event := range vm.Spec.Domain.PerfEvents {
+		if _, supported := perfEvents[event]; !supported {
+			return nil, fmt.Errorf("unsupported perf event %s", event)
+		}
+		wanted[event] = true
+	}
+	return wanted, nil
+}
+
+// preparePerfEvents enables the perf events of the VM in the domain spec.
+func preparePerfEvents(vm *v1.VirtualMachine, spec *api.DomainSpec) error {
+	wanted, err := wantedPerfEvents(vm)
+	if err != nil || len(wanted) == 0 {
+		return err
+	}
+	spec.Perf = &api.Perf{}
+	for _, event := range vm.Spec.Domain.PerfEvents {
+		spec.Perf.Events = append(spec.Perf.Events, api.PerfEvent{Name: event, Enabled: "yes"})
+	}
+	return nil
+}
+
+// syncPerfEvents enables and disables perf events of a running domain to
+// match the VM. It returns whether any event was changed.
+func (l *LibvirtDomainManager) syncPerfEvents(vm *v1.VirtualMachine, dom cli.VirDomain) (bool, error) {
+	wanted, err := wantedPerfEvents(vm)
+	if err != nil {
+		return false, err
+	}
+	current, err := dom.GetPerfEvents(libvirt.DOMAIN_AFFECT_LIVE)
+	if err != nil {
+		// Hosts without perf support can still run guests which don't need it
+		if len(wanted) == 0 {
+			return false, nil
+		}
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the perf events failed.")
+		return false, err
+	}
+
+	params := &libvirt.DomainPerfEvents{}
+	changed := false
+	for event, fields := range perfEvents {
+		_, enabled := fields(current)
+		set, enable := fields(params)
+		if *enabled != wanted[event] {
+			*set = true
+			*enable = wanted[event]
+			changed = true
+		}
+	}
+	if !changed {
+		return false, nil
+	}
+	err = dom.SetPerfEvents(params, libvirt.DOMAIN_AFFECT_LIVE)
+	l.audit(vm, TriggerVMController, "set-perf-events", wanted, err)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Setting the perf events failed.")
+		return false, err
+	}
+	logging.DefaultLogger().Object(vm).Info().Msg("Perf events updated.")
+	return true, nil
+}
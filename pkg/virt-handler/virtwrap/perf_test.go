@@ -0,0 +1,99 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Perf events", func() {
+	var ctrl *gomock.Controller
+	var mockDomain *cli.MockVirDomain
+	var manager *LibvirtDomainManager
+	var vm *v1.VirtualMachine
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockDomain = cli.NewMockVirDomain(ctrl)
+		manager = &LibvirtDomainManager{}
+		vm = newVM("default", "testvm")
+		vm.Spec.Domain.PerfEvents = []string{"cache_misses", "instructions"}
+	})
+
+	It("should enable the perf events in the domain spec", func() {
+		spec := api.NewMinimalDomainSpec("testvm")
+		Expect(preparePerfEvents(vm, spec)).To(Succeed())
+		Expect(spec.Perf.Events).To(Equal([]api.PerfEvent{
+			{Name: "cache_misses", Enabled: "yes"},
+			{Name: "instructions", Enabled: "yes"},
+		}))
+	})
+
+	It("should reject unsupported perf events", func() {
+		vm.Spec.Domain.PerfEvents = []string{"cmt"}
+		Expect(preparePerfEvents(vm, api.NewMinimalDomainSpec("testvm"))).ToNot(Succeed())
+	})
+
+	It("should only touch changed perf events of running domains", func() {
+		mockDomain.EXPECT().GetPerfEvents(libvirt.DOMAIN_AFFECT_LIVE).Return(&libvirt.DomainPerfEvents{
+			CacheMissesSet: true,
+			CacheMisses:    true,
+			CpuCyclesSet:   true,
+			CpuCycles:      true,
+		}, nil)
+		mockDomain.EXPECT().SetPerfEvents(&libvirt.DomainPerfEvents{
+			InstructionsSet: true,
+			Instructions:    true,
+			CpuCyclesSet:    true,
+			CpuCycles:       false,
+		}, libvirt.DOMAIN_AFFECT_LIVE).Return(nil)
+
+		Expect(manager.syncPerfEvents(vm, mockDomain)).To(BeTrue())
+	})
+
+	It("should leave matching perf events alone", func() {
+		mockDomain.EXPECT().GetPerfEvents(libvirt.DOMAIN_AFFECT_LIVE).Return(&libvirt.DomainPerfEvents{
+			CacheMissesSet:  true,
+			CacheMisses:     true,
+			InstructionsSet: true,
+			Instructions:    true,
+		}, nil)
+
+		Expect(manager.syncPerfEvents(vm, mockDomain)).To(BeFalse())
+	})
+
+	It("should ignore hosts without perf support if no events are wanted", func() {
+		vm.Spec.Domain.PerfEvents = nil
+		mockDomain.EXPECT().GetPerfEvents(libvirt.DOMAIN_AFFECT_LIVE).Return(nil, libvirt.Error{Code: libvirt.ERR_NO_SUPPORT})
+
+		Expect(manager.syncPerfEvents(vm, mockDomain)).To(BeFalse())
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+})
@@ -0,0 +1,183 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package virtwrap
+
+import (
+	"fmt"
+	"strings"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+)
+
+// DomainProfile holds defaults which depend on the qemu build of the host or
+// on the preferred machine type, e.g. the path of the emulator on RHEL or the
+// root ports q35 machines need for hotplug. Profiles only fill in what the
+// VM spec leaves open.
+type DomainProfile struct {
+	// Arch restricts the profile to guests of the architecture, empty means
+	// all architectures
+	Arch string
+	// Machine is the machine type of guests which don't ask for one
+	Machine string
+	// Emulator is the path of the qemu binary
+	Emulator string
+	// Controllers are added unless the guest has a controller of the same
+	// type and index. If the profile has a machine type, they are only added
+	// to guests of that machine type.
+	Controllers []api.Controller
+}
+
+var domainProfiles = map[string]DomainProfile{
+	"pc": {
+		Arch:    "x86_64",
+		Machine: "pc",
+	},
+	"q35": {
+		Arch:    "x86_64",
+		Machine: "q35",
+		Controllers: []api.Controller{
+			{Type: "usb", Index: "0", Model: "qemu-xhci"},
+			{Type: "pci", Index: "1", Model: "pcie-root-port"},
+			{Type: "pci", Index: "2", Model: "pcie-root-port"},
+			{Type: "pci", Index: "3", Model: "pcie-root-port"},
+			{Type: "pci", Index: "4", Model: "pcie-root-port"},
+		},
+	},
+	"upstream": {
+		Arch:     "x86_64",
+		Emulator: "/usr/bin/qemu-system-x86_64",
+	},
+	"rhel": {
+		Arch:     "x86_64",
+		Emulator: "/usr/libexec/qemu-kvm",
+	},
+}
+
+// The profiles of this host, in the order in which they are applied.
+var activeDomainProfiles []DomainProfile
+
+// RegisterDomainProfile makes a profile available under the name, replacing
+// a built-in profile of the same name.
+func RegisterDomainProfile(name string, profile DomainProfile) {
+	domainProfiles[name] = profile
+}
+
+// SetDomainProfiles selects the profiles of this host. They are applied in
+// order, so later profiles override the machine type and emulator of
+// earlier ones and add to their controllers, e.g. "q35,rhel".
+func SetDomainProfiles(names []string) error {
+	profiles := []DomainProfile{}
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		profile, exists := domainProfiles[name]
+		if !exists {
+			return fmt.Errorf("unknown domain profile %s", name)
+		}
+		profiles = append(profiles, profile)
+	}
+	activeDomainProfiles = profiles
+	return nil
+}
+
+// sameMachineFamily compares machine types without their versions, e.g. q35
+// and pc-q35-2.10 are both q35 machines and pc-i440fx-2.10 is a pc machine.
+func sameMachineFamily(machine string, other string) bool {
+	return machineFamily(machine) == machineFamily(other)
+}
+
+func machineFamily(machine string) string {
+	if strings.Contains(machine, "q35") {
+		return "q35"
+	}
+	if machine == "pc" || strings.HasPrefix(machine, "pc-") {
+		return "pc"
+	}
+	return machine
+}
+
+func controllerKey(controller api.Controller) string {
+	return controller.Type + "/" + controller.Index
+}
+
+// mergeDomainProfiles combines the profiles which apply to the architecture
+// into one.
+func mergeDomainProfiles(profiles []DomainProfile, arch string) DomainProfile {
+	merged := DomainProfile{Arch: arch}
+	positions := map[string]int{}
+	for _, profile := range profiles {
+		if profile.Arch != "" && profile.Arch != arch {
+			continue
+		}
+		if profile.Machine != "" {
+			merged.Machine = profile.Machine
+		}
+		if profile.Emulator != "" {
+			merged.Emulator = profile.Emulator
+		}
+		for _, controller := range profile.Controllers {
+			if i, exists := positions[controllerKey(controller)]; exists {
+				merged.Controllers[i] = controller
+				continue
+			}
+			positions[controllerKey(controller)] = len(merged.Controllers)
+			merged.Controllers = append(merged.Controllers, controller)
+		}
+	}
+	return merged
+}
+
+// applyDomainProfiles fills in the defaults of the active profiles. It runs
+// before the architecture is prepared, so that the machine type of a profile
+// is checked like one the VM asked for.
+func applyDomainProfiles(spec *api.DomainSpec) {
+	if len(activeDomainProfiles) == 0 {
+		return
+	}
+	arch := spec.OS.Type.Arch
+	if arch == "" {
+		arch = hostArch
+	}
+	profile := mergeDomainProfiles(activeDomainProfiles, arch)
+
+	if spec.OS.Type.Machine == "" {
+		spec.OS.Type.Machine = profile.Machine
+	}
+	if spec.Devices.Emulator == "" {
+		spec.Devices.Emulator = profile.Emulator
+	}
+
+	// Controllers like PCIe root ports only fit the machine of their profile
+	matching := []DomainProfile{}
+	for _, p := range activeDomainProfiles {
+		if p.Machine == "" || sameMachineFamily(p.Machine, spec.OS.Type.Machine) {
+			matching = append(matching, p)
+		}
+	}
+	existing := map[string]bool{}
+	for _, controller := range spec.Devices.Controllers {
+		existing[controllerKey(controller)] = true
+	}
+	for _, controller := range mergeDomainProfiles(matching, arch).Controllers {
+		if !existing[controllerKey(controller)] {
+			spec.Devices.Controllers = append(spec.Devices.Controllers, controller)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package virtwrap
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+)
+
+var _ = Describe("Domain profiles", func() {
+	var spec *api.DomainSpec
+	var originalHostArch string
+
+	BeforeEach(func() {
+		spec = api.NewMinimalDomainSpec("testvm")
+		originalHostArch = hostArch
+		hostArch = "x86_64"
+	})
+
+	It("should leave the domain alone without profiles", func() {
+		Expect(SetDomainProfiles(nil)).To(Succeed())
+		applyDomainProfiles(spec)
+		Expect(spec).To(Equal(api.NewMinimalDomainSpec("testvm")))
+	})
+
+	It("should refuse unknown profiles", func() {
+		Expect(SetDomainProfiles([]string{"q35", "unknown"})).ToNot(Succeed())
+	})
+
+	It("should combine profiles in order", func() {
+		Expect(SetDomainProfiles([]string{"pc", "q35", "rhel"})).To(Succeed())
+		applyDomainProfiles(spec)
+		Expect(spec.OS.Type.Machine).To(Equal("q35"))
+		Expect(spec.Devices.Emulator).To(Equal("/usr/libexec/qemu-kvm"))
+		Expect(spec.Devices.Controllers).To(HaveLen(5))
+	})
+
+	It("should not override the spec", func() {
+		Expect(SetDomainProfiles([]string{"q35"})).To(Succeed())
+		spec.OS.Type.Machine = "pc-q35-2.10"
+		spec.Devices.Controllers = []api.Controller{{Type: "usb", Index: "0", Model: "none"}}
+		applyDomainProfiles(spec)
+		Expect(spec.OS.Type.Machine).To(Equal("pc-q35-2.10"))
+		Expect(spec.Devices.Controllers[0]).To(Equal(api.Controller{Type: "usb", Index: "0", Model: "none"}))
+		Expect(spec.Devices.Controllers).To(HaveLen(5))
+	})
+
+	It("should only add controllers to guests of the machine type of the profile", func() {
+		Expect(SetDomainProfiles([]string{"q35", "rhel"})).To(Succeed())
+		spec.OS.Type.Machine = "pc-i440fx-2.10"
+		applyDomainProfiles(spec)
+		Expect(spec.OS.Type.Machine).To(Equal("pc-i440fx-2.10"))
+		Expect(spec.Devices.Emulator).To(Equal("/usr/libexec/qemu-kvm"))
+		Expect(spec.Devices.Controllers).To(BeEmpty())
+	})
+
+	It("should replace controllers of earlier profiles", func() {
+		merged := mergeDomainProfiles([]DomainProfile{
+			{Controllers: []api.Controller{{Type: "usb", Index: "0", Model: "piix3-uhci"}}},
+			{Controllers: []api.Controller{{Type: "usb", Index: "0", Model: "qemu-xhci"}}},
+		}, "x86_64")
+		Expect(merged.Controllers).To(Equal([]api.Controller{{Type: "usb", Index: "0", Model: "qemu-xhci"}}))
+	})
+
+	It("should skip profiles of other architectures", func() {
+		Expect(SetDomainProfiles([]string{"q35"})).To(Succeed())
+		spec.OS.Type.Arch = "aarch64"
+		applyDomainProfiles(spec)
+		Expect(spec.OS.Type.Machine).To(BeEmpty())
+		Expect(spec.Devices.Controllers).To(BeEmpty())
+	})
+
+	It("should use registered profiles", func() {
+		RegisterDomainProfile("custom", DomainProfile{Emulator: "/opt/qemu/bin/qemu-system-x86_64"})
+		defer delete(domainProfiles, "custom")
+		Expect(SetDomainProfiles([]string{"custom"})).To(Succeed())
+		applyDomainProfiles(spec)
+		Expect(spec.Devices.Emulator).To(Equal("/opt/qemu/bin/qemu-system-x86_64"))
+	})
+
+	AfterEach(func() {
+		activeDomainProfiles = nil
+		hostArch = originalHostArch
+	})
+})
@@ -0,0 +1,77 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package virtwrap
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+)
+
+// Option ROMs are loaded by qemu, which is confined to the ROM directories of
+// the distributions.
+var romDirs = []string{"/usr/share/ipxe", "/usr/lib/ipxe", "/usr/share/qemu"}
+
+func isInROMDir(file string) bool {
+	for _, dir := range romDirs {
+		if strings.HasPrefix(file, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// prepareNetworkBoot validates the option ROMs of the interfaces. Custom ROMs
+// have to be in a ROM directory and interfaces which should boot need their
+// ROM, since it provides the PXE client. The ROM directories are only there
+// in the libvirt pod, so whether the ROM exists is left to libvirt.
+func prepareNetworkBoot(spec *api.DomainSpec) error {
+	for i, iface := range spec.Devices.Interfaces {
+		rom := iface.ROM
+		if rom == nil {
+			continue
+		}
+		if rom.Enabled != "" && rom.Enabled != "yes" && rom.Enabled != "no" {
+			return fmt.Errorf("interface %d: invalid ROM state %s", i, rom.Enabled)
+		}
+		if rom.BAR != "" && rom.BAR != "on" && rom.BAR != "off" {
+			return fmt.Errorf("interface %d: invalid ROM bar %s", i, rom.BAR)
+		}
+		if rom.Enabled == "no" {
+			if iface.BootOrder != nil {
+				return fmt.Errorf("interface %d: can't boot without its ROM", i)
+			}
+			if rom.File != "" {
+				return fmt.Errorf("interface %d: a disabled ROM can't have a file", i)
+			}
+			continue
+		}
+		if rom.File == "" {
+			continue
+		}
+		file := filepath.Clean(rom.File)
+		if !filepath.IsAbs(file) || !isInROMDir(file) {
+			return fmt.Errorf("interface %d: ROM %s is not in one of %s", i, rom.File, strings.Join(romDirs, ", "))
+		}
+		rom.File = file
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package virtwrap
+
+import (
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+)
+
+var _ = Describe("Network boot", func() {
+	var spec *api.DomainSpec
+
+	BeforeEach(func() {
+		spec = api.NewMinimalDomainSpec("testvm")
+		spec.Devices.Interfaces[0].BootOrder = &api.BootOrder{Order: 1}
+	})
+
+	It("should boot from an interface with a custom ROM", func() {
+		spec.Devices.Interfaces[0].ROM = &api.InterfaceROM{File: "/usr/share/ipxe/./1af41000.rom"}
+		Expect(prepareNetworkBoot(spec)).To(Succeed())
+		Expect(spec.Devices.Interfaces[0].ROM.File).To(Equal("/usr/share/ipxe/1af41000.rom"))
+	})
+
+	It("should leave interfaces without ROM alone", func() {
+		Expect(prepareNetworkBoot(spec)).To(Succeed())
+		Expect(spec.Devices.Interfaces[0].ROM).To(BeNil())
+	})
+
+	table.DescribeTable("should reject", func(rom *api.InterfaceROM) {
+		spec.Devices.Interfaces[0].ROM = rom
+		Expect(prepareNetworkBoot(spec)).ToNot(Succeed())
+	},
+		table.Entry("booting from an interface without ROM", &api.InterfaceROM{Enabled: "no"}),
+		table.Entry("ROMs outside of the ROM directories", &api.InterfaceROM{File: "/usr/share/ipxe/../1af41000.rom"}),
+		table.Entry("relative ROM paths", &api.InterfaceROM{File: "usr/share/ipxe/1af41000.rom"}),
+		table.Entry("invalid ROM bars", &api.InterfaceROM{BAR: "maybe"}),
+	)
+})
@@ -0,0 +1,83 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"fmt"
+	"strings"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+)
+
+// qemu options which VMs may pass to qemu on their own. Arbitrary options
+// would allow to escape the confinement of the domain, so no option is
+// allowed unless the admin allows it for the host.
+var allowedQEMUArgs = map[string]bool{}
+
+// SetAllowedQEMUArgs sets the qemu options, e.g. "-global", which VMs may
+// pass to qemu.
+func SetAllowedQEMUArgs(options []string) {
+	allowedQEMUArgs = map[string]bool{}
+	for _, option := range options {
+		if option = strings.TrimSpace(option); option != "" {
+			allowedQEMUArgs[option] = true
+		}
+	}
+}
+
+// prepareQEMUArgs adds the qemu arguments of the VM to the commandline of
+// the domain. The arguments are pairs of an allowed option and its value,
+// anything else could smuggle options past the allowed ones.
+func prepareQEMUArgs(vm *v1.VirtualMachine, spec *api.DomainSpec) error {
+	if vm.Spec.Domain == nil || len(vm.Spec.Domain.QEMUArgs) == 0 {
+		return nil
+	}
+	args := vm.Spec.Domain.QEMUArgs
+	if err := validateQEMUArgs(args); err != nil {
+		return err
+	}
+
+	if spec.QEMUCmd == nil {
+		spec.QEMUCmd = &api.Commandline{}
+	}
+	for _, arg := range args {
+		spec.QEMUCmd.QEMUArg = append(spec.QEMUCmd.QEMUArg, api.Arg{Value: arg})
+	}
+	return nil
+}
+
+// validateQEMUArgs checks that the arguments are pairs of an allowed option
+// and its value.
+func validateQEMUArgs(args []string) error {
+	for i := 0; i < len(args); i += 2 {
+		option := args[i]
+		if !strings.HasPrefix(option, "-") {
+			return fmt.Errorf("qemu argument %s is not an option", option)
+		}
+		if !allowedQEMUArgs[option] {
+			return fmt.Errorf("qemu option %s is not allowed on this host", option)
+		}
+		if i+1 == len(args) || strings.HasPrefix(args[i+1], "-") {
+			return fmt.Errorf("qemu option %s has no value", option)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"encoding/xml"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+)
+
+var _ = Describe("qemu arguments", func() {
+
+	BeforeEach(func() {
+		SetAllowedQEMUArgs([]string{"-global", " -set"})
+	})
+
+	It("should append allowed arguments to the commandline", func() {
+		vm := newVM("default", "testvm")
+		vm.Spec.Domain.QEMUArgs = []string{"-global", "ICH9-LPC.noreboot=off"}
+		spec := api.NewMinimalDomainSpec("default_testvm")
+		spec.XmlNS = "http://libvirt.org/schemas/domain/qemu/1.0"
+		spec.QEMUCmd = &api.Commandline{QEMUEnv: []api.Env{{Name: "SLICE", Value: "dfd"}}}
+		Expect(prepareQEMUArgs(vm, spec)).To(Succeed())
+		Expect(spec.QEMUCmd.QEMUArg).To(Equal([]api.Arg{{Value: "-global"}, {Value: "ICH9-LPC.noreboot=off"}}))
+
+		buf, err := xml.Marshal(spec)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(buf)).To(ContainSubstring(`<qemu:commandline><qemu:arg value="-global"></qemu:arg><qemu:arg value="ICH9-LPC.noreboot=off"></qemu:arg><qemu:env name="SLICE" value="dfd"></qemu:env></qemu:commandline>`))
+	})
+
+	It("should reject options which are not allowed", func() {
+		vm := newVM("default", "testvm")
+		vm.Spec.Domain.QEMUArgs = []string{"-set", "device.net0.x=1", "-device", "pci-assign,host=01:00.0"}
+		Expect(prepareQEMUArgs(vm, api.NewMinimalDomainSpec("default_testvm"))).ToNot(Succeed())
+	})
+
+	It("should reject arguments which do not start with an option", func() {
+		vm := newVM("default", "testvm")
+		vm.Spec.Domain.QEMUArgs = []string{"ICH9-LPC.noreboot=off"}
+		Expect(prepareQEMUArgs(vm, api.NewMinimalDomainSpec("default_testvm"))).ToNot(Succeed())
+	})
+
+	It("should reject values which do not follow an option", func() {
+		vm := newVM("default", "testvm")
+		vm.Spec.Domain.QEMUArgs = []string{"-global", "ICH9-LPC.noreboot=off", "ICH9-LPC.disable_s3=1"}
+		Expect(prepareQEMUArgs(vm, api.NewMinimalDomainSpec("default_testvm"))).ToNot(Succeed())
+	})
+
+	It("should reject options without a value", func() {
+		vm := newVM("default", "testvm")
+		vm.Spec.Domain.QEMUArgs = []string{"-global", "-set", "device.net0.x=1"}
+		Expect(prepareQEMUArgs(vm, api.NewMinimalDomainSpec("default_testvm"))).ToNot(Succeed())
+	})
+
+	It("should reject all options by default", func() {
+		SetAllowedQEMUArgs(nil)
+		vm := newVM("default", "testvm")
+		vm.Spec.Domain.QEMUArgs = []string{"-global", "ICH9-LPC.noreboot=off"}
+		Expect(prepareQEMUArgs(vm, api.NewMinimalDomainSpec("default_testvm"))).ToNot(Succeed())
+	})
+
+	AfterEach(func() {
+		SetAllowedQEMUArgs(nil)
+	})
+})
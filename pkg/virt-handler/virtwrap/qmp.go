@@ -0,0 +1,105 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cache"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+// Commands sent behind the back of libvirt can easily confuse it about the
+// state of the domain, so only commands which query qemu or which don't touch
+// anything libvirt manages are allowed.
+var allowedQMPCommands = map[string]bool{
+	"query-status":               true,
+	"query-version":              true,
+	"query-migrate":              true,
+	"query-migrate-parameters":   true,
+	"query-migrate-capabilities": true,
+	"query-cpus-fast":            true,
+	"query-block":                true,
+	"query-blockstats":           true,
+	"query-memory-size-summary":  true,
+	"calc-dirty-rate":            true,
+	"query-dirty-rate":           true,
+}
+
+type qmpCommand struct {
+	Execute   string                 `json:"execute"`
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+}
+
+type qmpResponse struct {
+	Return json.RawMessage `json:"return"`
+	Error  *qmpError       `json:"error"`
+}
+
+type qmpError struct {
+	Class       string `json:"class"`
+	Description string `json:"desc"`
+}
+
+// QemuMonitorCommand sends an allowed QMP command to the qemu monitor of the
+// domain and returns the content of the "return" member of the reply.
+func (l *LibvirtDomainManager) QemuMonitorCommand(vm *v1.VirtualMachine, command string, arguments map[string]interface{}) (json.RawMessage, error) {
+	if !allowedQMPCommands[command] {
+		return nil, fmt.Errorf("qemu monitor command %s is not allowed", command)
+	}
+
+	dom, err := l.virConn.LookupDomainByName(cache.VMNamespaceKeyFunc(vm))
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain failed.")
+		return nil, err
+	}
+	defer dom.Free()
+
+	return qemuMonitorCommand(vm, dom, command, arguments)
+}
+
+// qemuMonitorCommand sends any QMP command to the qemu monitor of the domain,
+// callers have to make sure that it does not confuse libvirt.
+func qemuMonitorCommand(vm *v1.VirtualMachine, dom cli.VirDomain, command string, arguments map[string]interface{}) (json.RawMessage, error) {
+	request, err := json.Marshal(&qmpCommand{Execute: command, Arguments: arguments})
+	if err != nil {
+		return nil, err
+	}
+
+	logging.DefaultLogger().Object(vm).Info().V(3).Msgf("Sending qemu monitor command %s.", command)
+	reply, err := dom.QemuMonitorCommand(string(request), libvirt.DOMAIN_QEMU_MONITOR_COMMAND_DEFAULT)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msgf("Qemu monitor command %s failed.", command)
+		return nil, err
+	}
+
+	var response qmpResponse
+	if err := json.Unmarshal([]byte(reply), &response); err != nil {
+		return nil, fmt.Errorf("invalid reply to qemu monitor command %s: %v", command, err)
+	}
+	if response.Error != nil {
+		return nil, fmt.Errorf("qemu monitor command %s failed: %s: %s", command, response.Error.Class, response.Error.Description)
+	}
+	return response.Return, nil
+}
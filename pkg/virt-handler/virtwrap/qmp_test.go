@@ -0,0 +1,71 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Qemu monitor commands", func() {
+	var ctrl *gomock.Controller
+	var mockConn *cli.MockConnection
+	var mockDomain *cli.MockVirDomain
+	var manager *LibvirtDomainManager
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockConn = cli.NewMockConnection(ctrl)
+		mockDomain = cli.NewMockVirDomain(ctrl)
+		manager = &LibvirtDomainManager{virConn: mockConn}
+	})
+
+	It("should return the result of allowed commands", func() {
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+		mockDomain.EXPECT().QemuMonitorCommand(`{"execute":"calc-dirty-rate","arguments":{"calc-time":1}}`, libvirt.DOMAIN_QEMU_MONITOR_COMMAND_DEFAULT).Return(`{"return":{},"id":"libvirt-42"}`, nil)
+		mockDomain.EXPECT().Free()
+
+		result, err := manager.QemuMonitorCommand(newVM("default", "testvm"), "calc-dirty-rate", map[string]interface{}{"calc-time": 1})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(result)).To(Equal("{}"))
+	})
+
+	It("should reject commands which are not allowed", func() {
+		_, err := manager.QemuMonitorCommand(newVM("default", "testvm"), "quit", nil)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should return errors reported by qemu", func() {
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+		mockDomain.EXPECT().QemuMonitorCommand(`{"execute":"query-dirty-rate"}`, libvirt.DOMAIN_QEMU_MONITOR_COMMAND_DEFAULT).Return(`{"error":{"class":"CommandNotFound","desc":"The command query-dirty-rate has not been found"}}`, nil)
+		mockDomain.EXPECT().Free()
+
+		_, err := manager.QemuMonitorCommand(newVM("default", "testvm"), "query-dirty-rate", nil)
+		Expect(err).To(MatchError(ContainSubstring("CommandNotFound")))
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+})
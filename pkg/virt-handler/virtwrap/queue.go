@@ -0,0 +1,89 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"sync"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cache"
+)
+
+type domainOperation struct {
+	run  func() error
+	done chan error
+}
+
+// domainQueues run the operations on a domain one after another in the
+// order in which they were submitted, e.g. a define can't overtake the
+// destroy which was requested before it. Every domain with pending
+// operations gets its own worker goroutine, so that operations on different
+// domains run in parallel. The zero value is ready to use.
+type domainQueues struct {
+	lock    sync.Mutex
+	pending map[string][]domainOperation
+}
+
+// Run submits the operation to the queue of the domain and waits until it
+// was executed.
+func (d *domainQueues) Run(name string, run func() error) error {
+	done := make(chan error, 1)
+
+	d.lock.Lock()
+	if d.pending == nil {
+		d.pending = make(map[string][]domainOperation)
+	}
+	operations, working := d.pending[name]
+	d.pending[name] = append(operations, domainOperation{run: run, done: done})
+	if !working {
+		go d.work(name)
+	}
+	d.lock.Unlock()
+
+	return <-done
+}
+
+// work executes the operations of the domain until its queue is empty.
+func (d *domainQueues) work(name string) {
+	for {
+		d.lock.Lock()
+		operations := d.pending[name]
+		if len(operations) == 0 {
+			delete(d.pending, name)
+			d.lock.Unlock()
+			return
+		}
+		operation := operations[0]
+		d.pending[name] = operations[1:]
+		d.lock.Unlock()
+
+		operation.done <- operation.run()
+	}
+}
+
+// runOnDomain executes the operation in the queue of the domain of the VM,
+// while holding the domain lock.
+func (l *LibvirtDomainManager) runOnDomain(vm *v1.VirtualMachine, run func() error) error {
+	name := cache.VMNamespaceKeyFunc(vm)
+	return l.domainQueues.Run(name, func() error {
+		defer l.domainLocks.Lock(name)()
+		return run()
+	})
+}
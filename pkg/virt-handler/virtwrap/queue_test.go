@@ -0,0 +1,100 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Domain queues", func() {
+	var queues *domainQueues
+
+	BeforeEach(func() {
+		queues = &domainQueues{}
+	})
+
+	It("should execute the operations of a domain in order", func() {
+		started := make(chan struct{})
+		release := make(chan struct{})
+		order := []int{}
+		record := func(i int) func() error {
+			return func() error {
+				if i == 0 {
+					close(started)
+					<-release
+				}
+				// Only the worker of the domain appends
+				order = append(order, i)
+				return nil
+			}
+		}
+		pending := func() int {
+			queues.lock.Lock()
+			defer queues.lock.Unlock()
+			return len(queues.pending["default_testvm"])
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				queues.Run("default_testvm", record(i))
+			}(i)
+			// Submit one after another to get a defined order
+			if i == 0 {
+				Eventually(started).Should(BeClosed())
+			} else {
+				Eventually(pending).Should(Equal(i))
+			}
+		}
+
+		close(release)
+		wg.Wait()
+		Expect(order).To(Equal([]int{0, 1, 2, 3}))
+		Eventually(func() int {
+			queues.lock.Lock()
+			defer queues.lock.Unlock()
+			return len(queues.pending)
+		}).Should(BeZero())
+	})
+
+	It("should run operations of different domains in parallel", func() {
+		release := make(chan struct{})
+		done := make(chan struct{})
+		go queues.Run("default_testvm", func() error {
+			<-release
+			return nil
+		})
+		go func() {
+			queues.Run("default_othervm", func() error { return nil })
+			close(done)
+		}()
+		Eventually(done).Should(BeClosed())
+		close(release)
+	})
+
+	It("should return the result of the operation", func() {
+		Expect(queues.Run("default_testvm", func() error { return nil })).To(Succeed())
+	})
+})
@@ -0,0 +1,213 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	kubecache "k8s.io/client-go/tools/cache"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cache"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+// In read only mode virt-handler only observes the domains. Nothing which
+// would change a domain is attempted, since the connection to libvirt
+// refuses it anyway.
+var readOnly = false
+
+// SetReadOnly enables or disables the read only mode.
+func SetReadOnly(ro bool) {
+	readOnly = ro
+}
+
+// IsReadOnly returns whether virt-handler only observes the domains.
+func IsReadOnly() bool {
+	return readOnly
+}
+
+// ReconcileExistingGuests recovers the state of all domains which were
+// defined before virt-handler (re)started. Host devices of domains are
+// recorded as allocated again, and domains whose VM is gone, or was replaced
+// by a new VM with the same name, are removed. Adopted domains, which were
+// defined under an older naming convention, are renamed. Foreign domains
+// which match the adoption pattern are kept and watched instead of being
+// removed. Finally, PCI devices which were
+// left bound to vfio-pci are released, if enabled. Domains which can't be
+// reconciled are logged and skipped, only failing to list the domains is an
+// error. The guests are reconciled again after every reconnect to libvirt.
+// In read only mode only the host devices and adoptions are recorded. The
+// VM store has to be synced before this is called.
+func (l *LibvirtDomainManager) ReconcileExistingGuests(vmStore kubecache.Store) error {
+	if err := l.reconcileExistingGuests(vmStore); err != nil {
+		return err
+	}
+	return l.reconcileAfterReconnects(vmStore)
+}
+
+// reconcileAfterReconnects reconciles the existing guests again whenever the
+// connection to libvirt is reestablished, since libvirtd may have been
+// restarted and the domains may have changed meanwhile.
+func (l *LibvirtDomainManager) reconcileAfterReconnects(vmStore kubecache.Store) error {
+	return l.virConn.DomainEventLifecycleRegister(func(_ *libvirt.Connect, _ *libvirt.Domain, event *libvirt.DomainEventLifecycle) {
+		if event != nil {
+			return
+		}
+		// We are called with the connection lock held, register again once it is released
+		go func() {
+			if err := l.reconcileAfterReconnects(vmStore); err != nil {
+				logging.DefaultLogger().Error().Reason(err).Msg("Watching for libvirt reconnects failed.")
+			}
+			if err := l.reconcileExistingGuests(vmStore); err != nil {
+				logging.DefaultLogger().Error().Reason(err).Msg("Reconciling the existing domains after a reconnect failed.")
+			}
+		}()
+	})
+}
+
+func (l *LibvirtDomainManager) reconcileExistingGuests(vmStore kubecache.Store) error {
+	doms, err := l.virConn.ListAllDomains(libvirt.CONNECT_LIST_DOMAINS_ACTIVE | libvirt.CONNECT_LIST_DOMAINS_INACTIVE)
+	if err != nil {
+		logging.DefaultLogger().Error().Reason(err).Msg("Listing the domains failed.")
+		return err
+	}
+
+	// A single broken domain must not keep the others from being recovered,
+	// they get another chance on the next sync of their VM
+	orphans := []*v1.VirtualMachine{}
+	for _, dom := range doms {
+		vm, orphaned, err := l.reconcileExistingGuest(dom, vmStore)
+		dom.Free()
+		if err != nil {
+			logging.DefaultLogger().Error().Reason(err).Msg("Reconciling an existing domain failed, skipping it.")
+			continue
+		}
+		if orphaned {
+			orphans = append(orphans, vm)
+		}
+	}
+
+	if readOnly {
+		for _, vm := range orphans {
+			logging.DefaultLogger().Object(vm).Info().Msg("Leaving the orphaned domain alone, libvirt is read only.")
+		}
+		return nil
+	}
+
+	for _, vm := range orphans {
+		logging.DefaultLogger().Object(vm).Info().Msg("Removing orphaned domain.")
+		err := l.runOnDomain(vm, func() error {
+			return l.killVM(vm, TriggerStartup)
+		})
+		if err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Removing the orphaned domain failed.")
+		}
+	}
+
+	if releaseUnusedVFIODevices {
+		return l.releaseLeakedVFIODevices()
+	}
+	return nil
+}
+
+func (l *LibvirtDomainManager) reconcileExistingGuest(dom cli.VirDomain, vmStore kubecache.Store) (*v1.VirtualMachine, bool, error) {
+	domain, err := cache.NewDomain(dom)
+	if err != nil {
+		logging.DefaultLogger().Error().Reason(err).Msg("Reading the domain failed.")
+		return nil, false, err
+	}
+	spec, err := cache.NewDomainSpec(dom)
+	if err != nil {
+		logging.DefaultLogger().Object(domain).Error().Reason(err).Msg("Parsing the domain XML failed.")
+		return nil, false, err
+	}
+	metadata, err := GetMetadata(dom)
+	if err != nil {
+		logging.DefaultLogger().Object(domain).Error().Reason(err).Msg("Reading the domain metadata failed.")
+		return nil, false, err
+	}
+
+	vm := v1.NewVMReferenceFromNameWithNS(domain.ObjectMeta.Namespace, domain.ObjectMeta.Name)
+	vm.ObjectMeta.UID = metadata.UID
+	l.recordHostDevices(cache.VMNamespaceKeyFunc(vm), spec)
+
+	obj, exists, err := vmStore.GetByKey(domain.ObjectMeta.Namespace + "/" + domain.ObjectMeta.Name)
+	if err != nil {
+		return nil, false, err
+	}
+	if !exists {
+		if isForeignDomain(spec.Name, metadata) {
+			l.adoptDomain(vm, spec.Name)
+			return vm, false, nil
+		}
+		return vm, true, nil
+	}
+	// Domains without metadata were defined by an older virt-handler, we can
+	// only match them by name.
+	if metadata.UID != "" && obj.(*v1.VirtualMachine).GetObjectMeta().GetUID() != metadata.UID {
+		return vm, true, nil
+	}
+	if readOnly {
+		return vm, false, nil
+	}
+	// Domains may have been defined with autostart by hand or by an older
+	// virt-handler.
+	if err := l.disableAutostart(vm, dom, TriggerStartup); err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Disabling autostart of the domain failed.")
+		return nil, false, err
+	}
+	// Domains without a namespace in their name were defined by an older
+	// virt-handler.
+	if err := l.renameDomain(dom, spec.Name, vm, TriggerStartup); err != nil {
+		return nil, false, err
+	}
+	return vm, false, nil
+}
+
+// recordHostDevices marks the host devices of an existing domain as allocated,
+// so that they are given back to the host when the domain goes away.
+func (l *LibvirtDomainManager) recordHostDevices(domName string, spec *api.DomainSpec) {
+	l.cacheLock.Lock()
+	defer l.cacheLock.Unlock()
+
+	for _, hostDev := range spec.Devices.HostDevices {
+		var name string
+		switch hostDev.Type {
+		case "pci":
+			if hostDev.Managed != "no" {
+				continue
+			}
+			var err error
+			if name, err = pciNodeDeviceName(hostDev.Source.Address); err != nil {
+				continue
+			}
+		case "mdev":
+			if hostDev.Source.Address == nil || hostDev.Source.Address.UUID == "" {
+				continue
+			}
+			name = mdevNodeDeviceName(hostDev.Source.Address.UUID)
+		default:
+			continue
+		}
+		l.hostDeviceCache[name] = domName
+	}
+}
@@ -0,0 +1,288 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"encoding/xml"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Reconciling existing guests", func() {
+	var ctrl *gomock.Controller
+	var mockConn *cli.MockConnection
+	var recorder *record.FakeRecorder
+	var manager *LibvirtDomainManager
+	var vmStore cache.Store
+
+	expectDomain := func(name string, uid string, spec *api.DomainSpec) *cli.MockVirDomain {
+		dom := cli.NewMockVirDomain(ctrl)
+		domXML, err := xml.Marshal(spec)
+		Expect(err).ToNot(HaveOccurred())
+		dom.EXPECT().GetName().Return(name, nil)
+		dom.EXPECT().GetUUIDString().Return(uid, nil)
+		dom.EXPECT().GetXMLDesc(libvirt.DOMAIN_XML_MIGRATABLE).Return(string(domXML), nil)
+		dom.EXPECT().GetMetadata(libvirt.DOMAIN_METADATA_ELEMENT, api.KubeVirtMetadataURI, libvirt.DOMAIN_AFFECT_CONFIG).Return("<kubevirt><uid>"+uid+"</uid></kubevirt>", nil)
+		dom.EXPECT().Free()
+		return dom
+	}
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockConn = cli.NewMockConnection(ctrl)
+		recorder = record.NewFakeRecorder(10)
+		manager = &LibvirtDomainManager{
+			virConn:         mockConn,
+			recorder:        recorder,
+			secretCache:     make(map[string][]string),
+			hostDeviceCache: make(map[string]string),
+			adoptedDomains:  make(map[string]string),
+			pendingRenames:  make(map[string]string),
+			domainSpecs:     newDomainSpecCache(),
+		}
+		vmStore = cache.NewStore(cache.DeletionHandlingMetaNamespaceKeyFunc)
+		vm := newVM("default", "testvm")
+		vm.ObjectMeta.UID = "1234"
+		vmStore.Add(vm)
+		mockConn.EXPECT().DomainEventLifecycleRegister(gomock.Any()).AnyTimes().Return(nil)
+	})
+
+	It("should record the host devices of known domains", func() {
+		spec := api.NewMinimalDomainSpec("default_testvm")
+		spec.Devices.HostDevices = []api.HostDevice{
+			{
+				Mode:    "subsystem",
+				Type:    "pci",
+				Managed: "no",
+				Source:  api.HostDeviceSource{Address: &api.Address{Domain: "0x0000", Bus: "0x06", Slot: "0x02", Function: "0x0"}},
+			},
+		}
+		dom := expectDomain("default_testvm", "1234", spec)
+		dom.EXPECT().GetAutostart().Return(false, nil)
+		mockConn.EXPECT().ListAllDomains(libvirt.CONNECT_LIST_DOMAINS_ACTIVE|libvirt.CONNECT_LIST_DOMAINS_INACTIVE).Return([]cli.VirDomain{dom}, nil)
+
+		Expect(manager.ReconcileExistingGuests(vmStore)).To(Succeed())
+		Expect(manager.hostDeviceCache).To(Equal(map[string]string{"pci_0000_06_02_0": "default_testvm"}))
+		Expect(recorder.Events).To(BeEmpty())
+	})
+
+	It("should disable autostart of adopted domains", func() {
+		dom := expectDomain("default_testvm", "1234", api.NewMinimalDomainSpec("default_testvm"))
+		dom.EXPECT().GetAutostart().Return(true, nil)
+		dom.EXPECT().SetAutostart(false).Return(nil)
+		mockConn.EXPECT().ListAllDomains(libvirt.CONNECT_LIST_DOMAINS_ACTIVE|libvirt.CONNECT_LIST_DOMAINS_INACTIVE).Return([]cli.VirDomain{dom}, nil)
+
+		Expect(manager.ReconcileExistingGuests(vmStore)).To(Succeed())
+		Expect(recorder.Events).To(BeEmpty())
+	})
+
+	It("should rename adopted domains of an older naming convention", func() {
+		dom := expectDomain("testvm", "1234", api.NewMinimalDomainSpec("testvm"))
+		dom.EXPECT().GetAutostart().Return(false, nil)
+		dom.EXPECT().GetState().Return(libvirt.DOMAIN_SHUTOFF, 1, nil)
+		dom.EXPECT().Rename("default_testvm", uint32(0)).Return(nil)
+		mockConn.EXPECT().ListAllDomains(libvirt.CONNECT_LIST_DOMAINS_ACTIVE|libvirt.CONNECT_LIST_DOMAINS_INACTIVE).Return([]cli.VirDomain{dom}, nil)
+
+		Expect(manager.ReconcileExistingGuests(vmStore)).To(Succeed())
+		Expect(recorder.Events).To(BeEmpty())
+	})
+
+	It("should remove domains whose VM is gone or was replaced", func() {
+		gone := expectDomain("default_gone", "5678", api.NewMinimalDomainSpec("default_gone"))
+		replaced := expectDomain("default_testvm", "9012", api.NewMinimalDomainSpec("default_testvm"))
+		mockConn.EXPECT().ListAllDomains(libvirt.CONNECT_LIST_DOMAINS_ACTIVE|libvirt.CONNECT_LIST_DOMAINS_INACTIVE).Return([]cli.VirDomain{gone, replaced}, nil)
+
+		for _, name := range []string{"default_gone", "default_testvm"} {
+			dom := cli.NewMockVirDomain(ctrl)
+			mockConn.EXPECT().LookupDomainByName(name).Return(dom, nil)
+			dom.EXPECT().GetState().Return(libvirt.DOMAIN_SHUTOFF, 1, nil)
+			dom.EXPECT().UndefineFlags(libvirt.DOMAIN_UNDEFINE_KEEP_NVRAM).Return(nil)
+			dom.EXPECT().Free()
+		}
+
+		Expect(manager.ReconcileExistingGuests(vmStore)).To(Succeed())
+		Expect(recorder.Events).To(HaveLen(2))
+	})
+
+	It("should leave all domains alone if libvirt is read only", func() {
+		SetReadOnly(true)
+		defer SetReadOnly(false)
+		gone := expectDomain("default_gone", "5678", api.NewMinimalDomainSpec("default_gone"))
+		dom := expectDomain("testvm", "1234", api.NewMinimalDomainSpec("testvm"))
+		mockConn.EXPECT().ListAllDomains(libvirt.CONNECT_LIST_DOMAINS_ACTIVE|libvirt.CONNECT_LIST_DOMAINS_INACTIVE).Return([]cli.VirDomain{gone, dom}, nil)
+
+		Expect(manager.ReconcileExistingGuests(vmStore)).To(Succeed())
+		Expect(recorder.Events).To(BeEmpty())
+	})
+
+	It("should skip domains which can't be reconciled", func() {
+		broken := cli.NewMockVirDomain(ctrl)
+		broken.EXPECT().GetName().Return("", libvirt.Error{Code: libvirt.ERR_INTERNAL_ERROR})
+		broken.EXPECT().Free()
+		dom := expectDomain("default_testvm", "1234", api.NewMinimalDomainSpec("default_testvm"))
+		dom.EXPECT().GetAutostart().Return(true, nil)
+		dom.EXPECT().SetAutostart(false).Return(nil)
+		mockConn.EXPECT().ListAllDomains(libvirt.CONNECT_LIST_DOMAINS_ACTIVE|libvirt.CONNECT_LIST_DOMAINS_INACTIVE).Return([]cli.VirDomain{broken, dom}, nil)
+
+		Expect(manager.ReconcileExistingGuests(vmStore)).To(Succeed())
+	})
+
+	It("should keep going if an orphaned domain can't be removed", func() {
+		gone := expectDomain("default_gone", "5678", api.NewMinimalDomainSpec("default_gone"))
+		replaced := expectDomain("default_testvm", "9012", api.NewMinimalDomainSpec("default_testvm"))
+		mockConn.EXPECT().ListAllDomains(libvirt.CONNECT_LIST_DOMAINS_ACTIVE|libvirt.CONNECT_LIST_DOMAINS_INACTIVE).Return([]cli.VirDomain{gone, replaced}, nil)
+		mockConn.EXPECT().LookupDomainByName("default_gone").Return(nil, libvirt.Error{Code: libvirt.ERR_INTERNAL_ERROR})
+		dom := cli.NewMockVirDomain(ctrl)
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(dom, nil)
+		dom.EXPECT().GetState().Return(libvirt.DOMAIN_SHUTOFF, 1, nil)
+		dom.EXPECT().UndefineFlags(libvirt.DOMAIN_UNDEFINE_KEEP_NVRAM).Return(nil)
+		dom.EXPECT().Free()
+
+		Expect(manager.ReconcileExistingGuests(vmStore)).To(Succeed())
+	})
+
+	It("should fail if the domains can't be listed", func() {
+		mockConn.EXPECT().ListAllDomains(libvirt.CONNECT_LIST_DOMAINS_ACTIVE|libvirt.CONNECT_LIST_DOMAINS_INACTIVE).Return(nil, libvirt.Error{Code: libvirt.ERR_INTERNAL_ERROR})
+
+		Expect(manager.ReconcileExistingGuests(vmStore)).ToNot(Succeed())
+	})
+
+	It("should reconcile the existing domains again after a reconnect", func() {
+		var reconnected libvirt.DomainEventLifecycleCallback
+		mockConn = cli.NewMockConnection(ctrl)
+		manager.virConn = mockConn
+		mockConn.EXPECT().DomainEventLifecycleRegister(gomock.Any()).Do(func(callback libvirt.DomainEventLifecycleCallback) {
+			reconnected = callback
+		}).Times(2).Return(nil)
+		mockConn.EXPECT().ListAllDomains(libvirt.CONNECT_LIST_DOMAINS_ACTIVE|libvirt.CONNECT_LIST_DOMAINS_INACTIVE).Return([]cli.VirDomain{}, nil)
+		Expect(manager.ReconcileExistingGuests(vmStore)).To(Succeed())
+
+		listed := make(chan struct{})
+		mockConn.EXPECT().ListAllDomains(libvirt.CONNECT_LIST_DOMAINS_ACTIVE|libvirt.CONNECT_LIST_DOMAINS_INACTIVE).Do(func(_ libvirt.ConnectListAllDomainsFlags) {
+			close(listed)
+		}).Return([]cli.VirDomain{}, nil)
+		reconnected(nil, nil, nil)
+		Eventually(listed).Should(BeClosed())
+	})
+
+	Context("with adoption of foreign domains", func() {
+		BeforeEach(func() {
+			Expect(SetAdoptDomainPattern("legacy_*")).To(Succeed())
+		})
+
+		expectForeignDomain := func(name string) *cli.MockVirDomain {
+			dom := cli.NewMockVirDomain(ctrl)
+			domXML, err := xml.Marshal(api.NewMinimalDomainSpec(name))
+			Expect(err).ToNot(HaveOccurred())
+			dom.EXPECT().GetName().Return(name, nil)
+			dom.EXPECT().GetUUIDString().Return("5678", nil)
+			dom.EXPECT().GetXMLDesc(libvirt.DOMAIN_XML_MIGRATABLE).Return(string(domXML), nil)
+			dom.EXPECT().GetMetadata(libvirt.DOMAIN_METADATA_ELEMENT, api.KubeVirtMetadataURI, libvirt.DOMAIN_AFFECT_CONFIG).Return("", libvirt.Error{Code: libvirt.ERR_NO_DOMAIN_METADATA})
+			dom.EXPECT().Free()
+			return dom
+		}
+
+		It("should watch domains which were not defined by KubeVirt", func() {
+			dom := expectForeignDomain("legacy_db")
+			mockConn.EXPECT().ListAllDomains(libvirt.CONNECT_LIST_DOMAINS_ACTIVE|libvirt.CONNECT_LIST_DOMAINS_INACTIVE).Return([]cli.VirDomain{dom}, nil)
+
+			Expect(manager.ReconcileExistingGuests(vmStore)).To(Succeed())
+			vm := newVM("legacy", "db")
+			Expect(manager.IsAdopted(vm)).To(BeTrue())
+			Expect(manager.KillVM(vm)).To(Succeed())
+			_, err := manager.SyncVM(vm)
+			Expect(err).To(HaveOccurred())
+			Expect(recorder.Events).To(BeEmpty())
+		})
+
+		It("should remove domains without metadata which don't match the pattern", func() {
+			old := expectForeignDomain("other_db")
+			mockConn.EXPECT().ListAllDomains(libvirt.CONNECT_LIST_DOMAINS_ACTIVE|libvirt.CONNECT_LIST_DOMAINS_INACTIVE).Return([]cli.VirDomain{old}, nil)
+			dom := cli.NewMockVirDomain(ctrl)
+			mockConn.EXPECT().LookupDomainByName("other_db").Return(dom, nil)
+			dom.EXPECT().GetState().Return(libvirt.DOMAIN_SHUTOFF, 1, nil)
+			dom.EXPECT().UndefineFlags(libvirt.DOMAIN_UNDEFINE_KEEP_NVRAM).Return(nil)
+			dom.EXPECT().Free()
+
+			Expect(manager.ReconcileExistingGuests(vmStore)).To(Succeed())
+			Expect(manager.IsAdopted(newVM("other", "db"))).To(BeFalse())
+		})
+
+		It("should adopt foreign domains which were defined later", func() {
+			dom := cli.NewMockVirDomain(ctrl)
+			mockConn.EXPECT().LookupDomainByName("legacy_db").Return(dom, nil)
+			dom.EXPECT().GetMetadata(libvirt.DOMAIN_METADATA_ELEMENT, api.KubeVirtMetadataURI, libvirt.DOMAIN_AFFECT_CONFIG).Return("", libvirt.Error{Code: libvirt.ERR_NO_DOMAIN_METADATA})
+			dom.EXPECT().Free()
+
+			Expect(manager.IsAdopted(newVM("legacy", "db"))).To(BeTrue())
+			Expect(manager.adoptedDomains).To(Equal(map[string]string{"legacy_db": "legacy_db"}))
+		})
+
+		It("should not adopt domains defined by KubeVirt", func() {
+			dom := cli.NewMockVirDomain(ctrl)
+			mockConn.EXPECT().LookupDomainByName("legacy_db").Return(dom, nil)
+			dom.EXPECT().GetMetadata(libvirt.DOMAIN_METADATA_ELEMENT, api.KubeVirtMetadataURI, libvirt.DOMAIN_AFFECT_CONFIG).Return("<kubevirt><uid>5678</uid></kubevirt>", nil)
+			dom.EXPECT().Free()
+
+			Expect(manager.IsAdopted(newVM("legacy", "db"))).To(BeFalse())
+		})
+
+		It("should forget adopted domains once they are gone", func() {
+			manager.adoptedDomains["legacy_db"] = "legacy_db"
+			manager.forgetAdoptedDomain("legacy_db")
+			mockConn.EXPECT().LookupDomainByName("legacy_db").Return(nil, libvirt.Error{Code: libvirt.ERR_NO_DOMAIN})
+
+			Expect(manager.IsAdopted(newVM("legacy", "db"))).To(BeFalse())
+		})
+
+		It("should refuse invalid patterns", func() {
+			Expect(SetAdoptDomainPattern("legacy_[")).ToNot(Succeed())
+		})
+
+		It("should still remove domains of deleted VMs", func() {
+			gone := expectDomain("default_gone", "5678", api.NewMinimalDomainSpec("default_gone"))
+			mockConn.EXPECT().ListAllDomains(libvirt.CONNECT_LIST_DOMAINS_ACTIVE|libvirt.CONNECT_LIST_DOMAINS_INACTIVE).Return([]cli.VirDomain{gone}, nil)
+			dom := cli.NewMockVirDomain(ctrl)
+			mockConn.EXPECT().LookupDomainByName("default_gone").Return(dom, nil)
+			dom.EXPECT().GetState().Return(libvirt.DOMAIN_SHUTOFF, 1, nil)
+			dom.EXPECT().UndefineFlags(libvirt.DOMAIN_UNDEFINE_KEEP_NVRAM).Return(nil)
+			dom.EXPECT().Free()
+
+			Expect(manager.ReconcileExistingGuests(vmStore)).To(Succeed())
+			Expect(manager.IsAdopted(newVM("default", "gone"))).To(BeFalse())
+		})
+
+		AfterEach(func() {
+			Expect(SetAdoptDomainPattern("")).To(Succeed())
+		})
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+})
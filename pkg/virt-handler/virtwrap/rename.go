@@ -0,0 +1,171 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cache"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	domainerrors "kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/errors"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+// renameDomain gives a domain, which was defined under a different naming
+// convention, the name virt-handler expects for the VM. libvirt keeps the
+// UUID of the domain on renames, so everything which refers to the domain by
+// UUID, like the TPM state, stays valid. Only inactive domains can be
+// renamed, running ones keep their name until they are stopped. Postponed
+// renames are retried when the domain stops and whenever the VM is synced.
+func (l *LibvirtDomainManager) renameDomain(dom cli.VirDomain, oldName string, vm *v1.VirtualMachine, trigger Trigger) error {
+	newName := cache.VMNamespaceKeyFunc(vm)
+	if oldName == newName {
+		return nil
+	}
+
+	state, _, err := dom.GetState()
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain state failed.")
+		return err
+	}
+	if state != libvirt.DOMAIN_SHUTOFF {
+		logging.DefaultLogger().Object(vm).Info().Msgf("Domain %s is active, renaming it is postponed.", oldName)
+		l.cacheLock.Lock()
+		l.pendingRenames[newName] = oldName
+		l.cacheLock.Unlock()
+		return nil
+	}
+
+	err = dom.Rename(newName, 0)
+	l.audit(vm, trigger, "rename", newName, err)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msgf("Renaming domain %s failed.", oldName)
+		return err
+	}
+	logging.DefaultLogger().Object(vm).Info().Msgf("Domain %s renamed.", oldName)
+	l.renameBookkeeping(oldName, newName)
+	return nil
+}
+
+// finishPostponedRename renames the domain of the VM, if renaming it was
+// postponed. If the domain still runs under its old name, the spec of the
+// running domain is returned instead.
+func (l *LibvirtDomainManager) finishPostponedRename(vm *v1.VirtualMachine, trigger Trigger) (*api.DomainSpec, bool, error) {
+	newName := cache.VMNamespaceKeyFunc(vm)
+	l.cacheLock.Lock()
+	oldName, postponed := l.pendingRenames[newName]
+	l.cacheLock.Unlock()
+	if !postponed {
+		return nil, false, nil
+	}
+
+	dom, err := l.virConn.LookupDomainByName(oldName)
+	if err != nil {
+		if domainerrors.IsNotFound(err) {
+			l.forgetPostponedRename(newName)
+			return nil, false, nil
+		}
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msgf("Getting domain %s failed.", oldName)
+		return nil, false, err
+	}
+	defer dom.Free()
+
+	if err := l.renameDomain(dom, oldName, vm, trigger); err != nil {
+		return nil, false, err
+	}
+	l.cacheLock.Lock()
+	_, postponed = l.pendingRenames[newName]
+	l.cacheLock.Unlock()
+	if !postponed {
+		return nil, false, nil
+	}
+	spec, err := l.getDomainSpec(oldName, dom)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain spec failed.")
+		return nil, true, err
+	}
+	return spec, true, nil
+}
+
+func (l *LibvirtDomainManager) forgetPostponedRename(newName string) {
+	l.cacheLock.Lock()
+	defer l.cacheLock.Unlock()
+
+	delete(l.pendingRenames, newName)
+}
+
+// retryPostponedRename renames domains, whose rename was postponed, once they
+// are stopped.
+func (l *LibvirtDomainManager) retryPostponedRename(d *libvirt.Domain, event *libvirt.DomainEventLifecycle) {
+	if event.Event != libvirt.DOMAIN_EVENT_STOPPED {
+		return
+	}
+	oldName, err := d.GetName()
+	if err != nil {
+		return
+	}
+
+	l.cacheLock.Lock()
+	var vms []*v1.VirtualMachine
+	for newName, name := range l.pendingRenames {
+		if name == oldName {
+			vms = append(vms, v1.NewVMReferenceFromNameWithNS(cache.SplitVMNamespaceKey(newName)))
+		}
+	}
+	l.cacheLock.Unlock()
+
+	for _, vm := range vms {
+		vm := vm
+		// We are called with the connection lock held, rename once it is released
+		go func() {
+			err := l.runOnDomain(vm, func() error {
+				_, _, err := l.finishPostponedRename(vm, TriggerLibvirtEvent)
+				return err
+			})
+			if err != nil {
+				logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Renaming the stopped domain failed.")
+			}
+		}()
+	}
+}
+
+// renameBookkeeping moves everything we track per domain name over to the new
+// name of the domain.
+func (l *LibvirtDomainManager) renameBookkeeping(oldName string, newName string) {
+	l.cacheLock.Lock()
+	defer l.cacheLock.Unlock()
+
+	delete(l.pendingRenames, newName)
+
+	if secretUUIDs, exists := l.secretCache[oldName]; exists {
+		l.secretCache[newName] = append(l.secretCache[newName], secretUUIDs...)
+		delete(l.secretCache, oldName)
+	}
+
+	for name, owner := range l.hostDeviceCache {
+		if owner == oldName {
+			l.hostDeviceCache[name] = newName
+		}
+	}
+
+	l.domainSpecs.invalidate(oldName)
+	l.domainSpecs.invalidate(newName)
+}
@@ -0,0 +1,112 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Renaming domains", func() {
+	var ctrl *gomock.Controller
+	var mockConn *cli.MockConnection
+	var mockDomain *cli.MockVirDomain
+	var manager *LibvirtDomainManager
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockConn = cli.NewMockConnection(ctrl)
+		mockDomain = cli.NewMockVirDomain(ctrl)
+		manager = &LibvirtDomainManager{
+			virConn:         mockConn,
+			secretCache:     map[string][]string{"testvm": {"secret-uuid"}},
+			hostDeviceCache: map[string]string{"pci_0000_06_02_0": "testvm", "pci_0000_06_03_0": "default_othervm"},
+			pendingRenames:  make(map[string]string),
+			domainSpecs:     newDomainSpecCache(),
+		}
+	})
+
+	It("should rename inactive domains and move their bookkeeping", func() {
+		mockDomain.EXPECT().GetState().Return(libvirt.DOMAIN_SHUTOFF, 1, nil)
+		mockDomain.EXPECT().Rename("default_testvm", uint32(0)).Return(nil)
+
+		Expect(manager.renameDomain(mockDomain, "testvm", newVM("default", "testvm"), TriggerVMController)).To(Succeed())
+		Expect(manager.secretCache).To(Equal(map[string][]string{"default_testvm": {"secret-uuid"}}))
+		Expect(manager.hostDeviceCache).To(Equal(map[string]string{"pci_0000_06_02_0": "default_testvm", "pci_0000_06_03_0": "default_othervm"}))
+	})
+
+	It("should postpone renaming active domains", func() {
+		mockDomain.EXPECT().GetState().Return(libvirt.DOMAIN_RUNNING, 1, nil)
+
+		Expect(manager.renameDomain(mockDomain, "testvm", newVM("default", "testvm"), TriggerVMController)).To(Succeed())
+		Expect(manager.hostDeviceCache["pci_0000_06_02_0"]).To(Equal("testvm"))
+		Expect(manager.pendingRenames).To(Equal(map[string]string{"default_testvm": "testvm"}))
+	})
+
+	It("should rename domains once they stopped", func() {
+		manager.pendingRenames["default_testvm"] = "testvm"
+		mockConn.EXPECT().LookupDomainByName("testvm").Return(mockDomain, nil)
+		mockDomain.EXPECT().GetState().Return(libvirt.DOMAIN_SHUTOFF, 1, nil)
+		mockDomain.EXPECT().Rename("default_testvm", uint32(0)).Return(nil)
+		mockDomain.EXPECT().Free()
+
+		spec, postponed, err := manager.finishPostponedRename(newVM("default", "testvm"), TriggerVMController)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(postponed).To(BeFalse())
+		Expect(spec).To(BeNil())
+		Expect(manager.pendingRenames).To(BeEmpty())
+	})
+
+	It("should keep running domains under their old name", func() {
+		manager.pendingRenames["default_testvm"] = "testvm"
+		mockConn.EXPECT().LookupDomainByName("testvm").Return(mockDomain, nil)
+		mockDomain.EXPECT().GetState().Return(libvirt.DOMAIN_RUNNING, 1, nil)
+		mockDomain.EXPECT().GetXMLDesc(gomock.Any()).Return("<domain><name>testvm</name></domain>", nil)
+		mockDomain.EXPECT().Free()
+
+		spec, postponed, err := manager.finishPostponedRename(newVM("default", "testvm"), TriggerVMController)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(postponed).To(BeTrue())
+		Expect(spec.Name).To(Equal("testvm"))
+		Expect(manager.pendingRenames).To(Equal(map[string]string{"default_testvm": "testvm"}))
+	})
+
+	It("should forget postponed renames of domains which are gone", func() {
+		manager.pendingRenames["default_testvm"] = "testvm"
+		mockConn.EXPECT().LookupDomainByName("testvm").Return(nil, libvirt.Error{Code: libvirt.ERR_NO_DOMAIN})
+
+		_, postponed, err := manager.finishPostponedRename(newVM("default", "testvm"), TriggerVMController)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(postponed).To(BeFalse())
+		Expect(manager.pendingRenames).To(BeEmpty())
+	})
+
+	It("should leave domains with the expected name alone", func() {
+		Expect(manager.renameDomain(mockDomain, "default_testvm", newVM("default", "testvm"), TriggerVMController)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+})
@@ -0,0 +1,68 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"fmt"
+	"os"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+)
+
+const defaultRngSource = "/dev/urandom"
+
+var allowedRngSources = map[string]bool{
+	"/dev/random":  true,
+	"/dev/urandom": true,
+	"/dev/hwrng":   true,
+}
+
+// prepareRandomGenerator fills in the defaults of the rng device and makes
+// sure that the chosen entropy source exists on the host.
+func prepareRandomGenerator(spec *api.DomainSpec) error {
+	rng := spec.Devices.Rng
+	if rng == nil {
+		return nil
+	}
+
+	if rng.Model == "" {
+		rng.Model = "virtio"
+	}
+	if rng.Backend.Model == "" {
+		rng.Backend.Model = "random"
+	}
+	if rng.Backend.Source == "" {
+		rng.Backend.Source = defaultRngSource
+	}
+
+	if rng.Backend.Model != "random" {
+		return fmt.Errorf("unsupported rng backend model %s", rng.Backend.Model)
+	}
+	if !allowedRngSources[rng.Backend.Source] {
+		return fmt.Errorf("unsupported rng source %s", rng.Backend.Source)
+	}
+	if _, err := os.Stat(rng.Backend.Source); err != nil {
+		return fmt.Errorf("rng source %s is not available on the host: %v", rng.Backend.Source, err)
+	}
+	if rng.Rate != nil && rng.Rate.Bytes == 0 {
+		return fmt.Errorf("rng rate limit must allow at least one byte")
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+)
+
+var _ = Describe("Random generator", func() {
+
+	It("should default to virtio with /dev/urandom", func() {
+		spec := api.NewMinimalDomainSpec("testvm")
+		spec.Devices.Rng = &api.RandomGenerator{}
+		Expect(prepareRandomGenerator(spec)).To(Succeed())
+		Expect(*spec.Devices.Rng).To(Equal(api.RandomGenerator{
+			Model:   "virtio",
+			Backend: api.RngBackend{Model: "random", Source: "/dev/urandom"},
+		}))
+	})
+
+	It("should reject sources which are no entropy sources", func() {
+		spec := api.NewMinimalDomainSpec("testvm")
+		spec.Devices.Rng = &api.RandomGenerator{Backend: api.RngBackend{Source: "/etc/passwd"}}
+		Expect(prepareRandomGenerator(spec)).ToNot(Succeed())
+	})
+
+	It("should reject an empty rate limit", func() {
+		spec := api.NewMinimalDomainSpec("testvm")
+		spec.Devices.Rng = &api.RandomGenerator{Rate: &api.RngRate{Period: 1000}}
+		Expect(prepareRandomGenerator(spec)).ToNot(Succeed())
+	})
+
+	It("should ignore domains without rng device", func() {
+		Expect(prepareRandomGenerator(api.NewMinimalDomainSpec("testvm"))).To(Succeed())
+	})
+})
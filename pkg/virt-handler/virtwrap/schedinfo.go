@@ -0,0 +1,87 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package virtwrap
+
+import (
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cache"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+)
+
+// GetCPUStats returns the CPU time the guest used. The difference between
+// the total and the vCPU time is the overhead of the emulator, which is
+// accounted against the cgroup of the virt-launcher Pod.
+func (l *LibvirtDomainManager) GetCPUStats(vm *v1.VirtualMachine) (*cli.CPUStats, error) {
+	dom, err := l.virConn.LookupDomainByName(cache.VMNamespaceKeyFunc(vm))
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain failed.")
+		return nil, err
+	}
+	defer dom.Free()
+
+	stats, err := cli.GetCPUStats(dom)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the CPU stats failed.")
+		return nil, err
+	}
+	return stats, nil
+}
+
+// GetSchedulerTuning returns the CFS parameters of the running guest.
+func (l *LibvirtDomainManager) GetSchedulerTuning(vm *v1.VirtualMachine) (*cli.SchedulerTuning, error) {
+	dom, err := l.virConn.LookupDomainByName(cache.VMNamespaceKeyFunc(vm))
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain failed.")
+		return nil, err
+	}
+	defer dom.Free()
+
+	tuning, err := cli.GetSchedulerTuning(dom)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the scheduler parameters failed.")
+		return nil, err
+	}
+	return tuning, nil
+}
+
+// TuneScheduler changes the CFS parameters of the running guest, e.g. to
+// constrain the emulator threads with an emulator quota.
+func (l *LibvirtDomainManager) TuneScheduler(vm *v1.VirtualMachine, tuning *cli.SchedulerTuning, trigger Trigger) error {
+	if err := tuning.Validate(); err != nil {
+		return err
+	}
+	return l.runOnDomain(vm, func() error {
+		dom, err := l.virConn.LookupDomainByName(cache.VMNamespaceKeyFunc(vm))
+		if err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain failed.")
+			return err
+		}
+		defer dom.Free()
+
+		err = cli.SetSchedulerTuning(dom, tuning)
+		l.audit(vm, trigger, "set-scheduler-parameters", tuning, err)
+		if err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Setting the scheduler parameters failed.")
+			return err
+		}
+		logging.DefaultLogger().Object(vm).Info().Msg("Scheduler parameters changed.")
+		return nil
+	})
+}
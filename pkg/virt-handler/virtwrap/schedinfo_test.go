@@ -0,0 +1,73 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package virtwrap
+
+import (
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Scheduler tuning", func() {
+	var ctrl *gomock.Controller
+	var mockConn *cli.MockConnection
+	var mockDomain *cli.MockVirDomain
+	var manager *LibvirtDomainManager
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockConn = cli.NewMockConnection(ctrl)
+		mockDomain = cli.NewMockVirDomain(ctrl)
+		manager = &LibvirtDomainManager{virConn: mockConn}
+	})
+
+	It("should throttle the emulator threads of a running guest", func() {
+		quota := int64(20000)
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+		mockDomain.EXPECT().SetSchedulerParametersFlags(&libvirt.DomainSchedulerParameters{
+			EmulatorQuotaSet: true,
+			EmulatorQuota:    20000,
+		}, libvirt.DOMAIN_AFFECT_LIVE).Return(nil)
+		mockDomain.EXPECT().Free()
+		Expect(manager.TuneScheduler(newVM("default", "testvm"), &cli.SchedulerTuning{EmulatorQuota: &quota}), TriggerVMController).To(Succeed())
+	})
+
+	It("should reject invalid parameters without touching the domain", func() {
+		quota := int64(1)
+		Expect(manager.TuneScheduler(newVM("default", "testvm"), &cli.SchedulerTuning{EmulatorQuota: &quota}), TriggerVMController).ToNot(Succeed())
+	})
+
+	It("should report the CPU time of the guest", func() {
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+		mockDomain.EXPECT().GetCPUStats(-1, uint(1), uint32(0)).Return([]libvirt.DomainCPUStats{
+			{CpuTimeSet: true, CpuTime: 3000, VcpuTimeSet: true, VcpuTime: 2000},
+		}, nil)
+		mockDomain.EXPECT().Free()
+		stats, err := manager.GetCPUStats(newVM("default", "testvm"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stats.Total - stats.VCPU).To(Equal(uint64(1000)))
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+})
@@ -0,0 +1,169 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+const secretHashPrefix = "hmac-sha256:"
+
+// The key the value hashes in the secret descriptions are keyed with. It is
+// generated once per host and never leaves it, so that the descriptions,
+// which can be read by anyone with access to libvirt, don't allow guessing
+// the values offline.
+var secretKeyFile = "/var/lib/kubevirt/secret-description.key"
+
+const secretKeySize = 32
+
+// loadSecretKey reads the key for the secret descriptions, or generates it
+// if this host does not have one yet.
+func loadSecretKey() ([]byte, error) {
+	key, err := ioutil.ReadFile(secretKeyFile)
+	if err == nil {
+		if len(key) != secretKeySize {
+			return nil, fmt.Errorf("invalid secret description key in %s", secretKeyFile)
+		}
+		return key, nil
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key = make([]byte, secretKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(secretKeyFile), 0755); err != nil {
+		return nil, err
+	}
+	tmpFile := secretKeyFile + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, key, 0600); err != nil {
+		return nil, err
+	}
+	return key, os.Rename(tmpFile, secretKeyFile)
+}
+
+// secretUsageTypes maps the usage types we define secrets for to their libvirt
+// counterpart. iscsi and ceph secrets hold the credentials of a network disk,
+// volume secrets the LUKS passphrase of a disk, tls secrets the passphrase of
+// the migration TLS key and vtpm secrets the key the swtpm state is encrypted
+// with.
+var secretUsageTypes = map[string]libvirt.SecretUsageType{
+	"iscsi":  libvirt.SECRET_USAGE_TYPE_ISCSI,
+	"ceph":   libvirt.SECRET_USAGE_TYPE_CEPH,
+	"volume": libvirt.SECRET_USAGE_TYPE_VOLUME,
+	"tls":    libvirt.SECRET_USAGE_TYPE_TLS,
+	"vtpm":   libvirt.SECRET_USAGE_TYPE_VTPM,
+}
+
+// iSCSI secrets are identified by their target, volume secrets by their
+// volume and all other usage types by a free form name.
+func newSecretUsage(usageType string, usageID string) api.SecretUsage {
+	switch usageType {
+	case "iscsi":
+		return api.SecretUsage{Type: usageType, Target: usageID}
+	case "volume":
+		return api.SecretUsage{Type: usageType, Volume: usageID}
+	}
+	return api.SecretUsage{Type: usageType, Name: usageID}
+}
+
+// lookupSecretUUID resolves the UUID of the secret with the given usage.
+// Devices like the TPM can't reference secrets by their usage, only by UUID.
+func (l *LibvirtDomainManager) lookupSecretUUID(usageType string, usageID string) (string, error) {
+	libvirtUsageType, supported := secretUsageTypes[usageType]
+	if !supported {
+		return "", fmt.Errorf("unsupported secret usage type %s", usageType)
+	}
+	secret, err := l.virConn.LookupSecretByUsage(libvirtUsageType, usageID)
+	if err != nil {
+		return "", err
+	}
+	defer secret.Free()
+	return secret.GetUUIDString()
+}
+
+// The values of private secrets can't be read back from libvirt. To know
+// whether a value has to be set again, the description of the secrets we
+// define holds a keyed hash of the value next to the name of the domain they
+// belong to.
+func secretDescription(key []byte, domName string, value string) string {
+	return domName + " " + secretHashPrefix + secretValueHash(key, value)
+}
+
+// parseSecretDescription returns the domain name and the value hash of a
+// secret description. Secrets defined before the hash was recorded only
+// have the domain name in their description, secrets with an unkeyed hash
+// are treated the same, so that their value and description get replaced.
+func parseSecretDescription(description string) (domName string, valueHash string) {
+	fields := strings.Fields(description)
+	if len(fields) == 0 {
+		return "", ""
+	}
+	if len(fields) > 1 && strings.HasPrefix(fields[1], secretHashPrefix) {
+		valueHash = strings.TrimPrefix(fields[1], secretHashPrefix)
+	}
+	return fields[0], valueHash
+}
+
+func secretValueHash(key []byte, value string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// redefineChangedSecret records the hash of the new value in the description
+// of the secret and returns the updated secret. If the value did not change,
+// nil is returned. The passed in secret is always freed.
+func (l *LibvirtDomainManager) redefineChangedSecret(secret cli.VirSecret, domName string, value string) (cli.VirSecret, error) {
+	defer secret.Free()
+
+	xmlStr, err := secret.GetXMLDesc(0)
+	if err != nil {
+		return nil, err
+	}
+	var spec api.SecretSpec
+	if err := xml.Unmarshal([]byte(xmlStr), &spec); err != nil {
+		return nil, err
+	}
+	if _, valueHash := parseSecretDescription(spec.Description); hmac.Equal([]byte(valueHash), []byte(secretValueHash(l.secretKey, value))) {
+		return nil, nil
+	}
+
+	spec.Description = secretDescription(l.secretKey, domName, value)
+	newXMLStr, err := xml.Marshal(&spec)
+	if err != nil {
+		return nil, err
+	}
+	return l.virConn.SecretDefineXML(string(newXMLStr))
+}
@@ -0,0 +1,177 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Secrets", func() {
+	var ctrl *gomock.Controller
+	var mockConn *cli.MockConnection
+	var mockSecret *cli.MockVirSecret
+	var manager *LibvirtDomainManager
+	secretKey := []byte("0123456789abcdef0123456789abcdef")
+
+	secretXML := func(description string) string {
+		x, err := xml.Marshal(&api.SecretSpec{
+			Ephemeral:   "no",
+			Private:     "yes",
+			UUID:        "5b5f3b8e-7c2d-4b6a-9f51-3c1f0e8f5a11",
+			Description: description,
+			Usage:       api.SecretUsage{Type: "iscsi", Target: "testusage"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		return string(x)
+	}
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockConn = cli.NewMockConnection(ctrl)
+		mockSecret = cli.NewMockVirSecret(ctrl)
+		manager = &LibvirtDomainManager{
+			virConn:     mockConn,
+			secretCache: make(map[string][]string),
+			secretKey:   secretKey,
+		}
+	})
+
+	It("should parse old and new secret descriptions", func() {
+		domName, valueHash := parseSecretDescription("default_testvm")
+		Expect(domName).To(Equal("default_testvm"))
+		Expect(valueHash).To(BeEmpty())
+
+		domName, valueHash = parseSecretDescription(secretDescription(secretKey, "default_testvm", "password"))
+		Expect(domName).To(Equal("default_testvm"))
+		Expect(valueHash).To(Equal(secretValueHash(secretKey, "password")))
+	})
+
+	It("should not put the plain hash of the value into the description", func() {
+		Expect(secretValueHash(secretKey, "password")).ToNot(Equal(secretValueHash([]byte("another key"), "password")))
+		Expect(secretDescription(secretKey, "default_testvm", "password")).ToNot(ContainSubstring(
+			"5e884898da28047151d0e56f8dc6292773603d0d6aabbdd62a11ef721d1542d8"))
+	})
+
+	It("should keep the secret description key of the host", func() {
+		tmpDir, err := ioutil.TempDir("", "secrets")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(tmpDir)
+		originalSecretKeyFile := secretKeyFile
+		defer func() { secretKeyFile = originalSecretKeyFile }()
+		secretKeyFile = filepath.Join(tmpDir, "secret-description.key")
+
+		key, err := loadSecretKey()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(key).To(HaveLen(secretKeySize))
+		info, err := os.Stat(secretKeyFile)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+
+		reloaded, err := loadSecretKey()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(reloaded).To(Equal(key))
+	})
+
+	It("should define missing secrets with the hash of their value", func() {
+		mockConn.EXPECT().LookupSecretByUsage(libvirt.SECRET_USAGE_TYPE_ISCSI, "testusage").Return(nil, libvirt.Error{Code: libvirt.ERR_NO_SECRET})
+		mockConn.EXPECT().SecretDefineXML(gomock.Any()).Do(func(xmlStr string) {
+			var spec api.SecretSpec
+			Expect(xml.Unmarshal([]byte(xmlStr), &spec)).To(Succeed())
+			Expect(spec.Description).To(Equal(secretDescription(secretKey, "default_testvm", "password")))
+		}).Return(mockSecret, nil)
+		mockSecret.EXPECT().GetUUIDString().Return("5b5f3b8e-7c2d-4b6a-9f51-3c1f0e8f5a11", nil)
+		mockSecret.EXPECT().SetValue([]byte("password"), uint32(0)).Return(nil)
+		mockSecret.EXPECT().Free()
+
+		Expect(manager.SyncVMSecret(newVM("default", "testvm"), "iscsi", "testusage", "password")).To(Succeed())
+		Expect(manager.secretCache["default_testvm"]).To(HaveLen(1))
+	})
+
+	It("should not touch secrets whose value did not change", func() {
+		mockConn.EXPECT().LookupSecretByUsage(libvirt.SECRET_USAGE_TYPE_ISCSI, "testusage").Return(mockSecret, nil)
+		mockSecret.EXPECT().GetXMLDesc(uint32(0)).Return(secretXML(secretDescription(secretKey, "default_testvm", "password")), nil)
+		mockSecret.EXPECT().Free()
+
+		Expect(manager.SyncVMSecret(newVM("default", "testvm"), "iscsi", "testusage", "password")).To(Succeed())
+	})
+
+	It("should update secrets whose value changed", func() {
+		updatedSecret := cli.NewMockVirSecret(ctrl)
+		mockConn.EXPECT().LookupSecretByUsage(libvirt.SECRET_USAGE_TYPE_ISCSI, "testusage").Return(mockSecret, nil)
+		mockSecret.EXPECT().GetXMLDesc(uint32(0)).Return(secretXML("default_testvm sha256:5e884898da28047151d0e56f8dc6292773603d0d6aabbdd62a11ef721d1542d8"), nil)
+		mockSecret.EXPECT().Free()
+		mockConn.EXPECT().SecretDefineXML(secretXML(secretDescription(secretKey, "default_testvm", "password"))).Return(updatedSecret, nil)
+		updatedSecret.EXPECT().SetValue([]byte("password"), uint32(0)).Return(nil)
+		updatedSecret.EXPECT().Free()
+
+		Expect(manager.SyncVMSecret(newVM("default", "testvm"), "iscsi", "testusage", "password")).To(Succeed())
+	})
+
+	It("should identify tls and vtpm secrets by name", func() {
+		mockConn.EXPECT().LookupSecretByUsage(libvirt.SECRET_USAGE_TYPE_TLS, "migration").Return(nil, libvirt.Error{Code: libvirt.ERR_NO_SECRET})
+		mockConn.EXPECT().SecretDefineXML(gomock.Any()).Do(func(xmlStr string) {
+			var spec api.SecretSpec
+			Expect(xml.Unmarshal([]byte(xmlStr), &spec)).To(Succeed())
+			Expect(spec.Usage).To(Equal(api.SecretUsage{Type: "tls", Name: "migration"}))
+		}).Return(mockSecret, nil)
+		mockSecret.EXPECT().GetUUIDString().Return("5b5f3b8e-7c2d-4b6a-9f51-3c1f0e8f5a11", nil)
+		mockSecret.EXPECT().SetValue([]byte("password"), uint32(0)).Return(nil)
+		mockSecret.EXPECT().Free()
+
+		Expect(manager.SyncVMSecret(newVM("default", "testvm"), "tls", "migration", "password")).To(Succeed())
+	})
+
+	It("should reject unknown usage types", func() {
+		Expect(manager.SyncVMSecret(newVM("default", "testvm"), "ceph", "testusage", "password")).ToNot(Succeed())
+	})
+
+	It("should point the TPM to its encryption secret", func() {
+		vm := newVM("default", "testvm")
+		vm.Spec.Domain.Devices.TPM = &v1.TPM{
+			Backend:          v1.TPMBackend{Type: "emulator"},
+			EncryptionSecret: "tpmkey-default-testvm---",
+		}
+		spec := api.NewMinimalDomainSpec("default_testvm")
+		spec.Devices.TPM = &api.TPM{Backend: api.TPMBackend{Type: "emulator"}}
+
+		mockConn.EXPECT().LookupSecretByUsage(libvirt.SECRET_USAGE_TYPE_VTPM, "tpmkey-default-testvm---").Return(mockSecret, nil)
+		mockSecret.EXPECT().GetUUIDString().Return("5b5f3b8e-7c2d-4b6a-9f51-3c1f0e8f5a11", nil)
+		mockSecret.EXPECT().Free()
+
+		Expect(manager.prepareTPMEncryption(vm, spec)).To(Succeed())
+		Expect(spec.Devices.TPM.Backend.Encryption).To(Equal(&api.TPMEncryption{Secret: "5b5f3b8e-7c2d-4b6a-9f51-3c1f0e8f5a11"}))
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+})
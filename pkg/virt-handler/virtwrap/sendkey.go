@@ -0,0 +1,144 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"fmt"
+	"strings"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cache"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+// libvirt refuses to send more keys at once
+const maxSendKeys = 16
+
+// Linux input event codes of the keys which can be sent to guests, letters
+// and digits are added in init.
+var linuxKeycodes = map[string]uint{
+	"esc":        1,
+	"minus":      12,
+	"equal":      13,
+	"backspace":  14,
+	"tab":        15,
+	"enter":      28,
+	"ctrl":       29,
+	"shift":      42,
+	"alt":        56,
+	"space":      57,
+	"capslock":   58,
+	"numlock":    69,
+	"scrolllock": 70,
+	"rightctrl":  97,
+	"sysrq":      99,
+	"altgr":      100,
+	"home":       102,
+	"up":         103,
+	"pageup":     104,
+	"left":       105,
+	"right":      106,
+	"end":        107,
+	"down":       108,
+	"pagedown":   109,
+	"insert":     110,
+	"delete":     111,
+	"meta":       125,
+	"f11":        87,
+	"f12":        88,
+}
+
+var keycodeAliases = map[string]string{
+	"escape":  "esc",
+	"return":  "enter",
+	"control": "ctrl",
+	"del":     "delete",
+	"ins":     "insert",
+	"super":   "meta",
+	"win":     "meta",
+}
+
+func init() {
+	for i, letter := range "qwertyuiop" {
+		linuxKeycodes[string(letter)] = 16 + uint(i)
+	}
+	for i, letter := range "asdfghjkl" {
+		linuxKeycodes[string(letter)] = 30 + uint(i)
+	}
+	for i, letter := range "zxcvbnm" {
+		linuxKeycodes[string(letter)] = 44 + uint(i)
+	}
+	for i, digit := range "1234567890" {
+		linuxKeycodes[string(digit)] = 2 + uint(i)
+	}
+	for i := 1; i <= 10; i++ {
+		linuxKeycodes[fmt.Sprintf("f%d", i)] = 58 + uint(i)
+	}
+}
+
+// ParseKeyCombination translates a combination of keys which are pressed
+// together, like "ctrl+alt+delete", into Linux keycodes. Key names are case
+// insensitive.
+func ParseKeyCombination(combination string) ([]uint, error) {
+	keys := strings.Split(combination, "+")
+	if len(keys) > maxSendKeys {
+		return nil, fmt.Errorf("at most %d keys can be sent at once", maxSendKeys)
+	}
+	keycodes := make([]uint, 0, len(keys))
+	for _, key := range keys {
+		name := strings.ToLower(strings.TrimSpace(key))
+		if alias, exists := keycodeAliases[name]; exists {
+			name = alias
+		}
+		keycode, exists := linuxKeycodes[name]
+		if !exists {
+			return nil, fmt.Errorf("unknown key %q in %q", key, combination)
+		}
+		keycodes = append(keycodes, keycode)
+	}
+	return keycodes, nil
+}
+
+// SendKey injects a key combination into the guest, e.g. "ctrl+alt+delete"
+// to reboot it or to get to the login prompt of a locked screen.
+func (l *LibvirtDomainManager) SendKey(vm *v1.VirtualMachine, combination string, trigger Trigger) error {
+	keycodes, err := ParseKeyCombination(combination)
+	if err != nil {
+		return err
+	}
+
+	dom, err := l.virConn.LookupDomainByName(cache.VMNamespaceKeyFunc(vm))
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain failed.")
+		return err
+	}
+	defer dom.Free()
+
+	// A hold time of zero lets libvirt pick its default
+	err = dom.SendKey(uint(libvirt.KEYCODE_SET_LINUX), 0, keycodes, 0)
+	l.audit(vm, trigger, "send-key", combination, err)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msgf("Sending %s failed.", combination)
+		return err
+	}
+	logging.DefaultLogger().Object(vm).Info().Msgf("Sent %s.", combination)
+	return nil
+}
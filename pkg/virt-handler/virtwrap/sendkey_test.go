@@ -0,0 +1,81 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"strings"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Sending keys", func() {
+	var ctrl *gomock.Controller
+	var mockConn *cli.MockConnection
+	var mockDomain *cli.MockVirDomain
+	var manager *LibvirtDomainManager
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockConn = cli.NewMockConnection(ctrl)
+		mockDomain = cli.NewMockVirDomain(ctrl)
+		manager = &LibvirtDomainManager{virConn: mockConn}
+	})
+
+	table.DescribeTable("should map key names to Linux keycodes", func(combination string, keycodes []uint) {
+		Expect(ParseKeyCombination(combination)).To(Equal(keycodes))
+	},
+		table.Entry("ctrl-alt-del", "ctrl+alt+delete", []uint{29, 56, 111}),
+		table.Entry("aliases and mixed case", "Control+Alt+Del", []uint{29, 56, 111}),
+		table.Entry("letters and digits", "a+z+1+0", []uint{30, 44, 2, 11}),
+		table.Entry("function keys", "alt+f1+f10+f12", []uint{56, 59, 68, 88}),
+	)
+
+	It("should reject unknown keys", func() {
+		_, err := ParseKeyCombination("ctrl+hyper")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should reject too many keys", func() {
+		_, err := ParseKeyCombination(strings.Repeat("a+", maxSendKeys) + "a")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should send the keycodes to the domain", func() {
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+		mockDomain.EXPECT().SendKey(uint(libvirt.KEYCODE_SET_LINUX), uint(0), []uint{29, 56, 111}, uint32(0)).Return(nil)
+		mockDomain.EXPECT().Free()
+
+		Expect(manager.SendKey(newVM("default", "testvm"), "ctrl+alt+delete", TriggerVMController)).To(Succeed())
+	})
+
+	It("should not look up the domain for invalid combinations", func() {
+		Expect(manager.SendKey(newVM("default", "testvm"), "ctrl+", TriggerVMController)).ToNot(Succeed())
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+})
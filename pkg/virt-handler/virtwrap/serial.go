@@ -0,0 +1,117 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cache"
+)
+
+// qemu listens on the unix sockets of serial and parallel ports of type
+// unix. They live in a directory per domain, below the libvirt runtime
+// directory which the libvirt pod shares with virt-handler.
+var serialSocketRoot = "/var/run/libvirt/kubevirt-serial"
+
+const (
+	PortKindSerial   = "serial"
+	PortKindParallel = "parallel"
+)
+
+func serialSocketDir(vm *v1.VirtualMachine) string {
+	return filepath.Join(serialSocketRoot, cache.VMNamespaceKeyFunc(vm))
+}
+
+func serialSocketPath(vm *v1.VirtualMachine, kind string, port uint) string {
+	return filepath.Join(serialSocketDir(vm), fmt.Sprintf("%s%d.sock", kind, port))
+}
+
+// SerialPortSocket returns the socket of a serial or parallel port of type
+// unix of the VM. Drivers which run guests without libvirt create the sockets
+// of their ports there too, so that OpenSerialPort finds them.
+func SerialPortSocket(vm *v1.VirtualMachine, kind string, port uint) string {
+	return serialSocketPath(vm, kind, port)
+}
+
+// bindPortSocket points a port of type unix to its socket. Ports need an
+// explicit number, so that clients know which socket to connect to.
+func bindPortSocket(vm *v1.VirtualMachine, kind string, source **api.SerialSource, target *api.SerialTarget, seen map[uint]bool) error {
+	if target == nil || target.Port == nil {
+		return fmt.Errorf("%s ports of type unix need a port number", kind)
+	}
+	port := *target.Port
+	if seen[port] {
+		return fmt.Errorf("%s port %d is defined twice", kind, port)
+	}
+	seen[port] = true
+	*source = &api.SerialSource{Mode: "bind", Path: serialSocketPath(vm, kind, port)}
+	return nil
+}
+
+// prepareSerialSockets binds all serial and parallel ports of type unix to
+// sockets in the socket directory of the domain.
+func prepareSerialSockets(vm *v1.VirtualMachine, spec *api.DomainSpec) error {
+	needsSockets := false
+	seen := map[uint]bool{}
+	for i := range spec.Devices.Serials {
+		serial := &spec.Devices.Serials[i]
+		if serial.Type != "unix" {
+			continue
+		}
+		if err := bindPortSocket(vm, PortKindSerial, &serial.Source, serial.Target, seen); err != nil {
+			return err
+		}
+		needsSockets = true
+	}
+	seen = map[uint]bool{}
+	for i := range spec.Devices.Parallels {
+		parallel := &spec.Devices.Parallels[i]
+		if parallel.Type != "unix" {
+			continue
+		}
+		if err := bindPortSocket(vm, PortKindParallel, &parallel.Source, parallel.Target, seen); err != nil {
+			return err
+		}
+		needsSockets = true
+	}
+	if !needsSockets {
+		return nil
+	}
+	return os.MkdirAll(serialSocketDir(vm), 0755)
+}
+
+// removeSerialSockets removes the socket directory of the domain.
+func removeSerialSockets(vm *v1.VirtualMachine) error {
+	return os.RemoveAll(serialSocketDir(vm))
+}
+
+// OpenSerialPort connects to the socket of a serial or parallel port of type
+// unix of a running VM.
+func OpenSerialPort(vm *v1.VirtualMachine, kind string, port uint) (net.Conn, error) {
+	if kind != PortKindSerial && kind != PortKindParallel {
+		return nil, fmt.Errorf("unsupported port kind %s", kind)
+	}
+	return net.Dial("unix", serialSocketPath(vm, kind, port))
+}
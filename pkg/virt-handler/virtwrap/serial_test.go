@@ -0,0 +1,106 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+)
+
+var _ = Describe("Serial port sockets", func() {
+	var tmpDir string
+	var originalSerialSocketRoot string
+
+	newPort := func(port uint) *api.SerialTarget {
+		return &api.SerialTarget{Port: &port}
+	}
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "serial")
+		Expect(err).ToNot(HaveOccurred())
+		originalSerialSocketRoot = serialSocketRoot
+		serialSocketRoot = tmpDir
+	})
+
+	It("should bind unix ports to sockets of the domain", func() {
+		vm := newVM("default", "testvm")
+		spec := api.NewMinimalDomainSpec("default_testvm")
+		spec.Devices.Serials = []api.Serial{
+			{Type: "pty", Target: newPort(0)},
+			{Type: "unix", Target: newPort(1)},
+		}
+		spec.Devices.Parallels = []api.Parallel{{Type: "unix", Target: newPort(0)}}
+		Expect(prepareSerialSockets(vm, spec)).To(Succeed())
+
+		Expect(spec.Devices.Serials[0].Source).To(BeNil())
+		Expect(spec.Devices.Serials[1].Source).To(Equal(&api.SerialSource{
+			Mode: "bind",
+			Path: filepath.Join(tmpDir, "default_testvm", "serial1.sock"),
+		}))
+		Expect(spec.Devices.Parallels[0].Source.Path).To(Equal(filepath.Join(tmpDir, "default_testvm", "parallel0.sock")))
+		Expect(filepath.Join(tmpDir, "default_testvm")).To(BeADirectory())
+
+		Expect(removeSerialSockets(vm)).To(Succeed())
+		Expect(filepath.Join(tmpDir, "default_testvm")).ToNot(BeADirectory())
+	})
+
+	It("should reject unix ports without a port number", func() {
+		spec := api.NewMinimalDomainSpec("default_testvm")
+		spec.Devices.Serials = []api.Serial{{Type: "unix"}}
+		Expect(prepareSerialSockets(newVM("default", "testvm"), spec)).ToNot(Succeed())
+	})
+
+	It("should reject ports which are defined twice", func() {
+		spec := api.NewMinimalDomainSpec("default_testvm")
+		spec.Devices.Serials = []api.Serial{
+			{Type: "unix", Target: newPort(1)},
+			{Type: "unix", Target: newPort(1)},
+		}
+		Expect(prepareSerialSockets(newVM("default", "testvm"), spec)).ToNot(Succeed())
+	})
+
+	It("should connect to the socket of a port", func() {
+		vm := newVM("default", "testvm")
+		Expect(os.MkdirAll(serialSocketDir(vm), 0755)).To(Succeed())
+		listener, err := net.Listen("unix", serialSocketPath(vm, PortKindSerial, 1))
+		Expect(err).ToNot(HaveOccurred())
+		defer listener.Close()
+
+		conn, err := OpenSerialPort(vm, PortKindSerial, 1)
+		Expect(err).ToNot(HaveOccurred())
+		conn.Close()
+
+		_, err = OpenSerialPort(vm, PortKindParallel, 1)
+		Expect(err).To(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		serialSocketRoot = originalSerialSocketRoot
+		os.RemoveAll(tmpDir)
+	})
+})
@@ -0,0 +1,304 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cache"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	domainerrors "kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/errors"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+const (
+	// No debugging and no key sharing with other guests
+	defaultSEVPolicy = 0x0003
+	// Encrypt the CPU state too
+	sevPolicyEncryptedState = 0x0004
+)
+
+// GetSEVCapability returns the SEV parameters of the host for guests of the
+// given machine type, or nil if the host does not support SEV.
+func GetSEVCapability(conn cli.Connection, arch string, machine string) (*api.SEVCapability, error) {
+	capsXML, err := conn.GetDomainCapabilities("", arch, machine, "kvm", 0)
+	if err != nil {
+		return nil, err
+	}
+	var caps api.DomainCapabilities
+	if err := xml.Unmarshal([]byte(capsXML), &caps); err != nil {
+		return nil, err
+	}
+	if caps.Features.SEV == nil || caps.Features.SEV.Supported != "yes" {
+		return nil, nil
+	}
+	return caps.Features.SEV, nil
+}
+
+// prepareLaunchSecurity adds the SEV launch security of the host to SEV
+// guests. Guest memory is encrypted, so virtio devices have to go through
+// the IOMMU to reach the shared buffers.
+func (l *LibvirtDomainManager) prepareLaunchSecurity(vm *v1.VirtualMachine, spec *api.DomainSpec) error {
+	if vm.Spec.Domain == nil || vm.Spec.Domain.SEV == nil {
+		return nil
+	}
+	sev := vm.Spec.Domain.SEV
+
+	if spec.OS.Loader == nil {
+		return fmt.Errorf("SEV requires a UEFI firmware")
+	}
+	if !strings.Contains(spec.OS.Type.Machine, "q35") {
+		return fmt.Errorf("SEV requires a q35 machine type, got '%s'", spec.OS.Type.Machine)
+	}
+	sevCaps, err := GetSEVCapability(l.virConn, spec.OS.Type.Arch, spec.OS.Type.Machine)
+	if err != nil {
+		return err
+	}
+	if sevCaps == nil {
+		return fmt.Errorf("the host does not support SEV")
+	}
+
+	policy := uint32(defaultSEVPolicy)
+	if sev.Policy != nil {
+		policy = *sev.Policy
+	}
+	if sev.EncryptedState {
+		policy |= sevPolicyEncryptedState
+	}
+	spec.LaunchSecurity = &api.LaunchSecurity{
+		Type:            "sev",
+		CBitPos:         sevCaps.CBitPos,
+		ReducedPhysBits: sevCaps.ReducedPhysBits,
+		Policy:          fmt.Sprintf("0x%04x", policy),
+		DHCert:          sev.DHCert,
+		Session:         sev.Session,
+	}
+
+	enableIOMMU(spec)
+	return nil
+}
+
+// enableIOMMU lets all virtio devices of the domain go through the IOMMU,
+// including the ones libvirt would add implicitly.
+func enableIOMMU(spec *api.DomainSpec) {
+	for i, disk := range spec.Devices.Disks {
+		if disk.Target.Bus != "virtio" {
+			continue
+		}
+		if disk.Driver == nil {
+			spec.Devices.Disks[i].Driver = &api.DiskDriver{}
+		}
+		spec.Devices.Disks[i].Driver.IOMMU = "on"
+	}
+	for i, iface := range spec.Devices.Interfaces {
+		if iface.Model == nil || iface.Model.Type != "virtio" {
+			continue
+		}
+		if iface.Driver == nil {
+			spec.Devices.Interfaces[i].Driver = &api.InterfaceDriver{}
+		}
+		spec.Devices.Interfaces[i].Driver.IOMMU = "on"
+	}
+
+	if spec.Devices.Ballooning == nil {
+		spec.Devices.Ballooning = &api.Ballooning{Model: "virtio"}
+	}
+	if spec.Devices.Ballooning.Model == "virtio" {
+		spec.Devices.Ballooning.Driver = &api.DeviceDriver{IOMMU: "on"}
+	}
+	if spec.Devices.Rng != nil && spec.Devices.Rng.Model == "virtio" {
+		spec.Devices.Rng.Driver = &api.DeviceDriver{IOMMU: "on"}
+	}
+
+	// Channels need a virtio-serial controller, which libvirt would
+	// otherwise add without the IOMMU
+	hasVirtioSerial := false
+	for i, controller := range spec.Devices.Controllers {
+		if controller.Type == "virtio-serial" {
+			hasVirtioSerial = true
+			spec.Devices.Controllers[i].Driver = &api.DeviceDriver{IOMMU: "on"}
+		}
+	}
+	if len(spec.Devices.Channels) > 0 && !hasVirtioSerial {
+		spec.Devices.Controllers = append(spec.Devices.Controllers, api.Controller{
+			Type:   "virtio-serial",
+			Index:  "0",
+			Driver: &api.DeviceDriver{IOMMU: "on"},
+		})
+	}
+}
+
+type sevLaunchMeasurement struct {
+	Data string `json:"data"`
+}
+
+// GetLaunchMeasurement returns the base64 encoded SEV launch measurement of
+// the guest, which the guest owner needs to verify the guest before handing
+// secrets to it.
+func (l *LibvirtDomainManager) GetLaunchMeasurement(vm *v1.VirtualMachine) (string, error) {
+	dom, err := l.virConn.LookupDomainByName(cache.VMNamespaceKeyFunc(vm))
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain failed.")
+		return "", err
+	}
+	defer dom.Free()
+
+	// The libvirt-go version in use has no API for it yet, the command only
+	// queries qemu
+	reply, err := qemuMonitorCommand(vm, dom, "query-sev-launch-measure", nil)
+	if err != nil {
+		return "", err
+	}
+	var measurement sevLaunchMeasurement
+	if err := json.Unmarshal(reply, &measurement); err != nil {
+		return "", fmt.Errorf("invalid SEV launch measurement: %v", err)
+	}
+	if measurement.Data == "" {
+		return "", fmt.Errorf("the guest has no SEV launch measurement")
+	}
+	return measurement.Data, nil
+}
+
+// awaitsLaunchSecret tells whether the guest owner hands a secret to the
+// guest after verifying its launch measurement, which requires the guest to
+// start paused.
+func awaitsLaunchSecret(vm *v1.VirtualMachine) bool {
+	return vm.Spec.Domain != nil && vm.Spec.Domain.SEV != nil && vm.Spec.Domain.SEV.Session != ""
+}
+
+// waitsForLaunchSecret tells whether the paused domain was started paused for
+// its launch secret, which is recorded in the domain metadata. Domains which
+// were paused for any other reason are not.
+func waitsForLaunchSecret(dom cli.VirDomain, domState libvirt.DomainState) (bool, error) {
+	if !cli.IsPaused(domState) {
+		return false, nil
+	}
+	metadata, err := GetMetadata(dom)
+	if err != nil {
+		return false, err
+	}
+	return metadata.AwaitsLaunchSecret, nil
+}
+
+// WaitsForLaunchSecret tells whether the SEV guest of the VM was started
+// paused and still waits for its launch secret.
+func (l *LibvirtDomainManager) WaitsForLaunchSecret(vm *v1.VirtualMachine) (bool, error) {
+	if !awaitsLaunchSecret(vm) {
+		return false, nil
+	}
+	dom, err := l.virConn.LookupDomainByName(cache.VMNamespaceKeyFunc(vm))
+	if err != nil {
+		if domainerrors.IsNotFound(err) {
+			return false, nil
+		}
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain failed.")
+		return false, err
+	}
+	defer dom.Free()
+
+	domState, _, err := dom.GetState()
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain state failed.")
+		return false, err
+	}
+	return waitsForLaunchSecret(dom, domState)
+}
+
+// setAwaitsLaunchSecret records in the domain metadata whether the domain
+// waits for its launch secret.
+func (l *LibvirtDomainManager) setAwaitsLaunchSecret(vm *v1.VirtualMachine, dom cli.VirDomain, awaits bool, trigger Trigger) error {
+	metadata, err := GetMetadata(dom)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Reading the domain metadata failed.")
+		return err
+	}
+	metadata.AwaitsLaunchSecret = awaits
+	err = SetMetadata(dom, metadata)
+	l.audit(vm, trigger, "set-metadata", metadata, err)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Storing the domain metadata failed.")
+		return err
+	}
+	return nil
+}
+
+// InjectLaunchSecret hands the secret, which the guest owner packed for the
+// launch measurement of the guest, to the paused SEV guest and starts it.
+// Both are base64 encoded.
+func (l *LibvirtDomainManager) InjectLaunchSecret(vm *v1.VirtualMachine, header string, secret string, trigger Trigger) error {
+	if header == "" || secret == "" {
+		return fmt.Errorf("the launch secret and its packet header are required")
+	}
+	domName := cache.VMNamespaceKeyFunc(vm)
+	return l.runOnDomain(vm, func() error {
+		dom, err := l.virConn.LookupDomainByName(domName)
+		if err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain failed.")
+			return err
+		}
+		defer dom.Free()
+
+		domState, _, err := dom.GetState()
+		if err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain state failed.")
+			return err
+		}
+		waiting, err := waitsForLaunchSecret(dom, domState)
+		if err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Reading the domain metadata failed.")
+			return err
+		}
+		if !waiting {
+			return fmt.Errorf("the guest does not wait for its launch secret")
+		}
+
+		// libvirt has no API for it yet, the command does not change
+		// anything libvirt manages
+		_, err = qemuMonitorCommand(vm, dom, "sev-inject-launch-secret", map[string]interface{}{
+			"packet-header": header,
+			"secret":        secret,
+		})
+		l.audit(vm, trigger, "inject-launch-secret", nil, err)
+		if err != nil {
+			return err
+		}
+		// Guests which fail to resume are resumed like any other paused
+		// guest from now on
+		if err := l.setAwaitsLaunchSecret(vm, dom, false, trigger); err != nil {
+			return err
+		}
+
+		err = dom.Resume()
+		l.audit(vm, trigger, "resume", nil, err)
+		l.domainSpecs.invalidate(domName)
+		if err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Resuming the VM failed.")
+			return err
+		}
+		logging.DefaultLogger().Object(vm).Info().Msg("Launch secret injected, domain resumed.")
+		return nil
+	})
+}
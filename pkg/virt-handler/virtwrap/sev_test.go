@@ -0,0 +1,211 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("SEV", func() {
+	var ctrl *gomock.Controller
+	var mockConn *cli.MockConnection
+	var mockDomain *cli.MockVirDomain
+	var manager *LibvirtDomainManager
+	var vm *v1.VirtualMachine
+	var spec *api.DomainSpec
+
+	sevCaps := `<domainCapabilities>
+  <features>
+    <sev supported='yes'>
+      <cbitpos>47</cbitpos>
+      <reducedPhysBits>1</reducedPhysBits>
+    </sev>
+  </features>
+</domainCapabilities>`
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockConn = cli.NewMockConnection(ctrl)
+		mockDomain = cli.NewMockVirDomain(ctrl)
+		manager = &LibvirtDomainManager{virConn: mockConn}
+
+		vm = newVM("default", "testvm")
+		vm.Spec.Domain.SEV = &v1.SEV{DHCert: "cert", Session: "session"}
+		spec = api.NewMinimalDomainSpec("default_testvm")
+		spec.OS.Type.Arch = "x86_64"
+		spec.OS.Type.Machine = "pc-q35-2.10"
+		spec.OS.Loader = &api.Loader{Type: "pflash"}
+		spec.Devices.Disks = []api.Disk{
+			{Target: api.DiskTarget{Device: "vda", Bus: "virtio"}, Driver: &api.DiskDriver{Name: "qemu", Type: "raw"}},
+		}
+		spec.Devices.Interfaces = []api.Interface{{Model: &api.Model{Type: "virtio"}}}
+	})
+
+	It("should add the launch security of the host", func() {
+		mockConn.EXPECT().GetDomainCapabilities("", "x86_64", "pc-q35-2.10", "kvm", uint32(0)).Return(sevCaps, nil)
+
+		Expect(manager.prepareLaunchSecurity(vm, spec)).To(Succeed())
+		Expect(spec.LaunchSecurity).To(Equal(&api.LaunchSecurity{
+			Type:            "sev",
+			CBitPos:         47,
+			ReducedPhysBits: 1,
+			Policy:          "0x0003",
+			DHCert:          "cert",
+			Session:         "session",
+		}))
+		Expect(spec.Devices.Disks[0].Driver.IOMMU).To(Equal("on"))
+		Expect(spec.Devices.Interfaces[0].Driver.IOMMU).To(Equal("on"))
+	})
+
+	It("should let all virtio devices use the IOMMU", func() {
+		spec.Devices.Disks = append(spec.Devices.Disks, api.Disk{Target: api.DiskTarget{Device: "vdb", Bus: "virtio"}})
+		spec.Devices.Rng = &api.RandomGenerator{Model: "virtio"}
+		spec.Devices.Channels = []api.Channel{newGuestAgentChannel()}
+		mockConn.EXPECT().GetDomainCapabilities(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(sevCaps, nil)
+
+		Expect(manager.prepareLaunchSecurity(vm, spec)).To(Succeed())
+		Expect(spec.Devices.Disks[1].Driver).To(Equal(&api.DiskDriver{IOMMU: "on"}))
+		Expect(spec.Devices.Ballooning).To(Equal(&api.Ballooning{Model: "virtio", Driver: &api.DeviceDriver{IOMMU: "on"}}))
+		Expect(spec.Devices.Rng.Driver).To(Equal(&api.DeviceDriver{IOMMU: "on"}))
+		Expect(spec.Devices.Controllers).To(Equal([]api.Controller{
+			{Type: "virtio-serial", Index: "0", Driver: &api.DeviceDriver{IOMMU: "on"}},
+		}))
+	})
+
+	It("should leave a disabled memory balloon alone", func() {
+		spec.Devices.Ballooning = &api.Ballooning{Model: "none"}
+		mockConn.EXPECT().GetDomainCapabilities(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(sevCaps, nil)
+
+		Expect(manager.prepareLaunchSecurity(vm, spec)).To(Succeed())
+		Expect(spec.Devices.Ballooning.Driver).To(BeNil())
+	})
+
+	It("should set the encrypted state policy bit for SEV-ES", func() {
+		policy := uint32(0x0001)
+		vm.Spec.Domain.SEV.Policy = &policy
+		vm.Spec.Domain.SEV.EncryptedState = true
+		mockConn.EXPECT().GetDomainCapabilities(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(sevCaps, nil)
+
+		Expect(manager.prepareLaunchSecurity(vm, spec)).To(Succeed())
+		Expect(spec.LaunchSecurity.Policy).To(Equal("0x0005"))
+	})
+
+	It("should refuse SEV on hosts without SEV", func() {
+		mockConn.EXPECT().GetDomainCapabilities(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(`<domainCapabilities><features><sev supported='no'/></features></domainCapabilities>`, nil)
+
+		Expect(manager.prepareLaunchSecurity(vm, spec)).ToNot(Succeed())
+	})
+
+	It("should refuse SEV without UEFI", func() {
+		spec.OS.Loader = nil
+		Expect(manager.prepareLaunchSecurity(vm, spec)).ToNot(Succeed())
+	})
+
+	It("should leave guests without SEV alone", func() {
+		Expect(manager.prepareLaunchSecurity(newVM("default", "testvm"), spec)).To(Succeed())
+		Expect(spec.LaunchSecurity).To(BeNil())
+	})
+
+	It("should return the launch measurement", func() {
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+		mockDomain.EXPECT().QemuMonitorCommand(`{"execute":"query-sev-launch-measure"}`, libvirt.DOMAIN_QEMU_MONITOR_COMMAND_DEFAULT).Return(`{"return":{"data":"bWVhc3VyZW1lbnQ="}}`, nil)
+		mockDomain.EXPECT().Free()
+
+		measurement, err := manager.GetLaunchMeasurement(newVM("default", "testvm"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(measurement).To(Equal("bWVhc3VyZW1lbnQ="))
+	})
+
+	Context("injecting the launch secret", func() {
+		awaitingMetadata := "<kubevirt><uid>1234</uid><awaitsLaunchSecret>true</awaitsLaunchSecret></kubevirt>"
+
+		BeforeEach(func() {
+			manager.domainSpecs = newDomainSpecCache()
+		})
+
+		It("should inject the secret and resume the guest", func() {
+			mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+			mockDomain.EXPECT().GetState().Return(libvirt.DOMAIN_PAUSED, int(libvirt.DOMAIN_PAUSED_USER), nil)
+			mockDomain.EXPECT().GetMetadata(libvirt.DOMAIN_METADATA_ELEMENT, api.KubeVirtMetadataURI, libvirt.DOMAIN_AFFECT_CONFIG).Return(awaitingMetadata, nil).Times(2)
+			mockDomain.EXPECT().QemuMonitorCommand(`{"execute":"sev-inject-launch-secret","arguments":{"packet-header":"aGVhZGVy","secret":"c2VjcmV0"}}`, libvirt.DOMAIN_QEMU_MONITOR_COMMAND_DEFAULT).Return(`{"return":{}}`, nil)
+			mockDomain.EXPECT().SetMetadata("<kubevirt><uid>1234</uid></kubevirt>", libvirt.DOMAIN_METADATA_ELEMENT, api.KubeVirtMetadataPrefix, api.KubeVirtMetadataURI, libvirt.DOMAIN_AFFECT_CONFIG).Return(nil)
+			mockDomain.EXPECT().Resume().Return(nil)
+			mockDomain.EXPECT().Free()
+
+			Expect(manager.InjectLaunchSecret(vm, "aGVhZGVy", "c2VjcmV0", TriggerVMController)).To(Succeed())
+			trail := manager.GetAuditTrail(vm)
+			Expect(trail).To(HaveLen(3))
+			Expect(trail[0].Operation).To(Equal("inject-launch-secret"))
+			Expect(trail[1].Operation).To(Equal("set-metadata"))
+			Expect(trail[2].Operation).To(Equal("resume"))
+		})
+
+		It("should not resume the guest if qemu rejects the secret", func() {
+			mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+			mockDomain.EXPECT().GetState().Return(libvirt.DOMAIN_PAUSED, int(libvirt.DOMAIN_PAUSED_USER), nil)
+			mockDomain.EXPECT().GetMetadata(libvirt.DOMAIN_METADATA_ELEMENT, api.KubeVirtMetadataURI, libvirt.DOMAIN_AFFECT_CONFIG).Return(awaitingMetadata, nil)
+			mockDomain.EXPECT().QemuMonitorCommand(gomock.Any(), gomock.Any()).Return(`{"error":{"class":"GenericError","desc":"SEV: failed to inject secret"}}`, nil)
+			mockDomain.EXPECT().Free()
+
+			Expect(manager.InjectLaunchSecret(vm, "aGVhZGVy", "c2VjcmV0", TriggerVMController)).ToNot(Succeed())
+		})
+
+		It("should refuse guests which do not wait for their launch secret", func() {
+			mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+			mockDomain.EXPECT().GetState().Return(libvirt.DOMAIN_RUNNING, 1, nil)
+			mockDomain.EXPECT().Free()
+
+			Expect(manager.InjectLaunchSecret(vm, "aGVhZGVy", "c2VjcmV0", TriggerVMController)).ToNot(Succeed())
+		})
+
+		It("should refuse guests which were paused for another reason", func() {
+			mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+			mockDomain.EXPECT().GetState().Return(libvirt.DOMAIN_PAUSED, int(libvirt.DOMAIN_PAUSED_USER), nil)
+			mockDomain.EXPECT().GetMetadata(libvirt.DOMAIN_METADATA_ELEMENT, api.KubeVirtMetadataURI, libvirt.DOMAIN_AFFECT_CONFIG).Return("<kubevirt><uid>1234</uid></kubevirt>", nil)
+			mockDomain.EXPECT().Free()
+
+			Expect(manager.InjectLaunchSecret(vm, "aGVhZGVy", "c2VjcmV0", TriggerVMController)).To(MatchError("the guest does not wait for its launch secret"))
+		})
+
+		It("should tell whether the guest waits for its launch secret", func() {
+			mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+			mockDomain.EXPECT().GetState().Return(libvirt.DOMAIN_PAUSED, int(libvirt.DOMAIN_PAUSED_USER), nil)
+			mockDomain.EXPECT().GetMetadata(libvirt.DOMAIN_METADATA_ELEMENT, api.KubeVirtMetadataURI, libvirt.DOMAIN_AFFECT_CONFIG).Return(awaitingMetadata, nil)
+			mockDomain.EXPECT().Free()
+
+			Expect(manager.WaitsForLaunchSecret(vm)).To(BeTrue())
+		})
+
+		It("should refuse empty secrets", func() {
+			Expect(manager.InjectLaunchSecret(vm, "", "", TriggerVMController)).ToNot(Succeed())
+		})
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+})
@@ -0,0 +1,176 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+)
+
+// GuestPhase is the KubeVirt level phase of a guest, derived from the libvirt
+// state of its domain and the reason it got into that state.
+type GuestPhase string
+
+const (
+	// GuestScheduled means the domain is defined, but was not started yet or
+	// was migrated away.
+	GuestScheduled GuestPhase = "Scheduled"
+	GuestRunning   GuestPhase = "Running"
+	GuestPaused    GuestPhase = "Paused"
+	// GuestSucceeded means the guest stopped voluntarily or was stopped by us.
+	GuestSucceeded GuestPhase = "Succeeded"
+	// GuestFailed means the guest can't continue, e.g. because its watchdog
+	// fired or a post-copy migration failed.
+	GuestFailed  GuestPhase = "Failed"
+	GuestCrashed GuestPhase = "Crashed"
+)
+
+// IsFinal tells whether the guest can't get out of the phase on its own.
+func (p GuestPhase) IsFinal() bool {
+	return p == GuestSucceeded || p == GuestFailed || p == GuestCrashed
+}
+
+// VMPhase returns the phase of the VM for the phase of its guest.
+func (p GuestPhase) VMPhase() v1.VMPhase {
+	switch p {
+	case GuestScheduled:
+		return v1.Scheduled
+	case GuestRunning, GuestPaused:
+		return v1.Running
+	case GuestSucceeded:
+		return v1.Succeeded
+	case GuestFailed, GuestCrashed:
+		return v1.Failed
+	}
+	return v1.Unknown
+}
+
+// GuestPhaseForState translates the libvirt state of a domain into the phase
+// of its guest.
+func GuestPhaseForState(status api.LifeCycle, reason api.StateChangeReason) GuestPhase {
+	// The guest watchdog fired, the configured action decides whether the
+	// guest was stopped, paused or keeps running
+	if reason == api.ReasonWatchdog {
+		switch status {
+		case api.Shutoff:
+			return GuestFailed
+		case api.Paused:
+			return GuestPaused
+		}
+		return GuestRunning
+	}
+
+	switch status {
+	case api.Running, api.Blocked, api.Shutdown:
+		return GuestRunning
+	case api.Paused, api.PMSuspended:
+		// Parts of the guest memory are on both hosts, the guest can't be
+		// resumed anymore
+		if reason == api.ReasonPostCopyFailed {
+			return GuestFailed
+		}
+		return GuestPaused
+	case api.Crashed:
+		return GuestCrashed
+	case api.Shutoff:
+		switch reason {
+		case api.ReasonCrashed, api.ReasonPanicked:
+			return GuestCrashed
+		case api.ReasonShutdown, api.ReasonDestroyed, api.ReasonSaved, api.ReasonFromSnapshot:
+			return GuestSucceeded
+		case api.ReasonFailed:
+			return GuestFailed
+		}
+	}
+	return GuestScheduled
+}
+
+// GuestTransition is a change of the phase of a guest.
+type GuestTransition struct {
+	From      GuestPhase
+	To        GuestPhase
+	Reason    api.StateChangeReason
+	Timestamp metav1.Time
+}
+
+type guestState struct {
+	phase GuestPhase
+	since metav1.Time
+}
+
+// GuestStateMachine tracks the phases of all guests of the node, so that
+// callers only have to react on transitions between them.
+type GuestStateMachine struct {
+	lock   sync.Mutex
+	guests map[string]guestState
+}
+
+func NewGuestStateMachine() *GuestStateMachine {
+	return &GuestStateMachine{guests: make(map[string]guestState)}
+}
+
+// Observe feeds the current state of a domain into the state machine. It
+// returns the transition, if the guest changed its phase. The first
+// observation of a guest is always a transition from an empty phase.
+func (m *GuestStateMachine) Observe(key string, status api.LifeCycle, reason api.StateChangeReason) (GuestTransition, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	phase := GuestPhaseForState(status, reason)
+	current := m.guests[key]
+	if current.phase == phase {
+		return GuestTransition{}, false
+	}
+	// A guest whose watchdog powered it off is reported as stopped right
+	// after, that does not make it succeed
+	if current.phase == GuestFailed && phase == GuestSucceeded {
+		return GuestTransition{}, false
+	}
+
+	transition := GuestTransition{
+		From:      current.phase,
+		To:        phase,
+		Reason:    reason,
+		Timestamp: metav1.Now(),
+	}
+	m.guests[key] = guestState{phase: phase, since: transition.Timestamp}
+	return transition, true
+}
+
+// Phase returns the current phase of a guest and since when it is in it.
+func (m *GuestStateMachine) Phase(key string) (GuestPhase, metav1.Time, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	current, exists := m.guests[key]
+	return current.phase, current.since, exists
+}
+
+// Forget drops a guest, its next observation is a transition again.
+func (m *GuestStateMachine) Forget(key string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	delete(m.guests, key)
+}
@@ -0,0 +1,102 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+)
+
+var _ = Describe("Guest state machine", func() {
+
+	table.DescribeTable("should translate the domain state", func(status api.LifeCycle, reason api.StateChangeReason, phase GuestPhase, vmPhase v1.VMPhase) {
+		Expect(GuestPhaseForState(status, reason)).To(Equal(phase))
+		Expect(phase.VMPhase()).To(Equal(vmPhase))
+	},
+		table.Entry("of defined domains", api.Shutoff, api.ReasonUnknown, GuestScheduled, v1.Scheduled),
+		table.Entry("of running domains", api.Running, api.ReasonUnknown, GuestRunning, v1.Running),
+		table.Entry("of domains which shut down", api.Shutdown, api.ReasonUser, GuestRunning, v1.Running),
+		table.Entry("of paused domains", api.Paused, api.ReasonUser, GuestPaused, v1.Running),
+		table.Entry("of domains which failed in post-copy", api.Paused, api.ReasonPostCopyFailed, GuestFailed, v1.Failed),
+		table.Entry("of domains whose watchdog stopped them", api.Shutoff, api.ReasonWatchdog, GuestFailed, v1.Failed),
+		table.Entry("of domains whose watchdog paused them", api.Paused, api.ReasonWatchdog, GuestPaused, v1.Running),
+		table.Entry("of domains whose watchdog did nothing", api.Running, api.ReasonWatchdog, GuestRunning, v1.Running),
+		table.Entry("of domains which were shut down", api.Shutoff, api.ReasonShutdown, GuestSucceeded, v1.Succeeded),
+		table.Entry("of destroyed domains", api.Shutoff, api.ReasonDestroyed, GuestSucceeded, v1.Succeeded),
+		table.Entry("of domains which failed to start", api.Shutoff, api.ReasonFailed, GuestFailed, v1.Failed),
+		table.Entry("of panicked domains", api.Shutoff, api.ReasonPanicked, GuestCrashed, v1.Failed),
+		table.Entry("of crashed domains", api.Crashed, api.ReasonUnknown, GuestCrashed, v1.Failed),
+		table.Entry("of migrated domains", api.Shutoff, api.ReasonMigrated, GuestScheduled, v1.Scheduled),
+	)
+
+	It("should only report phase changes", func() {
+		m := NewGuestStateMachine()
+
+		transition, changed := m.Observe("default/testvm", api.Running, api.ReasonUnknown)
+		Expect(changed).To(BeTrue())
+		Expect(transition.From).To(BeEmpty())
+		Expect(transition.To).To(Equal(GuestRunning))
+		Expect(transition.Timestamp.IsZero()).To(BeFalse())
+
+		_, changed = m.Observe("default/testvm", api.Running, api.ReasonPostCopy)
+		Expect(changed).To(BeFalse())
+
+		transition, changed = m.Observe("default/testvm", api.Shutoff, api.ReasonCrashed)
+		Expect(changed).To(BeTrue())
+		Expect(transition.From).To(Equal(GuestRunning))
+		Expect(transition.To).To(Equal(GuestCrashed))
+		Expect(transition.Reason).To(Equal(api.ReasonCrashed))
+		Expect(transition.To.IsFinal()).To(BeTrue())
+
+		phase, since, exists := m.Phase("default/testvm")
+		Expect(exists).To(BeTrue())
+		Expect(phase).To(Equal(GuestCrashed))
+		Expect(since).To(Equal(transition.Timestamp))
+	})
+
+	It("should keep guests failed when they are stopped afterwards", func() {
+		m := NewGuestStateMachine()
+		m.Observe("default/testvm", api.Running, api.ReasonUnknown)
+		transition, changed := m.Observe("default/testvm", api.Shutoff, api.ReasonWatchdog)
+		Expect(changed).To(BeTrue())
+		Expect(transition.To).To(Equal(GuestFailed))
+
+		_, changed = m.Observe("default/testvm", api.Shutoff, api.ReasonShutdown)
+		Expect(changed).To(BeFalse())
+		phase, _, _ := m.Phase("default/testvm")
+		Expect(phase).To(Equal(GuestFailed))
+	})
+
+	It("should start over for forgotten guests", func() {
+		m := NewGuestStateMachine()
+		m.Observe("default/testvm", api.Paused, api.ReasonUser)
+		m.Forget("default/testvm")
+
+		_, _, exists := m.Phase("default/testvm")
+		Expect(exists).To(BeFalse())
+		transition, changed := m.Observe("default/testvm", api.Paused, api.ReasonUser)
+		Expect(changed).To(BeTrue())
+		Expect(transition.From).To(BeEmpty())
+	})
+})
@@ -0,0 +1,112 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package stats
+
+import (
+	"sync"
+	"time"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+const DefaultCollectorTTL = 5 * time.Second
+
+const collectedStats = libvirt.DOMAIN_STATS_STATE |
+	libvirt.DOMAIN_STATS_CPU_TOTAL |
+	libvirt.DOMAIN_STATS_BALLOON |
+	libvirt.DOMAIN_STATS_VCPU |
+	libvirt.DOMAIN_STATS_INTERFACE |
+	libvirt.DOMAIN_STATS_BLOCK |
+	libvirt.DOMAIN_STATS_PERF
+
+// Collector fetches the statistics of all running domains with a single
+// libvirt call and serves all queries from that result until it is older
+// than the TTL. Concurrent queries wait for the same refresh instead of
+// hitting libvirtd on their own.
+type Collector struct {
+	virConn   cli.Connection
+	ttl       time.Duration
+	lock      sync.Mutex
+	stats     map[string]*cli.DomainStats
+	queues    map[string]cachedQueueStats
+	timestamp time.Time
+	now       func() time.Time
+}
+
+func NewCollector(virConn cli.Connection, ttl time.Duration) *Collector {
+	return &Collector{
+		virConn: virConn,
+		ttl:     ttl,
+		now:     time.Now,
+	}
+}
+
+// Get returns the statistics of the domain with the given name. The second
+// return value is false if the domain is not running.
+func (c *Collector) Get(name string) (*cli.DomainStats, bool, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := c.refreshIfStale(); err != nil {
+		return nil, false, err
+	}
+	stats, exists := c.stats[name]
+	return stats, exists, nil
+}
+
+// List returns the statistics of all running domains.
+func (c *Collector) List() ([]*cli.DomainStats, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := c.refreshIfStale(); err != nil {
+		return nil, err
+	}
+	list := make([]*cli.DomainStats, 0, len(c.stats))
+	for _, stats := range c.stats {
+		list = append(list, stats)
+	}
+	return list, nil
+}
+
+type cachedQueueStats struct {
+	queues []QueueStats
+	err    error
+}
+
+func (c *Collector) refreshIfStale() error {
+	now := c.now()
+	if c.stats != nil && now.Sub(c.timestamp) < c.ttl {
+		return nil
+	}
+
+	list, err := c.virConn.GetAllDomainStats(collectedStats, libvirt.CONNECT_GET_ALL_DOMAINS_STATS_ACTIVE)
+	if err != nil {
+		return err
+	}
+	c.stats = make(map[string]*cli.DomainStats, len(list))
+	c.queues = make(map[string]cachedQueueStats)
+	for _, stats := range list {
+		c.stats[stats.Name] = stats
+	}
+	c.timestamp = now
+	return nil
+}
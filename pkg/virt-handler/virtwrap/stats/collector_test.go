@@ -0,0 +1,95 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package stats
+
+import (
+	"time"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Collector", func() {
+	var ctrl *gomock.Controller
+	var mockConn *cli.MockConnection
+	var collector *Collector
+	var now time.Time
+
+	domainStats := []*cli.DomainStats{
+		{Name: "default_testvm", DomainStats: &libvirt.DomainStats{}},
+		{Name: "default_othervm", DomainStats: &libvirt.DomainStats{}},
+	}
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockConn = cli.NewMockConnection(ctrl)
+		collector = NewCollector(mockConn, DefaultCollectorTTL)
+		now = time.Now()
+		collector.now = func() time.Time { return now }
+	})
+
+	It("should serve all domains from a single call", func() {
+		mockConn.EXPECT().GetAllDomainStats(collectedStats, libvirt.CONNECT_GET_ALL_DOMAINS_STATS_ACTIVE).Return(domainStats, nil)
+
+		stats, exists, err := collector.Get("default_testvm")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(exists).To(BeTrue())
+		Expect(stats).To(Equal(domainStats[0]))
+
+		_, exists, err = collector.Get("default_unknownvm")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(exists).To(BeFalse())
+
+		list, err := collector.List()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(list).To(ConsistOf(domainStats[0], domainStats[1]))
+	})
+
+	It("should refresh the stats after the TTL expired", func() {
+		mockConn.EXPECT().GetAllDomainStats(collectedStats, libvirt.CONNECT_GET_ALL_DOMAINS_STATS_ACTIVE).Return(domainStats, nil)
+		_, err := collector.List()
+		Expect(err).ToNot(HaveOccurred())
+
+		now = now.Add(DefaultCollectorTTL)
+		mockConn.EXPECT().GetAllDomainStats(collectedStats, libvirt.CONNECT_GET_ALL_DOMAINS_STATS_ACTIVE).Return(domainStats[1:], nil)
+		_, exists, err := collector.Get("default_testvm")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(exists).To(BeFalse())
+	})
+
+	It("should retry after a failed refresh", func() {
+		mockConn.EXPECT().GetAllDomainStats(collectedStats, libvirt.CONNECT_GET_ALL_DOMAINS_STATS_ACTIVE).Return(nil, libvirt.Error{Code: libvirt.ERR_INTERNAL_ERROR})
+		_, err := collector.List()
+		Expect(err).To(HaveOccurred())
+
+		mockConn.EXPECT().GetAllDomainStats(collectedStats, libvirt.CONNECT_GET_ALL_DOMAINS_STATS_ACTIVE).Return(domainStats, nil)
+		list, err := collector.List()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(list).To(HaveLen(2))
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+})
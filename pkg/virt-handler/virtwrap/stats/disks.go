@@ -0,0 +1,83 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package stats
+
+import (
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+// DiskStats are the I/O counters of a disk of a domain, as qemu accounts
+// them. Times are the sums over all requests in nanoseconds, the latencies
+// the average time a request took since the domain started.
+type DiskStats struct {
+	Name          string `json:"name"`
+	ReadRequests  uint64 `json:"readRequests"`
+	ReadBytes     uint64 `json:"readBytes"`
+	ReadTime      uint64 `json:"readTime"`
+	WriteRequests uint64 `json:"writeRequests"`
+	WriteBytes    uint64 `json:"writeBytes"`
+	WriteTime     uint64 `json:"writeTime"`
+	FlushRequests uint64 `json:"flushRequests"`
+	FlushTime     uint64 `json:"flushTime"`
+	TotalTime     uint64 `json:"totalTime"`
+	ReadLatency   uint64 `json:"readLatency"`
+	WriteLatency  uint64 `json:"writeLatency"`
+	FlushLatency  uint64 `json:"flushLatency"`
+}
+
+func averageLatency(time uint64, requests uint64) uint64 {
+	if requests == 0 {
+		return 0
+	}
+	return time / requests
+}
+
+func newDiskStats(block *libvirt.DomainStatsBlock) DiskStats {
+	return DiskStats{
+		Name:          block.Name,
+		ReadRequests:  block.RdReqs,
+		ReadBytes:     block.RdBytes,
+		ReadTime:      block.RdTimes,
+		WriteRequests: block.WrReqs,
+		WriteBytes:    block.WrBytes,
+		WriteTime:     block.WrTimes,
+		FlushRequests: block.FlReqs,
+		FlushTime:     block.FlTimes,
+		TotalTime:     block.RdTimes + block.WrTimes + block.FlTimes,
+		ReadLatency:   averageLatency(block.RdTimes, block.RdReqs),
+		WriteLatency:  averageLatency(block.WrTimes, block.WrReqs),
+		FlushLatency:  averageLatency(block.FlTimes, block.FlReqs),
+	}
+}
+
+// DiskStats returns the I/O counters and latencies of all disks of the
+// domain with the given name. These are the read, write and flush times
+// libvirt reports per disk with virDomainBlockStatsFlags, they come with the
+// bulk stats. The second return value is false if the domain is not running.
+func (c *Collector) DiskStats(name string) ([]DiskStats, bool, error) {
+	stats, exists, err := c.Get(name)
+	if err != nil || !exists {
+		return nil, exists, err
+	}
+	disks := make([]DiskStats, 0, len(stats.Block))
+	for i := range stats.Block {
+		disks = append(disks, newDiskStats(&stats.Block[i]))
+	}
+	return disks, true, nil
+}
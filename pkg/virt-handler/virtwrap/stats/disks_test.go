@@ -0,0 +1,81 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package stats
+
+import (
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Disk stats", func() {
+	var ctrl *gomock.Controller
+	var mockConn *cli.MockConnection
+	var collector *Collector
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockConn = cli.NewMockConnection(ctrl)
+		collector = NewCollector(mockConn, DefaultCollectorTTL)
+
+		mockConn.EXPECT().GetAllDomainStats(collectedStats, libvirt.CONNECT_GET_ALL_DOMAINS_STATS_ACTIVE).Return([]*cli.DomainStats{
+			{Name: "default_testvm", DomainStats: &libvirt.DomainStats{Block: []libvirt.DomainStatsBlock{
+				{Name: "vda", RdReqs: 10, RdBytes: 40960, RdTimes: 5000, WrReqs: 4, WrBytes: 16384, WrTimes: 8000, FlReqs: 2, FlTimes: 3000},
+				{Name: "vdb"},
+			}}},
+		}, nil)
+	})
+
+	It("should report the times and latencies of all disks", func() {
+		disks, exists, err := collector.DiskStats("default_testvm")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(exists).To(BeTrue())
+		Expect(disks).To(Equal([]DiskStats{
+			{
+				Name:          "vda",
+				ReadRequests:  10,
+				ReadBytes:     40960,
+				ReadTime:      5000,
+				WriteRequests: 4,
+				WriteBytes:    16384,
+				WriteTime:     8000,
+				FlushRequests: 2,
+				FlushTime:     3000,
+				TotalTime:     16000,
+				ReadLatency:   500,
+				WriteLatency:  2000,
+				FlushLatency:  1500,
+			},
+			{Name: "vdb"},
+		}))
+	})
+
+	It("should tell if the domain is not running", func() {
+		_, exists, err := collector.DiskStats("default_othervm")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(exists).To(BeFalse())
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+})
@@ -0,0 +1,180 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package stats
+
+import (
+	"bufio"
+	"bytes"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+// libvirt only reports the totals of an interface. Counters per queue are
+// read with ethtool from the host device, if its driver exports them, e.g.
+// for SR-IOV VFs or vhost-user ports. tap devices don't, neither does qemu.
+// The devices live in the network namespace of the host, which virt-handler
+// enters through the host init process.
+var ethtoolCommand = []string{"nsenter", "--net=/proc/1/ns/net", "ethtool"}
+
+// Names of per queue counters of the common drivers, e.g. rx_queue_0_packets,
+// tx-1.bytes or rx2_packets
+var queueCounter = regexp.MustCompile(`^(rx|tx)(?:_queue_|-|)(\d+)[._](packets|bytes)$`)
+
+// InterfaceStats are the counters of an interface of a domain, as seen from
+// the host, received means sent by the guest.
+type InterfaceStats struct {
+	Name      string       `json:"name"`
+	RxBytes   uint64       `json:"rxBytes"`
+	RxPackets uint64       `json:"rxPackets"`
+	RxErrors  uint64       `json:"rxErrors"`
+	RxDrops   uint64       `json:"rxDrops"`
+	TxBytes   uint64       `json:"txBytes"`
+	TxPackets uint64       `json:"txPackets"`
+	TxErrors  uint64       `json:"txErrors"`
+	TxDrops   uint64       `json:"txDrops"`
+	Queues    []QueueStats `json:"queues,omitempty"`
+}
+
+// QueueStats are the counters of a single queue of a multiqueue interface.
+type QueueStats struct {
+	Queue     uint   `json:"queue"`
+	RxBytes   uint64 `json:"rxBytes"`
+	RxPackets uint64 `json:"rxPackets"`
+	TxBytes   uint64 `json:"txBytes"`
+	TxPackets uint64 `json:"txPackets"`
+}
+
+func newInterfaceStats(net *libvirt.DomainStatsNet) InterfaceStats {
+	return InterfaceStats{
+		Name:      net.Name,
+		RxBytes:   net.RxBytes,
+		RxPackets: net.RxPkts,
+		RxErrors:  net.RxErrs,
+		RxDrops:   net.RxDrop,
+		TxBytes:   net.TxBytes,
+		TxPackets: net.TxPkts,
+		TxErrors:  net.TxErrs,
+		TxDrops:   net.TxDrop,
+	}
+}
+
+// parseQueueStats picks the per queue counters out of the output of
+// ethtool -S.
+func parseQueueStats(output []byte) []QueueStats {
+	queues := map[uint]*QueueStats{}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), ":", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		match := queueCounter.FindStringSubmatch(strings.TrimSpace(fields[0]))
+		if match == nil {
+			continue
+		}
+		index, err := strconv.ParseUint(match[2], 10, 32)
+		if err != nil {
+			continue
+		}
+		value, err := strconv.ParseUint(strings.TrimSpace(fields[1]), 10, 64)
+		if err != nil {
+			continue
+		}
+		queue, exists := queues[uint(index)]
+		if !exists {
+			queue = &QueueStats{Queue: uint(index)}
+			queues[uint(index)] = queue
+		}
+		switch match[1] + "_" + match[3] {
+		case "rx_bytes":
+			queue.RxBytes = value
+		case "rx_packets":
+			queue.RxPackets = value
+		case "tx_bytes":
+			queue.TxBytes = value
+		case "tx_packets":
+			queue.TxPackets = value
+		}
+	}
+
+	list := make([]QueueStats, 0, len(queues))
+	for _, queue := range queues {
+		list = append(list, *queue)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Queue < list[j].Queue })
+	return list
+}
+
+func readQueueStats(device string) ([]QueueStats, error) {
+	args := append([]string{}, ethtoolCommand[1:]...)
+	args = append(args, "-S", device)
+	output, err := exec.Command(ethtoolCommand[0], args...).Output()
+	if err != nil {
+		return nil, err
+	}
+	return parseQueueStats(output), nil
+}
+
+// queueStats returns the per queue counters of the host device. They are
+// cached like the domain statistics, including failures, so that devices
+// without them are not asked again on every query.
+func (c *Collector) queueStats(device string) ([]QueueStats, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if cached, exists := c.queues[device]; exists {
+		return cached.queues, cached.err
+	}
+	queues, err := readQueueStats(device)
+	if c.queues != nil {
+		c.queues[device] = cachedQueueStats{queues: queues, err: err}
+	}
+	return queues, err
+}
+
+// InterfaceStats returns the counters of all interfaces of the domain with
+// the given name, including errors, drops and, where the host device
+// reports them, the counters of every queue. The second return value is
+// false if the domain is not running.
+func (c *Collector) InterfaceStats(name string) ([]InterfaceStats, bool, error) {
+	stats, exists, err := c.Get(name)
+	if err != nil || !exists {
+		return nil, exists, err
+	}
+	interfaces := make([]InterfaceStats, 0, len(stats.Net))
+	for i := range stats.Net {
+		iface := newInterfaceStats(&stats.Net[i])
+		queues, err := c.queueStats(iface.Name)
+		if err != nil {
+			logging.DefaultLogger().Info().V(4).Reason(err).With("domain", name).Msgf("No queue stats for interface %s.", iface.Name)
+		}
+		// Single queue interfaces have nothing to add to the totals
+		if len(queues) > 1 {
+			iface.Queues = queues
+		}
+		interfaces = append(interfaces, iface)
+	}
+	return interfaces, true, nil
+}
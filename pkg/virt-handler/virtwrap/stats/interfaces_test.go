@@ -0,0 +1,124 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package stats
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Interface stats", func() {
+
+	ethtoolOutput := `NIC statistics:
+     rx_queue_0_packets: 10
+     rx_queue_0_bytes: 1000
+     rx_queue_1_packets: 20
+     rx_queue_1_bytes: 2000
+     tx_queue_0_packets: 30
+     tx_queue_0_bytes: 3000
+     tx_queue_1_packets: 40
+     tx_queue_1_bytes: 4000
+     rx_dropped: 2
+`
+
+	It("should parse the per queue counters of ethtool", func() {
+		Expect(parseQueueStats([]byte(ethtoolOutput))).To(Equal([]QueueStats{
+			{Queue: 0, RxPackets: 10, RxBytes: 1000, TxPackets: 30, TxBytes: 3000},
+			{Queue: 1, RxPackets: 20, RxBytes: 2000, TxPackets: 40, TxBytes: 4000},
+		}))
+	})
+
+	It("should understand other counter names", func() {
+		Expect(parseQueueStats([]byte("     tx-1.bytes: 5\n     rx2_packets: 7\n"))).To(Equal([]QueueStats{
+			{Queue: 1, TxBytes: 5},
+			{Queue: 2, RxPackets: 7},
+		}))
+	})
+
+	Context("with a collector", func() {
+		var ctrl *gomock.Controller
+		var mockConn *cli.MockConnection
+		var collector *Collector
+		var tmpDir string
+		var originalEthtoolCommand []string
+
+		BeforeEach(func() {
+			var err error
+			ctrl = gomock.NewController(GinkgoT())
+			mockConn = cli.NewMockConnection(ctrl)
+			collector = NewCollector(mockConn, DefaultCollectorTTL)
+			tmpDir, err = ioutil.TempDir("", "ethtool")
+			Expect(err).ToNot(HaveOccurred())
+			originalEthtoolCommand = ethtoolCommand
+			ethtoolCommand = []string{"/bin/sh", filepath.Join(tmpDir, "ethtool")}
+			script := "echo \"$2\" >> " + filepath.Join(tmpDir, "calls") + "\nif [ \"$2\" = vnet0 ]; then\ncat <<EOF\n" + ethtoolOutput + "EOF\nelse\nexit 1\nfi\n"
+			Expect(ioutil.WriteFile(ethtoolCommand[1], []byte(script), 0644)).To(Succeed())
+
+			mockConn.EXPECT().GetAllDomainStats(collectedStats, libvirt.CONNECT_GET_ALL_DOMAINS_STATS_ACTIVE).Return([]*cli.DomainStats{
+				{Name: "default_testvm", DomainStats: &libvirt.DomainStats{Net: []libvirt.DomainStatsNet{
+					{Name: "vnet0", RxBytes: 3000, RxPkts: 30, RxErrs: 1, RxDrop: 2, TxBytes: 7000, TxPkts: 70, TxErrs: 3, TxDrop: 4},
+					{Name: "vnet1", RxBytes: 100, RxPkts: 1},
+				}}},
+			}, nil)
+		})
+
+		It("should report errors, drops and queues of all interfaces", func() {
+			interfaces, exists, err := collector.InterfaceStats("default_testvm")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(exists).To(BeTrue())
+			Expect(interfaces).To(HaveLen(2))
+			Expect(interfaces[0].RxErrors).To(Equal(uint64(1)))
+			Expect(interfaces[0].RxDrops).To(Equal(uint64(2)))
+			Expect(interfaces[0].TxErrors).To(Equal(uint64(3)))
+			Expect(interfaces[0].TxDrops).To(Equal(uint64(4)))
+			Expect(interfaces[0].Queues).To(HaveLen(2))
+			Expect(interfaces[1].Queues).To(BeEmpty())
+		})
+
+		It("should ask ethtool only once per device until the stats are refreshed", func() {
+			for i := 0; i < 2; i++ {
+				_, _, err := collector.InterfaceStats("default_testvm")
+				Expect(err).ToNot(HaveOccurred())
+			}
+			calls, err := ioutil.ReadFile(filepath.Join(tmpDir, "calls"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(calls)).To(Equal("vnet0\nvnet1\n"))
+		})
+
+		It("should tell if the domain is not running", func() {
+			_, exists, err := collector.InterfaceStats("default_othervm")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(exists).To(BeFalse())
+		})
+
+		AfterEach(func() {
+			ethtoolCommand = originalEthtoolCommand
+			os.RemoveAll(tmpDir)
+			ctrl.Finish()
+		})
+	})
+})
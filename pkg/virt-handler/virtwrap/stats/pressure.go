@@ -0,0 +1,255 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package stats
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+// libvirt does not report how long the vCPUs of a domain had to wait for a
+// host CPU, so the CPU steal is calculated from the scheduler statistics of
+// the qemu threads.
+var qemuPidDir = "/var/run/libvirt/qemu"
+var procRoot = "/proc"
+
+type PressureResource string
+
+const (
+	// Memory pages dirtied per second, only known while the domain is migrated
+	DirtyRate PressureResource = "DirtyRate"
+	// Percentage of the time the vCPUs were runnable but not running
+	CPUSteal PressureResource = "CPUSteal"
+	// KiB per second swapped in and out by the guest
+	SwapRate PressureResource = "SwapRate"
+)
+
+// PressureThresholds define above which values a domain is under pressure.
+// A zero threshold disables the check.
+type PressureThresholds struct {
+	DirtyRate uint64
+	CPUSteal  float64
+	SwapRate  uint64
+}
+
+// PressureEvent is published whenever a resource of a domain crosses its
+// threshold, in either direction.
+type PressureEvent struct {
+	Domain    string
+	Resource  PressureResource
+	Value     float64
+	Threshold float64
+	Exceeded  bool
+}
+
+type pressureSample struct {
+	timestamp time.Time
+	runDelay  uint64
+	swapIn    uint64
+	swapOut   uint64
+}
+
+type PressureSampler struct {
+	virConn    cli.Connection
+	interval   time.Duration
+	thresholds PressureThresholds
+	events     chan PressureEvent
+	samples    map[string]*pressureSample
+	exceeded   map[string]map[PressureResource]bool
+}
+
+func NewPressureSampler(virConn cli.Connection, interval time.Duration, thresholds PressureThresholds) *PressureSampler {
+	return &PressureSampler{
+		virConn:    virConn,
+		interval:   interval,
+		thresholds: thresholds,
+		events:     make(chan PressureEvent, 100),
+		samples:    make(map[string]*pressureSample),
+		exceeded:   make(map[string]map[PressureResource]bool),
+	}
+}
+
+// Events returns the channel on which threshold crossings are published.
+func (s *PressureSampler) Events() <-chan PressureEvent {
+	return s.events
+}
+
+// Run samples all running domains every interval until stopChan is closed.
+func (s *PressureSampler) Run(stopChan chan struct{}) {
+	wait.Until(func() {
+		if err := s.Sample(); err != nil {
+			logging.DefaultLogger().Error().Reason(err).Msg("Sampling the domain pressure failed.")
+		}
+	}, s.interval, stopChan)
+}
+
+// Sample collects the pressure of all running domains once. Rates can only
+// be calculated from the second sample of a domain on.
+func (s *PressureSampler) Sample() error {
+	doms, err := s.virConn.ListAllDomains(libvirt.CONNECT_LIST_DOMAINS_ACTIVE)
+	if err != nil {
+		return err
+	}
+
+	seen := map[string]bool{}
+	for _, dom := range doms {
+		name, err := dom.GetName()
+		if err == nil {
+			seen[name] = true
+			err = s.sampleDomain(name, dom)
+		}
+		dom.Free()
+		if err != nil {
+			logging.DefaultLogger().Error().Reason(err).Msgf("Sampling the pressure of domain %s failed.", name)
+		}
+	}
+
+	for name := range s.samples {
+		if !seen[name] {
+			delete(s.samples, name)
+			delete(s.exceeded, name)
+		}
+	}
+	return nil
+}
+
+func (s *PressureSampler) sampleDomain(name string, dom cli.VirDomain) error {
+	now := time.Now()
+	current := &pressureSample{timestamp: now}
+
+	memStats, err := dom.MemoryStats(uint32(libvirt.DOMAIN_MEMORY_STAT_NR), 0)
+	if err != nil {
+		return err
+	}
+	for _, stat := range memStats {
+		switch libvirt.DomainMemoryStatTags(stat.Tag) {
+		case libvirt.DOMAIN_MEMORY_STAT_SWAP_IN:
+			current.swapIn = stat.Val
+		case libvirt.DOMAIN_MEMORY_STAT_SWAP_OUT:
+			current.swapOut = stat.Val
+		}
+	}
+
+	// Steal is only an indicator, don't give up on the other resources
+	current.runDelay, err = qemuRunDelay(name)
+	if err != nil {
+		logging.DefaultLogger().V(3).Info().Reason(err).Msgf("Reading the run delay of domain %s failed.", name)
+	}
+
+	jobInfo, err := dom.GetJobStats(0)
+	if err != nil {
+		return err
+	}
+	if jobInfo.Type != libvirt.DOMAIN_JOB_NONE {
+		s.check(name, DirtyRate, float64(jobInfo.MemDirtyRate), float64(s.thresholds.DirtyRate))
+	}
+
+	previous, exists := s.samples[name]
+	s.samples[name] = current
+	if !exists {
+		return nil
+	}
+
+	elapsed := current.timestamp.Sub(previous.timestamp)
+	if elapsed <= 0 {
+		return nil
+	}
+	if current.runDelay >= previous.runDelay {
+		steal := float64(current.runDelay-previous.runDelay) / float64(elapsed.Nanoseconds()) * 100
+		s.check(name, CPUSteal, steal, s.thresholds.CPUSteal)
+	}
+	if current.swapIn >= previous.swapIn && current.swapOut >= previous.swapOut {
+		swapped := current.swapIn - previous.swapIn + current.swapOut - previous.swapOut
+		s.check(name, SwapRate, float64(swapped)/elapsed.Seconds(), float64(s.thresholds.SwapRate))
+	}
+	return nil
+}
+
+// check publishes an event if the value crossed the threshold since the
+// last check.
+func (s *PressureSampler) check(name string, resource PressureResource, value float64, threshold float64) {
+	if threshold == 0 {
+		return
+	}
+	if s.exceeded[name] == nil {
+		s.exceeded[name] = make(map[PressureResource]bool)
+	}
+	exceeded := value > threshold
+	if exceeded == s.exceeded[name][resource] {
+		return
+	}
+	s.exceeded[name][resource] = exceeded
+
+	event := PressureEvent{
+		Domain:    name,
+		Resource:  resource,
+		Value:     value,
+		Threshold: threshold,
+		Exceeded:  exceeded,
+	}
+	select {
+	case s.events <- event:
+	default:
+		logging.DefaultLogger().Warning().Msgf("Dropping %s pressure event of domain %s, nobody is listening.", resource, name)
+	}
+}
+
+// qemuRunDelay returns the nanoseconds all threads of the qemu process of
+// the domain spent waiting on a run queue.
+func qemuRunDelay(name string) (uint64, error) {
+	content, err := ioutil.ReadFile(filepath.Join(qemuPidDir, name+".pid"))
+	if err != nil {
+		return 0, err
+	}
+	pid := strings.TrimSpace(string(content))
+
+	tasks, err := ioutil.ReadDir(filepath.Join(procRoot, pid, "task"))
+	if err != nil {
+		return 0, err
+	}
+	var runDelay uint64
+	for _, task := range tasks {
+		schedstat, err := ioutil.ReadFile(filepath.Join(procRoot, pid, "task", task.Name(), "schedstat"))
+		if err != nil {
+			// The thread is already gone
+			continue
+		}
+		fields := strings.Fields(string(schedstat))
+		if len(fields) < 2 {
+			return 0, fmt.Errorf("unexpected schedstat format of task %s: %s", task.Name(), schedstat)
+		}
+		delay, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		runDelay += delay
+	}
+	return runDelay, nil
+}
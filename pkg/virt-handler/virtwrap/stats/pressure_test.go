@@ -0,0 +1,137 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package stats
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("PressureSampler", func() {
+	var tmpDir string
+	var originalQemuPidDir, originalProcRoot string
+	var ctrl *gomock.Controller
+	var mockConn *cli.MockConnection
+	var mockDomain *cli.MockVirDomain
+	var sampler *PressureSampler
+
+	writeSchedstat := func(task string, runDelay string) {
+		taskDir := filepath.Join(tmpDir, "proc", "4711", "task", task)
+		Expect(os.MkdirAll(taskDir, 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(taskDir, "schedstat"), []byte("1000 "+runDelay+" 10\n"), 0644)).To(Succeed())
+	}
+
+	expectSample := func(swapIn uint64, jobType libvirt.DomainJobType, dirtyRate uint64) {
+		mockConn.EXPECT().ListAllDomains(libvirt.CONNECT_LIST_DOMAINS_ACTIVE).Return([]cli.VirDomain{mockDomain}, nil)
+		mockDomain.EXPECT().GetName().Return("default_testvm", nil)
+		mockDomain.EXPECT().MemoryStats(uint32(libvirt.DOMAIN_MEMORY_STAT_NR), uint32(0)).Return([]libvirt.DomainMemoryStat{
+			{Tag: int32(libvirt.DOMAIN_MEMORY_STAT_SWAP_IN), Val: swapIn},
+			{Tag: int32(libvirt.DOMAIN_MEMORY_STAT_SWAP_OUT), Val: 0},
+		}, nil)
+		mockDomain.EXPECT().GetJobStats(libvirt.DomainGetJobStatsFlags(0)).Return(&libvirt.DomainJobInfo{Type: jobType, MemDirtyRate: dirtyRate}, nil)
+		mockDomain.EXPECT().Free()
+	}
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "pressure")
+		Expect(err).ToNot(HaveOccurred())
+		originalQemuPidDir, originalProcRoot = qemuPidDir, procRoot
+		qemuPidDir = filepath.Join(tmpDir, "qemu")
+		procRoot = filepath.Join(tmpDir, "proc")
+		Expect(os.MkdirAll(qemuPidDir, 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(qemuPidDir, "default_testvm.pid"), []byte("4711"), 0644)).To(Succeed())
+
+		ctrl = gomock.NewController(GinkgoT())
+		mockConn = cli.NewMockConnection(ctrl)
+		mockDomain = cli.NewMockVirDomain(ctrl)
+		sampler = NewPressureSampler(mockConn, time.Second, PressureThresholds{DirtyRate: 1000, CPUSteal: 10, SwapRate: 1})
+	})
+
+	It("should sum up the run delay of all qemu threads", func() {
+		writeSchedstat("4711", "100")
+		writeSchedstat("4712", "200")
+		runDelay, err := qemuRunDelay("default_testvm")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(runDelay).To(Equal(uint64(300)))
+	})
+
+	It("should publish an event when the dirty rate of a migrating domain exceeds the threshold", func() {
+		expectSample(0, libvirt.DOMAIN_JOB_UNBOUNDED, 5000)
+		Expect(sampler.Sample()).To(Succeed())
+
+		Expect(sampler.Events()).To(Receive(Equal(PressureEvent{
+			Domain:    "default_testvm",
+			Resource:  DirtyRate,
+			Value:     5000,
+			Threshold: 1000,
+			Exceeded:  true,
+		})))
+	})
+
+	It("should publish an event when swapping starts and stops", func() {
+		expectSample(0, libvirt.DOMAIN_JOB_NONE, 0)
+		Expect(sampler.Sample()).To(Succeed())
+		Expect(sampler.Events()).ToNot(Receive())
+
+		expectSample(1024*1024, libvirt.DOMAIN_JOB_NONE, 0)
+		Expect(sampler.Sample()).To(Succeed())
+		var event PressureEvent
+		Expect(sampler.Events()).To(Receive(&event))
+		Expect(event.Resource).To(Equal(SwapRate))
+		Expect(event.Exceeded).To(BeTrue())
+
+		// Only crossings are published
+		expectSample(2*1024*1024, libvirt.DOMAIN_JOB_NONE, 0)
+		Expect(sampler.Sample()).To(Succeed())
+		Expect(sampler.Events()).ToNot(Receive())
+
+		expectSample(2*1024*1024, libvirt.DOMAIN_JOB_NONE, 0)
+		Expect(sampler.Sample()).To(Succeed())
+		Expect(sampler.Events()).To(Receive(&event))
+		Expect(event.Resource).To(Equal(SwapRate))
+		Expect(event.Exceeded).To(BeFalse())
+	})
+
+	It("should forget domains which are not running anymore", func() {
+		expectSample(0, libvirt.DOMAIN_JOB_NONE, 0)
+		Expect(sampler.Sample()).To(Succeed())
+		Expect(sampler.samples).To(HaveKey("default_testvm"))
+
+		mockConn.EXPECT().ListAllDomains(libvirt.CONNECT_LIST_DOMAINS_ACTIVE).Return([]cli.VirDomain{}, nil)
+		Expect(sampler.Sample()).To(Succeed())
+		Expect(sampler.samples).To(BeEmpty())
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+		qemuPidDir, procRoot = originalQemuPidDir, originalProcRoot
+		os.RemoveAll(tmpDir)
+	})
+})
@@ -0,0 +1,60 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package storage
+
+import (
+	"encoding/xml"
+)
+
+type PoolSpec struct {
+	XMLName xml.Name   `xml:"pool"`
+	Type    string     `xml:"type,attr"`
+	Name    string     `xml:"name"`
+	UUID    string     `xml:"uuid,omitempty"`
+	Target  PoolTarget `xml:"target"`
+}
+
+type PoolTarget struct {
+	Path string `xml:"path"`
+}
+
+type VolumeSpec struct {
+	XMLName    xml.Name     `xml:"volume"`
+	Type       string       `xml:"type,attr,omitempty"`
+	Name       string       `xml:"name"`
+	Key        string       `xml:"key,omitempty"`
+	Capacity   Size         `xml:"capacity"`
+	Allocation *Size        `xml:"allocation,omitempty"`
+	Target     VolumeTarget `xml:"target"`
+}
+
+type Size struct {
+	Unit  string `xml:"unit,attr,omitempty"`
+	Value uint64 `xml:",chardata"`
+}
+
+type VolumeTarget struct {
+	Path   string        `xml:"path,omitempty"`
+	Format *VolumeFormat `xml:"format,omitempty"`
+}
+
+type VolumeFormat struct {
+	Type string `xml:"type,attr"`
+}
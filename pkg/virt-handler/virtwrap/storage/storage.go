@@ -0,0 +1,347 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package storage
+
+//go:generate mockgen -source $GOFILE -package=$GOPACKAGE -destination=generated_mock_$GOFILE
+
+/*
+ ATTENTION: Rerun code generators when interface signatures are modified.
+*/
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/net/context"
+
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	domainerrors "kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/errors"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+type StorageManager interface {
+	SyncPool(name string, path string) error
+	CreateVolume(pool string, name string, format string, capacity uint64) (string, error)
+	CloneVolume(pool string, source string, name string) (string, error)
+	ResizeVolume(pool string, name string, capacity uint64) error
+	DeleteVolume(pool string, name string) error
+	UploadVolume(pool string, name string, reader io.Reader, length uint64) error
+	DownloadVolume(pool string, name string, writer io.Writer) error
+}
+
+type LibvirtStorageManager struct {
+	virConn cli.Connection
+}
+
+func NewLibvirtStorageManager(connection cli.Connection) StorageManager {
+	return &LibvirtStorageManager{virConn: connection}
+}
+
+// SyncPool makes sure that a directory based pool with the given name exists,
+// is built and is running.
+func (l *LibvirtStorageManager) SyncPool(name string, path string) error {
+	pool, err := l.virConn.LookupStoragePoolByName(name)
+	if err != nil {
+		if !domainerrors.IsStoragePoolNotFound(err) {
+			logging.DefaultLogger().Error().Reason(err).Msgf("Getting the storage pool %s failed.", name)
+			return err
+		}
+		xmlStr, err := xml.Marshal(&PoolSpec{Type: "dir", Name: name, Target: PoolTarget{Path: path}})
+		if err != nil {
+			return err
+		}
+		pool, err = l.virConn.StoragePoolDefineXML(string(xmlStr))
+		if err != nil {
+			logging.DefaultLogger().Error().Reason(err).Msgf("Defining the storage pool %s failed.", name)
+			return err
+		}
+		if err := pool.Build(libvirt.STORAGE_POOL_BUILD_NEW); err != nil {
+			pool.Free()
+			logging.DefaultLogger().Error().Reason(err).Msgf("Building the storage pool %s failed.", name)
+			return err
+		}
+		logging.DefaultLogger().Info().Msgf("Storage pool %s defined.", name)
+	}
+	defer pool.Free()
+
+	active, err := pool.IsActive()
+	if err != nil {
+		return err
+	}
+	if !active {
+		if err := pool.Create(libvirt.STORAGE_POOL_CREATE_NORMAL); err != nil {
+			logging.DefaultLogger().Error().Reason(err).Msgf("Starting the storage pool %s failed.", name)
+			return err
+		}
+		logging.DefaultLogger().Info().Msgf("Storage pool %s started.", name)
+	}
+	return pool.SetAutostart(true)
+}
+
+// CreateVolume creates a new volume and returns its path.
+func (l *LibvirtStorageManager) CreateVolume(poolName string, name string, format string, capacity uint64) (string, error) {
+	spec := &VolumeSpec{
+		Name:     name,
+		Capacity: Size{Unit: "bytes", Value: capacity},
+	}
+	if format != "" {
+		spec.Target.Format = &VolumeFormat{Type: format}
+	}
+	xmlStr, err := xml.Marshal(spec)
+	if err != nil {
+		return "", err
+	}
+
+	pool, err := l.virConn.LookupStoragePoolByName(poolName)
+	if err != nil {
+		return "", err
+	}
+	defer pool.Free()
+
+	vol, err := pool.StorageVolCreateXML(string(xmlStr), 0)
+	if err != nil {
+		logging.DefaultLogger().Error().Reason(err).Msgf("Creating the volume %s in pool %s failed.", name, poolName)
+		return "", err
+	}
+	defer vol.Free()
+	return vol.GetPath()
+}
+
+// CloneVolume creates the volume name as a copy of the volume source of the
+// same pool and returns the path of the copy.
+func (l *LibvirtStorageManager) CloneVolume(poolName string, source string, name string) (string, error) {
+	pool, err := l.virConn.LookupStoragePoolByName(poolName)
+	if err != nil {
+		return "", err
+	}
+	defer pool.Free()
+
+	sourceSpec, err := lookupVolumeSpec(pool, source)
+	if err != nil {
+		return "", err
+	}
+	spec := &VolumeSpec{
+		Name:     name,
+		Capacity: sourceSpec.Capacity,
+		Target:   VolumeTarget{Format: sourceSpec.Target.Format},
+	}
+	xmlStr, err := xml.Marshal(spec)
+	if err != nil {
+		return "", err
+	}
+
+	vol, err := pool.StorageVolCreateXMLFrom(string(xmlStr), source, 0)
+	if err != nil {
+		logging.DefaultLogger().Error().Reason(err).Msgf("Cloning the volume %s in pool %s failed.", source, poolName)
+		return "", err
+	}
+	defer vol.Free()
+	return vol.GetPath()
+}
+
+// ResizeVolume grows the volume to the given capacity. Shrinking is refused,
+// since it would destroy the data at the end of the volume.
+func (l *LibvirtStorageManager) ResizeVolume(poolName string, name string, capacity uint64) error {
+	vol, err := l.lookupVolume(poolName, name)
+	if err != nil {
+		return err
+	}
+	defer vol.Free()
+
+	info, err := vol.GetInfo()
+	if err != nil {
+		return err
+	}
+	if capacity < info.Capacity {
+		return fmt.Errorf("shrinking volume %s from %d to %d bytes is not supported", name, info.Capacity, capacity)
+	}
+	return vol.Resize(capacity, 0)
+}
+
+// DeleteVolume removes the volume. It is not an error if it does not exist.
+func (l *LibvirtStorageManager) DeleteVolume(poolName string, name string) error {
+	vol, err := l.lookupVolume(poolName, name)
+	if err != nil {
+		if domainerrors.IsStorageVolNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	defer vol.Free()
+	return vol.Delete(libvirt.STORAGE_VOL_DELETE_NORMAL)
+}
+
+// UploadVolume replaces the content of the volume with length bytes read
+// from reader. Regular files which end after length bytes are uploaded as
+// sparse stream, so that holes in them don't end up as allocated zeros in
+// the volume.
+func (l *LibvirtStorageManager) UploadVolume(poolName string, name string, reader io.Reader, length uint64) error {
+	vol, err := l.lookupVolume(poolName, name)
+	if err != nil {
+		return err
+	}
+	defer vol.Free()
+
+	file, sparse := regularFile(reader)
+	var start int64
+	if sparse {
+		if start, err = file.Seek(0, io.SeekCurrent); err != nil {
+			return err
+		}
+		info, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		// The sparse stream sends everything up to the end of the file
+		sparse = info.Size()-start == int64(length)
+	}
+	var flags libvirt.StorageVolUploadFlags
+	if sparse {
+		flags = libvirt.STORAGE_VOL_UPLOAD_SPARSE_STREAM
+	}
+
+	stream, err := l.virConn.NewStream(0)
+	if err != nil {
+		return err
+	}
+	if err := vol.Upload(stream.UnderlyingStream(), 0, length, flags); err != nil {
+		stream.Free()
+		return err
+	}
+	opts := cli.CopyOptions{Operation: "upload"}
+	if sparse {
+		// Holes are not counted as transferred, but seeked over
+		_, err = stream.CopyToStreamSparse(context.Background(), file, opts)
+		if err == nil {
+			err = checkTransferred(file, start, length)
+		}
+	} else {
+		var n int64
+		n, err = stream.CopyToStream(context.Background(), io.LimitReader(reader, int64(length)), opts)
+		if err == nil && n != int64(length) {
+			err = io.ErrUnexpectedEOF
+		}
+	}
+	return finishStream(stream, err)
+}
+
+// DownloadVolume writes the whole content of the volume to writer. Regular
+// files are downloaded as sparse stream and keep the holes of the volume.
+func (l *LibvirtStorageManager) DownloadVolume(poolName string, name string, writer io.Writer) error {
+	vol, err := l.lookupVolume(poolName, name)
+	if err != nil {
+		return err
+	}
+	defer vol.Free()
+
+	file, sparse := regularFile(writer)
+	var flags libvirt.StorageVolDownloadFlags
+	if sparse {
+		flags = libvirt.STORAGE_VOL_DOWNLOAD_SPARSE_STREAM
+	}
+
+	stream, err := l.virConn.NewStream(0)
+	if err != nil {
+		return err
+	}
+	// A length of 0 downloads everything
+	if err := vol.Download(stream.UnderlyingStream(), 0, 0, flags); err != nil {
+		stream.Free()
+		return err
+	}
+	opts := cli.CopyOptions{Operation: "download"}
+	if sparse {
+		_, err = stream.CopyFromStreamSparse(context.Background(), file, opts)
+	} else {
+		_, err = stream.CopyFromStream(context.Background(), writer, opts)
+	}
+	return finishStream(stream, err)
+}
+
+// regularFile returns the file behind v, if it is a regular file. Only those
+// can be seeked for holes, pipes, sockets and terminals can't.
+func regularFile(v interface{}) (*os.File, bool) {
+	file, ok := v.(*os.File)
+	if !ok {
+		return nil, false
+	}
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return nil, false
+	}
+	return file, true
+}
+
+// checkTransferred verifies that a sparse transfer, which started at the
+// offset start of file, covered length bytes.
+func checkTransferred(file *os.File, start int64, length uint64) error {
+	end, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if end-start != int64(length) {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// finishStream ends a transfer. libvirt keeps the job of the stream open
+// until it is finished or aborted, so the stream is aborted if the transfer
+// or finishing it failed.
+func finishStream(stream cli.Stream, err error) error {
+	defer stream.Free()
+	if err == nil {
+		err = stream.Finish()
+	}
+	if err != nil {
+		stream.Abort()
+	}
+	return err
+}
+
+func (l *LibvirtStorageManager) lookupVolume(poolName string, name string) (cli.VirStorageVol, error) {
+	pool, err := l.virConn.LookupStoragePoolByName(poolName)
+	if err != nil {
+		return nil, err
+	}
+	defer pool.Free()
+	return pool.LookupStorageVolByName(name)
+}
+
+func lookupVolumeSpec(pool cli.VirStoragePool, name string) (*VolumeSpec, error) {
+	vol, err := pool.LookupStorageVolByName(name)
+	if err != nil {
+		return nil, err
+	}
+	defer vol.Free()
+
+	xmlStr, err := vol.GetXMLDesc(0)
+	if err != nil {
+		return nil, err
+	}
+	var spec VolumeSpec
+	if err := xml.Unmarshal([]byte(xmlStr), &spec); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
@@ -0,0 +1,290 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package storage
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Storage", func() {
+	var ctrl *gomock.Controller
+	var mockConn *cli.MockConnection
+	var mockPool *cli.MockVirStoragePool
+	var mockVol *cli.MockVirStorageVol
+	var manager StorageManager
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockConn = cli.NewMockConnection(ctrl)
+		mockPool = cli.NewMockVirStoragePool(ctrl)
+		mockVol = cli.NewMockVirStorageVol(ctrl)
+		manager = NewLibvirtStorageManager(mockConn)
+	})
+
+	Context("on syncing a pool", func() {
+		It("should define, build and start a missing pool", func() {
+			poolXML, err := xml.Marshal(&PoolSpec{Type: "dir", Name: "ephemeral", Target: PoolTarget{Path: "/var/run/kubevirt"}})
+			Expect(err).ToNot(HaveOccurred())
+
+			mockConn.EXPECT().LookupStoragePoolByName("ephemeral").Return(nil, libvirt.Error{Code: libvirt.ERR_NO_STORAGE_POOL})
+			mockConn.EXPECT().StoragePoolDefineXML(string(poolXML)).Return(mockPool, nil)
+			mockPool.EXPECT().Build(libvirt.STORAGE_POOL_BUILD_NEW).Return(nil)
+			mockPool.EXPECT().IsActive().Return(false, nil)
+			mockPool.EXPECT().Create(libvirt.STORAGE_POOL_CREATE_NORMAL).Return(nil)
+			mockPool.EXPECT().SetAutostart(true).Return(nil)
+			mockPool.EXPECT().Free()
+
+			Expect(manager.SyncPool("ephemeral", "/var/run/kubevirt")).To(Succeed())
+		})
+
+		It("should leave a running pool alone", func() {
+			mockConn.EXPECT().LookupStoragePoolByName("ephemeral").Return(mockPool, nil)
+			mockPool.EXPECT().IsActive().Return(true, nil)
+			mockPool.EXPECT().SetAutostart(true).Return(nil)
+			mockPool.EXPECT().Free()
+
+			Expect(manager.SyncPool("ephemeral", "/var/run/kubevirt")).To(Succeed())
+		})
+	})
+
+	Context("on managing volumes", func() {
+		BeforeEach(func() {
+			mockConn.EXPECT().LookupStoragePoolByName("ephemeral").Return(mockPool, nil)
+			mockPool.EXPECT().Free()
+		})
+
+		It("should create a volume", func() {
+			volXML, err := xml.Marshal(&VolumeSpec{
+				Name:     "disk.qcow2",
+				Capacity: Size{Unit: "bytes", Value: 1024},
+				Target:   VolumeTarget{Format: &VolumeFormat{Type: "qcow2"}},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			mockPool.EXPECT().StorageVolCreateXML(string(volXML), libvirt.StorageVolCreateFlags(0)).Return(mockVol, nil)
+			mockVol.EXPECT().GetPath().Return("/var/run/kubevirt/disk.qcow2", nil)
+			mockVol.EXPECT().Free()
+
+			path, err := manager.CreateVolume("ephemeral", "disk.qcow2", "qcow2", 1024)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(path).To(Equal("/var/run/kubevirt/disk.qcow2"))
+		})
+
+		It("should clone a volume with the format and capacity of the source", func() {
+			sourceVol := cli.NewMockVirStorageVol(ctrl)
+			volXML, err := xml.Marshal(&VolumeSpec{
+				Name:     "clone.qcow2",
+				Capacity: Size{Unit: "bytes", Value: 1024},
+				Target:   VolumeTarget{Format: &VolumeFormat{Type: "qcow2"}},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			mockPool.EXPECT().LookupStorageVolByName("disk.qcow2").Return(sourceVol, nil)
+			sourceVol.EXPECT().GetXMLDesc(uint32(0)).Return(`<volume><name>disk.qcow2</name><capacity unit="bytes">1024</capacity><target><path>/var/run/kubevirt/disk.qcow2</path><format type="qcow2"/></target></volume>`, nil)
+			sourceVol.EXPECT().Free()
+			mockPool.EXPECT().StorageVolCreateXMLFrom(string(volXML), "disk.qcow2", libvirt.StorageVolCreateFlags(0)).Return(mockVol, nil)
+			mockVol.EXPECT().GetPath().Return("/var/run/kubevirt/clone.qcow2", nil)
+			mockVol.EXPECT().Free()
+
+			path, err := manager.CloneVolume("ephemeral", "disk.qcow2", "clone.qcow2")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(path).To(Equal("/var/run/kubevirt/clone.qcow2"))
+		})
+
+		It("should grow a volume", func() {
+			mockPool.EXPECT().LookupStorageVolByName("disk.qcow2").Return(mockVol, nil)
+			mockVol.EXPECT().GetInfo().Return(&libvirt.StorageVolInfo{Capacity: 1024}, nil)
+			mockVol.EXPECT().Resize(uint64(2048), libvirt.StorageVolResizeFlags(0)).Return(nil)
+			mockVol.EXPECT().Free()
+
+			Expect(manager.ResizeVolume("ephemeral", "disk.qcow2", 2048)).To(Succeed())
+		})
+
+		It("should refuse to shrink a volume", func() {
+			mockPool.EXPECT().LookupStorageVolByName("disk.qcow2").Return(mockVol, nil)
+			mockVol.EXPECT().GetInfo().Return(&libvirt.StorageVolInfo{Capacity: 2048}, nil)
+			mockVol.EXPECT().Free()
+
+			Expect(manager.ResizeVolume("ephemeral", "disk.qcow2", 1024)).ToNot(Succeed())
+		})
+
+		It("should ignore deleting a missing volume", func() {
+			mockPool.EXPECT().LookupStorageVolByName("disk.qcow2").Return(nil, libvirt.Error{Code: libvirt.ERR_NO_STORAGE_VOL})
+
+			Expect(manager.DeleteVolume("ephemeral", "disk.qcow2")).To(Succeed())
+		})
+
+		It("should upload the content of a volume through a stream", func() {
+			mockStream := cli.NewMockStream(ctrl)
+			mockPool.EXPECT().LookupStorageVolByName("disk.qcow2").Return(mockVol, nil)
+			mockConn.EXPECT().NewStream(libvirt.StreamFlags(0)).Return(mockStream, nil)
+			mockStream.EXPECT().UnderlyingStream().Return(nil)
+			mockVol.EXPECT().Upload(gomock.Any(), uint64(0), uint64(4), libvirt.StorageVolUploadFlags(0)).Return(nil)
+			mockStream.EXPECT().CopyToStream(gomock.Any(), gomock.Any(), cli.CopyOptions{Operation: "upload"}).Return(int64(4), nil)
+			mockStream.EXPECT().Finish().Return(nil)
+			mockStream.EXPECT().Free()
+			mockVol.EXPECT().Free()
+
+			Expect(manager.UploadVolume("ephemeral", "disk.qcow2", bytes.NewBufferString("data"), 4)).To(Succeed())
+		})
+
+		It("should abort the stream if the upload fails", func() {
+			mockStream := cli.NewMockStream(ctrl)
+			mockPool.EXPECT().LookupStorageVolByName("disk.qcow2").Return(mockVol, nil)
+			mockConn.EXPECT().NewStream(libvirt.StreamFlags(0)).Return(mockStream, nil)
+			mockStream.EXPECT().UnderlyingStream().Return(nil)
+			mockVol.EXPECT().Upload(gomock.Any(), uint64(0), uint64(4), libvirt.StorageVolUploadFlags(0)).Return(nil)
+			mockStream.EXPECT().CopyToStream(gomock.Any(), gomock.Any(), cli.CopyOptions{Operation: "upload"}).Return(int64(2), nil)
+			mockStream.EXPECT().Abort()
+			mockStream.EXPECT().Free()
+			mockVol.EXPECT().Free()
+
+			Expect(manager.UploadVolume("ephemeral", "disk.qcow2", bytes.NewBufferString("da"), 4)).ToNot(Succeed())
+		})
+
+		It("should upload a file as sparse stream", func() {
+			file, err := ioutil.TempFile("", "volume")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(file.Name())
+			defer file.Close()
+			Expect(file.Truncate(4)).To(Succeed())
+
+			mockStream := cli.NewMockStream(ctrl)
+			mockPool.EXPECT().LookupStorageVolByName("disk.qcow2").Return(mockVol, nil)
+			mockConn.EXPECT().NewStream(libvirt.StreamFlags(0)).Return(mockStream, nil)
+			mockStream.EXPECT().UnderlyingStream().Return(nil)
+			mockVol.EXPECT().Upload(gomock.Any(), uint64(0), uint64(4), libvirt.STORAGE_VOL_UPLOAD_SPARSE_STREAM).Return(nil)
+			mockStream.EXPECT().CopyToStreamSparse(gomock.Any(), file, cli.CopyOptions{Operation: "upload"}).Do(func(_ interface{}, file *os.File, _ cli.CopyOptions) {
+				file.Seek(0, io.SeekEnd)
+			}).Return(int64(0), nil)
+			mockStream.EXPECT().Finish().Return(nil)
+			mockStream.EXPECT().Free()
+			mockVol.EXPECT().Free()
+
+			Expect(manager.UploadVolume("ephemeral", "disk.qcow2", file, 4)).To(Succeed())
+		})
+
+		It("should abort a sparse upload which did not cover the whole file", func() {
+			file, err := ioutil.TempFile("", "volume")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(file.Name())
+			defer file.Close()
+			Expect(file.Truncate(4)).To(Succeed())
+
+			mockStream := cli.NewMockStream(ctrl)
+			mockPool.EXPECT().LookupStorageVolByName("disk.qcow2").Return(mockVol, nil)
+			mockConn.EXPECT().NewStream(libvirt.StreamFlags(0)).Return(mockStream, nil)
+			mockStream.EXPECT().UnderlyingStream().Return(nil)
+			mockVol.EXPECT().Upload(gomock.Any(), uint64(0), uint64(4), libvirt.STORAGE_VOL_UPLOAD_SPARSE_STREAM).Return(nil)
+			mockStream.EXPECT().CopyToStreamSparse(gomock.Any(), file, cli.CopyOptions{Operation: "upload"}).Return(int64(2), nil)
+			mockStream.EXPECT().Abort()
+			mockStream.EXPECT().Free()
+			mockVol.EXPECT().Free()
+
+			Expect(manager.UploadVolume("ephemeral", "disk.qcow2", file, 4)).ToNot(Succeed())
+		})
+
+		It("should upload only length bytes of larger files", func() {
+			file, err := ioutil.TempFile("", "volume")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(file.Name())
+			defer file.Close()
+			Expect(file.Truncate(8)).To(Succeed())
+
+			mockStream := cli.NewMockStream(ctrl)
+			mockPool.EXPECT().LookupStorageVolByName("disk.qcow2").Return(mockVol, nil)
+			mockConn.EXPECT().NewStream(libvirt.StreamFlags(0)).Return(mockStream, nil)
+			mockStream.EXPECT().UnderlyingStream().Return(nil)
+			mockVol.EXPECT().Upload(gomock.Any(), uint64(0), uint64(4), libvirt.StorageVolUploadFlags(0)).Return(nil)
+			mockStream.EXPECT().CopyToStream(gomock.Any(), gomock.Any(), cli.CopyOptions{Operation: "upload"}).Return(int64(4), nil)
+			mockStream.EXPECT().Finish().Return(nil)
+			mockStream.EXPECT().Free()
+			mockVol.EXPECT().Free()
+
+			Expect(manager.UploadVolume("ephemeral", "disk.qcow2", file, 4)).To(Succeed())
+		})
+
+		It("should not upload pipes as sparse stream", func() {
+			reader, writer, err := os.Pipe()
+			Expect(err).ToNot(HaveOccurred())
+			defer reader.Close()
+			defer writer.Close()
+
+			mockStream := cli.NewMockStream(ctrl)
+			mockPool.EXPECT().LookupStorageVolByName("disk.qcow2").Return(mockVol, nil)
+			mockConn.EXPECT().NewStream(libvirt.StreamFlags(0)).Return(mockStream, nil)
+			mockStream.EXPECT().UnderlyingStream().Return(nil)
+			mockVol.EXPECT().Upload(gomock.Any(), uint64(0), uint64(4), libvirt.StorageVolUploadFlags(0)).Return(nil)
+			mockStream.EXPECT().CopyToStream(gomock.Any(), gomock.Any(), cli.CopyOptions{Operation: "upload"}).Return(int64(4), nil)
+			mockStream.EXPECT().Finish().Return(nil)
+			mockStream.EXPECT().Free()
+			mockVol.EXPECT().Free()
+
+			Expect(manager.UploadVolume("ephemeral", "disk.qcow2", reader, 4)).To(Succeed())
+		})
+
+		It("should abort the stream if finishing it fails", func() {
+			mockStream := cli.NewMockStream(ctrl)
+			mockPool.EXPECT().LookupStorageVolByName("disk.qcow2").Return(mockVol, nil)
+			mockConn.EXPECT().NewStream(libvirt.StreamFlags(0)).Return(mockStream, nil)
+			mockStream.EXPECT().UnderlyingStream().Return(nil)
+			mockVol.EXPECT().Download(gomock.Any(), uint64(0), uint64(0), libvirt.StorageVolDownloadFlags(0)).Return(nil)
+			mockStream.EXPECT().CopyFromStream(gomock.Any(), gomock.Any(), cli.CopyOptions{Operation: "download"}).Return(int64(4), nil)
+			mockStream.EXPECT().Finish().Return(libvirt.Error{Code: libvirt.ERR_RPC})
+			mockStream.EXPECT().Abort()
+			mockStream.EXPECT().Free()
+			mockVol.EXPECT().Free()
+
+			Expect(manager.DownloadVolume("ephemeral", "disk.qcow2", &bytes.Buffer{})).ToNot(Succeed())
+		})
+
+		It("should download a volume into a file as sparse stream", func() {
+			file, err := ioutil.TempFile("", "volume")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(file.Name())
+			defer file.Close()
+
+			mockStream := cli.NewMockStream(ctrl)
+			mockPool.EXPECT().LookupStorageVolByName("disk.qcow2").Return(mockVol, nil)
+			mockConn.EXPECT().NewStream(libvirt.StreamFlags(0)).Return(mockStream, nil)
+			mockStream.EXPECT().UnderlyingStream().Return(nil)
+			mockVol.EXPECT().Download(gomock.Any(), uint64(0), uint64(0), libvirt.STORAGE_VOL_DOWNLOAD_SPARSE_STREAM).Return(nil)
+			mockStream.EXPECT().CopyFromStreamSparse(gomock.Any(), file, cli.CopyOptions{Operation: "download"}).Return(int64(4), nil)
+			mockStream.EXPECT().Finish().Return(nil)
+			mockStream.EXPECT().Free()
+			mockVol.EXPECT().Free()
+
+			Expect(manager.DownloadVolume("ephemeral", "disk.qcow2", file)).To(Succeed())
+		})
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+})
@@ -0,0 +1,97 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/satori/go.uuid"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+)
+
+// SMBIOS system entries which libvirt accepts.
+var smbiosSystemEntries = map[string]bool{
+	"manufacturer": true,
+	"product":      true,
+	"version":      true,
+	"serial":       true,
+	"uuid":         true,
+	"sku":          true,
+	"family":       true,
+}
+
+// systemEntries merges the SMBIOS system entries of the spec with the ones
+// from the annotations of the VM. Annotations win.
+func systemEntries(vm *v1.VirtualMachine) map[string]string {
+	entries := map[string]string{}
+	if vm.Spec.Domain != nil && vm.Spec.Domain.SysInfo != nil {
+		for _, entry := range vm.Spec.Domain.SysInfo.System {
+			entries[entry.Name] = entry.Value
+		}
+	}
+	for key, value := range vm.GetObjectMeta().GetAnnotations() {
+		if strings.HasPrefix(key, v1.SMBIOSAnnotationPrefix) {
+			entries[strings.TrimPrefix(key, v1.SMBIOSAnnotationPrefix)] = value
+		}
+	}
+	return entries
+}
+
+// prepareSysInfo writes the SMBIOS system entries into the domain and makes
+// the guest see them instead of the ones of the host.
+func prepareSysInfo(vm *v1.VirtualMachine, spec *api.DomainSpec) error {
+	entries := systemEntries(vm)
+	if len(entries) == 0 {
+		return nil
+	}
+
+	for name := range entries {
+		if !smbiosSystemEntries[name] {
+			return fmt.Errorf("unsupported SMBIOS system entry %s", name)
+		}
+	}
+	if value, exists := entries["uuid"]; exists {
+		if _, err := uuid.FromString(value); err != nil {
+			return fmt.Errorf("invalid SMBIOS uuid %s: %v", value, err)
+		}
+	}
+
+	// Keep the order stable, so that the domain XML does not change between syncs
+	system := []api.Entry{}
+	for _, name := range []string{"manufacturer", "product", "version", "serial", "uuid", "sku", "family"} {
+		if value, exists := entries[name]; exists {
+			system = append(system, api.Entry{Name: name, Value: value})
+		}
+	}
+
+	if spec.SysInfo == nil {
+		spec.SysInfo = &api.SysInfo{}
+	}
+	spec.SysInfo.Type = "smbios"
+	spec.SysInfo.System = system
+	if spec.OS.SMBios == nil {
+		spec.OS.SMBios = &api.SMBios{}
+	}
+	spec.OS.SMBios.Mode = "sysinfo"
+	return nil
+}
@@ -0,0 +1,92 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+)
+
+var _ = Describe("SMBIOS", func() {
+	var vm *v1.VirtualMachine
+	var spec *api.DomainSpec
+
+	BeforeEach(func() {
+		vm = newVM("default", "testvm")
+		vm.Spec.Domain = &v1.DomainSpec{}
+		spec = api.NewMinimalDomainSpec("testvm")
+	})
+
+	It("should leave the domain alone without SMBIOS entries", func() {
+		Expect(prepareSysInfo(vm, spec)).To(Succeed())
+		Expect(spec.SysInfo).To(BeNil())
+		Expect(spec.OS.SMBios).To(BeNil())
+	})
+
+	It("should let annotations override the entries of the spec", func() {
+		vm.Spec.Domain.SysInfo = &v1.SysInfo{
+			System: []v1.Entry{
+				{Name: "serial", Value: "spec-serial"},
+				{Name: "manufacturer", Value: "KubeVirt"},
+			},
+		}
+		vm.ObjectMeta.Annotations = map[string]string{
+			v1.SMBIOSAnnotationPrefix + "serial": "annotated-serial",
+			v1.SMBIOSAnnotationPrefix + "family": "Virtual Machine",
+		}
+
+		Expect(prepareSysInfo(vm, spec)).To(Succeed())
+		Expect(spec.SysInfo.Type).To(Equal("smbios"))
+		Expect(spec.SysInfo.System).To(Equal([]api.Entry{
+			{Name: "manufacturer", Value: "KubeVirt"},
+			{Name: "serial", Value: "annotated-serial"},
+			{Name: "family", Value: "Virtual Machine"},
+		}))
+		Expect(spec.OS.SMBios.Mode).To(Equal("sysinfo"))
+	})
+
+	It("should only put a custom SMBIOS uuid into the sysinfo", func() {
+		vm.ObjectMeta.Annotations = map[string]string{
+			v1.SMBIOSAnnotationPrefix + "uuid": "4b20d080-1b54-4048-85b3-a6a62d165c01",
+		}
+		vm.ObjectMeta.UID = "5f6b3a4e-1d8c-4b2a-9e0f-7c3d2b1a0e9f"
+		spec.UUID = string(vm.GetObjectMeta().GetUID())
+		Expect(prepareSysInfo(vm, spec)).To(Succeed())
+		Expect(spec.SysInfo.System).To(Equal([]api.Entry{{Name: "uuid", Value: "4b20d080-1b54-4048-85b3-a6a62d165c01"}}))
+		Expect(spec.UUID).To(Equal("5f6b3a4e-1d8c-4b2a-9e0f-7c3d2b1a0e9f"))
+	})
+
+	It("should reject an invalid uuid", func() {
+		vm.ObjectMeta.Annotations = map[string]string{
+			v1.SMBIOSAnnotationPrefix + "uuid": "not-a-uuid",
+		}
+		Expect(prepareSysInfo(vm, spec)).ToNot(Succeed())
+	})
+
+	It("should reject unknown entries", func() {
+		vm.ObjectMeta.Annotations = map[string]string{
+			v1.SMBIOSAnnotationPrefix + "asset": "1234",
+		}
+		Expect(prepareSysInfo(vm, spec)).ToNot(Succeed())
+	})
+})
@@ -0,0 +1,114 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	domainerrors "kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/errors"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+// The title and the description of a domain show up in host side tools like
+// "virsh list --title", so we fill them with the identity of the VM instead
+// of leaving admins with the mangled domain name.
+
+// domainTitle is the namespace and the name of the VM. libvirt only allows a
+// single line.
+func domainTitle(vm *v1.VirtualMachine) string {
+	return fmt.Sprintf("%s/%s", vm.GetObjectMeta().GetNamespace(), vm.GetObjectMeta().GetName())
+}
+
+// domainDescription lists the labels of the VM, one per line and sorted, so
+// that the description only changes if the labels do.
+func domainDescription(vm *v1.VirtualMachine) string {
+	labels := vm.GetObjectMeta().GetLabels()
+	lines := make([]string, 0, len(labels))
+	for key, value := range labels {
+		lines = append(lines, key+"="+value)
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+// GetTitle returns the title of the domain, or an empty string if it has
+// none.
+func GetTitle(dom cli.VirDomain) (string, error) {
+	return getDomainText(dom, libvirt.DOMAIN_METADATA_TITLE, libvirt.DOMAIN_AFFECT_CONFIG)
+}
+
+// GetDescription returns the description of the domain, or an empty string
+// if it has none.
+func GetDescription(dom cli.VirDomain) (string, error) {
+	return getDomainText(dom, libvirt.DOMAIN_METADATA_DESCRIPTION, libvirt.DOMAIN_AFFECT_CONFIG)
+}
+
+func getDomainText(dom cli.VirDomain, metadataType libvirt.DomainMetadataType, flags libvirt.DomainModificationImpact) (string, error) {
+	text, err := dom.GetMetadata(metadataType, "", flags)
+	if err != nil {
+		if domainerrors.IsMetadataNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return text, nil
+}
+
+// syncTitle updates the title and the description of a running domain, e.g.
+// after the labels of the VM changed. Defining the domain again would only
+// change them on its next start.
+func (l *LibvirtDomainManager) syncTitle(vm *v1.VirtualMachine, dom cli.VirDomain, spec *api.DomainSpec) (bool, error) {
+	texts := []struct {
+		operation    string
+		metadataType libvirt.DomainMetadataType
+		wanted       string
+	}{
+		{"set-title", libvirt.DOMAIN_METADATA_TITLE, spec.Title},
+		{"set-description", libvirt.DOMAIN_METADATA_DESCRIPTION, spec.Description},
+	}
+	changed := false
+	for _, text := range texts {
+		current, err := getDomainText(dom, text.metadataType, libvirt.DOMAIN_AFFECT_LIVE)
+		if err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the domain title failed.")
+			return changed, err
+		}
+		if current == text.wanted {
+			continue
+		}
+		err = dom.SetMetadata(text.wanted, text.metadataType, "", "", libvirt.DOMAIN_AFFECT_LIVE|libvirt.DOMAIN_AFFECT_CONFIG)
+		l.audit(vm, TriggerVMController, text.operation, text.wanted, err)
+		if err != nil {
+			logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Setting the domain title failed.")
+			return changed, err
+		}
+		changed = true
+	}
+	if changed {
+		logging.DefaultLogger().Object(vm).Info().V(3).Msg("Domain title updated.")
+	}
+	return changed, nil
+}
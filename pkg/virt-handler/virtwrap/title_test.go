@@ -0,0 +1,88 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Domain title and description", func() {
+	var ctrl *gomock.Controller
+	var mockDomain *cli.MockVirDomain
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockDomain = cli.NewMockVirDomain(ctrl)
+	})
+
+	It("should identify the VM", func() {
+		vm := newVM("default", "testvm")
+		vm.ObjectMeta.Labels = map[string]string{"kubevirt.io/nodeName": "master", "app": "db"}
+
+		Expect(domainTitle(vm)).To(Equal("default/testvm"))
+		Expect(domainDescription(vm)).To(Equal("app=db\nkubevirt.io/nodeName=master"))
+	})
+
+	It("should read the title and the description of the domain", func() {
+		mockDomain.EXPECT().GetMetadata(libvirt.DOMAIN_METADATA_TITLE, "", libvirt.DOMAIN_AFFECT_CONFIG).Return("default/testvm", nil)
+		mockDomain.EXPECT().GetMetadata(libvirt.DOMAIN_METADATA_DESCRIPTION, "", libvirt.DOMAIN_AFFECT_CONFIG).Return("", libvirt.Error{Code: libvirt.ERR_NO_DOMAIN_METADATA})
+
+		Expect(GetTitle(mockDomain)).To(Equal("default/testvm"))
+		Expect(GetDescription(mockDomain)).To(BeEmpty())
+	})
+
+	It("should update the title and the description of running domains", func() {
+		vm := newVM("default", "testvm")
+		vm.ObjectMeta.Labels = map[string]string{"app": "db"}
+		spec := &api.DomainSpec{Title: domainTitle(vm), Description: domainDescription(vm)}
+		manager := &LibvirtDomainManager{}
+
+		mockDomain.EXPECT().GetMetadata(libvirt.DOMAIN_METADATA_TITLE, "", libvirt.DOMAIN_AFFECT_LIVE).Return("default/testvm", nil)
+		mockDomain.EXPECT().GetMetadata(libvirt.DOMAIN_METADATA_DESCRIPTION, "", libvirt.DOMAIN_AFFECT_LIVE).Return("app=web", nil)
+		mockDomain.EXPECT().SetMetadata("app=db", libvirt.DOMAIN_METADATA_DESCRIPTION, "", "", libvirt.DOMAIN_AFFECT_LIVE|libvirt.DOMAIN_AFFECT_CONFIG).Return(nil)
+
+		changed, err := manager.syncTitle(vm, mockDomain, spec)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(changed).To(BeTrue())
+		Expect(manager.GetAuditTrail(vm)[0].Operation).To(Equal("set-description"))
+	})
+
+	It("should leave current titles alone", func() {
+		vm := newVM("default", "testvm")
+		spec := &api.DomainSpec{Title: domainTitle(vm), Description: domainDescription(vm)}
+
+		mockDomain.EXPECT().GetMetadata(libvirt.DOMAIN_METADATA_TITLE, "", libvirt.DOMAIN_AFFECT_LIVE).Return("default/testvm", nil)
+		mockDomain.EXPECT().GetMetadata(libvirt.DOMAIN_METADATA_DESCRIPTION, "", libvirt.DOMAIN_AFFECT_LIVE).Return("", libvirt.Error{Code: libvirt.ERR_NO_DOMAIN_METADATA})
+
+		changed, err := (&LibvirtDomainManager{}).syncTitle(vm, mockDomain, spec)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(changed).To(BeFalse())
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+})
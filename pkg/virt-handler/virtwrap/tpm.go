@@ -0,0 +1,140 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cache"
+)
+
+// libvirt keeps the swtpm state of a domain in a directory named after the
+// domain UUID and removes it when the domain is undefined. To keep the state
+// of persistent TPMs, we move it out of the way before undefining the domain
+// and move it back before the domain is defined again. The libvirt data
+// directory is mounted into virt-handler, the saved states are kept on it
+// too, so that moving them is just a rename.
+var swtpmStateRoot = "/var/lib/libvirt/swtpm"
+var tpmPersistentStateRoot = "/var/lib/libvirt/kubevirt/swtpm"
+
+func hasTPM(vm *v1.VirtualMachine) bool {
+	return vm.Spec.Domain != nil && vm.Spec.Domain.Devices.TPM != nil
+}
+
+func hasPersistentTPM(vm *v1.VirtualMachine) bool {
+	return hasTPM(vm) && vm.Spec.Domain.Devices.TPM.Persistent
+}
+
+func hasEncryptedTPM(vm *v1.VirtualMachine) bool {
+	return hasTPM(vm) && vm.Spec.Domain.Devices.TPM.EncryptionSecret != ""
+}
+
+func swtpmStateDir(vm *v1.VirtualMachine) string {
+	return filepath.Join(swtpmStateRoot, string(vm.GetObjectMeta().GetUID()))
+}
+
+func tpmPersistentStateDir(vm *v1.VirtualMachine) string {
+	return filepath.Join(tpmPersistentStateRoot, cache.VMNamespaceKeyFunc(vm))
+}
+
+// restoreTPMState moves a previously saved TPM state back to where swtpm
+// expects it.
+func restoreTPMState(vm *v1.VirtualMachine) error {
+	if !hasPersistentTPM(vm) {
+		return nil
+	}
+	// Without the libvirt data directory the state would silently get lost
+	if _, err := os.Stat(filepath.Dir(swtpmStateRoot)); err != nil {
+		return fmt.Errorf("the libvirt data directory is not available: %v", err)
+	}
+	saved := tpmPersistentStateDir(vm)
+	if _, err := os.Stat(saved); os.IsNotExist(err) {
+		return nil
+	}
+	target := swtpmStateDir(vm)
+	if err := os.RemoveAll(target); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0711); err != nil {
+		return err
+	}
+	return os.Rename(saved, target)
+}
+
+// saveTPMState moves the TPM state of a persistent TPM out of the way, so
+// that it survives undefining the domain. swtpm only creates the state when
+// the guest starts, so it has to exist once the guest was started.
+func saveTPMState(vm *v1.VirtualMachine, started bool) error {
+	if !hasPersistentTPM(vm) {
+		return nil
+	}
+	source := swtpmStateDir(vm)
+	if _, err := os.Stat(source); os.IsNotExist(err) {
+		if started {
+			return fmt.Errorf("the TPM state %s of the started guest is missing", source)
+		}
+		return nil
+	} else if err != nil {
+		return err
+	}
+	saved := tpmPersistentStateDir(vm)
+	if err := os.RemoveAll(saved); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(tpmPersistentStateRoot, 0700); err != nil {
+		return err
+	}
+	return os.Rename(source, saved)
+}
+
+// removeTPMState wipes all TPM state of an ephemeral TPM.
+func removeTPMState(vm *v1.VirtualMachine) error {
+	if !hasTPM(vm) || hasPersistentTPM(vm) {
+		return nil
+	}
+	if err := os.RemoveAll(swtpmStateDir(vm)); err != nil {
+		return err
+	}
+	return os.RemoveAll(tpmPersistentStateDir(vm))
+}
+
+// removeSavedTPMState wipes the saved state of a persistent TPM, once the VM
+// is deleted.
+func removeSavedTPMState(vm *v1.VirtualMachine) error {
+	return os.RemoveAll(tpmPersistentStateDir(vm))
+}
+
+// prepareTPMEncryption points the TPM backend to the vtpm secret which holds
+// the key of the TPM state. The secret has to be synced beforehand.
+func (l *LibvirtDomainManager) prepareTPMEncryption(vm *v1.VirtualMachine, spec *api.DomainSpec) error {
+	if !hasEncryptedTPM(vm) || spec.Devices.TPM == nil {
+		return nil
+	}
+	secretUUID, err := l.lookupSecretUUID("vtpm", vm.Spec.Domain.Devices.TPM.EncryptionSecret)
+	if err != nil {
+		return err
+	}
+	spec.Devices.TPM.Backend.Encryption = &api.TPMEncryption{Secret: secretUUID}
+	return nil
+}
@@ -0,0 +1,101 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/types"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+)
+
+var _ = Describe("TPM state", func() {
+	var tmpDir string
+	var originalStateRoot, originalPersistentStateRoot string
+	var vm *v1.VirtualMachine
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "swtpm")
+		Expect(err).ToNot(HaveOccurred())
+		originalStateRoot, originalPersistentStateRoot = swtpmStateRoot, tpmPersistentStateRoot
+		swtpmStateRoot = filepath.Join(tmpDir, "libvirt")
+		tpmPersistentStateRoot = filepath.Join(tmpDir, "kubevirt")
+
+		vm = newVM("default", "testvm")
+		vm.ObjectMeta.UID = types.UID("1234")
+		vm.Spec.Domain.Devices.TPM = &v1.TPM{Model: "tpm-crb", Backend: v1.TPMBackend{Type: "emulator", Version: "2.0"}}
+		Expect(os.MkdirAll(filepath.Join(swtpmStateRoot, "1234"), 0700)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(swtpmStateRoot, "1234", "tpm2-00.permall"), []byte("state"), 0600)).To(Succeed())
+	})
+
+	It("should keep the state of persistent TPMs across domain definitions", func() {
+		vm.Spec.Domain.Devices.TPM.Persistent = true
+
+		Expect(saveTPMState(vm, true)).To(Succeed())
+		Expect(filepath.Join(swtpmStateRoot, "1234")).ToNot(BeADirectory())
+		Expect(removeTPMState(vm)).To(Succeed())
+		Expect(filepath.Join(tpmPersistentStateRoot, "default_testvm", "tpm2-00.permall")).To(BeARegularFile())
+
+		Expect(restoreTPMState(vm)).To(Succeed())
+		Expect(filepath.Join(swtpmStateRoot, "1234", "tpm2-00.permall")).To(BeARegularFile())
+		Expect(filepath.Join(tpmPersistentStateRoot, "default_testvm")).ToNot(BeADirectory())
+	})
+
+	It("should wipe the state of ephemeral TPMs", func() {
+		Expect(saveTPMState(vm, true)).To(Succeed())
+		Expect(removeTPMState(vm)).To(Succeed())
+		Expect(filepath.Join(swtpmStateRoot, "1234")).ToNot(BeADirectory())
+		Expect(filepath.Join(tpmPersistentStateRoot, "default_testvm")).ToNot(BeADirectory())
+	})
+
+	It("should wipe the saved state of persistent TPMs of deleted VMs", func() {
+		vm.Spec.Domain.Devices.TPM.Persistent = true
+		Expect(saveTPMState(vm, true)).To(Succeed())
+
+		Expect(removeSavedTPMState(newVM("default", "testvm"))).To(Succeed())
+		Expect(filepath.Join(tpmPersistentStateRoot, "default_testvm")).ToNot(BeADirectory())
+	})
+
+	It("should only accept a missing TPM state of guests which never started", func() {
+		vm.Spec.Domain.Devices.TPM.Persistent = true
+		Expect(os.RemoveAll(filepath.Join(swtpmStateRoot, "1234"))).To(Succeed())
+
+		Expect(saveTPMState(vm, false)).To(Succeed())
+		Expect(saveTPMState(vm, true)).ToNot(Succeed())
+	})
+
+	It("should fail without the libvirt data directory", func() {
+		vm.Spec.Domain.Devices.TPM.Persistent = true
+		swtpmStateRoot = filepath.Join(tmpDir, "missing", "swtpm")
+
+		Expect(restoreTPMState(vm)).ToNot(Succeed())
+	})
+
+	AfterEach(func() {
+		swtpmStateRoot, tpmPersistentStateRoot = originalStateRoot, originalPersistentStateRoot
+		os.RemoveAll(tmpDir)
+	})
+})
@@ -0,0 +1,73 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+)
+
+// prepareVhostUserInterfaces fills in the defaults of vhost-user interfaces
+// and checks that the guest memory can be shared with the dataplane, e.g.
+// OVS-DPDK or VPP. The dataplane accesses the virtio rings in the guest
+// memory directly, which only works with shared hugepages.
+func prepareVhostUserInterfaces(spec *api.DomainSpec) error {
+	hasVhostUser := false
+	for i := range spec.Devices.Interfaces {
+		iface := &spec.Devices.Interfaces[i]
+		if iface.Type != "vhostuser" {
+			continue
+		}
+		hasVhostUser = true
+
+		if iface.Source.Path == "" || !filepath.IsAbs(iface.Source.Path) {
+			return fmt.Errorf("vhostuser interface %d needs an absolute socket path", i)
+		}
+		iface.Source.Type = "unix"
+		if iface.Source.Mode == "" {
+			iface.Source.Mode = "client"
+		}
+		if iface.Source.Mode != "client" && iface.Source.Mode != "server" {
+			return fmt.Errorf("unsupported vhostuser socket mode %s", iface.Source.Mode)
+		}
+		if iface.Model == nil {
+			iface.Model = &api.Model{Type: "virtio"}
+		}
+		if iface.Model.Type != "virtio" {
+			return fmt.Errorf("vhostuser interface %d must use the virtio model", i)
+		}
+	}
+	if !hasVhostUser {
+		return nil
+	}
+
+	if spec.MemoryBacking == nil || spec.MemoryBacking.HugePages == nil {
+		return fmt.Errorf("vhostuser interfaces need the guest memory to be backed by hugepages")
+	}
+	if spec.MemoryBacking.Access == nil {
+		spec.MemoryBacking.Access = &api.MemoryAccess{Mode: "shared"}
+	}
+	if spec.MemoryBacking.Access.Mode != "shared" {
+		return fmt.Errorf("vhostuser interfaces need shared guest memory")
+	}
+	return nil
+}
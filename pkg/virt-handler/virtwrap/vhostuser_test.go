@@ -0,0 +1,75 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+)
+
+var _ = Describe("vhost-user interfaces", func() {
+
+	newSpec := func() *api.DomainSpec {
+		spec := api.NewMinimalDomainSpec("testvm")
+		spec.MemoryBacking = &api.MemoryBacking{HugePages: &api.HugePages{}}
+		spec.Devices.Interfaces = []api.Interface{
+			{Type: "vhostuser", Source: api.InterfaceSource{Path: "/var/run/openvswitch/vhu0"}},
+		}
+		return spec
+	}
+
+	It("should default to a virtio client socket on shared memory", func() {
+		spec := newSpec()
+		Expect(prepareVhostUserInterfaces(spec)).To(Succeed())
+		Expect(spec.Devices.Interfaces[0].Source).To(Equal(api.InterfaceSource{
+			Type: "unix",
+			Path: "/var/run/openvswitch/vhu0",
+			Mode: "client",
+		}))
+		Expect(spec.Devices.Interfaces[0].Model).To(Equal(&api.Model{Type: "virtio"}))
+		Expect(spec.MemoryBacking.Access).To(Equal(&api.MemoryAccess{Mode: "shared"}))
+	})
+
+	It("should reject relative socket paths", func() {
+		spec := newSpec()
+		spec.Devices.Interfaces[0].Source.Path = "vhu0"
+		Expect(prepareVhostUserInterfaces(spec)).ToNot(Succeed())
+	})
+
+	It("should reject guests without hugepages", func() {
+		spec := newSpec()
+		spec.MemoryBacking = nil
+		Expect(prepareVhostUserInterfaces(spec)).ToNot(Succeed())
+	})
+
+	It("should reject private guest memory", func() {
+		spec := newSpec()
+		spec.MemoryBacking.Access = &api.MemoryAccess{Mode: "private"}
+		Expect(prepareVhostUserInterfaces(spec)).ToNot(Succeed())
+	})
+
+	It("should ignore domains without vhost-user interfaces", func() {
+		spec := api.NewMinimalDomainSpec("testvm")
+		Expect(prepareVhostUserInterfaces(spec)).To(Succeed())
+		Expect(spec.MemoryBacking).To(BeNil())
+	})
+})
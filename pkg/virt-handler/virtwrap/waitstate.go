@@ -0,0 +1,141 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package virtwrap
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"kubevirt.io/kubevirt/pkg/api/v1"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cache"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+// The state is checked again at this interval even without lifecycle
+// events, in case events were lost.
+var stateWaitPollInterval = 1 * time.Second
+
+// stateWaiters wakes up everybody who waits for a state change of a domain
+// when libvirt reports a lifecycle event for it. The zero value is ready to
+// use.
+type stateWaiters struct {
+	lock    sync.Mutex
+	waiters map[string]map[chan struct{}]bool
+}
+
+// add returns a channel which receives a value whenever the domain changes,
+// and the function which removes it again.
+func (s *stateWaiters) add(name string) (<-chan struct{}, func()) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.waiters == nil {
+		s.waiters = make(map[string]map[chan struct{}]bool)
+	}
+	if s.waiters[name] == nil {
+		s.waiters[name] = make(map[chan struct{}]bool)
+	}
+	c := make(chan struct{}, 1)
+	s.waiters[name][c] = true
+	return c, func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		delete(s.waiters[name], c)
+		if len(s.waiters[name]) == 0 {
+			delete(s.waiters, name)
+		}
+	}
+}
+
+// notify wakes up the waiters of the domain without blocking, a pending
+// wake up covers all later ones.
+func (s *stateWaiters) notify(name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for c := range s.waiters[name] {
+		select {
+		case c <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// notifyAll wakes up all waiters, e.g. after a reconnect, when events might
+// have been missed.
+func (s *stateWaiters) notifyAll() {
+	s.lock.Lock()
+	names := make([]string, 0, len(s.waiters))
+	for name := range s.waiters {
+		names = append(names, name)
+	}
+	s.lock.Unlock()
+	for _, name := range names {
+		s.notify(name)
+	}
+}
+
+func (l *LibvirtDomainManager) notifyStateWaiters(d *libvirt.Domain) {
+	name, err := d.GetName()
+	if err != nil {
+		l.stateWaiters.notifyAll()
+		return
+	}
+	l.stateWaiters.notify(name)
+}
+
+// WaitForState blocks until the domain of the VM reaches one of the states,
+// and returns the state. It gives up when the context is done.
+func (l *LibvirtDomainManager) WaitForState(ctx context.Context, vm *v1.VirtualMachine, states ...api.LifeCycle) (api.LifeCycle, error) {
+	dom, err := l.virConn.LookupDomainByName(cache.VMNamespaceKeyFunc(vm))
+	if err != nil {
+		return "", err
+	}
+	defer dom.Free()
+	return l.waitForDomainState(ctx, dom, cache.VMNamespaceKeyFunc(vm), states...)
+}
+
+func (l *LibvirtDomainManager) waitForDomainState(ctx context.Context, dom cli.VirDomain, name string, states ...api.LifeCycle) (api.LifeCycle, error) {
+	changed, remove := l.stateWaiters.add(name)
+	defer remove()
+
+	for {
+		// Registering first makes sure that no change between the check
+		// and the wait is missed
+		status, _, err := dom.GetState()
+		if err != nil {
+			return "", err
+		}
+		current := cache.LifeCycleTranslationMap[status]
+		for _, state := range states {
+			if current == state {
+				return current, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return current, ctx.Err()
+		case <-changed:
+		case <-time.After(stateWaitPollInterval):
+		}
+	}
+}
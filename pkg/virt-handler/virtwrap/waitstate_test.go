@@ -0,0 +1,112 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+package virtwrap
+
+import (
+	"time"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/net/context"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Waiting for domain states", func() {
+	var ctrl *gomock.Controller
+	var mockConn *cli.MockConnection
+	var mockDomain *cli.MockVirDomain
+	var manager *LibvirtDomainManager
+	var originalPollInterval time.Duration
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockConn = cli.NewMockConnection(ctrl)
+		mockDomain = cli.NewMockVirDomain(ctrl)
+		manager = &LibvirtDomainManager{virConn: mockConn}
+		originalPollInterval = stateWaitPollInterval
+		// Long enough that only events wake up the waiters
+		stateWaitPollInterval = time.Hour
+
+		mockConn.EXPECT().LookupDomainByName("default_testvm").Return(mockDomain, nil)
+		mockDomain.EXPECT().Free()
+	})
+
+	It("should return right away if the domain is in the state", func() {
+		mockDomain.EXPECT().GetState().Return(libvirt.DOMAIN_SHUTOFF, 1, nil)
+
+		state, err := manager.WaitForState(context.Background(), newVM("default", "testvm"), api.Running, api.Shutoff)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).To(Equal(api.Shutoff))
+	})
+
+	It("should check again when the domain changes", func() {
+		gomock.InOrder(
+			mockDomain.EXPECT().GetState().Return(libvirt.DOMAIN_SHUTDOWN, 1, nil),
+			mockDomain.EXPECT().GetState().Return(libvirt.DOMAIN_SHUTOFF, 1, nil),
+		)
+
+		done := make(chan api.LifeCycle)
+		go func() {
+			defer GinkgoRecover()
+			state, err := manager.WaitForState(context.Background(), newVM("default", "testvm"), api.Shutoff)
+			Expect(err).ToNot(HaveOccurred())
+			done <- state
+		}()
+
+		Eventually(func() int {
+			manager.stateWaiters.lock.Lock()
+			defer manager.stateWaiters.lock.Unlock()
+			return len(manager.stateWaiters.waiters["default_testvm"])
+		}).Should(Equal(1))
+		manager.stateWaiters.notify("default_testvm")
+		Eventually(done).Should(Receive(Equal(api.Shutoff)))
+		Expect(manager.stateWaiters.waiters).To(BeEmpty())
+	})
+
+	It("should poll in case events are lost", func() {
+		stateWaitPollInterval = 10 * time.Millisecond
+		gomock.InOrder(
+			mockDomain.EXPECT().GetState().Return(libvirt.DOMAIN_RUNNING, 1, nil),
+			mockDomain.EXPECT().GetState().Return(libvirt.DOMAIN_PAUSED, 1, nil),
+		)
+
+		state, err := manager.WaitForState(context.Background(), newVM("default", "testvm"), api.Paused)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state).To(Equal(api.Paused))
+	})
+
+	It("should give up when the context is done", func() {
+		mockDomain.EXPECT().GetState().Return(libvirt.DOMAIN_RUNNING, 1, nil)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		state, err := manager.WaitForState(ctx, newVM("default", "testvm"), api.Shutoff)
+		Expect(err).To(Equal(context.DeadlineExceeded))
+		Expect(state).To(Equal(api.Running))
+	})
+
+	AfterEach(func() {
+		stateWaitPollInterval = originalPollInterval
+		ctrl.Finish()
+	})
+})
@@ -0,0 +1,184 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"encoding/xml"
+	"sync"
+
+	"github.com/jeevatkm/go-model"
+	"k8s.io/apimachinery/pkg/util/errors"
+
+	"kubevirt.io/kubevirt/pkg/logging"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+type cachedDomainSpec struct {
+	generation uint64
+	spec       *api.DomainSpec
+}
+
+// domainSpecCache keeps the parsed XML of the domains, so that a steady
+// state sync does not need to fetch and parse it again. Every change of a
+// domain bumps its generation and drops the cached spec. A spec is only
+// stored if the generation did not change while it was fetched, which keeps
+// XML fetched before a concurrent change out of the cache.
+type domainSpecCache struct {
+	lock        sync.Mutex
+	generations map[string]uint64
+	specs       map[string]cachedDomainSpec
+}
+
+func newDomainSpecCache() *domainSpecCache {
+	return &domainSpecCache{
+		generations: make(map[string]uint64),
+		specs:       make(map[string]cachedDomainSpec),
+	}
+}
+
+// lookup returns the cached spec of the domain, if any, and the current
+// generation of the domain.
+func (c *domainSpecCache) lookup(name string) (*api.DomainSpec, uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	generation := c.generations[name]
+	c.generations[name] = generation
+	if cached, exists := c.specs[name]; exists && cached.generation == generation {
+		return cached.spec, generation
+	}
+	return nil, generation
+}
+
+func (c *domainSpecCache) store(name string, generation uint64, spec *api.DomainSpec) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.generations[name] != generation {
+		return
+	}
+	c.specs[name] = cachedDomainSpec{generation: generation, spec: spec}
+}
+
+func (c *domainSpecCache) invalidate(name string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.generations[name]++
+	delete(c.specs, name)
+}
+
+func (c *domainSpecCache) invalidateAll() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for name := range c.generations {
+		c.generations[name]++
+	}
+	c.specs = make(map[string]cachedDomainSpec)
+}
+
+// getDomainSpec returns the spec of the domain from the cache or, if the
+// domain changed since it was cached, from libvirt. The caller gets its own
+// copy which it is free to modify.
+func (l *LibvirtDomainManager) getDomainSpec(name string, dom cli.VirDomain) (*api.DomainSpec, error) {
+	cached, generation := l.domainSpecs.lookup(name)
+	if cached == nil {
+		xmlstr, err := dom.GetXMLDesc(0)
+		if err != nil {
+			return nil, err
+		}
+		cached = &api.DomainSpec{}
+		if err := xml.Unmarshal([]byte(xmlstr), cached); err != nil {
+			return nil, err
+		}
+		l.domainSpecs.store(name, generation, cached)
+	}
+
+	var spec api.DomainSpec
+	if errs := model.Copy(&spec, cached); len(errs) > 0 {
+		return nil, errors.NewAggregate(errs)
+	}
+	return &spec, nil
+}
+
+// watchDomainChanges drops cached domain specs whenever libvirt reports a
+// change of the domain. After a reconnect all cached specs are dropped,
+// since events might have been missed. It also keeps track of the RTC
+// offsets the guests report and of their guest agents.
+func (l *LibvirtDomainManager) watchDomainChanges() error {
+	err := l.virConn.DomainEventLifecycleRegister(func(_ *libvirt.Connect, d *libvirt.Domain, event *libvirt.DomainEventLifecycle) {
+		if event == nil {
+			l.domainSpecs.invalidateAll()
+			l.stateWaiters.notifyAll()
+			l.agentStates.forgetAll()
+			l.forgetAdoptedDomains()
+			// We are called with the connection lock held, register again once it is released
+			go func() {
+				if err := l.watchDomainChanges(); err != nil {
+					logging.DefaultLogger().Error().Reason(err).Msg("Watching for domain changes failed.")
+				}
+			}()
+			return
+		}
+		l.invalidateDomainSpec(d)
+		l.notifyStateWaiters(d)
+		l.forgetAgentState(d, event)
+		l.forgetUndefinedAdoptedDomain(d, event)
+		l.retryPostponedRename(d, event)
+	})
+	if err != nil {
+		return err
+	}
+	err = l.virConn.DomainEventDeviceAddedRegister(func(_ *libvirt.Connect, d *libvirt.Domain, _ *libvirt.DomainEventDeviceAdded) {
+		l.invalidateDomainSpec(d)
+	})
+	if err != nil {
+		return err
+	}
+	err = l.virConn.DomainEventDeviceRemovedRegister(func(_ *libvirt.Connect, d *libvirt.Domain, _ *libvirt.DomainEventDeviceRemoved) {
+		l.invalidateDomainSpec(d)
+	})
+	if err != nil {
+		return err
+	}
+	// libvirt updates the clock adjustment in the live XML
+	err = l.virConn.DomainEventRTCChangeRegister(func(_ *libvirt.Connect, d *libvirt.Domain, _ *libvirt.DomainEventRTCChange) {
+		l.invalidateDomainSpec(d)
+	})
+	if err != nil {
+		return err
+	}
+	return l.virConn.DomainEventAgentLifecycleRegister(func(_ *libvirt.Connect, d *libvirt.Domain, event *libvirt.DomainEventAgentLifecycle) {
+		l.recordAgentState(d, event)
+	})
+}
+
+func (l *LibvirtDomainManager) invalidateDomainSpec(d *libvirt.Domain) {
+	name, err := d.GetName()
+	if err != nil {
+		// Better drop too much than to keep stale specs
+		l.domainSpecs.invalidateAll()
+		return
+	}
+	l.domainSpecs.invalidate(name)
+}
@@ -0,0 +1,82 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2017 Red Hat, Inc.
+ *
+ */
+
+package virtwrap
+
+import (
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/libvirt"
+)
+
+var _ = Describe("Domain spec cache", func() {
+	var ctrl *gomock.Controller
+	var mockDomain *cli.MockVirDomain
+	var manager *LibvirtDomainManager
+
+	domainXML := `<domain type="kvm"><name>default_testvm</name></domain>`
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockDomain = cli.NewMockVirDomain(ctrl)
+		manager = &LibvirtDomainManager{domainSpecs: newDomainSpecCache()}
+	})
+
+	It("should only fetch the XML once", func() {
+		mockDomain.EXPECT().GetXMLDesc(libvirt.DomainXMLFlags(0)).Return(domainXML, nil)
+
+		spec, err := manager.getDomainSpec("default_testvm", mockDomain)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(spec.Name).To(Equal("default_testvm"))
+
+		// Callers get their own copy
+		spec.Name = "changed"
+		spec, err = manager.getDomainSpec("default_testvm", mockDomain)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(spec.Name).To(Equal("default_testvm"))
+	})
+
+	It("should fetch the XML again after the domain changed", func() {
+		mockDomain.EXPECT().GetXMLDesc(libvirt.DomainXMLFlags(0)).Return(domainXML, nil).Times(2)
+
+		_, err := manager.getDomainSpec("default_testvm", mockDomain)
+		Expect(err).ToNot(HaveOccurred())
+		manager.domainSpecs.invalidate("default_testvm")
+		_, err = manager.getDomainSpec("default_testvm", mockDomain)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should not cache specs which were fetched before a change", func() {
+		cached, generation := manager.domainSpecs.lookup("default_testvm")
+		Expect(cached).To(BeNil())
+		manager.domainSpecs.invalidateAll()
+		manager.domainSpecs.store("default_testvm", generation, api.NewMinimalDomainSpec("default_testvm"))
+
+		cached, _ = manager.domainSpecs.lookup("default_testvm")
+		Expect(cached).To(BeNil())
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+})
@@ -20,9 +20,11 @@
 package virthandler
 
 import (
+	"encoding/base64"
 	goerror "errors"
 	"fmt"
 	"net"
+	"reflect"
 	"strings"
 	"time"
 
@@ -30,6 +32,8 @@ import (
 	k8sv1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
@@ -40,8 +44,10 @@ import (
 	cloudinit "kubevirt.io/kubevirt/pkg/cloud-init"
 	configdisk "kubevirt.io/kubevirt/pkg/config-disk"
 	"kubevirt.io/kubevirt/pkg/controller"
+	kernelboot "kubevirt.io/kubevirt/pkg/kernel-boot"
 	"kubevirt.io/kubevirt/pkg/kubecli"
 	"kubevirt.io/kubevirt/pkg/logging"
+	memorydump "kubevirt.io/kubevirt/pkg/memory-dump"
 	registrydisk "kubevirt.io/kubevirt/pkg/registry-disk"
 	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap"
 	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
@@ -117,13 +123,26 @@ func (d *VMHandlerDispatch) updateVMStatus(vm *v1.VirtualMachine, cfg *api.Domai
 	}
 	vm = obj.(*v1.VirtualMachine)
 
+	// Addresses are not essential for the VM status, try again on the next sync
+	interfaces, err := d.domainManager.GuestNetworkStatus(vm)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Warning().Reason(err).Msg("Getting the network status of the VM failed.")
+		interfaces = vm.Status.Interfaces
+	}
+	filesystems := d.guestFilesystems(vm)
+
 	// XXX When we start supporting hotplug, this needs to be altered.
-	// Check if the VM is already marked as running. If yes, don't update the VM.
-	// Otherwise we end up in endless controller requeues.
-	if vm.Status.Phase == v1.Running {
+	// Check if the VM is already marked as running. If yes, only update the VM
+	// when the addresses of its interfaces or its filesystems changed,
+	// otherwise we end up in endless controller requeues.
+	if vm.Status.Phase == v1.Running && reflect.DeepEqual(vm.Status.Interfaces, interfaces) &&
+		!filesystemsChanged(vm.Status.Filesystems, filesystems) {
 		return nil
 	}
 
+	vm.Status.Interfaces = interfaces
+	vm.Status.Filesystems = filesystems
+
 	vm.Status.Phase = v1.Running
 
 	vm.Status.Graphics = []v1.VMGraphics{}
@@ -150,9 +169,59 @@ func (d *VMHandlerDispatch) updateVMStatus(vm *v1.VirtualMachine, cfg *api.Domai
 
 }
 
+// guestFilesystems returns the filesystems of the guest, as far as the guest
+// agent reports them. Without an agent nothing is known about them.
+func (d *VMHandlerDispatch) guestFilesystems(vm *v1.VirtualMachine) []v1.VMFilesystem {
+	connected, err := d.domainManager.AgentConnected(vm)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Warning().Reason(err).Msg("Checking the guest agent failed.")
+		return vm.Status.Filesystems
+	}
+	if !connected {
+		return nil
+	}
+	filesystems, err := d.domainManager.GuestFilesystemInfo(vm)
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Warning().Reason(err).Msg("Getting the filesystems of the guest failed.")
+		return vm.Status.Filesystems
+	}
+	return filesystems
+}
+
+// filesystemsChanged tells whether the filesystems of the guest changed
+// enough to update the VM. Usage changes below a percent of the size of a
+// filesystem are ignored, a busy guest would update the VM all the time
+// otherwise.
+func filesystemsChanged(old []v1.VMFilesystem, current []v1.VMFilesystem) bool {
+	if len(old) != len(current) {
+		return true
+	}
+	for i := range old {
+		if old[i].MountPoint != current[i].MountPoint || old[i].Type != current[i].Type ||
+			!reflect.DeepEqual(old[i].Disks, current[i].Disks) || !reflect.DeepEqual(old[i].TotalBytes, current[i].TotalBytes) {
+			return true
+		}
+		if (old[i].UsedBytes == nil) != (current[i].UsedBytes == nil) {
+			return true
+		}
+		if old[i].UsedBytes == nil || current[i].TotalBytes == nil {
+			continue
+		}
+		delta := *current[i].UsedBytes - *old[i].UsedBytes
+		if *old[i].UsedBytes > *current[i].UsedBytes {
+			delta = *old[i].UsedBytes - *current[i].UsedBytes
+		}
+		if delta*100 > *current[i].TotalBytes {
+			return true
+		}
+	}
+	return false
+}
+
 func (d *VMHandlerDispatch) Execute(store cache.Store, queue workqueue.RateLimitingInterface, key interface{}) {
 
 	shouldDeleteVm := false
+	vmDeleted := false
 
 	// Fetch the latest Vm state from cache
 	obj, exists, err := store.GetByKey(key.(string))
@@ -179,7 +248,7 @@ func (d *VMHandlerDispatch) Execute(store cache.Store, queue workqueue.RateLimit
 	// Check For Migration before processing vm not in our cache
 	if !exists {
 		// If we don't have the VM in the cache, it could be that it is currently migrating to us
-		isDestination, err := d.isMigrationDestination(vm.GetObjectMeta().GetNamespace(), vm.GetObjectMeta().GetName())
+		isDestination, deleted, err := d.isMigrationDestination(vm.GetObjectMeta().GetNamespace(), vm.GetObjectMeta().GetName())
 		if err != nil {
 			// unable to determine migration status, we'll try again later.
 			queue.AddRateLimited(key)
@@ -191,13 +260,14 @@ func (d *VMHandlerDispatch) Execute(store cache.Store, queue workqueue.RateLimit
 			queue.Forget(key)
 			return
 		}
-		// The VM is deleted on the cluster, continue with processing the deletion on the host.
+		// The VM is deleted on the cluster or moved to another host, continue with processing the deletion on the host.
 		shouldDeleteVm = true
+		vmDeleted = deleted
 	}
 	logging.DefaultLogger().V(3).Info().Object(vm).Msg("Processing VM update.")
 
 	// Process the VM
-	isPending, err := d.processVmUpdate(vm, shouldDeleteVm)
+	isPending, err := d.processVmUpdate(vm, shouldDeleteVm, vmDeleted)
 	if err != nil {
 		// Something went wrong, reenqueue the item with a delay
 		logging.DefaultLogger().Error().Object(vm).Reason(err).Msg("Synchronizing the VM failed.")
@@ -271,6 +341,24 @@ func MapPersistentVolumes(vm *v1.VirtualMachine, restClient cache.Getter, namesp
 				return vm, fmt.Errorf("Missing disk source host")
 			}
 
+			if disk.Source.Protocol == "iscsi" && len(disk.Source.Hosts) > 0 {
+				host, err := selectISCSIPortal(diskSourcePortals(disk.Source))
+				if err != nil {
+					logger.Error().Reason(err).Msg("Unable to select an iSCSI portal")
+					return vm, err
+				}
+				newDisk.Source.Host = host
+				newDisk.Source.Hosts = nil
+
+				vmCopy.Spec.Domain.Devices.Disks[idx] = newDisk
+				continue
+			}
+
+			// There is nothing to resolve for local sockets, e.g. NBD exports
+			if disk.Source.Host.Transport == "unix" {
+				continue
+			}
+
 			ipAddrs, err := net.LookupIP(disk.Source.Host.Name)
 			if err != nil || ipAddrs == nil || len(ipAddrs) < 1 {
 				logger.Error().Reason(err).Msgf("Unable to resolve host '%s'", disk.Source.Host.Name)
@@ -279,6 +367,16 @@ func MapPersistentVolumes(vm *v1.VirtualMachine, restClient cache.Getter, namesp
 
 			newDisk.Source.Host.Name = ipAddrs[0].String()
 
+			newDisk.Source.Hosts = nil
+			for _, host := range disk.Source.Hosts {
+				ipAddrs, err := net.LookupIP(host.Name)
+				if err != nil || ipAddrs == nil || len(ipAddrs) < 1 {
+					logger.Error().Reason(err).Msgf("Unable to resolve host '%s'", host.Name)
+					return vm, fmt.Errorf("Unable to resolve host '%s': %s", host.Name, err)
+				}
+				newDisk.Source.Hosts = append(newDisk.Source.Hosts, v1.DiskSourceHost{Name: ipAddrs[0].String(), Port: host.Port})
+			}
+
 			vmCopy.Spec.Domain.Devices.Disks[idx] = newDisk
 		}
 	}
@@ -293,6 +391,7 @@ func mapPVToDisk(disk *v1.Disk, pv *k8sv1.PersistentVolume) (*v1.Disk, error) {
 		newDisk.Type = "network"
 		newDisk.Device = "disk"
 		newDisk.Target = disk.Target
+		newDisk.IOTune = disk.IOTune
 		newDisk.Driver = new(v1.DiskDriver)
 		newDisk.Driver.Type = "raw"
 		newDisk.Driver.Name = "qemu"
@@ -300,16 +399,15 @@ func mapPVToDisk(disk *v1.Disk, pv *k8sv1.PersistentVolume) (*v1.Disk, error) {
 		newDisk.Source.Name = fmt.Sprintf("%s/%d", pv.Spec.ISCSI.IQN, pv.Spec.ISCSI.Lun)
 		newDisk.Source.Protocol = "iscsi"
 
-		hostPort := strings.Split(pv.Spec.ISCSI.TargetPortal, ":")
-		ipAddrs, err := net.LookupIP(hostPort[0])
-		if err != nil || len(ipAddrs) < 1 {
-			return nil, fmt.Errorf("Unable to resolve host '%s': %s", hostPort[0], err)
+		portals := append([]string{pv.Spec.ISCSI.TargetPortal}, pv.Spec.ISCSI.Portals...)
+		host, err := selectISCSIPortal(portals)
+		if err != nil {
+			return nil, err
 		}
+		newDisk.Source.Host = host
 
-		newDisk.Source.Host = &v1.DiskSourceHost{}
-		newDisk.Source.Host.Name = ipAddrs[0].String()
-		if len(hostPort) > 1 {
-			newDisk.Source.Host.Port = hostPort[1]
+		if pv.Spec.ISCSI.InitiatorName != nil && *pv.Spec.ISCSI.InitiatorName != "" {
+			newDisk.Source.Initiator = &v1.DiskSourceInitiator{IQN: *pv.Spec.ISCSI.InitiatorName}
 		}
 
 		// This iscsi device has auth associated with it.
@@ -322,28 +420,161 @@ func mapPVToDisk(disk *v1.Disk, pv *k8sv1.PersistentVolume) (*v1.Disk, error) {
 			}
 		}
 		return &newDisk, nil
+	} else if pv.Spec.RBD != nil {
+		newDisk := v1.Disk{}
+
+		newDisk.Type = "network"
+		newDisk.Device = "disk"
+		newDisk.Target = disk.Target
+		newDisk.IOTune = disk.IOTune
+		newDisk.Driver = new(v1.DiskDriver)
+		newDisk.Driver.Type = "raw"
+		newDisk.Driver.Name = "qemu"
+
+		pool := pv.Spec.RBD.RBDPool
+		if pool == "" {
+			pool = "rbd"
+		}
+		newDisk.Source.Name = fmt.Sprintf("%s/%s", pool, pv.Spec.RBD.RBDImage)
+		newDisk.Source.Protocol = "rbd"
+
+		if len(pv.Spec.RBD.CephMonitors) == 0 {
+			return nil, fmt.Errorf("Referenced PV %s has no Ceph monitors", pv.ObjectMeta.Name)
+		}
+		// qemu talks to the monitors itself, no kernel mount on the host is needed
+		for i, monitor := range pv.Spec.RBD.CephMonitors {
+			host, err := resolveDiskSourceHost(monitor)
+			if err != nil {
+				return nil, err
+			}
+			if i == 0 {
+				newDisk.Source.Host = host
+			} else {
+				newDisk.Source.Hosts = append(newDisk.Source.Hosts, *host)
+			}
+		}
+
+		if pv.Spec.RBD.ReadOnly {
+			newDisk.ReadOnly = &v1.ReadOnly{}
+		}
+
+		// This rbd device has cephx auth associated with it.
+		if pv.Spec.RBD.SecretRef != nil && pv.Spec.RBD.SecretRef.Name != "" {
+			user := pv.Spec.RBD.RadosUser
+			if user == "" {
+				user = "admin"
+			}
+			newDisk.Auth = &v1.DiskAuth{
+				Username: user,
+				Secret: &v1.DiskSecret{
+					Type:  "ceph",
+					Usage: pv.Spec.RBD.SecretRef.Name,
+				},
+			}
+		}
+		return &newDisk, nil
 	} else {
-		err := fmt.Errorf("Referenced PV %s is backed by an unsupported storage type. Only iSCSI is supported.", pv.ObjectMeta.Name)
+		err := fmt.Errorf("Referenced PV %s is backed by an unsupported storage type. Only iSCSI and Ceph RBD are supported.", pv.ObjectMeta.Name)
 		return nil, err
 	}
 }
 
+// resolveDiskSourceHost turns a host:port pair into a disk source host with
+// the IP address of the host.
+func resolveDiskSourceHost(hostPortStr string) (*v1.DiskSourceHost, error) {
+	hostPort := strings.Split(hostPortStr, ":")
+	ipAddrs, err := net.LookupIP(hostPort[0])
+	if err != nil || len(ipAddrs) < 1 {
+		return nil, fmt.Errorf("Unable to resolve host '%s': %s", hostPort[0], err)
+	}
+
+	host := &v1.DiskSourceHost{Name: ipAddrs[0].String()}
+	if len(hostPort) > 1 {
+		host.Port = hostPort[1]
+	}
+	return host, nil
+}
+
+const defaultISCSIPort = "3260"
+
+var portalDialTimeout = 2 * time.Second
+
+// dialPortal checks whether an iSCSI portal accepts connections
+var dialPortal = func(address string) error {
+	conn, err := net.DialTimeout("tcp", address, portalDialTimeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// selectISCSIPortal picks the portal qemu connects to. qemu can only talk to
+// a single portal of a target, so with multiple portals the first one which
+// accepts connections is used. This way a VM can still be started when one
+// of the paths to the target is down. If none of the portals can be reached,
+// the first one which resolves is used and qemu reports the error.
+func selectISCSIPortal(portals []string) (*v1.DiskSourceHost, error) {
+	if len(portals) == 1 {
+		return resolveDiskSourceHost(portals[0])
+	}
+
+	var fallback *v1.DiskSourceHost
+	for _, portal := range portals {
+		host, err := resolveDiskSourceHost(portal)
+		if err != nil {
+			logging.DefaultLogger().Warning().Reason(err).Msgf("Skipping iSCSI portal %s.", portal)
+			continue
+		}
+		port := host.Port
+		if port == "" {
+			port = defaultISCSIPort
+		}
+		if err := dialPortal(net.JoinHostPort(host.Name, port)); err != nil {
+			logging.DefaultLogger().Warning().Reason(err).Msgf("iSCSI portal %s is not reachable.", portal)
+			if fallback == nil {
+				fallback = host
+			}
+			continue
+		}
+		return host, nil
+	}
+	if fallback == nil {
+		return nil, fmt.Errorf("Unable to resolve any of the iSCSI portals %v", portals)
+	}
+	return fallback, nil
+}
+
+func diskSourcePortals(source v1.DiskSource) []string {
+	hosts := append([]v1.DiskSourceHost{*source.Host}, source.Hosts...)
+	portals := []string{}
+	for _, host := range hosts {
+		if host.Port == "" {
+			portals = append(portals, host.Name)
+		} else {
+			portals = append(portals, host.Name+":"+host.Port)
+		}
+	}
+	return portals
+}
+
+// vmSecretUsage returns the VM specific usage id of a secret and the name of
+// the k8s secret it is backed by. The usage may already be the VM specific one.
+func vmSecretUsage(vm *v1.VirtualMachine, usage string) (usageID string, secretID string) {
+	usageIDSuffix := fmt.Sprintf("-%s-%s---", vm.GetObjectMeta().GetNamespace(), vm.GetObjectMeta().GetName())
+	if strings.HasSuffix(usage, usageIDSuffix) {
+		return usage, strings.TrimSuffix(usage, usageIDSuffix)
+	}
+	return fmt.Sprintf("%s%s", usage, usageIDSuffix), usage
+}
+
 func (d *VMHandlerDispatch) injectDiskAuth(vm *v1.VirtualMachine) (*v1.VirtualMachine, error) {
 	for idx, disk := range vm.Spec.Domain.Devices.Disks {
 		if disk.Auth == nil || disk.Auth.Secret == nil || disk.Auth.Secret.Usage == "" {
 			continue
 		}
 
-		usageIDSuffix := fmt.Sprintf("-%s-%s---", vm.GetObjectMeta().GetNamespace(), vm.GetObjectMeta().GetName())
-		usageID := disk.Auth.Secret.Usage
+		usageID, secretID := vmSecretUsage(vm, disk.Auth.Secret.Usage)
 		usageType := disk.Auth.Secret.Type
-		secretID := usageID
-
-		if strings.HasSuffix(usageID, usageIDSuffix) {
-			secretID = strings.TrimSuffix(usageID, usageIDSuffix)
-		} else {
-			usageID = fmt.Sprintf("%s%s", usageID, usageIDSuffix)
-		}
 
 		secret, err := d.clientset.CoreV1().Secrets(vm.ObjectMeta.Namespace).Get(secretID, metav1.GetOptions{})
 		if err != nil {
@@ -351,16 +582,27 @@ func (d *VMHandlerDispatch) injectDiskAuth(vm *v1.VirtualMachine) (*v1.VirtualMa
 			return nil, err
 		}
 
-		secretValue, ok := secret.Data["node.session.auth.password"]
-		if ok == false {
-			return nil, goerror.New(fmt.Sprintf("No password value found in k8s secret %s %v", secretID, err))
-		}
+		var secretValue []byte
+		var ok bool
+		switch usageType {
+		case "ceph":
+			// Ceph secrets only hold the key, the user comes from the PV
+			secretValue, ok = secret.Data["key"]
+			if ok == false {
+				return nil, goerror.New(fmt.Sprintf("No key found in k8s secret %s", secretID))
+			}
+		default:
+			secretValue, ok = secret.Data["node.session.auth.password"]
+			if ok == false {
+				return nil, goerror.New(fmt.Sprintf("No password value found in k8s secret %s %v", secretID, err))
+			}
 
-		userValue, ok := secret.Data["node.session.auth.username"]
-		if ok == false {
-			return nil, goerror.New(fmt.Sprintf("Failed to find username for disk auth %s", secretID))
+			userValue, ok := secret.Data["node.session.auth.username"]
+			if ok == false {
+				return nil, goerror.New(fmt.Sprintf("Failed to find username for disk auth %s", secretID))
+			}
+			vm.Spec.Domain.Devices.Disks[idx].Auth.Username = string(userValue)
 		}
-		vm.Spec.Domain.Devices.Disks[idx].Auth.Username = string(userValue)
 
 		// override the usage id on the VM with the VM specific one.
 		// By decoupling usage from the k8s secret name here, this allows
@@ -377,7 +619,75 @@ func (d *VMHandlerDispatch) injectDiskAuth(vm *v1.VirtualMachine) (*v1.VirtualMa
 	return vm, nil
 }
 
-func (d *VMHandlerDispatch) processVmUpdate(vm *v1.VirtualMachine, shouldDeleteVm bool) (bool, error) {
+// syncPassphraseSecret defines a libvirt secret of the given usage type with
+// the passphrase from the k8s secret behind usage and returns the VM specific
+// usage id of the libvirt secret.
+func (d *VMHandlerDispatch) syncPassphraseSecret(vm *v1.VirtualMachine, usageType string, usage string) (string, error) {
+	usageID, secretID := vmSecretUsage(vm, usage)
+
+	secret, err := d.clientset.CoreV1().Secrets(vm.ObjectMeta.Namespace).Get(secretID, metav1.GetOptions{})
+	if err != nil {
+		logging.DefaultLogger().Error().Reason(err).Msg("Defining the VM secret failed unable to pull corresponding k8s secret value")
+		return "", err
+	}
+
+	secretValue, ok := secret.Data["passphrase"]
+	if ok == false {
+		return "", goerror.New(fmt.Sprintf("No passphrase found in k8s secret %s", secretID))
+	}
+
+	err = d.domainManager.SyncVMSecret(vm, usageType, usageID, string(secretValue))
+	if err != nil {
+		return "", err
+	}
+	return usageID, nil
+}
+
+func (d *VMHandlerDispatch) injectDiskEncryption(vm *v1.VirtualMachine) (*v1.VirtualMachine, error) {
+	for idx, disk := range vm.Spec.Domain.Devices.Disks {
+		if disk.Encryption == nil {
+			continue
+		}
+		if disk.Encryption.Format != "luks" {
+			return nil, goerror.New(fmt.Sprintf("Unsupported disk encryption format %s", disk.Encryption.Format))
+		}
+		if disk.Encryption.Secret == nil || disk.Encryption.Secret.Usage == "" {
+			return nil, goerror.New(fmt.Sprintf("Encrypted disk %s has no passphrase secret", disk.Target.Device))
+		}
+
+		usageID, err := d.syncPassphraseSecret(vm, "volume", disk.Encryption.Secret.Usage)
+		if err != nil {
+			return nil, err
+		}
+		vm.Spec.Domain.Devices.Disks[idx].Encryption.Secret.Type = "passphrase"
+		vm.Spec.Domain.Devices.Disks[idx].Encryption.Secret.Usage = usageID
+	}
+
+	return vm, nil
+}
+
+func (d *VMHandlerDispatch) injectTPMSecret(vm *v1.VirtualMachine) (*v1.VirtualMachine, error) {
+	tpm := vm.Spec.Domain.Devices.TPM
+	if tpm == nil || tpm.EncryptionSecret == "" {
+		return vm, nil
+	}
+
+	usageID, err := d.syncPassphraseSecret(vm, "vtpm", tpm.EncryptionSecret)
+	if err != nil {
+		return nil, err
+	}
+	tpm.EncryptionSecret = usageID
+
+	return vm, nil
+}
+
+func (d *VMHandlerDispatch) processVmUpdate(vm *v1.VirtualMachine, shouldDeleteVm bool, vmDeleted bool) (bool, error) {
+
+	if virtwrap.IsReadOnly() {
+		// The domain controller still reports the state of the domains
+		logging.DefaultLogger().V(3).Info().Object(vm).Msg("Libvirt is read only, not synchronizing the VM.")
+		return false, nil
+	}
 
 	if shouldDeleteVm {
 		// Since the VM was not in the cache, we delete it
@@ -397,6 +707,19 @@ func (d *VMHandlerDispatch) processVmUpdate(vm *v1.VirtualMachine, shouldDeleteV
 			return false, err
 		}
 
+		err = kernelboot.CleanupKernelBootData(vm)
+		if err != nil {
+			return false, err
+		}
+
+		// Only VMs which are gone for good lose the data which outlives their domain
+		if vmDeleted {
+			err = d.domainManager.RemoveVMData(vm)
+			if err != nil {
+				return false, err
+			}
+		}
+
 		return false, d.configDisk.Undefine(vm)
 	} else if isWorthSyncing(vm) == false {
 		// nothing to do here.
@@ -420,11 +743,27 @@ func (d *VMHandlerDispatch) processVmUpdate(vm *v1.VirtualMachine, shouldDeleteV
 		return false, err
 	}
 
+	// Map the kernel and initrd of a direct kernel boot to their host copies
+	vm, err = kernelboot.MapKernelBoot(vm)
+	if err != nil {
+		return false, err
+	}
+
 	vm, err = d.injectDiskAuth(vm)
 	if err != nil {
 		return false, err
 	}
 
+	vm, err = d.injectDiskEncryption(vm)
+	if err != nil {
+		return false, err
+	}
+
+	vm, err = d.injectTPMSecret(vm)
+	if err != nil {
+		return false, err
+	}
+
 	// Map whatever devices are being used for config-init
 	vm, err = cloudinit.MapCloudInitDisks(vm)
 	if err != nil {
@@ -436,7 +775,12 @@ func (d *VMHandlerDispatch) processVmUpdate(vm *v1.VirtualMachine, shouldDeleteV
 		// Only sync if the VM is not marked as migrating.
 		// Everything except shutting down the VM is not
 		// permitted when it is migrating.
-		return false, nil
+		return false, d.syncMigration(vm)
+	}
+
+	vm, err = d.allocateMACs(vm)
+	if err != nil {
+		return false, err
 	}
 
 	// TODO check if found VM has the same UID like the domain,
@@ -446,10 +790,287 @@ func (d *VMHandlerDispatch) processVmUpdate(vm *v1.VirtualMachine, shouldDeleteV
 		return false, err
 	}
 
+	vm, err = d.storeDeviceAllocations(vm)
+	if err != nil {
+		return false, err
+	}
+
+	if err := d.tuneCgroups(vm); err != nil {
+		return false, err
+	}
+
+	vm, err = d.injectLaunchSecret(vm)
+	if err != nil {
+		return false, err
+	}
+
+	vm, err = d.startMemoryDump(vm)
+	if err != nil {
+		return false, err
+	}
+
+	vm, err = d.cancelJob(vm)
+	if err != nil {
+		return false, err
+	}
+
 	return false, d.updateVMStatus(vm, newCfg)
 }
 
-func (d *VMHandlerDispatch) isMigrationDestination(namespace string, vmName string) (bool, error) {
+// injectLaunchSecret hands the launch secret from the k8s secret named by the
+// LaunchSecretAnnotation to the SEV guest, once it waits for it. The guest
+// owner can only reach the guest through the VM object this way, virt-handler
+// has no API which changes domains.
+func (d *VMHandlerDispatch) injectLaunchSecret(vm *v1.VirtualMachine) (*v1.VirtualMachine, error) {
+	secretName, exists := vm.ObjectMeta.Annotations[v1.LaunchSecretAnnotation]
+	if !exists {
+		return vm, nil
+	}
+	waiting, err := d.domainManager.WaitsForLaunchSecret(vm)
+	if err != nil || !waiting {
+		return vm, err
+	}
+
+	secret, err := d.clientset.CoreV1().Secrets(vm.ObjectMeta.Namespace).Get(secretName, metav1.GetOptions{})
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Getting the launch secret failed.")
+		return nil, err
+	}
+	header, ok := secret.Data["packetHeader"]
+	if !ok {
+		return nil, goerror.New(fmt.Sprintf("No packetHeader found in k8s secret %s", secretName))
+	}
+	launchSecret, ok := secret.Data["secret"]
+	if !ok {
+		return nil, goerror.New(fmt.Sprintf("No secret found in k8s secret %s", secretName))
+	}
+	err = d.domainManager.InjectLaunchSecret(vm, base64.StdEncoding.EncodeToString(header), base64.StdEncoding.EncodeToString(launchSecret), virtwrap.TriggerVMController)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := scheme.Scheme.Copy(vm)
+	if err != nil {
+		return nil, err
+	}
+	updated := obj.(*v1.VirtualMachine)
+	delete(updated.ObjectMeta.Annotations, v1.LaunchSecretAnnotation)
+	err = d.restClient.Put().Resource("virtualmachines").Body(updated).
+		Name(updated.ObjectMeta.Name).Namespace(updated.ObjectMeta.Namespace).Do().Into(updated)
+	if err != nil {
+		return nil, err
+	}
+	logging.DefaultLogger().Object(updated).Info().Msg("Launch secret injected.")
+	return updated, nil
+}
+
+// startMemoryDump starts the memory dump requested through the
+// MemoryDumpAnnotation and removes the annotation, so that every request
+// results in one dump. Requests which can't be served are reported as events
+// and dropped as well, retrying them would not help.
+func (d *VMHandlerDispatch) startMemoryDump(vm *v1.VirtualMachine) (*v1.VirtualMachine, error) {
+	if _, exists := vm.ObjectMeta.Annotations[v1.MemoryDumpAnnotation]; !exists {
+		return vm, nil
+	}
+
+	request, err := memorydump.RequestFromVM(vm)
+	if err == nil {
+		var id string
+		id, err = d.domainManager.MemoryDump(vm, request.Path, request.Format, virtwrap.TriggerVMController)
+		if err == nil {
+			d.recorder.Eventf(vm, k8sv1.EventTypeNormal, v1.MemoryDumped.String(), "Memory dump job %s started", id)
+		}
+	}
+	if err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msg("Starting the memory dump failed.")
+		d.recorder.Eventf(vm, k8sv1.EventTypeWarning, v1.MemoryDumped.String(), "Starting the memory dump failed: %v", err)
+	}
+
+	obj, err := scheme.Scheme.Copy(vm)
+	if err != nil {
+		return nil, err
+	}
+	updated := obj.(*v1.VirtualMachine)
+	delete(updated.ObjectMeta.Annotations, v1.MemoryDumpAnnotation)
+	err = d.restClient.Put().Resource("virtualmachines").Body(updated).
+		Name(updated.ObjectMeta.Name).Namespace(updated.ObjectMeta.Namespace).Do().Into(updated)
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// cancelJob cancels the background job named by the CancelJobAnnotation and
+// removes the annotation. Jobs which already finished or never existed are
+// only reported as events.
+func (d *VMHandlerDispatch) cancelJob(vm *v1.VirtualMachine) (*v1.VirtualMachine, error) {
+	id, exists := vm.ObjectMeta.Annotations[v1.CancelJobAnnotation]
+	if !exists {
+		return vm, nil
+	}
+
+	if err := d.domainManager.CancelJob(vm, id, virtwrap.TriggerVMController); err != nil {
+		logging.DefaultLogger().Object(vm).Error().Reason(err).Msgf("Cancelling job %s failed.", id)
+		d.recorder.Eventf(vm, k8sv1.EventTypeWarning, v1.JobCancelled.String(), "Cancelling job %s failed: %v", id, err)
+	} else {
+		d.recorder.Eventf(vm, k8sv1.EventTypeNormal, v1.JobCancelled.String(), "Job %s cancelled", id)
+	}
+
+	obj, err := scheme.Scheme.Copy(vm)
+	if err != nil {
+		return nil, err
+	}
+	updated := obj.(*v1.VirtualMachine)
+	delete(updated.ObjectMeta.Annotations, v1.CancelJobAnnotation)
+	err = d.restClient.Put().Resource("virtualmachines").Body(updated).
+		Name(updated.ObjectMeta.Name).Namespace(updated.ObjectMeta.Namespace).Do().Into(updated)
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// tuneCgroups aligns the memory limits of the domain cgroup with the
+// resources of the compute container of the virt-launcher Pod and sets the
+// blkio weight the VM asks for.
+func (d *VMHandlerDispatch) tuneCgroups(vm *v1.VirtualMachine) error {
+	resources, found, err := d.launcherResources(vm)
+	if err != nil {
+		return err
+	}
+	if found {
+		err = d.domainManager.TuneMemory(vm, virtwrap.MemoryTuningForResources(resources), virtwrap.TriggerVMController)
+		if err != nil {
+			return err
+		}
+	}
+
+	blkio, err := virtwrap.BlkioTuningForVM(vm)
+	if err != nil {
+		return err
+	}
+	if blkio != nil {
+		return d.domainManager.TuneBlkio(vm, blkio, virtwrap.TriggerVMController)
+	}
+	return nil
+}
+
+// launcherResources returns the resources of the compute container of the
+// running virt-launcher Pod of the VM on this host.
+func (d *VMHandlerDispatch) launcherResources(vm *v1.VirtualMachine) (k8sv1.ResourceRequirements, bool, error) {
+	labelSelector, err := labels.Parse(fmt.Sprintf(v1.AppLabel+"=virt-launcher,"+v1.VMUIDLabel+"=%s", string(vm.GetObjectMeta().GetUID())))
+	if err != nil {
+		return k8sv1.ResourceRequirements{}, false, err
+	}
+	fieldSelector := fields.ParseSelectorOrDie("spec.nodeName=" + d.host + ",status.phase=" + string(k8sv1.PodRunning))
+	pods, err := d.clientset.CoreV1().Pods(vm.ObjectMeta.Namespace).List(metav1.ListOptions{
+		LabelSelector: labelSelector.String(),
+		FieldSelector: fieldSelector.String(),
+	})
+	if err != nil {
+		return k8sv1.ResourceRequirements{}, false, err
+	}
+	for _, pod := range pods.Items {
+		for _, container := range pod.Spec.Containers {
+			if container.Name == "compute" {
+				return container.Resources, true, nil
+			}
+		}
+	}
+	return k8sv1.ResourceRequirements{}, false, nil
+}
+
+// storeDeviceAllocations stores the target names and addresses the devices
+// of the domain got on the VM, so that they keep them after the domain was
+// undefined.
+func (d *VMHandlerDispatch) storeDeviceAllocations(vm *v1.VirtualMachine) (*v1.VirtualMachine, error) {
+	allocations, err := d.domainManager.GetDeviceAllocations(vm)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := scheme.Scheme.Copy(vm)
+	if err != nil {
+		return nil, err
+	}
+	updated := obj.(*v1.VirtualMachine)
+	changed, err := virtwrap.StoreDeviceAllocations(updated, allocations)
+	if err != nil || !changed {
+		return vm, err
+	}
+	err = d.restClient.Put().Resource("virtualmachines").Body(updated).
+		Name(updated.ObjectMeta.Name).Namespace(updated.ObjectMeta.Namespace).Do().Into(updated)
+	if err != nil {
+		return nil, err
+	}
+	logging.DefaultLogger().Object(updated).Info().V(3).Msg("Device addresses stored.")
+	return updated, nil
+}
+
+// allocateMACs allocates the MAC addresses of interfaces without one and
+// stores them on the VM, before a domain is defined with them. The addresses
+// are checked against the ones of all VMs in the cluster.
+func (d *VMHandlerDispatch) allocateMACs(vm *v1.VirtualMachine) (*v1.VirtualMachine, error) {
+	if !virtwrap.NeedsMACs(vm) {
+		return vm, nil
+	}
+	vms := v1.VirtualMachineList{}
+	err := d.restClient.Get().Resource("virtualmachines").Do().Into(&vms)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := scheme.Scheme.Copy(vm)
+	if err != nil {
+		return nil, err
+	}
+	vm = obj.(*v1.VirtualMachine)
+	if err := virtwrap.AllocateMACs(vm, virtwrap.MACsInUse(vms.Items)); err != nil {
+		return nil, err
+	}
+	err = d.restClient.Put().Resource("virtualmachines").Body(vm).
+		Name(vm.ObjectMeta.Name).Namespace(vm.ObjectMeta.Namespace).Do().Into(vm)
+	if err != nil {
+		return nil, err
+	}
+	logging.DefaultLogger().Object(vm).Info().V(3).Msg("MAC addresses allocated.")
+	return vm, nil
+}
+
+// syncMigration applies changed tuning options to the outgoing migration of a
+// VM. If the Migration object was deleted, it stops the migration and marks
+// the VM as running on this host again.
+func (d *VMHandlerDispatch) syncMigration(vm *v1.VirtualMachine) error {
+	migrations := v1.MigrationList{}
+	err := d.restClient.Get().Resource("migrations").Namespace(vm.ObjectMeta.Namespace).Do().Into(&migrations)
+	if err != nil {
+		return err
+	}
+	for _, migration := range migrations.Items {
+		if migration.Spec.Selector.Name == vm.ObjectMeta.Name {
+			return d.domainManager.TuneMigration(vm, migration.Spec.Options)
+		}
+	}
+
+	if err := d.domainManager.AbortJob(vm); err != nil {
+		return err
+	}
+	d.recorder.Event(vm, k8sv1.EventTypeNormal, v1.AbortedVirtualMachineMigration.String(), "Migration aborted, the Migration was deleted.")
+
+	obj, err := scheme.Scheme.Copy(vm)
+	if err != nil {
+		return err
+	}
+	vm = obj.(*v1.VirtualMachine)
+	vm.Status.MigrationNodeName = ""
+	vm.Status.Phase = v1.Running
+	return d.restClient.Put().Resource("virtualmachines").Body(vm).
+		Name(vm.ObjectMeta.Name).Namespace(vm.ObjectMeta.Namespace).Do().Error()
+}
+
+// isMigrationDestination tells whether the VM is migrating to this host, and
+// whether the VM is deleted on the cluster.
+func (d *VMHandlerDispatch) isMigrationDestination(namespace string, vmName string) (bool, bool, error) {
 
 	// If we don't have the VM in the cache, it could be that it is currently migrating to us
 	result := d.restClient.Get().Name(vmName).Resource("virtualmachines").Namespace(namespace).Do()
@@ -457,18 +1078,19 @@ func (d *VMHandlerDispatch) isMigrationDestination(namespace string, vmName stri
 		// So the VM still seems to exist
 		fetchedVM, err := result.Get()
 		if err != nil {
-			return false, err
+			return false, false, err
 		}
 		if fetchedVM.(*v1.VirtualMachine).Status.MigrationNodeName == d.host {
-			return true, nil
+			return true, false, nil
 		}
+		return false, false, nil
 	} else if !errors.IsNotFound(result.Error()) {
 		// Something went wrong, let's try again later
-		return false, result.Error()
+		return false, false, result.Error()
 	}
 
 	// VM object was not found.
-	return false, nil
+	return false, true, nil
 }
 
 func isWorthSyncing(vm *v1.VirtualMachine) bool {
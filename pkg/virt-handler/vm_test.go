@@ -20,6 +20,8 @@
 package virthandler
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"testing"
 
@@ -29,6 +31,7 @@ import (
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/ghttp"
 	k8sv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -46,6 +49,8 @@ import (
 	"kubevirt.io/kubevirt/pkg/kubecli"
 	"kubevirt.io/kubevirt/pkg/logging"
 	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/api"
+	"kubevirt.io/kubevirt/pkg/virt-handler/virtwrap/cli"
 )
 
 var _ = Describe("VM", func() {
@@ -92,24 +97,73 @@ var _ = Describe("VM", func() {
 				),
 			)
 			domainManager.EXPECT().RemoveVMSecrets(v1.NewVMReferenceFromName("testvm")).Return(nil)
-			domainManager.EXPECT().KillVM(v1.NewVMReferenceFromName("testvm")).Do(func(vm *v1.VirtualMachine) {
+			domainManager.EXPECT().KillVM(v1.NewVMReferenceFromName("testvm")).Return(nil)
+			domainManager.EXPECT().RemoveVMData(v1.NewVMReferenceFromName("testvm")).Do(func(vm *v1.VirtualMachine) {
 				close(done)
 			})
 
 			dispatch.Execute(vmStore, vmQueue, "default/testvm")
 		}, 1)
+		It("should leave the Domain alone if libvirt is read only", func() {
+			virtwrap.SetReadOnly(true)
+			defer virtwrap.SetReadOnly(false)
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/apis/kubevirt.io/v1alpha1/namespaces/default/virtualmachines/testvm"),
+					ghttp.RespondWithJSONEncoded(http.StatusNotFound, struct{}{}),
+				),
+			)
+
+			dispatch.Execute(vmStore, vmQueue, "default/testvm")
+			Expect(vmQueue.Len()).To(Equal(0))
+		})
+		It("should keep the data of VMs which moved to another host", func() {
+			vm := v1.NewMinimalVM("testvm")
+			vm.Status.NodeName = "othernode"
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/apis/kubevirt.io/v1alpha1/namespaces/default/virtualmachines/testvm"),
+					ghttp.RespondWithJSONEncoded(http.StatusOK, vm),
+				),
+			)
+			domainManager.EXPECT().KillVM(v1.NewVMReferenceFromName("testvm")).Return(nil)
+			domainManager.EXPECT().RemoveVMSecrets(v1.NewVMReferenceFromName("testvm")).Return(nil)
+
+			dispatch.Execute(vmStore, vmQueue, "default/testvm")
+		})
 		It("should leave the Domain alone if the VM is migrating to its host", func() {
 			vm := v1.NewMinimalVM("testvm")
 			vm.Status.MigrationNodeName = "master"
+			migration := v1.NewMinimalMigration("testmigration", "testvm")
 			server.AppendHandlers(
 				ghttp.CombineHandlers(
-					ghttp.VerifyRequest("GET", "/apis/kubevirt.io/v1alpha1/namespaces/default/virtualmachines/testvm"),
+					ghttp.VerifyRequest("GET", "/apis/kubevirt.io/v1alpha1/namespaces/default/migrations"),
+					ghttp.RespondWithJSONEncoded(http.StatusOK, v1.MigrationList{Items: []v1.Migration{*migration}}),
+				),
+			)
+			domainManager.EXPECT().TuneMigration(vm, gomock.Any()).Return(nil)
+			vmStore.Add(vm)
+			dispatch.Execute(vmStore, vmQueue, "default/testvm")
+			Expect(server.ReceivedRequests()).To(HaveLen(1))
+		})
+		It("should abort the migration if the Migration was deleted", func() {
+			vm := v1.NewMinimalVM("testvm")
+			vm.Status.MigrationNodeName = "master"
+			vm.Status.Phase = v1.Migrating
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/apis/kubevirt.io/v1alpha1/namespaces/default/migrations"),
+					ghttp.RespondWithJSONEncoded(http.StatusOK, v1.MigrationList{}),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("PUT", "/apis/kubevirt.io/v1alpha1/namespaces/default/virtualmachines/testvm"),
 					ghttp.RespondWithJSONEncoded(http.StatusOK, vm),
 				),
 			)
+			domainManager.EXPECT().AbortJob(vm).Return(nil)
 			vmStore.Add(vm)
 			dispatch.Execute(vmStore, vmQueue, "default/testvm")
-
+			Expect(server.ReceivedRequests()).To(HaveLen(2))
 		})
 		It("should re-enqueue if the Key is unparseable", func() {
 			Expect(vmQueue.Len()).Should(Equal(0))
@@ -133,12 +187,468 @@ var _ = Describe("VM", func() {
 		)
 	})
 
+	Context("allocating MAC addresses", func() {
+		It("should store MACs which no other VM uses on the VM", func() {
+			vm := v1.NewMinimalVM("testvm")
+			other := v1.NewMinimalVM("othervm")
+			Expect(virtwrap.AllocateMACs(vm, map[string]string{})).To(Succeed())
+			other.ObjectMeta.Annotations = map[string]string{v1.MACAddressesAnnotation: vm.ObjectMeta.Annotations[v1.MACAddressesAnnotation]}
+			delete(vm.ObjectMeta.Annotations, v1.MACAddressesAnnotation)
+
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/apis/kubevirt.io/v1alpha1/virtualmachines"),
+					ghttp.RespondWithJSONEncoded(http.StatusOK, v1.VirtualMachineList{Items: []v1.VirtualMachine{*other}}),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("PUT", "/apis/kubevirt.io/v1alpha1/namespaces/default/virtualmachines/testvm"),
+					func(w http.ResponseWriter, r *http.Request) {
+						stored := v1.VirtualMachine{}
+						Expect(json.NewDecoder(r.Body).Decode(&stored)).To(Succeed())
+						Expect(virtwrap.NeedsMACs(&stored)).To(BeFalse())
+						ghttp.RespondWithJSONEncoded(http.StatusOK, stored)(w, r)
+					},
+				),
+			)
+			allocated, err := dispatch.(*VMHandlerDispatch).allocateMACs(vm)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(allocated.ObjectMeta.Annotations[v1.MACAddressesAnnotation]).ToNot(Equal(other.ObjectMeta.Annotations[v1.MACAddressesAnnotation]))
+			Expect(virtwrap.NeedsMACs(vm)).To(BeTrue())
+		})
+
+		It("should leave VMs with MACs alone", func() {
+			vm := v1.NewMinimalVM("testvm")
+			Expect(virtwrap.AllocateMACs(vm, map[string]string{})).To(Succeed())
+			allocated, err := dispatch.(*VMHandlerDispatch).allocateMACs(vm)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(allocated).To(BeIdenticalTo(vm))
+			Expect(server.ReceivedRequests()).To(BeEmpty())
+		})
+	})
+
+	Context("storing device addresses", func() {
+		allocations := []api.DeviceAllocation{
+			{Key: "disk/file//disks/root.img", Target: "vda", Address: &api.Address{Type: "pci", Domain: "0x0000", Bus: "0x00", Slot: "0x03", Function: "0x0"}},
+		}
+
+		It("should store the device addresses of the domain on the VM", func() {
+			vm := v1.NewMinimalVM("testvm")
+			domainManager.EXPECT().GetDeviceAllocations(vm).Return(allocations, nil)
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("PUT", "/apis/kubevirt.io/v1alpha1/namespaces/default/virtualmachines/testvm"),
+					func(w http.ResponseWriter, r *http.Request) {
+						stored := v1.VirtualMachine{}
+						Expect(json.NewDecoder(r.Body).Decode(&stored)).To(Succeed())
+						Expect(stored.ObjectMeta.Annotations).To(HaveKey(v1.DeviceAddressesAnnotation))
+						ghttp.RespondWithJSONEncoded(http.StatusOK, stored)(w, r)
+					},
+				),
+			)
+			updated, err := dispatch.(*VMHandlerDispatch).storeDeviceAllocations(vm)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(updated.ObjectMeta.Annotations).To(HaveKey(v1.DeviceAddressesAnnotation))
+			Expect(vm.ObjectMeta.Annotations).ToNot(HaveKey(v1.DeviceAddressesAnnotation))
+		})
+
+		It("should leave VMs with the current device addresses alone", func() {
+			vm := v1.NewMinimalVM("testvm")
+			changed, err := virtwrap.StoreDeviceAllocations(vm, allocations)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(changed).To(BeTrue())
+			domainManager.EXPECT().GetDeviceAllocations(vm).Return(allocations, nil)
+
+			updated, err := dispatch.(*VMHandlerDispatch).storeDeviceAllocations(vm)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(updated).To(BeIdenticalTo(vm))
+			Expect(server.ReceivedRequests()).To(BeEmpty())
+		})
+	})
+
+	Context("injecting the TPM secret", func() {
+		var vm *v1.VirtualMachine
+
+		BeforeEach(func() {
+			vm = v1.NewMinimalVM("testvm")
+			vm.Spec.Domain.Devices.TPM = &v1.TPM{
+				Backend:          v1.TPMBackend{Type: "emulator"},
+				EncryptionSecret: "tpmsecret",
+			}
+		})
+
+		It("should define a vtpm secret with the passphrase of the k8s secret", func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/api/v1/namespaces/default/secrets/tpmsecret"),
+					ghttp.RespondWithJSONEncoded(http.StatusOK, k8sv1.Secret{Data: map[string][]byte{"passphrase": []byte("secret")}}),
+				),
+			)
+			domainManager.EXPECT().SyncVMSecret(vm, "vtpm", "tpmsecret-default-testvm---", "secret").Return(nil)
+
+			updated, err := dispatch.(*VMHandlerDispatch).injectTPMSecret(vm)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(updated.Spec.Domain.Devices.TPM.EncryptionSecret).To(Equal("tpmsecret-default-testvm---"))
+		})
+
+		It("should keep the VM specific usage on the next sync", func() {
+			vm.Spec.Domain.Devices.TPM.EncryptionSecret = "tpmsecret-default-testvm---"
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/api/v1/namespaces/default/secrets/tpmsecret"),
+					ghttp.RespondWithJSONEncoded(http.StatusOK, k8sv1.Secret{Data: map[string][]byte{"passphrase": []byte("secret")}}),
+				),
+			)
+			domainManager.EXPECT().SyncVMSecret(vm, "vtpm", "tpmsecret-default-testvm---", "secret").Return(nil)
+
+			updated, err := dispatch.(*VMHandlerDispatch).injectTPMSecret(vm)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(updated.Spec.Domain.Devices.TPM.EncryptionSecret).To(Equal("tpmsecret-default-testvm---"))
+		})
+
+		It("should fail if the k8s secret has no passphrase", func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/api/v1/namespaces/default/secrets/tpmsecret"),
+					ghttp.RespondWithJSONEncoded(http.StatusOK, k8sv1.Secret{Data: map[string][]byte{"password": []byte("secret")}}),
+				),
+			)
+
+			_, err := dispatch.(*VMHandlerDispatch).injectTPMSecret(vm)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should leave TPMs without encryption alone", func() {
+			vm.Spec.Domain.Devices.TPM.EncryptionSecret = ""
+
+			updated, err := dispatch.(*VMHandlerDispatch).injectTPMSecret(vm)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(updated).To(BeIdenticalTo(vm))
+			Expect(server.ReceivedRequests()).To(BeEmpty())
+		})
+	})
+
+	Context("injecting the launch secret", func() {
+		var vm *v1.VirtualMachine
+
+		BeforeEach(func() {
+			vm = v1.NewMinimalVM("testvm")
+			vm.ObjectMeta.Annotations = map[string]string{v1.LaunchSecretAnnotation: "launchsecret"}
+		})
+
+		It("should inject the k8s secret and remove the annotation", func() {
+			domainManager.EXPECT().WaitsForLaunchSecret(vm).Return(true, nil)
+			domainManager.EXPECT().InjectLaunchSecret(vm, "aGVhZGVy", "c2VjcmV0", virtwrap.TriggerVMController).Return(nil)
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/api/v1/namespaces/default/secrets/launchsecret"),
+					ghttp.RespondWithJSONEncoded(http.StatusOK, k8sv1.Secret{Data: map[string][]byte{"packetHeader": []byte("header"), "secret": []byte("secret")}}),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("PUT", "/apis/kubevirt.io/v1alpha1/namespaces/default/virtualmachines/testvm"),
+					func(w http.ResponseWriter, r *http.Request) {
+						stored := v1.VirtualMachine{}
+						Expect(json.NewDecoder(r.Body).Decode(&stored)).To(Succeed())
+						Expect(stored.ObjectMeta.Annotations).ToNot(HaveKey(v1.LaunchSecretAnnotation))
+						ghttp.RespondWithJSONEncoded(http.StatusOK, stored)(w, r)
+					},
+				),
+			)
+
+			updated, err := dispatch.(*VMHandlerDispatch).injectLaunchSecret(vm)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(updated.ObjectMeta.Annotations).ToNot(HaveKey(v1.LaunchSecretAnnotation))
+		})
+
+		It("should wait until the guest waits for its launch secret", func() {
+			domainManager.EXPECT().WaitsForLaunchSecret(vm).Return(false, nil)
+
+			updated, err := dispatch.(*VMHandlerDispatch).injectLaunchSecret(vm)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(updated).To(BeIdenticalTo(vm))
+			Expect(server.ReceivedRequests()).To(BeEmpty())
+		})
+
+		It("should fail if the k8s secret has no packet header", func() {
+			domainManager.EXPECT().WaitsForLaunchSecret(vm).Return(true, nil)
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/api/v1/namespaces/default/secrets/launchsecret"),
+					ghttp.RespondWithJSONEncoded(http.StatusOK, k8sv1.Secret{Data: map[string][]byte{"secret": []byte("secret")}}),
+				),
+			)
+
+			_, err := dispatch.(*VMHandlerDispatch).injectLaunchSecret(vm)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("starting memory dumps", func() {
+		var vm *v1.VirtualMachine
+
+		expectAnnotationRemoval := func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("PUT", "/apis/kubevirt.io/v1alpha1/namespaces/default/virtualmachines/testvm"),
+					func(w http.ResponseWriter, r *http.Request) {
+						stored := v1.VirtualMachine{}
+						Expect(json.NewDecoder(r.Body).Decode(&stored)).To(Succeed())
+						Expect(stored.ObjectMeta.Annotations).ToNot(HaveKey(v1.MemoryDumpAnnotation))
+						Expect(stored.ObjectMeta.Annotations).To(HaveKey(v1.MemoryDumpClaimAnnotation))
+						ghttp.RespondWithJSONEncoded(http.StatusOK, stored)(w, r)
+					},
+				),
+			)
+		}
+
+		BeforeEach(func() {
+			vm = v1.NewMinimalVM("testvm")
+			vm.ObjectMeta.Annotations = map[string]string{
+				v1.MemoryDumpClaimAnnotation: "dumps",
+				v1.MemoryDumpAnnotation:      `{"path": "testvm.kdump", "format": "kdump-zlib"}`,
+			}
+		})
+
+		It("should start the requested dump and remove the annotation", func() {
+			domainManager.EXPECT().MemoryDump(vm, "testvm.kdump", "kdump-zlib", virtwrap.TriggerVMController).Return("1234", nil)
+			expectAnnotationRemoval()
+
+			updated, err := dispatch.(*VMHandlerDispatch).startMemoryDump(vm)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(updated.ObjectMeta.Annotations).ToNot(HaveKey(v1.MemoryDumpAnnotation))
+		})
+
+		It("should drop requests which can't be served", func() {
+			vm.ObjectMeta.Annotations[v1.MemoryDumpAnnotation] = `{"path": "../testvm.kdump"}`
+			expectAnnotationRemoval()
+
+			updated, err := dispatch.(*VMHandlerDispatch).startMemoryDump(vm)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(updated.ObjectMeta.Annotations).ToNot(HaveKey(v1.MemoryDumpAnnotation))
+		})
+
+		It("should leave VMs without a request alone", func() {
+			delete(vm.ObjectMeta.Annotations, v1.MemoryDumpAnnotation)
+
+			updated, err := dispatch.(*VMHandlerDispatch).startMemoryDump(vm)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(updated).To(BeIdenticalTo(vm))
+			Expect(server.ReceivedRequests()).To(BeEmpty())
+		})
+	})
+
+	Context("cancelling jobs", func() {
+		var vm *v1.VirtualMachine
+
+		BeforeEach(func() {
+			vm = v1.NewMinimalVM("testvm")
+			vm.ObjectMeta.Annotations = map[string]string{v1.CancelJobAnnotation: "1234"}
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("PUT", "/apis/kubevirt.io/v1alpha1/namespaces/default/virtualmachines/testvm"),
+					func(w http.ResponseWriter, r *http.Request) {
+						stored := v1.VirtualMachine{}
+						Expect(json.NewDecoder(r.Body).Decode(&stored)).To(Succeed())
+						Expect(stored.ObjectMeta.Annotations).ToNot(HaveKey(v1.CancelJobAnnotation))
+						ghttp.RespondWithJSONEncoded(http.StatusOK, stored)(w, r)
+					},
+				),
+			)
+		})
+
+		It("should cancel the job and remove the annotation", func() {
+			domainManager.EXPECT().CancelJob(vm, "1234", virtwrap.TriggerVMController).Return(nil)
+
+			updated, err := dispatch.(*VMHandlerDispatch).cancelJob(vm)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(updated.ObjectMeta.Annotations).ToNot(HaveKey(v1.CancelJobAnnotation))
+		})
+
+		It("should drop requests for unknown jobs", func() {
+			domainManager.EXPECT().CancelJob(vm, "1234", virtwrap.TriggerVMController).Return(fmt.Errorf("job 1234 does not exist"))
+
+			updated, err := dispatch.(*VMHandlerDispatch).cancelJob(vm)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(updated.ObjectMeta.Annotations).ToNot(HaveKey(v1.CancelJobAnnotation))
+		})
+	})
+
+	Context("injecting disk encryption secrets", func() {
+		var vm *v1.VirtualMachine
+
+		BeforeEach(func() {
+			vm = v1.NewMinimalVM("testvm")
+			vm.Spec.Domain.Devices.Disks = []v1.Disk{{
+				Type:   "file",
+				Target: v1.DiskTarget{Device: "vda"},
+				Encryption: &v1.DiskEncryption{
+					Format: "luks",
+					Secret: &v1.DiskSecret{Usage: "disksecret"},
+				},
+			}}
+		})
+
+		It("should define a volume secret with the passphrase of the k8s secret", func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/api/v1/namespaces/default/secrets/disksecret"),
+					ghttp.RespondWithJSONEncoded(http.StatusOK, k8sv1.Secret{Data: map[string][]byte{"passphrase": []byte("secret")}}),
+				),
+			)
+			domainManager.EXPECT().SyncVMSecret(vm, "volume", "disksecret-default-testvm---", "secret").Return(nil)
+
+			updated, err := dispatch.(*VMHandlerDispatch).injectDiskEncryption(vm)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(*updated.Spec.Domain.Devices.Disks[0].Encryption.Secret).To(Equal(v1.DiskSecret{Type: "passphrase", Usage: "disksecret-default-testvm---"}))
+		})
+
+		It("should fail if the k8s secret can't be found", func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/api/v1/namespaces/default/secrets/disksecret"),
+					ghttp.RespondWithJSONEncoded(http.StatusNotFound, struct{}{}),
+				),
+			)
+
+			_, err := dispatch.(*VMHandlerDispatch).injectDiskEncryption(vm)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should reject unsupported encryption formats", func() {
+			vm.Spec.Domain.Devices.Disks[0].Encryption.Format = "qcow"
+
+			_, err := dispatch.(*VMHandlerDispatch).injectDiskEncryption(vm)
+			Expect(err).To(HaveOccurred())
+			Expect(server.ReceivedRequests()).To(BeEmpty())
+		})
+
+		It("should reject encrypted disks without passphrase secret", func() {
+			vm.Spec.Domain.Devices.Disks[0].Encryption.Secret = nil
+
+			_, err := dispatch.(*VMHandlerDispatch).injectDiskEncryption(vm)
+			Expect(err).To(HaveOccurred())
+			Expect(server.ReceivedRequests()).To(BeEmpty())
+		})
+	})
+
+	Context("tuning the cgroups of a running VM", func() {
+		It("should align the memory limits with the resources of the compute container", func() {
+			vm := v1.NewMinimalVM("testvm")
+			resources := k8sv1.ResourceRequirements{
+				Requests: k8sv1.ResourceList{k8sv1.ResourceMemory: resource.MustParse("1Gi")},
+				Limits:   k8sv1.ResourceList{k8sv1.ResourceMemory: resource.MustParse("2Gi")},
+			}
+			pod := k8sv1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "virt-launcher-testvm", Namespace: "default"},
+				Spec: k8sv1.PodSpec{Containers: []k8sv1.Container{
+					{Name: "compute", Resources: resources},
+				}},
+			}
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/api/v1/namespaces/default/pods"),
+					ghttp.RespondWithJSONEncoded(http.StatusOK, k8sv1.PodList{Items: []k8sv1.Pod{pod}}),
+				),
+			)
+			domainManager.EXPECT().TuneMemory(vm, virtwrap.MemoryTuningForResources(resources), virtwrap.TriggerVMController).Return(nil)
+
+			Expect(dispatch.(*VMHandlerDispatch).tuneCgroups(vm)).To(Succeed())
+		})
+
+		It("should set the blkio weight of the VM", func() {
+			vm := v1.NewMinimalVM("testvm")
+			vm.ObjectMeta.Annotations = map[string]string{v1.BlkioWeightAnnotation: "500"}
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/api/v1/namespaces/default/pods"),
+					ghttp.RespondWithJSONEncoded(http.StatusOK, k8sv1.PodList{}),
+				),
+			)
+			weight := uint(500)
+			domainManager.EXPECT().TuneBlkio(vm, &cli.BlkioTuning{Weight: &weight}, virtwrap.TriggerVMController).Return(nil)
+
+			Expect(dispatch.(*VMHandlerDispatch).tuneCgroups(vm)).To(Succeed())
+		})
+	})
+
+	Context("updating the status of a running VM", func() {
+		var vm *v1.VirtualMachine
+
+		BeforeEach(func() {
+			vm = v1.NewMinimalVM("testvm")
+			vm.Status.Phase = v1.Running
+			vm.Status.NodeName = "master"
+			domainManager.EXPECT().GuestNetworkStatus(gomock.Any()).Return(nil, nil)
+		})
+
+		It("should report the filesystems of the guest", func() {
+			used, total := uint64(10), uint64(100)
+			filesystems := []v1.VMFilesystem{{MountPoint: "/", Type: "ext4", UsedBytes: &used, TotalBytes: &total}}
+			domainManager.EXPECT().AgentConnected(gomock.Any()).Return(true, nil)
+			domainManager.EXPECT().GuestFilesystemInfo(gomock.Any()).Return(filesystems, nil)
+			node := k8sv1.Node{Status: k8sv1.NodeStatus{Addresses: []k8sv1.NodeAddress{{Type: k8sv1.NodeInternalIP, Address: "127.0.0.1"}}}}
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/api/v1/nodes/master"),
+					ghttp.RespondWithJSONEncoded(http.StatusOK, node),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("PUT", "/apis/kubevirt.io/v1alpha1/namespaces/default/virtualmachines/testvm"),
+					func(w http.ResponseWriter, r *http.Request) {
+						updated := v1.VirtualMachine{}
+						Expect(json.NewDecoder(r.Body).Decode(&updated)).To(Succeed())
+						Expect(updated.Status.Filesystems).To(Equal(filesystems))
+					},
+					ghttp.RespondWithJSONEncoded(http.StatusOK, vm),
+				),
+			)
+
+			Expect(dispatch.(*VMHandlerDispatch).updateVMStatus(vm, &api.DomainSpec{})).To(Succeed())
+			Expect(server.ReceivedRequests()).To(HaveLen(2))
+		})
+
+		It("should not ask for the filesystems without a guest agent", func() {
+			domainManager.EXPECT().AgentConnected(gomock.Any()).Return(false, nil)
+
+			Expect(dispatch.(*VMHandlerDispatch).updateVMStatus(vm, &api.DomainSpec{})).To(Succeed())
+			Expect(server.ReceivedRequests()).To(BeEmpty())
+		})
+	})
+
 	AfterEach(func() {
 		server.Close()
 		ctrl.Finish()
 	})
 })
 
+var _ = Describe("Guest filesystems", func() {
+	size := func(bytes uint64) *uint64 { return &bytes }
+
+	table.DescribeTable("should tell whether they changed", func(old []v1.VMFilesystem, current []v1.VMFilesystem, changed bool) {
+		Expect(filesystemsChanged(old, current)).To(Equal(changed))
+	},
+		table.Entry("not if they are the same",
+			[]v1.VMFilesystem{{MountPoint: "/", Type: "ext4", UsedBytes: size(10), TotalBytes: size(1000)}},
+			[]v1.VMFilesystem{{MountPoint: "/", Type: "ext4", UsedBytes: size(10), TotalBytes: size(1000)}},
+			false),
+		table.Entry("not if the usage changed by less than a percent",
+			[]v1.VMFilesystem{{MountPoint: "/", Type: "ext4", UsedBytes: size(10), TotalBytes: size(1000)}},
+			[]v1.VMFilesystem{{MountPoint: "/", Type: "ext4", UsedBytes: size(15), TotalBytes: size(1000)}},
+			false),
+		table.Entry("if the usage changed by more than a percent",
+			[]v1.VMFilesystem{{MountPoint: "/", Type: "ext4", UsedBytes: size(30), TotalBytes: size(1000)}},
+			[]v1.VMFilesystem{{MountPoint: "/", Type: "ext4", UsedBytes: size(10), TotalBytes: size(1000)}},
+			true),
+		table.Entry("if a filesystem was mounted",
+			[]v1.VMFilesystem{{MountPoint: "/", Type: "ext4"}},
+			[]v1.VMFilesystem{{MountPoint: "/", Type: "ext4"}, {MountPoint: "/home", Type: "xfs"}},
+			true),
+		table.Entry("if the guest agent went away",
+			[]v1.VMFilesystem{{MountPoint: "/", Type: "ext4"}},
+			nil,
+			true),
+	)
+})
+
 var _ = Describe("PVC", func() {
 	RegisterFailHandler(Fail)
 
@@ -231,6 +741,74 @@ var _ = Describe("PVC", func() {
 			Expect(newDisk.Source.Protocol).To(Equal("iscsi"))
 			Expect(newDisk.Source.Name).To(Equal("iqn.2009-02.com.test:for.all/1"))
 		})
+		It("should use the first reachable iSCSI portal", func() {
+			originalDialPortal := dialPortal
+			defer func() { dialPortal = originalDialPortal }()
+			dialPortal = func(address string) error {
+				if address == "127.0.0.2:3260" {
+					return nil
+				}
+				return fmt.Errorf("connection refused")
+			}
+
+			initiator := "iqn.2017-10.io.kubevirt:node01"
+			expectedPV.Spec.ISCSI.Portals = []string{"127.0.0.2"}
+			expectedPV.Spec.ISCSI.InitiatorName = &initiator
+			disk := v1.Disk{
+				Type: "PersistentVolumeClaim",
+				Source: v1.DiskSource{
+					Name: "test-claim",
+				},
+				Target: v1.DiskTarget{
+					Device: "vda",
+				},
+			}
+			newDisk, err := mapPVToDisk(&disk, &expectedPV)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(newDisk.Source.Host).To(Equal(&v1.DiskSourceHost{Name: "127.0.0.2"}))
+			Expect(newDisk.Source.Hosts).To(BeEmpty())
+			Expect(newDisk.Source.Initiator).To(Equal(&v1.DiskSourceInitiator{IQN: initiator}))
+		})
+		It("should fall back to the first iSCSI portal if none is reachable", func() {
+			originalDialPortal := dialPortal
+			defer func() { dialPortal = originalDialPortal }()
+			dialPortal = func(address string) error {
+				return fmt.Errorf("connection refused")
+			}
+
+			host, err := selectISCSIPortal([]string{"127.0.0.1:6543", "127.0.0.2"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(host).To(Equal(&v1.DiskSourceHost{Name: "127.0.0.1", Port: "6543"}))
+		})
+		It("should map Ceph RBD PVs to network disks", func() {
+			expectedPV.Spec.ISCSI = nil
+			expectedPV.Spec.RBD = &k8sv1.RBDVolumeSource{
+				CephMonitors: []string{"127.0.0.1:6789", "127.0.0.2:6789"},
+				RBDImage:     "testimage",
+				RadosUser:    "kubevirt",
+				SecretRef:    &k8sv1.LocalObjectReference{Name: "ceph-secret"},
+			}
+			disk := v1.Disk{
+				Type: "PersistentVolumeClaim",
+				Source: v1.DiskSource{
+					Name: "test-claim",
+				},
+				Target: v1.DiskTarget{
+					Device: "vda",
+				},
+			}
+			newDisk, err := mapPVToDisk(&disk, &expectedPV)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(newDisk.Type).To(Equal("network"))
+			Expect(newDisk.Source.Protocol).To(Equal("rbd"))
+			Expect(newDisk.Source.Name).To(Equal("rbd/testimage"))
+			Expect(newDisk.Source.Host).To(Equal(&v1.DiskSourceHost{Name: "127.0.0.1", Port: "6789"}))
+			Expect(newDisk.Source.Hosts).To(Equal([]v1.DiskSourceHost{{Name: "127.0.0.2", Port: "6789"}}))
+			Expect(newDisk.Auth).To(Equal(&v1.DiskAuth{
+				Username: "kubevirt",
+				Secret:   &v1.DiskSecret{Type: "ceph", Usage: "ceph-secret"},
+			}))
+		})
 		It("should fail on unsupported PV disk types", func() {
 			expectedPV.Spec.ISCSI = nil
 			expectedPV.Spec.CephFS = &k8sv1.CephFSPersistentVolumeSource{}
@@ -35,7 +35,7 @@ import (
 type monitor struct {
 	timeout         time.Duration
 	pid             int
-	exename         string
+	exenames        []string
 	start           time.Time
 	isDone          bool
 	forwardedSignal os.Signal
@@ -46,13 +46,20 @@ type ProcessMonitor interface {
 	RunForever(startTimeout time.Duration)
 }
 
-func NewProcessMonitor(execname string, debugMode bool) ProcessMonitor {
+// NewProcessMonitor creates a monitor for the first process it finds whose
+// executable starts with one of the names, e.g. one per VMM virt-handler may
+// start.
+func NewProcessMonitor(execnames []string, debugMode bool) ProcessMonitor {
 	return &monitor{
-		exename:   execname,
+		exenames:  execnames,
 		debugMode: debugMode,
 	}
 }
 
+func (mon *monitor) exename() string {
+	return strings.Join(mon.exenames, "|")
+}
+
 func (mon *monitor) refresh() {
 	if mon.isDone {
 		log.Print("Called refresh after done!")
@@ -60,23 +67,27 @@ func (mon *monitor) refresh() {
 	}
 
 	if mon.debugMode {
-		log.Printf("Refreshing executable %s pid %d", mon.exename, mon.pid)
+		log.Printf("Refreshing executable %s pid %d", mon.exename(), mon.pid)
 	}
 
 	// is the process there?
 	if mon.pid == 0 {
 		var err error
-		mon.pid, err = pidOf(mon.exename)
+		for _, exename := range mon.exenames {
+			if mon.pid, err = pidOf(exename); err == nil {
+				break
+			}
+		}
 		if err == nil {
-			log.Printf("Found PID for %s: %d", mon.exename, mon.pid)
+			log.Printf("Found PID for %s: %d", mon.exename(), mon.pid)
 		} else {
 			if mon.debugMode {
-				log.Printf("Missing PID for %s", mon.exename)
+				log.Printf("Missing PID for %s", mon.exename())
 			}
 			// if the proces is not there yet, is it too late?
 			elapsed := time.Since(mon.start)
 			if mon.timeout > 0 && elapsed >= mon.timeout {
-				log.Printf("%s not found after timeout", mon.exename)
+				log.Printf("%s not found after timeout", mon.exename())
 				mon.isDone = true
 			}
 		}
@@ -90,7 +101,7 @@ func (mon *monitor) refresh() {
 	// and open it only when needed, which is a tiny part of the
 	// virt-launcher lifetime.
 	if !pidExists(mon.pid) {
-		log.Printf("Process %s is gone!", mon.exename)
+		log.Printf("Process %s is gone!", mon.exename())
 		mon.pid = 0
 		mon.isDone = true
 		return
@@ -82,7 +82,7 @@ var _ = Describe("VirtLauncher", func() {
 
 	BeforeEach(func() {
 		mon = &monitor{
-			exename:   processName,
+			exenames:  []string{processName},
 			debugMode: true,
 		}
 	})
@@ -97,6 +97,15 @@ var _ = Describe("VirtLauncher", func() {
 				VerifyProcessStopped()
 			})
 
+			It("verify pid detection works with several process names", func() {
+				mon.exenames = []string{"no-such-process", processName}
+				StartProcess()
+				VerifyProcessStarted()
+				StopProcess()
+				CleanupProcess()
+				VerifyProcessStopped()
+			})
+
 			It("verify start timeout works", func() {
 				done := make(chan string)
 
@@ -21,6 +21,7 @@ package console
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
@@ -28,6 +29,7 @@ import (
 	"net/url"
 	"os"
 	"os/signal"
+	"text/tabwriter"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -36,14 +38,26 @@ import (
 	"k8s.io/api/core/v1"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+
+	"kubevirt.io/kubevirt/pkg/kubecli"
 )
 
 type Console struct {
 }
 
+// consoleDevice is a console device as listed by virt-handler
+type consoleDevice struct {
+	Name   string `json:"name"`
+	Kind   string `json:"kind"`
+	Type   string `json:"type"`
+	Target string `json:"target,omitempty"`
+}
+
 func (c *Console) FlagSet() *flag.FlagSet {
 	cf := flag.NewFlagSet("console", flag.ExitOnError)
 	cf.StringP("device", "d", "", "Console to connect to")
+	cf.Bool("force", true, "Take over the console if it is already in use")
+	cf.BoolP("list", "l", false, "List the consoles of the VM instead of connecting to one")
 
 	return cf
 }
@@ -53,6 +67,10 @@ func (c *Console) Usage() string {
 	usage += "Examples:\n"
 	usage += "# Connect to the console 'serial0' on the VM 'myvm':\n"
 	usage += "virtctl console myvm --device serial0\n\n"
+	usage += "# Connect to the guest agent channel on the VM 'myvm', unless it is in use:\n"
+	usage += "virtctl console myvm --device guestagent-channel --force=false\n\n"
+	usage += "# List the consoles of the VM 'myvm':\n"
+	usage += "virtctl console myvm --list\n\n"
 	usage += "Options:\n"
 	usage += c.FlagSet().FlagUsages()
 	return usage
@@ -64,6 +82,8 @@ func (c *Console) Run(flags *flag.FlagSet) int {
 	kubeconfig, _ := flags.GetString("kubeconfig")
 	namespace, _ := flags.GetString("namespace")
 	device, _ := flags.GetString("device")
+	force, _ := flags.GetBool("force")
+	list, _ := flags.GetBool("list")
 	if namespace == "" {
 		namespace = v1.NamespaceDefault
 	}
@@ -73,6 +93,14 @@ func (c *Console) Run(flags *flag.FlagSet) int {
 	}
 	vm := flags.Arg(1)
 
+	if list {
+		if err := listConsoles(server, kubeconfig, namespace, vm); err != nil {
+			log.Println(err)
+			return 1
+		}
+		return 0
+	}
+
 	config, err := clientcmd.BuildConfigFromFlags(server, kubeconfig)
 	if err != nil {
 		log.Println(err)
@@ -87,7 +115,7 @@ func (c *Console) Run(flags *flag.FlagSet) int {
 	}
 
 	// Create the basic console request
-	req, err := requestFromConfig(config, vm, namespace, device)
+	req, err := requestFromConfig(config, vm, namespace, device, force)
 	if err != nil {
 		log.Println(err)
 		return 1
@@ -103,6 +131,30 @@ func (c *Console) Run(flags *flag.FlagSet) int {
 	return 0
 }
 
+func listConsoles(server string, kubeconfig string, namespace string, vm string) error {
+	virtClient, err := kubecli.GetKubevirtClientFromFlags(server, kubeconfig)
+	if err != nil {
+		return err
+	}
+	body, err := virtClient.RestClient().Get().
+		Resource("virtualmachines").SubResource("consoles").
+		Namespace(namespace).Name(vm).Do().Raw()
+	if err != nil {
+		return fmt.Errorf("Can't list the consoles: %s", err.Error())
+	}
+	consoles := []consoleDevice{}
+	if err := json.Unmarshal(body, &consoles); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tKIND\tTYPE\tTARGET")
+	for _, console := range consoles {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", console.Name, console.Kind, console.Type, console.Target)
+	}
+	return w.Flush()
+}
+
 func WebsocketCallback(ws *websocket.Conn, resp *http.Response, err error) error {
 
 	if err != nil {
@@ -178,7 +230,7 @@ func WebsocketCallback(ws *websocket.Conn, resp *http.Response, err error) error
 	return nil
 }
 
-func requestFromConfig(config *rest.Config, vm string, namespace string, device string) (*http.Request, error) {
+func requestFromConfig(config *rest.Config, vm string, namespace string, device string, force bool) (*http.Request, error) {
 
 	u, err := url.Parse(config.Host)
 	if err != nil {
@@ -195,9 +247,14 @@ func requestFromConfig(config *rest.Config, vm string, namespace string, device
 	}
 
 	u.Path = fmt.Sprintf("/apis/kubevirt.io/v1alpha1/namespaces/%s/virtualmachines/%s/console", namespace, vm)
+	query := url.Values{}
 	if device != "" {
-		u.RawQuery = "console=" + device
+		query.Set("console", device)
+	}
+	if !force {
+		query.Set("force", "false")
 	}
+	u.RawQuery = query.Encode()
 	req := &http.Request{
 		Method: http.MethodGet,
 		URL:    u,